@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/qiangli/shell/sh"
 	"github.com/qiangli/shell/vfs"
+	"github.com/qiangli/shell/vnet"
 	"github.com/qiangli/shell/vos"
 )
 
@@ -26,18 +29,49 @@ func main() {
 	home, _ := os.UserHomeDir()
 	tmpdir := os.TempDir()
 
-	lfs, _ := vfs.NewLocalFS([]string{ws, home, tmpdir})
-	los, _ := vos.NewLocalSystem(lfs)
+	var opts []vfs.LocalOption
+	if cache, err := os.UserCacheDir(); err == nil {
+		opts = append(opts, vfs.WithIndex(filepath.Join(cache, "shell", "index")))
+	}
+	lfs, _ := vfs.NewLocalFS([]string{ws, home, tmpdir}, opts...)
+	wfs := checkpoints(lfs, ws)
+	los, _ := vos.NewLocalSystem(wfs)
 	los.Exitf = func(code int) {
 		fmt.Printf("exit %v\n", code)
 		os.Exit(code)
 	}
 
 	ioe := &sh.IOE{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
-	vs := sh.NewVirtualSystem(los, lfs, ioe)
+	vs := sh.NewVirtualSystem(los, wfs, ioe)
+	network, err := vnet.PolicyFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	vs.Network = network
 	vs.ExecHandler = sh.NewDummyExecHandler(vs)
 
 	if err := sh.Gosh(context.Background(), vs, script, args); err != nil {
 		os.Exit(1)
 	}
 }
+
+// checkpoints enables the checkpoint builtin with snapshots kept in the
+// user cache directory per workspace root, if GOSH_CHECKPOINTS is set.
+func checkpoints(lfs vfs.Workspace, root string) vfs.Workspace {
+	if os.Getenv("GOSH_CHECKPOINTS") == "" {
+		return lfs
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return lfs
+	}
+	sum := sha256.Sum256([]byte(root))
+	dir := filepath.Join(cache, "shell", "checkpoints", hex.EncodeToString(sum[:8]))
+	cws, err := vfs.NewCheckpointWorkspace(lfs, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "checkpoints disabled: %v\n", err)
+		return lfs
+	}
+	return cws
+}
@@ -2,21 +2,45 @@ package sh
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"strings"
 
+	"github.com/qiangli/shell/tool/core/awk"
 	// "github.com/qiangli/shell/tool/core/backoff"
 	"github.com/qiangli/shell/tool/core/basename"
 	"github.com/qiangli/shell/tool/core/cat"
+	"github.com/qiangli/shell/tool/core/checkpoint"
+	"github.com/qiangli/shell/tool/core/column"
+	"github.com/qiangli/shell/tool/core/comm"
+	"github.com/qiangli/shell/tool/core/curl"
+	"github.com/qiangli/shell/tool/core/cut"
 	"github.com/qiangli/shell/tool/core/date"
+	"github.com/qiangli/shell/tool/core/diff"
 	"github.com/qiangli/shell/tool/core/dirname"
+	"github.com/qiangli/shell/tool/core/expand"
+	"github.com/qiangli/shell/tool/core/fold"
+	"github.com/qiangli/shell/tool/core/grep"
 	"github.com/qiangli/shell/tool/core/head"
+	"github.com/qiangli/shell/tool/core/join"
+	"github.com/qiangli/shell/tool/core/jq"
+	"github.com/qiangli/shell/tool/core/nl"
+	"github.com/qiangli/shell/tool/core/paste"
+	"github.com/qiangli/shell/tool/core/patch"
+	"github.com/qiangli/shell/tool/core/sed"
 	"github.com/qiangli/shell/tool/core/sleep"
+	"github.com/qiangli/shell/tool/core/sort"
+	"github.com/qiangli/shell/tool/core/symbols"
 	"github.com/qiangli/shell/tool/core/tail"
 	"github.com/qiangli/shell/tool/core/time"
+	"github.com/qiangli/shell/tool/core/tr"
 
 	"github.com/qiangli/shell/tool/core/tac"
 	"github.com/qiangli/shell/tool/core/wget"
+	"github.com/qiangli/shell/tool/core/yq"
 
 	"github.com/u-root/u-root/pkg/core"
 	"github.com/u-root/u-root/pkg/core/base64"
@@ -34,15 +58,16 @@ import (
 	"github.com/u-root/u-root/pkg/core/touch"
 	"github.com/u-root/u-root/pkg/core/xargs"
 	"golang.org/x/exp/slices"
+	"mvdan.cc/sh/v3/interp"
+
+	"github.com/qiangli/shell/vfs"
 )
 
 // https://github.com/u-root/u-root/tree/main/cmds/core
 // tool/core/cmp/
 //
-// tool/core/grep/
 // tool/core/md5sum/
 // tool/core/seq/
-// tool/core/sort/
 // tool/core/tee/
 // tool/core/truncate/
 // tool/core/uniq/
@@ -51,8 +76,10 @@ import (
 
 // internal commands
 var CoreUtilsCommands = []string{
-	"base64", "basename", "cat", "chmod", "cp", "date", "dirname", "find", "gzip", "head", "ls", "mkdir",
-	"mktemp", "mv", "rm", "shasum", "sleep", "tac", "tail", "tar", "time", "touch", "wget", "xargs",
+	"awk", "base64", "basename", "cat", "checkpoint", "chmod", "column", "comm", "cp", "curl", "cut", "date", "diff",
+	"dirname", "expand", "find", "fold", "grep", "gzip", "head", "join", "jq", "ls", "mkdir", "mktemp", "mv", "nl",
+	"paste", "patch", "rm", "sed", "shasum", "sleep", "sort", "symbols", "tac", "tail", "tar", "time", "touch", "tr",
+	"wget", "xargs", "yq",
 }
 
 // bash commands
@@ -96,15 +123,38 @@ type virtualFS struct {
 }
 
 func (r *virtualFS) Open(s string) (fs.File, error) {
-	return r.vs.Workspace.OpenFile(s, os.O_RDWR, 0o755)
+	return r.vs.Workspace.OpenFile(s, os.O_RDONLY, 0)
+}
+
+// Watch reports the changes of the path in the workspace.
+func (r *virtualFS) Watch(ctx context.Context, path string, recursive bool) (<-chan vfs.Event, error) {
+	return vfs.Watch(ctx, r.vs.Workspace, path, recursive)
 }
 
 func RunCoreUtils(ctx context.Context, vs *VirtualSystem, args []string) (bool, error) {
+	// the stdio of the runner, which may be redirected or piped
+	hc := interp.HandlerCtx(ctx)
+	var stdin io.Reader = strings.NewReader("")
+	if hc.Stdin != nil {
+		stdin = hc.Stdin
+	}
 	runCmd := func(cmd core.Command) (bool, error) {
-		cmd.SetIO(vs.IOE.Stdin, vs.IOE.Stdout, vs.IOE.Stderr)
+		cmd.SetIO(stdin, hc.Stdout, hc.Stderr)
 		workdir, _ := vs.System.Getwd()
 		cmd.SetWorkingDir(workdir)
 		err := cmd.RunContext(ctx, args[1:]...)
+		// report the exit status instead of stopping the script
+		var exit interface {
+			error
+			ExitCode() int
+			Unwrap() error
+		}
+		if errors.As(err, &exit) {
+			if cause := exit.Unwrap(); cause != nil {
+				fmt.Fprintf(hc.Stderr, "%s: %v\n", args[0], cause)
+			}
+			return true, interp.ExitStatus(exit.ExitCode())
+		}
 		return true, err
 	}
 
@@ -116,6 +166,8 @@ func RunCoreUtils(ctx context.Context, vs *VirtualSystem, args []string) (bool,
 	}
 
 	switch args[0] {
+	case "awk":
+		return runCmd(awk.New(awk.OpenFunc(VirtualOpenHandler(vs)), awkExec(vs)))
 	// case "backoff":
 	// 	return runCmd(backoff.New())
 	case "base64":
@@ -124,20 +176,46 @@ func RunCoreUtils(ctx context.Context, vs *VirtualSystem, args []string) (bool,
 		return runCmd(basename.New())
 	case "cat":
 		return runCmd(cat.New(fs))
+	case "checkpoint":
+		cp, ok := vfs.Lookup[vfs.Checkpointer](vs.Workspace)
+		if !ok {
+			return true, fmt.Errorf("checkpoint: not supported by the workspace")
+		}
+		return runCmd(checkpoint.New(cp))
 	case "chmod":
 		return runCmd(chmod.New())
+	case "column":
+		return runCmd(column.New(fs))
+	case "comm":
+		return runCmd(comm.New(fs))
 	case "cp":
 		return runCmd(cp.New())
+	case "curl":
+		return runCmd(curl.New(vs.Workspace, vs.Network))
+	case "cut":
+		return runCmd(cut.New(fs))
 	case "date":
 		return runCmd(date.New())
+	case "diff":
+		return runCmd(diff.New(vs.Workspace))
 	case "dirname":
 		return runCmd(dirname.New())
+	case "expand":
+		return runCmd(expand.New(fs))
 	case "find":
 		return runCmd(find.New())
+	case "fold":
+		return runCmd(fold.New(fs))
+	case "grep":
+		return runCmd(grep.New(fs))
 	case "gzip":
 		return runCmd(gzip.New())
 	case "head":
 		return runCmd(head.New(fs))
+	case "join":
+		return runCmd(join.New(fs))
+	case "jq":
+		return runCmd(jq.New(fs))
 	case "ls":
 		return runCmd(ls.New())
 	case "mkdir":
@@ -146,12 +224,24 @@ func RunCoreUtils(ctx context.Context, vs *VirtualSystem, args []string) (bool,
 		return runCmd(mktemp.New())
 	case "mv":
 		return runCmd(mv.New())
+	case "nl":
+		return runCmd(nl.New(fs))
+	case "paste":
+		return runCmd(paste.New(fs))
+	case "patch":
+		return runCmd(patch.New(vs.Workspace))
 	case "rm":
 		return runCmd(rm.New())
+	case "sed":
+		return runCmd(sed.New(vs.Workspace))
 	case "shasum":
 		return runCmd(shasum.New())
 	case "sleep":
 		return runCmd(sleep.New())
+	case "sort":
+		return runCmd(sort.New(vs.Workspace))
+	case "symbols":
+		return runCmd(symbols.New(vs.Workspace))
 	case "tac":
 		return runCmd(tac.New(fs))
 	case "tail":
@@ -162,11 +252,40 @@ func RunCoreUtils(ctx context.Context, vs *VirtualSystem, args []string) (bool,
 		return runCmd(time.New())
 	case "touch":
 		return runCmd(touch.New())
+	case "tr":
+		return runCmd(tr.New())
 	case "wget":
-		return runCmd(wget.New())
+		return runCmd(wget.New(vs.Workspace, vs.Network))
 	case "xargs":
 		return runCmd(xargs.New())
+	case "yq":
+		return runCmd(yq.New(vs.Workspace))
 	default:
 		return false, nil
 	}
 }
+
+// awkExec runs the command lines of awk in a new runner of the virtual
+// system, in the directory and environment of the current one.
+func awkExec(vs *VirtualSystem) awk.ExecFunc {
+	return func(ctx context.Context, cmdline string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+		hc := interp.HandlerCtx(ctx)
+		r, err := vs.NewRunner()
+		if err != nil {
+			return 0, err
+		}
+		interp.Env(hc.Env)(r)
+		if err := interp.Dir(hc.Dir)(r); err != nil {
+			return 0, err
+		}
+		if err := interp.StdIO(stdin, stdout, stderr)(r); err != nil {
+			return 0, err
+		}
+		err = run(ctx, r, strings.NewReader(cmdline), "")
+		var status interp.ExitStatus
+		if errors.As(err, &status) {
+			return int(status), nil
+		}
+		return 0, err
+	}
+}
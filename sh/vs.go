@@ -12,6 +12,7 @@ import (
 	"mvdan.cc/sh/v3/syntax"
 
 	"github.com/qiangli/shell/vfs"
+	"github.com/qiangli/shell/vnet"
 	"github.com/qiangli/shell/vos"
 )
 
@@ -26,6 +27,11 @@ type VirtualSystem struct {
 
 	ExecHandler ExecHandler
 
+	// Network restricts the hosts and responses of curl and wget,
+	// unrestricted if nil. Set MaxBytes to bound the size of downloads.
+	// gosh configures it with vnet.PolicyFromEnv.
+	Network *vnet.Policy
+
 	MaxTimeout int
 }
 
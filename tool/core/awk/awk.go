@@ -0,0 +1,255 @@
+// Awk scans and processes patterns.
+//
+// Synopsis:
+//
+//	awk [-F FS] [-v VAR=VALUE]... {PROGRAM | -f FILE...} [FILE | VAR=VALUE]...
+//
+// Description:
+//
+//	Awk runs the POSIX awk program on the records of the files, or of
+//	stdin. The program is the first operand unless -f is given. Operands
+//	of the form VAR=VALUE assign the variable before the next file is
+//	read. Regular expressions are POSIX extended ones.
+//
+//	The program can not reach past the environment of the shell: the
+//	input files, getline from files, output redirections and the -f files
+//	are opened through the open handler of the shell, and system(), the
+//	output pipes and getline from commands run the command lines through
+//	its exec handlers. Commands read no input except from an output pipe.
+//
+//	The elements of ENVIRON are looked up when they are used, and for-in
+//	loops take the numeric subscripts in order, then the others.
+//
+// Options:
+//
+//	-F, --field-separator FS: split the fields at FS, "t" being a TAB
+//	-f, --file FILE:          read the program from FILE
+//	-v, --assign VAR=VALUE:   assign VALUE to VAR before running the program
+package awk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// OpenFunc opens the file at path like os.OpenFile.
+type OpenFunc func(ctx context.Context, path string, flag int, perm fs.FileMode) (io.ReadWriteCloser, error)
+
+// ExecFunc runs the shell command line and returns its exit status.
+type ExecFunc func(ctx context.Context, cmdline string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+
+// command implements the awk core utility.
+type command struct {
+	core.Base
+
+	open OpenFunc
+	exec ExecFunc
+}
+
+// New creates a new awk command that opens files with open and runs
+// commands with exec. Either may be nil to deny the access.
+func New(open OpenFunc, exec ExecFunc) core.Command {
+	c := &command{
+		open: open,
+		exec: exec,
+	}
+	c.Init()
+	return c
+}
+
+// listFlag collects the values of a repeated option.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+type flags struct {
+	fs      string
+	files   listFlag
+	assigns listFlag
+}
+
+var valued = []string{"F", "field-separator", "f", "file", "v", "assign"}
+
+// options converts the options before the program, leaving the program
+// and the operands as they are.
+func options(args []string) []string {
+	i := 0
+	for ; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			i++
+			break
+		}
+		if len(a) < 2 || a[0] != '-' {
+			break
+		}
+		name, _, attached := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if strings.HasPrefix(a, "--") && !attached || len(a) == 2 {
+			for _, v := range valued {
+				if name == v {
+					i++
+					break
+				}
+			}
+		}
+	}
+	i = min(i, len(args))
+	return append(cli.Args(args[:i], valued...), args[i:]...)
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("awk", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.StringVar(&f.fs, "F", "", "split the fields at `FS`")
+	fs.StringVar(&f.fs, "field-separator", "", "split the fields at `FS`")
+	fs.Var(&f.files, "f", "read the program from `FILE`")
+	fs.Var(&f.files, "file", "read the program from `FILE`")
+	fs.Var(&f.assigns, "v", "assign `VAR=VALUE` before running the program")
+	fs.Var(&f.assigns, "assign", "assign `VAR=VALUE` before running the program")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "awk [-F FS] [-v VAR=VALUE]... {PROGRAM | -f FILE...} [FILE | VAR=VALUE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Awk scans and processes patterns.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(options(args)); err != nil {
+		return cli.Exit(2, err)
+	}
+	operands := fs.Args()
+
+	var sources []source
+	if len(f.files) == 0 {
+		if len(operands) == 0 {
+			fs.Usage()
+			return cli.Exit(2, nil)
+		}
+		sources = append(sources, source{name: "cmd. line", text: operands[0]})
+		operands = operands[1:]
+	}
+	for _, name := range f.files {
+		text, err := c.readSource(ctx, name)
+		if err != nil {
+			return cli.Exit(2, fmt.Errorf("%s: %w", name, pathCause(err)))
+		}
+		sources = append(sources, source{name: name, text: text})
+	}
+	prog, err := parse(sources)
+	if err != nil {
+		return cli.Exit(2, err)
+	}
+
+	stdout := &syncWriter{w: c.Stdout}
+	in := &interp{
+		ctx:       ctx,
+		prog:      prog,
+		open:      c.open,
+		exec:      c.exec,
+		resolve:   c.ResolvePath,
+		lookupEnv: c.LookupEnv,
+		globals:   make([]cell, len(prog.globals)),
+		stdinSrc:  c.Stdin,
+		stdout:    stdout,
+		stderr:    &syncWriter{w: c.Stderr},
+		out:       bufio.NewWriter(stdout),
+		streams:   map[string]*stream{},
+		argIndex:  1,
+		ranges:    make([]bool, len(prog.items)),
+		regexes:   map[string]*regexp.Regexp{},
+		rng:       rand.New(rand.NewSource(0)),
+	}
+	g := in.globals
+	g[vFS].v = str(" ")
+	g[vOFS].v = str(" ")
+	g[vORS].v = str("\n")
+	g[vRS].v = str("\n")
+	g[vSUBSEP].v = str("\x1c")
+	g[vCONVFMT].v = str("%.6g")
+	g[vOFMT].v = str("%.6g")
+	g[vNR].v, g[vFNR].v, g[vNF].v = num(0), num(0), num(0)
+	g[vRSTART].v, g[vRLENGTH].v = num(0), num(-1)
+	g[vENVIRON].array()
+	argv := g[vARGV].array()
+	argv["0"] = str("awk")
+	for i, arg := range operands {
+		argv[strconv.Itoa(i+1)] = strnum(arg)
+	}
+	g[vARGC].v = num(float64(len(operands) + 1))
+
+	if fs := f.fs; fs != "" {
+		if fs == "t" {
+			fs = "\t"
+		}
+		g[vFS].v = str(unescapeString(fs))
+	}
+	for _, a := range f.assigns {
+		name, val, ok := assignment(a)
+		if !ok {
+			return cli.Exit(2, fmt.Errorf("invalid -v argument: %s", a))
+		}
+		in.assignVar(name, val)
+	}
+
+	err = in.runProgram()
+	in.closeAll()
+	in.closeMain()
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return err
+		}
+		return cli.Exit(2, err)
+	}
+	if in.exitCode == 0 && in.failed {
+		return cli.Exit(2, nil)
+	}
+	if in.exitCode != 0 {
+		return cli.Exit(in.exitCode, nil)
+	}
+	return nil
+}
+
+// readSource reads a program file, "-" being stdin.
+func (c *command) readSource(ctx context.Context, name string) (string, error) {
+	if name == "-" || name == "/dev/stdin" {
+		b, err := io.ReadAll(c.Stdin)
+		return string(b), err
+	}
+	if c.open == nil {
+		return "", errNoAccess
+	}
+	f, err := c.open(ctx, c.ResolvePath(name), os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	return string(b), err
+}
@@ -0,0 +1,841 @@
+package awk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// handlers records the files and commands of a run. The commands are a
+// few of the shell: echo, sort and exit, separated by ";".
+type handlers struct {
+	dir   string
+	opens []string
+	execs []string
+}
+
+func (h *handlers) open(ctx context.Context, path string, flag int, perm fs.FileMode) (io.ReadWriteCloser, error) {
+	h.opens = append(h.opens, path)
+	return os.OpenFile(path, flag, perm)
+}
+
+func (h *handlers) exec(ctx context.Context, cmdline string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	h.execs = append(h.execs, cmdline)
+	for _, line := range strings.Split(cmdline, ";") {
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "echo":
+			fmt.Fprintln(stdout, strings.Join(args[1:], " "))
+		case "sort":
+			b, err := io.ReadAll(stdin)
+			if err != nil {
+				return 1, nil
+			}
+			lines := strings.SplitAfter(string(b), "\n")
+			slices.Sort(lines)
+			fmt.Fprint(stdout, strings.Join(lines, ""))
+		case "exit":
+			n, _ := strconv.Atoi(args[1])
+			return n, nil
+		default:
+			return 0, fmt.Errorf("%s: command not found", args[0])
+		}
+	}
+	return 0, nil
+}
+
+func setup(t *testing.T, files map[string]string) *handlers {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &handlers{dir: dir}
+}
+
+func runAwk(h *handlers, stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	var cmd = New(nil, nil)
+	if h != nil {
+		cmd = New(h.open, h.exec)
+		cmd.SetWorkingDir(h.dir)
+	}
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	cmd.SetLookupEnv(func(key string) (string, bool) {
+		if key == "AWKTEST" {
+			return "val", true
+		}
+		return "", false
+	})
+	err := cmd.Run(args...)
+	var e *cli.ExitError
+	if errors.As(err, &e) && e.Err != nil {
+		// as the shell reports it
+		fmt.Fprintf(&stderr, "awk: %v\n", e.Err)
+	}
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+func exitCode(err error) int {
+	var e *cli.ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// The expected results are those of mawk, or of gawk where they differ.
+func TestAwk(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		stdin string
+		files map[string]string
+		want  string
+		code  int
+	}{
+		{
+			name:  "print2",
+			args:  []string{"{print $2}"},
+			stdin: "a b c\nd e f\n",
+			want:  "b\ne\n",
+		},
+		{
+			name:  "sum",
+			args:  []string{"{s+=$1} END {print s}"},
+			stdin: "1\n2\n3.5\n",
+			want:  "6.5\n",
+		},
+		{
+			name:  "nr",
+			args:  []string{"{print NR, NF, $NF}"},
+			stdin: "a b\n\nc d e\n",
+			want:  "1 2 b\n2 0 \n3 3 e\n",
+		},
+		{
+			name:  "F colon",
+			args:  []string{"-F:", "{print $1}"},
+			stdin: "root:x:0\nbin:x:1\n",
+			want:  "root\nbin\n",
+		},
+		{
+			name:  "F regex",
+			args:  []string{"-F", "[,;]+", "{print $3}"},
+			stdin: "a,,b;c\n",
+			want:  "c\n",
+		},
+		{
+			name: "v assign",
+			args: []string{"-v", "x=hi\\tthere", "BEGIN {print x}"},
+			want: "hi\tthere\n",
+		},
+		{
+			name:  "pattern regex",
+			args:  []string{"/b/"},
+			stdin: "abc\nxyz\nbbb\n",
+			want:  "abc\nbbb\n",
+		},
+		{
+			name:  "range",
+			args:  []string{"/start/,/end/"},
+			stdin: "a\nstart\nb\nend\nc\nstart\nd\n",
+			want:  "start\nb\nend\nstart\nd\n",
+		},
+		{
+			name:  "not match",
+			args:  []string{"$1 !~ /^#/ {print}"},
+			stdin: "#c\nx\n#d\ny\n",
+			want:  "x\ny\n",
+		},
+		{
+			name:  "printf",
+			args:  []string{"{printf \"%-5s|%5.2f|%d|%x|%o|%e|%c|%c\\n\", $1, $2, $2, $3, $3, $2, 65, \"hello\"}"},
+			stdin: "ab 3.14159 255\n",
+			want:  "ab   | 3.14|3|ff|377|3.141590e+00|A|h\n",
+		},
+		{
+			name: "printf g",
+			args: []string{"BEGIN {printf \"%g %g %g %G %.3g %10.4f|%-10d|%+d|% d|%05d\\n\", 100000, 1000000, 0.0001, 1e-10, 3.14159, 2.5, 42, 5, 5, 42}"},
+			want: "100000 1e+06 0.0001 1E-10 3.14     2.5000|42        |+5| 5|00042\n",
+		},
+		{
+			name: "printf star",
+			args: []string{"BEGIN {printf \"%*d|%-*s|%.*f\\n\", 5, 42, 4, \"ab\", 2, 3.14159}"},
+			want: "   42|ab  |3.14\n",
+		},
+		{
+			name: "printf pct",
+			args: []string{"BEGIN {printf \"100%%\\n\"}"},
+			want: "100%\n",
+		},
+		{
+			name: "ofmt",
+			args: []string{"BEGIN {OFMT=\"%.2f\"; CONVFMT=\"%.3f\"; x=3.14159; print x; print x \"\"; print 17}"},
+			want: "3.14\n3.142\n17\n",
+		},
+		{
+			name:  "index length",
+			args:  []string{"{print index($0, \"lo\"), length($0), length, length()}"},
+			stdin: "hello\n",
+			want:  "4 5 5 5\n",
+		},
+		{
+			name: "split",
+			args: []string{"BEGIN {n=split(\"a:b:c\", arr, \":\"); print n, arr[1], arr[3]; n=split(\"  x  y \", b); print n, b[1] b[2]; n=split(\"a1b22c\", c, /[0-9]+/); print n, c[3]; n = split(\"\", d); print n, length(d)}"},
+			want: "3 a c\n2 xy\n3 c\n0 0\n",
+		},
+		{
+			name:  "sub gsub",
+			args:  []string{"{gsub(/o/, \"0\"); sub(/l+/, \"[&]\"); print; x=\"aaa\"; n=gsub(/a/, \"\\\\&\", x); print n, x}"},
+			stdin: "hello world\n",
+			want:  "he[ll]0 w0rld\n3 &&&\n",
+		},
+		{
+			name: "gsub empty",
+			args: []string{"BEGIN {s=\"abc\"; gsub(/x*/, \"-\", s); print s; t=\"abc\"; gsub(/b*/, \"-\", t); print t}"},
+			want: "-a-b-c-\n-a-c-\n",
+		},
+		{
+			name:  "match",
+			args:  []string{"{if (match($0, /[0-9]+/)) print RSTART, RLENGTH, substr($0, RSTART, RLENGTH); else print RSTART, RLENGTH}"},
+			stdin: "abc123def\nnone\n",
+			want:  "4 3 123\n0 -1\n",
+		},
+		{
+			name:  "toupper",
+			args:  []string{"{print toupper($0), tolower(\"ABC\")}"},
+			stdin: "mixed Case\n",
+			want:  "MIXED CASE abc\n",
+		},
+		{
+			name:  "compare",
+			args:  []string{"{print ($1 < $2), ($1 == $2), ($1 \"\" < $2 \"\")}"},
+			stdin: "10 9\n10 10.0\nabc abd\n",
+			want:  "0 0 1\n0 1 1\n1 0 1\n",
+		},
+		{
+			name: "uninit",
+			args: []string{"BEGIN {print x+0, \"[\" x \"]\", length(x), (x == 0), (x == \"\")}"},
+			want: "0 [] 0 1 1\n",
+		},
+		{
+			name:  "nf assign",
+			args:  []string{"{NF=2; print; print NF}"},
+			stdin: "a b c d\n",
+			want:  "a b\n2\n",
+		},
+		{
+			name:  "field assign",
+			args:  []string{"BEGIN {OFS=\"-\"} {$5=\"e\"; print; print NF; $1=$1; print}"},
+			stdin: "a b c\n",
+			want:  "a-b-c--e\n5\na-b-c--e\n",
+		},
+		{
+			name:  "dollar0 assign",
+			args:  []string{"{$0=\"x y z\"; print NF, $2}"},
+			stdin: "a\n",
+			want:  "3 y\n",
+		},
+		{
+			name:  "ofs rebuild",
+			args:  []string{"BEGIN {OFS=\":\"} {$1=$1} 1"},
+			stdin: "a b  c\n",
+			want:  "a:b:c\n",
+		},
+		{
+			name: "functions",
+			args: []string{"function fact(n) { return n <= 1 ? 1 : n * fact(n-1) } BEGIN {print fact(10)}"},
+			want: "3628800\n",
+		},
+		{
+			name: "function array",
+			args: []string{"function fill(a, n,  i) { for (i=1;i<=n;i++) a[i]=i*i } BEGIN {fill(sq, 4); print sq[3], length(sq)}"},
+			want: "9 4\n",
+		},
+		{
+			name: "function locals",
+			args: []string{"function f(x,  y) { y = x * 2; x = 0; return y } BEGIN {a = 5; print f(a), a, y}"},
+			want: "10 5 \n",
+		},
+		{
+			name: "delete",
+			args: []string{"BEGIN {a[1];a[2];a[3]; delete a[2]; print length(a), (2 in a), (3 in a); delete a; print length(a)}"},
+			want: "2 0 1\n0\n",
+		},
+		{
+			name: "multi subscript",
+			args: []string{"BEGIN {a[1,2]=3; for (k in a) {split(k, p, SUBSEP); print p[1], p[2]}; print ((1,2) in a)}"},
+			want: "1 2\n1\n",
+		},
+		{
+			name: "while do",
+			args: []string{"BEGIN {i=0; while (i<3) {i++; if (i==2) continue; print i}; do {print \"do\" i; i--} while (i>1)}"},
+			want: "1\n3\ndo3\ndo2\n",
+		},
+		{
+			name: "for break",
+			args: []string{"BEGIN {for (i=0;;i++) {if (i>3) break}; print i}"},
+			want: "4\n",
+		},
+		{
+			name:  "next",
+			args:  []string{"NR==2 {next} {print}"},
+			stdin: "1\n2\n3\n",
+			want:  "1\n3\n",
+		},
+		{
+			name:  "exit",
+			args:  []string{"{print} NR==2 {exit 3} END {print \"end\"}"},
+			stdin: "1\n2\n3\n",
+			want:  "1\n2\nend\n",
+			code:  3,
+		},
+		{
+			name:  "exit begin",
+			args:  []string{"BEGIN {print \"b\"; exit} {print} END {print \"e\"}"},
+			stdin: "x\n",
+			want:  "b\ne\n",
+		},
+		{
+			name:  "end nr",
+			args:  []string{"END {print NR, $0}"},
+			stdin: "a\nb\nlast line\n",
+			want:  "3 last line\n",
+		},
+		{
+			name:  "files",
+			args:  []string{"{print FILENAME, FNR, NR}", "f1", "f2"},
+			files: map[string]string{"f1": "a\nb\n", "f2": "c\n"},
+			want:  "f1 1 1\nf1 2 2\nf2 1 3\n",
+		},
+		{
+			name:  "operand assign",
+			args:  []string{"{print x, $0}", "x=1", "f1", "x=2", "f2"},
+			files: map[string]string{"f1": "a\n", "f2": "b\n"},
+			want:  "1 a\n2 b\n",
+		},
+		{
+			name:  "getline file",
+			args:  []string{"BEGIN {while ((getline line < \"f1\") > 0) n++; print n, line; close(\"f1\"); getline < \"f1\"; print $0, NF}"},
+			files: map[string]string{"f1": "a b\nc d e\n"},
+			want:  "2 c d e\na b 2\n",
+		},
+		{
+			name:  "getline plain",
+			args:  []string{"NR==1 {getline; print \"got\", $0} {print NR, $0}"},
+			stdin: "1\n2\n3\n",
+			want:  "got 2\n2 2\n3 3\n",
+		},
+		{
+			name:  "getline var",
+			args:  []string{"{getline x; print $0, x, NR}"},
+			stdin: "1\n2\n3\n4\n",
+			want:  "1 2 2\n3 4 4\n",
+		},
+		{
+			name:  "output redirect",
+			args:  []string{"{print > \"out\"} END {close(\"out\"); while ((getline l < \"out\") > 0) print \"r\", l}"},
+			stdin: "a\nb\n",
+			want:  "r a\nr b\n",
+		},
+		{
+			name:  "append redirect",
+			args:  []string{"{print >> \"f1\"} END {close(\"f1\"); while ((getline l < \"f1\") > 0) print l}"},
+			stdin: "new\n",
+			files: map[string]string{"f1": "old\n"},
+			want:  "old\nnew\n",
+		},
+		{
+			name: "system",
+			args: []string{"BEGIN {r = system(\"echo hi; exit 3\"); print \"r=\" r}"},
+			want: "hi\nr=3\n",
+		},
+		{
+			name:  "output pipe",
+			args:  []string{"{print | \"sort\"} END {close(\"sort\"); print \"done\"}"},
+			stdin: "c\na\nb\n",
+			want:  "a\nb\nc\ndone\n",
+		},
+		{
+			name:  "RS para",
+			args:  []string{"BEGIN {RS=\"\"} {print NR\": \"$1\"/\"$NF\"/\"NF}"},
+			stdin: "\n\na b\nc\n\n\nd e\nf g\n\n",
+			want:  "1: a/c/3\n2: d/g/4\n",
+		},
+		{
+			name:  "RS char",
+			args:  []string{"BEGIN {RS=\";\"} {print NR, $0}"},
+			stdin: "a;b;c\n",
+			want:  "1 a\n2 b\n3 c\n\n",
+		},
+		{
+			name:  "RS regex",
+			args:  []string{"BEGIN {RS=\"[0-9]+\"} {print NR, $0}"},
+			stdin: "a1b22c\n",
+			want:  "1 a\n2 b\n3 c\n\n",
+		},
+		{
+			name:  "FS single space char",
+			args:  []string{"BEGIN {FS=\",\"} {print NF; for (i=1;i<=NF;i++) print \"[\" $i \"]\"}"},
+			stdin: "a,,b,\n",
+			want:  "4\n[a]\n[]\n[b]\n[]\n",
+		},
+		{
+			name:  "FS pipe",
+			args:  []string{"-F|", "{print $2}"},
+			stdin: "a|b|c\n",
+			want:  "b\n",
+		},
+		{
+			name:  "FS dot",
+			args:  []string{"-F.", "{print $2}"},
+			stdin: "a.b.c\n",
+			want:  "b\n",
+		},
+		{
+			name:  "regex dynamic",
+			args:  []string{"{if ($0 ~ \"^a.c$\") print \"y\"; else print \"n\"}"},
+			stdin: "abc\nabcd\n",
+			want:  "y\nn\n",
+		},
+		{
+			name:  "regex classes",
+			args:  []string{"/^[[:digit:]]+$/ {print \"num\", $0} /^[[:alpha:]_]+$/ {print \"word\", $0}"},
+			stdin: "123\nabc_\na1\n",
+			want:  "num 123\nword abc_\n",
+		},
+		{
+			name:  "regex escapes",
+			args:  []string{"/a\\.b/ {print} /\\// {print \"slash\"}"},
+			stdin: "a.b\naxb\nx/y\n",
+			want:  "a.b\nslash\n",
+		},
+		{
+			name:  "bracket escape",
+			args:  []string{"{gsub(/[\\/\\]]/, \"_\"); print}"},
+			stdin: "a/b]c\n",
+			want:  "a_b_c\n",
+		},
+		{
+			name:  "ternary",
+			args:  []string{"{print ($1 > 5 ? \"big\" : \"small\")}"},
+			stdin: "3\n10\n",
+			want:  "small\nbig\n",
+		},
+		{
+			name: "incr",
+			args: []string{"BEGIN {x=5; print x++, x, ++x, x--, --x; a[\"k\"]++; print a[\"k\"]}"},
+			want: "5 6 7 7 5\n1\n",
+		},
+		{
+			name:  "field incr",
+			args:  []string{"{$2++; print; print $1++ + ++$1}"},
+			stdin: "1 2\n",
+			want:  "1 3\n4\n",
+		},
+		{
+			name: "assign ops",
+			args: []string{"BEGIN {x=10; x+=5; x-=3; x*=2; x/=4; x%=4; x^=3; print x}"},
+			want: "8\n",
+		},
+		{
+			name:  "string num",
+			args:  []string{"{print $1+0, $1*2, -$1}"},
+			stdin: "3abc\n  12  \n.5\n1e3\nx\n",
+			want:  "3 6 -3\n12 24 -12\n0.5 1 -0.5\n1000 2000 -1000\n0 0 0\n",
+		},
+		{
+			name: "concat precedence",
+			args: []string{"BEGIN {print 1 \" \" 2+3; print 2 -1; x = \"a\" \"b\" 1+1; print x; print 1 \" \" -1}"},
+			want: "1 5\n1\nab2\n1-1\n",
+		},
+		{
+			name: "unary minus pow",
+			args: []string{"BEGIN {print -2^2, 2^3^2, 2^-1, !0, !1, !\"\", !\"a\"}"},
+			want: "-4 512 0.5 1 0 1 0\n",
+		},
+		{
+			name: "in precedence",
+			args: []string{"BEGIN {a[1]; print 1 in a, 2 in a; if (!(2 in a)) print \"no\"}"},
+			want: "1 0\nno\n",
+		},
+		{
+			name: "semicolon newline",
+			args: []string{"BEGIN {\n  x = 1\n  if (x)\n    print \"yes\"\n  else\n    print \"no\"\n  for (i = 0; i < 2; i++)\n    print i\n}"},
+			want: "yes\n0\n1\n",
+		},
+		{
+			name: "comments",
+			args: []string{"# c\nBEGIN { # x\n print \"a\" # y\n}\n"},
+			want: "a\n",
+		},
+		{
+			name: "continuation",
+			args: []string{"BEGIN { x = 1 + \\\n 2; print x }"},
+			want: "3\n",
+		},
+		{
+			name: "logical newline",
+			args: []string{"BEGIN { if (1 &&\n 1 ||\n 0) print \"ok\" }"},
+			want: "ok\n",
+		},
+		{
+			name: "print parens",
+			args: []string{"BEGIN {print(1,2); print (1)(2); print (1,2) > \"/dev/stdout\"}"},
+			want: "1 2\n12\n1 2\n",
+		},
+		{
+			name: "print comparison parens",
+			args: []string{"BEGIN {print (2 > 1), (1 > 2)}"},
+			want: "1 0\n",
+		},
+		{
+			name:  "getline update nr",
+			args:  []string{"BEGIN {while ((getline line) > 0) n++; print n, NR}"},
+			stdin: "a\nb\n",
+			want:  "2 2\n",
+		},
+		{
+			name:  "uninit field",
+			args:  []string{"{print \"[\" $5 \"]\", NF}"},
+			stdin: "a b\n",
+			want:  "[] 2\n",
+		},
+		{
+			name: "srand rand",
+			args: []string{"BEGIN {srand(1); x=rand(); srand(1); y=rand(); print (x==y), (x>=0 && x<1), srand(2)}"},
+			want: "1 1 1\n",
+		},
+		{
+			name: "length array",
+			args: []string{"BEGIN {a[1]; a[2]; print length(a)}"},
+			want: "2\n",
+		},
+		{
+			name: "sprintf",
+			args: []string{"BEGIN {s = sprintf(\"%03d-%s\", 7, \"x\"); print s, length(s)}"},
+			want: "007-x 5\n",
+		},
+		{
+			name:  "numeric string output",
+			args:  []string{"{print $1, $1+0}"},
+			stdin: "0.10\n1e2\n",
+			want:  "0.10 0.1\n1e2 100\n",
+		},
+		{
+			name:  "regex as value",
+			args:  []string{"{x = /a/; print x}"},
+			stdin: "a\nb\n",
+			want:  "1\n0\n",
+		},
+		{
+			name:  "nextfile",
+			args:  []string{"FNR==2 {nextfile} {print FILENAME, $0}", "f1", "f2"},
+			files: map[string]string{"f1": "a\nb\nc\n", "f2": "d\ne\n"},
+			want:  "f1 a\nf2 d\n",
+		},
+		{
+			name:  "stdin dash",
+			args:  []string{"{print FILENAME \":\" $0}", "-"},
+			stdin: "x\n",
+			want:  "-:x\n",
+		},
+		{
+			name:  "f file",
+			args:  []string{"-f", "prog.awk", "f1"},
+			files: map[string]string{"prog.awk": "{ print \"p\", $0 }\n", "f1": "a\n"},
+			want:  "p a\n",
+		},
+		{
+			name: "uninitialized array in",
+			args: []string{"BEGIN {if (x in a) print \"y\"; else print \"n\"; print length(a)}"},
+			want: "n\n0\n",
+		},
+		{
+			name:  "printf no newline",
+			args:  []string{"{printf \"%s,\", $0} END {print \"\"}"},
+			stdin: "a\nb\n",
+			want:  "a,b,\n",
+		},
+		{
+			name:  "pattern only expr",
+			args:  []string{"NR % 2"},
+			stdin: "1\n2\n3\n",
+			want:  "1\n3\n",
+		},
+		{
+			name:  "empty pattern action",
+			args:  []string{"{}"},
+			stdin: "a\n",
+			want:  "",
+		},
+		{
+			name:  "BEGIN only no read",
+			args:  []string{"BEGIN {print \"x\"}"},
+			stdin: "never read\n",
+			want:  "x\n",
+		},
+		{
+			name: "getline from nonexistent",
+			args: []string{"BEGIN {print (getline line < \"nope\")}"},
+			want: "-1\n",
+		},
+		{
+			name: "close return",
+			args: []string{"BEGIN {print close(\"nothing\"); \"exit 5\" | getline; print close(\"exit 5\")}"},
+			want: "-1\n5\n",
+		},
+		{
+			name: "sort via close",
+			args: []string{"BEGIN {print \"b\" | \"sort\"; print \"a\" | \"sort\"; close(\"sort\"); print \"after\"}"},
+			want: "a\nb\nafter\n",
+		},
+		{
+			name: "hex and octal escapes",
+			args: []string{"BEGIN {print \"a\\101\\tb\"}"},
+			want: "aA\tb\n",
+		},
+		{
+			name: "subsep default",
+			args: []string{"BEGIN {a[\"x\",\"y\"]; for (k in a) print length(k)}"},
+			want: "3\n",
+		},
+		{
+			name:  "NR assign",
+			args:  []string{"NR==2 {NR=10} {print NR}"},
+			stdin: "a\nb\nc\n",
+			want:  "1\n10\n11\n",
+		},
+		{
+			name:  "FS change next record",
+			args:  []string{"{FS=\":\"; print $1}"},
+			stdin: "a:b c\nd:e f\n",
+			want:  "a:b\nd\n",
+		},
+		{
+			name:  "regex FS leading",
+			args:  []string{"BEGIN {FS=\"[ ]\"} {print NF\":\"$1\":\"$2}"},
+			stdin: " a b\n",
+			want:  "3::a\n",
+		},
+		{
+			name:  "getline var field",
+			args:  []string{"{getline $2 < \"f1\"; print; print NF}"},
+			stdin: "x y z\n",
+			files: map[string]string{"f1": "new\n"},
+			want:  "x new z\n3\n",
+		},
+		{
+			name: "printf c num",
+			args: []string{"BEGIN {printf \"%c%c%c\\n\", 72, 105, \"!!\"}"},
+			want: "Hi!\n",
+		},
+		{
+			name: "printf i u",
+			args: []string{"BEGIN {printf \"%i %u %5.1s|\\n\", 3.9, 4, \"abc\"}"},
+			want: "3 4     a|\n",
+		},
+		{
+			name:  "long program",
+			args:  []string{"{ n = split($0, w, \",\"); for (i = n; i > 0; i--) printf \"%s%s\", w[i], (i > 1 ? \",\" : \"\\n\") }"},
+			stdin: "a,b,c\n1,2\n",
+			want:  "c,b,a\n2,1\n",
+		},
+		{
+			name: "recursion array",
+			args: []string{"function sum(a, n) { return n ? a[n] + sum(a, n-1) : 0 } BEGIN {x[1]=1;x[2]=2;x[3]=3; print sum(x, 3)}"},
+			want: "6\n",
+		},
+		{
+			name:  "dollar expr",
+			args:  []string{"{i=1; print $i, $(i+1), $NF, $(NF-1)}"},
+			stdin: "a b c\n",
+			want:  "a b c b\n",
+		},
+		{
+			name:  "negative field",
+			args:  []string{"{print $(-1)}"},
+			stdin: "a\n",
+			want:  "",
+			code:  2,
+		},
+		{
+			name:  "regex match op var",
+			args:  []string{"BEGIN {re = \"^[0-9]+$\"} $0 ~ re {print \"num\"}"},
+			stdin: "12\nab\n",
+			want:  "num\n",
+		},
+		{
+			name:  "string compare strnum const",
+			args:  []string{"{print ($1 == \"10\"), ($1 == 10), ($1 < \"9\")}"},
+			stdin: "10\n",
+			want:  "1 1 1\n",
+		},
+		{
+			name: "uninit var as array param",
+			args: []string{"function f(a) { a[\"x\"] = 1 } BEGIN { f(arr); print length(arr), arr[\"x\"] }"},
+			want: "1 1\n",
+		},
+		{
+			name:  "F t is a tab",
+			args:  []string{"-Ft", "{print $2}"},
+			stdin: "a\tb c\td\n",
+			want:  "b c\n",
+		},
+		{
+			name:  "for in order",
+			args:  []string{"{for (i=1;i<=NF;i++) c[$i]++} END {for (w in c) print w, c[w]}"},
+			stdin: "b a b\nc a b\n10 9\n",
+			want:  "9 1\n10 1\na 2\nb 3\nc 1\n",
+		},
+		{
+			name: "integers",
+			args: []string{"BEGIN {print 2^53, 1e300*10, -0, 0.1 + 0.2}"},
+			want: "9007199254740992 1e+301 0 0.3\n",
+		},
+		{
+			name: "substr rounding",
+			args: []string{`BEGIN {s="hello"; print substr(s,-1,3), substr(s,1.5,2.3), substr(s,0,2)}`},
+			want: "h el h\n",
+		},
+		{
+			name: "math",
+			args: []string{"BEGIN {print int(3.9), int(-3.9), sqrt(16), exp(0), log(1), atan2(0, -1), 7%3, -7%3, 2^10, 2**3}"},
+			want: "3 -3 4 1 0 3.14159 1 -1 1024 8\n",
+		},
+		{
+			name:  "missing file",
+			args:  []string{"{print}", "nofile", "f1"},
+			files: map[string]string{"f1": "a\n"},
+			want:  "a\n",
+			code:  2,
+		},
+		{
+			name: "command getline",
+			args: []string{`BEGIN {while (("echo a; echo b" | getline x) > 0) print "got", x; "echo 1 2 3" | getline; print NF, $2, NR}`},
+			want: "got a\ngot b\n3 2 3\n",
+		},
+		{
+			name:  "interval",
+			args:  []string{"/^a{2}$/ {print \"two\"} /{/ {print \"brace\"}"},
+			stdin: "aa\na\n{x\n",
+			want:  "two\nbrace\n",
+		},
+		{
+			name:  "unicode",
+			args:  []string{`{print length($0), substr($0, 2, 2), index($0, "l"), toupper($0)}`},
+			stdin: "héllo\n",
+			want:  "5 él 3 HÉLLO\n",
+		},
+		{
+			name: "ENVIRON",
+			args: []string{`BEGIN {print ENVIRON["AWKTEST"], length(ENVIRON["NONE"])}`},
+			want: "val 0\n",
+		},
+		{
+			name: "ARGV",
+			args: []string{"BEGIN {for (i = 0; i < ARGC; i++) print i, ARGV[i]}", "a", "b=1"},
+			want: "0 awk\n1 a\n2 b=1\n",
+		},
+		{
+			name:  "options",
+			args:  []string{"--field-separator=:", "--assign", "x=1", "{print x, $2}", "-v"},
+			files: map[string]string{"-v": "a:b\n"},
+			want:  "1 b\n",
+		},
+		{
+			name: "usage",
+			code: 2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := setup(t, tt.files)
+			got, stderr, code := runAwk(h, tt.stdin, tt.args...)
+			if got != tt.want || code != tt.code {
+				t.Errorf("awk %q: got %q, exit %d, want %q, exit %d; stderr %q", tt.args, got, code, tt.want, tt.code, stderr)
+			}
+		})
+	}
+}
+
+func TestAwkErrors(t *testing.T) {
+	h := setup(t, map[string]string{"p.awk": "BEGIN {\n  print 1\n  x = (\n}\n"})
+	for _, tt := range []struct {
+		args   []string
+		stderr string
+		code   int
+	}{
+		{[]string{"BEGIN {print (}"}, "awk: cmd. line:1: syntax error at }\n", 2},
+		{[]string{"-f", "p.awk"}, "awk: p.awk:3: syntax error: unexpected newline\n", 2},
+		{[]string{"-f", "none.awk"}, "awk: none.awk: no such file or directory\n", 2},
+		{[]string{"BEGIN {f()}"}, "awk: function f never defined\n", 2},
+		{[]string{"BEGIN {print 1/0}"}, "awk: division by zero\n", 2},
+		{[]string{"BEGIN {print 1%0}"}, "awk: division by zero in %\n", 2},
+		{[]string{`BEGIN {$1e12 = "a"}`}, "awk: field $1000000000000 exceeds the maximum field 32767\n", 2},
+		{[]string{"BEGIN {print $32768}"}, "awk: field $32768 exceeds the maximum field 32767\n", 2},
+		{[]string{"BEGIN {NF = 1e12}"}, "awk: NF set to 1000000000000 exceeds the maximum number of fields 32767\n", 2},
+		{[]string{`BEGIN {print "x" ~ "("}`}, "awk: invalid regex /(/: missing closing )\n", 2},
+		{[]string{"{print}", "nofile"}, "awk: nofile: no such file or directory\n", 2},
+		{[]string{"-v", "1x=2", "BEGIN {}"}, "awk: invalid -v argument: 1x=2\n", 2},
+		{[]string{"BEGIN {print > \"dir/x\"}"}, "awk: can't redirect to dir/x: no such file or directory\n", 2},
+		{[]string{`BEGIN {system("nope")}`}, "awk: nope: nope: command not found\n", 0},
+	} {
+		_, stderr, code := runAwk(h, "", tt.args...)
+		if stderr != tt.stderr || code != tt.code {
+			t.Errorf("awk %q: got %q, exit %d, want %q, exit %d", tt.args, stderr, code, tt.stderr, tt.code)
+		}
+	}
+}
+
+// The files and commands go through the handlers, and without them
+// there is no access.
+func TestAwkHandlers(t *testing.T) {
+	h := setup(t, map[string]string{"in": "x\n", "p.awk": "{print > \"out\"; print | \"sort\"} END {system(\"exit 0\"); \"echo e\" | getline; print}\n"})
+	got, stderr, code := runAwk(h, "", "-f", "p.awk", "in")
+	if got != "e\nx\n" || stderr != "" || code != 0 {
+		t.Errorf("got %q, %q, exit %d", got, stderr, code)
+	}
+	wantOpens := []string{filepath.Join(h.dir, "p.awk"), filepath.Join(h.dir, "in"), filepath.Join(h.dir, "out")}
+	if !slices.Equal(h.opens, wantOpens) {
+		t.Errorf("got opens %q, want %q", h.opens, wantOpens)
+	}
+	if want := []string{"sort", "exit 0", "echo e"}; !slices.Equal(h.execs, want) {
+		t.Errorf("got execs %q, want %q", h.execs, want)
+	}
+
+	for _, tt := range []struct {
+		args   []string
+		stderr string
+		code   int
+	}{
+		{[]string{"-f", "p.awk"}, "awk: p.awk: not supported in this environment\n", 2},
+		{[]string{"{print}", "in"}, "awk: in: not supported in this environment\n", 2},
+		{[]string{`BEGIN {print (getline < "in")}`}, "", 0},
+		{[]string{`BEGIN {print system("echo")}`}, "awk: echo: not supported in this environment\n", 0},
+		{[]string{`BEGIN {print > "out"}`}, "awk: can't redirect to out: not supported in this environment\n", 2},
+	} {
+		_, stderr, code := runAwk(nil, "", tt.args...)
+		if stderr != tt.stderr || code != tt.code {
+			t.Errorf("awk %q: got %q, exit %d, want %q, exit %d", tt.args, stderr, code, tt.stderr, tt.code)
+		}
+	}
+}
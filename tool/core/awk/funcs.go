@@ -0,0 +1,470 @@
+package awk
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+func (in *interp) builtin(e *builtinExpr) value {
+	args := e.args
+	arg := func(i int) value { return in.eval(args[i]) }
+	str := func(i int) string { return in.toStr(in.eval(args[i])) }
+
+	switch e.name {
+	case "length":
+		if len(args) == 0 {
+			return num(float64(utf8.RuneCountInString(in.record)))
+		}
+		if v, ok := args[0].(*varExpr); ok {
+			if c := in.cell(v); c.arr != nil || c.ref != nil && c.ref.arr != nil {
+				return num(float64(len(c.array())))
+			}
+		}
+		return num(float64(utf8.RuneCountInString(str(0))))
+	case "substr":
+		s := str(0)
+		m := arg(1).num()
+		n := math.Inf(1)
+		if len(args) == 3 {
+			n = arg(2).num()
+		}
+		return value{kind: kStr, s: substr(s, m, n)}
+	case "index":
+		s, t := str(0), str(1)
+		i := strings.Index(s, t)
+		if i < 0 {
+			return num(0)
+		}
+		return num(float64(utf8.RuneCountInString(s[:i]) + 1))
+	case "split":
+		return in.splitArray(args)
+	case "sub", "gsub":
+		return in.substitute(args, e.name == "gsub")
+	case "match":
+		s := str(0)
+		loc := in.regexOf(args[1]).FindStringIndex(s)
+		if loc == nil {
+			in.globals[vRSTART].v, in.globals[vRLENGTH].v = num(0), num(-1)
+			return num(0)
+		}
+		start := utf8.RuneCountInString(s[:loc[0]]) + 1
+		in.globals[vRSTART].v = num(float64(start))
+		in.globals[vRLENGTH].v = num(float64(utf8.RuneCountInString(s[loc[0]:loc[1]])))
+		return num(float64(start))
+	case "sprintf":
+		vals := make([]value, len(args))
+		for i := range args {
+			vals[i] = arg(i)
+		}
+		return value{kind: kStr, s: sprintf(in.toStr(vals[0]), vals[1:], in.convfmt())}
+	case "tolower":
+		return value{kind: kStr, s: strings.ToLower(str(0))}
+	case "toupper":
+		return value{kind: kStr, s: strings.ToUpper(str(0))}
+	case "int":
+		return num(math.Trunc(arg(0).num()))
+	case "sqrt":
+		return num(math.Sqrt(arg(0).num()))
+	case "exp":
+		return num(math.Exp(arg(0).num()))
+	case "log":
+		return num(math.Log(arg(0).num()))
+	case "sin":
+		return num(math.Sin(arg(0).num()))
+	case "cos":
+		return num(math.Cos(arg(0).num()))
+	case "atan2":
+		return num(math.Atan2(arg(0).num(), arg(1).num()))
+	case "rand":
+		return num(in.rng.Float64())
+	case "srand":
+		prev := in.seed
+		if len(args) == 0 {
+			in.seed = float64(time.Now().Unix())
+		} else {
+			in.seed = arg(0).num()
+		}
+		in.rng = rand.New(rand.NewSource(int64(in.seed)))
+		return num(prev)
+	case "system":
+		cmdline := str(0)
+		in.flush()
+		return num(float64(in.run(cmdline, nil, in.stdout)))
+	case "close":
+		return num(float64(in.closeStream(str(0))))
+	case "fflush":
+		if len(args) == 0 {
+			in.flush()
+			return num(0)
+		}
+		s, ok := in.streams[str(0)]
+		if !ok || s.w == nil {
+			return num(-1)
+		}
+		s.w.Flush()
+		return num(0)
+	}
+	in.fatalf("%s is not supported", e.name)
+	return value{}
+}
+
+// substr returns the characters of s from m, up to n of them, rounding
+// m and n.
+func substr(s string, m, n float64) string {
+	if math.IsNaN(m) || math.IsNaN(n) {
+		return ""
+	}
+	r := []rune(s)
+	start := math.Round(m)
+	end := start + math.Round(n)
+	start = max(start, 1)
+	end = min(end, float64(len(r)+1))
+	if end <= start {
+		return ""
+	}
+	return string(r[int(start)-1 : int(end)-1])
+}
+
+// splitArray splits the string into the array, returning the number of
+// elements.
+func (in *interp) splitArray(args []expr) value {
+	s := in.toStr(in.eval(args[0]))
+	var parts []string
+	switch {
+	case len(args) < 3:
+		parts = in.split(s, in.toStr(in.globals[vFS].v), false)
+	default:
+		if re, ok := args[2].(*regexExpr); ok {
+			if s != "" {
+				parts = in.regex(re.re).Split(s, -1)
+			}
+		} else {
+			parts = in.split(s, in.toStr(in.eval(args[2])), false)
+		}
+	}
+	arr := in.array(args[1].(*varExpr))
+	clear(arr)
+	for i, p := range parts {
+		arr[strconv.Itoa(i+1)] = strnum(p)
+	}
+	return num(float64(len(parts)))
+}
+
+// substitute replaces the first, or every, match of the regex in the
+// target, $0 by default, returning the number of replacements. In the
+// replacement "&" is the match, "\&" a literal "&" and "\\" a backslash.
+func (in *interp) substitute(args []expr, global bool) value {
+	re := in.regexOf(args[0])
+	repl := in.toStr(in.eval(args[1]))
+	var target expr = &fieldExpr{&numExpr{0}}
+	if len(args) == 3 {
+		target = args[2]
+	}
+	r := in.ref(target)
+	s := in.toStr(r.get())
+	n := 1
+	if global {
+		n = -1
+	}
+	matches := re.FindAllStringIndex(s, n)
+	if matches == nil {
+		return num(0)
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(s[last:m[0]])
+		for i := 0; i < len(repl); i++ {
+			switch c := repl[i]; {
+			case c == '\\' && i+1 < len(repl) && (repl[i+1] == '&' || repl[i+1] == '\\'):
+				i++
+				sb.WriteByte(repl[i])
+			case c == '&':
+				sb.WriteString(s[m[0]:m[1]])
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		last = m[1]
+	}
+	sb.WriteString(s[last:])
+	r.set(value{kind: kStr, s: sb.String()})
+	return num(float64(len(matches)))
+}
+
+// regexOf returns the regex of a regex literal or of the string value of
+// another expression.
+func (in *interp) regexOf(e expr) *regexp.Regexp {
+	if re, ok := e.(*regexExpr); ok {
+		return in.regex(re.re)
+	}
+	return in.regex(in.toStr(in.eval(e)))
+}
+
+// regex compiles the extended regular expression, caching it.
+func (in *interp) regex(s string) *regexp.Regexp {
+	if re, ok := in.regexes[s]; ok {
+		return re
+	}
+	t, err := translate(s)
+	if err == nil {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile("(?s)" + t); err == nil {
+			re.Longest()
+			in.regexes[s] = re
+			return re
+		}
+	}
+	var perr *syntax.Error
+	if errors.As(err, &perr) {
+		err = errors.New(strings.TrimPrefix(perr.Code.String(), "invalid "))
+	}
+	in.fatalf("invalid regex /%s/: %v", s, err)
+	return nil
+}
+
+// translate converts a POSIX extended regular expression, with the escape
+// sequences of awk, to the syntax of the regexp package.
+func translate(s string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				sb.WriteString(`\\`)
+				continue
+			}
+			i++
+			switch d := s[i]; d {
+			case 'y', '<', '>':
+				sb.WriteString(`\b`)
+			case 'B', 'w', 'W', 's', 'S':
+				sb.WriteByte('\\')
+				sb.WriteByte(d)
+			case '`':
+				sb.WriteString(`\A`)
+			case '\'':
+				sb.WriteString(`\z`)
+			default:
+				var lit string
+				lit, i = escape(s, i-1)
+				sb.WriteString(lit)
+			}
+		case '[':
+			end, class, err := bracket(s, i)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(class)
+			i = end
+		case '{':
+			if !interval(s[i:]) {
+				sb.WriteString(`\{`)
+				continue
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+// interval reports whether s starts with an interval such as "{2}" or
+// "{1,3}".
+func interval(s string) bool {
+	end := strings.IndexByte(s, '}')
+	if end < 2 {
+		return false
+	}
+	lo, hi, _ := strings.Cut(s[1:end], ",")
+	return lo != "" && strings.Trim(lo, "0123456789") == "" && strings.Trim(hi, "0123456789") == ""
+}
+
+// bracket returns the end of the bracket expression at i and its
+// translation.
+func bracket(s string, i int) (int, string, error) {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	j := i + 1
+	if j < len(s) && s[j] == '^' {
+		sb.WriteByte('^')
+		j++
+	}
+	// a leading "]" is literal
+	if j < len(s) && s[j] == ']' {
+		sb.WriteString(`\]`)
+		j++
+	}
+	for ; j < len(s); j++ {
+		switch c := s[j]; c {
+		case ']':
+			sb.WriteByte(']')
+			return j, sb.String(), nil
+		case '[':
+			if j+1 < len(s) && (s[j+1] == ':' || s[j+1] == '.' || s[j+1] == '=') {
+				end := strings.Index(s[j+2:], string(s[j+1])+"]")
+				if end < 0 {
+					return 0, "", errors.New("unmatched [")
+				}
+				sb.WriteString(s[j : j+2+end+2])
+				j += 2 + end + 1
+				continue
+			}
+			sb.WriteString(`\[`)
+		case '\\':
+			if j+1 == len(s) {
+				return 0, "", errors.New("unmatched [")
+			}
+			var lit string
+			lit, j = escape(s, j)
+			sb.WriteString(lit)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return 0, "", errors.New("unmatched [")
+}
+
+// escape returns the escape sequence at s[i] quoted for the regexp
+// package and the offset of its last byte. Escaped characters without a
+// meaning stand for themselves.
+func escape(s string, i int) (string, int) {
+	var sb strings.Builder
+	j := unescape(&sb, s, i)
+	lit := sb.String()
+	if len(lit) == 2 && lit[0] == '\\' {
+		if lit[1] >= utf8.RuneSelf {
+			// the character is copied next
+			return "", i
+		}
+		lit = lit[1:]
+	}
+	return regexp.QuoteMeta(lit), j
+}
+
+// sprintf formats the values like printf of C. Strings are taken as
+// numbers, and numbers as strings with convfmt.
+func sprintf(format string, args []value, convfmt string) string {
+	var sb strings.Builder
+	next := func() value {
+		if len(args) == 0 {
+			return value{}
+		}
+		v := args[0]
+		args = args[1:]
+		return v
+	}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		start := i
+		i++
+		if i < len(format) && format[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		flags := ""
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+			flags += format[i : i+1]
+			i++
+		}
+		width := ""
+		if i < len(format) && format[i] == '*' {
+			width = strconv.Itoa(int(next().num()))
+			i++
+		}
+		for i < len(format) && isDigit(format[i]) {
+			width += format[i : i+1]
+			i++
+		}
+		prec := ""
+		if i < len(format) && format[i] == '.' {
+			prec = "."
+			i++
+			if i < len(format) && format[i] == '*' {
+				prec += strconv.Itoa(max(int(next().num()), 0))
+				i++
+			}
+			for i < len(format) && isDigit(format[i]) {
+				prec += format[i : i+1]
+				i++
+			}
+		}
+		spec := "%" + flags + width + prec
+		// the strings are padded with spaces
+		strSpec := "%" + strings.ReplaceAll(flags, "0", "") + width
+		if i == len(format) {
+			sb.WriteString(format[start:])
+			break
+		}
+		switch verb := format[i]; verb {
+		case 'd', 'i':
+			n := math.Trunc(next().num())
+			if math.IsNaN(n) || math.Abs(n) >= 1<<63 {
+				fmt.Fprintf(&sb, strSpec+"s", formatNum(n, "%.0f"))
+				continue
+			}
+			fmt.Fprintf(&sb, spec+"d", int64(n))
+		case 'o', 'x', 'X', 'u':
+			n := math.Trunc(next().num())
+			u := uint64(int64(n))
+			if n >= 1<<63 {
+				u = uint64(n)
+			}
+			if verb == 'u' {
+				verb = 'd'
+			}
+			fmt.Fprintf(&sb, spec+string(verb), u)
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			n := next().num()
+			if math.IsNaN(n) || math.IsInf(n, 0) {
+				s := formatNum(n, "")
+				if n > 0 && strings.Contains(flags, "+") {
+					s = "+" + s
+				}
+				fmt.Fprintf(&sb, strSpec+"s", s)
+				continue
+			}
+			if prec == "" {
+				spec += ".6"
+			}
+			fmt.Fprintf(&sb, spec+string(verb), n)
+		case 'c':
+			v := next()
+			var s string
+			if v.kind == kNum {
+				s = string(rune(int(v.n)))
+			} else if r, _ := utf8.DecodeRuneInString(v.s); v.s != "" {
+				s = string(r)
+			}
+			fmt.Fprintf(&sb, strSpec+"s", s)
+		case 's':
+			fmt.Fprintf(&sb, strSpec+prec+"s", next().str(convfmt))
+		default:
+			sb.WriteString(format[start : i+1])
+		}
+	}
+	return sb.String()
+}
+
+// pathCause strips the operation and path of the error.
+func pathCause(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
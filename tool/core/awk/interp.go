@@ -0,0 +1,890 @@
+package awk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cell holds a variable, scalar or array. A parameter bound to an
+// untyped variable of the caller refers to it, so that it becomes the
+// array if the function uses the parameter as one.
+type cell struct {
+	v   value
+	arr map[string]value
+	ref *cell
+}
+
+func (c *cell) array() map[string]value {
+	if c.arr == nil {
+		if c.ref != nil {
+			c.arr = c.ref.array()
+		} else {
+			c.arr = map[string]value{}
+		}
+	}
+	return c.arr
+}
+
+// the control flow of statements
+var (
+	errBreak    = errors.New("break")
+	errContinue = errors.New("continue")
+	errNext     = errors.New("next")
+	errNextFile = errors.New("nextfile")
+	errExit     = errors.New("exit")
+	errReturn   = errors.New("return")
+)
+
+// runtimeError stops the program.
+type runtimeError struct {
+	err error
+}
+
+func (e *runtimeError) Error() string { return e.err.Error() }
+func (e *runtimeError) Unwrap() error { return e.err }
+
+const maxDepth = 10000
+
+type interp struct {
+	ctx  context.Context
+	prog *program
+
+	open      OpenFunc
+	exec      ExecFunc
+	resolve   func(string) string
+	lookupEnv func(string) (string, bool)
+
+	globals []cell
+	// frame holds the parameters of the function being called
+	frame []cell
+	depth int
+
+	record string
+	fields []string
+
+	stdinSrc io.Reader
+	stdin    *recordReader
+	stdout   io.Writer
+	stderr   io.Writer
+	out      *bufio.Writer
+	streams  map[string]*stream
+
+	// the main input
+	argIndex   int
+	main       *recordReader
+	mainCloser io.Closer
+	sawFile    bool
+
+	ranges   []bool
+	regexes  map[string]*regexp.Regexp
+	rng      *rand.Rand
+	seed     float64
+	retval   value
+	exitCode int
+	// failed is set if an input could not be read
+	failed bool
+}
+
+func (in *interp) fatalf(format string, args ...any) {
+	panic(&runtimeError{fmt.Errorf(format, args...)})
+}
+
+// warnf reports an error and goes on.
+func (in *interp) warnf(format string, args ...any) {
+	in.out.Flush()
+	fmt.Fprintf(in.stderr, "awk: "+format+"\n", args...)
+}
+
+func (in *interp) checkContext() {
+	if err := in.ctx.Err(); err != nil {
+		panic(&runtimeError{err})
+	}
+}
+
+func (in *interp) convfmt() string {
+	return in.globals[vCONVFMT].v.str("%.6g")
+}
+
+func (in *interp) toStr(v value) string {
+	return v.str(in.convfmt())
+}
+
+// runProgram runs the BEGIN actions, the items on each record of the
+// input and the END actions.
+func (in *interp) runProgram() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*runtimeError)
+			if !ok {
+				panic(r)
+			}
+			err = e.err
+		}
+	}()
+	exited := false
+	for _, body := range in.prog.begin {
+		if err := in.action(body); err == errExit {
+			exited = true
+			break
+		} else if err != nil {
+			in.fatalf("%s used in a BEGIN action", err)
+		}
+	}
+	if !exited && (len(in.prog.items) > 0 || len(in.prog.end) > 0) {
+		in.mainLoop()
+	}
+	// exit runs the END actions too, unless it is in one
+	for _, body := range in.prog.end {
+		if err := in.action(body); err == errExit {
+			break
+		} else if err != nil {
+			in.fatalf("%s used in an END action", err)
+		}
+	}
+	return nil
+}
+
+// action runs the statements of an action, returning how next, nextfile
+// or exit ended it, even from a function.
+func (in *interp) action(body []stmt) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok || e != errNext && e != errNextFile && e != errExit {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return in.execStmts(body)
+}
+
+// mainLoop runs the items on the records until the input ends or exit.
+func (in *interp) mainLoop() {
+	for {
+		in.checkContext()
+		rec, ok := in.nextRecord()
+		if !ok {
+			return
+		}
+		in.setRecord(rec)
+		switch in.runItems() {
+		case errNextFile:
+			in.closeMain()
+		case errExit:
+			return
+		}
+	}
+}
+
+func (in *interp) runItems() error {
+	for i, it := range in.prog.items {
+		matched := true
+		switch {
+		case it.end != nil:
+			if !in.ranges[i] {
+				in.ranges[i] = in.eval(it.pattern).bool()
+			}
+			matched = in.ranges[i]
+			if matched && in.eval(it.end).bool() {
+				in.ranges[i] = false
+			}
+		case it.pattern != nil:
+			matched = in.eval(it.pattern).bool()
+		}
+		if !matched {
+			continue
+		}
+		if it.body == nil {
+			in.out.WriteString(in.record)
+			in.out.WriteString(in.toStr(in.globals[vORS].v))
+			continue
+		}
+		if err := in.action(it.body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextRecord reads the next record of the main input, counting it.
+func (in *interp) nextRecord() (string, bool) {
+	for {
+		if in.main == nil && !in.openNext() {
+			return "", false
+		}
+		rec, ok, err := in.main.read(in.rs())
+		if err != nil {
+			in.warnf("%s: %v", in.toStr(in.globals[vFILENAME].v), err)
+			in.failed = true
+		}
+		if !ok {
+			in.closeMain()
+			continue
+		}
+		in.globals[vNR].v = num(in.globals[vNR].v.num() + 1)
+		in.globals[vFNR].v = num(in.globals[vFNR].v.num() + 1)
+		return rec, true
+	}
+}
+
+// openNext opens the next file of ARGV, doing the assignments before
+// it. Stdin is read if there is no file.
+func (in *interp) openNext() bool {
+	for in.argIndex < int(in.globals[vARGC].v.num()) {
+		arg := in.toStr(in.globals[vARGV].array()[strconv.Itoa(in.argIndex)])
+		in.argIndex++
+		if arg == "" {
+			continue
+		}
+		if name, val, ok := assignment(arg); ok {
+			in.assignVar(name, val)
+			continue
+		}
+		in.sawFile = true
+		f, err := in.openFile(arg)
+		if err != nil {
+			in.warnf("%s: %v", arg, pathCause(err))
+			in.failed = true
+			continue
+		}
+		in.globals[vFILENAME].v = str(arg)
+		in.globals[vFNR].v = num(0)
+		if f == nil {
+			in.main = in.stdinReader()
+		} else {
+			in.main, in.mainCloser = newRecordReader(f), f
+		}
+		return true
+	}
+	if in.sawFile {
+		return false
+	}
+	in.sawFile = true
+	in.globals[vFNR].v = num(0)
+	in.main = in.stdinReader()
+	return true
+}
+
+func (in *interp) closeMain() {
+	if in.mainCloser != nil {
+		in.mainCloser.Close()
+	}
+	in.main, in.mainCloser = nil, nil
+}
+
+// rs returns the record separator and its regex if it is one.
+func (in *interp) rs() (string, *regexp.Regexp) {
+	rs := in.toStr(in.globals[vRS].v)
+	if len(rs) > 1 {
+		return rs, in.regex(rs)
+	}
+	return rs, nil
+}
+
+// assignment splits an operand of the form name=value.
+func assignment(arg string) (string, string, bool) {
+	name, val, ok := strings.Cut(arg, "=")
+	if !ok || name == "" || isDigit(name[0]) {
+		return "", "", false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c != '_' && !isLetter(c) && !isDigit(c) {
+			return "", "", false
+		}
+	}
+	return name, val, true
+}
+
+// assignVar assigns the value of a -v option or operand.
+func (in *interp) assignVar(name, val string) {
+	i, ok := in.prog.globals[name]
+	if !ok {
+		// the program does not use it
+		return
+	}
+	in.setVar(&varExpr{name: name, index: i}, strnum(unescapeString(val)))
+}
+
+func (in *interp) setRecord(s string) {
+	in.record = s
+	fs := in.toStr(in.globals[vFS].v)
+	rs := in.toStr(in.globals[vRS].v)
+	in.fields = in.split(s, fs, rs == "")
+	in.globals[vNF].v = num(float64(len(in.fields)))
+}
+
+// split splits s into fields at the separator fs: runs of blanks if it
+// is " ", each character if it is empty, the character if it is one
+// and otherwise the matches of the regex. Newlines separate fields too
+// in paragraph mode.
+func (in *interp) split(s, fs string, paragraph bool) []string {
+	if s == "" {
+		return nil
+	}
+	switch {
+	case fs == " ":
+		return strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' })
+	case fs == "":
+		var chars []string
+		for _, r := range s {
+			chars = append(chars, string(r))
+		}
+		return chars
+	case len(fs) == 1 && !paragraph:
+		return strings.Split(s, fs)
+	case len(fs) == 1:
+		return strings.FieldsFunc(s, func(r rune) bool { return r == rune(fs[0]) || r == '\n' })
+	case paragraph:
+		fs = "(" + fs + ")|\n"
+	}
+	return in.regex(fs).Split(s, -1)
+}
+
+func (in *interp) getField(i int) value {
+	if i == 0 {
+		return strnum(in.record)
+	}
+	if i <= len(in.fields) {
+		return strnum(in.fields[i-1])
+	}
+	return value{}
+}
+
+func (in *interp) setField(i int, s string) {
+	if i == 0 {
+		in.setRecord(s)
+		return
+	}
+	for len(in.fields) < i {
+		in.fields = append(in.fields, "")
+	}
+	in.fields[i-1] = s
+	in.globals[vNF].v = num(float64(len(in.fields)))
+	in.rebuild()
+}
+
+// maxField is the highest field number, as in mawk.
+const maxField = 32767
+
+// setNF truncates or extends the fields.
+func (in *interp) setNF(v value) {
+	f := v.num()
+	if f < 0 {
+		in.fatalf("NF set to negative value %d", int(f))
+	}
+	if f > maxField {
+		in.fatalf("NF set to %.0f exceeds the maximum number of fields %d", f, maxField)
+	}
+	n := int(f)
+	for len(in.fields) < n {
+		in.fields = append(in.fields, "")
+	}
+	in.fields = in.fields[:n]
+	in.globals[vNF].v = num(float64(n))
+	in.rebuild()
+}
+
+// rebuild joins the fields into the record.
+func (in *interp) rebuild() {
+	in.record = strings.Join(in.fields, in.toStr(in.globals[vOFS].v))
+}
+
+func (in *interp) fieldIndex(e expr) int {
+	n := in.eval(e).num()
+	if n < 0 || math.IsNaN(n) {
+		in.fatalf("trying to access out of range field %d", int(n))
+	}
+	if n > maxField {
+		in.fatalf("field $%.0f exceeds the maximum field %d", n, maxField)
+	}
+	return int(n)
+}
+
+func (in *interp) cell(v *varExpr) *cell {
+	if v.local {
+		return &in.frame[v.index]
+	}
+	return &in.globals[v.index]
+}
+
+func (in *interp) getVar(v *varExpr) value {
+	c := in.cell(v)
+	if c.arr != nil {
+		in.fatalf("attempt to use array %s in a scalar context", v.name)
+	}
+	return c.v
+}
+
+func (in *interp) setVar(v *varExpr, val value) {
+	c := in.cell(v)
+	if c.arr != nil {
+		in.fatalf("attempt to use array %s in a scalar context", v.name)
+	}
+	if !v.local && v.index == vNF {
+		in.setNF(val)
+		return
+	}
+	c.v = val
+}
+
+func (in *interp) array(v *varExpr) map[string]value {
+	return in.cell(v).array()
+}
+
+// key returns the subscript of the index, joined by SUBSEP.
+func (in *interp) key(index []expr) string {
+	if len(index) == 1 {
+		return in.toStr(in.eval(index[0]))
+	}
+	keys := make([]string, len(index))
+	for i, e := range index {
+		keys[i] = in.toStr(in.eval(e))
+	}
+	return strings.Join(keys, in.toStr(in.globals[vSUBSEP].v))
+}
+
+// element returns the element of the array, creating it. The elements
+// of ENVIRON are looked up when first used.
+func (in *interp) element(v *varExpr, arr map[string]value, key string) value {
+	val, ok := arr[key]
+	if !ok {
+		if !v.local && v.index == vENVIRON {
+			if s, found := in.lookupEnv(key); found {
+				val = strnum(s)
+			}
+		}
+		arr[key] = val
+	}
+	return val
+}
+
+// ref is an lvalue whose subscript is evaluated once.
+type ref struct {
+	get func() value
+	set func(value)
+}
+
+func (in *interp) ref(e expr) ref {
+	switch e := e.(type) {
+	case *varExpr:
+		return ref{
+			get: func() value { return in.getVar(e) },
+			set: func(v value) { in.setVar(e, v) },
+		}
+	case *fieldExpr:
+		i := in.fieldIndex(e.index)
+		return ref{
+			get: func() value { return in.getField(i) },
+			set: func(v value) { in.setField(i, in.toStr(v)) },
+		}
+	case *indexExpr:
+		arr := in.array(e.array)
+		key := in.key(e.index)
+		return ref{
+			get: func() value { return in.element(e.array, arr, key) },
+			set: func(v value) { arr[key] = v },
+		}
+	}
+	panic(fmt.Sprintf("awk: %T is not an lvalue", e))
+}
+
+func (in *interp) execStmts(stmts []stmt) error {
+	for _, s := range stmts {
+		if err := in.execStmt(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loop runs the body of a loop, reporting whether the loop goes on.
+func (in *interp) loop(body []stmt) (bool, error) {
+	in.checkContext()
+	switch err := in.execStmts(body); err {
+	case nil, errContinue:
+		return true, nil
+	case errBreak:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (in *interp) execStmt(s stmt) error {
+	switch s := s.(type) {
+	case *exprStmt:
+		in.eval(s.e)
+	case *printStmt:
+		in.print(s)
+	case *ifStmt:
+		if in.eval(s.cond).bool() {
+			return in.execStmts(s.then)
+		}
+		return in.execStmts(s.els)
+	case *whileStmt:
+		for in.eval(s.cond).bool() {
+			if ok, err := in.loop(s.body); !ok {
+				return err
+			}
+		}
+	case *doStmt:
+		for {
+			if ok, err := in.loop(s.body); !ok {
+				return err
+			}
+			if !in.eval(s.cond).bool() {
+				break
+			}
+		}
+	case *forStmt:
+		if s.init != nil {
+			if err := in.execStmt(s.init); err != nil {
+				return err
+			}
+		}
+		for s.cond == nil || in.eval(s.cond).bool() {
+			if ok, err := in.loop(s.body); !ok {
+				return err
+			}
+			if s.post != nil {
+				if err := in.execStmt(s.post); err != nil {
+					return err
+				}
+			}
+		}
+	case *forInStmt:
+		arr := in.array(s.array)
+		for _, key := range sortedKeys(arr) {
+			if _, ok := arr[key]; !ok {
+				// deleted by the body
+				continue
+			}
+			in.setVar(s.v, strnum(key))
+			if ok, err := in.loop(s.body); !ok {
+				return err
+			}
+		}
+	case *blockStmt:
+		return in.execStmts(s.body)
+	case *nextStmt:
+		return errNext
+	case *nextfileStmt:
+		return errNextFile
+	case *exitStmt:
+		if s.e != nil {
+			in.exitCode = int(in.eval(s.e).num())
+		}
+		return errExit
+	case *returnStmt:
+		in.retval = value{}
+		if s.e != nil {
+			in.retval = in.eval(s.e)
+		}
+		return errReturn
+	case *breakStmt:
+		return errBreak
+	case *continueStmt:
+		return errContinue
+	case *deleteStmt:
+		arr := in.array(s.array)
+		if s.index == nil {
+			clear(arr)
+		} else {
+			delete(arr, in.key(s.index))
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the subscripts in the order of for-in loops: the
+// numbers in increasing order, then the other strings.
+func sortedKeys(arr map[string]value) []string {
+	keys := make([]string, 0, len(arr))
+	for k := range arr {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, aok := looksNumeric(keys[i])
+		b, bok := looksNumeric(keys[j])
+		switch {
+		case aok && bok && a != b:
+			return a < b
+		case aok != bok:
+			return aok
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func (in *interp) print(s *printStmt) {
+	var text string
+	if s.printf {
+		args := make([]value, len(s.args))
+		for i, e := range s.args {
+			args[i] = in.eval(e)
+		}
+		text = sprintf(in.toStr(args[0]), args[1:], in.convfmt())
+	} else {
+		var sb strings.Builder
+		if len(s.args) == 0 {
+			sb.WriteString(in.record)
+		}
+		ofmt := in.globals[vOFMT].v.str("%.6g")
+		for i, e := range s.args {
+			if i > 0 {
+				sb.WriteString(in.toStr(in.globals[vOFS].v))
+			}
+			sb.WriteString(in.eval(e).str(ofmt))
+		}
+		sb.WriteString(in.toStr(in.globals[vORS].v))
+		text = sb.String()
+	}
+	if s.redirect == 0 {
+		in.out.WriteString(text)
+		return
+	}
+	dest := in.toStr(in.eval(s.dest))
+	st, err := in.openOutput(s.redirect, dest)
+	if err != nil {
+		in.fatalf("can't redirect to %s: %v", dest, pathCause(err))
+	}
+	st.w.WriteString(text)
+	if st.unbuffered {
+		st.w.Flush()
+	}
+}
+
+func (in *interp) eval(e expr) value {
+	switch e := e.(type) {
+	case *numExpr:
+		return num(e.n)
+	case *strExpr:
+		return str(e.s)
+	case *regexExpr:
+		return boolean(in.regex(e.re).MatchString(in.record))
+	case *varExpr:
+		return in.getVar(e)
+	case *fieldExpr:
+		return in.getField(in.fieldIndex(e.index))
+	case *indexExpr:
+		return in.element(e.array, in.array(e.array), in.key(e.index))
+	case *assignExpr:
+		r := in.ref(e.left)
+		var v value
+		if e.op == tAssign {
+			v = in.eval(e.right)
+		} else {
+			left := r.get().num()
+			v = num(in.arith(assignOps[e.op], left, in.eval(e.right).num()))
+		}
+		r.set(v)
+		return v
+	case *condExpr:
+		if in.eval(e.cond).bool() {
+			return in.eval(e.yes)
+		}
+		return in.eval(e.no)
+	case *binaryExpr:
+		return in.binary(e)
+	case *matchExpr:
+		s := in.toStr(in.eval(e.left))
+		return boolean(in.regexOf(e.re).MatchString(s) != e.not)
+	case *inExpr:
+		arr := in.array(e.array)
+		key := in.key(e.index)
+		_, ok := arr[key]
+		if !ok && !e.array.local && e.array.index == vENVIRON {
+			_, ok = in.lookupEnv(key)
+		}
+		return boolean(ok)
+	case *unaryExpr:
+		v := in.eval(e.e)
+		switch e.op {
+		case tSub:
+			return num(-v.num())
+		case tAdd:
+			return num(v.num())
+		}
+		return boolean(!v.bool())
+	case *incrExpr:
+		r := in.ref(e.e)
+		old := r.get().num()
+		n := old + 1
+		if e.op == tDecr {
+			n = old - 1
+		}
+		r.set(num(n))
+		if e.pre {
+			return num(n)
+		}
+		return num(old)
+	case *callExpr:
+		return in.call(e)
+	case *builtinExpr:
+		return in.builtin(e)
+	case *getlineExpr:
+		return in.getline(e)
+	case *groupExpr:
+		in.fatalf("syntax error: a list of expressions is not a value")
+	}
+	panic(fmt.Sprintf("awk: unknown expression %T", e))
+}
+
+var assignOps = map[token]token{
+	tAddAssign: tAdd,
+	tSubAssign: tSub,
+	tMulAssign: tMul,
+	tDivAssign: tDiv,
+	tModAssign: tMod,
+	tPowAssign: tPow,
+}
+
+func (in *interp) arith(op token, a, b float64) float64 {
+	switch op {
+	case tAdd:
+		return a + b
+	case tSub:
+		return a - b
+	case tMul:
+		return a * b
+	case tDiv:
+		if b == 0 {
+			in.fatalf("division by zero")
+		}
+		return a / b
+	case tMod:
+		if b == 0 {
+			in.fatalf("division by zero in %%")
+		}
+		return math.Mod(a, b)
+	}
+	return math.Pow(a, b)
+}
+
+func (in *interp) binary(e *binaryExpr) value {
+	switch e.op {
+	case tAnd:
+		return boolean(in.eval(e.left).bool() && in.eval(e.right).bool())
+	case tOr:
+		return boolean(in.eval(e.left).bool() || in.eval(e.right).bool())
+	}
+	left, right := in.eval(e.left), in.eval(e.right)
+	switch e.op {
+	case tConcat:
+		return str(in.toStr(left) + in.toStr(right))
+	case tLess:
+		return boolean(in.compare(left, right) < 0)
+	case tLessEqual:
+		return boolean(in.compare(left, right) <= 0)
+	case tGreater:
+		return boolean(in.compare(left, right) > 0)
+	case tGreaterEqual:
+		return boolean(in.compare(left, right) >= 0)
+	case tEqual:
+		return boolean(in.compare(left, right) == 0)
+	case tNotEqual:
+		return boolean(in.compare(left, right) != 0)
+	}
+	return num(in.arith(e.op, left.num(), right.num()))
+}
+
+// compare compares numerically if both values are numbers and as
+// strings otherwise.
+func (in *interp) compare(a, b value) int {
+	if a.numeric() && b.numeric() {
+		x, y := a.num(), b.num()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(in.toStr(a), in.toStr(b))
+}
+
+func (in *interp) call(e *callExpr) value {
+	fn := e.fn
+	frame := make([]cell, len(fn.params))
+	for i, arg := range e.args {
+		if v, ok := arg.(*varExpr); ok {
+			// arrays are passed by reference
+			c := in.cell(v)
+			if c.arr != nil {
+				frame[i].arr = c.arr
+			} else {
+				frame[i].v, frame[i].ref = c.v, c
+			}
+			continue
+		}
+		frame[i].v = in.eval(arg)
+	}
+	if in.depth >= maxDepth {
+		in.fatalf("function %s: call nesting too deep", fn.name)
+	}
+	saved := in.frame
+	in.frame = frame
+	in.depth++
+	err := in.execStmts(fn.body)
+	in.depth--
+	in.frame = saved
+	switch err {
+	case nil:
+		return value{}
+	case errReturn:
+		v := in.retval
+		in.retval = value{}
+		return v
+	}
+	// next, nextfile or exit end the action calling the function
+	panic(err)
+}
+
+// getline reads a record, returning 1, 0 at the end of the input or -1
+// if the input can not be read.
+func (in *interp) getline(e *getlineExpr) value {
+	var rec string
+	switch e.kind {
+	case tLess, tPipe:
+		name := in.toStr(in.eval(e.src))
+		st, err := in.openInput(e.kind, name)
+		if err != nil {
+			return num(-1)
+		}
+		s, ok, err := st.r.read(in.rs())
+		if err != nil {
+			return num(-1)
+		}
+		if !ok {
+			return num(0)
+		}
+		if e.kind == tPipe {
+			in.globals[vNR].v = num(in.globals[vNR].v.num() + 1)
+		}
+		rec = s
+	default:
+		s, ok := in.nextRecord()
+		if !ok {
+			return num(0)
+		}
+		rec = s
+	}
+	if e.target == nil {
+		in.setRecord(rec)
+	} else {
+		in.ref(e.target).set(strnum(rec))
+	}
+	return num(1)
+}
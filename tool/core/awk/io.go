@@ -0,0 +1,294 @@
+package awk
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// recordReader splits its input into records at the record separator,
+// which may change between reads.
+type recordReader struct {
+	r   io.Reader
+	buf []byte
+	off int
+	eof bool
+	err error
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	return &recordReader{r: r}
+}
+
+// fill reads more input, reporting whether there is more.
+func (rr *recordReader) fill() bool {
+	if rr.eof {
+		return false
+	}
+	if rr.off > 0 {
+		rr.buf = append(rr.buf[:0], rr.buf[rr.off:]...)
+		rr.off = 0
+	}
+	if len(rr.buf) == cap(rr.buf) {
+		rr.buf = append(rr.buf, make([]byte, max(4096, len(rr.buf)))...)[:len(rr.buf)]
+	}
+	n, err := rr.r.Read(rr.buf[len(rr.buf):cap(rr.buf)])
+	rr.buf = rr.buf[:len(rr.buf)+n]
+	if err != nil {
+		rr.eof = true
+		if err != io.EOF {
+			rr.err = err
+		}
+	}
+	return true
+}
+
+// take returns the next n bytes as a record, skipping skip more bytes.
+func (rr *recordReader) take(n, skip int) string {
+	s := string(rr.buf[rr.off : rr.off+n])
+	rr.off += n + skip
+	return s
+}
+
+// read returns the next record ended by rs: a newline by default, a
+// blank line if rs is empty and a match of the regex re if rs is longer
+// than one character.
+func (rr *recordReader) read(rs string, re *regexp.Regexp) (string, bool, error) {
+	if rs == "" {
+		return rr.readParagraph()
+	}
+	for {
+		data := rr.buf[rr.off:]
+		if len(rs) == 1 {
+			if i := bytes.IndexByte(data, rs[0]); i >= 0 {
+				return rr.take(i, 1), true, nil
+			}
+		} else if loc := re.FindIndex(data); loc != nil && loc[1] > loc[0] && (loc[1] < len(data) || rr.eof) {
+			// a match at the end may go on with more input
+			return rr.take(loc[0], loc[1]-loc[0]), true, nil
+		}
+		if !rr.fill() {
+			if len(data) == 0 {
+				return "", false, rr.err
+			}
+			return rr.take(len(data), 0), true, nil
+		}
+	}
+}
+
+// readParagraph returns the lines up to the next blank lines.
+func (rr *recordReader) readParagraph() (string, bool, error) {
+	for {
+		for rr.off < len(rr.buf) && rr.buf[rr.off] == '\n' {
+			rr.off++
+		}
+		if rr.off < len(rr.buf) || !rr.fill() {
+			break
+		}
+	}
+	for {
+		data := rr.buf[rr.off:]
+		if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+			return rr.take(i, 2), true, nil
+		}
+		if !rr.fill() {
+			if len(data) == 0 {
+				return "", false, rr.err
+			}
+			return rr.take(len(bytes.TrimRight(data, "\n")), len(data)), true, nil
+		}
+	}
+}
+
+// syncWriter serializes the writes of awk and of its commands.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// stream is a file or command opened by a redirection or getline.
+type stream struct {
+	w *bufio.Writer
+	r *recordReader
+	// unbuffered streams are flushed after each write
+	unbuffered bool
+	// close closes the file or waits for the command, returning the
+	// exit status
+	close func() int
+}
+
+var errNoAccess = errors.New("not supported in this environment")
+
+// openOutput opens the output redirection to the file or command dest.
+func (in *interp) openOutput(redirect token, dest string) (*stream, error) {
+	if s, ok := in.streams[dest]; ok && s.w != nil {
+		return s, nil
+	}
+	var s *stream
+	switch {
+	case redirect == tPipe:
+		if in.exec == nil {
+			return nil, errNoAccess
+		}
+		in.flush()
+		pr, pw := io.Pipe()
+		done := make(chan int, 1)
+		go func() {
+			status := in.run(dest, pr, in.stdout)
+			// the writes fail once the command is gone
+			pr.CloseWithError(errors.New("command exited"))
+			done <- status
+		}()
+		s = &stream{w: bufio.NewWriter(pw), close: func() int {
+			pw.Close()
+			return <-done
+		}}
+	case dest == "/dev/stdout" || dest == "-":
+		s = &stream{w: in.out, close: func() int { return 0 }}
+	case dest == "/dev/stderr":
+		s = &stream{w: bufio.NewWriter(in.stderr), unbuffered: true, close: func() int { return 0 }}
+	default:
+		if in.open == nil {
+			return nil, errNoAccess
+		}
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if redirect == tAppend {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := in.open(in.ctx, in.resolve(dest), flag, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		s = &stream{w: bufio.NewWriter(f), close: func() int {
+			if f.Close() != nil {
+				return -1
+			}
+			return 0
+		}}
+	}
+	in.streams[dest] = s
+	return s, nil
+}
+
+// openInput opens the file or command src for getline.
+func (in *interp) openInput(kind token, src string) (*stream, error) {
+	if s, ok := in.streams[src]; ok && s.r != nil {
+		return s, nil
+	}
+	var s *stream
+	switch {
+	case kind == tPipe:
+		if in.exec == nil {
+			return nil, errNoAccess
+		}
+		in.flush()
+		pr, pw := io.Pipe()
+		done := make(chan int, 1)
+		go func() {
+			status := in.run(src, nil, pw)
+			pw.Close()
+			done <- status
+		}()
+		s = &stream{r: newRecordReader(pr), close: func() int {
+			pr.Close()
+			return <-done
+		}}
+	case src == "-" || src == "/dev/stdin":
+		s = &stream{r: in.stdinReader(), close: func() int { return 0 }}
+	default:
+		if in.open == nil {
+			return nil, errNoAccess
+		}
+		f, err := in.open(in.ctx, in.resolve(src), os.O_RDONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		s = &stream{r: newRecordReader(f), close: func() int {
+			if f.Close() != nil {
+				return -1
+			}
+			return 0
+		}}
+	}
+	in.streams[src] = s
+	return s, nil
+}
+
+// run runs the command line with no input unless it is an output pipe.
+// Errors are reported and have the status 127.
+func (in *interp) run(cmdline string, stdin io.Reader, stdout io.Writer) int {
+	if in.exec == nil {
+		in.warnf("%s: %v", cmdline, errNoAccess)
+		return 127
+	}
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	status, err := in.exec(in.ctx, cmdline, stdin, stdout, in.stderr)
+	if err != nil {
+		in.warnf("%s: %v", cmdline, err)
+		return 127
+	}
+	return status
+}
+
+// stdinReader returns the reader of stdin, shared by the main input and
+// getline.
+func (in *interp) stdinReader() *recordReader {
+	if in.stdin == nil {
+		in.stdin = newRecordReader(in.stdinSrc)
+	}
+	return in.stdin
+}
+
+// closeStream closes the named stream, returning -1 if it is not open.
+func (in *interp) closeStream(name string) int {
+	s, ok := in.streams[name]
+	if !ok {
+		return -1
+	}
+	delete(in.streams, name)
+	if s.w != nil {
+		s.w.Flush()
+	}
+	return s.close()
+}
+
+// flush writes the buffered output of stdout and of the streams.
+func (in *interp) flush() {
+	in.out.Flush()
+	for _, s := range in.streams {
+		if s.w != nil {
+			s.w.Flush()
+		}
+	}
+}
+
+func (in *interp) closeAll() {
+	in.out.Flush()
+	for name := range in.streams {
+		in.closeStream(name)
+	}
+}
+
+// openFile opens an input operand.
+func (in *interp) openFile(name string) (io.ReadCloser, error) {
+	if name == "-" || name == "/dev/stdin" {
+		return nil, nil
+	}
+	if in.open == nil {
+		return nil, errNoAccess
+	}
+	return in.open(in.ctx, in.resolve(name), os.O_RDONLY, 0)
+}
@@ -0,0 +1,420 @@
+package awk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type token int
+
+const (
+	tEOF token = iota
+	tNewline
+	tNumber
+	tString
+	tRegex
+	tName
+	// tFuncName is a name directly followed by "(", a call of a function
+	tFuncName
+	tBuiltin
+
+	// keywords
+	tBegin
+	tEnd
+	tFunction
+	tIf
+	tElse
+	tWhile
+	tFor
+	tDo
+	tBreak
+	tContinue
+	tNext
+	tNextfile
+	tExit
+	tReturn
+	tDelete
+	tIn
+	tGetline
+	tPrint
+	tPrintf
+
+	// punctuation and operators
+	tLbrace
+	tRbrace
+	tLparen
+	tRparen
+	tLbracket
+	tRbracket
+	tSemicolon
+	tComma
+	tAdd
+	tSub
+	tMul
+	tDiv
+	tMod
+	tPow
+	tNot
+	tGreater
+	tLess
+	tPipe
+	tQuestion
+	tColon
+	tMatch
+	tNotMatch
+	tDollar
+	tAssign
+	tAddAssign
+	tSubAssign
+	tMulAssign
+	tDivAssign
+	tModAssign
+	tPowAssign
+	tEqual
+	tNotEqual
+	tLessEqual
+	tGreaterEqual
+	tIncr
+	tDecr
+	tAnd
+	tOr
+	tAppend
+	// tConcat is the implicit operator of concatenation
+	tConcat
+)
+
+var keywords = map[string]token{
+	"BEGIN":    tBegin,
+	"END":      tEnd,
+	"function": tFunction,
+	"func":     tFunction,
+	"if":       tIf,
+	"else":     tElse,
+	"while":    tWhile,
+	"for":      tFor,
+	"do":       tDo,
+	"break":    tBreak,
+	"continue": tContinue,
+	"next":     tNext,
+	"nextfile": tNextfile,
+	"exit":     tExit,
+	"return":   tReturn,
+	"delete":   tDelete,
+	"in":       tIn,
+	"getline":  tGetline,
+	"print":    tPrint,
+	"printf":   tPrintf,
+}
+
+var builtins = map[string]bool{
+	"atan2": true, "close": true, "cos": true, "exp": true, "fflush": true,
+	"gsub": true, "index": true, "int": true, "length": true, "log": true,
+	"match": true, "rand": true, "sin": true, "split": true, "sprintf": true,
+	"sqrt": true, "srand": true, "sub": true, "substr": true, "system": true,
+	"tolower": true, "toupper": true,
+}
+
+// operators by length, longest first
+var operators = []struct {
+	s string
+	t token
+}{
+	{"**=", tPowAssign},
+	{"&&", tAnd}, {"||", tOr}, {"==", tEqual}, {"!=", tNotEqual},
+	{"<=", tLessEqual}, {">=", tGreaterEqual}, {"++", tIncr}, {"--", tDecr},
+	{"+=", tAddAssign}, {"-=", tSubAssign}, {"*=", tMulAssign}, {"/=", tDivAssign},
+	{"%=", tModAssign}, {"^=", tPowAssign}, {"!~", tNotMatch}, {">>", tAppend},
+	{"**", tPow},
+	{"{", tLbrace}, {"}", tRbrace}, {"(", tLparen}, {")", tRparen},
+	{"[", tLbracket}, {"]", tRbracket}, {";", tSemicolon}, {",", tComma},
+	{"+", tAdd}, {"-", tSub}, {"*", tMul}, {"/", tDiv}, {"%", tMod},
+	{"^", tPow}, {"!", tNot}, {">", tGreater}, {"<", tLess}, {"|", tPipe},
+	{"?", tQuestion}, {":", tColon}, {"~", tMatch}, {"$", tDollar}, {"=", tAssign},
+}
+
+// lexer splits the program text into tokens. The parser asks for a regex
+// where a "/" starts an operand.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+
+	tok  token
+	text string
+	num  float64
+	// tokLine is the line of the current token
+	tokLine int
+	// start is the offset of the current token
+	start int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1}
+}
+
+// next scans the next token.
+func (l *lexer) next() error {
+	l.skipBlanks()
+	l.start, l.tokLine, l.text = l.pos, l.line, ""
+	if l.pos >= len(l.src) {
+		l.tok = tEOF
+		return nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case c == '\n':
+		l.pos++
+		l.line++
+		l.tok = tNewline
+		return nil
+	case c == '"':
+		return l.string()
+	case isDigit(c) || c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+		return l.number()
+	case c == '_' || isLetter(c):
+		end := l.pos
+		for end < len(l.src) && (l.src[end] == '_' || isLetter(l.src[end]) || isDigit(l.src[end])) {
+			end++
+		}
+		l.text = l.src[l.pos:end]
+		l.pos = end
+		if t, ok := keywords[l.text]; ok {
+			l.tok = t
+		} else if builtins[l.text] {
+			l.tok = tBuiltin
+		} else if l.pos < len(l.src) && l.src[l.pos] == '(' {
+			l.tok = tFuncName
+		} else {
+			l.tok = tName
+		}
+		return nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op.s) {
+			l.pos += len(op.s)
+			l.tok, l.text = op.t, op.s
+			return nil
+		}
+	}
+	return l.errorf("invalid character '%c'", c)
+}
+
+// skipBlanks skips blanks, comments and escaped newlines.
+func (l *lexer) skipBlanks() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '\\' && strings.HasPrefix(l.src[l.pos+1:], "\n"):
+			l.pos += 2
+			l.line++
+		case c == '\\' && strings.HasPrefix(l.src[l.pos+1:], "\r\n"):
+			l.pos += 3
+			l.line++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) number() error {
+	end := l.pos
+	if strings.HasPrefix(l.src[end:], "0x") || strings.HasPrefix(l.src[end:], "0X") {
+		end += 2
+		for end < len(l.src) && strings.IndexByte("0123456789abcdefABCDEF", l.src[end]) >= 0 {
+			end++
+		}
+		n, err := strconv.ParseUint(l.src[l.pos+2:end], 16, 64)
+		if err == nil {
+			l.tok, l.num, l.text = tNumber, float64(n), l.src[l.pos:end]
+			l.pos = end
+			return nil
+		}
+		end = l.pos
+	}
+	for end < len(l.src) && isDigit(l.src[end]) {
+		end++
+	}
+	if end < len(l.src) && l.src[end] == '.' {
+		end++
+		for end < len(l.src) && isDigit(l.src[end]) {
+			end++
+		}
+	}
+	if end < len(l.src) && (l.src[end] == 'e' || l.src[end] == 'E') {
+		e := end + 1
+		if e < len(l.src) && (l.src[e] == '+' || l.src[e] == '-') {
+			e++
+		}
+		if e < len(l.src) && isDigit(l.src[e]) {
+			for e < len(l.src) && isDigit(l.src[e]) {
+				e++
+			}
+			end = e
+		}
+	}
+	n, err := strconv.ParseFloat(l.src[l.pos:end], 64)
+	if err != nil {
+		return l.errorf("invalid number %s", l.src[l.pos:end])
+	}
+	l.tok, l.num, l.text = tNumber, n, l.src[l.pos:end]
+	l.pos = end
+	return nil
+}
+
+func (l *lexer) string() error {
+	var sb strings.Builder
+	for i := l.pos + 1; i < len(l.src); i++ {
+		c := l.src[i]
+		switch c {
+		case '"':
+			l.pos = i + 1
+			l.tok, l.text = tString, sb.String()
+			return nil
+		case '\n':
+			return l.errorf("unterminated string")
+		case '\\':
+			if i+1 < len(l.src) && l.src[i+1] == '\n' {
+				// a continued line
+				i++
+				l.line++
+				continue
+			}
+			i = unescape(&sb, l.src, i)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return l.errorf("unterminated string")
+}
+
+// regex scans a regex literal, the current token being the "/" or "/="
+// starting it.
+func (l *lexer) regex() error {
+	i := l.start + 1
+	var sb strings.Builder
+	inBracket := false
+	for ; i < len(l.src); i++ {
+		c := l.src[i]
+		switch {
+		case c == '\n':
+			return l.errorf("unterminated regexp")
+		case c == '\\' && i+1 < len(l.src):
+			if l.src[i+1] == '/' {
+				sb.WriteByte('/')
+			} else {
+				sb.WriteString(l.src[i : i+2])
+			}
+			i++
+			continue
+		case c == '[' && !inBracket:
+			inBracket = true
+			sb.WriteByte(c)
+			// a leading "]" is literal
+			if strings.HasPrefix(l.src[i+1:], "^]") {
+				sb.WriteString("^]")
+				i += 2
+			} else if strings.HasPrefix(l.src[i+1:], "]") {
+				sb.WriteByte(']')
+				i++
+			}
+			continue
+		case c == '[' && strings.HasPrefix(l.src[i+1:], ":"):
+			end := strings.Index(l.src[i+2:], ":]")
+			if end >= 0 {
+				sb.WriteString(l.src[i : i+2+end+2])
+				i += 2 + end + 1
+				continue
+			}
+		case c == ']':
+			inBracket = false
+		case c == '/' && !inBracket:
+			l.pos = i + 1
+			l.tok, l.text = tRegex, sb.String()
+			return nil
+		}
+		sb.WriteByte(c)
+	}
+	return l.errorf("unterminated regexp")
+}
+
+// unescape writes the escape sequence at s[i] and returns the offset of
+// its last byte.
+func unescape(sb *strings.Builder, s string, i int) int {
+	if i+1 >= len(s) {
+		sb.WriteByte('\\')
+		return i
+	}
+	i++
+	switch c := s[i]; c {
+	case 'a':
+		sb.WriteByte('\a')
+	case 'b':
+		sb.WriteByte('\b')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'r':
+		sb.WriteByte('\r')
+	case 't':
+		sb.WriteByte('\t')
+	case 'v':
+		sb.WriteByte('\v')
+	case '"', '\\', '/':
+		sb.WriteByte(c)
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n := 0
+		j := i
+		for ; j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7'; j++ {
+			n = n*8 + int(s[j]-'0')
+		}
+		sb.WriteByte(byte(n))
+		return j - 1
+	default:
+		// unknown sequences keep the backslash, as regexes need it
+		sb.WriteByte('\\')
+		sb.WriteByte(c)
+	}
+	return i
+}
+
+// unescapeString processes the escape sequences of s, as in -v
+// assignments.
+func unescapeString(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i = unescape(&sb, s, i)
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+// syntaxError is an error in the program text.
+type syntaxError struct {
+	source string
+	line   int
+	msg    string
+}
+
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.source, e.line, e.msg)
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return &syntaxError{line: l.line, msg: fmt.Sprintf(format, args...)}
+}
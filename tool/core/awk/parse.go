@@ -0,0 +1,951 @@
+package awk
+
+import (
+	"fmt"
+	"slices"
+)
+
+// expressions
+type (
+	expr interface{}
+
+	numExpr struct{ n float64 }
+	strExpr struct{ s string }
+	// regexExpr matches $0, or is the regex of ~, split, sub, gsub and
+	// match
+	regexExpr struct{ re string }
+	varExpr   struct {
+		name  string
+		local bool
+		index int
+	}
+	fieldExpr struct{ index expr }
+	indexExpr struct {
+		array *varExpr
+		index []expr
+	}
+	// assignExpr assigns, or with op updates, the lvalue
+	assignExpr struct {
+		left  expr
+		op    token
+		right expr
+	}
+	condExpr struct {
+		cond, yes, no expr
+	}
+	binaryExpr struct {
+		op          token
+		left, right expr
+	}
+	matchExpr struct {
+		left, re expr
+		not      bool
+	}
+	inExpr struct {
+		index []expr
+		array *varExpr
+	}
+	unaryExpr struct {
+		op token
+		e  expr
+	}
+	incrExpr struct {
+		e   expr
+		op  token
+		pre bool
+	}
+	callExpr struct {
+		name string
+		fn   *function
+		args []expr
+	}
+	builtinExpr struct {
+		name string
+		args []expr
+	}
+	// getlineExpr reads the next record, from the file with tLess or
+	// from the command with tPipe, into $0 or the target
+	getlineExpr struct {
+		kind   token
+		src    expr
+		target expr
+	}
+	// groupExpr is a parenthesized list, only valid before in or as the
+	// arguments of print
+	groupExpr struct{ exprs []expr }
+)
+
+// statements
+type (
+	stmt interface{}
+
+	exprStmt  struct{ e expr }
+	printStmt struct {
+		printf   bool
+		args     []expr
+		redirect token
+		dest     expr
+	}
+	ifStmt struct {
+		cond      expr
+		then, els []stmt
+	}
+	whileStmt struct {
+		cond expr
+		body []stmt
+	}
+	doStmt struct {
+		body []stmt
+		cond expr
+	}
+	forStmt struct {
+		init stmt
+		cond expr
+		post stmt
+		body []stmt
+	}
+	forInStmt struct {
+		v     *varExpr
+		array *varExpr
+		body  []stmt
+	}
+	blockStmt    struct{ body []stmt }
+	nextStmt     struct{}
+	nextfileStmt struct{}
+	exitStmt     struct{ e expr }
+	returnStmt   struct{ e expr }
+	breakStmt    struct{}
+	continueStmt struct{}
+	deleteStmt   struct {
+		array *varExpr
+		index []expr
+	}
+)
+
+// item is a pattern and action. A nil body prints the record.
+type item struct {
+	pattern, end expr
+	body         []stmt
+}
+
+type function struct {
+	name   string
+	params []string
+	body   []stmt
+}
+
+type program struct {
+	begin, end [][]stmt
+	items      []item
+	funcs      map[string]*function
+	globals    map[string]int
+}
+
+// the special variables come first in the globals
+const (
+	vNF = iota
+	vNR
+	vFNR
+	vFS
+	vOFS
+	vORS
+	vRS
+	vFILENAME
+	vSUBSEP
+	vRSTART
+	vRLENGTH
+	vCONVFMT
+	vOFMT
+	vENVIRON
+	vARGC
+	vARGV
+	numSpecials
+)
+
+var specials = []string{
+	"NF", "NR", "FNR", "FS", "OFS", "ORS", "RS", "FILENAME", "SUBSEP",
+	"RSTART", "RLENGTH", "CONVFMT", "OFMT", "ENVIRON", "ARGC", "ARGV",
+}
+
+// source is a part of the program text, the -f files or the operand.
+type source struct {
+	name string
+	text string
+}
+
+type parser struct {
+	*lexer
+	source string
+	prog   *program
+
+	// params are the parameters of the function being parsed
+	params []string
+	inFunc bool
+	loops  int
+	// noGreater makes ">" a redirection in the arguments of print
+	noGreater bool
+	calls     []*callExpr
+}
+
+// parse parses the program sources.
+func parse(sources []source) (*program, error) {
+	prog := &program{
+		funcs:   map[string]*function{},
+		globals: map[string]int{},
+	}
+	for i, name := range specials {
+		prog.globals[name] = i
+	}
+	p := &parser{prog: prog}
+	for _, src := range sources {
+		p.lexer, p.source = newLexer(src.text), src.name
+		if err := p.catch(p.program); err != nil {
+			return nil, err
+		}
+	}
+	for _, call := range p.calls {
+		fn, ok := prog.funcs[call.name]
+		if !ok {
+			return nil, fmt.Errorf("function %s never defined", call.name)
+		}
+		if len(call.args) > len(fn.params) {
+			return nil, fmt.Errorf("function %s called with %d args, accepts only %d", call.name, len(call.args), len(fn.params))
+		}
+		call.fn = fn
+	}
+	return prog, nil
+}
+
+// catch runs the parse function, returning the syntax error it panics
+// with.
+func (p *parser) catch(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*syntaxError)
+			if !ok {
+				panic(r)
+			}
+			e.source = p.source
+			err = e
+		}
+	}()
+	p.next()
+	f()
+	return nil
+}
+
+func (p *parser) next() {
+	if err := p.lexer.next(); err != nil {
+		panic(err)
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) {
+	panic(&syntaxError{line: p.tokLine, msg: fmt.Sprintf(format, args...)})
+}
+
+// unexpected fails at the current token.
+func (p *parser) unexpected() {
+	switch p.tok {
+	case tEOF:
+		p.errorf("syntax error: unexpected end of program")
+	case tNewline:
+		p.errorf("syntax error: unexpected newline")
+	case tString:
+		p.errorf("syntax error at %q", p.text)
+	case tNumber:
+		p.errorf("syntax error at %s", p.text)
+	}
+	p.errorf("syntax error at %s", p.lexer.src[p.start:p.pos])
+}
+
+func (p *parser) expect(t token) {
+	if p.tok != t {
+		p.unexpected()
+	}
+	p.next()
+}
+
+func (p *parser) optNewlines() {
+	for p.tok == tNewline {
+		p.next()
+	}
+}
+
+// skipTerminators skips newlines and semicolons.
+func (p *parser) skipTerminators() {
+	for p.tok == tNewline || p.tok == tSemicolon {
+		p.next()
+	}
+}
+
+func (p *parser) program() {
+	p.skipTerminators()
+	for p.tok != tEOF {
+		switch p.tok {
+		case tFunction:
+			p.function()
+		case tBegin:
+			p.next()
+			p.prog.begin = append(p.prog.begin, p.action())
+		case tEnd:
+			p.next()
+			p.prog.end = append(p.prog.end, p.action())
+		case tLbrace:
+			p.prog.items = append(p.prog.items, item{body: p.action()})
+		default:
+			it := item{pattern: p.expr()}
+			if p.tok == tComma {
+				p.next()
+				p.optNewlines()
+				it.end = p.expr()
+			}
+			if p.tok == tLbrace {
+				it.body = p.action()
+			}
+			p.prog.items = append(p.prog.items, it)
+		}
+		p.skipTerminators()
+	}
+}
+
+func (p *parser) function() {
+	p.next()
+	if p.tok != tName && p.tok != tFuncName {
+		p.unexpected()
+	}
+	name := p.text
+	if _, ok := p.prog.funcs[name]; ok {
+		p.errorf("function %s redefined", name)
+	}
+	if _, ok := p.prog.globals[name]; ok {
+		p.errorf("function name %s previously used as a variable", name)
+	}
+	p.next()
+	p.expect(tLparen)
+	var params []string
+	for p.tok != tRparen {
+		if p.tok != tName {
+			p.unexpected()
+		}
+		if p.text == name || slices.Contains(params, p.text) || slices.Contains(specials, p.text) {
+			p.errorf("invalid parameter %s of function %s", p.text, name)
+		}
+		params = append(params, p.text)
+		p.next()
+		if p.tok == tRparen {
+			break
+		}
+		p.expect(tComma)
+		p.optNewlines()
+	}
+	p.next()
+	p.optNewlines()
+	p.params, p.inFunc = params, true
+	body := p.action()
+	p.params, p.inFunc = nil, false
+	p.prog.funcs[name] = &function{name: name, params: params, body: body}
+}
+
+// action parses a block of statements.
+func (p *parser) action() []stmt {
+	p.expect(tLbrace)
+	// an empty action is not nil, which prints the record
+	body := []stmt{}
+	for {
+		p.skipTerminators()
+		if p.tok == tRbrace {
+			break
+		}
+		body = append(body, p.stmt())
+	}
+	p.next()
+	return body
+}
+
+// body parses the statement of if, else and loops.
+func (p *parser) body() []stmt {
+	p.optNewlines()
+	if p.tok == tSemicolon {
+		p.next()
+		return nil
+	}
+	s := p.stmt()
+	if b, ok := s.(*blockStmt); ok {
+		return b.body
+	}
+	return []stmt{s}
+}
+
+func (p *parser) loopBody() []stmt {
+	p.loops++
+	defer func() { p.loops-- }()
+	return p.body()
+}
+
+func (p *parser) stmt() stmt {
+	switch p.tok {
+	case tLbrace:
+		return &blockStmt{p.action()}
+	case tIf:
+		p.next()
+		p.expect(tLparen)
+		s := &ifStmt{cond: p.expr()}
+		p.expect(tRparen)
+		s.then = p.body()
+		// else may follow the terminator of the statement
+		lex := *p.lexer
+		p.skipTerminators()
+		if p.tok == tElse {
+			p.next()
+			s.els = p.body()
+		} else {
+			*p.lexer = lex
+		}
+		return s
+	case tWhile:
+		p.next()
+		p.expect(tLparen)
+		s := &whileStmt{cond: p.expr()}
+		p.expect(tRparen)
+		s.body = p.loopBody()
+		return s
+	case tDo:
+		p.next()
+		s := &doStmt{body: p.loopBody()}
+		p.skipTerminators()
+		p.expect(tWhile)
+		p.expect(tLparen)
+		s.cond = p.expr()
+		p.expect(tRparen)
+		p.terminator()
+		return s
+	case tFor:
+		return p.forStmt()
+	}
+	s := p.simpleStmt()
+	p.terminator()
+	return s
+}
+
+// terminator ends a simple statement.
+func (p *parser) terminator() {
+	switch p.tok {
+	case tNewline, tSemicolon:
+		p.next()
+	case tRbrace, tEOF:
+	default:
+		p.unexpected()
+	}
+}
+
+func (p *parser) forStmt() stmt {
+	p.next()
+	p.expect(tLparen)
+	var init stmt
+	if p.tok != tSemicolon {
+		init = p.simpleStmt()
+		if e, ok := init.(*exprStmt); ok && p.tok == tRparen {
+			in, ok := e.e.(*inExpr)
+			if !ok || len(in.index) != 1 {
+				p.unexpected()
+			}
+			v, ok := in.index[0].(*varExpr)
+			if !ok {
+				p.unexpected()
+			}
+			p.next()
+			return &forInStmt{v: v, array: in.array, body: p.loopBody()}
+		}
+	}
+	p.expect(tSemicolon)
+	p.optNewlines()
+	s := &forStmt{init: init}
+	if p.tok != tSemicolon {
+		s.cond = p.expr()
+	}
+	p.expect(tSemicolon)
+	p.optNewlines()
+	if p.tok != tRparen {
+		s.post = p.simpleStmt()
+	}
+	p.expect(tRparen)
+	s.body = p.loopBody()
+	return s
+}
+
+func (p *parser) simpleStmt() stmt {
+	switch p.tok {
+	case tPrint, tPrintf:
+		return p.printStmt()
+	case tDelete:
+		p.next()
+		s := &deleteStmt{array: p.arrayName()}
+		if p.tok == tLbracket {
+			p.next()
+			s.index = p.exprList(tRbracket)
+		}
+		return s
+	case tNext:
+		p.next()
+		return &nextStmt{}
+	case tNextfile:
+		p.next()
+		return &nextfileStmt{}
+	case tExit:
+		p.next()
+		s := &exitStmt{}
+		if !p.ends() {
+			s.e = p.expr()
+		}
+		return s
+	case tReturn:
+		if !p.inFunc {
+			p.errorf("return outside function")
+		}
+		p.next()
+		s := &returnStmt{}
+		if !p.ends() {
+			s.e = p.expr()
+		}
+		return s
+	case tBreak, tContinue:
+		if p.loops == 0 {
+			p.errorf("%s outside a loop", p.text)
+		}
+		t := p.tok
+		p.next()
+		if t == tBreak {
+			return &breakStmt{}
+		}
+		return &continueStmt{}
+	}
+	return &exprStmt{p.expr()}
+}
+
+// ends reports whether the current token ends a simple statement.
+func (p *parser) ends() bool {
+	return p.tok == tNewline || p.tok == tSemicolon || p.tok == tRbrace || p.tok == tEOF
+}
+
+func (p *parser) printStmt() stmt {
+	s := &printStmt{printf: p.tok == tPrintf}
+	p.next()
+	saved := p.noGreater
+	p.noGreater = true
+	if !p.ends() && p.tok != tGreater && p.tok != tAppend && p.tok != tPipe {
+		s.args = p.exprList(tEOF)
+	}
+	if len(s.args) == 1 {
+		if g, ok := s.args[0].(*groupExpr); ok {
+			s.args = g.exprs
+		}
+	}
+	switch p.tok {
+	case tGreater, tAppend, tPipe:
+		s.redirect = p.tok
+		p.next()
+		s.dest = p.concat()
+	}
+	p.noGreater = saved
+	if s.printf && len(s.args) == 0 {
+		p.errorf("printf: no format")
+	}
+	return s
+}
+
+// exprList parses a comma separated list of expressions, ending with the
+// token unless it is tEOF.
+func (p *parser) exprList(end token) []expr {
+	var list []expr
+	for {
+		list = append(list, p.expr())
+		if p.tok != tComma {
+			break
+		}
+		p.next()
+		p.optNewlines()
+	}
+	if end != tEOF {
+		p.expect(end)
+	}
+	return list
+}
+
+// nested parses the expressions between brackets, where ">" compares.
+func (p *parser) nested(f func() []expr) []expr {
+	saved := p.noGreater
+	p.noGreater = false
+	defer func() { p.noGreater = saved }()
+	return f()
+}
+
+func isLvalue(e expr) bool {
+	switch e.(type) {
+	case *varExpr, *indexExpr, *fieldExpr:
+		return true
+	}
+	return false
+}
+
+func (p *parser) expr() expr {
+	left := p.ternary()
+	switch p.tok {
+	case tAssign, tAddAssign, tSubAssign, tMulAssign, tDivAssign, tModAssign, tPowAssign:
+		if !isLvalue(left) {
+			p.unexpected()
+		}
+		op := p.tok
+		p.next()
+		p.optNewlines()
+		return &assignExpr{left: left, op: op, right: p.expr()}
+	}
+	return left
+}
+
+func (p *parser) ternary() expr {
+	cond := p.or()
+	if p.tok != tQuestion {
+		return cond
+	}
+	p.next()
+	p.optNewlines()
+	yes := p.expr()
+	p.optNewlines()
+	p.expect(tColon)
+	p.optNewlines()
+	return &condExpr{cond: cond, yes: yes, no: p.expr()}
+}
+
+func (p *parser) or() expr {
+	left := p.and()
+	for p.tok == tOr {
+		p.next()
+		p.optNewlines()
+		left = &binaryExpr{op: tOr, left: left, right: p.and()}
+	}
+	return left
+}
+
+func (p *parser) and() expr {
+	left := p.in()
+	for p.tok == tAnd {
+		p.next()
+		p.optNewlines()
+		left = &binaryExpr{op: tAnd, left: left, right: p.in()}
+	}
+	return left
+}
+
+func (p *parser) in() expr {
+	left := p.match()
+	for p.tok == tIn {
+		p.next()
+		index := []expr{left}
+		if g, ok := left.(*groupExpr); ok {
+			index = g.exprs
+		}
+		left = &inExpr{index: index, array: p.arrayName()}
+	}
+	return left
+}
+
+func (p *parser) match() expr {
+	left := p.comparison()
+	for p.tok == tMatch || p.tok == tNotMatch {
+		not := p.tok == tNotMatch
+		p.next()
+		left = &matchExpr{left: left, re: p.comparison(), not: not}
+	}
+	return left
+}
+
+func (p *parser) comparison() expr {
+	left := p.pipeGetline()
+	switch p.tok {
+	case tGreater:
+		if p.noGreater {
+			return left
+		}
+		fallthrough
+	case tLess, tLessEqual, tGreaterEqual, tEqual, tNotEqual:
+		op := p.tok
+		p.next()
+		return &binaryExpr{op: op, left: left, right: p.pipeGetline()}
+	}
+	return left
+}
+
+// pipeGetline parses cmd | getline [var].
+func (p *parser) pipeGetline() expr {
+	left := p.concat()
+	for p.tok == tPipe && p.peek() == tGetline {
+		p.next()
+		p.next()
+		left = &getlineExpr{kind: tPipe, src: left, target: p.optLvalue()}
+	}
+	return left
+}
+
+// peek returns the token after the current one.
+func (p *parser) peek() token {
+	lex := *p.lexer
+	defer func() { *p.lexer = lex }()
+	if err := p.lexer.next(); err != nil {
+		return tEOF
+	}
+	return p.tok
+}
+
+// startsConcat reports whether the token starts an operand concatenated
+// to the previous one.
+func (p *parser) startsConcat() bool {
+	switch p.tok {
+	case tNumber, tString, tName, tFuncName, tBuiltin, tDollar, tLparen, tIncr, tDecr:
+		return true
+	}
+	return false
+}
+
+func (p *parser) concat() expr {
+	left := p.additive()
+	for p.startsConcat() {
+		left = &binaryExpr{op: tConcat, left: left, right: p.additive()}
+	}
+	return left
+}
+
+func (p *parser) additive() expr {
+	left := p.multiplicative()
+	for p.tok == tAdd || p.tok == tSub {
+		op := p.tok
+		p.next()
+		left = &binaryExpr{op: op, left: left, right: p.multiplicative()}
+	}
+	return left
+}
+
+func (p *parser) multiplicative() expr {
+	left := p.unary()
+	for p.tok == tMul || p.tok == tDiv || p.tok == tMod {
+		op := p.tok
+		p.next()
+		left = &binaryExpr{op: op, left: left, right: p.unary()}
+	}
+	return left
+}
+
+func (p *parser) unary() expr {
+	switch p.tok {
+	case tNot, tSub, tAdd:
+		op := p.tok
+		p.next()
+		return &unaryExpr{op: op, e: p.unary()}
+	}
+	return p.power()
+}
+
+func (p *parser) power() expr {
+	base := p.postfix()
+	if p.tok != tPow {
+		return base
+	}
+	p.next()
+	// the exponent may be negated and is right associative
+	switch p.tok {
+	case tNot, tSub, tAdd:
+		op := p.tok
+		p.next()
+		return &binaryExpr{op: tPow, left: base, right: &unaryExpr{op: op, e: p.power()}}
+	}
+	return &binaryExpr{op: tPow, left: base, right: p.power()}
+}
+
+func (p *parser) postfix() expr {
+	e := p.primary()
+	if (p.tok == tIncr || p.tok == tDecr) && isLvalue(e) {
+		op := p.tok
+		p.next()
+		return &incrExpr{e: e, op: op}
+	}
+	return e
+}
+
+func (p *parser) primary() expr {
+	switch p.tok {
+	case tNumber:
+		n := p.num
+		p.next()
+		return &numExpr{n}
+	case tString:
+		s := p.text
+		p.next()
+		return &strExpr{s}
+	case tDiv, tDivAssign:
+		if err := p.regex(); err != nil {
+			panic(err)
+		}
+		re := p.text
+		p.next()
+		return &regexExpr{re}
+	case tDollar:
+		p.next()
+		switch p.tok {
+		case tIncr, tDecr, tSub, tAdd, tNot:
+			op := p.tok
+			p.next()
+			e := p.primary()
+			if op == tIncr || op == tDecr {
+				if !isLvalue(e) {
+					p.unexpected()
+				}
+				return &fieldExpr{&incrExpr{e: e, op: op, pre: true}}
+			}
+			return &fieldExpr{&unaryExpr{op: op, e: e}}
+		}
+		return &fieldExpr{p.primary()}
+	case tIncr, tDecr:
+		op := p.tok
+		p.next()
+		e := p.primary()
+		if !isLvalue(e) {
+			p.unexpected()
+		}
+		return &incrExpr{e: e, op: op, pre: true}
+	case tLparen:
+		p.next()
+		exprs := p.nested(func() []expr { return p.exprList(tRparen) })
+		if len(exprs) > 1 {
+			if p.tok != tIn && !p.noGreater {
+				p.unexpected()
+			}
+			return &groupExpr{exprs}
+		}
+		return exprs[0]
+	case tName:
+		v := p.variable(p.text)
+		p.next()
+		if p.tok != tLbracket {
+			return v
+		}
+		p.next()
+		return &indexExpr{array: v, index: p.nested(func() []expr { return p.exprList(tRbracket) })}
+	case tFuncName:
+		call := &callExpr{name: p.text}
+		if _, ok := p.prog.globals[call.name]; ok {
+			p.errorf("%s is a variable, not a function", call.name)
+		}
+		p.next()
+		p.next()
+		if p.tok != tRparen {
+			call.args = p.nested(func() []expr { return p.exprList(tEOF) })
+		}
+		p.expect(tRparen)
+		p.calls = append(p.calls, call)
+		return call
+	case tBuiltin:
+		return p.builtin()
+	case tGetline:
+		p.next()
+		g := &getlineExpr{target: p.optLvalue()}
+		if p.tok == tLess {
+			p.next()
+			g.kind, g.src = tLess, p.postfix()
+		}
+		return g
+	}
+	p.unexpected()
+	return nil
+}
+
+func (p *parser) builtin() expr {
+	b := &builtinExpr{name: p.text}
+	p.next()
+	if p.tok != tLparen {
+		if b.name != "length" {
+			p.unexpected()
+		}
+		return b
+	}
+	p.next()
+	if p.tok != tRparen {
+		b.args = p.nested(func() []expr { return p.exprList(tEOF) })
+	}
+	p.expect(tRparen)
+
+	n := len(b.args)
+	check := func(min, max int) {
+		if n < min || n > max {
+			p.errorf("%d arguments to %s", n, b.name)
+		}
+	}
+	switch b.name {
+	case "atan2":
+		check(2, 2)
+	case "close":
+		check(1, 2)
+	case "cos", "exp", "int", "log", "sin", "sqrt", "system", "tolower", "toupper":
+		check(1, 1)
+	case "fflush", "length", "srand":
+		check(0, 1)
+	case "gsub", "sub":
+		check(2, 3)
+		if n == 3 && !isLvalue(b.args[2]) {
+			p.errorf("%s: the third argument is not a variable", b.name)
+		}
+	case "index":
+		check(2, 2)
+	case "match":
+		check(2, 2)
+	case "rand":
+		check(0, 0)
+	case "split":
+		check(2, 3)
+		if _, ok := b.args[1].(*varExpr); !ok {
+			p.errorf("split: the second argument is not an array")
+		}
+	case "sprintf":
+		check(1, n)
+	case "substr":
+		check(2, 3)
+	}
+	return b
+}
+
+// optLvalue parses the optional variable of getline.
+func (p *parser) optLvalue() expr {
+	switch p.tok {
+	case tName:
+		return p.primary()
+	case tDollar:
+		p.next()
+		return &fieldExpr{p.primary()}
+	}
+	return nil
+}
+
+func (p *parser) arrayName() *varExpr {
+	if p.tok != tName {
+		p.unexpected()
+	}
+	v := p.variable(p.text)
+	p.next()
+	return v
+}
+
+// variable resolves the name to a parameter of the function being
+// parsed or to a global.
+func (p *parser) variable(name string) *varExpr {
+	if i := slices.Index(p.params, name); i >= 0 {
+		return &varExpr{name: name, local: true, index: i}
+	}
+	if _, ok := p.prog.funcs[name]; ok {
+		p.errorf("function %s used as a variable", name)
+	}
+	i, ok := p.prog.globals[name]
+	if !ok {
+		i = len(p.prog.globals)
+		p.prog.globals[name] = i
+	}
+	return &varExpr{name: name, index: i}
+}
@@ -0,0 +1,167 @@
+package awk
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+type kind uint8
+
+const (
+	// kNull is the value of uninitialized variables, both "" and 0
+	kNull kind = iota
+	kNum
+	kStr
+	// kStrNum is input that looks like a number, compared as a number
+	kStrNum
+)
+
+type value struct {
+	kind kind
+	s    string
+	n    float64
+}
+
+func num(n float64) value { return value{kind: kNum, n: n} }
+func str(s string) value  { return value{kind: kStr, s: s} }
+
+func boolean(b bool) value {
+	if b {
+		return num(1)
+	}
+	return num(0)
+}
+
+// strnum returns the value of input, which is a number if it looks like
+// one.
+func strnum(s string) value {
+	if n, ok := looksNumeric(s); ok {
+		return value{kind: kStrNum, s: s, n: n}
+	}
+	return str(s)
+}
+
+// numeric reports whether the value compares as a number.
+func (v value) numeric() bool {
+	return v.kind != kStr
+}
+
+func (v value) num() float64 {
+	switch v.kind {
+	case kNum, kStrNum:
+		return v.n
+	case kStr:
+		return parseNumPrefix(v.s)
+	}
+	return 0
+}
+
+// str returns the string of the value, formatting numbers with the
+// CONVFMT or OFMT format.
+func (v value) str(format string) string {
+	switch v.kind {
+	case kStr, kStrNum:
+		return v.s
+	case kNum:
+		return formatNum(v.n, format)
+	}
+	return ""
+}
+
+func (v value) bool() bool {
+	switch v.kind {
+	case kNum, kStrNum:
+		return v.n != 0
+	case kStr:
+		return v.s != ""
+	}
+	return false
+}
+
+// formatNum formats integers as integers and other numbers with format.
+func formatNum(n float64, format string) string {
+	switch {
+	case math.IsNaN(n):
+		if math.Signbit(n) {
+			return "-nan"
+		}
+		return "nan"
+	case math.IsInf(n, 1):
+		return "inf"
+	case math.IsInf(n, -1):
+		return "-inf"
+	case n == math.Trunc(n) && math.Abs(n) < 1e16:
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return sprintf(format, []value{num(n)}, "%.6g")
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// numberLen returns the length of the number at the start of s, or 0.
+func numberLen(s string) int {
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+		digits++
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+// parseNumPrefix converts the leading number of s like strtod, being 0
+// if there is none.
+func parseNumPrefix(s string) float64 {
+	s = strings.TrimLeftFunc(s, func(r rune) bool { return r < 0x80 && isBlank(byte(r)) })
+	n := numberLen(s)
+	if n == 0 {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(s[:n], 64)
+	return f
+}
+
+// looksNumeric reports whether s is a number with optional blanks.
+func looksNumeric(s string) (float64, bool) {
+	i, j := 0, len(s)
+	for i < j && isBlank(s[i]) {
+		i++
+	}
+	for j > i && isBlank(s[j-1]) {
+		j--
+	}
+	s = s[i:j]
+	if n := numberLen(s); n == 0 || n != len(s) {
+		return 0, false
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f, true
+}
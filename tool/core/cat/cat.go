@@ -13,6 +13,7 @@ import (
 	"io/fs"
 	// "os"
 
+	"github.com/qiangli/shell/vfs"
 	"github.com/u-root/u-root/pkg/core"
 	"github.com/u-root/u-root/pkg/uroot/unixflag"
 )
@@ -24,6 +25,11 @@ type command struct {
 	core.Base
 
 	f fs.FS
+
+	// transcode text to UTF-8 from the encoding, detected if "auto"
+	encoding string
+	// render binary content as a hexdump
+	hexdump bool
 }
 
 // New creates a new cat command.
@@ -36,13 +42,35 @@ func New(f fs.FS) core.Command {
 }
 
 type flags struct {
-	u bool // ignored flag for compatibility
+	u        bool // ignored flag for compatibility
+	encoding string
+	hexdump  bool
 }
 
 var errCopy = fmt.Errorf("error concatenating stdin to stdout")
 
-// cat copies data from reader to writer.
+// cat copies data from reader to writer, transcoding text and rendering
+// binary content as a hexdump if requested.
 func (c *command) cat(reader io.Reader, writer io.Writer) error {
+	if c.encoding != "" || c.hexdump {
+		var enc *vfs.TextEncoding
+		var err error
+		if c.encoding != "" {
+			reader, enc, err = vfs.DecodeReader(reader, c.encoding)
+		} else {
+			reader, enc, err = vfs.DetectReader(reader)
+		}
+		if err != nil {
+			return err
+		}
+		if enc == nil && c.hexdump {
+			h := vfs.NewHexdumper(writer, 0)
+			if _, err := io.Copy(h, reader); err != nil {
+				return errCopy
+			}
+			return h.Close()
+		}
+	}
 	if _, err := io.Copy(writer, reader); err != nil {
 		return errCopy
 	}
@@ -92,9 +120,11 @@ func (c *command) RunContext(ctx context.Context, args ...string) error {
 	fs.SetOutput(c.Stderr)
 
 	fs.BoolVar(&f.u, "u", false, "ignored")
+	fs.StringVar(&f.encoding, "encoding", "", "transcode text from `NAME` to UTF-8, detect the encoding if auto")
+	fs.BoolVar(&f.hexdump, "hexdump", false, "print binary files as a hexdump")
 
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage: cat [-u] [FILES]...\n\n")
+		fmt.Fprintf(fs.Output(), "Usage: cat [-u] [--encoding=NAME] [--hexdump] [FILES]...\n\n")
 		fmt.Fprintf(fs.Output(), "cat concatenates files and prints them to stdout.\n")
 		fmt.Fprintf(fs.Output(), "If no files are specified, read from stdin.\n\n")
 		fmt.Fprintf(fs.Output(), "Options:\n")
@@ -105,6 +135,14 @@ func (c *command) RunContext(ctx context.Context, args ...string) error {
 		return err
 	}
 
+	if f.encoding != "" && f.encoding != "auto" {
+		if _, err := vfs.LookupEncoding(f.encoding); err != nil {
+			return err
+		}
+	}
+	c.encoding = f.encoding
+	c.hexdump = f.hexdump
+
 	if err := c.runCat(fs.Args()); err != nil {
 		return err
 	}
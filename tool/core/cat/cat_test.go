@@ -233,3 +233,66 @@ func TestCatDash(t *testing.T) {
 // 		t.Errorf("Want: %q Got: %q", testContent, stdout.String())
 // 	}
 // }
+
+func TestCatEncoding(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name     string
+		data     []byte
+		encoding string
+		want     string
+	}{
+		{"utf8bom", []byte("\xef\xbb\xbfhello\n"), "auto", "hello\n"},
+		{"utf16le", []byte("\xff\xfeh\x00i\x00\n\x00"), "auto", "hi\n"},
+		{"latin1", []byte("caf\xe9\n"), "auto", "café\n"},
+		{"sjis", []byte("\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd\n"), "shift_jis", "こんにちは\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(f, tt.data, 0o666); err != nil {
+				t.Fatal(err)
+			}
+			cmd := New(NewLocalFS())
+			var stdout, stderr bytes.Buffer
+			cmd.SetIO(&bytes.Buffer{}, &stdout, &stderr)
+			if err := cmd.Run("--encoding="+tt.encoding, f); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("got %q, want %q", stdout.String(), tt.want)
+			}
+		})
+	}
+
+	cmd := New(NewLocalFS())
+	cmd.SetIO(&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+	if err := cmd.Run("--encoding=nope", filepath.Join(dir, "latin1")); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+}
+
+func TestCatHexdump(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if err := os.WriteFile(bin, []byte("\x00\x01ABCDEFGHIJKLMNOPQ"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	text := filepath.Join(dir, "text")
+	if err := os.WriteFile(text, []byte("plain\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := New(NewLocalFS())
+	var stdout, stderr bytes.Buffer
+	cmd.SetIO(&bytes.Buffer{}, &stdout, &stderr)
+	if err := cmd.Run("--hexdump", text, bin); err != nil {
+		t.Fatal(err)
+	}
+	want := "plain\n" +
+		"00000000  00 01 41 42 43 44 45 46  47 48 49 4a 4b 4c 4d 4e  |..ABCDEFGHIJKLMN|\n" +
+		"00000010  4f 50 51                                          |OPQ|\n" +
+		"00000013\n"
+	if stdout.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", stdout.String(), want)
+	}
+}
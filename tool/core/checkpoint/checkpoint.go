@@ -0,0 +1,130 @@
+// Checkpoint saves and restores the state of workspace files.
+//
+// Synopsis:
+//
+//	checkpoint [create]
+//	checkpoint list
+//	checkpoint rollback ID
+//	checkpoint diff [ID]
+//
+// Description:
+//
+//	create:   start a new checkpoint and print its id
+//	list:     list checkpoints and the files modified in each
+//	rollback: restore all files modified since checkpoint ID
+//	diff:     show the changes since checkpoint ID (default: latest)
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/u-root/u-root/pkg/core"
+	"github.com/u-root/u-root/pkg/uroot/unixflag"
+
+	"github.com/qiangli/shell/vfs"
+)
+
+var errUsage = errors.New("usage: checkpoint [create|list|rollback ID|diff [ID]]")
+
+// command implements the checkpoint builtin.
+type command struct {
+	core.Base
+
+	cp vfs.Checkpointer
+}
+
+// New creates a new checkpoint command.
+func New(cp vfs.Checkpointer) core.Command {
+	c := &command{
+		cp: cp,
+	}
+	c.Init()
+	return c
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	fs := flag.NewFlagSet("checkpoint", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "checkpoint [create|list|rollback ID|diff [ID]]\n\n")
+		fmt.Fprintf(fs.Output(), "Checkpoint saves and restores the state of workspace files.\n")
+		fmt.Fprintf(fs.Output(), "Files are saved before their first modification after a checkpoint.\n")
+	}
+
+	if err := fs.Parse(unixflag.ArgsToGoArgs(args)); err != nil {
+		return err
+	}
+
+	args = fs.Args()
+	if len(args) == 0 {
+		args = []string{"create"}
+	}
+
+	switch args[0] {
+	case "create":
+		id, err := c.cp.Checkpoint()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.Stdout, id)
+	case "list":
+		list, err := c.cp.ListCheckpoints()
+		if err != nil {
+			return err
+		}
+		for _, cp := range list {
+			fmt.Fprintf(c.Stdout, "%s\t%s\t%d files\n", cp.ID, cp.Created.Format(time.RFC3339), len(cp.Files))
+			for _, f := range cp.Files {
+				fmt.Fprintf(c.Stdout, "\t%s\n", f)
+			}
+		}
+	case "rollback":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return c.cp.Rollback(args[1])
+	case "diff":
+		id, err := c.resolve(args[1:])
+		if err != nil {
+			return err
+		}
+		diff, err := c.cp.DiffCheckpoint(id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(c.Stdout, diff)
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+// resolve returns the checkpoint id in args or the latest one.
+func (c *command) resolve(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		list, err := c.cp.ListCheckpoints()
+		if err != nil {
+			return "", err
+		}
+		if len(list) == 0 {
+			return "", fmt.Errorf("checkpoint: no checkpoints")
+		}
+		return list[len(list)-1].ID, nil
+	case 1:
+		return args[0], nil
+	default:
+		return "", errUsage
+	}
+}
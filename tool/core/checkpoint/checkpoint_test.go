@@ -0,0 +1,101 @@
+package checkpoint
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/vfs"
+)
+
+func setup(t *testing.T) (string, *vfs.CheckpointWorkspace) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := vfs.NewCheckpointWorkspace(ws, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, cp
+}
+
+func runCheckpoint(cp vfs.Checkpointer, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := New(cp)
+	cmd.SetIO(strings.NewReader(""), &stdout, &stderr)
+	err := cmd.Run(args...)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, cp := setup(t)
+	a := filepath.Join(dir, "a.txt")
+
+	if _, _, err := runCheckpoint(cp, "diff"); err == nil || !strings.Contains(err.Error(), "no checkpoints") {
+		t.Errorf("diff without checkpoints: %v", err)
+	}
+	for _, want := range []string{"1\n", "2\n"} {
+		args := []string{"create"}
+		if want == "1\n" {
+			// create is the default
+			args = nil
+		}
+		if stdout, _, err := runCheckpoint(cp, args...); err != nil || stdout != want {
+			t.Fatalf("create = %q, %v, want %q", stdout, err, want)
+		}
+	}
+	if err := cp.WriteFile(a, []byte("two\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, err := runCheckpoint(cp, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`(?m)^1\t\S+\t0 files\n2\t\S+\t1 files\n\t` + regexp.QuoteMeta(a) + `\n$`)
+	if !re.MatchString(stdout) {
+		t.Errorf("list = %q", stdout)
+	}
+
+	want := "--- " + a + "\n+++ " + a + "\n@@ -1 +1 @@\n-one\n+two\n"
+	for _, args := range [][]string{{"diff"}, {"diff", "1"}, {"diff", "2"}} {
+		if stdout, _, err := runCheckpoint(cp, args...); err != nil || stdout != want {
+			t.Errorf("%v = %q, %v, want %q", args, stdout, err, want)
+		}
+	}
+
+	if _, _, err := runCheckpoint(cp, "rollback", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(a); string(data) != "one\n" {
+		t.Errorf("a.txt = %q after rollback", data)
+	}
+	if stdout, _, err := runCheckpoint(cp, "diff"); err != nil || stdout != "" {
+		t.Errorf("diff after rollback = %q, %v", stdout, err)
+	}
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	_, cp := setup(t)
+	for _, args := range [][]string{
+		{"rollback"},
+		{"rollback", "1", "2"},
+		{"rollback", "9"},
+		{"diff", "9"},
+		{"diff", "1", "2"},
+		{"undo"},
+	} {
+		if _, _, err := runCheckpoint(cp, args...); err == nil {
+			t.Errorf("%v succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Column formats its input into columns.
+//
+// Synopsis:
+//
+//	column [OPTION]... [FILE]...
+//
+// Description:
+//
+//	Column fills the width of the output with the non-empty lines of the
+//	files, or of stdin, in columns down and then across, or across and
+//	then down with -x. Columns are padded with TABs to a multiple of 8.
+//	The width is -c, or $COLUMNS, or 80.
+//
+//	With -t the lines are split into cells at the separators and written
+//	as a table of left justified columns. Runs of separators count as one.
+//	COLUMNS of -R is a comma separated list of column numbers, from 1, or
+//	of names given by -N.
+//
+// Options:
+//
+//	-c, --output-width WIDTH:     fill WIDTH columns
+//	-N, --table-columns NAMES:    write a header line of the comma separated NAMES
+//	-o, --output-separator STRING: separate table columns with STRING (default: two spaces)
+//	-R, --table-right COLUMNS:    right justify the COLUMNS
+//	-s, --separator CHARS:        split table cells at any of CHARS (default: blanks)
+//	-t, --table:                  write a table
+//	-x, --fillrows:               fill rows before columns
+package column
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the column core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new column command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	width     int
+	names     string
+	outputSep string
+	right     string
+	separator string
+	table     bool
+	fillRows  bool
+}
+
+const tabWidth = 8
+
+// width returns the columns taken by s.
+func width(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("column", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.IntVar(&f.width, "c", 0, "fill `WIDTH` columns")
+	fs.IntVar(&f.width, "output-width", 0, "fill `WIDTH` columns")
+	fs.StringVar(&f.names, "N", "", "write a header line of the comma separated `NAMES`")
+	fs.StringVar(&f.names, "table-columns", "", "write a header line of the comma separated `NAMES`")
+	fs.StringVar(&f.outputSep, "o", "  ", "separate table columns with `STRING`")
+	fs.StringVar(&f.outputSep, "output-separator", "  ", "separate table columns with `STRING`")
+	fs.StringVar(&f.right, "R", "", "right justify the `COLUMNS`")
+	fs.StringVar(&f.right, "table-right", "", "right justify the `COLUMNS`")
+	fs.StringVar(&f.separator, "s", "", "split table cells at any of `CHARS`")
+	fs.StringVar(&f.separator, "separator", "", "split table cells at any of `CHARS`")
+	fs.BoolVar(&f.table, "t", false, "write a table")
+	fs.BoolVar(&f.table, "table", false, "write a table")
+	fs.BoolVar(&f.fillRows, "x", false, "fill rows before columns")
+	fs.BoolVar(&f.fillRows, "fillrows", false, "fill rows before columns")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "column [OPTION]... [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Column formats its input into columns.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	valued := []string{
+		"c", "output-width", "N", "table-columns", "o", "output-separator",
+		"R", "table-right", "s", "separator",
+	}
+	if err := fs.Parse(cli.Args(args, valued...)); err != nil {
+		return cli.Exit(1, err)
+	}
+
+	termWidth := f.width
+	if termWidth <= 0 {
+		termWidth = 80
+		if n, err := strconv.Atoi(c.Getenv("COLUMNS")); err == nil && n > 0 {
+			termWidth = n
+		}
+	}
+
+	var lines []string
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	failed := false
+	for _, name := range names {
+		r, err := cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "column: %v\n", err)
+			failed = true
+			continue
+		}
+		lines, err = readLines(ctx, r, lines)
+		r.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "column: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+
+	w := bufio.NewWriter(c.Stdout)
+	if f.table {
+		t := &table{outputSep: f.outputSep}
+		if f.names != "" {
+			t.header = strings.Split(f.names, ",")
+		}
+		if err := t.setRight(f.right); err != nil {
+			return cli.Exit(1, err)
+		}
+		for _, line := range lines {
+			t.rows = append(t.rows, split(line, f.separator))
+		}
+		t.write(w)
+	} else if f.fillRows {
+		fillRows(w, lines, termWidth)
+	} else {
+		fillColumns(w, lines, termWidth)
+	}
+	if err := w.Flush(); err != nil {
+		return cli.Exit(1, err)
+	}
+	if failed {
+		return cli.Exit(1, nil)
+	}
+	return nil
+}
+
+// readLines appends the non-empty lines of r.
+func readLines(ctx context.Context, r io.Reader, lines []string) ([]string, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<30)
+	for s.Scan() {
+		if err := ctx.Err(); err != nil {
+			return lines, err
+		}
+		if line := strings.TrimRightFunc(s.Text(), unicode.IsSpace); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, s.Err()
+}
+
+// split returns the cells of the line, split at runs of the separators.
+func split(line, separators string) []string {
+	if separators == "" {
+		return strings.Fields(line)
+	}
+	return strings.FieldsFunc(line, func(r rune) bool { return strings.ContainsRune(separators, r) })
+}
+
+// maxLength returns the width of the widest line, rounded up to the next
+// tab stop.
+func maxLength(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		n = max(n, width(line))
+	}
+	return (n + tabWidth) &^ (tabWidth - 1)
+}
+
+// pad writes the TABs from the column to the last tab stop not past end
+// and returns the new column.
+func pad(w *bufio.Writer, column, end int) int {
+	for {
+		next := (column + tabWidth) &^ (tabWidth - 1)
+		if next > end {
+			return column
+		}
+		w.WriteByte('\t')
+		column = next
+	}
+}
+
+// fillColumns writes the lines down the columns first.
+func fillColumns(w *bufio.Writer, lines []string, termWidth int) {
+	if len(lines) == 0 {
+		return
+	}
+	maxLen := maxLength(lines)
+	cols := max(termWidth/maxLen, 1)
+	rows := (len(lines) + cols - 1) / cols
+	for row := 0; row < rows; row++ {
+		column, end := 0, maxLen
+		for i := row; ; {
+			w.WriteString(lines[i])
+			column += width(lines[i])
+			if i += rows; i >= len(lines) {
+				break
+			}
+			column = pad(w, column, end)
+			end += maxLen
+		}
+		w.WriteByte('\n')
+	}
+}
+
+// fillRows writes the lines across the rows first.
+func fillRows(w *bufio.Writer, lines []string, termWidth int) {
+	if len(lines) == 0 {
+		return
+	}
+	maxLen := maxLength(lines)
+	cols := max(termWidth/maxLen, 1)
+	column := 0
+	for i, line := range lines {
+		w.WriteString(line)
+		column += width(line)
+		if (i+1)%cols == 0 || i == len(lines)-1 {
+			w.WriteByte('\n')
+			column = 0
+			continue
+		}
+		column = pad(w, column, (i%cols+1)*maxLen)
+	}
+}
+
+// table is written with -t.
+type table struct {
+	header    []string
+	rows      [][]string
+	outputSep string
+	rightCols map[int]bool
+}
+
+// setRight parses the -R list of column numbers or names.
+func (t *table) setRight(list string) error {
+	t.rightCols = map[int]bool{}
+	if list == "" {
+		return nil
+	}
+	for _, s := range strings.Split(list, ",") {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			t.rightCols[n-1] = true
+			continue
+		}
+		found := false
+		for i, name := range t.header {
+			if name == s {
+				t.rightCols[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("undefined column name '%s'", s)
+		}
+	}
+	return nil
+}
+
+func (t *table) write(w *bufio.Writer) {
+	rows := t.rows
+	if t.header != nil {
+		rows = append([][]string{t.header}, rows...)
+	}
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], width(cell))
+		}
+	}
+	for _, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				b.WriteString(t.outputSep)
+			}
+			fill := strings.Repeat(" ", widths[i]-width(cell))
+			switch {
+			case t.rightCols[i]:
+				b.WriteString(fill)
+				b.WriteString(cell)
+			case i < len(row)-1:
+				b.WriteString(cell)
+				b.WriteString(fill)
+			default:
+				// the last cell is not padded
+				b.WriteString(cell)
+			}
+		}
+		w.WriteString(b.String())
+		w.WriteByte('\n')
+	}
+}
@@ -0,0 +1,11 @@
+package column
+
+import (
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestColumn(t *testing.T) {
+	golden.Run(t, "column", New)
+}
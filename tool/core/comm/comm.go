@@ -0,0 +1,268 @@
+// Comm compares two sorted files line by line.
+//
+// Synopsis:
+//
+//	comm [OPTION]... FILE1 FILE2
+//
+// Description:
+//
+//	Comm writes three columns: the lines only in FILE1, the lines only in
+//	FILE2 and the lines in both. Columns are indented by TABs, or by the
+//	output delimiter. A FILE of "-" is stdin.
+//
+//	Unless --nocheck-order is given, the first line out of order in each
+//	file is reported and the exit status is 1; with --check-order comm
+//	stops there.
+//
+// Options:
+//
+//	-1:                          suppress the lines only in FILE1
+//	-2:                          suppress the lines only in FILE2
+//	-3:                          suppress the lines in both files
+//	--check-order:               fail at the first line out of order
+//	--nocheck-order:             do not check that the input is sorted
+//	--output-delimiter STRING:   separate columns with STRING
+//	--total:                     write a summary line
+//	-z, --zero-terminated:       lines end with NUL, not newline
+package comm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the comm core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new comm command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	suppress1    bool
+	suppress2    bool
+	suppress3    bool
+	checkOrder   bool
+	nocheckOrder bool
+	delimiter    *string
+	total        bool
+	zero         bool
+}
+
+// valueFlag is a string flag that records whether it was given.
+type valueFlag struct {
+	value **string
+}
+
+func (v valueFlag) String() string {
+	if v.value == nil || *v.value == nil {
+		return ""
+	}
+	return **v.value
+}
+
+func (v valueFlag) Set(s string) error {
+	*v.value = &s
+	return nil
+}
+
+var errDisorder = errors.New("input is not in sorted order")
+
+// input is a file being compared.
+type input struct {
+	n    int
+	r    *bufio.Reader
+	eol  byte
+	line string
+	prev string
+	ok   bool
+	read bool
+	// warned is set once the disorder of the file is reported
+	warned bool
+}
+
+// next reads the next line without its terminator.
+func (in *input) next() error {
+	in.prev, in.read = in.line, in.read || in.ok
+	line, err := in.r.ReadString(in.eol)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	in.ok = line != ""
+	in.line = strings.TrimSuffix(line, string(in.eol))
+	return nil
+}
+
+// disordered reports whether the current line sorts before the previous
+// one and was not reported yet.
+func (in *input) disordered() bool {
+	if !in.ok || !in.read || in.warned || in.prev <= in.line {
+		return false
+	}
+	in.warned = true
+	return true
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("comm", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.BoolVar(&f.suppress1, "1", false, "suppress the lines only in FILE1")
+	fs.BoolVar(&f.suppress2, "2", false, "suppress the lines only in FILE2")
+	fs.BoolVar(&f.suppress3, "3", false, "suppress the lines in both files")
+	fs.BoolVar(&f.checkOrder, "check-order", false, "fail at the first line out of order")
+	fs.BoolVar(&f.nocheckOrder, "nocheck-order", false, "do not check that the input is sorted")
+	fs.Var(valueFlag{&f.delimiter}, "output-delimiter", "separate columns with `STRING`")
+	fs.BoolVar(&f.total, "total", false, "write a summary line")
+	fs.BoolVar(&f.zero, "z", false, "lines end with NUL, not newline")
+	fs.BoolVar(&f.zero, "zero-terminated", false, "lines end with NUL, not newline")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "comm [OPTION]... FILE1 FILE2\n\n")
+		fmt.Fprintf(fs.Output(), "Comm compares two sorted files line by line.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(cli.Args(args, "output-delimiter")); err != nil {
+		return cli.Exit(1, err)
+	}
+	names := fs.Args()
+	switch len(names) {
+	case 0:
+		return cli.Exit(1, errors.New("missing operand"))
+	case 1:
+		return cli.Exit(1, fmt.Errorf("missing operand after '%s'", names[0]))
+	case 2:
+	default:
+		return cli.Exit(1, fmt.Errorf("extra operand '%s'", names[2]))
+	}
+
+	delimiter := "\t"
+	if f.delimiter != nil {
+		delimiter = *f.delimiter
+		if delimiter == "" {
+			delimiter = "\x00"
+		}
+	}
+	eol := byte('\n')
+	if f.zero {
+		eol = 0
+	}
+
+	var inputs [2]*input
+	for i, name := range names {
+		r, err := cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+		if err != nil {
+			return cli.Exit(1, err)
+		}
+		defer r.Close()
+		inputs[i] = &input{n: i + 1, r: bufio.NewReader(r), eol: eol}
+	}
+
+	w := bufio.NewWriter(c.Stdout)
+	defer w.Flush()
+	show := [3]bool{!f.suppress1, !f.suppress2, !f.suppress3}
+	var counts [3]int
+	write := func(column int, line string) {
+		counts[column]++
+		if !show[column] {
+			return
+		}
+		for i := 0; i < column; i++ {
+			if show[i] {
+				w.WriteString(delimiter)
+			}
+		}
+		w.WriteString(line)
+		w.WriteByte(eol)
+	}
+
+	disorder := false
+	// advance reads the next line of the inputs, checking their order
+	advance := func(ins ...*input) error {
+		for _, in := range ins {
+			if err := in.next(); err != nil {
+				return fmt.Errorf("%s: %w", names[in.n-1], err)
+			}
+			if f.nocheckOrder || !in.disordered() {
+				continue
+			}
+			w.Flush()
+			fmt.Fprintf(c.Stderr, "comm: file %d is not in sorted order\n", in.n)
+			if f.checkOrder {
+				return errDisorder
+			}
+			disorder = true
+		}
+		return nil
+	}
+
+	in1, in2 := inputs[0], inputs[1]
+	err := advance(in1, in2)
+	for err == nil && (in1.ok || in2.ok) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch {
+		case !in2.ok || in1.ok && in1.line < in2.line:
+			write(0, in1.line)
+			err = advance(in1)
+		case !in1.ok || in2.line < in1.line:
+			write(1, in2.line)
+			err = advance(in2)
+		default:
+			write(2, in1.line)
+			err = advance(in1, in2)
+		}
+	}
+	if errors.Is(err, errDisorder) {
+		// already reported
+		return cli.Exit(1, nil)
+	}
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+
+	if f.total {
+		for _, n := range counts {
+			fmt.Fprintf(w, "%d%s", n, delimiter)
+		}
+		w.WriteString("total")
+		w.WriteByte(eol)
+	}
+	if err := w.Flush(); err != nil {
+		return cli.Exit(1, err)
+	}
+	if disorder {
+		return cli.Exit(1, errDisorder)
+	}
+	return nil
+}
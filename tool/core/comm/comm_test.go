@@ -0,0 +1,26 @@
+package comm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestComm(t *testing.T) {
+	golden.Run(t, "comm", New)
+}
+
+func TestCommZeroTerminated(t *testing.T) {
+	var stdout bytes.Buffer
+	cmd := New(nil)
+	cmd.SetIO(strings.NewReader("a\x00b\x00"), &stdout, &stdout)
+	if err := cmd.Run("-z", "--output-delimiter=", "--total", "-", "-"); err != nil {
+		t.Fatal(err)
+	}
+	// stdin is read by the first operand, the second one is then empty
+	if got, want := stdout.String(), "a\x00b\x002\x000\x000\x00total\x00"; got != want {
+		t.Errorf("comm -z: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,870 @@
+// Curl transfers data from or to HTTP servers.
+//
+// Synopsis:
+//
+//	curl [OPTION]... URL...
+//
+// Description:
+//
+//	Curl requests each URL, http:// being assumed without a scheme, and
+//	writes the response body to stdout, or to the files of -o and -O
+//	which are taken in order for the URLs. Files, for the output and for
+//	the @FILE of the data options, are read and written through the
+//	workspace; a download is written once it is complete. Requests follow
+//	the network policy of the shell: the allow-list of hosts, checked for
+//	redirects too, the cap on the size of responses and the timeout.
+//
+//	The data of -d, --data-raw, --data-binary and --data-urlencode is
+//	joined with '&' and sent with POST as a form, or appended to the query
+//	with -G. With -d and --data-binary @FILE reads the data from FILE,
+//	"-" being stdin; -d drops its newlines. -F sends a multipart form of
+//	NAME=VALUE, NAME=@FILE to upload FILE, or NAME=<FILE for the content
+//	of FILE, with ";type=TYPE" to set the type of a file.
+//
+//	The exit status is that of curl: 3 for a malformed URL, 6 if the host
+//	can not be resolved, 7 if the connection fails, 9 if the host is not
+//	allowed, 22 for an HTTP error with -f, 23 if the output can not be
+//	written, 26 if a data file can not be read, 28 on timeout, 47 for too
+//	many redirects and 63 if the response is too large.
+//
+// Options:
+//
+//	-X, --request METHOD:     use METHOD instead of GET, or POST with data
+//	-H, --header LINE:        add the header "Name: value", "Name:" removes it
+//	-d, --data DATA:          send DATA as a form
+//	    --data-raw DATA:      like -d without @FILE
+//	    --data-binary DATA:   like -d keeping the newlines of @FILE
+//	    --data-urlencode DATA: like -d with the content, or NAME=content, URL encoded
+//	    --json DATA:          send DATA as JSON, accepting JSON
+//	-F, --form NAME=CONTENT:  send a multipart form field
+//	-G, --get:                append the data to the query of a GET request
+//	-I, --head:               send a HEAD request and write the headers
+//	-i, --include:            write the status line and the headers before the body
+//	-o, --output FILE:        write the body to FILE, "-" for stdout
+//	-O, --remote-name:        write the body to the file named as in the URL
+//	-L, --location:           follow redirects
+//	    --max-redirs NUM:     follow at most NUM redirects (default: 50)
+//	-f, --fail:               fail without output on HTTP errors
+//	-s, --silent:             do not report errors
+//	-S, --show-error:         report errors even with -s
+//	-w, --write-out FORMAT:   write FORMAT after the transfer, with %{variable}
+//	-m, --max-time SECONDS:   give up on the transfer after SECONDS
+//	    --connect-timeout SECONDS: give up on connecting after SECONDS
+//	    --max-filesize BYTES: fail on responses larger than BYTES
+//	-A, --user-agent NAME:    send NAME as the User-Agent
+//	-e, --referer URL:        send URL as the Referer
+//	-u, --user USER:PASSWORD: send the credentials with basic authentication
+//	-k, --insecure:           do not verify the certificates of servers
+//
+// The variables of -w are http_code, response_code, url_effective,
+// content_type, size_download, size_header, time_total, num_redirects,
+// redirect_url, method, scheme, exitcode, errormsg and header{NAME}, while
+// %{stdout} and %{stderr} switch the output.
+package curl
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+	"github.com/qiangli/shell/vnet"
+)
+
+// The exit statuses of curl.
+const (
+	exitUnsupported = 1
+	exitUsage       = 2
+	exitMalformed   = 3
+	exitResolve     = 6
+	exitConnect     = 7
+	exitDenied      = 9
+	exitHTTP        = 22
+	exitWrite       = 23
+	exitRead        = 26
+	exitTimeout     = 28
+	exitRedirects   = 47
+	exitReceive     = 56
+	exitSSL         = 60
+	exitFileSize    = 63
+)
+
+// command implements the curl core utility.
+type command struct {
+	core.Base
+
+	ws     vfs.Workspace
+	policy *vnet.Policy
+}
+
+// New creates a new curl command reading and writing files in ws, with
+// the requests restricted by policy.
+func New(ws vfs.Workspace, policy *vnet.Policy) core.Command {
+	c := &command{
+		ws:     ws,
+		policy: policy,
+	}
+	c.Init()
+	return c
+}
+
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+// data is an argument of the data options.
+type data struct {
+	kind  string
+	value string
+}
+
+type dataFlag struct {
+	list *[]data
+	kind string
+}
+
+func (d dataFlag) String() string     { return "" }
+func (d dataFlag) Set(s string) error { *d.list = append(*d.list, data{d.kind, s}); return nil }
+
+// output is the file of -o, or the remote name of -O.
+type output struct {
+	name   string
+	remote bool
+}
+
+type outputFlag struct {
+	list   *[]output
+	remote bool
+}
+
+func (o outputFlag) String() string   { return "" }
+func (o outputFlag) IsBoolFlag() bool { return o.remote }
+func (o outputFlag) Set(s string) error {
+	if o.remote {
+		if s != "false" {
+			*o.list = append(*o.list, output{remote: true})
+		}
+		return nil
+	}
+	*o.list = append(*o.list, output{name: s})
+	return nil
+}
+
+type flags struct {
+	method     string
+	headers    listFlag
+	data       []data
+	json       listFlag
+	forms      listFlag
+	get        bool
+	head       bool
+	include    bool
+	outputs    []output
+	location   bool
+	maxRedirs  int
+	fail       bool
+	silent     bool
+	showError  bool
+	writeOut   string
+	maxTime    float64
+	connect    float64
+	maxSize    int64
+	userAgent  string
+	referer    string
+	user       string
+	insecure   bool
+	stdinCache []byte
+}
+
+// curlError is a failed transfer with the exit status of curl.
+type curlError struct {
+	code int
+	msg  string
+}
+
+func (e *curlError) Error() string {
+	return fmt.Sprintf("(%d) %s", e.code, e.msg)
+}
+
+func fail(code int, format string, a ...any) error {
+	return &curlError{code, fmt.Sprintf(format, a...)}
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("curl", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	boolVar := func(p *bool, short, long, usage string) {
+		if short != "" {
+			fs.BoolVar(p, short, false, usage)
+		}
+		fs.BoolVar(p, long, false, usage)
+	}
+	stringVar := func(p *string, short, long, usage string) {
+		if short != "" {
+			fs.StringVar(p, short, "", usage)
+		}
+		fs.StringVar(p, long, "", usage)
+	}
+	listVar := func(v flag.Value, short, long, usage string) {
+		if short != "" {
+			fs.Var(v, short, usage)
+		}
+		fs.Var(v, long, usage)
+	}
+
+	stringVar(&f.method, "X", "request", "use `METHOD` instead of GET, or POST with data")
+	listVar(&f.headers, "H", "header", "add the header `LINE`, \"Name: value\"")
+	listVar(dataFlag{&f.data, "data"}, "d", "data", "send `DATA` as a form, @FILE to read it")
+	listVar(dataFlag{&f.data, "raw"}, "", "data-raw", "send `DATA` as -d does, without @FILE")
+	listVar(dataFlag{&f.data, "binary"}, "", "data-binary", "send `DATA` as -d does, keeping the newlines of @FILE")
+	listVar(dataFlag{&f.data, "urlencode"}, "", "data-urlencode", "send `DATA` as -d does, URL encoding the content")
+	listVar(&f.json, "", "json", "send `DATA` as JSON")
+	listVar(&f.forms, "F", "form", "send the multipart form field `NAME=CONTENT`")
+	boolVar(&f.get, "G", "get", "append the data to the query of a GET request")
+	boolVar(&f.head, "I", "head", "send a HEAD request and write the headers")
+	boolVar(&f.include, "i", "include", "write the status line and the headers before the body")
+	listVar(outputFlag{&f.outputs, false}, "o", "output", "write the body to `FILE`, \"-\" for stdout")
+	listVar(outputFlag{&f.outputs, true}, "O", "remote-name", "write the body to the file named as in the URL")
+	boolVar(&f.location, "L", "location", "follow redirects")
+	fs.IntVar(&f.maxRedirs, "max-redirs", 50, "follow at most `NUM` redirects")
+	boolVar(&f.fail, "f", "fail", "fail without output on HTTP errors")
+	boolVar(&f.silent, "s", "silent", "do not report errors")
+	boolVar(&f.showError, "S", "show-error", "report errors even with -s")
+	stringVar(&f.writeOut, "w", "write-out", "write `FORMAT` after the transfer")
+	fs.Float64Var(&f.maxTime, "m", 0, "give up on the transfer after `SECONDS`")
+	fs.Float64Var(&f.maxTime, "max-time", 0, "give up on the transfer after `SECONDS`")
+	fs.Float64Var(&f.connect, "connect-timeout", 0, "give up on connecting after `SECONDS`")
+	fs.Int64Var(&f.maxSize, "max-filesize", 0, "fail on responses larger than `BYTES`")
+	stringVar(&f.userAgent, "A", "user-agent", "send `NAME` as the User-Agent")
+	stringVar(&f.referer, "e", "referer", "send `URL` as the Referer")
+	stringVar(&f.user, "u", "user", "send `USER:PASSWORD` with basic authentication")
+	boolVar(&f.insecure, "k", "insecure", "do not verify the certificates of servers")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "curl [OPTION]... URL...\n\n")
+		fmt.Fprintf(fs.Output(), "Curl transfers data from or to HTTP servers.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	valued := []string{
+		"X", "request", "H", "header", "d", "data", "data-raw", "data-binary", "data-urlencode", "json",
+		"F", "form", "o", "output", "max-redirs", "w", "write-out", "m", "max-time", "connect-timeout",
+		"max-filesize", "A", "user-agent", "e", "referer", "u", "user",
+	}
+	if err := fs.Parse(cli.Args(args, valued...)); err != nil {
+		return cli.Exit(exitUsage, err)
+	}
+	if fs.NArg() == 0 {
+		return cli.Exit(exitUsage, errors.New("no URL specified"))
+	}
+	if len(f.forms) > 0 && (len(f.data) > 0 || len(f.json) > 0 || f.head) {
+		return cli.Exit(exitUsage, errors.New("you can only select one HTTP request method"))
+	}
+
+	client := c.client(&f)
+	status := 0
+	for i, rawURL := range fs.Args() {
+		var out *output
+		if i < len(f.outputs) {
+			out = &f.outputs[i]
+		}
+		if err := c.transfer(ctx, client, &f, rawURL, out); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var ce *curlError
+			if !errors.As(err, &ce) {
+				return err
+			}
+			if !f.silent || f.showError {
+				fmt.Fprintf(c.Stderr, "curl: %v\n", ce)
+			}
+			status = ce.code
+		}
+	}
+	if status != 0 {
+		return cli.Exit(status, nil)
+	}
+	return nil
+}
+
+// client returns the HTTP client of the options and the policy.
+func (c *command) client(f *flags) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if f.connect > 0 {
+		dialer := &net.Dialer{Timeout: seconds(f.connect), KeepAlive: 30 * time.Second}
+		t.DialContext = dialer.DialContext
+		t.TLSHandshakeTimeout = seconds(f.connect)
+	}
+	if f.insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{
+		Transport: c.policy.Transport(t),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !f.location {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > f.maxRedirs {
+				return fail(exitRedirects, "Maximum (%d) redirects followed", f.maxRedirs)
+			}
+			return nil
+		},
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// transfer requests the URL and writes the response to the output.
+func (c *command) transfer(ctx context.Context, client *http.Client, f *flags, rawURL string, out *output) error {
+	start := time.Now()
+	timeout := seconds(f.maxTime)
+	if c.policy != nil && c.policy.Timeout > 0 && (timeout == 0 || c.policy.Timeout < timeout) {
+		timeout = c.policy.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := c.request(ctx, f, rawURL)
+	if err != nil {
+		return err
+	}
+	name := "-"
+	if out != nil && out.remote {
+		name = path.Base(req.URL.Path)
+		if name == "." || name == "/" || strings.HasSuffix(req.URL.Path, "/") {
+			return fail(exitWrite, "Remote file name has no length")
+		}
+	} else if out != nil {
+		name = out.name
+	}
+
+	w := &writeOut{start: start, method: req.Method, url: req.URL}
+	resp, err := client.Do(req)
+	if err != nil {
+		err = c.cause(err, req.URL, timeout)
+		w.err = err
+		c.writeOut(f, w)
+		return err
+	}
+	defer resp.Body.Close()
+	w.resp = resp
+	w.redirects = redirects(resp)
+
+	if f.fail && resp.StatusCode >= 400 {
+		err := fail(exitHTTP, "The requested URL returned error: %d", resp.StatusCode)
+		w.err = err
+		c.writeOut(f, w)
+		return err
+	}
+	if f.maxSize > 0 && resp.ContentLength > f.maxSize {
+		err := fail(exitFileSize, "Maximum file size exceeded")
+		w.err = err
+		c.writeOut(f, w)
+		return err
+	}
+
+	// the download replaces the file once complete
+	var file *cli.File
+	defer func() {
+		if file != nil {
+			file.Abort()
+		}
+	}()
+	dst := &writer{w: c.Stdout}
+	if name != "-" {
+		file, err = cli.CreateFile(c.ws, c.ResolvePath(name))
+		if err != nil {
+			err = fail(exitWrite, "Failed to open the file %s: %v", name, pathCause(err))
+			w.err = err
+			c.writeOut(f, w)
+			return err
+		}
+		dst.w = file
+	}
+	if f.include || f.head {
+		var header bytes.Buffer
+		fmt.Fprintf(&header, "%s %s\r\n", resp.Proto, resp.Status)
+		resp.Header.Write(&header)
+		header.WriteString("\r\n")
+		w.header = int64(header.Len())
+		if _, err := dst.Write(header.Bytes()); err != nil {
+			return fail(exitWrite, "Failure writing output to destination")
+		}
+	}
+	body := c.policy.Body(resp.Body)
+	if f.maxSize > 0 {
+		body = (&vnet.Policy{MaxBytes: f.maxSize}).Body(body)
+	}
+	w.size, err = io.Copy(dst, body)
+	switch {
+	case dst.err != nil:
+		err = fail(exitWrite, "Failure writing output to destination")
+	case errors.Is(err, vnet.ErrTooLarge):
+		err = fail(exitFileSize, "Maximum file size exceeded")
+	case err != nil && ctx.Err() != nil:
+		err = c.cause(ctx.Err(), req.URL, timeout)
+	case err != nil:
+		err = fail(exitReceive, "Failure when receiving data from the peer")
+	case file != nil:
+		werr := file.Commit()
+		file = nil
+		if werr != nil {
+			err = fail(exitWrite, "Failed writing body to %s: %v", name, pathCause(werr))
+		}
+	}
+	w.err = err
+	c.writeOut(f, w)
+	return err
+}
+
+// writer keeps the error of writing the output, which is not the peer's.
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// request builds the request of the URL with the options.
+func (c *command) request(ctx context.Context, f *flags, rawURL string) (*http.Request, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fail(exitMalformed, "URL rejected: Malformed input to a URL function")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fail(exitUnsupported, "Protocol \"%s\" not supported", u.Scheme)
+	}
+
+	header := http.Header{}
+	method := http.MethodGet
+	var body io.Reader
+	switch {
+	case len(f.forms) > 0:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, field := range f.forms {
+			if err := c.formField(mw, f, field); err != nil {
+				return nil, err
+			}
+		}
+		mw.Close()
+		method, body = http.MethodPost, &buf
+		header.Set("Content-Type", mw.FormDataContentType())
+	case len(f.data) > 0 || len(f.json) > 0:
+		var parts []string
+		for _, d := range f.data {
+			s, err := c.data(f, d)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, s)
+		}
+		text := strings.Join(parts, "&")
+		for _, j := range f.json {
+			s, err := c.data(f, data{"binary", j})
+			if err != nil {
+				return nil, err
+			}
+			text += s
+		}
+		switch {
+		case f.get:
+			if u.RawQuery != "" {
+				u.RawQuery += "&"
+			}
+			u.RawQuery += text
+		case len(f.json) > 0:
+			method, body = http.MethodPost, strings.NewReader(text)
+			header.Set("Content-Type", "application/json")
+			header.Set("Accept", "application/json")
+		default:
+			method, body = http.MethodPost, strings.NewReader(text)
+			header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if f.head {
+		method = http.MethodHead
+	}
+	if f.method != "" {
+		method = f.method
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fail(exitMalformed, "URL rejected: %v", err)
+	}
+	req.Header = header
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	if f.referer != "" {
+		req.Header.Set("Referer", f.referer)
+	}
+	if f.user != "" {
+		user, password, _ := strings.Cut(f.user, ":")
+		req.SetBasicAuth(user, password)
+	}
+	for _, line := range f.headers {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			// "Name;" sends an empty header
+			if name, ok := strings.CutSuffix(line, ";"); ok {
+				req.Header[textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))] = []string{""}
+			}
+			continue
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		switch {
+		case value == "" && strings.EqualFold(name, "User-Agent"):
+			// an empty value keeps the client from adding its own
+			req.Header.Set(name, "")
+		case value == "":
+			req.Header.Del(name)
+		case strings.EqualFold(name, "Host"):
+			req.Host = value
+		default:
+			req.Header.Set(name, value)
+		}
+	}
+	return req, nil
+}
+
+// readFile reads a file of the data options, "-" being stdin.
+func (c *command) readFile(f *flags, name string) ([]byte, error) {
+	if name == "-" {
+		if f.stdinCache == nil {
+			b, err := io.ReadAll(c.Stdin)
+			if err != nil {
+				return nil, fail(exitRead, "Failed to read stdin: %v", err)
+			}
+			f.stdinCache = b
+		}
+		return f.stdinCache, nil
+	}
+	b, err := c.ws.ReadFile(c.ResolvePath(name), nil)
+	if err != nil {
+		return nil, fail(exitRead, "Failed to open/read local data from file/application: %s: %v", name, pathCause(err))
+	}
+	return b, nil
+}
+
+// data returns the text of a data option.
+func (c *command) data(f *flags, d data) (string, error) {
+	switch d.kind {
+	case "raw":
+		return d.value, nil
+	case "urlencode":
+		name, content, found := strings.Cut(d.value, "=")
+		if !found {
+			name, content = "", d.value
+			// NAME@FILE and @FILE
+			if n, file, ok := strings.Cut(d.value, "@"); ok {
+				b, err := c.readFile(f, file)
+				if err != nil {
+					return "", err
+				}
+				name, content = n, string(b)
+			}
+		}
+		if name == "" {
+			return url.QueryEscape(content), nil
+		}
+		return name + "=" + url.QueryEscape(content), nil
+	}
+	file, ok := strings.CutPrefix(d.value, "@")
+	if !ok {
+		return d.value, nil
+	}
+	b, err := c.readFile(f, file)
+	if err != nil {
+		return "", err
+	}
+	if d.kind == "data" {
+		b = bytes.ReplaceAll(bytes.ReplaceAll(b, []byte("\r"), nil), []byte("\n"), nil)
+	}
+	return string(b), nil
+}
+
+// formField adds a field of -F to the multipart form.
+func (c *command) formField(mw *multipart.Writer, f *flags, field string) error {
+	name, content, found := strings.Cut(field, "=")
+	if !found {
+		return fail(exitUsage, "Illegally formatted input field")
+	}
+	switch {
+	case strings.HasPrefix(content, "@"):
+		file, ctype, _ := strings.Cut(content[1:], ";type=")
+		b, err := c.readFile(f, file)
+		if err != nil {
+			return err
+		}
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(name), escapeQuotes(filepath.Base(file))))
+		h.Set("Content-Type", ctype)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		_, err = part.Write(b)
+		return err
+	case strings.HasPrefix(content, "<"):
+		b, err := c.readFile(f, content[1:])
+		if err != nil {
+			return err
+		}
+		return mw.WriteField(name, string(b))
+	}
+	return mw.WriteField(name, content)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// cause maps an error of the client to the status of curl.
+func (c *command) cause(err error, u *url.URL, timeout time.Duration) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		// the URL of a redirect
+		if r, perr := url.Parse(ue.URL); perr == nil {
+			u = r
+		}
+	}
+	var ce *curlError
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuth x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	switch {
+	case errors.As(err, &ce):
+		return ce
+	case errors.Is(err, vnet.ErrHostNotAllowed):
+		return fail(exitDenied, "Access denied by the network policy: %s", u.Hostname())
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded):
+		return fail(exitTimeout, "Operation timed out after %d milliseconds", timeout.Milliseconds())
+	case errors.As(err, &dnsErr):
+		return fail(exitResolve, "Could not resolve host: %s", u.Hostname())
+	case errors.As(err, &certErr) || errors.As(err, &unknownAuth) || errors.As(err, &hostErr):
+		return fail(exitSSL, "SSL certificate problem: %v", errors.Unwrap(err))
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		return fail(exitConnect, "Failed to connect to %s port %s: %v", u.Hostname(), port, opErr.Err)
+	}
+	return fail(exitConnect, "%v", err)
+}
+
+// redirects counts the redirects followed to the response.
+func redirects(resp *http.Response) int {
+	n := 0
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		n++
+	}
+	return n
+}
+
+// pathCause drops the operation and the path of file errors.
+func pathCause(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// writeOut is the state of a transfer for -w.
+type writeOut struct {
+	start     time.Time
+	method    string
+	url       *url.URL
+	resp      *http.Response
+	redirects int
+	header    int64
+	size      int64
+	err       error
+}
+
+// writeOut writes the format of -w for the transfer.
+func (c *command) writeOut(f *flags, w *writeOut) {
+	if f.writeOut == "" {
+		return
+	}
+	total := time.Since(w.start)
+	out := c.Stdout
+	var buf strings.Builder
+	flush := func() {
+		io.WriteString(out, buf.String())
+		buf.Reset()
+	}
+	format := f.writeOut
+	for len(format) > 0 {
+		switch {
+		case strings.HasPrefix(format, "%{"):
+			end := strings.IndexByte(format, '}')
+			if strings.HasPrefix(format, "%{header{") {
+				if end = strings.Index(format, "}}"); end >= 0 {
+					end++
+				}
+			}
+			if end < 0 {
+				buf.WriteString(format)
+				format = ""
+				continue
+			}
+			name := format[2:end]
+			format = format[end+1:]
+			switch name {
+			case "stdout":
+				flush()
+				out = c.Stdout
+			case "stderr":
+				flush()
+				out = c.Stderr
+			default:
+				buf.WriteString(w.variable(name, total))
+			}
+		case strings.HasPrefix(format, "%%"):
+			buf.WriteByte('%')
+			format = format[2:]
+		case strings.HasPrefix(format, `\`) && len(format) > 1:
+			switch format[1] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case '\\':
+				buf.WriteByte('\\')
+			default:
+				buf.WriteString(format[:2])
+			}
+			format = format[2:]
+		default:
+			buf.WriteByte(format[0])
+			format = format[1:]
+		}
+	}
+	flush()
+}
+
+// variable returns the value of a variable of -w.
+func (w *writeOut) variable(name string, total time.Duration) string {
+	if header, ok := strings.CutPrefix(name, "header{"); ok {
+		if w.resp == nil {
+			return ""
+		}
+		return strings.Join(w.resp.Header.Values(strings.TrimSuffix(header, "}")), ", ")
+	}
+	u := w.url
+	if w.resp != nil {
+		u = w.resp.Request.URL
+	}
+	switch name {
+	case "http_code", "response_code":
+		if w.resp == nil {
+			return "000"
+		}
+		return fmt.Sprintf("%03d", w.resp.StatusCode)
+	case "url_effective":
+		return u.String()
+	case "scheme":
+		return strings.ToUpper(u.Scheme)
+	case "method":
+		if w.resp != nil {
+			return w.resp.Request.Method
+		}
+		return w.method
+	case "content_type":
+		if w.resp == nil {
+			return ""
+		}
+		return w.resp.Header.Get("Content-Type")
+	case "size_download":
+		return strconv.FormatInt(w.size, 10)
+	case "size_header":
+		return strconv.FormatInt(w.header, 10)
+	case "time_total":
+		return strconv.FormatFloat(total.Seconds(), 'f', 6, 64)
+	case "num_redirects":
+		return strconv.Itoa(w.redirects)
+	case "redirect_url":
+		if w.resp == nil || w.resp.StatusCode/100 != 3 {
+			return ""
+		}
+		loc, err := w.resp.Location()
+		if err != nil {
+			return ""
+		}
+		return loc.String()
+	case "exitcode":
+		var ce *curlError
+		if errors.As(w.err, &ce) {
+			return strconv.Itoa(ce.code)
+		}
+		return "0"
+	case "errormsg":
+		var ce *curlError
+		if errors.As(w.err, &ce) {
+			return ce.msg
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,567 @@
+package curl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+	"github.com/qiangli/shell/vnet"
+)
+
+// setup creates the files in a workspace.
+func setup(t *testing.T, files map[string]string) (string, vfs.Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func runCurl(ws vfs.Workspace, policy *vnet.Policy, dir, stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := New(ws, policy)
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	cmd.SetWorkingDir(dir)
+	err := cmd.Run(args...)
+	var e *cli.ExitError
+	if errors.As(err, &e) && e.Err != nil {
+		// as the shell reports it
+		fmt.Fprintf(&stderr, "curl: %v\n", e.Err)
+	}
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+func exitCode(err error) int {
+	var e *cli.ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// echo writes the method, the sorted headers and the body of a request.
+func echo(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "%s %s\n", r.Method, r.URL.RequestURI())
+	if r.Host != r.URL.Host && r.Host != "" && !strings.HasPrefix(r.Host, "127.0.0.1:") {
+		fmt.Fprintf(w, "Host: %s\n", r.Host)
+	}
+	var names []string
+	for name := range r.Header {
+		switch name {
+		case "Accept-Encoding", "Content-Length":
+		default:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(r.Header[name], ", ")
+		if name == "Content-Type" {
+			// without the boundary of multipart forms
+			value, _, _ = strings.Cut(value, ";")
+		}
+		fmt.Fprintf(w, "%s: %s\n", name, value)
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		r.ParseMultipartForm(1 << 20)
+		var keys []string
+		for k := range r.MultipartForm.Value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "field %s=%s\n", k, r.MultipartForm.Value[k][0])
+		}
+		for k, fhs := range r.MultipartForm.File {
+			f, _ := fhs[0].Open()
+			b, _ := io.ReadAll(f)
+			fmt.Fprintf(w, "file %s=%s %s %q\n", k, fhs[0].Filename, fhs[0].Header.Get("Content-Type"), b)
+		}
+		return
+	}
+	b, _ := io.ReadAll(r.Body)
+	if len(b) > 0 {
+		fmt.Fprintf(w, "%q\n", b)
+	}
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", echo)
+	mux.HandleFunc("/echo/", echo)
+	mux.HandleFunc("/file.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Test", "yes")
+		io.WriteString(w, "content\n")
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file.txt", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/ipv4", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://127.0.0.1:"+r.URL.Query().Get("port")+"/file.txt", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not here", http.StatusNotFound)
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 100))
+	})
+	mux.HandleFunc("/latin1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=iso-8859-1")
+		io.WriteString(w, "caf\xe9\n")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCurl(t *testing.T) {
+	s := newServer(t)
+	u, _ := url.Parse(s.URL)
+	for _, tt := range []struct {
+		name   string
+		args   []string
+		body   string
+		stdin  string
+		stdout string
+		stderr string
+		code   int
+		files  map[string]string
+	}{
+		{
+			name:   "get",
+			args:   []string{s.URL + "/file.txt"},
+			stdout: "content\n",
+		},
+		{
+			name:   "no scheme",
+			args:   []string{u.Host + "/file.txt"},
+			stdout: "content\n",
+		},
+		{
+			name:   "several urls",
+			args:   []string{s.URL + "/file.txt", s.URL + "/file.txt"},
+			stdout: "content\ncontent\n",
+		},
+		{
+			name:   "method and headers",
+			args:   []string{"-X", "PUT", "-H", "X-One: 1", "-H", "User-Agent:", "-H", "Host: example.com", "-A", "ignored", s.URL + "/echo"},
+			stdout: "PUT /echo\nHost: example.com\nX-One: 1\n",
+		},
+		{
+			name:   "user agent referer and user",
+			args:   []string{"-A", "agent/1", "-e", "http://ref/", "-u", "me:secret", s.URL + "/echo"},
+			stdout: "GET /echo\nAuthorization: Basic bWU6c2VjcmV0\nReferer: http://ref/\nUser-Agent: agent/1\n",
+		},
+		{
+			name:   "data",
+			args:   []string{"-d", "a=1", "--data=b=2", "-d", "@body", s.URL + "/echo"},
+			stdout: "POST /echo\nContent-Type: application/x-www-form-urlencoded\nUser-Agent: Go-http-client/1.1\n\"a=1&b=2&c=3d=4\"\n",
+			body:   "c=3\nd=4\n",
+		},
+		{
+			name:   "data binary and raw",
+			args:   []string{"--data-binary", "@-", "--data-raw", "@x", s.URL + "/echo"},
+			stdin:  "l1\nl2\n",
+			stdout: "POST /echo\nContent-Type: application/x-www-form-urlencoded\nUser-Agent: Go-http-client/1.1\n\"l1\\nl2\\n&@x\"\n",
+		},
+		{
+			name:   "data urlencode",
+			args:   []string{"--data-urlencode", "q=a b&c", "--data-urlencode", "x y", "--data-urlencode", "f@body", s.URL + "/echo"},
+			stdout: "POST /echo\nContent-Type: application/x-www-form-urlencoded\nUser-Agent: Go-http-client/1.1\n\"q=a+b%26c&x+y&f=%3D\"\n",
+			body:   "=",
+		},
+		{
+			name:   "get with data",
+			args:   []string{"-G", "-d", "a=1", "-d", "b=2", s.URL + "/echo?x=0"},
+			stdout: "GET /echo?x=0&a=1&b=2\nUser-Agent: Go-http-client/1.1\n",
+		},
+		{
+			name:   "json",
+			args:   []string{"--json", `{"a":1}`, s.URL + "/echo"},
+			stdout: "POST /echo\nAccept: application/json\nContent-Type: application/json\nUser-Agent: Go-http-client/1.1\n\"{\\\"a\\\":1}\"\n",
+		},
+		{
+			name:   "form",
+			args:   []string{"-F", "name=value", "-F", "text=<body", "-F", "up=@body;type=text/plain", s.URL + "/echo"},
+			stdout: "POST /echo\nContent-Type: multipart/form-data\nUser-Agent: Go-http-client/1.1\nfield name=value\nfield text=hello\nfile up=body text/plain \"hello\"\n",
+			body:   "hello",
+		},
+		{
+			name:   "head",
+			args:   []string{"-I", s.URL + "/file.txt"},
+			stdout: "HTTP/1.1 200 OK\r\nContent-Length: 8\r\nContent-Type: text/plain\r\nDate: DATE\r\nX-Test: yes\r\n\r\n",
+		},
+		{
+			name:   "include",
+			args:   []string{"-i", s.URL + "/file.txt"},
+			stdout: "HTTP/1.1 200 OK\r\nContent-Length: 8\r\nContent-Type: text/plain\r\nDate: DATE\r\nX-Test: yes\r\n\r\ncontent\n",
+		},
+		{
+			name:   "output",
+			args:   []string{"-o", "out", s.URL + "/file.txt", "-O", s.URL + "/file.txt", "-o", "-", s.URL + "/file.txt"},
+			stdout: "content\n",
+			files:  map[string]string{"out": "content\n", "file.txt": "content\n"},
+		},
+		{
+			name:   "remote name missing",
+			args:   []string{"-O", s.URL + "/echo/"},
+			stderr: "curl: (23) Remote file name has no length\n",
+			code:   23,
+		},
+		{
+			name:   "no redirect",
+			args:   []string{"-w", "%{http_code} %{redirect_url} %{num_redirects}", s.URL + "/redirect"},
+			stdout: "<a href=\"/file.txt\">Found</a>.\n\n302 " + s.URL + "/file.txt 0",
+		},
+		{
+			name:   "location",
+			args:   []string{"-L", "-w", "%{http_code} %{url_effective} %{num_redirects}\\n", s.URL + "/redirect"},
+			stdout: "content\n200 " + s.URL + "/file.txt 1\n",
+		},
+		{
+			name:   "max redirs",
+			args:   []string{"-L", "--max-redirs", "3", s.URL + "/loop"},
+			stderr: "curl: (47) Maximum (3) redirects followed\n",
+			code:   47,
+		},
+		{
+			name:   "fail",
+			args:   []string{"-f", "-w", "%{http_code} %{exitcode}\\n", s.URL + "/missing"},
+			stdout: "404 22\n",
+			stderr: "curl: (22) The requested URL returned error: 404\n",
+			code:   22,
+		},
+		{
+			name:   "no fail",
+			args:   []string{s.URL + "/missing"},
+			stdout: "not here\n",
+		},
+		{
+			name: "silent",
+			args: []string{"-sf", s.URL + "/missing"},
+			code: 22,
+		},
+		{
+			name:   "show error",
+			args:   []string{"-sSf", s.URL + "/missing"},
+			stderr: "curl: (22) The requested URL returned error: 404\n",
+			code:   22,
+		},
+		{
+			name:   "write out",
+			args:   []string{"-s", "-o", "out", "-w", `%{method} %{scheme} %{content_type} %{size_download} %{header{x-test}} 100%%\t%{stderr}err\n`, s.URL + "/file.txt"},
+			stdout: "GET HTTP text/plain 8 yes 100%\t",
+			stderr: "err\n",
+			files:  map[string]string{"out": "content\n"},
+		},
+		{
+			name:   "write out unterminated",
+			args:   []string{"-s", "-o", "out", "-w", `%{http_code} %{header{x-test}`, s.URL + "/file.txt"},
+			stdout: "200 %{header{x-test}",
+			files:  map[string]string{"out": "content\n"},
+		},
+		{
+			name:   "max filesize",
+			args:   []string{"--max-filesize", "10", "-o", "out", s.URL + "/big"},
+			stderr: "curl: (63) Maximum file size exceeded\n",
+			code:   63,
+		},
+		{
+			name:   "max time",
+			args:   []string{"-m", "0.1", s.URL + "/slow"},
+			stderr: "curl: (28) Operation timed out after 100 milliseconds\n",
+			code:   28,
+		},
+		{
+			name:   "unsupported",
+			args:   []string{"ftp://host/file"},
+			stderr: "curl: (1) Protocol \"ftp\" not supported\n",
+			code:   1,
+		},
+		{
+			name:   "malformed",
+			args:   []string{"http://"},
+			stderr: "curl: (3) URL rejected: Malformed input to a URL function\n",
+			code:   3,
+		},
+		{
+			name:   "missing data file",
+			args:   []string{"-d", "@nofile", s.URL + "/echo"},
+			stderr: "curl: (26) Failed to open/read local data from file/application: nofile: no such file or directory\n",
+			code:   26,
+		},
+		{
+			name:   "data and form",
+			args:   []string{"-d", "a", "-F", "b=c", s.URL + "/echo"},
+			stderr: "curl: you can only select one HTTP request method\n",
+			code:   2,
+		},
+		{
+			name:   "no url",
+			args:   []string{"-s"},
+			stderr: "curl: no URL specified\n",
+			code:   2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := setup(t, map[string]string{"body": tt.body})
+			stdout, stderr, code := runCurl(ws, nil, dir, tt.stdin, tt.args...)
+			if i := strings.Index(stdout, "Date: "); i >= 0 {
+				end := strings.Index(stdout[i:], "\r\n")
+				stdout = stdout[:i] + "Date: DATE" + stdout[i+end:]
+			}
+			if stdout != tt.stdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.stdout)
+			}
+			if stderr != tt.stderr {
+				t.Errorf("stderr = %q, want %q", stderr, tt.stderr)
+			}
+			if code != tt.code {
+				t.Errorf("code = %d, want %d", code, tt.code)
+			}
+			for name, want := range tt.files {
+				b, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil || string(b) != want {
+					t.Errorf("%s = %q, %v, want %q", name, b, err, want)
+				}
+			}
+			if tt.code != 0 {
+				if _, err := os.Stat(filepath.Join(dir, "out")); err == nil {
+					t.Errorf("out written on failure")
+				}
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	s := newServer(t)
+	u, _ := url.Parse(s.URL)
+	host := "localhost:" + u.Port()
+	for _, tt := range []struct {
+		name   string
+		policy *vnet.Policy
+		url    string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{
+			name:   "allowed",
+			policy: &vnet.Policy{AllowHosts: []string{"localhost"}},
+			url:    "http://" + host + "/file.txt",
+			stdout: "content\n",
+		},
+		{
+			name:   "not allowed",
+			policy: &vnet.Policy{AllowHosts: []string{"example.com"}},
+			url:    "http://" + host + "/file.txt",
+			stderr: "curl: (9) Access denied by the network policy: localhost\n",
+			code:   9,
+		},
+		{
+			name:   "redirect not allowed",
+			policy: &vnet.Policy{AllowHosts: []string{"localhost"}},
+			url:    "http://" + host + "/ipv4?port=" + u.Port(),
+			stderr: "curl: (9) Access denied by the network policy: 127.0.0.1\n",
+			code:   9,
+		},
+		{
+			name:   "redirect allowed",
+			policy: &vnet.Policy{AllowHosts: []string{"localhost", "127.0.0.0/8"}},
+			url:    "http://" + host + "/ipv4?port=" + u.Port(),
+			stdout: "content\n",
+		},
+		{
+			name:   "too large",
+			policy: &vnet.Policy{MaxBytes: 99},
+			url:    s.URL + "/big",
+			stderr: "curl: (63) Maximum file size exceeded\n",
+			code:   63,
+		},
+		{
+			name:   "within the cap",
+			policy: &vnet.Policy{MaxBytes: 100},
+			url:    s.URL + "/big",
+			stdout: strings.Repeat("x", 100),
+		},
+		{
+			name:   "timeout",
+			policy: &vnet.Policy{Timeout: 100 * time.Millisecond},
+			url:    s.URL + "/slow",
+			stderr: "curl: (28) Operation timed out after 100 milliseconds\n",
+			code:   28,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := setup(t, nil)
+			stdout, stderr, code := runCurl(ws, tt.policy, dir, "", "-L", "-o", "out", tt.url)
+			if code != tt.code || stderr != tt.stderr {
+				t.Errorf("code, stderr = %d, %q, want %d, %q", code, stderr, tt.code, tt.stderr)
+			}
+			b, err := os.ReadFile(filepath.Join(dir, "out"))
+			if tt.code != 0 {
+				if err == nil {
+					t.Errorf("out written on failure")
+				}
+				return
+			}
+			if string(b) != tt.stdout || stdout != "" {
+				t.Errorf("out = %q, %v, want %q", b, err, tt.stdout)
+			}
+		})
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	s := newServer(t)
+	// UTF-16 with a byte order mark
+	old := "\xff\xfeo\x00l\x00d\x00\n\x00"
+	for _, tt := range []struct {
+		name   string
+		policy *vnet.Policy
+		args   []string
+		want   string
+		stderr string
+		code   int
+	}{
+		{
+			name: "replaced as received",
+			args: []string{"-o", "out", s.URL + "/latin1"},
+			want: "caf\xe9\n",
+		},
+		{
+			name: "remote name",
+			args: []string{"-O", s.URL + "/file.txt"},
+			want: old,
+		},
+		{
+			name:   "too large",
+			policy: &vnet.Policy{MaxBytes: 99},
+			args:   []string{"-o", "out", s.URL + "/big"},
+			want:   old,
+			stderr: "curl: (63) Maximum file size exceeded\n",
+			code:   63,
+		},
+		{
+			name:   "HTTP error",
+			args:   []string{"-f", "-o", "out", s.URL + "/missing"},
+			want:   old,
+			stderr: "curl: (22) The requested URL returned error: 404\n",
+			code:   22,
+		},
+		{
+			name:   "missing directory",
+			args:   []string{"-o", "none/out", s.URL + "/file.txt"},
+			want:   old,
+			stderr: "curl: (23) Failed to open the file none/out: ",
+			code:   23,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := setup(t, map[string]string{"out": old})
+			if err := os.Chmod(filepath.Join(dir, "out"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, stderr, code := runCurl(ws, tt.policy, dir, "", tt.args...)
+			// the cause is that of the workspace
+			if code != tt.code || !strings.HasPrefix(stderr, tt.stderr) || tt.stderr == "" && stderr != "" {
+				t.Errorf("code, stderr = %d, %q, want %d, %q", code, stderr, tt.code, tt.stderr)
+			}
+			if b, err := os.ReadFile(filepath.Join(dir, "out")); string(b) != tt.want {
+				t.Errorf("out = %q, %v, want %q", b, err, tt.want)
+			}
+			if info, err := os.Stat(filepath.Join(dir, "out")); err != nil || info.Mode().Perm() != 0o600 {
+				t.Errorf("out mode = %v, %v, want %v", info.Mode(), err, os.FileMode(0o600))
+			}
+			entries, _ := os.ReadDir(dir)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			want := []string{"out"}
+			if tt.name == "remote name" {
+				want = []string{"file.txt", "out"}
+			}
+			if !slices.Equal(names, want) {
+				t.Errorf("files = %q, want %q", names, want)
+			}
+		})
+	}
+}
+
+func TestOutputStreamed(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 1000))
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "y")
+	}))
+	defer s.Close()
+
+	dir, ws := setup(t, map[string]string{"out": "old"})
+	done := make(chan int)
+	go func() {
+		_, _, code := runCurl(ws, nil, dir, "", "-o", "out", s.URL)
+		done <- code
+	}()
+	// the body received so far is in a temporary file, the output is
+	// replaced once complete
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatal("no partial download")
+		}
+		matches, _ := filepath.Glob(filepath.Join(dir, ".out.*.tmp"))
+		if len(matches) != 1 {
+			continue
+		}
+		if info, err := os.Stat(matches[0]); err == nil && info.Size() == 1000 {
+			break
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "out")); string(b) != "old" {
+		t.Errorf("out = %q before the download is complete", b)
+	}
+	close(release)
+	if code := <-done; code != 0 {
+		t.Fatalf("exit %d", code)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "out")); string(b) != strings.Repeat("x", 1000)+"y" {
+		t.Errorf("out = %q", b)
+	}
+}
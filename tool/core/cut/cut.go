@@ -0,0 +1,375 @@
+// Cut prints selected parts of lines.
+//
+// Synopsis:
+//
+//	cut OPTION... [FILE]...
+//
+// Description:
+//
+//	Cut prints the selected bytes, characters or fields of each line of
+//	the files, or of stdin. LIST is made of ranges separated by commas:
+//	N, N-, N-M or -M, counted from 1.
+//
+// Options:
+//
+//	-b, --bytes LIST:             select only these bytes
+//	-c, --characters LIST:        select only these characters
+//	-f, --fields LIST:            select only these fields, and lines without delimiters
+//	-d, --delimiter DELIM:        use DELIM instead of TAB as the field delimiter
+//	-s, --only-delimited:         do not print lines without delimiters
+//	    --complement:             select the bytes, characters or fields not in LIST
+//	    --output-delimiter STRING: separate the selected parts by STRING
+//	-z, --zero-terminated:        lines end with NUL, not newline
+//	-n:                           ignored
+package cut
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the cut core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new cut command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	bytes, chars, fields string
+	delimiter            string
+	onlyDelimited        bool
+	complement           bool
+	outputDelimiter      string
+	zero                 bool
+	ignored              bool
+}
+
+// span is a range of positions counted from 1, inclusive.
+type span struct {
+	lo, hi int
+}
+
+// parseList parses a LIST of fields, or of positions if not fields, into
+// sorted and merged spans.
+func parseList(list string, fields bool) ([]span, error) {
+	var spans []span
+	for _, r := range strings.Split(list, ",") {
+		s := span{1, math.MaxInt}
+		lo, hi, isRange := strings.Cut(r, "-")
+		var err error
+		switch {
+		case !isRange:
+			if s.lo, err = strconv.Atoi(lo); err == nil {
+				s.hi = s.lo
+			}
+		case lo == "" && hi == "":
+			return nil, errors.New("invalid range with no endpoint: -")
+		default:
+			if lo != "" {
+				s.lo, err = strconv.Atoi(lo)
+			}
+			if err == nil && hi != "" {
+				s.hi, err = strconv.Atoi(hi)
+			}
+		}
+		if err != nil {
+			if fields {
+				return nil, fmt.Errorf("invalid field value '%s'", r)
+			}
+			return nil, fmt.Errorf("invalid byte or character range '%s'", r)
+		}
+		if s.lo < 1 || s.hi < 1 {
+			if fields {
+				return nil, errors.New("fields are numbered from 1")
+			}
+			return nil, errors.New("byte/character positions are numbered from 1")
+		}
+		if s.lo > s.hi {
+			return nil, errors.New("invalid decreasing range")
+		}
+		spans = append(spans, s)
+	}
+	// sort and merge overlapping spans, adjacent ones are delimited
+	for i := 1; i < len(spans); i++ {
+		for j := i; j > 0 && spans[j].lo < spans[j-1].lo; j-- {
+			spans[j], spans[j-1] = spans[j-1], spans[j]
+		}
+	}
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s.lo <= last.hi {
+			last.hi = max(last.hi, s.hi)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged, nil
+}
+
+// complement returns the spans not in spans.
+func complement(spans []span) []span {
+	var out []span
+	next := 1
+	for _, s := range spans {
+		if s.lo > next {
+			out = append(out, span{next, s.lo - 1})
+		}
+		if s.hi == math.MaxInt {
+			return out
+		}
+		next = s.hi + 1
+	}
+	return append(out, span{next, math.MaxInt})
+}
+
+// cutter cuts lines.
+type cutter struct {
+	spans []span
+	// one of 'b', 'c' or 'f'
+	mode            byte
+	delimiter       string
+	outputDelimiter string
+	onlyDelimited   bool
+}
+
+// cut writes the selected parts of the line, reporting whether anything
+// is to be written for it, including its terminator.
+func (ct *cutter) cut(w *bufio.Writer, line string) bool {
+	switch ct.mode {
+	case 'f':
+		if !strings.Contains(line, ct.delimiter) {
+			if ct.onlyDelimited {
+				return false
+			}
+			w.WriteString(line)
+			return true
+		}
+		fields := strings.Split(line, ct.delimiter)
+		first := true
+		for _, s := range ct.spans {
+			for i := s.lo; i <= min(s.hi, len(fields)); i++ {
+				if !first {
+					w.WriteString(ct.outputDelimiter)
+				}
+				w.WriteString(fields[i-1])
+				first = false
+			}
+		}
+	case 'c':
+		// the byte offsets of the characters, and of the end
+		offsets := make([]int, 0, len(line)+1)
+		for i := range line {
+			offsets = append(offsets, i)
+		}
+		offsets = append(offsets, len(line))
+		ct.writeSpans(w, line, len(offsets)-1, func(i int) int { return offsets[i] })
+	default:
+		ct.writeSpans(w, line, len(line), func(i int) int { return i })
+	}
+	return true
+}
+
+// writeSpans writes the spans of the n positions of the line, offset
+// returning the byte offset of a position counted from 0. Spans are
+// separated by the output delimiter if one is given.
+func (ct *cutter) writeSpans(w *bufio.Writer, line string, n int, offset func(int) int) {
+	for i, s := range ct.spans {
+		if s.lo > n {
+			break
+		}
+		if i > 0 && ct.outputDelimiter != "" {
+			w.WriteString(ct.outputDelimiter)
+		}
+		w.WriteString(line[offset(s.lo-1):offset(min(s.hi, n))])
+	}
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+	delimiter := valueFlag{s: &f.delimiter}
+	outputDelimiter := valueFlag{s: &f.outputDelimiter}
+
+	fs := flag.NewFlagSet("cut", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.StringVar(&f.bytes, "b", "", "select only these bytes")
+	fs.StringVar(&f.bytes, "bytes", "", "select only these bytes")
+	fs.StringVar(&f.chars, "c", "", "select only these characters")
+	fs.StringVar(&f.chars, "characters", "", "select only these characters")
+	fs.StringVar(&f.fields, "f", "", "select only these fields")
+	fs.StringVar(&f.fields, "fields", "", "select only these fields")
+	fs.Var(&delimiter, "d", "use DELIM instead of TAB as the field delimiter")
+	fs.Var(&delimiter, "delimiter", "use DELIM instead of TAB as the field delimiter")
+	fs.BoolVar(&f.onlyDelimited, "s", false, "do not print lines without delimiters")
+	fs.BoolVar(&f.onlyDelimited, "only-delimited", false, "do not print lines without delimiters")
+	fs.BoolVar(&f.complement, "complement", false, "select the bytes, characters or fields not in LIST")
+	fs.Var(&outputDelimiter, "output-delimiter", "separate the selected parts by STRING")
+	fs.BoolVar(&f.zero, "z", false, "lines end with NUL, not newline")
+	fs.BoolVar(&f.zero, "zero-terminated", false, "lines end with NUL, not newline")
+	fs.BoolVar(&f.ignored, "n", false, "ignored")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "cut OPTION... [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Cut prints selected parts of lines.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	valued := []string{"b", "bytes", "c", "characters", "f", "fields", "d", "delimiter", "output-delimiter"}
+	if err := fs.Parse(cli.Args(args, valued...)); err != nil {
+		return cli.Exit(1, err)
+	}
+
+	ct := &cutter{onlyDelimited: f.onlyDelimited, delimiter: "\t"}
+	var list string
+	for _, l := range []struct {
+		mode byte
+		list string
+	}{{'b', f.bytes}, {'c', f.chars}, {'f', f.fields}} {
+		if l.list == "" {
+			continue
+		}
+		if ct.mode != 0 {
+			return cli.Exit(1, errors.New("only one type of list may be specified"))
+		}
+		ct.mode, list = l.mode, l.list
+	}
+	if ct.mode == 0 {
+		return cli.Exit(1, errors.New("you must specify a list of bytes, characters, or fields"))
+	}
+	if ct.mode != 'f' {
+		if delimiter.set {
+			return cli.Exit(1, errors.New("an input delimiter may be specified only when operating on fields"))
+		}
+		if f.onlyDelimited {
+			return cli.Exit(1, errors.New("suppressing non-delimited lines makes sense\n\tonly when operating on fields"))
+		}
+	}
+	switch {
+	case !delimiter.set:
+	case f.delimiter == "":
+		// as GNU cut, the empty delimiter is NUL
+		ct.delimiter = "\x00"
+	case utf8.RuneCountInString(f.delimiter) != 1:
+		return cli.Exit(1, errors.New("the delimiter must be a single character"))
+	default:
+		ct.delimiter = f.delimiter
+	}
+	spans, err := parseList(list, ct.mode == 'f')
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+	if f.complement {
+		spans = complement(spans)
+	}
+	ct.spans = spans
+	ct.outputDelimiter = f.outputDelimiter
+	if !outputDelimiter.set && ct.mode == 'f' {
+		ct.outputDelimiter = ct.delimiter
+	}
+
+	eol := byte('\n')
+	if f.zero {
+		eol = 0
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	w := bufio.NewWriter(c.Stdout)
+	defer w.Flush()
+	failed := false
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r, err := cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+		if err != nil {
+			w.Flush()
+			fmt.Fprintf(c.Stderr, "cut: %v\n", err)
+			failed = true
+			continue
+		}
+		err = c.cutReader(w, r, ct, eol)
+		r.Close()
+		if err != nil {
+			w.Flush()
+			fmt.Fprintf(c.Stderr, "cut: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return cli.Exit(1, err)
+	}
+	if failed {
+		return cli.Exit(1, nil)
+	}
+	return nil
+}
+
+func (c *command) cutReader(w *bufio.Writer, r io.Reader, ct *cutter, eol byte) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString(eol)
+		if line != "" {
+			if ct.cut(w, strings.TrimSuffix(line, string(eol))) {
+				w.WriteByte(eol)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// valueFlag is a string flag that records whether it was given, even
+// empty.
+type valueFlag struct {
+	s   *string
+	set bool
+}
+
+func (v *valueFlag) String() string {
+	if v.s == nil {
+		return ""
+	}
+	return *v.s
+}
+
+func (v *valueFlag) Set(s string) error {
+	*v.s, v.set = s, true
+	return nil
+}
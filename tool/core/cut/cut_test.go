@@ -0,0 +1,25 @@
+package cut
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestCut(t *testing.T) {
+	golden.Run(t, "cut", New)
+}
+
+func TestCutZeroTerminated(t *testing.T) {
+	var stdout bytes.Buffer
+	cmd := New(nil)
+	cmd.SetIO(strings.NewReader("a,b\x00c,d"), &stdout, &stdout)
+	if err := cmd.Run("-z", "-d,", "-f2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "b\x00d\x00"; got != want {
+		t.Errorf("cut -z: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,799 @@
+// Diff compares files line by line.
+//
+// Synopsis:
+//
+//	diff [OPTION]... FILE1 FILE2
+//
+// Description:
+//
+//	Diff compares the files FILE1 and FILE2 of the workspace, one of them
+//	being stdin if it is "-". A directory and a file compare the file of
+//	the same name in the directory. Two directories compare their files
+//	of the same name, in the order of the names, and report the files only
+//	in one of them; each comparison with differences is introduced by a
+//	"diff" line with the options.
+//
+//	The differences are written in the normal format by default, which
+//	lists the changes without context. The exit status is 0 if the inputs
+//	are the same, 1 if they differ and 2 on trouble.
+//
+// Options:
+//
+//	    --normal:                output a normal diff (the default)
+//	-q, --brief:                 report only whether the files differ
+//	-s, --report-identical-files: report when the files are the same
+//	-c, -C NUM, --context[=NUM]: output NUM (default 3) lines of copied context
+//	-u, -U NUM, --unified[=NUM]: output NUM (default 3) lines of unified context
+//	-y, --side-by-side:          output in two columns
+//	-W, --width NUM:             output at most NUM (default 130) columns with -y
+//	    --suppress-common-lines: do not output common lines with -y
+//	-L, --label LABEL:           use LABEL instead of the file name and time, once for each file
+//	-r, --recursive:             compare the subdirectories too
+//	-N, --new-file:              compare a file only in one directory with an empty file
+//	-i, --ignore-case:           ignore case differences
+//	-b, --ignore-space-change:   ignore changes in the amount of white space
+//	-w, --ignore-all-space:      ignore all white space
+//	-B, --ignore-blank-lines:    ignore changes whose lines are all blank
+package diff
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/u-root/u-root/pkg/core"
+	"golang.org/x/text/width"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+// command implements the diff core utility.
+type command struct {
+	core.Base
+
+	ws vfs.Workspace
+}
+
+// New creates a new diff command.
+func New(ws vfs.Workspace) core.Command {
+	c := &command{
+		ws: ws,
+	}
+	c.Init()
+	return c
+}
+
+// The output formats.
+const (
+	normal = iota
+	copied
+	unified
+	sideBySide
+)
+
+type flags struct {
+	vfs.DiffOptions
+
+	// the output format, -1 until one is given
+	format   int
+	conflict bool
+	// the lines of context of -c and -u, -1 until given
+	lines     int
+	width     int
+	suppress  bool
+	labels    labelFlag
+	identical bool
+}
+
+// formatFlag selects an output format, with the number of context lines
+// as its optional value.
+type formatFlag struct {
+	f      *flags
+	format int
+	// the number of lines is required, as for -C and -U
+	counted bool
+}
+
+func (v formatFlag) String() string   { return "" }
+func (v formatFlag) IsBoolFlag() bool { return !v.counted }
+func (v formatFlag) Set(s string) error {
+	if s == "false" {
+		return nil
+	}
+	v.f.conflict = v.f.conflict || v.f.format >= 0 && v.f.format != v.format
+	v.f.format = v.format
+	n := 3
+	if s != "true" || v.counted {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 0 {
+			return fmt.Errorf("invalid context length '%s'", s)
+		}
+	}
+	if v.format == copied || v.format == unified {
+		// the largest context given wins
+		v.f.lines = max(v.f.lines, n)
+	}
+	return nil
+}
+
+type labelFlag []string
+
+func (l *labelFlag) String() string { return strings.Join(*l, ",") }
+func (l *labelFlag) Set(s string) error {
+	if len(*l) == 2 {
+		return errors.New("too many file label options")
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	f := flags{format: -1, lines: -1}
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	boolVar := func(p *bool, short, long, usage string) {
+		if short != "" {
+			fs.BoolVar(p, short, false, usage)
+		}
+		fs.BoolVar(p, long, false, usage)
+	}
+	formatVar := func(format int, short, counted, long, usage string) {
+		if short != "" {
+			fs.Var(formatFlag{&f, format, false}, short, usage)
+		}
+		if counted != "" {
+			fs.Var(formatFlag{&f, format, true}, counted, "like -"+short+" with `NUM` lines of context")
+		}
+		fs.Var(formatFlag{&f, format, false}, long, usage)
+	}
+
+	formatVar(normal, "", "", "normal", "output a normal diff (the default)")
+	boolVar(&f.Brief, "q", "brief", "report only whether the files differ")
+	boolVar(&f.identical, "s", "report-identical-files", "report when the files are the same")
+	formatVar(copied, "c", "C", "context", "output 3 lines of copied context")
+	formatVar(unified, "u", "U", "unified", "output 3 lines of unified context")
+	formatVar(sideBySide, "y", "", "side-by-side", "output in two columns")
+	fs.IntVar(&f.width, "W", 130, "output at most `NUM` columns with -y")
+	fs.IntVar(&f.width, "width", 130, "output at most `NUM` columns with -y")
+	boolVar(&f.suppress, "", "suppress-common-lines", "do not output common lines with -y")
+	fs.Var(&f.labels, "L", "use `LABEL` instead of the file name and time")
+	fs.Var(&f.labels, "label", "use `LABEL` instead of the file name and time")
+	boolVar(&f.Recursive, "r", "recursive", "compare the subdirectories too")
+	boolVar(&f.NewFile, "N", "new-file", "compare a file only in one directory with an empty file")
+	boolVar(&f.IgnoreCase, "i", "ignore-case", "ignore case differences")
+	boolVar(&f.IgnoreSpaceChange, "b", "ignore-space-change", "ignore changes in the amount of white space")
+	boolVar(&f.IgnoreAllSpace, "w", "ignore-all-space", "ignore all white space")
+	boolVar(&f.IgnoreBlankLines, "B", "ignore-blank-lines", "ignore changes whose lines are all blank")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "diff [OPTION]... FILE1 FILE2\n\n")
+		fmt.Fprintf(fs.Output(), "Diff compares files line by line.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(cli.Args(args, "C", "U", "W", "width", "L", "label")); err != nil {
+		return cli.Exit(2, err)
+	}
+	if f.conflict {
+		return cli.Exit(2, errors.New("conflicting output style options"))
+	}
+	switch fs.NArg() {
+	case 0:
+		return cli.Exit(2, errors.New("missing operand"))
+	case 1:
+		return cli.Exit(2, fmt.Errorf("missing operand after '%s'", fs.Arg(0)))
+	case 2:
+	default:
+		return cli.Exit(2, fmt.Errorf("extra operand '%s'", fs.Arg(2)))
+	}
+	if f.width <= 0 {
+		return cli.Exit(2, fmt.Errorf("invalid width '%d'", f.width))
+	}
+
+	f.format = max(f.format, normal)
+	// hunks without context for the normal and side by side formats
+	f.Context = -1
+	if (f.format == copied || f.format == unified) && f.lines > 0 {
+		f.Context = f.lines
+	}
+	f.Identical = true
+
+	p := &printer{
+		command:  c,
+		f:        &f,
+		w:        bufio.NewWriter(c.Stdout),
+		old:      operand{name: fs.Arg(0), path: c.ResolvePath(fs.Arg(0))},
+		new:      operand{name: fs.Arg(1), path: c.ResolvePath(fs.Arg(1))},
+		switches: switches(args, fs.Args()),
+	}
+	defer p.w.Flush()
+
+	var result *vfs.DiffResult
+	var err error
+	if p.old.name == "-" || p.new.name == "-" {
+		result, err = p.diffStdin()
+	} else {
+		p.dirs = p.isDir(p.old.path) && p.isDir(p.new.path)
+		result, err = c.ws.Diff(p.old.path, p.new.path, &f.DiffOptions)
+	}
+	if result != nil {
+		for _, fd := range result.Files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p.print(fd)
+		}
+	}
+	if err != nil {
+		p.w.Flush()
+		return cli.Exit(2, p.cause(err))
+	}
+	if p.status != 0 {
+		return cli.Exit(p.status, nil)
+	}
+	return nil
+}
+
+// switches returns the arguments other than the operands, for the
+// "diff" lines of directories.
+func switches(args, operands []string) string {
+	args = slices.Clone(args)
+	for _, name := range slices.Backward(operands) {
+		for i := len(args) - 1; i >= 0; i-- {
+			if args[i] == name {
+				args = slices.Delete(args, i, i+1)
+				break
+			}
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// operand is an operand as it was given and resolved.
+type operand struct {
+	name string
+	path string
+}
+
+// display returns the name of the path under the operand as given.
+func (o operand) display(path string) string {
+	rel, ok := strings.CutPrefix(path, o.path)
+	if !ok || rel != "" && rel[0] != filepath.Separator {
+		return path
+	}
+	rel = strings.TrimPrefix(rel, string(filepath.Separator))
+	switch {
+	case rel == "":
+		return o.name
+	case strings.HasSuffix(o.name, "/"):
+		return o.name + rel
+	}
+	return o.name + "/" + rel
+}
+
+// printer writes the differences of the files.
+type printer struct {
+	*command
+
+	f        *flags
+	w        *bufio.Writer
+	old, new operand
+	switches string
+	// both operands are directories
+	dirs bool
+	// content read from stdin
+	stdin  []byte
+	status int
+}
+
+func (p *printer) isDir(path string) bool {
+	info, err := p.ws.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// cause names the files of errors as the operands were given.
+func (p *printer) cause(err error) error {
+	var pe *fs.PathError
+	if !errors.As(err, &pe) {
+		return err
+	}
+	name := p.old.display(pe.Path)
+	if name == pe.Path {
+		name = p.new.display(pe.Path)
+	}
+	return fmt.Errorf("%s: %w", name, pe.Err)
+}
+
+// diffStdin compares stdin with the other operand.
+func (p *printer) diffStdin() (*vfs.DiffResult, error) {
+	if p.old.name == p.new.name {
+		return &vfs.DiffResult{}, nil
+	}
+	other := p.old.path
+	if p.old.name == "-" {
+		other = p.new.path
+	}
+	if p.isDir(other) {
+		return nil, errors.New("cannot compare '-' to a directory")
+	}
+	data, err := p.ws.ReadFile(other, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.stdin, err = io.ReadAll(p.Stdin); err != nil {
+		return nil, err
+	}
+	a, b := string(p.stdin), string(data)
+	if p.new.name == "-" {
+		a, b = b, a
+	}
+	fd := &vfs.FileDiff{OldPath: p.old.path, NewPath: p.new.path, Status: vfs.DiffModified}
+	switch {
+	case a == b:
+		fd.Status = vfs.DiffIdentical
+	case strings.IndexByte(a[:min(len(a), 8192)], 0) >= 0 || strings.IndexByte(b[:min(len(b), 8192)], 0) >= 0:
+		fd.Status = vfs.DiffBinary
+	default:
+		if fd.Hunks = vfs.DiffContent(a, b, &p.f.DiffOptions); len(fd.Hunks) == 0 {
+			fd.Status = vfs.DiffIdentical
+		}
+	}
+	return &vfs.DiffResult{Files: []*vfs.FileDiff{fd}}, nil
+}
+
+// read returns the lines of a compared file, none if it is missing.
+func (p *printer) read(o operand, path string, missing bool) ([]string, error) {
+	if missing {
+		return nil, nil
+	}
+	if o.name == "-" {
+		return vfs.SplitLines(string(p.stdin)), nil
+	}
+	data, err := p.ws.ReadFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return vfs.SplitLines(string(data)), nil
+}
+
+// print writes the difference of a pair of files.
+func (p *printer) print(fd *vfs.FileDiff) {
+	a, b := p.old.display(fd.OldPath), p.new.display(fd.NewPath)
+	switch {
+	case fd.OldPath == "":
+		fmt.Fprintf(p.w, "Only in %s: %s\n", p.new.display(filepath.Dir(fd.NewPath)), filepath.Base(fd.NewPath))
+		p.status = max(p.status, 1)
+		return
+	case fd.NewPath == "":
+		fmt.Fprintf(p.w, "Only in %s: %s\n", p.old.display(filepath.Dir(fd.OldPath)), filepath.Base(fd.OldPath))
+		p.status = max(p.status, 1)
+		return
+	}
+	switch fd.Status {
+	case vfs.DiffCommon:
+		fmt.Fprintf(p.w, "Common subdirectories: %s and %s\n", a, b)
+		return
+	case vfs.DiffMismatch:
+		fmt.Fprintf(p.w, "File %s is a %s while file %s is a %s\n", a, p.kind(fd.OldPath), b, p.kind(fd.NewPath))
+		p.status = max(p.status, 1)
+		return
+	case vfs.DiffBinary:
+		if p.f.Brief {
+			fmt.Fprintf(p.w, "Files %s and %s differ\n", a, b)
+		} else {
+			fmt.Fprintf(p.w, "Binary files %s and %s differ\n", a, b)
+		}
+		p.status = max(p.status, 1)
+		return
+	case vfs.DiffIdentical:
+		if p.f.format == sideBySide && !p.f.Brief {
+			// side by side shows the files even if they are the same
+			p.header(a, b)
+			p.sideBySide(fd)
+		}
+		if p.f.identical {
+			fmt.Fprintf(p.w, "Files %s and %s are identical\n", a, b)
+		}
+		return
+	}
+	p.status = max(p.status, 1)
+	if p.f.Brief {
+		fmt.Fprintf(p.w, "Files %s and %s differ\n", a, b)
+		return
+	}
+	p.header(a, b)
+	switch p.f.format {
+	case normal:
+		p.normal(fd.Hunks)
+	case copied:
+		p.names("***", "---", fd, "Mon Jan _2 15:04:05 2006")
+		p.copied(fd.Hunks)
+	case unified:
+		p.names("---", "+++", fd, "2006-01-02 15:04:05.000000000 -0700")
+		p.unified(fd.Hunks)
+	case sideBySide:
+		p.sideBySide(fd)
+	}
+}
+
+// header writes the "diff" line introducing the files of directories.
+func (p *printer) header(a, b string) {
+	if len(p.f.labels) > 0 {
+		a = p.f.labels[0]
+	}
+	if len(p.f.labels) > 1 {
+		b = p.f.labels[1]
+	}
+	if p.dirs {
+		fields := slices.DeleteFunc([]string{"diff", p.switches, a, b}, func(s string) bool { return s == "" })
+		fmt.Fprintln(p.w, strings.Join(fields, " "))
+	}
+}
+
+// kind returns the type of file as in the messages of diff.
+func (p *printer) kind(path string) string {
+	info, err := p.ws.Stat(path)
+	if err != nil {
+		return "file"
+	}
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode.IsRegular() && info.Size() == 0:
+		return "regular empty file"
+	case mode.IsRegular():
+		return "regular file"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character special file"
+	case mode&os.ModeDevice != 0:
+		return "block special file"
+	}
+	return "weird file"
+}
+
+// names writes the lines naming the files, with their modification
+// times in layout unless labels are given.
+func (p *printer) names(oldMark, newMark string, fd *vfs.FileDiff, layout string) {
+	label := func(i int, o operand, path string, missing bool) string {
+		if i < len(p.f.labels) {
+			return p.f.labels[i]
+		}
+		t := time.Now()
+		switch {
+		case missing:
+			t = time.Unix(0, 0)
+		case o.name != "-":
+			if info, err := p.ws.Stat(path); err == nil {
+				t = info.ModTime()
+			}
+		}
+		return o.display(path) + "\t" + t.Format(layout)
+	}
+	fmt.Fprintf(p.w, "%s %s\n", oldMark, label(0, p.old, fd.OldPath, fd.Status == vfs.DiffAdded))
+	fmt.Fprintf(p.w, "%s %s\n", newMark, label(1, p.new, fd.NewPath, fd.Status == vfs.DiffDeleted))
+}
+
+// line writes a line of a file after prefix.
+func (p *printer) line(prefix, text string) {
+	p.w.WriteString(prefix)
+	p.w.WriteString(text)
+	if !strings.HasSuffix(text, "\n") {
+		p.w.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// chunk is a run of common lines, or a change of the old lines into the
+// new ones.
+type chunk struct {
+	common   []string
+	old, new []string
+}
+
+// chunks splits a hunk into its common lines and changes, the old lines
+// of a change coming before the new ones.
+func chunks(h *vfs.DiffHunk) []*chunk {
+	var list []*chunk
+	var last *chunk
+	for _, l := range h.Lines {
+		change := l.Kind != ' '
+		if last == nil || change != (last.common == nil) {
+			last = &chunk{}
+			list = append(list, last)
+		}
+		switch l.Kind {
+		case ' ':
+			last.common = append(last.common, l.Text)
+		case '-':
+			last.old = append(last.old, l.Text)
+		case '+':
+			last.new = append(last.new, l.Text)
+		}
+	}
+	return list
+}
+
+// normal writes the hunks, without context, in the normal format.
+func (p *printer) normal(hunks []*vfs.DiffHunk) {
+	lines := func(start, n int) string {
+		if n == 1 {
+			return strconv.Itoa(start)
+		}
+		return fmt.Sprintf("%d,%d", start, start+n-1)
+	}
+	for _, h := range hunks {
+		switch {
+		case h.OldLines == 0:
+			fmt.Fprintf(p.w, "%da%s\n", h.OldStart-1, lines(h.NewStart, h.NewLines))
+		case h.NewLines == 0:
+			fmt.Fprintf(p.w, "%sd%d\n", lines(h.OldStart, h.OldLines), h.NewStart-1)
+		default:
+			fmt.Fprintf(p.w, "%sc%s\n", lines(h.OldStart, h.OldLines), lines(h.NewStart, h.NewLines))
+		}
+		for _, ch := range chunks(h) {
+			for _, l := range ch.old {
+				p.line("< ", l)
+			}
+			if ch.old != nil && ch.new != nil {
+				p.w.WriteString("---\n")
+			}
+			for _, l := range ch.new {
+				p.line("> ", l)
+			}
+		}
+	}
+}
+
+// unified writes the hunks in the unified format.
+func (p *printer) unified(hunks []*vfs.DiffHunk) {
+	for _, h := range hunks {
+		p.w.WriteString(h.Header())
+		p.w.WriteByte('\n')
+		for _, ch := range chunks(h) {
+			for _, l := range ch.common {
+				p.line(" ", l)
+			}
+			for _, l := range ch.old {
+				p.line("-", l)
+			}
+			for _, l := range ch.new {
+				p.line("+", l)
+			}
+		}
+	}
+}
+
+// copied writes the hunks in the context format, the old lines of a hunk
+// then the new ones.
+func (p *printer) copied(hunks []*vfs.DiffHunk) {
+	lines := func(start, n int) string {
+		switch n {
+		case 0:
+			return strconv.Itoa(start - 1)
+		case 1:
+			return strconv.Itoa(start)
+		}
+		return fmt.Sprintf("%d,%d", start, start+n-1)
+	}
+	side := func(chunks []*chunk, changed func(*chunk) []string, mark string) {
+		for _, ch := range chunks {
+			for _, l := range ch.common {
+				p.line("  ", l)
+			}
+			m := mark
+			if ch.old != nil && ch.new != nil {
+				m = "! "
+			}
+			for _, l := range changed(ch) {
+				p.line(m, l)
+			}
+		}
+	}
+	for _, h := range hunks {
+		list := chunks(h)
+		p.w.WriteString("***************\n")
+		fmt.Fprintf(p.w, "*** %s ****\n", lines(h.OldStart, h.OldLines))
+		if slices.ContainsFunc(list, func(ch *chunk) bool { return ch.old != nil }) {
+			side(list, func(ch *chunk) []string { return ch.old }, "- ")
+		}
+		fmt.Fprintf(p.w, "--- %s ----\n", lines(h.NewStart, h.NewLines))
+		if slices.ContainsFunc(list, func(ch *chunk) bool { return ch.new != nil }) {
+			side(list, func(ch *chunk) []string { return ch.new }, "+ ")
+		}
+	}
+}
+
+// sideBySide writes the files in two columns, marking the changed lines
+// with '|', the old lines with '<' and the new ones with '>'. Common
+// lines which are not equal, as with -i, are marked with '(' and ')'
+// when they do not pair up.
+func (p *printer) sideBySide(fd *vfs.FileDiff) {
+	a, errA := p.read(p.old, fd.OldPath, fd.Status == vfs.DiffAdded)
+	b, errB := p.read(p.new, fd.NewPath, fd.Status == vfs.DiffDeleted)
+	if err := cmp.Or(errA, errB); err != nil {
+		p.w.Flush()
+		fmt.Fprintf(p.Stderr, "diff: %v\n", p.cause(err))
+		p.status = 2
+		return
+	}
+
+	// the layout of GNU diff with tabs of 8 columns
+	off := (p.f.width + 8 + 3) / 16 * 8
+	s := &columns{w: p.w, half: max(0, min(off-3, p.f.width-off))}
+	s.col2 = p.f.width
+	if s.half != 0 {
+		s.col2 = off
+	}
+
+	next0, next1 := 0, 0
+	common := func(limit0, limit1 int) {
+		i0, i1 := next0, next1
+		next0, next1 = limit0, limit1
+		if p.f.suppress {
+			return
+		}
+		for ; i0 < limit0 && i1 < limit1; i0, i1 = i0+1, i1+1 {
+			s.line(a[i0], ' ', b[i1])
+		}
+		for ; i1 < limit1; i1++ {
+			s.line("", ')', b[i1])
+		}
+		for ; i0 < limit0; i0++ {
+			s.line(a[i0], '(', "")
+		}
+	}
+	for _, h := range fd.Hunks {
+		first0, first1 := h.OldStart-1, h.NewStart-1
+		common(first0, first1)
+		last0, last1 := first0+h.OldLines, first1+h.NewLines
+		for ; first0 < last0 && first1 < last1; first0, first1 = first0+1, first1+1 {
+			s.line(a[first0], '|', b[first1])
+		}
+		for ; first1 < last1; first1++ {
+			s.line("", '>', b[first1])
+		}
+		for ; first0 < last0; first0++ {
+			s.line(a[first0], '<', "")
+		}
+		next0, next1 = last0, last1
+	}
+	common(len(a), len(b))
+}
+
+// columns writes lines side by side.
+type columns struct {
+	w *bufio.Writer
+	// the width of a column and the offset of the second one
+	half, col2 int
+}
+
+// line writes a line of the output, left or right being missing for the
+// separators '>' and ')', or '<' and '('.
+func (s *columns) line(left string, sep byte, right string) {
+	hasLeft := sep != '>' && sep != ')'
+	hasRight := sep != '<' && sep != '('
+	newline := false
+	col := 0
+	if hasLeft {
+		newline = strings.HasSuffix(left, "\n")
+		col = s.text(left)
+	}
+	if sep != ' ' {
+		col = s.tab(col, (s.half+s.col2-1)/2) + 1
+		if sep == '|' && newline != strings.HasSuffix(right, "\n") {
+			sep = '\\'
+			if newline {
+				sep = '/'
+			}
+		}
+		s.w.WriteByte(sep)
+	}
+	if hasRight {
+		newline = newline || strings.HasSuffix(right, "\n")
+		if right != "" && right[0] != '\n' {
+			col = s.tab(col, s.col2)
+			s.text(right)
+		}
+	}
+	if newline {
+		s.w.WriteByte('\n')
+	}
+}
+
+// text writes as much of the line as fits in a column and returns the
+// column it ends at. Tabs are kept and stop every 8 columns.
+func (s *columns) text(line string) int {
+	in, out := 0, 0
+	for _, r := range line {
+		switch {
+		case r == '\n':
+			return out
+		case r == '\t':
+			spaces := 8 - in%8
+			if in == out && out+spaces < s.half {
+				out += spaces
+				s.w.WriteByte('\t')
+			}
+			in += spaces
+		case r == '\r':
+			s.w.WriteByte('\r')
+			in, out = 0, 0
+		case r == '\b':
+			if in == 0 {
+				break
+			}
+			if in--; in < s.half {
+				if out <= in {
+					for ; out < in; out++ {
+						s.w.WriteByte(' ')
+					}
+				} else {
+					out = in
+					s.w.WriteByte('\b')
+				}
+			}
+		case r < ' ' || r == 0x7f:
+			if in < s.half {
+				s.w.WriteRune(r)
+			}
+		default:
+			in += runeWidth(r)
+			if in <= s.half {
+				out = in
+				s.w.WriteRune(r)
+			}
+		}
+	}
+	return out
+}
+
+// runeWidth returns the number of columns of a printable rune.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// tab writes tabs and spaces from column from to column to.
+func (s *columns) tab(from, to int) int {
+	for t := from + 8 - from%8; t <= to; t += 8 {
+		s.w.WriteByte('\t')
+		from = t
+	}
+	for ; from < to; from++ {
+		s.w.WriteByte(' ')
+	}
+	return to
+}
@@ -0,0 +1,351 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+// setup creates the files in a workspace, names ending with a slash
+// being directories.
+func setup(t *testing.T, files map[string]string) (string, vfs.Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func runDiff(ws vfs.Workspace, dir, stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := New(ws)
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	cmd.SetWorkingDir(dir)
+	err := cmd.Run(args...)
+	var e *cli.ExitError
+	if errors.As(err, &e) && e.Err != nil {
+		// as the shell reports it
+		fmt.Fprintf(&stderr, "diff: %v\n", e.Err)
+	}
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+func exitCode(err error) int {
+	var e *cli.ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+var files = map[string]string{
+	"old":       "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+	"new":       "a\nB\nc\nd\ne\nf\ng\nh\nj\nk",
+	"w1":        "Hello  World\n\nx\n",
+	"w2":        "hello world \nx\n\n",
+	"t1":        "x\n\ty\n",
+	"t2":        "x\n\tz\n",
+	"d1/f":      "x\ny\n",
+	"d2/f":      "x\nz\n",
+	"d1/gone":   "q\n",
+	"d2/new":    "n\n",
+	"d1/only/":  "",
+	"d1/sub/g":  "s\n",
+	"d2/sub/g":  "t\n",
+	"d1/same":   "same\n",
+	"d2/same":   "same\n",
+	"d1/bin":    "bin\x00a",
+	"d2/bin":    "bin\x00b",
+	"d1/kind":   "",
+	"d2/kind/":  "",
+	"d2/empty/": "",
+}
+
+// The expected outputs are those of GNU diff.
+func TestDiff(t *testing.T) {
+	dir, ws := setup(t, files)
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+		code  int
+	}{
+		{
+			name: "normal",
+			args: []string{"old", "new"},
+			want: "2c2\n< b\n---\n> B\n9d8\n< i\n10a10\n> k\n\\ No newline at end of file\n",
+			code: 1,
+		},
+		{
+			name: "unified",
+			args: []string{"-u", "-L", "a", "-L", "b", "old", "new"},
+			want: "--- a\n+++ b\n@@ -1,10 +1,10 @@\n a\n-b\n+B\n c\n d\n e\n f\n g\n h\n-i\n j\n+k\n" +
+				"\\ No newline at end of file\n",
+			code: 1,
+		},
+		{
+			name: "unified without context",
+			args: []string{"-U0", "--label=a", "--label=b", "old", "new"},
+			want: "--- a\n+++ b\n@@ -2 +2 @@\n-b\n+B\n@@ -9 +8,0 @@\n-i\n@@ -10,0 +10 @@\n+k\n" +
+				"\\ No newline at end of file\n",
+			code: 1,
+		},
+		{
+			name: "largest context wins",
+			args: []string{"-u", "-U", "1", "-L", "a", "-L", "b", "old", "new"},
+			want: "--- a\n+++ b\n@@ -1,10 +1,10 @@\n a\n-b\n+B\n c\n d\n e\n f\n g\n h\n-i\n j\n+k\n" +
+				"\\ No newline at end of file\n",
+			code: 1,
+		},
+		{
+			name: "context",
+			args: []string{"-c", "-L", "a", "-L", "b", "old", "new"},
+			want: "*** a\n--- b\n***************\n*** 1,10 ****\n  a\n! b\n  c\n  d\n  e\n  f\n  g\n  h\n- i\n  j\n" +
+				"--- 1,10 ----\n  a\n! B\n  c\n  d\n  e\n  f\n  g\n  h\n  j\n+ k\n\\ No newline at end of file\n",
+			code: 1,
+		},
+		{
+			name: "context of one line",
+			args: []string{"-C1", "-L", "a", "-L", "b", "old", "new"},
+			want: "*** a\n--- b\n***************\n*** 1,3 ****\n  a\n! b\n  c\n--- 1,3 ----\n  a\n! B\n  c\n" +
+				"***************\n*** 8,10 ****\n  h\n- i\n  j\n--- 8,10 ----\n  h\n  j\n+ k\n" +
+				"\\ No newline at end of file\n",
+			code: 1,
+		},
+		{
+			name: "side by side",
+			args: []string{"-y", "-W", "40", "old", "new"},
+			want: "a\t\t\ta\nb\t\t   |\tB\nc\t\t\tc\nd\t\t\td\ne\t\t\te\nf\t\t\tf\ng\t\t\tg\nh\t\t\th\n" +
+				"i\t\t   <\nj\t\t\tj\n\t\t   >\tk",
+			code: 1,
+		},
+		{
+			name: "side by side without common lines",
+			args: []string{"-y", "-W", "40", "--suppress-common-lines", "old", "new"},
+			want: "b\t\t   |\tB\ni\t\t   <\n\t\t   >\tk",
+			code: 1,
+		},
+		{
+			name: "side by side narrow",
+			args: []string{"-yW20", "t1", "t2"},
+			want: "x\tx\n      |\t\n",
+			code: 1,
+		},
+		{
+			name: "side by side same files",
+			args: []string{"-y", "-W", "30", "d1/same", "d2/same"},
+			want: "same\t\tsame\n",
+		},
+		{
+			name: "side by side ignored blank lines",
+			args: []string{"-y", "-W", "30", "-B", "w1", "w2"},
+			want: "Hello  World  |\thello world \n\t      <\nx\t\tx\n\t      )\n",
+			code: 1,
+		},
+		{
+			name: "brief",
+			args: []string{"-q", "old", "new"},
+			want: "Files old and new differ\n",
+			code: 1,
+		},
+		{
+			name: "same",
+			args: []string{"old", "old"},
+		},
+		{
+			name: "report identical",
+			args: []string{"-s", "old", "old"},
+			want: "Files old and old are identical\n",
+		},
+		{
+			name: "ignore case",
+			args: []string{"-i", "w1", "w2"},
+			want: "1,2c1\n< Hello  World\n< \n---\n> hello world \n3a3\n> \n",
+			code: 1,
+		},
+		{
+			name: "ignore space change",
+			args: []string{"-ib", "w1", "w2"},
+			want: "2d1\n< \n3a3\n> \n",
+			code: 1,
+		},
+		{
+			name: "ignore blank lines",
+			args: []string{"-ibB", "w1", "w2"},
+		},
+		{
+			name: "ignore all space",
+			args: []string{"-w", "w1", "w2"},
+			want: "1,2c1\n< Hello  World\n< \n---\n> hello world \n3a3\n> \n",
+			code: 1,
+		},
+		{
+			name: "ignore all space and case",
+			args: []string{"-iwB", "w1", "w2"},
+		},
+		{
+			name:  "stdin",
+			args:  []string{"-", "t2"},
+			stdin: "x\n\ty\n",
+			want:  "2c2\n< \ty\n---\n> \tz\n",
+			code:  1,
+		},
+		{
+			name:  "stdin second",
+			args:  []string{"t1", "-"},
+			stdin: "x\n\ty\n",
+		},
+		{
+			name: "directory and file",
+			args: []string{"d1", "d2/f"},
+			want: "2c2\n< y\n---\n> z\n",
+			code: 1,
+		},
+		{
+			name: "directories",
+			args: []string{"d1", "d2"},
+			want: "Binary files d1/bin and d2/bin differ\n" +
+				"Only in d2: empty\n" +
+				"diff d1/f d2/f\n2c2\n< y\n---\n> z\n" +
+				"Only in d1: gone\n" +
+				"File d1/kind is a regular empty file while file d2/kind is a directory\n" +
+				"Only in d2: new\n" +
+				"Only in d1: only\n" +
+				"Common subdirectories: d1/sub and d2/sub\n",
+			code: 1,
+		},
+		{
+			name: "recursive",
+			args: []string{"-r", "d1", "d2"},
+			want: "Binary files d1/bin and d2/bin differ\n" +
+				"Only in d2: empty\n" +
+				"diff -r d1/f d2/f\n2c2\n< y\n---\n> z\n" +
+				"Only in d1: gone\n" +
+				"File d1/kind is a regular empty file while file d2/kind is a directory\n" +
+				"Only in d2: new\n" +
+				"Only in d1: only\n" +
+				"diff -r d1/sub/g d2/sub/g\n1c1\n< s\n---\n> t\n",
+			code: 1,
+		},
+		{
+			name: "recursive new files",
+			args: []string{"-rN", "d1", "d2"},
+			want: "Binary files d1/bin and d2/bin differ\n" +
+				"diff -rN d1/f d2/f\n2c2\n< y\n---\n> z\n" +
+				"diff -rN d1/gone d2/gone\n1d0\n< q\n" +
+				"File d1/kind is a regular empty file while file d2/kind is a directory\n" +
+				"diff -rN d1/new d2/new\n0a1\n> n\n" +
+				"diff -rN d1/sub/g d2/sub/g\n1c1\n< s\n---\n> t\n",
+			code: 1,
+		},
+		{
+			name: "recursive brief",
+			args: []string{"-rq", "d1/", "d2"},
+			want: "Files d1/bin and d2/bin differ\n" +
+				"Only in d2: empty\n" +
+				"Files d1/f and d2/f differ\n" +
+				"Only in d1/: gone\n" +
+				"File d1/kind is a regular empty file while file d2/kind is a directory\n" +
+				"Only in d2: new\n" +
+				"Only in d1/: only\n" +
+				"Files d1/sub/g and d2/sub/g differ\n",
+			code: 1,
+		},
+		{
+			name: "recursive labels",
+			args: []string{"-ru", "-L", "a", "-L", "b", "d1/sub", "d2/sub"},
+			want: "diff -ru -L a -L b a b\n--- a\n+++ b\n@@ -1 +1 @@\n-s\n+t\n",
+			code: 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runDiff(ws, dir, tt.stdin, tt.args...)
+			if stdout != tt.want || code != tt.code || stderr != "" {
+				t.Errorf("diff %q = %q, %q, %d, want %q, %d", tt.args, stdout, stderr, code, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestDiffTimes(t *testing.T) {
+	dir, ws := setup(t, map[string]string{"a": "x\n", "b": "y\n"})
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.Local)
+	for _, name := range []string{"a", "b"} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		args   []string
+		layout string
+		marks  [2]string
+		hunk   string
+	}{
+		{[]string{"-u", "a", "b"}, "2006-01-02 15:04:05.000000000 -0700", [2]string{"---", "+++"}, "@@ -1 +1 @@\n-x\n+y\n"},
+		{[]string{"-c", "a", "b"}, "Mon Jan _2 15:04:05 2006", [2]string{"***", "---"},
+			"***************\n*** 1 ****\n! x\n--- 1 ----\n! y\n"},
+	} {
+		stamp := mtime.Format(tt.layout)
+		want := tt.marks[0] + " a\t" + stamp + "\n" + tt.marks[1] + " b\t" + stamp + "\n" + tt.hunk
+		if stdout, stderr, code := runDiff(ws, dir, "", tt.args...); stdout != want || code != 1 {
+			t.Errorf("diff %q = %q, %q, %d, want %q, 1", tt.args, stdout, stderr, code, want)
+		}
+	}
+
+	// a missing file is empty with -N, from the epoch
+	epoch := time.Unix(0, 0).Format("2006-01-02 15:04:05.000000000 -0700")
+	want := "--- a\t" + mtime.Format("2006-01-02 15:04:05.000000000 -0700") + "\n+++ c\t" + epoch + "\n@@ -1 +0,0 @@\n-x\n"
+	if stdout, stderr, code := runDiff(ws, dir, "", "-Nu", "a", "c"); stdout != want || code != 1 {
+		t.Errorf("diff -Nu a c = %q, %q, %d, want %q, 1", stdout, stderr, code, want)
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	dir, ws := setup(t, map[string]string{"a": "x\n", "d/": ""})
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "diff: missing operand\n"},
+		{[]string{"a"}, "diff: missing operand after 'a'\n"},
+		{[]string{"a", "a", "b"}, "diff: extra operand 'b'\n"},
+		{[]string{"-u", "--normal", "a", "a"}, "diff: conflicting output style options\n"},
+		{[]string{"nofile", "a"}, "diff: nofile: no such file or directory\n"},
+		{[]string{"a", "d"}, "diff: d/a: no such file or directory\n"},
+		{[]string{"-", "d"}, "diff: cannot compare '-' to a directory\n"},
+	} {
+		stdout, stderr, code := runDiff(ws, dir, "", tt.args...)
+		if stdout != "" || stderr != tt.want || code != 2 {
+			t.Errorf("diff %q = %q, %q, %d, want %q, 2", tt.args, stdout, stderr, code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Expand converts tabs to spaces.
+//
+// Synopsis:
+//
+//	expand [OPTION]... [FILE]...
+//
+// Description:
+//
+//	Expand writes the files, or stdin, with TABs replaced by the spaces up
+//	to the next tab stop. Tab stops are every 8 columns by default.
+//
+//	LIST is a single number, the distance between tab stops, or a list of
+//	tab stop positions separated by commas or blanks. The last position
+//	may be prefixed by '/' to go on with stops at its multiples, or by '+'
+//	to go on with stops at that distance after the previous one. Past the
+//	last tab stop of a list a TAB is replaced by one space.
+//
+// Options:
+//
+//	-i, --initial:    only convert the TABs before the first non-blank
+//	-t, --tabs LIST:  use the tab stops of LIST instead of 8
+package expand
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the expand core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new expand command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	initial bool
+	tabs    []string
+}
+
+// listFlag collects repeated -t values.
+type listFlag struct {
+	values *[]string
+}
+
+func (l listFlag) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l listFlag) Set(s string) error {
+	*l.values = append(*l.values, s)
+	return nil
+}
+
+var obsoleteTabs = regexp.MustCompile(`^-[0-9][0-9,]*$`)
+
+// tabStops are the tab stop positions.
+type tabStops struct {
+	stops []int
+	// every, past the last stop, is the distance to the next multiple
+	// (slash) or to the previous stop
+	every int
+	slash bool
+}
+
+func parseTabs(lists []string) (*tabStops, error) {
+	t := &tabStops{}
+	for _, list := range lists {
+		for _, s := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if t.every > 0 {
+				return nil, fmt.Errorf("'%c' specifier only allowed with the last value", "+/"[b2i(t.slash)])
+			}
+			prefix := s[0]
+			if prefix == '/' || prefix == '+' {
+				s = s[1:]
+			}
+			n, err := strconv.Atoi(s)
+			if errors.Is(err, strconv.ErrRange) {
+				return nil, fmt.Errorf("tab stop is too large: '%s'", s)
+			}
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("tab size contains invalid character(s): '%s'", s)
+			}
+			switch prefix {
+			case '/', '+':
+				if n == 0 {
+					return nil, fmt.Errorf("'%c' specifier not at start of number: '%s'", prefix, s)
+				}
+				t.every, t.slash = n, prefix == '/'
+			default:
+				if n == 0 {
+					return nil, errors.New("tab size cannot be 0")
+				}
+				if k := len(t.stops); k > 0 && n <= t.stops[k-1] {
+					return nil, errors.New("tab sizes must be ascending")
+				}
+				t.stops = append(t.stops, n)
+			}
+		}
+	}
+	switch {
+	case len(t.stops) == 0 && t.every == 0:
+		t.every, t.slash = 8, true
+	case len(t.stops) == 1 && t.every == 0:
+		t.every, t.slash = t.stops[0], true
+		t.stops = nil
+	}
+	return t, nil
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// next returns the tab stop after the column, -1 past the last one or 0
+// if it overflows.
+func (t *tabStops) next(column int) int {
+	for _, s := range t.stops {
+		if s > column {
+			return s
+		}
+	}
+	if t.every == 0 {
+		return -1
+	}
+	if column > math.MaxInt-t.every {
+		return 0
+	}
+	if t.slash {
+		return column + t.every - column%t.every
+	}
+	last := 0
+	if k := len(t.stops); k > 0 {
+		last = t.stops[k-1]
+	}
+	return column + t.every - (column-last)%t.every
+}
+
+// expander replaces TABs.
+type expander struct {
+	w       *bufio.Writer
+	tabs    *tabStops
+	initial bool
+}
+
+func (e *expander) copy(ctx context.Context, r io.Reader) error {
+	br := bufio.NewReader(r)
+	column, leading := 0, true
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '\t' && (leading || !e.initial):
+			next := e.tabs.next(column)
+			if next < 0 {
+				next = column + 1
+			}
+			if next <= column {
+				return errors.New("input line is too long")
+			}
+			if err := e.pad(ctx, next-column); err != nil {
+				return err
+			}
+			column = next
+			continue
+		case c == '\b':
+			column = max(column-1, 0)
+		case c == '\n':
+			column, leading = 0, true
+		default:
+			column++
+			leading = leading && (c == ' ' || c == '\t')
+		}
+		e.w.WriteByte(c)
+	}
+}
+
+// spaces are written in chunks of this size, the gap to a tab stop may be
+// larger than memory.
+var spaces = strings.Repeat(" ", 256)
+
+// pad writes n spaces.
+func (e *expander) pad(ctx context.Context, n int) error {
+	for n > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		k := min(n, len(spaces))
+		if _, err := e.w.WriteString(spaces[:k]); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("expand", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.BoolVar(&f.initial, "i", false, "only convert the TABs before the first non-blank")
+	fs.BoolVar(&f.initial, "initial", false, "only convert the TABs before the first non-blank")
+	fs.Var(listFlag{&f.tabs}, "t", "use the tab stops of LIST instead of 8")
+	fs.Var(listFlag{&f.tabs}, "tabs", "use the tab stops of LIST instead of 8")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "expand [OPTION]... [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Expand converts tabs to spaces.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	args = append([]string(nil), args...)
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		if obsoleteTabs.MatchString(a) {
+			args[i] = "-t" + a[1:]
+		}
+	}
+	if err := fs.Parse(cli.Args(args, "t", "tabs")); err != nil {
+		return cli.Exit(1, err)
+	}
+	tabs, err := parseTabs(f.tabs)
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+
+	e := &expander{
+		w:       bufio.NewWriter(c.Stdout),
+		tabs:    tabs,
+		initial: f.initial,
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	failed := false
+	for _, name := range names {
+		r, err := cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+		if err != nil {
+			e.w.Flush()
+			fmt.Fprintf(c.Stderr, "expand: %v\n", err)
+			failed = true
+			continue
+		}
+		err = e.copy(ctx, r)
+		r.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			e.w.Flush()
+			fmt.Fprintf(c.Stderr, "expand: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if err := e.w.Flush(); err != nil {
+		return cli.Exit(1, err)
+	}
+	if failed {
+		return cli.Exit(1, nil)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package expand
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestExpand(t *testing.T) {
+	golden.Run(t, "expand", New)
+}
+
+func TestExpandLargeTabStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelWriter{limit: 1 << 20, cancel: cancel}
+	e := &expander{
+		w:    bufio.NewWriter(w),
+		tabs: &tabStops{every: 1_000_000_000_000, slash: true},
+	}
+	// the gap is written in chunks until the context is canceled
+	if err := e.copy(ctx, strings.NewReader("\tx\n")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+
+	e = &expander{
+		w:    bufio.NewWriter(io.Discard),
+		tabs: &tabStops{stops: []int{1}, every: math.MaxInt},
+	}
+	if err := e.copy(context.Background(), strings.NewReader("\t\tx\n")); err == nil || err.Error() != "input line is too long" {
+		t.Fatalf("error = %v, want input line is too long", err)
+	}
+}
+
+// cancelWriter cancels a context once limit bytes are written.
+type cancelWriter struct {
+	n, limit int
+	cancel   func()
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	if w.n >= w.limit {
+		w.cancel()
+	}
+	return len(p), nil
+}
@@ -0,0 +1,239 @@
+// Fold wraps lines to a width.
+//
+// Synopsis:
+//
+//	fold [OPTION]... [FILE]...
+//
+// Description:
+//
+//	Fold breaks the lines of the files, or of stdin, longer than the width
+//	in columns. A TAB advances to the next multiple of 8 columns, a
+//	backspace goes back one and a carriage return goes back to the first.
+//	The obsolete form -WIDTH is accepted.
+//
+// Options:
+//
+//	-b, --bytes:        count bytes rather than columns
+//	-s, --spaces:       break after the last blank within the width, if any
+//	-w, --width WIDTH:  use WIDTH columns instead of 80
+package fold
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the fold core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new fold command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	bytes  bool
+	spaces bool
+	width  int
+}
+
+var obsoleteWidth = regexp.MustCompile(`^-[0-9]+$`)
+
+// folder breaks lines.
+type folder struct {
+	w      *bufio.Writer
+	width  int
+	bytes  bool
+	spaces bool
+}
+
+// adjust returns the column after the character at the column.
+func (f *folder) adjust(column int, c byte) int {
+	if f.bytes {
+		return column + 1
+	}
+	switch c {
+	case '\b':
+		return max(column-1, 0)
+	case '\r':
+		return 0
+	case '\t':
+		return column + 8 - column%8
+	}
+	return column + 1
+}
+
+// next returns the length of the character at the start of s, a byte
+// with -b.
+func (f *folder) next(s string) int {
+	if f.bytes {
+		return 1
+	}
+	_, n := utf8.DecodeRuneInString(s)
+	return n
+}
+
+// fold writes the line, without its newline, broken to the width.
+func (f *folder) fold(line string) {
+	column, start := 0, 0
+	for i := 0; i < len(line); {
+		n := f.next(line[i:])
+		column = f.adjust(column, line[i])
+		if column <= f.width {
+			i += n
+			continue
+		}
+		if f.spaces {
+			if k := lastBlank(line[start:i]); k >= 0 {
+				// break after the blank and rescan the character
+				f.w.WriteString(line[start : start+k+1])
+				f.w.WriteByte('\n')
+				start += k + 1
+				column = 0
+				for j := start; j < i; j += f.next(line[j:]) {
+					column = f.adjust(column, line[j])
+				}
+				continue
+			}
+		}
+		if start == i {
+			// the character is wider than the width
+			i += n
+			continue
+		}
+		f.w.WriteString(line[start:i])
+		f.w.WriteByte('\n')
+		start, column = i, 0
+	}
+	f.w.WriteString(line[start:])
+}
+
+func lastBlank(s string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == ' ' || s[i] == '\t' {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *folder) copy(ctx context.Context, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := br.ReadString('\n')
+		if n := len(line); n > 0 && line[n-1] == '\n' {
+			f.fold(line[:n-1])
+			f.w.WriteByte('\n')
+		} else {
+			f.fold(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("fold", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.BoolVar(&f.bytes, "b", false, "count bytes rather than columns")
+	fs.BoolVar(&f.bytes, "bytes", false, "count bytes rather than columns")
+	fs.BoolVar(&f.spaces, "s", false, "break after the last blank within the width, if any")
+	fs.BoolVar(&f.spaces, "spaces", false, "break after the last blank within the width, if any")
+	fs.IntVar(&f.width, "w", 80, "use WIDTH columns instead of 80")
+	fs.IntVar(&f.width, "width", 80, "use WIDTH columns instead of 80")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "fold [OPTION]... [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Fold wraps lines to a width.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	args = append([]string(nil), args...)
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		if obsoleteWidth.MatchString(a) {
+			args[i] = "-w" + a[1:]
+		}
+	}
+	if err := fs.Parse(cli.Args(args, "w", "width")); err != nil {
+		return cli.Exit(1, err)
+	}
+	if f.width < 1 {
+		return cli.Exit(1, fmt.Errorf("invalid number of columns: '%d'", f.width))
+	}
+
+	fd := &folder{
+		w:      bufio.NewWriter(c.Stdout),
+		width:  f.width,
+		bytes:  f.bytes,
+		spaces: f.spaces,
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	failed := false
+	for _, name := range names {
+		r, err := cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+		if err != nil {
+			fd.w.Flush()
+			fmt.Fprintf(c.Stderr, "fold: %v\n", err)
+			failed = true
+			continue
+		}
+		err = fd.copy(ctx, r)
+		r.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fd.w.Flush()
+			fmt.Fprintf(c.Stderr, "fold: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if err := fd.w.Flush(); err != nil {
+		return cli.Exit(1, err)
+	}
+	if failed {
+		return cli.Exit(1, nil)
+	}
+	return nil
+}
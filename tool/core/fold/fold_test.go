@@ -0,0 +1,11 @@
+package fold
+
+import (
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestFold(t *testing.T) {
+	golden.Run(t, "fold", New)
+}
@@ -2,262 +2,833 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// grep searches file contents using regular expressions.
+// Package grep implements the grep core utility.
 //
 // Synopsis:
 //
-//	grep [-clFivnhqre] [FILE]...
+//	grep [OPTION]... PATTERNS [FILE]...
+//	grep [OPTION]... -e PATTERNS ... [FILE]...
+//	grep [OPTION]... -f PATTERN_FILE ... [FILE]...
+//
+// Description:
+//
+//	Search the files, or stdin if there is none or the file is -, for the
+//	lines matching the patterns. The exit status is 0 if a line is
+//	selected, 1 if none is and 2 if an error occurred.
 //
 // Options:
 //
-//  -c, --count                Just show counts
-//  -l, --files-with-matches   list only files
-//  -F, --fixed-strings        Match using fixed strings
-//  -i, --ignore-case          case-insensitive matching
-//  -v, --invert-match         Print only non-matching lines
-//  -n, --line-number          Show line numbers
-//  -h, --no-filename          Suppress file name prefixes on output
-//  -q, --quiet                Don't print matches; exit on first match
-//  -r, --recursive            recursive
-//  -e, --regexp string        Pattern to match
-
-package main
+//	-E, --extended-regexp      PATTERNS are extended regular expressions
+//	-F, --fixed-strings        PATTERNS are strings
+//	-G, --basic-regexp         PATTERNS are basic regular expressions (default)
+//	-P, --perl-regexp          PATTERNS are Perl regular expressions
+//	-e, --regexp=PATTERNS      use PATTERNS for matching
+//	-f, --file=FILE            take PATTERNS from FILE
+//	-i, --ignore-case          ignore case distinctions
+//	-w, --word-regexp          match only whole words
+//	-x, --line-regexp          match only whole lines
+//	-v, --invert-match         select non-matching lines
+//	-m, --max-count=NUM        stop after NUM selected lines
+//	-b, --byte-offset          print the byte offset with output lines
+//	-n, --line-number          print line number with output lines
+//	-H, --with-filename        print file name with output lines
+//	-h, --no-filename          suppress the file name prefix on output
+//	    --label=LABEL          use LABEL as the standard input file name
+//	-o, --only-matching        show only nonempty parts of lines that match
+//	-q, --quiet, --silent      suppress all normal output
+//	-s, --no-messages          suppress error messages
+//	-a, --text                 equivalent to --binary-files=text
+//	-I                         equivalent to --binary-files=without-match
+//	    --binary-files=TYPE    binary, text or without-match
+//	-r, --recursive            search directories recursively
+//	-R, --dereference-recursive  likewise, following all symlinks
+//	    --include=GLOB         search only files that match GLOB
+//	    --exclude=GLOB         skip files that match GLOB
+//	    --exclude-dir=GLOB     skip directories that match GLOB
+//	-L, --files-without-match  print only names of files with no selected lines
+//	-l, --files-with-matches   print only names of files with selected lines
+//	-c, --count                print only a count of selected lines per file
+//	-Z, --null                 print 0 byte after file name
+//	-z, --null-data            a data line ends in 0 byte, not newline
+//	-A, --after-context=NUM    print NUM lines of trailing context
+//	-B, --before-context=NUM   print NUM lines of leading context
+//	-C, --context=NUM, -NUM    print NUM lines of output context
+//	    --color[=WHEN]         use markers to highlight the matching strings;
+//	                           WHEN is always, never, or auto (default)
+package grep
 
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
-	"path/filepath"
-	"regexp"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 
-	"github.com/u-root/u-root/pkg/uroot/unixflag"
+	"github.com/u-root/u-root/pkg/core"
+	"golang.org/x/term"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
 )
 
-var errQuiet = fmt.Errorf("not found")
+// binarySniff is how much of a file is checked for NUL bytes to tell
+// whether it is binary.
+const binarySniff = 32 * 1024
 
-type params struct {
-	expr string
-	headers, invert, recursive, caseInsensitive, fixed,
-	noShowMatch, quiet, count, number bool
+var errUsage = errors.New("usage: grep [OPTION]... PATTERNS [FILE]...")
+
+// command implements the grep core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
 }
 
-type grepCommand struct {
-	rc   io.ReadCloser
-	name string
+// New creates a new grep command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
 }
 
-// run runs a command. args are as from os.Args, i.e., args[0] is the command name.
-func run(stdin io.ReadCloser, stdout io.Writer, stderr io.Writer, args []string) error {
-	var c cmd
+type params struct {
+	patterns     []string
+	patternFiles []string
+	syntax       syntax
+	ignoreCase, word, line, invert,
+	count, list, listMissing, quiet, noMessages, only,
+	number, byteOffset, nullName, nullData, lineBuffered bool
+	// -1 unless set
+	withFilename int
+	maxCount     int
+	after        int
+	before       int
+	context      int
+	recursive    bool
+	dereference  bool
+	binaryFiles  string
+	label        string
+	include      []string
+	exclude      []string
+	excludeDir   []string
+	color        string
+}
 
-	f := flag.NewFlagSet(args[0], flag.ExitOnError)
-	f.StringVar(&c.params.expr, "regexp", "", "Pattern to match")
-	f.StringVar(&c.expr, "e", "", "Pattern to match (shorthand)")
+// listFlag collects the values of an option given several times.
+type listFlag []string
 
-	f.BoolVar(&c.params.headers, "no-filename", false, "Suppress file name prefixes on output")
-	f.BoolVar(&c.params.headers, "h", false, "Suppress file name prefixes on output (shorthand)")
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
 
-	f.BoolVar(&c.params.invert, "invert-match", false, "Print only non-matching lines")
-	f.BoolVar(&c.params.invert, "v", false, "Print only non-matching lines (shorthand)")
+// valueFlag sets a variable to a value when the option is given.
+type valueFlag[T any] struct {
+	p *T
+	v T
+}
 
-	f.BoolVar(&c.params.recursive, "recursive", false, "recursive")
-	f.BoolVar(&c.params.recursive, "r", false, "recursive")
+func (f valueFlag[T]) IsBoolFlag() bool { return true }
+func (f valueFlag[T]) String() string   { return "" }
 
-	f.BoolVar(&c.params.noShowMatch, "files-with-matches", false, "list only files")
-	f.BoolVar(&c.params.noShowMatch, "l", false, "list only files (shorthand)")
+func (f valueFlag[T]) Set(s string) error {
+	if s != "true" {
+		return fmt.Errorf("option does not take a value")
+	}
+	*f.p = f.v
+	return nil
+}
 
-	f.BoolVar(&c.params.count, "count", false, "Just show counts")
-	f.BoolVar(&c.params.count, "c", false, "Just show counts")
+// colorFlag is --color[=WHEN].
+type colorFlag struct{ p *string }
 
-	f.BoolVar(&c.params.caseInsensitive, "ignore-case", false, "case-insensitive matching")
-	f.BoolVar(&c.params.caseInsensitive, "i", false, "case-insensitive matching (shorthand)")
+func (f colorFlag) IsBoolFlag() bool { return true }
+func (f colorFlag) String() string   { return "" }
 
-	f.BoolVar(&c.params.number, "line-number", false, "Show line numbers")
-	f.BoolVar(&c.params.number, "n", false, "Show line numbers (shorthand)")
+func (f colorFlag) Set(s string) error {
+	switch s {
+	case "true", "auto", "tty", "if-tty":
+		*f.p = "auto"
+	case "always", "yes", "force":
+		*f.p = "always"
+	case "never", "no", "none":
+		*f.p = "never"
+	default:
+		return fmt.Errorf("invalid argument '%s' for '--color'", s)
+	}
+	return nil
+}
 
-	f.BoolVar(&c.params.fixed, "fixed-strings", false, "Match using fixed strings")
-	f.BoolVar(&c.params.fixed, "F", false, "Match using fixed strings (shorthand)")
+// valued lists the options taking a value.
+var valued = []string{
+	"e", "regexp", "f", "file", "m", "max-count", "A", "after-context", "B", "before-context",
+	"C", "context", "label", "include", "exclude", "exclude-dir", "binary-files",
+}
 
-	f.BoolVar(&c.params.quiet, "quiet", false, "Don't print matches; exit on first match")
-	f.BoolVar(&c.params.quiet, "q", false, "Don't print matches; exit on first match (shorthand)")
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
 
-	f.BoolVar(&c.params.quiet, "silent", false, "Don't print matches; exit on first match")
-	f.BoolVar(&c.params.quiet, "s", false, "Don't print matches; exit on first match (shorthand)")
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	p := params{
+		withFilename: -1,
+		maxCount:     -1,
+		after:        -1,
+		before:       -1,
+		context:      -1,
+		binaryFiles:  "binary",
+		color:        "auto",
+	}
+
+	f := flag.NewFlagSet("grep", flag.ContinueOnError)
+	f.SetOutput(c.Stderr)
+
+	var patterns, patternFiles listFlag
+	for _, name := range []string{"e", "regexp"} {
+		f.Var(&patterns, name, "use `PATTERNS` for matching")
+	}
+	for _, name := range []string{"f", "file"} {
+		f.Var(&patternFiles, name, "take PATTERNS from `FILE`")
+	}
+	for _, s := range []struct {
+		names string
+		syn   syntax
+		usage string
+	}{
+		{"E extended-regexp", extended, "PATTERNS are extended regular expressions"},
+		{"F fixed-strings", fixed, "PATTERNS are strings"},
+		{"G basic-regexp", basic, "PATTERNS are basic regular expressions"},
+		{"P perl-regexp", perl, "PATTERNS are Perl regular expressions"},
+	} {
+		for _, name := range strings.Fields(s.names) {
+			f.Var(valueFlag[syntax]{&p.syntax, s.syn}, name, s.usage)
+		}
+	}
+	boolVar := func(v *bool, names, usage string) {
+		for _, name := range strings.Fields(names) {
+			f.BoolVar(v, name, false, usage)
+		}
+	}
+	intVar := func(v *int, names, usage string) {
+		for _, name := range strings.Fields(names) {
+			f.IntVar(v, name, *v, usage)
+		}
+	}
+	boolVar(&p.ignoreCase, "i ignore-case", "ignore case distinctions in patterns and data")
+	f.Var(valueFlag[bool]{&p.ignoreCase, false}, "no-ignore-case", "do not ignore case distinctions (default)")
+	boolVar(&p.word, "w word-regexp", "match only whole words")
+	boolVar(&p.line, "x line-regexp", "match only whole lines")
+	boolVar(&p.invert, "v invert-match", "select non-matching lines")
+	intVar(&p.maxCount, "m max-count", "stop after `NUM` selected lines")
+	boolVar(&p.byteOffset, "b byte-offset", "print the byte offset with output lines")
+	boolVar(&p.number, "n line-number", "print line number with output lines")
+	boolVar(&p.lineBuffered, "line-buffered", "flush output on every line")
+	f.Var(valueFlag[int]{&p.withFilename, 1}, "H", "print file name with output lines")
+	f.Var(valueFlag[int]{&p.withFilename, 1}, "with-filename", "print file name with output lines")
+	f.Var(valueFlag[int]{&p.withFilename, 0}, "h", "suppress the file name prefix on output")
+	f.Var(valueFlag[int]{&p.withFilename, 0}, "no-filename", "suppress the file name prefix on output")
+	f.StringVar(&p.label, "label", "(standard input)", "use `LABEL` as the standard input file name")
+	boolVar(&p.only, "o only-matching", "show only nonempty parts of lines that match")
+	boolVar(&p.quiet, "q quiet silent", "suppress all normal output")
+	boolVar(&p.noMessages, "s no-messages", "suppress error messages")
+	f.StringVar(&p.binaryFiles, "binary-files", "binary", "assume that binary files are `TYPE`: binary, text or without-match")
+	f.Var(valueFlag[string]{&p.binaryFiles, "text"}, "a", "equivalent to --binary-files=text")
+	f.Var(valueFlag[string]{&p.binaryFiles, "text"}, "text", "equivalent to --binary-files=text")
+	f.Var(valueFlag[string]{&p.binaryFiles, "without-match"}, "I", "equivalent to --binary-files=without-match")
+	boolVar(&p.recursive, "r recursive", "search directories recursively")
+	boolVar(&p.dereference, "R dereference-recursive", "likewise, but follow all symlinks")
+	f.Var((*listFlag)(&p.include), "include", "search only files that match `GLOB`")
+	f.Var((*listFlag)(&p.exclude), "exclude", "skip files that match `GLOB`")
+	f.Var((*listFlag)(&p.excludeDir), "exclude-dir", "skip directories that match `GLOB`")
+	boolVar(&p.listMissing, "L files-without-match", "print only names of files with no selected lines")
+	boolVar(&p.list, "l files-with-matches", "print only names of files with selected lines")
+	boolVar(&p.count, "c count", "print only a count of selected lines per file")
+	boolVar(&p.nullName, "Z null", "print 0 byte after file name")
+	boolVar(&p.nullData, "z null-data", "a data line ends in 0 byte, not newline")
+	intVar(&p.after, "A after-context", "print `NUM` lines of trailing context")
+	intVar(&p.before, "B before-context", "print `NUM` lines of leading context")
+	intVar(&p.context, "C context", "print `NUM` lines of output context")
+	f.Var(colorFlag{&p.color}, "color", "highlight the matches when `WHEN` is always, never or auto")
+	f.Var(colorFlag{&p.color}, "colour", "highlight the matches when `WHEN` is always, never or auto")
 
 	f.Usage = func() {
-		fmt.Fprint(f.Output(), "Usage: grep [-clFivnhqre] [FILE]...\n\n")
+		fmt.Fprint(f.Output(), "Usage: grep [OPTION]... PATTERNS [FILE]...\n\n")
+		fmt.Fprint(f.Output(), "Search for PATTERNS in each FILE.\n")
+		fmt.Fprint(f.Output(), "Options:\n")
 		f.PrintDefaults()
 	}
 
-	f.Parse(unixflag.ArgsToGoArgs(args[1:]))
+	if err := f.Parse(cli.Args(contextArgs(args), valued...)); err != nil {
+		return cli.Exit(2, err)
+	}
+	if p.dereference {
+		p.recursive = true
+	}
+	switch p.binaryFiles {
+	case "binary", "text", "without-match":
+	default:
+		return cli.Exit(2, fmt.Errorf("invalid argument '%s' for '--binary-files'", p.binaryFiles))
+	}
+	if p.after < -1 || p.before < -1 || p.context < -1 {
+		return cli.Exit(2, fmt.Errorf("invalid context length argument"))
+	}
+	if p.context >= 0 {
+		if p.after < 0 {
+			p.after = p.context
+		}
+		if p.before < 0 {
+			p.before = p.context
+		}
+	}
+	p.after, p.before = max(p.after, 0), max(p.before, 0)
 
-	c.args = f.Args()
-	c.stdin = stdin
-	c.stdout = bufio.NewWriter(stdout)
-	c.stderr = stderr
+	operands := f.Args()
+	for _, e := range patterns {
+		p.patterns = append(p.patterns, strings.Split(e, "\n")...)
+	}
+	p.patternFiles = patternFiles
+	if len(patterns) == 0 && len(patternFiles) == 0 {
+		if len(operands) == 0 {
+			return cli.Exit(2, errUsage)
+		}
+		p.patterns = strings.Split(operands[0], "\n")
+		operands = operands[1:]
+	}
 
-	return c.run()
+	g := &grep{
+		c:      c,
+		ctx:    ctx,
+		params: p,
+	}
+	if err := g.compile(); err != nil {
+		return cli.Exit(2, err)
+	}
+	return g.run(operands)
 }
 
-func main() {
-	if err := run(os.Stdin, os.Stdout, os.Stderr, os.Args); err != nil {
-		if err == errQuiet {
-			os.Exit(1)
+// contextArgs turns the -NUM context options into -C NUM.
+func contextArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(out, args[i:]...)
+		}
+		if len(a) > 1 && a[0] == '-' && strings.Trim(a[1:], "0123456789") == "" {
+			out = append(out, "-C", a[1:])
+			continue
+		}
+		out = append(out, a)
+		// skip the value of an option
+		name := strings.TrimLeft(a, "-")
+		if strings.HasPrefix(a, "-") && !strings.Contains(a, "=") && i+1 < len(args) {
+			if slices.Contains(valued, name) && (strings.HasPrefix(a, "--") || len(name) == 1) {
+				i++
+				out = append(out, args[i])
+			}
 		}
-		log.Fatal(err)
 	}
+	return out
+}
+
+// colors of the output, as in GREP_COLORS
+type colors struct {
+	selected, context, filename, lineNumber, byteOffset, separator string
 }
 
-// cmd contains the actually business logic of grep
-type cmd struct {
-	stdin  io.ReadCloser
-	stdout *bufio.Writer
-	stderr io.Writer
-	args   []string
+func defaultColors() *colors {
+	return &colors{
+		selected:   "01;31",
+		context:    "01;31",
+		filename:   "35",
+		lineNumber: "32",
+		byteOffset: "32",
+		separator:  "36",
+	}
+}
+
+// parse applies the GREP_COLORS capabilities, such as "ms=01;32:fn=34".
+func (cs *colors) parse(s string) {
+	for _, kv := range strings.Split(s, ":") {
+		k, v, _ := strings.Cut(kv, "=")
+		switch k {
+		case "mt":
+			cs.selected, cs.context = v, v
+		case "ms":
+			cs.selected = v
+		case "mc":
+			cs.context = v
+		case "fn":
+			cs.filename = v
+		case "ln":
+			cs.lineNumber = v
+		case "bn":
+			cs.byteOffset = v
+		case "se":
+			cs.separator = v
+		}
+	}
+}
+
+// grep is a search of files.
+type grep struct {
+	c   *command
+	ctx context.Context
 	params
-	matchCount int
-	showName   bool
+
+	m *matcher
+	// of the output, empty when not colored
+	colors *colors
+	out    *bufio.Writer
+	// end of data lines
+	eol byte
+	// print the file names
+	names bool
+
+	// some line was selected, some error occurred
+	matched, failed bool
+	// some output line has been printed, to separate context groups
+	printed bool
 }
 
-// grep reads data from the os.File embedded in grepCommand.
-// It matches each line against the re and prints the matching result
-// If we are only looking for a match, we exit as soon as the condition is met.
-// "match" means result of re.Match == match flag.
-func (c *cmd) grep(f *grepCommand, re *regexp.Regexp) (ok bool) {
-	r := bufio.NewScanner(f.rc)
-	defer f.rc.Close()
-	var lineNum int
-	for r.Scan() {
-		line := r.Text()
-		var m bool
-		switch {
-		case c.fixed && c.caseInsensitive:
-			m = strings.Contains(strings.ToLower(line), strings.ToLower(c.expr))
-		case c.fixed && !c.caseInsensitive:
-			m = strings.Contains(line, c.expr)
-		default:
-			m = re.MatchString(line)
-		}
-		if m != c.invert {
-			// in quiet mode, exit before the first match
-			if c.quiet {
-				return false
-			}
-			c.printMatch(f, line, lineNum+1, m)
-			if c.noShowMatch {
-				break
-			}
+func (g *grep) compile() error {
+	for _, name := range g.patternFiles {
+		var data []byte
+		var err error
+		if name == "-" {
+			data, err = io.ReadAll(g.c.Stdin)
+		} else {
+			data, err = fs.ReadFile(g.c.f, g.c.ResolvePath(name))
+		}
+		if err != nil {
+			return err
 		}
-		lineNum++
+		if len(data) > 0 {
+			g.patterns = append(g.patterns, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")...)
+		}
+	}
+	m, err := newMatcher(g.patterns, g.syntax, g.ignoreCase, g.word, g.line)
+	if err != nil {
+		return err
 	}
-	c.stdout.Flush()
-	return true
+	g.m = m
+	return nil
 }
 
-func (c *cmd) printMatch(cmd *grepCommand, line string, lineNum int, match bool) {
-	if match == !c.invert {
-		c.matchCount++
+func (g *grep) run(operands []string) error {
+	g.eol = '\n'
+	if g.nullData {
+		g.eol = 0
 	}
-	if c.count {
-		return
+	g.colors = &colors{}
+	switch g.color {
+	case "always":
+		g.colors = defaultColors()
+	case "auto":
+		if f, ok := g.c.Stdout.(*os.File); ok && term.IsTerminal(int(f.Fd())) && g.c.Getenv("TERM") != "dumb" {
+			g.colors = defaultColors()
+		}
 	}
-	// at this point, we have committed to writing a line
-	defer func() {
-		c.stdout.WriteByte('\n')
-	}()
-	// if showName, write name to stdout
-	if c.showName {
-		c.stdout.WriteString(cmd.name)
+	if g.color != "never" && g.colors.selected != "" {
+		g.colors.parse(g.c.Getenv("GREP_COLORS"))
+	}
+
+	g.out = bufio.NewWriter(g.c.Stdout)
+	defer g.out.Flush()
+
+	if len(operands) == 0 {
+		if g.recursive {
+			operands = []string{""}
+		} else {
+			operands = []string{"-"}
+		}
+	}
+	// file names are printed for several operands and, unless set, in
+	// directories searched recursively
+	g.names = len(operands) > 1
+	if g.withFilename >= 0 {
+		g.names = g.withFilename == 1
+	}
+
+	for _, name := range operands {
+		if g.search(name) {
+			break
+		}
 	}
-	// if dont show match, then newline and return, we are done
-	if c.noShowMatch {
+
+	switch {
+	case g.matched && (g.quiet || !g.failed):
+		return nil
+	case g.failed:
+		return cli.Exit(2, nil)
+	default:
+		return cli.Exit(1, nil)
+	}
+}
+
+// warn reports an error unless messages are suppressed.
+func (g *grep) warn(name string, err error) {
+	g.failed = true
+	if g.noMessages {
 		return
 	}
-	if match == !c.invert {
-		// if showName, need a :
-		if c.showName {
-			c.stdout.WriteByte(':')
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	g.out.Flush()
+	fmt.Fprintf(g.c.Stderr, "grep: %s: %v\n", name, err)
+}
+
+// search searches the operand, the current directory if empty. It
+// returns true when the search is over.
+func (g *grep) search(name string) bool {
+	if name == "-" {
+		if g.c.Stdin == nil {
+			return g.searchReader(bytes.NewReader(nil), g.label)
 		}
-		// if showing line number, print the line number then a :
-		if c.number {
-			c.stdout.Write(strconv.AppendUint(nil, uint64(lineNum), 10))
-			c.stdout.WriteByte(':')
+		return g.searchReader(g.c.Stdin, g.label)
+	}
+	fsName := g.c.ResolvePath(name)
+	if name == "" {
+		fsName = g.c.ResolvePath(".")
+	}
+	info, err := fs.Stat(g.c.f, fsName)
+	if err != nil {
+		g.warn(name, err)
+		return false
+	}
+	if info.IsDir() {
+		if !g.recursive {
+			g.warn(name, errors.New("Is a directory"))
+			return false
 		}
-		// now write the line to stdout
-		c.stdout.WriteString(line)
+		return g.searchDir(fsName, name)
 	}
+	if !g.included(name, false) {
+		return false
+	}
+	return g.searchFile(fsName, name)
 }
 
-func (c *cmd) run() error {
-	defer c.stdout.Flush()
-	// parse the expression into valid regex
-	if c.expr != "" {
-		c.args = append([]string{c.expr}, c.args...)
+// included reports whether the file or directory is to be searched.
+func (g *grep) included(name string, dir bool) bool {
+	base := path.Base(name)
+	matches := func(globs []string) bool {
+		for _, glob := range globs {
+			if ok, _ := path.Match(glob, base); ok {
+				return true
+			}
+			if ok, _ := path.Match(glob, name); ok {
+				return true
+			}
+		}
+		return false
 	}
-	r := ".*"
-	if len(c.args) > 0 {
-		r = c.args[0]
+	if dir {
+		return !matches(g.excludeDir)
 	}
-	if c.caseInsensitive && !bytes.HasPrefix([]byte(r), []byte("(?i)")) && !c.fixed {
-		r = "(?i)" + r
+	if name == "" {
+		return true
 	}
-	var re *regexp.Regexp
-	if !c.fixed {
-		re = regexp.MustCompile(r)
-	} else if c.expr == "" {
-		c.expr = c.args[0]
+	if matches(g.exclude) {
+		return false
 	}
+	return len(g.include) == 0 || matches(g.include)
+}
 
-	// if len(c.args) < 2, then we read from stdin
-	if len(c.args) < 2 {
-		if !c.grep(&grepCommand{c.stdin, "<stdin>"}, re) {
-			return nil
+// searchDir searches the files of the directory and, recursively, of
+// its subdirectories. Symbolic links are only followed with -R.
+func (g *grep) searchDir(fsName, name string) bool {
+	entries, err := fs.ReadDir(g.c.f, fsName)
+	if err != nil {
+		g.warn(name, err)
+		return false
+	}
+	if g.withFilename < 0 {
+		g.names = true
+	}
+	for _, d := range entries {
+		if g.ctx.Err() != nil {
+			g.failed = true
+			return true
 		}
-	} else {
-		c.showName = (len(c.args[1:]) > 1 || c.recursive || c.noShowMatch) && !c.headers
-		var ok bool
-		for _, v := range c.args[1:] {
-			err := filepath.Walk(v, func(name string, fi os.FileInfo, err error) error {
-				if err != nil {
-					fmt.Fprintf(c.stderr, "grep: %v: %v\n", name, err)
-					return nil
-				}
-				if fi.IsDir() && !c.recursive {
-					fmt.Fprintf(c.stderr, "grep: %v: Is a directory\n", name)
-					return filepath.SkipDir
-				}
-				fp, err := os.Open(name)
-				if err != nil {
-					fmt.Fprintf(c.stderr, "can't open %s: %v\n", name, err)
-					return nil
-				}
-				defer fp.Close()
-				if !c.grep(&grepCommand{fp, name}, re) {
-					ok = true
-					return nil
-				}
-				return nil
-			})
-			if ok {
-				return nil
+		child := d.Name()
+		if name != "" {
+			child = strings.TrimSuffix(name, "/") + "/" + d.Name()
+		}
+		fsChild := path.Join(fsName, d.Name())
+		isDir := d.IsDir()
+		if d.Type()&fs.ModeSymlink != 0 {
+			if !g.dereference {
+				continue
 			}
+			info, err := fs.Stat(g.c.f, fsChild)
 			if err != nil {
-				return err
+				g.warn(child, err)
+				continue
+			}
+			isDir = info.IsDir()
+		} else if !isDir && !d.Type().IsRegular() {
+			// devices, pipes and sockets
+			continue
+		}
+
+		var done bool
+		if isDir {
+			if g.included(child, true) {
+				done = g.searchDir(fsChild, child)
 			}
+		} else if g.included(child, false) {
+			done = g.searchFile(fsChild, child)
+		}
+		if done {
+			return true
 		}
 	}
-	if c.quiet {
-		return errQuiet
+	return false
+}
+
+func (g *grep) searchFile(fsName, name string) bool {
+	f, err := g.c.f.Open(fsName)
+	if err != nil {
+		g.warn(name, err)
+		return false
 	}
-	if c.count {
-		c.stdout.Write(strconv.AppendUint(nil, uint64(c.matchCount), 10))
-		c.stdout.WriteByte('\n')
+	defer f.Close()
+	return g.searchReader(f, name)
+}
+
+// searchReader searches the lines of the reader. It returns true when the
+// search is over.
+func (g *grep) searchReader(r io.Reader, name string) bool {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	binary := false
+	if g.binaryFiles != "text" {
+		head, err := br.Peek(binarySniff)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			g.warn(name, err)
+			return false
+		}
+		binary = !g.nullData && bytes.IndexByte(head, 0) >= 0
+		if binary && g.binaryFiles == "without-match" {
+			return false
+		}
+	}
+	// only the matches and the counts of binary files are reported
+	listing := g.quiet || g.list || g.listMissing || g.count
+
+	var (
+		count     int
+		offset    int64
+		lastShown int // number of the last line printed
+		afterLeft int
+		before    []contextLine
+	)
+	limit := g.maxCount
+	for lineno := 1; ; lineno++ {
+		if lineno%1024 == 0 && g.ctx.Err() != nil {
+			g.failed = true
+			return true
+		}
+		data, err := br.ReadBytes(g.eol)
+		if len(data) == 0 && err != nil {
+			if err != io.EOF {
+				g.warn(name, err)
+			}
+			break
+		}
+		line := bytes.TrimSuffix(data, []byte{g.eol})
+		lineOffset := offset
+		offset += int64(len(data))
+
+		if limit >= 0 && count >= limit {
+			// trailing context after the last selected line
+			if afterLeft == 0 || listing || binary {
+				break
+			}
+			g.printLine(name, lineno, lineOffset, line, false)
+			lastShown = lineno
+			afterLeft--
+			continue
+		}
+
+		if g.m.match(line) == g.invert {
+			if afterLeft > 0 && !listing && !binary {
+				g.printLine(name, lineno, lineOffset, line, false)
+				lastShown = lineno
+				afterLeft--
+			} else if g.before > 0 {
+				if len(before) == g.before {
+					before = before[1:]
+				}
+				before = append(before, contextLine{lineno, lineOffset, bytes.Clone(line)})
+			}
+			continue
+		}
+
+		count++
+		if !g.listMissing {
+			g.matched = true
+		}
+		if g.quiet {
+			return true
+		}
+		if listing {
+			if g.list || g.listMissing {
+				break
+			}
+			continue
+		}
+		if binary {
+			g.out.Flush()
+			fmt.Fprintf(g.c.Stderr, "grep: %s: binary file matches\n", name)
+			break
+		}
+
+		first := lineno - len(before)
+		if (g.before > 0 || g.after > 0) && g.printed && (lastShown == 0 || first > lastShown+1) {
+			g.writeColored("--", g.colors.separator)
+			g.out.WriteByte('\n')
+		}
+		for _, b := range before {
+			g.printLine(name, b.number, b.offset, b.line, false)
+		}
+		before = before[:0]
+		g.printLine(name, lineno, lineOffset, line, true)
+		lastShown = lineno
+		afterLeft = g.after
+	}
+
+	switch {
+	case g.count:
+		if g.names {
+			g.writeName(name, ':')
+		}
+		g.out.WriteString(strconv.Itoa(count))
+		g.out.WriteByte('\n')
+	case g.list && count > 0, g.listMissing && count == 0:
+		g.writeColored(name, g.colors.filename)
+		if g.nullName {
+			g.out.WriteByte(0)
+		} else {
+			g.out.WriteByte('\n')
+		}
+		if g.listMissing {
+			// with -L, listing a file is a success
+			g.matched = true
+		}
+	}
+	if g.lineBuffered {
+		g.out.Flush()
+	}
+	return false
+}
+
+// contextLine is a line kept for the leading context of a match.
+type contextLine struct {
+	number int
+	offset int64
+	line   []byte
+}
+
+// writeColored writes the text within SGR sequences of the color, if
+// any.
+func (g *grep) writeColored(text, color string) {
+	if color == "" {
+		g.out.WriteString(text)
+		return
+	}
+	fmt.Fprintf(g.out, "\x1b[%sm\x1b[K%s\x1b[m\x1b[K", color, text)
+}
+
+// writeName writes the file name followed by the separator, or by a 0
+// byte with -Z.
+func (g *grep) writeName(name string, sep byte) {
+	g.writeColored(name, g.colors.filename)
+	if g.nullName {
+		g.out.WriteByte(0)
+		return
+	}
+	g.writeColored(string(sep), g.colors.separator)
+}
+
+// printLine prints a selected line, or a context line, with its prefix:
+// "name:12:" for selected lines and "name-12-" for context lines. With
+// -o, it prints the matches of selected lines on lines of their own.
+func (g *grep) printLine(name string, lineno int, offset int64, line []byte, selected bool) {
+	sep := byte('-')
+	if selected {
+		sep = ':'
+	}
+	prefix := func(off int64) {
+		if g.names {
+			g.writeName(name, sep)
+		}
+		if g.number {
+			g.writeColored(strconv.Itoa(lineno), g.colors.lineNumber)
+			g.writeColored(string(sep), g.colors.separator)
+		}
+		if g.byteOffset {
+			g.writeColored(strconv.FormatInt(off, 10), g.colors.byteOffset)
+			g.writeColored(string(sep), g.colors.separator)
+		}
+	}
+
+	if g.only {
+		if !selected || g.invert {
+			return
+		}
+		for _, loc := range g.m.find(line, -1) {
+			prefix(offset + int64(loc[0]))
+			g.writeColored(string(line[loc[0]:loc[1]]), g.colors.selected)
+			g.out.WriteByte(g.eol)
+		}
+		g.flushLine()
+		return
+	}
+
+	prefix(offset)
+	// highlight the matches of selected lines, and of context lines with -v
+	var color string
+	switch {
+	case selected && !g.invert:
+		color = g.colors.selected
+	case !selected && g.invert:
+		color = g.colors.context
+	}
+	if color == "" {
+		g.out.Write(line)
+	} else {
+		pos := 0
+		for _, loc := range g.m.find(line, -1) {
+			g.out.Write(line[pos:loc[0]])
+			g.writeColored(string(line[loc[0]:loc[1]]), color)
+			pos = loc[1]
+		}
+		g.out.Write(line[pos:])
+	}
+	g.out.WriteByte(g.eol)
+	g.flushLine()
+}
+
+func (g *grep) flushLine() {
+	g.printed = true
+	if g.lineBuffered {
+		g.out.Flush()
 	}
-	return nil
 }
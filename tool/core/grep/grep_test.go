@@ -2,295 +2,291 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+package grep
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
 )
 
-// GrepTest is a table-driven which spawns grep with a variety of options and inputs.
-// We need to look at any output data, as well as exit status (errQuite) for things like the -q switch.
+type localFS struct {
+}
+
+func (r *localFS) Open(s string) (fs.File, error) {
+	return os.Open(s)
+}
+
+// exitCode returns the exit status of the error of a run.
+func exitCode(err error) int {
+	var exit *cli.ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+func run(stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := New(&localFS{})
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	err := cmd.Run(args...)
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+// TestStdinGrep runs grep with a variety of options on stdin, checking the
+// output and the exit status.
 func TestStdinGrep(t *testing.T) {
 	tests := []struct {
 		input  string
 		output string
-		err    error
-		p      params
+		code   int
+		args   []string
+	}{
+		{"hix\n", "hix\n", 0, []string{"."}},
+		{"hix\n", "", 0, []string{"-q", "."}},
+		{"hix\n", "hix\n", 0, []string{"-i", "hix"}},
+		{"hix\n", "", 1, []string{"-i", "hox"}},
+		{"HiX\n", "HiX\n", 0, []string{"-i", "hix"}},
+		{"hix\n", "1:hix\n", 0, []string{"-n", "hix"}},
+		{"hix\n", "hix\n", 0, []string{"-e", "hix"}},
+		{"hix\n", "1\n", 0, []string{"-c", "hix"}},
+		{"hix", "", 1, []string{"-q", "hello"}},
+		{"hix", "hix\n", 0, []string{"hix"}},
+		{"hix\n", "hix\n", 0, []string{"-h", "hix"}},
+		{"hix\n", "hix\n", 0, []string{"-r", "hix", "-"}},
+		{"hix\nfoo\n", "foo\n", 0, []string{"-v", "hix"}},
+		{"hix\n", "(standard input)\n", 0, []string{"-l", "hix"}},
+		{"hix\n", "", 1, []string{"-L", "hix"}},
+		{"a: [a-z]{1,2}\n", "a: [a-z]{1,2}\n", 0, []string{"-F", "{1,2}"}},
+		{"a: [a-Z]{1,2}\n", "a: [a-Z]{1,2}\n", 0, []string{"-F", "-i", "[A-z]"}},
+		{"a\nb\nc\n", "b\n", 0, []string{"-F", "b"}},
+		{"a\nb\nc\n", "b\nc\n", 0, []string{"-e", "b", "-e", "c"}},
+		{"a\nb\nc\n", "a\nc\n", 0, []string{"-F", "a\nc"}},
+
+		// syntax
+		{"a+b\naab\n", "a+b\n", 0, []string{"a+b"}},
+		{"a+b\naab\n", "aab\n", 0, []string{"-E", "a+b"}},
+		{"a+b\naab\n", "aab\n", 0, []string{`a\+b`}},
+		{"ab\nabab\n", "abab\n", 0, []string{`^\(ab\)\{2\}$`}},
+		{"ab\nabab\n", "abab\n", 0, []string{"-E", "^(ab){2}$"}},
+		{"*star\n", "*star\n", 0, []string{"*star"}},
+		{"x{y\n", "x{y\n", 0, []string{"-E", "x{y"}},
+		{"a]b\n", "a]b\n", 0, []string{"[]]"}},
+		{"a1\n", "a1\n", 0, []string{"[[:digit:]]"}},
+		{"b\na\n", "a\n", 0, []string{"[[.a.]]"}},
+		{"b\na\n", "a\n", 0, []string{"-E", "^[[=a=]]$"}},
+		{"a-b\nab\n", "a-b\n", 0, []string{"a[[.-.]]b"}},
+		{"a]\na\n", "a]\n", 0, []string{"a[x[.].]]"}},
+		{"a^\n", "a^\n", 0, []string{"a[[.^.]]"}},
+		{"é\ne\n", "é\n", 0, []string{"[[=é=]]"}},
+		{"b\nm\n", "m\n", 0, []string{"[[.l.]-[.n.]]"}},
+		{"foo12\n", "12\n", 0, []string{"-o", "-P", `\d+`}},
+		{"héllo\n", "héllo\n", 0, []string{"é"}},
+
+		// word and line matches
+		{"foo\nfoobar\nbar foo.\n", "foo\nbar foo.\n", 0, []string{"-w", "foo"}},
+		{"foo\nfoobar\n", "foo\n", 0, []string{"-x", "foo"}},
+		{"foo foo\n", "foo\nfoo\n", 0, []string{"-o", "-w", "foo"}},
+		{"foo_bar\n", "", 1, []string{"-w", "foo"}},
+
+		// only matching and byte offsets
+		{"a1b22c333\n", "1\n22\n333\n", 0, []string{"-o", "-E", "[0-9]+"}},
+		{"xx\nab ab\n", "3:ab\n6:ab\n", 0, []string{"-o", "-b", "ab"}},
+		{"xx\nab\n", "2:3:ab\n", 0, []string{"-n", "-b", "ab"}},
+
+		// max count
+		{"a\na\na\n", "a\na\n", 0, []string{"-m", "2", "a"}},
+		{"a\na\na\n", "2\n", 0, []string{"-c", "-m2", "a"}},
+		{"a\n", "", 1, []string{"-m", "0", "a"}},
+
+		// context
+		{"1\n2\nx\n3\n4\n", "2\nx\n3\n", 0, []string{"-C", "1", "x"}},
+		{"1\n2\nx\n3\n4\n", "2\nx\n3\n", 0, []string{"-1", "x"}},
+		{"1\n2\nx\n3\n4\n", "1-1\n2-2\n3:x\n", 0, []string{"-n", "-B", "2", "x"}},
+		{"x\n1\n2\n3\nx\n", "x\n1\n--\n3\nx\n", 0, []string{"-C1", "x"}},
+		{"x\n1\nx\n", "x\n1\nx\n", 0, []string{"-A", "1", "x"}},
+		{"x\n1\nx\n2\n", "x\n1\n", 0, []string{"-m1", "-A1", "x"}},
+
+		// null data and names
+		{"a\x00b\x00", "b\x00", 0, []string{"-z", "b"}},
+
+		// errors
+		{"a\n", "", 2, []string{"-E", "a("}},
+		{"a\n", "", 2, []string{`a\1`}},
+		{"a\n", "", 2, []string{"[[.ab.]]"}},
+		{"a\n", "", 2, []string{"[[==]]"}},
+		{"a\n", "", 2, []string{"[[.a]"}},
+		{"a\n", "", 2, []string{"[[:nope:]]"}},
+		{"a\n", "", 2, nil},
+		{"a\n", "", 2, []string{"--binary-files=x", "a"}},
+	}
+
+	for idx, test := range tests {
+		t.Run(fmt.Sprintf("case_%d", idx), func(t *testing.T) {
+			out, _, code := run(test.input, test.args...)
+			if code != test.code {
+				t.Errorf("grep %q: got exit status %d, want %d", test.args, code, test.code)
+			}
+			if out != test.output {
+				t.Errorf("grep %q: got out %q, want %q", test.args, out, test.output)
+			}
+		})
+	}
+}
+
+func TestFilesGrep(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	f1 := write("f1.txt", "hix\nnix\n")
+	f2 := write("f2.txt", "hix\nhello\n")
+	f3 := write("sub/f3.go", "hix\ngoodbye\n")
+	other := t.TempDir()
+	bin := filepath.Join(other, "bin.dat")
+	if err := os.WriteFile(bin, []byte("hix\x00\x01\x02\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	patterns := filepath.Join(other, "patterns")
+	if err := os.WriteFile(patterns, []byte("hello\ngoodbye\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(f1, filepath.Join(tmpDir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		output string
+		stderr string
+		code   int
 		args   []string
 	}{
-		// BEWARE: the IO package seems to want this to be newline terminated.
-		// If you just use hix with no newline the test will fail. Yuck.
 		{
-			input:  "hix\n",
-			output: "hix\n",
-			err:    nil,
-			args:   []string{"."},
+			output: fmt.Sprintf("%s:hix\n%s:hix\n%s:hix\n", f1, f2, f3),
+			args:   []string{"-r", "hix", tmpDir},
 		},
 		{
-			input:  "hix\n",
-			output: "",
-			err:    nil,
-			p:      params{quiet: true},
-			args:   []string{"."},
+			output: fmt.Sprintf("%s:hix\n%s:hix\n%s:hix\n%s:hix\n", f1, f2, filepath.Join(tmpDir, "link.txt"), f3),
+			args:   []string{"-R", "-I", "hix", tmpDir},
 		},
 		{
-			input:  "hix\n",
-			output: "hix\n",
-			err:    nil,
-			p:      params{caseInsensitive: true},
-			args:   []string{"hix"},
+			stderr: fmt.Sprintf("grep: %s: Is a directory\n", tmpDir),
+			code:   2,
+			args:   []string{"hix", tmpDir},
 		},
 		{
-			input:  "hix\n",
-			output: "",
-			err:    nil,
-			p:      params{caseInsensitive: true},
-			args:   []string{"hox"},
+			output: fmt.Sprintf("%s:hello\n", f2),
+			args:   []string{"hello", f1, f2},
 		},
 		{
-			input:  "HiX\n",
-			output: "HiX\n",
-			err:    nil,
-			p:      params{caseInsensitive: true},
-			args:   []string{"hix"},
+			output: fmt.Sprintf("%s\n", f1),
+			args:   []string{"-l", "nix", f1},
 		},
 		{
-			input:  "hix\n",
-			output: "1:hix\n",
-			err:    nil,
-			p:      params{number: true},
-			args:   []string{"hix"},
+			output: fmt.Sprintf("%s\n", f2),
+			args:   []string{"-L", "nix", f1, f2},
 		},
 		{
-			input:  "hix\n",
-			output: "hix\n",
-			err:    nil,
-			p:      params{expr: "hix"},
+			output: fmt.Sprintf("%s:1\n%s:0\n", f1, f2),
+			args:   []string{"-c", "nix", f1, f2},
 		},
 		{
-			input:  "hix\n",
-			output: "1\n",
-			err:    nil,
-			p:      params{count: true},
-			args:   []string{"hix"},
+			args: []string{"-q", "nix", f1},
 		},
 		{
-			input:  "hix",
-			output: "",
-			err:    errQuiet,
-			p:      params{quiet: true},
-			args:   []string{"hello"},
+			stderr: "no such file or directory",
+			code:   2,
+			args:   []string{"-q", "nix", tmpDir + "1"},
 		},
-		// These tests don't make a lot of sense the way we're running it, but
-		// hopefully it'll make codecov shut up.
 		{
-			input:  "hix\n",
-			output: "hix\n",
-			err:    nil,
-			p:      params{headers: true},
-			args:   []string{"hix"},
+			code: 2,
+			args: []string{"-s", "nix", tmpDir + "1"},
 		},
 		{
-			input:  "hix\n",
-			output: "hix\n",
-			err:    nil,
-			p:      params{recursive: true},
-			args:   []string{"hix"},
+			// a match and an error
+			stderr: "no such file or directory",
+			args:   []string{"-q", "nix", tmpDir + "1", f1},
 		},
 		{
-			input:  "hix\nfoo\n",
-			output: "foo\n",
-			err:    nil,
-			p:      params{invert: true},
-			args:   []string{"hix"},
+			stderr: "no such file or directory",
+			code:   2,
+			args:   []string{"nix", tmpDir + "1", f1},
+			output: fmt.Sprintf("%s:nix\n", f1),
 		},
 		{
-			input:  "hix\n",
-			output: "\n",
-			err:    nil,
-			p:      params{noShowMatch: true},
-			args:   []string{"hix"},
-		}, // no filename, so it just prints a newline
-		{
-			input:  "a: [a-z]{1,2}\n",
-			output: "a: [a-z]{1,2}\n",
-			err:    nil,
-			p:      params{fixed: true},
-			args:   []string{"{1,2}"},
+			output: fmt.Sprintf("%s:hello\n%s:goodbye\n", f2, f3),
+			args:   []string{"-r", "-f", patterns, tmpDir},
 		},
 		{
-			input:  "a: [a-Z]{1,2}\n",
-			output: "a: [a-Z]{1,2}\n",
-			err:    nil,
-			p:      params{fixed: true, caseInsensitive: true},
-			args:   []string{"[A-z]"},
+			output: fmt.Sprintf("%s:hix\n", f3),
+			args:   []string{"-r", "--include=*.go", "hix", tmpDir},
 		},
 		{
-			input:  "a\nb\nc\n",
-			output: "b\n",
-			err:    nil,
-			p:      params{fixed: true},
-			args:   []string{"b"},
+			output: fmt.Sprintf("%s:hix\n", f2),
+			args:   []string{"-r", "--exclude-dir=sub", "--exclude=f1.txt", "--exclude=link.txt", "hix", tmpDir},
 		},
 		{
-			input:  "a\nb\nc\n",
-			output: "b\n",
-			err:    nil,
-			p:      params{fixed: true, expr: "b"},
-		},
-	}
-
-	for idx, te := range tests {
-		test := te
-		t.Run(fmt.Sprintf("case_%d", idx), func(t *testing.T) {
-			var stdout bytes.Buffer
-			rc := io.NopCloser(strings.NewReader(test.input))
-			cmd := cmd{
-				stdin:  rc,
-				stdout: bufio.NewWriter(&stdout),
-				stderr: nil,
-				params: test.p,
-				args:   test.args,
-			}
-			err := cmd.run()
-			if err != test.err {
-				t.Errorf("got err %v, want %v", err, test.err)
-			}
-
-			res := stdout.String()
-			if res != test.output {
-				t.Errorf("got out %q, want %q", res, test.output)
-			}
-		})
-	}
-}
-
-func TestFilesGrep(t *testing.T) {
-	tmpDir := t.TempDir()
-	f1, err := os.CreateTemp(tmpDir, "f1")
-	if err != nil {
-		t.Fatal(err)
-	}
-	f2, err := os.CreateTemp(tmpDir, "f2")
-	if err != nil {
-		t.Fatal(err)
-	}
-	f3, err := os.CreateTemp(tmpDir, "f3")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	_, err = f1.WriteString("hix\nnix\n")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	_, err = f2.WriteString("hix\nhello\n")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	_, err = f3.WriteString("hix\ngoodbye\n")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	err = os.Chdir(tmpDir)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	tests := []struct {
-		output  string
-		err     error
-		partial bool
-		p       params
-		args    []string
-	}{
-		{
-			output: fmt.Sprintf("%s:hix\n%s:hix\n%s:hix\n", f1.Name(), f2.Name(), f3.Name()),
-			err:    nil,
-			p:      params{recursive: true},
-			args:   []string{"hix", tmpDir},
+			stderr: fmt.Sprintf("grep: %s: binary file matches\n", bin),
+			args:   []string{"hix", bin},
 		},
 		{
-			output: fmt.Sprintf("grep: %v: Is a directory\n", tmpDir),
-			err:    filepath.SkipDir,
-			p:      params{recursive: false},
-			args:   []string{"hix", tmpDir},
+			output: "hix\x00\x01\x02\n",
+			args:   []string{"-a", "hix", bin},
 		},
 		{
-			output: fmt.Sprintf("%s:hello\n", f2.Name()),
-			err:    nil,
-			args:   []string{"hello", f1.Name(), f2.Name()},
+			code: 1,
+			args: []string{"-I", "hix", bin},
 		},
 		{
-			output: fmt.Sprintf("%s\n", f1.Name()),
-			err:    nil,
-			p:      params{noShowMatch: true},
-			args:   []string{"nix", f1.Name()},
+			output: fmt.Sprintf("%s\x00", f1),
+			args:   []string{"-lZ", "hix", f1},
 		},
 		{
-			output: "",
-			err:    nil,
-			p:      params{quiet: true},
-			args:   []string{"nix", f1.Name()},
-		},
-		{
-			output:  fmt.Sprintf("grep: %s", tmpDir+"1"),
-			partial: true,
-			err:     errQuiet,
-			p:       params{quiet: true},
-			args:    []string{"nix", tmpDir + "1"},
+			output: fmt.Sprintf("\x1b[35m\x1b[K%s\x1b[m\x1b[K\x1b[36m\x1b[K:\x1b[m\x1b[K\x1b[01;31m\x1b[Khel\x1b[m\x1b[Klo\n", f2),
+			args:   []string{"--color=always", "-H", "hel", f2},
 		},
 	}
 
-	for idx, te := range tests {
-		test := te
+	for idx, test := range tests {
 		t.Run(fmt.Sprintf("case_%d", idx), func(t *testing.T) {
-			var stdout bytes.Buffer
-			cmd := cmd{
-				stdin:  nil,
-				stdout: bufio.NewWriter(&stdout),
-				stderr: &stdout,
-				params: test.p,
-				args:   test.args,
+			out, stderr, code := run("", test.args...)
+			if code != test.code {
+				t.Errorf("grep %q: got exit status %d, want %d", test.args, code, test.code)
 			}
-			err := cmd.run()
-			if test.err == nil && err != nil {
-				t.Errorf("got %v, want nil", err)
-			} else if err != nil {
-				if !strings.Contains(err.Error(), test.err.Error()) {
-					t.Errorf("got %v, want %v", err, test.err)
-				}
+			if out != test.output {
+				t.Errorf("grep %q: got out %q, want %q", test.args, out, test.output)
 			}
-
-			res := stdout.String()
-			if (test.partial && !strings.Contains(res, test.output)) || (!test.partial && res != test.output) {
-				t.Errorf("got %v, want %v", res, test.output)
+			if !strings.Contains(stderr, test.stderr) || test.stderr == "" && stderr != "" {
+				t.Errorf("grep %q: got stderr %q, want %q", test.args, stderr, test.stderr)
 			}
 		})
 	}
 }
 
 func TestDefaultParams(t *testing.T) {
-	var stdout bytes.Buffer
-	rc := io.NopCloser(strings.NewReader("hix\n"))
-
-	err := run(rc, &stdout, &stdout, []string{"grep", "."})
-	if err != nil {
-		t.Errorf("got err %v, want %v", err, nil)
+	out, _, code := run("hix\n", ".")
+	if code != 0 {
+		t.Errorf("got exit status %d, want 0", code)
 	}
-
-	res := stdout.String()
-	if res != "hix\n" {
-		t.Errorf("got out %q, want %q", res, "hix\n")
+	if out != "hix\n" {
+		t.Errorf("got out %q, want %q", out, "hix\n")
 	}
 }
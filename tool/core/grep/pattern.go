@@ -0,0 +1,127 @@
+// Copyright 2012-2017 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grep
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/qiangli/shell/tool/core/internal/regex"
+)
+
+// syntax of the patterns
+type syntax int
+
+const (
+	basic syntax = iota
+	extended
+	fixed
+	perl
+)
+
+// matcher finds the matches of the patterns in lines.
+type matcher struct {
+	re *regexp.Regexp
+	// matches must be whole words (-w)
+	word bool
+	// there is an empty pattern, which matches every line
+	empty bool
+}
+
+// newMatcher compiles the patterns into a single regular expression
+// preferring the longest matches, as POSIX does.
+func newMatcher(patterns []string, syn syntax, ignoreCase, word, line bool) (*matcher, error) {
+	m := &matcher{word: word}
+	alts := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		var (
+			re  string
+			err error
+		)
+		switch syn {
+		case fixed:
+			re = regexp.QuoteMeta(p)
+		case basic:
+			re, err = regex.Convert(p, true)
+		case extended:
+			re, err = regex.Convert(p, false)
+		case perl:
+			re = p
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.empty = m.empty || p == ""
+		alts = append(alts, "(?:"+re+")")
+	}
+	re := strings.Join(alts, "|")
+	if len(alts) == 0 {
+		// no pattern matches nothing
+		re = `[^\x00-\x{10FFFF}]`
+	}
+	if line {
+		re = "^(?:" + re + ")$"
+	}
+	if ignoreCase {
+		re = "(?i)" + re
+	}
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+	if syn != perl {
+		compiled.Longest()
+	}
+	m.re = compiled
+	return m, nil
+}
+
+// match reports whether the line has a match.
+func (m *matcher) match(line []byte) bool {
+	if !m.word {
+		return m.re.Match(line)
+	}
+	if m.empty {
+		return true
+	}
+	return len(m.find(line, 1)) > 0
+}
+
+// find returns the locations of up to n matches of the line, all if n < 0.
+// Empty matches are left out, they print nothing.
+func (m *matcher) find(line []byte, n int) [][]int {
+	var locs [][]int
+	for _, loc := range m.re.FindAllIndex(line, -1) {
+		if loc[0] == loc[1] || m.word && !isWord(line, loc[0], loc[1]) {
+			continue
+		}
+		locs = append(locs, loc)
+		if len(locs) == n {
+			break
+		}
+	}
+	return locs
+}
+
+// isWord reports whether the match is neither preceded nor followed by a
+// word constituent: a letter, a digit or an underscore.
+func isWord(line []byte, start, end int) bool {
+	wordRune := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRune(line[:start]); wordRune(r) {
+			return false
+		}
+	}
+	if end < len(line) {
+		if r, _ := utf8.DecodeRune(line[end:]); wordRune(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+// Package cli helps core commands follow the conventions of GNU tools.
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/qiangli/shell/vfs"
+)
+
+// ExitError carries the exit status of a command. Err, if set, is the
+// message to report; the command has already reported it otherwise.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// Exit returns an error that makes the shell exit with the code.
+func Exit(code int, err error) error {
+	return &ExitError{Code: code, Err: err}
+}
+
+func (e *ExitError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit status.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Args converts GNU style arguments for the flag package.
+//
+// Grouped short options are split and long options lose one dash.
+// The value of an option listed in valued may be attached to it, as in
+// "-p1" or "--strip=1", or be the next argument. Options may follow
+// operands; all operands are moved after a "--" so that operands
+// starting with a dash are not mistaken for options. Parsing of options
+// stops at "--" and the lone "-" is an operand.
+func Args(args []string, valued ...string) []string {
+	takes := func(name string) bool {
+		return slices.Contains(valued, name)
+	}
+
+	var opts, operands []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			operands = append(operands, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(a, "--"):
+			name, _, found := strings.Cut(a[2:], "=")
+			opts = append(opts, a[1:])
+			if !found && takes(name) && i+1 < len(args) {
+				i++
+				opts = append(opts, args[i])
+			}
+		case strings.HasPrefix(a, "-") && a != "-":
+			for j := 1; j < len(a); j++ {
+				name := a[j : j+1]
+				opts = append(opts, "-"+name)
+				if !takes(name) {
+					continue
+				}
+				if j+1 < len(a) {
+					opts = append(opts, a[j+1:])
+				} else if i+1 < len(args) {
+					i++
+					opts = append(opts, args[i])
+				}
+				break
+			}
+		default:
+			operands = append(operands, a)
+		}
+	}
+	return append(append(opts, "--"), operands...)
+}
+
+// Open opens the input operand name at path, stdin being "-". Errors are
+// reported as "name: cause" without the operation and the path.
+func Open(f fs.FS, stdin io.Reader, name, path string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(stdin), nil
+	}
+	file, err := f.Open(path)
+	if err != nil {
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return file, nil
+}
+
+// Workspace is the part of the workspace of the shell that CreateFile
+// writes through.
+type Workspace interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	MoveFile(source, destination string) error
+	DeleteFile(path string, recursive bool) error
+}
+
+// File is written to a temporary file next to its path, which replaces
+// the file at the path on Commit. The content is written as is.
+type File struct {
+	vfs.File
+	ws   Workspace
+	path string
+	tmp  string
+}
+
+// CreateFile creates the temporary file of path in ws. A file replacing
+// a regular one keeps its permissions.
+func CreateFile(ws Workspace, path string) (*File, error) {
+	dir, base := filepath.Split(path)
+	for range 100 {
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.%06d.tmp", base, rand.Intn(1e6)))
+		f, err := ws.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info, err := ws.Stat(path); err == nil && info.Mode().IsRegular() {
+			f.Chmod(info.Mode().Perm())
+		}
+		return &File{File: f, ws: ws, path: path, tmp: tmp}, nil
+	}
+	return nil, &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+}
+
+// Commit closes the file and moves it to its path.
+func (f *File) Commit() error {
+	err := f.File.Close()
+	if err == nil {
+		err = f.ws.MoveFile(f.tmp, f.path)
+	}
+	if err != nil {
+		f.ws.DeleteFile(f.tmp, false)
+	}
+	return err
+}
+
+// Abort closes and removes the file, leaving the file at its path as it
+// was.
+func (f *File) Abort() {
+	f.File.Close()
+	f.ws.DeleteFile(f.tmp, false)
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		args   []string
+		valued []string
+		want   []string
+	}{
+		{"empty", nil, nil, []string{"--"}},
+		{"grouped", []string{"-rn", "foo"}, nil, []string{"-r", "-n", "--", "foo"}},
+		{"attached value", []string{"-p1", "-i", "x.patch"}, []string{"p", "i"}, []string{"-p", "1", "-i", "x.patch", "--"}},
+		{"grouped value", []string{"-Rp1"}, []string{"p"}, []string{"-R", "-p", "1", "--"}},
+		{"long", []string{"--dry-run", "--strip=1", "--input", "a"}, []string{"strip", "input"}, []string{"-dry-run", "-strip=1", "-input", "a", "--"}},
+		{"permute", []string{"foo", "-n", "bar"}, nil, []string{"-n", "--", "foo", "bar"}},
+		{"dash value", []string{"-n", "-5", "f"}, []string{"n"}, []string{"-n", "-5", "--", "f"}},
+		{"stdin", []string{"-", "-c"}, nil, []string{"-c", "--", "-"}},
+		{"double dash", []string{"-v", "--", "-x", "y"}, nil, []string{"-v", "--", "-x", "y"}},
+		{"separator", []string{"-d:", "-f1"}, []string{"d", "f"}, []string{"-d", ":", "-f", "1", "--"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Args(tt.args, tt.valued...)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Args(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
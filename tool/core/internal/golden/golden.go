@@ -0,0 +1,180 @@
+// Package golden runs core commands on the cases of golden files.
+//
+// A golden file, testdata/NAME.golden, is a sequence of sections each
+// starting with a "-- SECTION --" line:
+//
+//	-- args --      the arguments, one per line, Go quoted if they start
+//	                with a double quote
+//	-- stdin --     the standard input
+//	-- file NAME -- a file of the working directory
+//	-- stdout --    the expected standard output
+//	-- stderr --    the expected standard error, not compared if absent
+//	-- exit --      the expected exit status, 0 if absent
+//
+// Lines before the first section are comments. Running the tests with
+// -update rewrites the expected sections with the actual results.
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/core"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+type section struct {
+	name, data string
+}
+
+// parse splits a golden file into its comment and its sections.
+func parse(data string) (string, []section) {
+	var comment strings.Builder
+	var sections []section
+	for line := range strings.Lines(data) {
+		name, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "-- ")
+		if ok {
+			name, ok = strings.CutSuffix(name, " --")
+		}
+		switch {
+		case ok:
+			sections = append(sections, section{name: name})
+		case len(sections) == 0:
+			comment.WriteString(line)
+		default:
+			sections[len(sections)-1].data += line
+		}
+	}
+	return comment.String(), sections
+}
+
+// localFS opens the files of the host.
+type localFS struct{}
+
+func (localFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// Run runs the command made by newCmd on each golden file of the testdata
+// directory. Errors carried by exit statuses are written to stderr as the
+// shell reports them, prefixed by the name of the command.
+func Run(t *testing.T, name string, newCmd func(fs.FS) core.Command) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no golden files in testdata")
+	}
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".golden"), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			comment, sections := parse(string(data))
+
+			dir := t.TempDir()
+			var args []string
+			var stdin string
+			for _, s := range sections {
+				switch {
+				case s.name == "args":
+					for line := range strings.Lines(s.data) {
+						arg := strings.TrimSuffix(line, "\n")
+						if strings.HasPrefix(arg, `"`) {
+							if arg, err = strconv.Unquote(arg); err != nil {
+								t.Fatalf("args: %v", err)
+							}
+						}
+						args = append(args, arg)
+					}
+				case s.name == "stdin":
+					stdin = s.data
+				case strings.HasPrefix(s.name, "file "):
+					if err := os.WriteFile(filepath.Join(dir, strings.TrimPrefix(s.name, "file ")), []byte(s.data), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := newCmd(localFS{})
+			cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+			cmd.SetWorkingDir(dir)
+			code := 0
+			if err := cmd.Run(args...); err != nil {
+				var exit interface {
+					ExitCode() int
+					Unwrap() error
+				}
+				if !errors.As(err, &exit) {
+					t.Fatalf("%s %q: %v", name, args, err)
+				}
+				code = exit.ExitCode()
+				if cause := exit.Unwrap(); cause != nil {
+					fmt.Fprintf(&stderr, "%s: %v\n", name, cause)
+				}
+			}
+
+			got := map[string]string{
+				"stdout": stdout.String(),
+				"stderr": stderr.String(),
+				"exit":   fmt.Sprintf("%d\n", code),
+			}
+			if *update {
+				write(t, path, comment, sections, got)
+				return
+			}
+			want := map[string]string{"exit": "0\n"}
+			for _, s := range sections {
+				want[s.name] = s.data
+			}
+			for _, s := range []string{"stdout", "stderr", "exit"} {
+				w, ok := want[s]
+				if !ok && s == "stderr" {
+					continue
+				}
+				if got[s] != w {
+					t.Errorf("%s %q: got %s %q, want %q", name, args, s, got[s], w)
+				}
+			}
+		})
+	}
+}
+
+// write rewrites the golden file with the results. Sections end with a
+// newline, so outputs without one can not be recorded.
+func write(t *testing.T, path, comment string, sections []section, got map[string]string) {
+	if out := got["stdout"]; out != "" && !strings.HasSuffix(out, "\n") {
+		t.Fatalf("%s: the output does not end with a newline", path)
+	}
+	var b strings.Builder
+	b.WriteString(comment)
+	for _, s := range sections {
+		if s.name == "stdout" || s.name == "stderr" || s.name == "exit" {
+			continue
+		}
+		fmt.Fprintf(&b, "-- %s --\n%s", s.name, s.data)
+	}
+	fmt.Fprintf(&b, "-- stdout --\n%s", got["stdout"])
+	if got["stderr"] != "" {
+		fmt.Fprintf(&b, "-- stderr --\n%s", got["stderr"])
+	}
+	if got["exit"] != "0\n" {
+		fmt.Fprintf(&b, "-- exit --\n%s", got["exit"])
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
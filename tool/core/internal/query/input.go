@@ -0,0 +1,146 @@
+package query
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Decoder returns the next value of an input, io.EOF at the end.
+type Decoder func() (any, error)
+
+// NewDecoder returns the decoder of an input format for r.
+type NewDecoder func(r io.Reader) Decoder
+
+// DecodeJSON decodes a sequence of JSON values, keeping the numbers as
+// they are written.
+func DecodeJSON(r io.Reader) Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return func() (any, error) {
+		var v any
+		err := dec.Decode(&v)
+		return v, err
+	}
+}
+
+// decodeLines decodes each line as a string for -R.
+func decodeLines(r io.Reader) Decoder {
+	br := bufio.NewReader(r)
+	return func() (any, error) {
+		line, err := br.ReadString('\n')
+		if line == "" {
+			return nil, err
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+}
+
+// Inputs are the values of the input files, or of stdin, in order. They
+// are the iterator of input and inputs as well as of the main loop.
+// Errors are yielded as values and end their file.
+type Inputs struct {
+	names  []string
+	open   func(name string) (io.ReadCloser, error)
+	decode NewDecoder
+	slurp  bool
+	raw    bool
+
+	file io.ReadCloser
+	name string
+	next Decoder
+}
+
+// NewInputs returns the inputs of the files, "-" being stdin, opened
+// with open and decoded with decode, or as lines with -R.
+func NewInputs(names []string, open func(string) (io.ReadCloser, error), decode NewDecoder, o *Options) *Inputs {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	if o.RawInput {
+		decode = decodeLines
+	}
+	in := &Inputs{names: names, open: open, decode: decode, raw: o.RawInput}
+	// with -n the program reads the inputs itself
+	in.slurp = o.Slurp && !o.NullInput
+	if in.slurp && in.raw {
+		// the files as a whole
+		in.decode = func(r io.Reader) Decoder {
+			done := false
+			return func() (any, error) {
+				if done {
+					return nil, io.EOF
+				}
+				done = true
+				b, err := io.ReadAll(r)
+				return string(b), err
+			}
+		}
+	}
+	return in
+}
+
+// Next returns the next value, or the array of all the values with -s.
+func (in *Inputs) Next() (any, bool) {
+	if !in.slurp {
+		return in.value()
+	}
+	in.slurp = false
+	all := []any{}
+	var text strings.Builder
+	for {
+		v, ok := in.value()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return err, true
+		}
+		if in.raw {
+			text.WriteString(v.(string))
+		} else {
+			all = append(all, v)
+		}
+	}
+	if in.raw {
+		return text.String(), true
+	}
+	return all, true
+}
+
+// value returns the next value of the files.
+func (in *Inputs) value() (any, bool) {
+	for {
+		if in.next == nil {
+			if len(in.names) == 0 {
+				return nil, false
+			}
+			in.name, in.names = in.names[0], in.names[1:]
+			f, err := in.open(in.name)
+			if err != nil {
+				return err, true
+			}
+			in.file, in.next = f, in.decode(f)
+		}
+		v, err := in.next()
+		if err == nil {
+			return v, true
+		}
+		in.file.Close()
+		in.next = nil
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", in.Name(), err), true
+		}
+	}
+}
+
+// Name returns the name of the current file, "<stdin>" for stdin.
+func (in *Inputs) Name() string {
+	if in.name == "-" {
+		return "<stdin>"
+	}
+	return in.name
+}
@@ -0,0 +1,266 @@
+// Package query runs jq programs for the jq and yq commands.
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// The exit statuses of jq.
+const (
+	ExitFalsy   = 1
+	ExitUsage   = 2
+	ExitCompile = 3
+	ExitNoValue = 4
+	ExitError   = 5
+)
+
+// Options are the options common to jq and yq.
+type Options struct {
+	Raw        bool
+	Join       bool
+	Compact    bool
+	Slurp      bool
+	NullInput  bool
+	RawInput   bool
+	ExitStatus bool
+	Tab        bool
+	SortKeys   bool
+	Indent     int
+
+	// Vars are the variables of --arg and --argjson, in order
+	Vars []Var
+}
+
+// Var is a named argument of the program.
+type Var struct {
+	Name  string
+	Value any
+}
+
+// Valued are the options of Flags that take a value.
+var Valued = []string{"indent"}
+
+// Flags defines the common options in fs.
+func (o *Options) Flags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Raw, "r", false, "write strings without quotes")
+	fs.BoolVar(&o.Raw, "raw-output", false, "write strings without quotes")
+	fs.BoolVar(&o.Join, "j", false, "like -r without newlines after the results")
+	fs.BoolVar(&o.Join, "join-output", false, "like -r without newlines after the results")
+	fs.BoolVar(&o.Compact, "c", false, "write each result on one line")
+	fs.BoolVar(&o.Compact, "compact-output", false, "write each result on one line")
+	fs.BoolVar(&o.Slurp, "s", false, "run the program once on the array of the inputs")
+	fs.BoolVar(&o.Slurp, "slurp", false, "run the program once on the array of the inputs")
+	fs.BoolVar(&o.NullInput, "n", false, "run the program once on null")
+	fs.BoolVar(&o.NullInput, "null-input", false, "run the program once on null")
+	fs.BoolVar(&o.RawInput, "R", false, "read the lines of the input as strings")
+	fs.BoolVar(&o.RawInput, "raw-input", false, "read the lines of the input as strings")
+	fs.BoolVar(&o.ExitStatus, "e", false, "set the exit status from the last result")
+	fs.BoolVar(&o.ExitStatus, "exit-status", false, "set the exit status from the last result")
+	fs.BoolVar(&o.SortKeys, "S", false, "sort the keys of objects (always done)")
+	fs.BoolVar(&o.SortKeys, "sort-keys", false, "sort the keys of objects (always done)")
+	fs.BoolVar(&o.Tab, "tab", false, "indent with a tab")
+	fs.IntVar(&o.Indent, "indent", 2, "indent with `N` spaces")
+}
+
+// Args takes the --arg NAME VALUE and --argjson NAME TEXT options out of
+// args, which the flag package can not parse, and returns the others.
+func (o *Options) Args(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if a != "--arg" && a != "--argjson" {
+			rest = append(rest, a)
+			continue
+		}
+		if i+2 >= len(args) {
+			return nil, fmt.Errorf("%s takes two parameters (e.g. %s varname value)", a, a)
+		}
+		name, text := args[i+1], args[i+2]
+		i += 2
+		var v any = text
+		if a == "--argjson" {
+			dec := json.NewDecoder(strings.NewReader(text))
+			dec.UseNumber()
+			if err := dec.Decode(&v); err != nil || dec.More() {
+				return nil, fmt.Errorf("invalid JSON text passed to --argjson: %s", text)
+			}
+		}
+		o.Vars = append(o.Vars, Var{Name: name, Value: v})
+	}
+	return rest, nil
+}
+
+// Program is a compiled jq program.
+type Program struct {
+	code   *gojq.Code
+	values []any
+}
+
+// Compile compiles the program with the variables of the options and
+// $ARGS. Inputs is the iterator of input and inputs.
+func Compile(src string, o *Options, inputs gojq.Iter) (*Program, error) {
+	q, err := gojq.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %s: %w", src, err)
+	}
+	named := map[string]any{}
+	names := []string{"$ARGS"}
+	values := []any{map[string]any{"named": named, "positional": []any{}}}
+	for _, v := range o.Vars {
+		named[v.Name] = v.Value
+		names = append(names, "$"+v.Name)
+		values = append(values, v.Value)
+	}
+	code, err := gojq.Compile(q,
+		gojq.WithVariables(names),
+		gojq.WithInputIter(inputs),
+		gojq.WithFunction("input_filename", 0, 0, func(any, []any) any {
+			if in, ok := inputs.(interface{ Name() string }); ok && in.Name() != "<stdin>" {
+				return in.Name()
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("compile error: %w", err)
+	}
+	return &Program{code: code, values: values}, nil
+}
+
+// Run runs the program on each input value, or once on null with -n, and
+// writes the results. Errors are reported to stderr prefixed by name and
+// the exit status is that of jq.
+func (p *Program) Run(ctx context.Context, name string, o *Options, inputs gojq.Iter, write func(any) error, stderr io.Writer) error {
+	code := 0
+	// the status of -e: no value yet
+	status := ExitNoValue
+	run := func(v any) bool {
+		iter := p.code.RunWithContext(ctx, v, p.values...)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				return true
+			}
+			if err, ok := v.(error); ok {
+				var halt *gojq.HaltError
+				if errors.As(err, &halt) {
+					if v := halt.Value(); v != nil {
+						if s, ok := v.(string); ok {
+							io.WriteString(stderr, s)
+						} else {
+							b, _ := gojq.Marshal(v)
+							fmt.Fprintf(stderr, "%s\n", b)
+						}
+					}
+					code = halt.ExitCode()
+					return false
+				}
+				if ctx.Err() != nil {
+					return false
+				}
+				fmt.Fprintf(stderr, "%s: error: %v\n", name, err)
+				code = ExitError
+				return true
+			}
+			if err := write(v); err != nil {
+				fmt.Fprintf(stderr, "%s: %v\n", name, err)
+				code = ExitError
+				return false
+			}
+			status = 0
+			if v == nil || v == false {
+				status = ExitFalsy
+			}
+		}
+	}
+
+	if o.NullInput {
+		run(nil)
+	} else {
+		for {
+			v, ok := inputs.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				fmt.Fprintf(stderr, "%s: %v\n", name, err)
+				code = ExitUsage
+				continue
+			}
+			if !run(v) {
+				break
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if code == 0 && o.ExitStatus {
+		code = status
+	}
+	if code != 0 {
+		return cli.Exit(code, nil)
+	}
+	return nil
+}
+
+// WriteJSON writes v as JSON following the output options, strings being
+// raw with -r and -j.
+func (o *Options) WriteJSON(w io.Writer, v any) error {
+	var b []byte
+	if s, ok := v.(string); ok && (o.Raw || o.Join) {
+		b = []byte(s)
+	} else {
+		var err error
+		if b, err = gojq.Marshal(v); err != nil {
+			return err
+		}
+		if indent := o.indent(); indent != "" {
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, b, "", indent); err != nil {
+				return err
+			}
+			b = buf.Bytes()
+		}
+	}
+	if !o.Join {
+		b = append(b, '\n')
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// indent returns the indentation of the output, empty if it is compact.
+func (o *Options) indent() string {
+	switch {
+	case o.Compact:
+		return ""
+	case o.Tab:
+		return "\t"
+	}
+	return strings.Repeat(" ", o.Indent)
+}
+
+// CheckIndent validates the --indent option.
+func (o *Options) CheckIndent() error {
+	if o.Indent < 0 || o.Indent > 7 {
+		return errors.New("cannot indent more than 7 characters: " + strconv.Itoa(o.Indent))
+	}
+	return nil
+}
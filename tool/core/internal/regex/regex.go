@@ -0,0 +1,164 @@
+// Package regex translates POSIX regular expressions for the regexp
+// package.
+package regex
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var errUnmatched = errors.New("unmatched [, [^, [:, [., or [=")
+
+// Convert translates a POSIX basic or extended regular expression into
+// the syntax of the regexp package. In basic expressions "\(", "\)", "\{",
+// "\}", "\|", "\+" and "\?" are operators and the bare characters are
+// literal; "*" is literal where it can not repeat anything. "\<" and "\>"
+// are word boundaries and backslashes are literal in bracket expressions.
+// Collating elements and equivalence classes, such as "[.a.]" and "[=a=]",
+// are single characters as in the C locale.
+func Convert(p string, bre bool) (string, error) {
+	var sb strings.Builder
+	// where "*" is literal: at the start of the expression or of a group
+	// and after an anchor or an alternation
+	start := true
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		atStart := start
+		start = false
+		switch c {
+		case '\\':
+			if i+1 == len(p) {
+				return "", fmt.Errorf("trailing backslash (\\)")
+			}
+			i++
+			c = p[i]
+			switch {
+			case bre && strings.IndexByte("(){}|+?", c) >= 0:
+				sb.WriteByte(c)
+				start = c == '(' || c == '|'
+			case c == '<' || c == '>':
+				sb.WriteString(`\b`)
+			case c >= '1' && c <= '9':
+				return "", fmt.Errorf("back-references are not supported: \\%c", c)
+			case c == 'w' || c == 'W' || c == 's' || c == 'S' || c == 'b' || c == 'B':
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+			case c == '`':
+				sb.WriteString(`\A`)
+			case c == '\'':
+				sb.WriteString(`\z`)
+			default:
+				literal(&sb, c)
+			}
+		case '[':
+			j, class, err := bracket(p, i)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(class)
+			i = j
+		case '*':
+			if atStart {
+				sb.WriteString(`\*`)
+			} else {
+				sb.WriteByte(c)
+			}
+		case '(', ')', '{', '}', '|', '+', '?':
+			if bre {
+				sb.WriteByte('\\')
+				sb.WriteByte(c)
+				continue
+			}
+			if c == '{' && !interval(p[i:]) {
+				// a brace not starting an interval is literal
+				sb.WriteString(`\{`)
+				continue
+			}
+			sb.WriteByte(c)
+			start = c == '(' || c == '|'
+		case '^':
+			sb.WriteByte(c)
+			start = true
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+// literal writes the escaped byte, escaping it again if it is special in
+// the regexp package. The bytes of multibyte characters are written as
+// they are.
+func literal(sb *strings.Builder, c byte) {
+	if strings.IndexByte(`\.+*?()|[]{}^$`, c) >= 0 {
+		sb.WriteByte('\\')
+	}
+	sb.WriteByte(c)
+}
+
+// interval reports whether s starts with an interval such as "{2}" or
+// "{1,3}".
+func interval(s string) bool {
+	end := strings.IndexByte(s, '}')
+	if end < 2 {
+		return false
+	}
+	lo, hi, _ := strings.Cut(s[1:end], ",")
+	return lo != "" && strings.Trim(lo, "0123456789") == "" && strings.Trim(hi, "0123456789") == ""
+}
+
+// bracket returns the end of the bracket expression at i and its
+// translation.
+func bracket(p string, i int) (int, string, error) {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	j := i + 1
+	if j < len(p) && p[j] == '^' {
+		sb.WriteByte('^')
+		j++
+	}
+	// a leading "]" is literal
+	if j < len(p) && p[j] == ']' {
+		sb.WriteString(`\]`)
+		j++
+	}
+	for ; j < len(p); j++ {
+		switch c := p[j]; c {
+		case ']':
+			sb.WriteByte(']')
+			return j, sb.String(), nil
+		case '[':
+			// character classes such as [:alpha:], collating elements such
+			// as [.-.] and equivalence classes such as [=a=]
+			if j+1 < len(p) && (p[j+1] == ':' || p[j+1] == '.' || p[j+1] == '=') {
+				kind := p[j+1]
+				end := strings.Index(p[j+2:], string(kind)+"]")
+				if end < 0 {
+					return -1, "", errUnmatched
+				}
+				name := p[j+2 : j+2+end]
+				j += 2 + end + 1
+				if kind == ':' {
+					sb.WriteString("[:" + name + ":]")
+					continue
+				}
+				if _, size := utf8.DecodeRuneInString(name); name == "" || size != len(name) {
+					return -1, "", fmt.Errorf("invalid collation character: %s", name)
+				}
+				if strings.Contains(`\]^-[`, name) {
+					sb.WriteByte('\\')
+				}
+				sb.WriteString(name)
+				continue
+			}
+			sb.WriteString(`\[`)
+		case '\\':
+			sb.WriteString(`\\`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return -1, "", errUnmatched
+}
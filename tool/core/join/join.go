@@ -0,0 +1,542 @@
+// Join joins the lines of two files on a common field.
+//
+// Synopsis:
+//
+//	join [OPTION]... FILE1 FILE2
+//
+// Description:
+//
+//	For each pair of lines of FILE1 and FILE2, sorted on their join
+//	fields, with identical join fields, join writes the join field
+//	followed by the other fields of both lines. Fields are separated by
+//	blanks, leading blanks ignored, unless -t is given. One of the files
+//	may be "-" for stdin.
+//
+//	FORMAT is a list of field specifications separated by commas or
+//	blanks: 0 for the join field or N.M for field M of file N. "auto"
+//	uses the fields of the first line of each file.
+//
+// Options:
+//
+//	-a FILENUM:           also print the unpairable lines of file FILENUM, 1 or 2
+//	-v FILENUM:           like -a, but print only the unpairable lines
+//	-e EMPTY:             replace missing input fields with EMPTY
+//	-i, --ignore-case:    ignore differences in case when comparing fields
+//	-j FIELD:             equivalent to -1 FIELD -2 FIELD
+//	-1 FIELD:             join on this field of file 1
+//	-2 FIELD:             join on this field of file 2
+//	-o FORMAT:            print the fields of FORMAT
+//	-t CHAR:              use CHAR as the input and output field separator
+//	    --check-order:    fail when the input is not sorted
+//	    --nocheck-order:  do not check the order of the input
+//	    --header:         treat the first line of each file as a header, printed unpaired
+//	-z, --zero-terminated: lines end with NUL, not newline
+//
+// Unless --nocheck-order is given, once a line was unpairable the order of
+// the files is checked; a disorder is reported and makes the exit status 1.
+package join
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the join core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new join command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+// fileList is -a and -v, which may be given twice.
+type fileList [2]bool
+
+func (l *fileList) String() string { return "" }
+func (l *fileList) Set(s string) error {
+	switch s {
+	case "1":
+		l[0] = true
+	case "2":
+		l[1] = true
+	default:
+		return fmt.Errorf("invalid file number: '%s'", s)
+	}
+	return nil
+}
+
+// formatList is -o, which may be given several times.
+type formatList []string
+
+func (l *formatList) String() string     { return strings.Join(*l, ",") }
+func (l *formatList) Set(s string) error { *l = append(*l, s); return nil }
+
+// separator is -t, which may be empty.
+type separator struct {
+	s   string
+	set bool
+}
+
+func (t *separator) String() string     { return t.s }
+func (t *separator) Set(s string) error { t.s, t.set = s, true; return nil }
+
+type flags struct {
+	unpaired     fileList
+	onlyUnpaired fileList
+	empty        string
+	ignoreCase   bool
+	join         int
+	field1       int
+	field2       int
+	format       formatList
+	sep          separator
+	checkOrder   bool
+	noCheck      bool
+	header       bool
+	zero         bool
+}
+
+// spec is a field of the output format, file 0 for the join field.
+type spec struct {
+	file, field int
+}
+
+// parseFormat parses the field specifications of -o.
+func parseFormat(list []string) ([]spec, error) {
+	var specs []spec
+	for _, l := range list {
+		for _, s := range strings.FieldsFunc(l, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if s == "0" {
+				specs = append(specs, spec{})
+				continue
+			}
+			file, field, ok := strings.Cut(s, ".")
+			n, err := strconv.Atoi(field)
+			if !ok || file != "1" && file != "2" || err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid field specifier: '%s'", s)
+			}
+			specs = append(specs, spec{int(file[0] - '0'), n - 1})
+		}
+	}
+	return specs, nil
+}
+
+// line is an input line split into fields.
+type line struct {
+	text   string
+	fields []string
+}
+
+// joiner joins the lines of two files.
+type joiner struct {
+	w   *bufio.Writer
+	eol byte
+	// the field separator, -1 for blanks
+	sep int
+	// the join fields counted from 0
+	field [2]int
+	// print the unpaired lines, the paired ones
+	unpaired [2]bool
+	paired   bool
+	empty    string
+	// output fields, autoformat if auto
+	specs      []spec
+	auto       bool
+	autoCount  [2]int
+	ignoreCase bool
+	// check the order: -1 never, 0 after an unpairable line, 1 always
+	check      int
+	unpairable bool
+	disorder   [2]bool
+	stderr     io.Writer
+}
+
+// split splits a line into its fields.
+func (j *joiner) split(text string) *line {
+	l := &line{text: text}
+	if text == "" {
+		return l
+	}
+	if j.sep >= 0 {
+		l.fields = strings.Split(text, string(rune(j.sep)))
+		return l
+	}
+	l.fields = strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' })
+	return l
+}
+
+// key returns the join field of a line of the file.
+func (j *joiner) key(l *line, file int) string {
+	if f := j.field[file]; f < len(l.fields) {
+		return l.fields[f]
+	}
+	return ""
+}
+
+func (j *joiner) compare(a, b string) int {
+	if j.ignoreCase {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// reader reads the lines of a file, checking their order.
+type reader struct {
+	j    *joiner
+	file int
+	name string
+	r    *bufio.Reader
+	eol  byte
+	n    int
+	prev *line
+}
+
+// next returns the next line, nil at the end.
+func (r *reader) next() (*line, error) {
+	text, err := r.r.ReadString(r.eol)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", r.name, err)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	text = strings.TrimSuffix(text, string(r.eol))
+	r.n++
+	l := r.j.split(text)
+	j := r.j
+	if r.prev != nil && !j.disorder[r.file] && (j.check > 0 || j.check == 0 && j.unpairable) {
+		if j.compare(j.key(r.prev, r.file), j.key(l, r.file)) > 0 {
+			j.disorder[r.file] = true
+			fmt.Fprintf(j.stderr, "join: %s:%d: is not sorted: %s\n", r.name, r.n, text)
+			if j.check > 0 {
+				return nil, errDisorder
+			}
+		}
+	}
+	r.prev = l
+	return l, nil
+}
+
+var errDisorder = errors.New("input is not in sorted order")
+
+// print writes the join of two lines, one of which may be nil.
+func (j *joiner) print(l1, l2 *line) {
+	sep := " "
+	if j.sep >= 0 && j.sep != '\n' {
+		sep = string(rune(j.sep))
+	}
+	field := func(l *line, i int) string {
+		if l != nil && i < len(l.fields) {
+			return l.fields[i]
+		}
+		return j.empty
+	}
+	if j.specs != nil {
+		for i, s := range j.specs {
+			if i > 0 {
+				j.w.WriteString(sep)
+			}
+			switch {
+			case s.file == 0 && l1 != nil:
+				j.w.WriteString(field(l1, j.field[0]))
+			case s.file == 0:
+				j.w.WriteString(field(l2, j.field[1]))
+			case s.file == 1:
+				j.w.WriteString(field(l1, s.field))
+			default:
+				j.w.WriteString(field(l2, s.field))
+			}
+		}
+		j.w.WriteByte(j.eol)
+		return
+	}
+	if l1 != nil {
+		j.w.WriteString(field(l1, j.field[0]))
+	} else {
+		j.w.WriteString(field(l2, j.field[1]))
+	}
+	for file, l := range []*line{l1, l2} {
+		n := 0
+		switch {
+		case j.auto:
+			n = j.autoCount[file]
+		case l != nil:
+			n = len(l.fields)
+		}
+		for i := range n {
+			if i != j.field[file] {
+				j.w.WriteString(sep)
+				j.w.WriteString(field(l, i))
+			}
+		}
+	}
+	j.w.WriteByte(j.eol)
+}
+
+// printUnpaired writes an unpairable line of the file if asked to.
+func (j *joiner) printUnpaired(l *line, file int) {
+	if !j.unpaired[file] {
+		return
+	}
+	if file == 0 {
+		j.print(l, nil)
+	} else {
+		j.print(nil, l)
+	}
+}
+
+// join joins the lines of the readers.
+func (j *joiner) join(ctx context.Context, r1, r2 *reader, header bool) error {
+	l1, err := r1.next()
+	if err != nil {
+		return err
+	}
+	l2, err := r2.next()
+	if err != nil {
+		return err
+	}
+	if j.auto {
+		if l1 != nil {
+			j.autoCount[0] = len(l1.fields)
+		}
+		if l2 != nil {
+			j.autoCount[1] = len(l2.fields)
+		}
+	}
+	if header && (l1 != nil || l2 != nil) {
+		j.print(l1, l2)
+		if l1 != nil {
+			if l1, err = r1.next(); err != nil {
+				return err
+			}
+		}
+		if l2 != nil {
+			if l2, err = r2.next(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for l1 != nil && l2 != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		k1, k2 := j.key(l1, 0), j.key(l2, 1)
+		switch c := j.compare(k1, k2); {
+		case c < 0:
+			j.printUnpaired(l1, 0)
+			if l1, err = r1.next(); err != nil {
+				return err
+			}
+			// as GNU join, the order is checked from the line after
+			j.unpairable = true
+			continue
+		case c > 0:
+			j.printUnpaired(l2, 1)
+			if l2, err = r2.next(); err != nil {
+				return err
+			}
+			j.unpairable = true
+			continue
+		}
+		// the groups of lines with equal join fields
+		group1 := []*line{l1}
+		for {
+			if l1, err = r1.next(); err != nil {
+				return err
+			}
+			if l1 == nil || j.compare(j.key(l1, 0), k2) != 0 {
+				break
+			}
+			group1 = append(group1, l1)
+		}
+		group2 := []*line{l2}
+		for {
+			if l2, err = r2.next(); err != nil {
+				return err
+			}
+			if l2 == nil || j.compare(j.key(l2, 1), k1) != 0 {
+				break
+			}
+			group2 = append(group2, l2)
+		}
+		if j.paired {
+			for _, a := range group1 {
+				for _, b := range group2 {
+					j.print(a, b)
+				}
+			}
+		}
+	}
+
+	j.unpairable = j.unpairable || l1 != nil || l2 != nil
+	for l1 != nil {
+		j.printUnpaired(l1, 0)
+		if l1, err = r1.next(); err != nil {
+			return err
+		}
+	}
+	for l2 != nil {
+		j.printUnpaired(l2, 1)
+		if l2, err = r2.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("join", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.Var(&f.unpaired, "a", "also print the unpairable lines of file FILENUM, 1 or 2")
+	fs.Var(&f.onlyUnpaired, "v", "like -a, but print only the unpairable lines")
+	fs.StringVar(&f.empty, "e", "", "replace missing input fields with EMPTY")
+	fs.BoolVar(&f.ignoreCase, "i", false, "ignore differences in case when comparing fields")
+	fs.BoolVar(&f.ignoreCase, "ignore-case", false, "ignore differences in case when comparing fields")
+	fs.IntVar(&f.join, "j", 0, "equivalent to -1 FIELD -2 FIELD")
+	fs.IntVar(&f.field1, "1", 0, "join on this field of file 1")
+	fs.IntVar(&f.field2, "2", 0, "join on this field of file 2")
+	fs.Var(&f.format, "o", "print the fields of FORMAT")
+	fs.Var(&f.sep, "t", "use CHAR as the input and output field separator")
+	fs.BoolVar(&f.checkOrder, "check-order", false, "fail when the input is not sorted")
+	fs.BoolVar(&f.noCheck, "nocheck-order", false, "do not check the order of the input")
+	fs.BoolVar(&f.header, "header", false, "treat the first line of each file as a header")
+	fs.BoolVar(&f.zero, "z", false, "lines end with NUL, not newline")
+	fs.BoolVar(&f.zero, "zero-terminated", false, "lines end with NUL, not newline")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "join [OPTION]... FILE1 FILE2\n\n")
+		fmt.Fprintf(fs.Output(), "Join joins the lines of two files on a common field.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(cli.Args(args, "a", "v", "e", "j", "1", "2", "o", "t")); err != nil {
+		return cli.Exit(1, err)
+	}
+
+	j := &joiner{
+		sep:        -1,
+		empty:      f.empty,
+		ignoreCase: f.ignoreCase,
+		paired:     true,
+		stderr:     c.Stderr,
+	}
+	j.unpaired = f.unpaired
+	if f.onlyUnpaired[0] || f.onlyUnpaired[1] {
+		j.unpaired, j.paired = f.onlyUnpaired, false
+	}
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, fl := range []struct {
+		name  string
+		n     int
+		files []int
+	}{{"j", f.join, []int{0, 1}}, {"1", f.field1, []int{0}}, {"2", f.field2, []int{1}}} {
+		if !set[fl.name] {
+			continue
+		}
+		if fl.n < 1 {
+			return cli.Exit(1, fmt.Errorf("invalid field number: '%d'", fl.n))
+		}
+		for _, i := range fl.files {
+			j.field[i] = fl.n - 1
+		}
+	}
+	switch {
+	case !f.sep.set:
+	case f.sep.s == "":
+		// the whole line is the field
+		j.sep = '\n'
+	case f.sep.s == `\0`:
+		j.sep = 0
+	case len([]rune(f.sep.s)) == 1:
+		j.sep = int([]rune(f.sep.s)[0])
+	default:
+		return cli.Exit(1, fmt.Errorf("multi-character tab '%s'", f.sep.s))
+	}
+	if len(f.format) == 1 && f.format[0] == "auto" {
+		j.auto = true
+	} else if len(f.format) > 0 {
+		specs, err := parseFormat(f.format)
+		if err != nil {
+			return cli.Exit(1, err)
+		}
+		j.specs = specs
+	}
+	switch {
+	case f.noCheck:
+		j.check = -1
+	case f.checkOrder:
+		j.check = 1
+	}
+
+	names := fs.Args()
+	switch len(names) {
+	case 0:
+		return cli.Exit(1, errors.New("missing operand"))
+	case 1:
+		return cli.Exit(1, fmt.Errorf("missing operand after '%s'", names[0]))
+	case 2:
+	default:
+		return cli.Exit(1, fmt.Errorf("extra operand '%s'", names[2]))
+	}
+	eol := byte('\n')
+	if f.zero {
+		eol = 0
+	}
+	var readers [2]*reader
+	for i, name := range names {
+		r, err := cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+		if err != nil {
+			return cli.Exit(1, err)
+		}
+		defer r.Close()
+		readers[i] = &reader{j: j, file: i, name: name, r: bufio.NewReader(r), eol: eol}
+	}
+
+	j.w, j.eol = bufio.NewWriter(c.Stdout), eol
+	err := j.join(ctx, readers[0], readers[1], f.header)
+	if ferr := j.w.Flush(); err == nil && ferr != nil {
+		err = ferr
+	}
+	if errors.Is(err, errDisorder) {
+		// already reported
+		return cli.Exit(1, nil)
+	}
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+	if j.disorder[0] || j.disorder[1] {
+		return cli.Exit(1, errDisorder)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package join
+
+import (
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestJoin(t *testing.T) {
+	golden.Run(t, "join", New)
+}
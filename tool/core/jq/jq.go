@@ -0,0 +1,112 @@
+// Jq processes JSON.
+//
+// Synopsis:
+//
+//	jq [OPTION]... PROGRAM [FILE]...
+//
+// Description:
+//
+//	Jq runs the jq PROGRAM on each JSON value of the files, or of stdin,
+//	and writes the results as JSON. The language is that of gojq: keys of
+//	objects are always sorted, numbers keep their precision and $ENV is
+//	empty. The variables of --arg and --argjson are also in $ARGS.named.
+//
+//	The exit status is 2 for invalid input, 3 for an invalid program and
+//	5 if the program fails. With -e it is 1 if the last result is false or
+//	null and 4 if there is none; halt_error sets its own.
+//
+// Options:
+//
+//	-r, --raw-output:       write strings without quotes
+//	-j, --join-output:      like -r without newlines after the results
+//	-c, --compact-output:   write each result on one line
+//	-s, --slurp:            run the program once on the array of the inputs
+//	-n, --null-input:       run the program once on null, the inputs being read by input
+//	-R, --raw-input:        read the lines of the input as strings, or the whole input with -s
+//	-e, --exit-status:      set the exit status from the last result
+//	-S, --sort-keys:        sort the keys of objects (always done)
+//	    --tab:              indent with a tab
+//	    --indent N:         indent with N spaces (default: 2)
+//	    --arg NAME VALUE:   set $NAME to the string VALUE
+//	    --argjson NAME TEXT: set $NAME to the JSON TEXT
+package jq
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/tool/core/internal/query"
+)
+
+// command implements the jq core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new jq command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var o query.Options
+
+	fs := flag.NewFlagSet("jq", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	o.Flags(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "jq [OPTION]... PROGRAM [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Jq processes JSON.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "  --arg NAME VALUE\n    \tset $NAME to the string VALUE\n")
+		fmt.Fprintf(fs.Output(), "  --argjson NAME TEXT\n    \tset $NAME to the JSON TEXT\n")
+	}
+
+	args, err := o.Args(args)
+	if err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	if err := fs.Parse(cli.Args(args, query.Valued...)); err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	if err := o.CheckIndent(); err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return cli.Exit(query.ExitUsage, nil)
+	}
+
+	open := func(name string) (io.ReadCloser, error) {
+		return cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+	}
+	inputs := query.NewInputs(fs.Args()[1:], open, query.DecodeJSON, &o)
+	prog, err := query.Compile(fs.Arg(0), &o, inputs)
+	if err != nil {
+		return cli.Exit(query.ExitCompile, err)
+	}
+	write := func(v any) error {
+		return o.WriteJSON(c.Stdout, v)
+	}
+	return prog.Run(ctx, "jq", &o, inputs, write, c.Stderr)
+}
@@ -0,0 +1,11 @@
+package jq
+
+import (
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestJq(t *testing.T) {
+	golden.Run(t, "jq", New)
+}
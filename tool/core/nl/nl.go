@@ -0,0 +1,311 @@
+// Nl numbers lines.
+//
+// Synopsis:
+//
+//	nl [OPTION]... [FILE]...
+//
+// Description:
+//
+//	Nl writes the lines of the files, or of stdin, with line numbers.
+//	The input is made of logical pages of header, body and footer
+//	sections, started by lines of the section delimiter CC repeated three,
+//	two and one times. Those lines are written as empty lines and restart
+//	the numbering unless -p is given; input without them is one body.
+//
+//	STYLE is one of a (all lines), t (non-empty lines), n (no lines) or
+//	pBRE (lines matching the basic regular expression BRE). FORMAT is one
+//	of ln (left justified), rn (right justified) or rz (right justified,
+//	padded with zeros).
+//
+// Options:
+//
+//	-b, --body-numbering STYLE:      number the lines of bodies (default: t)
+//	-h, --header-numbering STYLE:    number the lines of headers (default: n)
+//	-f, --footer-numbering STYLE:    number the lines of footers (default: n)
+//	-d, --section-delimiter CC:      use CC to delimit sections (default: \:)
+//	-i, --line-increment NUMBER:     add NUMBER to the line number at each line (default: 1)
+//	-l, --join-blank-lines NUMBER:   count a group of NUMBER empty lines as one (default: 1)
+//	-n, --number-format FORMAT:      format the line numbers (default: rn)
+//	-p, --no-renumber:               do not reset the line numbers at sections
+//	-s, --number-separator STRING:   write STRING after the line numbers (default: TAB)
+//	-v, --starting-line-number NUMBER: the first line number of each section (default: 1)
+//	-w, --number-width NUMBER:       use NUMBER columns for the line numbers (default: 6)
+package nl
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/tool/core/internal/regex"
+)
+
+// command implements the nl core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new nl command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	body, header, footer string
+	delimiter            string
+	increment            int
+	join                 int
+	format               string
+	noRenumber           bool
+	separator            string
+	start                int
+	width                int
+}
+
+// maxWidth is the widest line number field fmt can pad.
+const maxWidth = 1_000_000
+
+// style selects the lines to number.
+type style struct {
+	kind byte
+	re   *regexp.Regexp
+}
+
+func parseStyle(s, option string) (style, error) {
+	switch {
+	case s == "a" || s == "t" || s == "n":
+		return style{kind: s[0]}, nil
+	case strings.HasPrefix(s, "p"):
+		p, err := regex.Convert(s[1:], true)
+		if err == nil {
+			var re *regexp.Regexp
+			if re, err = regexp.Compile(p); err == nil {
+				return style{kind: 'p', re: re}, nil
+			}
+		}
+		return style{}, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	return style{}, fmt.Errorf("invalid %s numbering style: '%s'", option, s)
+}
+
+// section of a logical page.
+const (
+	header = iota
+	body
+	footer
+)
+
+// numberer numbers lines.
+type numberer struct {
+	w          *bufio.Writer
+	styles     [3]style
+	delimiter  string
+	increment  int
+	join       int
+	format     string
+	renumber   bool
+	separator  string
+	start      int
+	width      int
+	section    int
+	number     int
+	blankLines int
+}
+
+// line writes the line, without its newline.
+func (n *numberer) line(line string) {
+	if n.delimiter != "" {
+		for s, count := range []int{3, 2, 1} {
+			if line == strings.Repeat(n.delimiter, count) {
+				n.section = s
+				if n.renumber {
+					n.number = n.start
+				}
+				n.w.WriteByte('\n')
+				return
+			}
+		}
+	}
+	number := false
+	switch st := n.styles[n.section]; st.kind {
+	case 'a':
+		number = true
+		if n.join > 1 {
+			n.blankLines++
+			number = line != "" || n.blankLines == n.join
+			if number {
+				n.blankLines = 0
+			}
+		}
+	case 't':
+		number = line != ""
+	case 'p':
+		number = st.re.MatchString(line)
+	}
+	if !number {
+		n.w.WriteString(strings.Repeat(" ", n.width+len(n.separator)))
+		n.w.WriteString(line)
+		n.w.WriteByte('\n')
+		return
+	}
+	switch n.format {
+	case "ln":
+		fmt.Fprintf(n.w, "%-*d", n.width, n.number)
+	case "rz":
+		fmt.Fprintf(n.w, "%0*d", n.width, n.number)
+	default:
+		fmt.Fprintf(n.w, "%*d", n.width, n.number)
+	}
+	n.w.WriteString(n.separator)
+	n.w.WriteString(line)
+	n.w.WriteByte('\n')
+	n.number += n.increment
+}
+
+func (n *numberer) copy(ctx context.Context, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := br.ReadString('\n')
+		if line != "" {
+			n.line(strings.TrimSuffix(line, "\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("nl", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	stringVar := func(p *string, short, long, value, usage string) {
+		fs.StringVar(p, short, value, usage)
+		fs.StringVar(p, long, value, usage)
+	}
+	intVar := func(p *int, short, long string, value int, usage string) {
+		fs.IntVar(p, short, value, usage)
+		fs.IntVar(p, long, value, usage)
+	}
+	stringVar(&f.body, "b", "body-numbering", "t", "number the lines of bodies")
+	stringVar(&f.header, "h", "header-numbering", "n", "number the lines of headers")
+	stringVar(&f.footer, "f", "footer-numbering", "n", "number the lines of footers")
+	stringVar(&f.delimiter, "d", "section-delimiter", `\:`, "use CC to delimit sections")
+	intVar(&f.increment, "i", "line-increment", 1, "add NUMBER to the line number at each line")
+	intVar(&f.join, "l", "join-blank-lines", 1, "count a group of NUMBER empty lines as one")
+	stringVar(&f.format, "n", "number-format", "rn", "format the line numbers: ln, rn or rz")
+	fs.BoolVar(&f.noRenumber, "p", false, "do not reset the line numbers at sections")
+	fs.BoolVar(&f.noRenumber, "no-renumber", false, "do not reset the line numbers at sections")
+	stringVar(&f.separator, "s", "number-separator", "\t", "write STRING after the line numbers")
+	intVar(&f.start, "v", "starting-line-number", 1, "the first line number of each section")
+	intVar(&f.width, "w", "number-width", 6, "use NUMBER columns for the line numbers")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "nl [OPTION]... [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Nl numbers lines.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	valued := []string{
+		"b", "body-numbering", "h", "header-numbering", "f", "footer-numbering", "d", "section-delimiter",
+		"i", "line-increment", "l", "join-blank-lines", "n", "number-format", "s", "number-separator",
+		"v", "starting-line-number", "w", "number-width",
+	}
+	if err := fs.Parse(cli.Args(args, valued...)); err != nil {
+		return cli.Exit(1, err)
+	}
+
+	n := &numberer{
+		w:         bufio.NewWriter(c.Stdout),
+		delimiter: f.delimiter,
+		increment: f.increment,
+		join:      f.join,
+		format:    f.format,
+		renumber:  !f.noRenumber,
+		separator: f.separator,
+		start:     f.start,
+		width:     f.width,
+		section:   body,
+		number:    f.start,
+	}
+	for i, s := range []struct{ style, name string }{{f.header, "header"}, {f.body, "body"}, {f.footer, "footer"}} {
+		st, err := parseStyle(s.style, s.name)
+		if err != nil {
+			return cli.Exit(1, err)
+		}
+		n.styles[i] = st
+	}
+	if len(n.delimiter) == 1 {
+		// a lone character is followed by the default second one
+		n.delimiter += ":"
+	}
+	switch {
+	case f.format != "ln" && f.format != "rn" && f.format != "rz":
+		return cli.Exit(1, fmt.Errorf("invalid line numbering format: '%s'", f.format))
+	case f.width < 1 || f.width > maxWidth:
+		return cli.Exit(1, fmt.Errorf("invalid line number field width: '%d'", f.width))
+	case f.join < 1:
+		return cli.Exit(1, fmt.Errorf("invalid line number of blank lines: '%d'", f.join))
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	failed := false
+	for _, name := range names {
+		r, err := cli.Open(c.f, c.Stdin, name, c.ResolvePath(name))
+		if err != nil {
+			n.w.Flush()
+			fmt.Fprintf(c.Stderr, "nl: %v\n", err)
+			failed = true
+			continue
+		}
+		err = n.copy(ctx, r)
+		r.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			n.w.Flush()
+			fmt.Fprintf(c.Stderr, "nl: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if err := n.w.Flush(); err != nil {
+		return cli.Exit(1, err)
+	}
+	if failed {
+		return cli.Exit(1, nil)
+	}
+	return nil
+}
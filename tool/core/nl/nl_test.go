@@ -0,0 +1,11 @@
+package nl
+
+import (
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestNl(t *testing.T) {
+	golden.Run(t, "nl", New)
+}
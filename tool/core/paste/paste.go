@@ -0,0 +1,244 @@
+// Paste merges lines of files.
+//
+// Synopsis:
+//
+//	paste [OPTION]... [FILE]...
+//
+// Description:
+//
+//	Paste writes the lines of the files side by side, separated by TABs,
+//	or one file per line with -s. The delimiters of LIST are used in
+//	turn; \n, \t, \\ and \0 (no delimiter) are recognized. A "-" operand
+//	reads the next line of stdin, stdin may be given several times.
+//
+// Options:
+//
+//	-d, --delimiters LIST:  use the delimiters of LIST instead of TAB
+//	-s, --serial:           paste the lines of one file at a time
+//	-z, --zero-terminated:  lines end with NUL, not newline
+package paste
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the paste core utility.
+type command struct {
+	core.Base
+
+	f fs.FS
+}
+
+// New creates a new paste command.
+func New(f fs.FS) core.Command {
+	c := &command{
+		f: f,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	delimiters string
+	serial     bool
+	zero       bool
+}
+
+// parseDelimiters decodes the escapes of the list. The empty string is
+// no delimiter.
+func parseDelimiters(list string) ([]string, error) {
+	var delims []string
+	for i := 0; i < len(list); i++ {
+		if list[i] != '\\' {
+			delims = append(delims, list[i:i+1])
+			continue
+		}
+		if i+1 == len(list) {
+			return nil, fmt.Errorf("delimiter list ends with an unescaped backslash: %s", list)
+		}
+		i++
+		switch c := list[i]; c {
+		case 'n':
+			delims = append(delims, "\n")
+		case 't':
+			delims = append(delims, "\t")
+		case '0':
+			delims = append(delims, "")
+		default:
+			delims = append(delims, string(c))
+		}
+	}
+	return delims, nil
+}
+
+// input is an operand being read.
+type input struct {
+	name string
+	r    *bufio.Reader
+	c    io.Closer
+	eof  bool
+}
+
+// next reads the next line without its terminator.
+func (in *input) next(eol byte) (string, bool, error) {
+	if in.eof {
+		return "", false, nil
+	}
+	line, err := in.r.ReadString(eol)
+	if err == io.EOF {
+		in.eof = true
+		return line, line != "", nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %w", in.name, err)
+	}
+	return line[:len(line)-1], true, nil
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("paste", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.StringVar(&f.delimiters, "d", "\t", "use the delimiters of LIST instead of TAB")
+	fs.StringVar(&f.delimiters, "delimiters", "\t", "use the delimiters of LIST instead of TAB")
+	fs.BoolVar(&f.serial, "s", false, "paste the lines of one file at a time")
+	fs.BoolVar(&f.serial, "serial", false, "paste the lines of one file at a time")
+	fs.BoolVar(&f.zero, "z", false, "lines end with NUL, not newline")
+	fs.BoolVar(&f.zero, "zero-terminated", false, "lines end with NUL, not newline")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "paste [OPTION]... [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Paste merges lines of files.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(cli.Args(args, "d", "delimiters")); err != nil {
+		return cli.Exit(1, err)
+	}
+
+	delims, err := parseDelimiters(f.delimiters)
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+	if len(delims) == 0 {
+		delims = []string{""}
+	}
+	eol := byte('\n')
+	if f.zero {
+		eol = 0
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	// stdin is shared by its operands
+	stdin := bufio.NewReader(c.Stdin)
+	inputs := make([]*input, 0, len(names))
+	defer func() {
+		for _, in := range inputs {
+			if in.c != nil {
+				in.c.Close()
+			}
+		}
+	}()
+	for _, name := range names {
+		if name == "-" {
+			inputs = append(inputs, &input{name: name, r: stdin})
+			continue
+		}
+		r, err := cli.Open(c.f, nil, name, c.ResolvePath(name))
+		if err != nil {
+			return cli.Exit(1, err)
+		}
+		inputs = append(inputs, &input{name: name, r: bufio.NewReader(r), c: r})
+	}
+
+	w := bufio.NewWriter(c.Stdout)
+	if f.serial {
+		err = c.serial(ctx, w, inputs, delims, eol)
+	} else {
+		err = c.parallel(ctx, w, inputs, delims, eol)
+	}
+	if ferr := w.Flush(); err == nil && ferr != nil {
+		err = ferr
+	}
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+	return nil
+}
+
+// parallel writes a line of every input per output line, until all of
+// them end.
+func (c *command) parallel(ctx context.Context, w *bufio.Writer, inputs []*input, delims []string, eol byte) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var line []byte
+		more := false
+		for i, in := range inputs {
+			s, ok, err := in.next(eol)
+			if err != nil {
+				return err
+			}
+			more = more || ok
+			line = append(line, s...)
+			if i < len(inputs)-1 {
+				line = append(line, delims[i%len(delims)]...)
+			}
+		}
+		if !more {
+			return nil
+		}
+		w.Write(line)
+		w.WriteByte(eol)
+	}
+}
+
+// serial writes the lines of each input on one line.
+func (c *command) serial(ctx context.Context, w *bufio.Writer, inputs []*input, delims []string, eol byte) error {
+	for _, in := range inputs {
+		n := 0
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			s, ok, err := in.next(eol)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			if n > 0 {
+				w.WriteString(delims[(n-1)%len(delims)])
+			}
+			w.WriteString(s)
+			n++
+		}
+		if err := w.WriteByte(eol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
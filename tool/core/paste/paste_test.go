@@ -0,0 +1,11 @@
+package paste
+
+import (
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestPaste(t *testing.T) {
+	golden.Run(t, "paste", New)
+}
@@ -0,0 +1,206 @@
+// Patch applies a unified or git style diff to workspace files.
+//
+// Synopsis:
+//
+//	patch [OPTIONS] [ORIGFILE [PATCHFILE]]
+//
+// Description:
+//
+//	The patch is read from PATCHFILE, the -i option or stdin. Hunks
+//	that do not apply are reported and the exit status is 1.
+//
+// Options:
+//
+//	-p, --strip NUM:         strip NUM leading components from file names
+//	-F, --fuzz NUM:          ignore up to NUM context lines (default: 2)
+//	-l, --ignore-whitespace: ignore white space differences in context
+//	-R, --reverse:           undo the patch
+//	-i, --input FILE:        read the patch from FILE
+//	-d, --directory DIR:     change to DIR first
+//	    --dry-run:           only report what would happen
+//	-s, --silent:            report failures only
+package patch
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+var errUsage = errors.New("usage: patch [OPTIONS] [ORIGFILE [PATCHFILE]]")
+
+// command implements the patch core utility.
+type command struct {
+	core.Base
+
+	ws vfs.Workspace
+}
+
+// New creates a new patch command.
+func New(ws vfs.Workspace) core.Command {
+	c := &command{
+		ws: ws,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	strip      int
+	fuzz       int
+	whitespace bool
+	reverse    bool
+	input      string
+	dir        string
+	dryRun     bool
+	silent     bool
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("patch", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.IntVar(&f.strip, "p", -1, "strip NUM leading components from file names")
+	fs.IntVar(&f.strip, "strip", -1, "strip NUM leading components from file names")
+	fs.IntVar(&f.fuzz, "F", 2, "ignore up to NUM context lines")
+	fs.IntVar(&f.fuzz, "fuzz", 2, "ignore up to NUM context lines")
+	fs.BoolVar(&f.whitespace, "l", false, "ignore white space differences in context")
+	fs.BoolVar(&f.whitespace, "ignore-whitespace", false, "ignore white space differences in context")
+	fs.BoolVar(&f.reverse, "R", false, "undo the patch")
+	fs.BoolVar(&f.reverse, "reverse", false, "undo the patch")
+	fs.StringVar(&f.input, "i", "", "read the patch from FILE")
+	fs.StringVar(&f.input, "input", "", "read the patch from FILE")
+	fs.StringVar(&f.dir, "d", "", "change to DIR first")
+	fs.StringVar(&f.dir, "directory", "", "change to DIR first")
+	fs.BoolVar(&f.dryRun, "dry-run", false, "only report what would happen")
+	fs.BoolVar(&f.silent, "s", false, "report failures only")
+	fs.BoolVar(&f.silent, "silent", false, "report failures only")
+	fs.BoolVar(&f.silent, "quiet", false, "report failures only")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "patch [OPTIONS] [ORIGFILE [PATCHFILE]]\n\n")
+		fmt.Fprintf(fs.Output(), "Patch applies a unified or git style diff to workspace files.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(cli.Args(args, "p", "strip", "F", "fuzz", "i", "input", "d", "directory")); err != nil {
+		return cli.Exit(2, err)
+	}
+
+	o := &vfs.PatchOptions{
+		Strip:            f.strip,
+		Fuzz:             f.fuzz,
+		IgnoreWhitespace: f.whitespace,
+		Reverse:          f.reverse,
+		DryRun:           f.dryRun,
+		Dir:              c.ResolvePath(f.dir),
+	}
+
+	input := f.input
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		o.File = c.resolve(o.Dir, fs.Arg(0))
+	case 2:
+		o.File = c.resolve(o.Dir, fs.Arg(0))
+		input = fs.Arg(1)
+	default:
+		return cli.Exit(2, errUsage)
+	}
+
+	var patch []byte
+	var err error
+	if input == "" || input == "-" {
+		patch, err = io.ReadAll(c.Stdin)
+	} else {
+		patch, err = c.ws.ReadFile(c.ResolvePath(input), nil)
+	}
+	if err != nil {
+		return cli.Exit(2, err)
+	}
+
+	result, err := vfs.ApplyPatch(c.ws, string(patch), o)
+	if result != nil {
+		c.report(result, &f)
+	}
+	if err != nil {
+		return cli.Exit(2, err)
+	}
+	if result.Failed() > 0 {
+		return cli.Exit(1, nil)
+	}
+	return nil
+}
+
+func (c *command) resolve(dir, name string) string {
+	if filepath.IsAbs(name) || dir == "" {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// report prints the outcome in the format of GNU patch.
+func (c *command) report(result *vfs.PatchResult, f *flags) {
+	verb := "patching"
+	if f.dryRun {
+		verb = "checking"
+	}
+	for _, r := range result.Files {
+		if !f.silent {
+			switch {
+			case r.From != "":
+				fmt.Fprintf(c.Stdout, "%s file %s (renamed from %s)\n", verb, r.Path, r.From)
+			case r.Created:
+				fmt.Fprintf(c.Stdout, "%s file %s (created)\n", verb, r.Path)
+			case r.Deleted:
+				fmt.Fprintf(c.Stdout, "%s file %s (removed)\n", verb, r.Path)
+			default:
+				fmt.Fprintf(c.Stdout, "%s file %s\n", verb, r.Path)
+			}
+		}
+		if r.Error != "" {
+			fmt.Fprintf(c.Stderr, "patch: %s: %s\n", r.Path, r.Error)
+		}
+		for i, h := range r.Hunks {
+			switch {
+			case !h.Applied:
+				fmt.Fprintf(c.Stdout, "Hunk #%d FAILED at %d.\n", i+1, h.Line)
+			case f.silent:
+			case h.Offset != 0 && h.Fuzz != 0:
+				fmt.Fprintf(c.Stdout, "Hunk #%d succeeded at %d with fuzz %d (offset %d %s).\n", i+1, h.Line, h.Fuzz, h.Offset, lines(h.Offset))
+			case h.Offset != 0:
+				fmt.Fprintf(c.Stdout, "Hunk #%d succeeded at %d (offset %d %s).\n", i+1, h.Line, h.Offset, lines(h.Offset))
+			case h.Fuzz != 0:
+				fmt.Fprintf(c.Stdout, "Hunk #%d succeeded at %d with fuzz %d.\n", i+1, h.Line, h.Fuzz)
+			}
+		}
+		if len(r.Rejects) > 0 {
+			fmt.Fprintf(c.Stdout, "%d out of %d hunks FAILED\n", len(r.Rejects), len(r.Hunks))
+			fmt.Fprint(c.Stdout, vfs.FormatHunks(r.Path, r.Path, r.Rejects))
+		}
+	}
+}
+
+func lines(n int) string {
+	if n == 1 || n == -1 {
+		return "line"
+	}
+	return "lines"
+}
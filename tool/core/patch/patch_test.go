@@ -0,0 +1,206 @@
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+func setup(t *testing.T, files map[string]string) (string, vfs.Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func run(t *testing.T, ws vfs.Workspace, dir string, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := New(ws)
+	var stdout, stderr bytes.Buffer
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	cmd.SetWorkingDir(dir)
+	err := cmd.Run(args...)
+	return stdout.String() + stderr.String(), err
+}
+
+func exitCode(err error) int {
+	var e *cli.ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+const gitPatch = `diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+
+func TestPatchGit(t *testing.T) {
+	dir, ws := setup(t, map[string]string{
+		"a.txt":   "one\ntwo\nthree\n",
+		"old.txt": "bye\n",
+	})
+	out, err := run(t, ws, dir, gitPatch)
+	if err != nil {
+		t.Fatalf("patch failed: %v\n%s", err, out)
+	}
+	for name, want := range map[string]string{
+		"a.txt":   "one\n2\nthree\n",
+		"new.txt": "hello\nworld\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("old.txt not removed: %v", err)
+	}
+
+	// and back
+	if out, err := run(t, ws, dir, gitPatch, "-R"); err != nil {
+		t.Fatalf("reverse patch failed: %v\n%s", err, out)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(got) != "one\ntwo\nthree\n" {
+		t.Errorf("reverse a.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("new.txt not removed: %v", err)
+	}
+}
+
+func TestPatchOffsetAndFuzz(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		patch   string
+		args    []string
+		want    string
+		message string
+		code    int
+	}{
+		{
+			name:    "offset",
+			content: "x\ny\na\nb\nc\n",
+			patch:   "--- f\n+++ f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:    "x\ny\na\nB\nc\n",
+			message: "Hunk #1 succeeded at 3 (offset 2 lines).",
+		},
+		{
+			name:    "fuzz",
+			content: "a\nb\nc\nd\nX\n",
+			patch:   "--- f\n+++ f\n@@ -2,3 +2,3 @@\n b\n-c\n+C\n e\n",
+			want:    "a\nb\nC\nd\nX\n",
+			message: "with fuzz 1",
+		},
+		{
+			name:    "no fuzz",
+			content: "a\nb\nc\nd\nX\n",
+			patch:   "--- f\n+++ f\n@@ -2,3 +2,3 @@\n b\n-c\n+C\n e\n",
+			args:    []string{"-F0"},
+			want:    "a\nb\nc\nd\nX\n",
+			message: "Hunk #1 FAILED at 2.",
+			code:    1,
+		},
+		{
+			name:    "whitespace",
+			content: "a\n  b\nc\n",
+			patch:   "--- f\n+++ f\n@@ -1,3 +1,3 @@\n a\n b\n-c\n+C\n",
+			args:    []string{"-l"},
+			want:    "a\n  b\nC\n",
+		},
+		{
+			name:    "no newline",
+			content: "a\nb",
+			patch:   "--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+			want:    "a\nc\n",
+		},
+		{
+			name:    "dry run",
+			content: "a\n",
+			patch:   "--- f\n+++ f\n@@ -1 +1 @@\n-a\n+b\n",
+			args:    []string{"--dry-run"},
+			want:    "a\n",
+			message: "checking file",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := setup(t, map[string]string{"f": tt.content})
+			out, err := run(t, ws, dir, tt.patch, tt.args...)
+			if code := exitCode(err); code != tt.code {
+				t.Fatalf("exit code %d (%v), want %d\n%s", code, err, tt.code, out)
+			}
+			if !strings.Contains(out, tt.message) {
+				t.Errorf("output %q does not contain %q", out, tt.message)
+			}
+			got, _ := os.ReadFile(filepath.Join(dir, "f"))
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchFileArgs(t *testing.T) {
+	dir, ws := setup(t, map[string]string{
+		"target.txt": "a\nb\n",
+		"fix.patch":  "--- other\n+++ other\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+	})
+	if out, err := run(t, ws, dir, "", "target.txt", "fix.patch"); err != nil {
+		t.Fatalf("patch failed: %v\n%s", err, out)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "target.txt"))
+	if string(got) != "a\nc\n" {
+		t.Errorf("got %q", got)
+	}
+
+	_, err := run(t, ws, dir, "garbage\n")
+	if code := exitCode(err); code != 2 {
+		t.Errorf("exit code %d for an invalid patch, want 2", code)
+	}
+}
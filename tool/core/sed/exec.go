@@ -0,0 +1,563 @@
+package sed
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// output is stdout or the file of a w command. A line written without its
+// newline, the last one of an input without a final newline, gets it
+// before anything else is written.
+type output struct {
+	w              *bufio.Writer
+	c              io.Closer
+	eol            byte
+	missingNewline bool
+}
+
+func (o *output) fix() {
+	if o.missingNewline {
+		o.w.WriteByte(o.eol)
+		o.missingNewline = false
+	}
+}
+
+// line writes s followed by the end of line if newline is set.
+func (o *output) line(s string, newline bool) {
+	o.fix()
+	o.w.WriteString(s)
+	if newline {
+		o.w.WriteByte(o.eol)
+	} else {
+		o.missingNewline = true
+	}
+}
+
+// raw writes s as it is.
+func (o *output) raw(s string) {
+	o.fix()
+	o.w.WriteString(s)
+}
+
+// input reads the lines of a sequence of files, one line ahead to know
+// the last one.
+type input struct {
+	names []string
+	// open opens an input, reporting its errors
+	open func(name string) (io.ReadCloser, bool)
+	eol  byte
+
+	r    *bufio.Reader
+	c    io.Closer
+	name string
+
+	next     string
+	nextNL   bool
+	nextName string
+	hasNext  bool
+	err      error
+}
+
+// fill reads the next line ahead, opening the next files as needed.
+func (in *input) fill() {
+	for !in.hasNext && in.err == nil {
+		if in.r == nil {
+			if len(in.names) == 0 {
+				return
+			}
+			name := in.names[0]
+			in.names = in.names[1:]
+			rc, ok := in.open(name)
+			if !ok {
+				continue
+			}
+			in.r, in.c, in.name = bufio.NewReader(rc), rc, name
+		}
+		line, err := in.r.ReadString(in.eol)
+		if line != "" {
+			in.next, in.nextName, in.hasNext = line, in.name, true
+			in.nextNL = strings.HasSuffix(line, string(in.eol))
+			if in.nextNL {
+				in.next = line[:len(line)-1]
+			}
+		}
+		if err == io.EOF {
+			in.close()
+		} else if err != nil {
+			in.err = fmt.Errorf("read error on %s: %w", in.name, err)
+		}
+	}
+}
+
+func (in *input) close() {
+	if in.c != nil {
+		in.c.Close()
+	}
+	in.r, in.c = nil, nil
+}
+
+// read returns the next line, its file and whether it ended with a
+// newline.
+func (in *input) read() (line, name string, nl, ok bool) {
+	in.fill()
+	if !in.hasNext {
+		return "", "", false, false
+	}
+	in.hasNext = false
+	return in.next, in.nextName, in.nextNL, true
+}
+
+// last reports whether there is no line after the current one.
+func (in *input) last() bool {
+	in.fill()
+	return !in.hasNext
+}
+
+// action ends the execution of the script on a line.
+type action int
+
+const (
+	actEnd        action = iota // write the pattern space, unless -n
+	actDelete                   // start the next cycle
+	actRestart                  // start the next cycle without reading a line
+	actQuit                     // write the pattern space and quit
+	actQuitSilent               // quit
+)
+
+// queued is the text of a, r and R written at the end of the cycle.
+type queued struct {
+	text string
+	// file is read by r, one line of it by R
+	file    string
+	oneLine bool
+}
+
+// engine executes a script.
+type engine struct {
+	cmds     []*cmd
+	quiet    bool
+	lineWrap int
+	out      *output
+	// readFile reads the file of r, openLines the file of R
+	readFile  func(name string) ([]byte, error)
+	openLines func(name string) (*bufio.Reader, error)
+
+	in       *input
+	ps, hs   string
+	nl       bool
+	name     string
+	line     int
+	lastRe   *regexp.Regexp
+	replaced bool
+	appends  []queued
+	rlines   map[string]*bufio.Reader
+	quit     bool
+	exit     int
+}
+
+// run executes the script on the lines of the input.
+func (e *engine) run(ctx context.Context, in *input) error {
+	e.in = in
+	restart := false
+	for !e.quit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !restart {
+			if !e.readLine() {
+				break
+			}
+			e.replaced = false
+		}
+		restart = false
+		act, err := e.execute()
+		if err != nil {
+			return err
+		}
+		switch act {
+		case actEnd, actQuit:
+			if !e.quiet {
+				e.out.line(e.ps, e.nl)
+			}
+		case actRestart:
+			restart = true
+		}
+		if act != actQuitSilent {
+			e.flushAppends()
+		}
+		e.quit = e.quit || act == actQuit || act == actQuitSilent
+	}
+	return in.err
+}
+
+// readLine replaces the pattern space with the next line.
+func (e *engine) readLine() bool {
+	line, name, nl, ok := e.in.read()
+	if !ok {
+		return false
+	}
+	e.ps, e.name, e.nl = line, name, nl
+	e.line++
+	return true
+}
+
+func (e *engine) flushAppends() {
+	for _, q := range e.appends {
+		switch {
+		case q.file == "":
+			e.out.raw(q.text)
+		case q.oneLine:
+			r, ok := e.rlines[q.file]
+			if !ok {
+				r, _ = e.openLines(q.file)
+				e.rlines[q.file] = r
+			}
+			if r == nil {
+				continue
+			}
+			if line, _ := r.ReadString(e.out.eol); line != "" {
+				e.out.line(strings.TrimSuffix(line, string(e.out.eol)), true)
+			}
+		default:
+			if data, err := e.readFile(q.file); err == nil {
+				e.out.raw(string(data))
+			}
+		}
+	}
+	e.appends = e.appends[:0]
+}
+
+var errNoPrevious = errors.New("no previous regular expression")
+
+// regex returns the regex to use, the last one used for the empty regex.
+func (e *engine) regex(re *regexp.Regexp) (*regexp.Regexp, error) {
+	if re == nil {
+		if e.lastRe == nil {
+			return nil, errNoPrevious
+		}
+		return e.lastRe, nil
+	}
+	e.lastRe = re
+	return re, nil
+}
+
+// matchAddress reports whether the address selects the current line.
+func (e *engine) matchAddress(a *address) (bool, error) {
+	switch a.kind {
+	case addrLine:
+		return e.line == a.line, nil
+	case addrLast:
+		return e.in.last(), nil
+	case addrStep:
+		if a.step <= 0 {
+			return e.line == a.line, nil
+		}
+		return e.line >= a.line && (e.line-a.line)%a.step == 0, nil
+	case addrRegex:
+		re, err := e.regex(a.re)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(e.ps), nil
+	}
+	return false, nil
+}
+
+// matches reports whether the addresses of the command select the
+// current line, updating the state of ranges.
+func (e *engine) matches(c *cmd) (bool, error) {
+	if c.addr1 == nil {
+		return true, nil
+	}
+	if c.addr2 == nil {
+		return e.matchAddress(c.addr1)
+	}
+	if c.active {
+		switch c.addr2.kind {
+		case addrLine, addrPlus, addrMult:
+			c.active = e.line < c.rangeEnd
+			return e.line <= c.rangeEnd, nil
+		}
+		ok, err := e.matchAddress(c.addr2)
+		if err != nil {
+			return false, err
+		}
+		c.active = !ok
+		return true, nil
+	}
+	ok, err := e.matchAddress(c.addr1)
+	if !ok || err != nil {
+		return false, err
+	}
+	switch a2 := c.addr2; a2.kind {
+	case addrLine:
+		c.rangeEnd = a2.line
+	case addrPlus:
+		c.rangeEnd = e.line + a2.line
+	case addrMult:
+		c.rangeEnd = e.line
+		if a2.line > 0 && e.line%a2.line != 0 {
+			c.rangeEnd = (e.line/a2.line + 1) * a2.line
+		}
+	default:
+		c.active = true
+		return true, nil
+	}
+	c.active = e.line < c.rangeEnd
+	return true, nil
+}
+
+// execute runs the script on the pattern space.
+func (e *engine) execute() (action, error) {
+	for pc := 0; pc < len(e.cmds); {
+		c := e.cmds[pc]
+		ok, err := e.matches(c)
+		if err != nil {
+			return 0, err
+		}
+		if ok == c.negate {
+			if c.name == '{' {
+				pc = c.jump
+			} else {
+				pc++
+			}
+			continue
+		}
+		switch c.name {
+		case '=':
+			e.out.raw(strconv.Itoa(e.line) + "\n")
+		case 'a':
+			e.appends = append(e.appends, queued{text: c.text})
+		case 'i':
+			e.out.raw(c.text)
+		case 'c':
+			if c.addr2 == nil || c.negate || !c.active {
+				e.out.raw(c.text)
+			}
+			return actDelete, nil
+		case 'b':
+			pc = c.jump
+			continue
+		case 't', 'T':
+			if e.replaced == (c.name == 't') {
+				e.replaced = false
+				pc = c.jump
+				continue
+			}
+			e.replaced = false
+		case 'd':
+			return actDelete, nil
+		case 'D':
+			i := strings.IndexByte(e.ps, '\n')
+			if i < 0 {
+				return actDelete, nil
+			}
+			e.ps = e.ps[i+1:]
+			return actRestart, nil
+		case 'F':
+			e.out.raw(e.name + "\n")
+		case 'g':
+			e.ps = e.hs
+		case 'G':
+			e.ps += "\n" + e.hs
+		case 'h':
+			e.hs = e.ps
+		case 'H':
+			e.hs += "\n" + e.ps
+		case 'x':
+			e.ps, e.hs = e.hs, e.ps
+		case 'l':
+			width := e.lineWrap
+			if c.hasN {
+				width = c.n
+			}
+			e.list(width)
+		case 'n':
+			if e.in.last() {
+				return actQuit, nil
+			}
+			if !e.quiet {
+				e.out.line(e.ps, e.nl)
+			}
+			e.flushAppends()
+			e.readLine()
+		case 'N':
+			if e.in.last() {
+				return actQuit, nil
+			}
+			e.flushAppends()
+			ps := e.ps
+			e.readLine()
+			e.ps = ps + "\n" + e.ps
+		case 'p':
+			e.out.line(e.ps, e.nl)
+		case 'P':
+			first, _, found := strings.Cut(e.ps, "\n")
+			e.out.line(first, found || e.nl)
+		case 'q':
+			e.exit = c.n
+			return actQuit, nil
+		case 'Q':
+			e.exit = c.n
+			return actQuitSilent, nil
+		case 'r':
+			e.appends = append(e.appends, queued{file: c.text})
+		case 'R':
+			e.appends = append(e.appends, queued{file: c.text, oneLine: true})
+		case 's':
+			if err := e.substitute(c); err != nil {
+				return 0, err
+			}
+		case 'w':
+			c.out.line(e.ps, e.nl)
+		case 'W':
+			first, _, found := strings.Cut(e.ps, "\n")
+			c.out.line(first, found || e.nl)
+		case 'y':
+			e.ps = strings.Map(func(r rune) rune {
+				if to, ok := c.ymap[r]; ok {
+					return to
+				}
+				return r
+			}, e.ps)
+		case 'z':
+			e.ps = ""
+		}
+		pc++
+	}
+	return actEnd, nil
+}
+
+// substitute runs the s command.
+func (e *engine) substitute(c *cmd) error {
+	re, err := e.regex(c.re)
+	if err != nil {
+		return err
+	}
+	nth := max(c.nth, 1)
+	var b strings.Builder
+	last, count := 0, 0
+	for _, m := range re.FindAllStringSubmatchIndex(e.ps, -1) {
+		count++
+		if count < nth {
+			continue
+		}
+		if count > nth && !c.global {
+			break
+		}
+		b.WriteString(e.ps[last:m[0]])
+		expand(&b, e.ps, m, c.replacement)
+		last = m[1]
+	}
+	if count < nth {
+		return nil
+	}
+	b.WriteString(e.ps[last:])
+	e.ps = b.String()
+	e.replaced = true
+	for i := 0; i < c.print; i++ {
+		e.out.line(e.ps, e.nl)
+	}
+	if c.out != nil {
+		c.out.line(e.ps, e.nl)
+	}
+	return nil
+}
+
+// expand writes the replacement of the match m of s.
+func expand(b *strings.Builder, s string, m []int, parts []part) {
+	// mode is U or L until E, next is u or l for the next character
+	var mode, next byte
+	write := func(t string) {
+		if t == "" {
+			return
+		}
+		switch mode {
+		case 'U':
+			t = strings.ToUpper(t)
+		case 'L':
+			t = strings.ToLower(t)
+		}
+		if next != 0 {
+			r, n := utf8.DecodeRuneInString(t)
+			if next == 'u' {
+				r = unicode.ToUpper(r)
+			} else {
+				r = unicode.ToLower(r)
+			}
+			t = string(r) + t[n:]
+			next = 0
+		}
+		b.WriteString(t)
+	}
+	for _, p := range parts {
+		switch p.kind {
+		case partLiteral:
+			write(p.text)
+		case partGroup:
+			if i := 2 * p.group; i < len(m) && m[i] >= 0 {
+				write(s[m[i]:m[i+1]])
+			}
+		case partCase:
+			switch p.conv {
+			case 'U', 'L':
+				mode, next = p.conv, 0
+			case 'E':
+				mode, next = 0, 0
+			default:
+				next = p.conv
+			}
+		}
+	}
+}
+
+// list writes the pattern space unambiguously for l, wrapping lines
+// longer than width.
+func (e *engine) list(width int) {
+	var b strings.Builder
+	column := 0
+	for i := 0; i < len(e.ps); i++ {
+		c := e.ps[i]
+		var s string
+		switch c {
+		case '\\':
+			s = `\\`
+		case '\a':
+			s = `\a`
+		case '\b':
+			s = `\b`
+		case '\f':
+			s = `\f`
+		case '\n':
+			s = `\n`
+		case '\r':
+			s = `\r`
+		case '\t':
+			s = `\t`
+		case '\v':
+			s = `\v`
+		default:
+			if c >= ' ' && c < 0x7f {
+				s = string(c)
+			} else {
+				s = fmt.Sprintf(`\%03o`, c)
+			}
+		}
+		if width > 1 && column+len(s) > width-1 {
+			b.WriteString("\\\n")
+			column = 0
+		}
+		b.WriteString(s)
+		column += len(s)
+	}
+	b.WriteString("$\n")
+	e.out.raw(b.String())
+}
@@ -0,0 +1,763 @@
+package sed
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"github.com/qiangli/shell/tool/core/internal/regex"
+)
+
+// addrKind is the kind of an address.
+type addrKind int
+
+const (
+	addrLine  addrKind = iota // N
+	addrLast                  // $
+	addrRegex                 // /RE/
+	addrStep                  // FIRST~STEP
+	addrPlus                  // ,+N
+	addrMult                  // ,~N
+)
+
+type address struct {
+	kind addrKind
+	line int
+	step int
+	// re is nil for the empty regex, the last one used
+	re *regexp.Regexp
+}
+
+// replacement part kinds, other than literal text.
+const (
+	partLiteral = iota
+	partGroup
+	partCase
+)
+
+// part of the replacement of an s command.
+type part struct {
+	kind  int
+	text  string
+	group int
+	// conv is one of the case conversions U, L, u, l and E
+	conv byte
+}
+
+// cmd is a command of the script.
+type cmd struct {
+	addr1, addr2 *address
+	negate       bool
+	name         byte
+
+	// range state
+	active   bool
+	rangeEnd int
+
+	// text of a, i and c, label of b, t, T and :, file of r, R, w and W
+	text string
+	// jump is the command index of a branch or of the end of a block
+	jump int
+	// out is the output of w, W and the w flag of s
+	out *output
+
+	// s
+	re          *regexp.Regexp
+	replacement []part
+	global      bool
+	nth         int
+	print       int
+
+	// y
+	ymap map[rune]rune
+
+	// exit status of q and Q, line length of l
+	n    int
+	hasN bool
+}
+
+// location names a position of the script for error messages.
+type location struct {
+	start int
+	// expr is the number of the -e expression, or 0 for a -f file
+	expr int
+	file string
+}
+
+// script is the text of the -e and -f options joined by newlines.
+type script struct {
+	text      string
+	locations []location
+}
+
+func (s *script) add(text string, expr int, file string) {
+	if s.text != "" {
+		s.text += "\n"
+	}
+	s.locations = append(s.locations, location{start: len(s.text), expr: expr, file: file})
+	s.text += text
+}
+
+// errorAt returns a syntax error at the position of the script.
+func (s *script) errorAt(pos int, msg string) error {
+	loc := s.locations[0]
+	for _, l := range s.locations {
+		if l.start <= pos {
+			loc = l
+		}
+	}
+	pos = min(pos, len(s.text))
+	if loc.expr > 0 {
+		return fmt.Errorf("-e expression #%d, char %d: %s", loc.expr, pos-loc.start, msg)
+	}
+	line := 1 + strings.Count(s.text[loc.start:pos], "\n")
+	if pos == len(s.text) && strings.HasSuffix(s.text, "\n") {
+		line--
+	}
+	return fmt.Errorf("file %s line %d: %s", loc.file, line, msg)
+}
+
+// parser reads the commands of a script.
+type parser struct {
+	s        *script
+	pos      int
+	extended bool
+	// outputs opens the files of w commands
+	outputs func(name string) (*output, error)
+	cmds    []*cmd
+	blocks  []int
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.s.text) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s.text[p.pos]
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return p.s.errorAt(p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// parse parses the whole script and resolves the branches.
+func (p *parser) parse() ([]*cmd, error) {
+	for {
+		// skip blanks, newlines and semicolons between commands
+		for !p.eof() && strings.IndexByte(" \t\n;", p.peek()) >= 0 {
+			p.pos++
+		}
+		if p.eof() {
+			break
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+		if err := p.command(); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.blocks) > 0 {
+		p.pos = len(p.s.text)
+		return nil, p.errorf("unmatched `{'")
+	}
+	labels := map[string]int{}
+	for i, c := range p.cmds {
+		if c.name == ':' {
+			if _, ok := labels[c.text]; ok {
+				return nil, fmt.Errorf("duplicate label `%s'", c.text)
+			}
+			labels[c.text] = i
+		}
+	}
+	for _, c := range p.cmds {
+		if c.name != 'b' && c.name != 't' && c.name != 'T' {
+			continue
+		}
+		if c.text == "" {
+			c.jump = len(p.cmds)
+			continue
+		}
+		i, ok := labels[c.text]
+		if !ok {
+			return nil, fmt.Errorf("can't find label for jump to `%s'", c.text)
+		}
+		c.jump = i
+	}
+	return p.cmds, nil
+}
+
+func (p *parser) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// end checks that the command is followed by its end.
+func (p *parser) end() error {
+	p.skipSpace()
+	switch p.peek() {
+	case 0, '\n', ';', '#', '}':
+		return nil
+	}
+	p.pos++
+	return p.errorf("extra characters after command")
+}
+
+func (p *parser) command() error {
+	c := &cmd{}
+	var err error
+	if c.addr1, err = p.address(false); err != nil {
+		return err
+	}
+	if c.addr1 != nil {
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			p.skipSpace()
+			if c.addr2, err = p.address(true); err != nil {
+				return err
+			}
+			if c.addr2 == nil {
+				return p.errorf("unexpected `,'")
+			}
+		}
+		if c.addr1.kind == addrLine && c.addr1.line == 0 &&
+			(c.addr2 == nil || c.addr2.kind != addrRegex) {
+			return p.errorf("invalid usage of line address 0")
+		}
+	}
+	p.skipSpace()
+	for p.peek() == '!' {
+		c.negate = true
+		p.pos++
+		p.skipSpace()
+	}
+	if p.eof() {
+		return p.errorf("missing command")
+	}
+	c.name = p.peek()
+	p.pos++
+
+	noAddr := func() error {
+		if c.addr1 != nil {
+			return p.errorf("%c doesn't want any addresses", c.name)
+		}
+		return nil
+	}
+	oneAddr := func() error {
+		if c.addr2 != nil {
+			return p.errorf("command only uses one address")
+		}
+		return nil
+	}
+
+	switch c.name {
+	case '{':
+		p.blocks = append(p.blocks, len(p.cmds))
+		p.cmds = append(p.cmds, c)
+		return nil
+	case '}':
+		if err := noAddr(); err != nil {
+			return err
+		}
+		if len(p.blocks) == 0 {
+			return p.errorf("unexpected `}'")
+		}
+		open := p.blocks[len(p.blocks)-1]
+		p.blocks = p.blocks[:len(p.blocks)-1]
+		p.cmds[open].jump = len(p.cmds) + 1
+		p.cmds = append(p.cmds, c)
+		return p.end()
+	case ':':
+		if c.addr1 != nil {
+			return p.errorf(": doesn't want any addresses")
+		}
+		p.skipSpace()
+		c.text = p.label()
+		if c.text == "" {
+			return p.errorf("\":\" lacks a label")
+		}
+	case 'b', 't', 'T':
+		p.skipSpace()
+		c.text = p.label()
+	case '=', 'd', 'D', 'F', 'g', 'G', 'h', 'H', 'n', 'N', 'p', 'P', 'x', 'z':
+		if err := p.end(); err != nil {
+			return err
+		}
+	case 'q', 'Q', 'l':
+		if c.name != 'l' {
+			if err := oneAddr(); err != nil {
+				return err
+			}
+		}
+		p.skipSpace()
+		if n, ok := p.number(); ok {
+			c.n, c.hasN = n, true
+		}
+		if err := p.end(); err != nil {
+			return err
+		}
+	case 'a', 'i', 'c':
+		if c.text, err = p.textArg(); err != nil {
+			return err
+		}
+	case 'r', 'R', 'w', 'W':
+		c.text = p.fileName()
+		if c.text == "" {
+			return p.errorf("missing filename in r/R/w/W commands")
+		}
+		if c.name == 'w' || c.name == 'W' {
+			if c.out, err = p.outputs(c.text); err != nil {
+				return err
+			}
+		}
+	case 's':
+		if err := p.substitute(c); err != nil {
+			return err
+		}
+	case 'y':
+		if err := p.transliterate(c); err != nil {
+			return err
+		}
+	case 'e':
+		return p.errorf("e command not supported")
+	case 'v':
+		// v only checks the version
+		p.label()
+	default:
+		return p.errorf("unknown command: `%c'", c.name)
+	}
+	p.cmds = append(p.cmds, c)
+	return nil
+}
+
+// label reads a label, ending at a newline or a semicolon.
+func (p *parser) label() string {
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' && p.peek() != ';' {
+		p.pos++
+	}
+	return strings.TrimRight(p.s.text[start:p.pos], " \t")
+}
+
+// fileName reads the file name ending the line.
+func (p *parser) fileName() string {
+	p.skipSpace()
+	start := p.pos
+	p.skipLine()
+	return p.s.text[start:p.pos]
+}
+
+func (p *parser) number() (int, bool) {
+	start := p.pos
+	for !p.eof() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, false
+	}
+	n, err := strconv.Atoi(p.s.text[start:p.pos])
+	return n, err == nil
+}
+
+// address reads an address, nil if there is none. The second address of
+// a range may also be +N or ~N.
+func (p *parser) address(second bool) (*address, error) {
+	switch c := p.peek(); {
+	case c >= '0' && c <= '9':
+		n, _ := p.number()
+		if p.peek() == '~' && !second {
+			p.pos++
+			step, _ := p.number()
+			return &address{kind: addrStep, line: n, step: step}, nil
+		}
+		return &address{kind: addrLine, line: n}, nil
+	case c == '+' || c == '~':
+		if !second {
+			return nil, nil
+		}
+		p.pos++
+		n, ok := p.number()
+		if !ok {
+			return nil, p.errorf("expected newer version of sed")
+		}
+		if c == '+' {
+			return &address{kind: addrPlus, line: n}, nil
+		}
+		return &address{kind: addrMult, line: n}, nil
+	case c == '$':
+		p.pos++
+		return &address{kind: addrLast}, nil
+	case c == '/' || c == '\\':
+		if c == '\\' {
+			p.pos++
+			if p.eof() || p.peek() == '\n' || p.peek() == '\\' {
+				return nil, p.errorf("unexpected `,'")
+			}
+		}
+		delim := p.peek()
+		p.pos++
+		pattern, ok := p.delimited(delim, true)
+		if !ok {
+			return nil, p.errorf("unterminated address regex")
+		}
+		var flags string
+		for p.peek() == 'I' || p.peek() == 'M' {
+			flags += string(p.peek())
+			p.pos++
+		}
+		re, err := p.compile(pattern, flags)
+		if err != nil {
+			return nil, err
+		}
+		return &address{kind: addrRegex, re: re}, nil
+	}
+	return nil, nil
+}
+
+// delimited reads up to the unescaped delimiter, dropping the backslash
+// of escaped delimiters. In a regex, \n is a newline and the delimiter is
+// not special inside brackets.
+func (p *parser) delimited(delim byte, isRegex bool) (string, bool) {
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == delim:
+			return sb.String(), true
+		case c == '\n' && isRegex:
+			return "", false
+		case c == '\\' && !p.eof():
+			n := p.peek()
+			p.pos++
+			switch {
+			case n == delim:
+				sb.WriteByte(n)
+			case n == 'n' && isRegex:
+				sb.WriteByte('\n')
+			case n == '\n':
+				sb.WriteString("\\\n")
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(n)
+			}
+		case c == '[' && isRegex:
+			// copy the bracket expression as it is
+			sb.WriteByte(c)
+			end := bracketEnd(p.s.text, p.pos)
+			if end < 0 {
+				// the delimiter is not special in brackets
+				return "", false
+			}
+			sb.WriteString(bracketEscapes.Replace(p.s.text[p.pos:end]))
+			p.pos = end
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// bracketEscapes are the escapes GNU sed decodes in bracket expressions,
+// where backslashes are otherwise literal.
+var bracketEscapes = strings.NewReplacer(`\n`, "\n", `\t`, "\t")
+
+// bracketEnd returns the position after the bracket expression whose
+// content starts at i, or -1.
+func bracketEnd(s string, i int) int {
+	j := i
+	if j < len(s) && s[j] == '^' {
+		j++
+	}
+	if j < len(s) && s[j] == ']' {
+		j++
+	}
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\n':
+			return -1
+		case ']':
+			return j + 1
+		case '[':
+			if j+1 < len(s) && strings.IndexByte(":.=", s[j+1]) >= 0 {
+				end := strings.Index(s[j+2:], string(s[j+1])+"]")
+				if end < 0 {
+					return -1
+				}
+				j += 2 + end + 1
+			}
+		}
+	}
+	return -1
+}
+
+// compile translates the POSIX regex. The empty regex is the last regex
+// used, it is returned as nil.
+func (p *parser) compile(pattern, flags string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		if flags != "" {
+			return nil, p.errorf("no previous regular expression")
+		}
+		return nil, nil
+	}
+	expr, err := regex.Convert(unescape(pattern), !p.extended)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	prefix := "(?s"
+	if strings.Contains(flags, "I") {
+		prefix += "i"
+	}
+	if strings.Contains(flags, "M") {
+		prefix += "m"
+	}
+	re, err := regexp.Compile(prefix + ")" + expr)
+	if err != nil {
+		var se *syntax.Error
+		if errors.As(err, &se) {
+			return nil, p.errorf("%v", se.Code)
+		}
+		return nil, p.errorf("%v", err)
+	}
+	re.Longest()
+	return re, nil
+}
+
+// unescape decodes the \t escape of GNU sed outside of the regex
+// converter, which keeps other escapes.
+func unescape(p string) string {
+	if !strings.Contains(p, `\t`) {
+		return p
+	}
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+1 < len(p) {
+			if p[i+1] == 't' {
+				sb.WriteByte('\t')
+			} else {
+				sb.WriteString(p[i : i+2])
+			}
+			i++
+			continue
+		}
+		sb.WriteByte(p[i])
+	}
+	return sb.String()
+}
+
+// textArg reads the text of a, i and c: either "\" and the following
+// lines, or the rest of the line. A backslash escapes the next character
+// and a trailing backslash continues the text on the next line.
+func (p *parser) textArg() (string, error) {
+	p.skipSpace()
+	if p.peek() == '\\' {
+		p.pos++
+		// blanks after the backslash are kept unless a newline follows
+		i := p.pos
+		for i < len(p.s.text) && (p.s.text[i] == ' ' || p.s.text[i] == '\t') {
+			i++
+		}
+		if i < len(p.s.text) && p.s.text[i] == '\n' {
+			p.pos = i + 1
+		}
+	} else if p.eof() || p.peek() == '\n' {
+		return "", p.errorf("expected \\ after `a', `c' or `i'")
+	}
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		if c == '\n' {
+			break
+		}
+		if c == '\\' && !p.eof() {
+			c = p.peek()
+			p.pos++
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String() + "\n", nil
+}
+
+// substitute reads the s command.
+func (p *parser) substitute(c *cmd) error {
+	delim := p.peek()
+	if delim == 0 || delim == '\n' || delim == '\\' {
+		return p.errorf("unterminated `s' command")
+	}
+	p.pos++
+	pattern, ok := p.delimited(delim, true)
+	if !ok {
+		return p.errorf("unterminated `s' command")
+	}
+	replacement, ok := p.delimited(delim, false)
+	if !ok {
+		return p.errorf("unterminated `s' command")
+	}
+	var flags string
+	for done := false; !done && !p.eof(); {
+		switch f := p.peek(); {
+		case f == 'g':
+			if c.global {
+				return p.errorf("multiple `g' options to `s' command")
+			}
+			c.global = true
+			p.pos++
+		case f == 'p':
+			if c.print > 0 {
+				return p.errorf("multiple `p' options to `s' command")
+			}
+			c.print++
+			p.pos++
+		case f == 'i' || f == 'I':
+			flags += "I"
+			p.pos++
+		case f == 'm' || f == 'M':
+			flags += "M"
+			p.pos++
+		case f >= '0' && f <= '9':
+			if c.nth > 0 {
+				return p.errorf("multiple number options to `s' command")
+			}
+			n, _ := p.number()
+			if n == 0 {
+				return p.errorf("number option to `s' command may not be zero")
+			}
+			c.nth = n
+		case f == 'w':
+			p.pos++
+			c.text = p.fileName()
+			if c.text == "" {
+				return p.errorf("missing filename in r/R/w/W commands")
+			}
+			var err error
+			if c.out, err = p.outputs(c.text); err != nil {
+				return err
+			}
+			done = true
+		case f == 'e':
+			return p.errorf("e command not supported")
+		case f == ' ' || f == '\t' || f == ';' || f == '\n' || f == '#' || f == '}':
+			done = true
+		default:
+			p.pos++
+			return p.errorf("unknown option to `s'")
+		}
+	}
+	var err error
+	if c.re, err = p.compile(pattern, flags); err != nil {
+		return err
+	}
+	if c.replacement, err = p.parseReplacement(replacement, c.re); err != nil {
+		return err
+	}
+	if c.text == "" {
+		return p.end()
+	}
+	return nil
+}
+
+// parseReplacement splits the replacement into literal text, groups
+// (& and \1 to \9) and the case conversions of GNU sed.
+func (p *parser) parseReplacement(s string, re *regexp.Regexp) ([]part, error) {
+	var parts []part
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, part{kind: partLiteral, text: lit.String()})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '&':
+			flush()
+			parts = append(parts, part{kind: partGroup})
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch n := s[i]; {
+			case n >= '0' && n <= '9':
+				group := int(n - '0')
+				if re != nil && group > re.NumSubexp() {
+					return nil, p.errorf("invalid reference \\%d on `s' command's RHS", group)
+				}
+				flush()
+				parts = append(parts, part{kind: partGroup, group: group})
+			case strings.IndexByte("ULulE", n) >= 0:
+				flush()
+				parts = append(parts, part{kind: partCase, conv: n})
+			case n == 'n':
+				lit.WriteByte('\n')
+			case n == 't':
+				lit.WriteByte('\t')
+			default:
+				lit.WriteByte(n)
+			}
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	flush()
+	return parts, nil
+}
+
+// transliterate reads the y command.
+func (p *parser) transliterate(c *cmd) error {
+	delim := p.peek()
+	if delim == 0 || delim == '\n' || delim == '\\' {
+		return p.errorf("unterminated `y' command")
+	}
+	p.pos++
+	src, ok := p.delimited(delim, false)
+	if !ok {
+		return p.errorf("unterminated `y' command")
+	}
+	dst, ok := p.delimited(delim, false)
+	if !ok {
+		return p.errorf("unterminated `y' command")
+	}
+	from, to := []rune(yUnescape(src)), []rune(yUnescape(dst))
+	if len(from) != len(to) {
+		return p.errorf("strings for `y' command are different lengths")
+	}
+	c.ymap = make(map[rune]rune, len(from))
+	for i, r := range from {
+		c.ymap[r] = to[i]
+	}
+	return p.end()
+}
+
+// yUnescape decodes the escapes of the strings of y.
+func yUnescape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,458 @@
+// Sed edits streams of lines.
+//
+// Synopsis:
+//
+//	sed [OPTION]... {SCRIPT | -e SCRIPT... | -f FILE...} [FILE]...
+//
+// Description:
+//
+//	Sed runs the script on each line of the workspace files, or of stdin,
+//	and writes the results. The script is the first operand unless -e or
+//	-f is given; the texts of the -e and -f options are joined by newlines.
+//	Regular expressions are POSIX basic ones, or extended ones with -E.
+//
+//	Commands take zero, one or two addresses: a line number, $ for the
+//	last line, /RE/ or \cREc with the I and M flags, FIRST~STEP, and as
+//	the second address +N or ~N. An address of 0 may start a range ending
+//	at a regex. The ! suffix negates the addresses.
+//
+//	  {  }          group commands
+//	  =             write the line number
+//	  a, i, c TEXT  append, insert or change to TEXT
+//	  b, t, T LABEL branch always, on a substitution or on none
+//	  : LABEL       define a label
+//	  d, D          delete the pattern space, or its first line
+//	  F             write the file name
+//	  g, G, h, H, x copy or append between the hold and pattern spaces
+//	  l [N]         write the pattern space unambiguously
+//	  n, N          write or append the next line
+//	  p, P          write the pattern space, or its first line
+//	  q, Q [CODE]   quit, with or without writing the pattern space
+//	  r, R FILE     append the file, or its next line
+//	  s/RE/REP/FLAGS substitute, FLAGS are g, p, N, i, m and w FILE
+//	  w, W FILE     write the pattern space, or its first line, to FILE
+//	  y/SRC/DST/    transliterate characters
+//	  z             empty the pattern space
+//
+//	With -i the files are edited in place: the output replaces each file
+//	through the atomic writes of the workspace. If SUFFIX is given, the
+//	original file is kept as the file name followed by SUFFIX, or as
+//	SUFFIX with each "*" replaced by the base name of the file.
+//
+// Options:
+//
+//	-n, --quiet, --silent:       do not write the pattern space at the end of cycles
+//	-e, --expression SCRIPT:     add SCRIPT to the script
+//	-f, --file FILE:             add the content of FILE to the script
+//	-E, -r, --regexp-extended:   use extended regular expressions
+//	-i[SUFFIX], --in-place[=SUFFIX]: edit the files in place, keeping a backup with SUFFIX
+//	-l, --line-length N:         wrap the lines of l at N characters (default: 70)
+//	-s, --separate:              consider the files separately
+//	-z, --null-data:             lines end with NUL, not newline
+package sed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+// command implements the sed core utility.
+type command struct {
+	core.Base
+
+	ws vfs.Workspace
+}
+
+// New creates a new sed command.
+func New(ws vfs.Workspace) core.Command {
+	c := &command{
+		ws: ws,
+	}
+	c.Init()
+	return c
+}
+
+// scriptFlag adds the -e and -f options to the script in order.
+type scriptFlag struct {
+	parts *[]scriptPart
+	file  bool
+}
+
+type scriptPart struct {
+	text string
+	file bool
+}
+
+func (s scriptFlag) String() string { return "" }
+func (s scriptFlag) Set(v string) error {
+	*s.parts = append(*s.parts, scriptPart{text: v, file: s.file})
+	return nil
+}
+
+// inPlaceFlag is -i and --in-place with an optional suffix.
+type inPlaceFlag struct {
+	on     bool
+	suffix string
+}
+
+func (f *inPlaceFlag) String() string   { return f.suffix }
+func (f *inPlaceFlag) IsBoolFlag() bool { return true }
+func (f *inPlaceFlag) Set(s string) error {
+	f.on = s != "false"
+	if s != "true" && s != "false" {
+		f.suffix = s
+	}
+	return nil
+}
+
+type flags struct {
+	quiet      bool
+	scripts    []scriptPart
+	extended   bool
+	inPlace    inPlaceFlag
+	lineLength int
+	separate   bool
+	zero       bool
+}
+
+// inPlaceArgs rewrites -i[SUFFIX], which may end a group of short
+// options, as --in-place[=SUFFIX] since its value is optional.
+func inPlaceArgs(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i, a := range args {
+		if a == "--" {
+			return append(out, args[i:]...)
+		}
+		if len(a) < 2 || a[0] != '-' || a[1] == '-' {
+			out = append(out, a)
+			continue
+		}
+		j := 1
+		for ; j < len(a) && strings.IndexByte("nErsuz", a[j]) >= 0; j++ {
+		}
+		if j == len(a) || a[j] != 'i' {
+			out = append(out, a)
+			continue
+		}
+		if j > 1 {
+			out = append(out, a[:j])
+		}
+		if suffix := a[j+1:]; suffix != "" {
+			out = append(out, "--in-place="+suffix)
+		} else {
+			out = append(out, "--in-place")
+		}
+	}
+	return out
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("sed", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.BoolVar(&f.quiet, "n", false, "do not write the pattern space at the end of cycles")
+	fs.BoolVar(&f.quiet, "quiet", false, "do not write the pattern space at the end of cycles")
+	fs.BoolVar(&f.quiet, "silent", false, "do not write the pattern space at the end of cycles")
+	fs.Var(scriptFlag{parts: &f.scripts}, "e", "add `SCRIPT` to the script")
+	fs.Var(scriptFlag{parts: &f.scripts}, "expression", "add `SCRIPT` to the script")
+	fs.Var(scriptFlag{parts: &f.scripts, file: true}, "f", "add the content of `FILE` to the script")
+	fs.Var(scriptFlag{parts: &f.scripts, file: true}, "file", "add the content of `FILE` to the script")
+	fs.BoolVar(&f.extended, "E", false, "use extended regular expressions")
+	fs.BoolVar(&f.extended, "r", false, "use extended regular expressions")
+	fs.BoolVar(&f.extended, "regexp-extended", false, "use extended regular expressions")
+	fs.Var(&f.inPlace, "in-place", "edit the files in place, keeping a backup with `SUFFIX` if given")
+	fs.IntVar(&f.lineLength, "l", 70, "wrap the lines of l at `N` characters")
+	fs.IntVar(&f.lineLength, "line-length", 70, "wrap the lines of l at `N` characters")
+	fs.BoolVar(&f.separate, "s", false, "consider the files separately")
+	fs.BoolVar(&f.separate, "separate", false, "consider the files separately")
+	fs.BoolVar(&f.zero, "z", false, "lines end with NUL, not newline")
+	fs.BoolVar(&f.zero, "null-data", false, "lines end with NUL, not newline")
+	// accepted for compatibility, output is flushed at the end
+	var unbuffered bool
+	fs.BoolVar(&unbuffered, "u", false, "accepted for compatibility")
+	fs.BoolVar(&unbuffered, "unbuffered", false, "accepted for compatibility")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "sed [OPTION]... {SCRIPT | -e SCRIPT... | -f FILE...} [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Sed edits streams of lines.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	valued := []string{"e", "expression", "f", "file", "l", "line-length"}
+	if err := fs.Parse(cli.Args(inPlaceArgs(args), valued...)); err != nil {
+		return cli.Exit(1, err)
+	}
+	names := fs.Args()
+	if len(f.scripts) == 0 {
+		if len(names) == 0 {
+			fs.Usage()
+			return cli.Exit(1, nil)
+		}
+		f.scripts = []scriptPart{{text: names[0]}}
+		names = names[1:]
+	}
+
+	eol := byte('\n')
+	if f.zero {
+		eol = 0
+	}
+	stdout := &output{w: bufio.NewWriter(c.Stdout), eol: eol}
+	defer stdout.w.Flush()
+
+	// the files of w commands, opened while parsing
+	outputs := map[string]*output{"/dev/stdout": stdout}
+	defer func() {
+		for _, o := range outputs {
+			o.w.Flush()
+			if o.c != nil {
+				o.c.Close()
+			}
+		}
+	}()
+	openOutput := func(name string) (*output, error) {
+		if o, ok := outputs[name]; ok {
+			return o, nil
+		}
+		var o *output
+		if name == "/dev/stderr" {
+			o = &output{w: bufio.NewWriter(c.Stderr), eol: eol}
+		} else {
+			file, err := c.ws.OpenFile(c.ResolvePath(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't open file %s: %w", name, pathCause(err))
+			}
+			o = &output{w: bufio.NewWriter(file), c: file, eol: eol}
+		}
+		outputs[name] = o
+		return o, nil
+	}
+
+	s := &script{}
+	expr := 0
+	for _, part := range f.scripts {
+		if !part.file {
+			expr++
+			s.add(part.text, expr, "")
+			continue
+		}
+		text, err := c.readScript(part.text)
+		if err != nil {
+			return cli.Exit(1, err)
+		}
+		s.add(strings.TrimSuffix(text, "\n"), 0, part.text)
+	}
+	if first := s.text; first == "#n" || strings.HasPrefix(first, "#n\n") {
+		f.quiet = true
+	}
+	p := &parser{s: s, extended: f.extended, outputs: openOutput}
+	cmds, err := p.parse()
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+	for _, cmd := range cmds {
+		if cmd.addr1 != nil && cmd.addr1.kind == addrLine && cmd.addr1.line == 0 {
+			// 0,/RE/ may end on the first line
+			cmd.active = true
+		}
+	}
+
+	e := &engine{
+		cmds:      cmds,
+		quiet:     f.quiet,
+		lineWrap:  f.lineLength,
+		out:       stdout,
+		readFile:  func(name string) ([]byte, error) { return c.ws.ReadFile(c.ResolvePath(name), nil) },
+		openLines: c.openLines,
+		rlines:    map[string]*bufio.Reader{},
+	}
+
+	status := 0
+	open := func(name string) (io.ReadCloser, bool) {
+		r, err := c.open(name)
+		if err != nil {
+			stdout.w.Flush()
+			fmt.Fprintf(c.Stderr, "sed: %v\n", err)
+			status = 2
+			return nil, false
+		}
+		return r, true
+	}
+	if len(names) == 0 {
+		if f.inPlace.on {
+			return cli.Exit(4, errors.New("no input files"))
+		}
+		names = []string{"-"}
+	}
+
+	switch {
+	case f.inPlace.on:
+		for _, name := range names {
+			if e.quit {
+				break
+			}
+			if err := c.editInPlace(ctx, e, name, f.inPlace.suffix, eol); err != nil {
+				if ctx.Err() != nil || errors.Is(err, errNoPrevious) {
+					return runError(ctx, err)
+				}
+				stdout.w.Flush()
+				fmt.Fprintf(c.Stderr, "sed: %v\n", err)
+				status = 4
+			}
+		}
+	case f.separate:
+		for _, name := range names {
+			if e.quit {
+				break
+			}
+			e.line = 0
+			if err := e.run(ctx, &input{names: []string{name}, open: open, eol: eol}); err != nil {
+				return runError(ctx, err)
+			}
+		}
+	default:
+		if err := e.run(ctx, &input{names: names, open: open, eol: eol}); err != nil {
+			return runError(ctx, err)
+		}
+	}
+
+	for _, o := range outputs {
+		if err := o.w.Flush(); err != nil {
+			return cli.Exit(4, fmt.Errorf("couldn't write: %w", err))
+		}
+	}
+	if e.exit != 0 {
+		return cli.Exit(e.exit, nil)
+	}
+	if status != 0 {
+		return cli.Exit(status, nil)
+	}
+	return nil
+}
+
+// runError returns the exit status of an error of the execution.
+func runError(ctx context.Context, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.Is(err, errNoPrevious):
+		return cli.Exit(1, err)
+	}
+	return cli.Exit(4, err)
+}
+
+// readScript reads the script file of -f, stdin for "-".
+func (c *command) readScript(name string) (string, error) {
+	if name == "-" {
+		data, err := io.ReadAll(c.Stdin)
+		return string(data), err
+	}
+	data, err := c.ws.ReadFile(c.ResolvePath(name), nil)
+	if err != nil {
+		return "", fmt.Errorf("couldn't open file %s: %w", name, pathCause(err))
+	}
+	return string(data), nil
+}
+
+// open opens an input file, stdin for "-".
+func (c *command) open(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(c.Stdin), nil
+	}
+	path := c.ResolvePath(name)
+	if info, err := c.ws.Stat(path); err == nil && info.IsDir() {
+		return nil, fmt.Errorf("read error on %s: is a directory", name)
+	}
+	file, err := c.ws.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s: %w", name, pathCause(err))
+	}
+	return file, nil
+}
+
+// openLines opens the file of R, nil if it can not be read.
+func (c *command) openLines(name string) (*bufio.Reader, error) {
+	data, err := c.ws.ReadFile(c.ResolvePath(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(bytes.NewReader(data)), nil
+}
+
+// editInPlace runs the script on the file and replaces it with the
+// output through the workspace.
+func (c *command) editInPlace(ctx context.Context, e *engine, name, suffix string, eol byte) error {
+	path := c.ResolvePath(name)
+	info, err := c.ws.Stat(path)
+	switch {
+	case name == "-", err == nil && !info.Mode().IsRegular():
+		return fmt.Errorf("couldn't edit %s: not a regular file", name)
+	case err != nil:
+		return fmt.Errorf("can't read %s: %w", name, pathCause(err))
+	}
+	data, err := c.ws.ReadFile(path, nil)
+	if err != nil {
+		return fmt.Errorf("can't read %s: %w", name, pathCause(err))
+	}
+
+	var buf bytes.Buffer
+	stdout := e.out
+	e.out = &output{w: bufio.NewWriter(&buf), eol: eol}
+	e.line = 0
+	open := func(string) (io.ReadCloser, bool) {
+		return io.NopCloser(bytes.NewReader(data)), true
+	}
+	err = e.run(ctx, &input{names: []string{name}, open: open, eol: eol})
+	e.out.w.Flush()
+	e.out = stdout
+	if err != nil {
+		return err
+	}
+
+	if suffix != "" {
+		backup := path + suffix
+		if strings.Contains(suffix, "*") {
+			backup = strings.ReplaceAll(suffix, "*", filepath.Base(path))
+			if !filepath.IsAbs(backup) {
+				backup = filepath.Join(filepath.Dir(path), backup)
+			}
+		}
+		if err := c.ws.WriteFile(backup, data, nil); err != nil {
+			return fmt.Errorf("couldn't back up %s: %w", name, err)
+		}
+	}
+	if err := c.ws.WriteFile(path, buf.Bytes(), nil); err != nil {
+		return fmt.Errorf("couldn't edit %s: %w", name, err)
+	}
+	return nil
+}
+
+// pathCause drops the operation and the path of file errors.
+func pathCause(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
@@ -0,0 +1,745 @@
+package sed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+func setup(t *testing.T, files map[string]string) (string, vfs.Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func runSed(ws vfs.Workspace, dir, stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := New(ws)
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	cmd.SetWorkingDir(dir)
+	err := cmd.Run(args...)
+	var e *cli.ExitError
+	if errors.As(err, &e) && e.Err != nil {
+		// as the shell reports it
+		fmt.Fprintf(&stderr, "sed: %v\n", e.Err)
+	}
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+func exitCode(err error) int {
+	var e *cli.ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// The expected results are those of GNU sed.
+func TestSed(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		stdin string
+		files map[string]string
+		want  string
+		code  int
+		// wantFiles are the contents of files after the run
+		wantFiles map[string]string
+	}{
+		{
+			name:  "substitute",
+			args:  []string{"s/o/0/"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "0ne\ntw0\nthree\nf0ur\nfive\n",
+		},
+		{
+			name:  "substitute global",
+			args:  []string{"s/o/0/g"},
+			stdin: "foo boo\n",
+			want:  "f00 b00\n",
+		},
+		{
+			name:  "substitute nth",
+			args:  []string{"s/o/0/2"},
+			stdin: "foo boo\n",
+			want:  "fo0 boo\n",
+		},
+		{
+			name:  "substitute nth and after",
+			args:  []string{"s/o/0/2g"},
+			stdin: "foo boo\n",
+			want:  "fo0 b00\n",
+		},
+		{
+			name:  "substitute empty matches",
+			args:  []string{"s/x*/-/g"},
+			stdin: "abc\n",
+			want:  "-a-b-c-\n",
+		},
+		{
+			name:  "substitute groups",
+			args:  []string{`s/\(a*\)\(b*\)/[\2\1]/`},
+			stdin: "aabbb\n",
+			want:  "[bbbaa]\n",
+		},
+		{
+			name:  "substitute extended groups",
+			args:  []string{"-E", `s/(a+)(b+)/[\2&\1]/`},
+			stdin: "xaabbby\n",
+			want:  "x[bbbaabbbaa]y\n",
+		},
+		{
+			name:  "substitute ampersand escape",
+			args:  []string{`s/b/\&&/`},
+			stdin: "abc\n",
+			want:  "a&bc\n",
+		},
+		{
+			name:  "substitute case conversion",
+			args:  []string{"-E", `s/(\w+) (\w+)/\U\1\E \u\2/`},
+			stdin: "hello world\n",
+			want:  "HELLO World\n",
+		},
+		{
+			name:  "substitute lower",
+			args:  []string{`s/.*/\L&/`},
+			stdin: "HeLLo\n",
+			want:  "hello\n",
+		},
+		{
+			name:  "substitute delimiter",
+			args:  []string{"s|/usr|/opt|"},
+			stdin: "/usr/bin\n",
+			want:  "/opt/bin\n",
+		},
+		{
+			name:  "substitute escaped delimiter",
+			args:  []string{`s/\//:/g`},
+			stdin: "a/b/c\n",
+			want:  "a:b:c\n",
+		},
+		{
+			name:  "substitute ignore case",
+			args:  []string{"s/HELLO/bye/I"},
+			stdin: "hello\n",
+			want:  "bye\n",
+		},
+		{
+			name:  "substitute print",
+			args:  []string{"-n", "s/two/2/p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "2\n",
+		},
+		{
+			name:  "substitute newline",
+			args:  []string{`s/ /\n/`},
+			stdin: "a b\n",
+			want:  "a\nb\n",
+		},
+		{
+			name:  "substitute bracket newline",
+			args:  []string{`N;s/[\n]/+/`},
+			stdin: "a\nb\n",
+			want:  "a+b\n",
+		},
+		{
+			name:  "substitute not newline",
+			args:  []string{`N;s/[^\n]*$/X/`},
+			stdin: "a\nb\n",
+			want:  "a\nX\n",
+		},
+		{
+			name:  "substitute tab",
+			args:  []string{`s/\t/<TAB>/`},
+			stdin: "a\tb\n",
+			want:  "a<TAB>b\n",
+		},
+		{
+			name:  "substitute interval",
+			args:  []string{`s/o\{2\}/0/`},
+			stdin: "foo\n",
+			want:  "f0\n",
+		},
+		{
+			name:  "substitute star literal",
+			args:  []string{"s/*/x/"},
+			stdin: "a*b\n",
+			want:  "axb\n",
+		},
+		{
+			name:  "substitute anchors",
+			args:  []string{"s/^/> /;s/$/ </"},
+			stdin: "x\n",
+			want:  "> x <\n",
+		},
+		{
+			name:  "substitute longest",
+			args:  []string{"-E", "s/a|ab/X/"},
+			stdin: "abc\n",
+			want:  "Xc\n",
+		},
+		{
+			name:  "delete",
+			args:  []string{"2d"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nthree\nfour\nfive\n",
+		},
+		{
+			name:  "delete range",
+			args:  []string{"2,4d"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nfive\n",
+		},
+		{
+			name:  "delete regex range",
+			args:  []string{"/two/,/four/d"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nfive\n",
+		},
+		{
+			name:  "delete last",
+			args:  []string{"$d"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\ntwo\nthree\nfour\n",
+		},
+		{
+			name:  "negate",
+			args:  []string{"-n", "2!p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nthree\nfour\nfive\n",
+		},
+		{
+			name:  "step",
+			args:  []string{"-n", "1~2p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nthree\nfive\n",
+		},
+		{
+			name:  "step zero first",
+			args:  []string{"-n", "0~2p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "two\nfour\n",
+		},
+		{
+			name:  "plus range",
+			args:  []string{"-n", "/two/,+1p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "two\nthree\n",
+		},
+		{
+			name:  "multiple range",
+			args:  []string{"-n", "2,~4p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "two\nthree\nfour\n",
+		},
+		{
+			name:  "zero address",
+			args:  []string{"0,/o/s//0/"},
+			stdin: "foo\nboo\n",
+			want:  "f0o\nboo\n",
+		},
+		{
+			name:  "backward range",
+			args:  []string{"-n", "3,1p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "three\n",
+		},
+		{
+			name:  "regex range restarts",
+			args:  []string{"-n", "/a/,/b/p"},
+			stdin: "a\nb\nc\na\nc\n",
+			want:  "a\nb\na\nc\n",
+		},
+		{
+			name:  "print",
+			args:  []string{"p"},
+			stdin: "a\nb\n",
+			want:  "a\na\nb\nb\n",
+		},
+		{
+			name:  "quiet",
+			args:  []string{"-n", "$p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "five\n",
+		},
+		{
+			name:  "quiet comment",
+			args:  []string{"#n\n3p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "three\n",
+		},
+		{
+			name:  "line number",
+			args:  []string{"-n", "$="},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "5\n",
+		},
+		{
+			name:  "equals",
+			args:  []string{"="},
+			stdin: "a\nb\n",
+			want:  "1\na\n2\nb\n",
+		},
+		{
+			name:  "append",
+			args:  []string{"2a\\\nadded"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\ntwo\nadded\nthree\nfour\nfive\n",
+		},
+		{
+			name:  "append one liner",
+			args:  []string{"2a added  text"},
+			stdin: "a\nb\n",
+			want:  "a\nb\nadded  text\n",
+		},
+		{
+			name:  "append escaped",
+			args:  []string{`1a\  lead`},
+			stdin: "a\n",
+			want:  "a\n  lead\n",
+		},
+		{
+			name:  "append multiline",
+			args:  []string{"1a\\\nx\\\ny"},
+			stdin: "a\nb\n",
+			want:  "a\nx\ny\nb\n",
+		},
+		{
+			name:  "insert",
+			args:  []string{"1i\\\nfirst"},
+			stdin: "a\nb\n",
+			want:  "first\na\nb\n",
+		},
+		{
+			name:  "insert one liner",
+			args:  []string{"$i before last"},
+			stdin: "a\nb\n",
+			want:  "a\nbefore last\nb\n",
+		},
+		{
+			name:  "change",
+			args:  []string{"2c\\\nchanged"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nchanged\nthree\nfour\nfive\n",
+		},
+		{
+			name:  "change range",
+			args:  []string{"2,4c\\\nchanged"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nchanged\nfive\n",
+		},
+		{
+			name:  "change negated",
+			args:  []string{"2!c X"},
+			stdin: "a\nb\nc\n",
+			want:  "X\nb\nX\n",
+		},
+		{
+			name:  "transliterate",
+			args:  []string{"y/abc/xyz/"},
+			stdin: "aabbcc\n",
+			want:  "xxyyzz\n",
+		},
+		{
+			name:  "transliterate newline",
+			args:  []string{`N;y/\n/ /`},
+			stdin: "a\nb\n",
+			want:  "a b\n",
+		},
+		{
+			name:  "next",
+			args:  []string{"n;d"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nthree\nfive\n",
+		},
+		{
+			name:  "next at end",
+			args:  []string{"$!d;n;s/./X/"},
+			stdin: "a\nb\n",
+			want:  "b\n",
+		},
+		{
+			name:  "next quiet",
+			args:  []string{"-n", "n;p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "two\nfour\n",
+		},
+		{
+			name:  "append next",
+			args:  []string{`N;s/\n/ /`},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one two\nthree four\nfive\n",
+		},
+		{
+			name:  "append next at end",
+			args:  []string{`N;s/\n/ /`},
+			stdin: "a\nb\nc\n",
+			want:  "a b\nc\n",
+		},
+		{
+			name:  "join all lines",
+			args:  []string{`:a;N;$!ba;s/\n/,/g`},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one,two,three,four,five\n",
+		},
+		{
+			name:  "delete first line",
+			args:  []string{"$!N;P;D"},
+			stdin: "a\na\nb\nb\nb\nc\n",
+			want:  "a\na\nb\nb\nb\nc\n",
+		},
+		{
+			name:  "hold",
+			args:  []string{"-n", "1!G;h;$p"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "five\nfour\nthree\ntwo\none\n",
+		},
+		{
+			name:  "hold append",
+			args:  []string{"-n", `H;${x;s/\n/,/g;p}`},
+			stdin: "a\nb\nc\n",
+			want:  ",a,b,c\n",
+		},
+		{
+			name:  "exchange",
+			args:  []string{"x"},
+			stdin: "a\nb\n",
+			want:  "\na\n",
+		},
+		{
+			name:  "get",
+			args:  []string{"1h;2g"},
+			stdin: "a\nb\n",
+			want:  "a\na\n",
+		},
+		{
+			name:  "block",
+			args:  []string{"/t/{s/t/T/;s/e/E/}"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\nTwo\nThrEe\nfour\nfive\n",
+		},
+		{
+			name:  "nested blocks",
+			args:  []string{"-n", "2,4{/f/!{p}}"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "two\nthree\n",
+		},
+		{
+			name:  "block semicolons",
+			args:  []string{"-n", "/o/{p;p}"},
+			stdin: "one\ntwo\n",
+			want:  "one\none\ntwo\ntwo\n",
+		},
+		{
+			name:  "branch",
+			args:  []string{"/two/b;s/o/0/"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "0ne\ntwo\nthree\nf0ur\nfive\n",
+		},
+		{
+			name:  "branch label",
+			args:  []string{"-e", "/two/bend", "-e", "s/o/0/", "-e", ":end"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "0ne\ntwo\nthree\nf0ur\nfive\n",
+		},
+		{
+			name:  "test",
+			args:  []string{":a;s/aa/a/;ta"},
+			stdin: "aaaaa\n",
+			want:  "a\n",
+		},
+		{
+			name:  "test not",
+			args:  []string{"s/x/X/;Tskip;s/$/!/;:skip"},
+			stdin: "x\ny\n",
+			want:  "X!\ny\n",
+		},
+		{
+			name:  "quit",
+			args:  []string{"2q"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\ntwo\n",
+		},
+		{
+			name:  "quit exit code",
+			args:  []string{"2q5"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\ntwo\n",
+			code:  5,
+		},
+		{
+			name:  "quit silent",
+			args:  []string{"2Q"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			want:  "one\n",
+		},
+		{
+			name:  "list",
+			args:  []string{"-n", "l"},
+			stdin: "a\tb\\c\x01\n",
+			want:  "a\\tb\\\\c\\001$\n",
+		},
+		{
+			name:  "list wrap",
+			args:  []string{"-n", "l 10"},
+			stdin: "abcdefghijklmnop\n",
+			want:  "abcdefghi\\\njklmnop$\n",
+		},
+		{
+			name:  "list line length",
+			args:  []string{"-l", "6", "-n", "l"},
+			stdin: "abcdefghij\n",
+			want:  "abcde\\\nfghij$\n",
+		},
+		{
+			name:  "first line",
+			args:  []string{"-n", "N;P"},
+			stdin: "a\nb\n",
+			want:  "a\n",
+		},
+		{
+			name:  "zap",
+			args:  []string{"2z"},
+			stdin: "a\nb\nc\n",
+			want:  "a\n\nc\n",
+		},
+		{
+			name:  "missing newline",
+			args:  []string{"s/a/b/"},
+			stdin: "a\na",
+			want:  "b\nb",
+		},
+		{
+			name:  "missing newline print",
+			args:  []string{"p"},
+			stdin: "x",
+			want:  "x\nx",
+		},
+		{
+			name:  "missing newline append",
+			args:  []string{"a\\\nz"},
+			stdin: "x",
+			want:  "x\nz\n",
+		},
+		{
+			name:  "files",
+			args:  []string{"-n", "$p", "a.txt", "b.txt"},
+			files: map[string]string{"a.txt": "1\n2\n", "b.txt": "3\n4\n"},
+			want:  "4\n",
+		},
+		{
+			name:  "files separate",
+			args:  []string{"-s", "-n", "$p;1p", "a.txt", "b.txt"},
+			files: map[string]string{"a.txt": "1\n2\n", "b.txt": "3\n4\n"},
+			want:  "1\n2\n3\n4\n",
+		},
+		{
+			name:  "files line numbers",
+			args:  []string{"-n", "3p", "a.txt", "b.txt"},
+			files: map[string]string{"a.txt": "1\n2\n", "b.txt": "3\n4\n"},
+			want:  "3\n",
+		},
+		{
+			name:  "file name",
+			args:  []string{"F"},
+			files: map[string]string{"a.txt": "1\n"},
+		},
+		{
+			name:  "file stdin name",
+			args:  []string{"-s", "F", "-"},
+			stdin: "x\n",
+			want:  "-\nx\n",
+		},
+		{
+			name:  "missing file",
+			args:  []string{"p", "missing.txt", "a.txt"},
+			files: map[string]string{"a.txt": "1\n"},
+			want:  "1\n1\n",
+			code:  2,
+		},
+		{
+			name:  "read file",
+			args:  []string{"1r r.txt"},
+			stdin: "a\nb\n",
+			files: map[string]string{"r.txt": "R1\nR2\n"},
+			want:  "a\nR1\nR2\nb\n",
+		},
+		{
+			name:  "read missing file",
+			args:  []string{"1r nothing"},
+			stdin: "a\nb\n",
+			want:  "a\nb\n",
+		},
+		{
+			name:  "read line",
+			args:  []string{"R r.txt"},
+			stdin: "a\nb\nc\n",
+			files: map[string]string{"r.txt": "R1\nR2\n"},
+			want:  "a\nR1\nb\nR2\nc\n",
+		},
+		{
+			name:      "write file",
+			args:      []string{"-n", "/o/w out.txt"},
+			stdin:     "one\ntwo\nthree\nfour\nfive\n",
+			wantFiles: map[string]string{"out.txt": "one\ntwo\nfour\n"},
+		},
+		{
+			name:      "write first line",
+			args:      []string{"-n", "N;W out.txt"},
+			stdin:     "a\nb\n",
+			wantFiles: map[string]string{"out.txt": "a\n"},
+		},
+		{
+			name:      "substitute write",
+			args:      []string{"s/o/0/w out.txt"},
+			stdin:     "one\ntwo\nthree\nfour\nfive\n",
+			want:      "0ne\ntw0\nthree\nf0ur\nfive\n",
+			wantFiles: map[string]string{"out.txt": "0ne\ntw0\nf0ur\n"},
+		},
+		{
+			name:  "write stdout",
+			args:  []string{"s/o/0/w /dev/stdout"},
+			stdin: "foo\n",
+			want:  "f0o\nf0o\n",
+		},
+		{
+			name:  "script file",
+			args:  []string{"-f", "script.sed"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			files: map[string]string{"script.sed": "# comment\n/one/d\ns/t/T/\n"},
+			want:  "Two\nThree\nfour\nfive\n",
+		},
+		{
+			name:  "script file and expression",
+			args:  []string{"-e", "s/one/1/", "-f", "script.sed", "-e", "s/three/3/"},
+			stdin: "one\ntwo\nthree\nfour\nfive\n",
+			files: map[string]string{"script.sed": "s/two/2/\n"},
+			want:  "1\n2\n3\nfour\nfive\n",
+		},
+		{
+			name:  "expression append",
+			args:  []string{"-e", `1a\`, "-e", "text"},
+			stdin: "a\n",
+			want:  "a\ntext\n",
+		},
+		{
+			name:      "in place",
+			args:      []string{"-i", "s/o/0/g", "a.txt"},
+			files:     map[string]string{"a.txt": "foo\nbar\n"},
+			wantFiles: map[string]string{"a.txt": "f00\nbar\n"},
+		},
+		{
+			name:      "in place suffix",
+			args:      []string{"-i.bak", "s/o/0/g", "a.txt"},
+			files:     map[string]string{"a.txt": "foo\n"},
+			wantFiles: map[string]string{"a.txt": "f00\n", "a.txt.bak": "foo\n"},
+		},
+		{
+			name:      "in place long suffix",
+			args:      []string{"--in-place=.orig", "s/o/0/", "a.txt"},
+			files:     map[string]string{"a.txt": "foo\n"},
+			wantFiles: map[string]string{"a.txt": "f0o\n", "a.txt.orig": "foo\n"},
+		},
+		{
+			name:      "in place star suffix",
+			args:      []string{"-i", "-ibak_*", "s/o/0/", "a.txt"},
+			files:     map[string]string{"a.txt": "foo\n"},
+			wantFiles: map[string]string{"a.txt": "f0o\n", "bak_a.txt": "foo\n"},
+		},
+		{
+			name:      "in place grouped",
+			args:      []string{"-ni", "2p", "a.txt"},
+			files:     map[string]string{"a.txt": "1\n2\n3\n"},
+			wantFiles: map[string]string{"a.txt": "2\n"},
+		},
+		{
+			name:      "in place separate files",
+			args:      []string{"-i", "1d;$s/$/!/", "a.txt", "b.txt"},
+			files:     map[string]string{"a.txt": "1\n2\n", "b.txt": "3\n4\n"},
+			wantFiles: map[string]string{"a.txt": "2!\n", "b.txt": "4!\n"},
+		},
+		{
+			name:      "in place quit",
+			args:      []string{"-i", "2q", "a.txt"},
+			files:     map[string]string{"a.txt": "1\n2\n3\n"},
+			wantFiles: map[string]string{"a.txt": "1\n2\n"},
+		},
+		{
+			name:      "in place missing newline",
+			args:      []string{"-i", "s/a/b/", "a.txt"},
+			files:     map[string]string{"a.txt": "a\na"},
+			wantFiles: map[string]string{"a.txt": "b\nb"},
+		},
+		{
+			name:  "null data",
+			args:  []string{"-z", "s/^./X/"},
+			stdin: "ab\x00cd\x00",
+			want:  "Xb\x00Xd\x00",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := setup(t, tt.files)
+			got, stderr, code := runSed(ws, dir, tt.stdin, tt.args...)
+			if got != tt.want || code != tt.code {
+				t.Errorf("sed %q: got %q, exit %d, want %q, exit %d; stderr %q", tt.args, got, code, tt.want, tt.code, stderr)
+			}
+			for name, want := range tt.wantFiles {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Errorf("sed %q: %v", tt.args, err)
+				} else if string(data) != want {
+					t.Errorf("sed %q: got %s %q, want %q", tt.args, name, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSedErrors(t *testing.T) {
+	dir, ws := setup(t, map[string]string{"s.sed": "p\nk\n"})
+	for _, tt := range []struct {
+		args   []string
+		stderr string
+		code   int
+	}{
+		{[]string{"k"}, "sed: -e expression #1, char 1: unknown command: `k'\n", 1},
+		{[]string{"s/a/b"}, "sed: -e expression #1, char 5: unterminated `s' command\n", 1},
+		{[]string{"s/[a/b/"}, "sed: -e expression #1, char 3: unterminated `s' command\n", 1},
+		{[]string{"s/a/b/k"}, "sed: -e expression #1, char 7: unknown option to `s'\n", 1},
+		{[]string{"pq"}, "sed: -e expression #1, char 2: extra characters after command\n", 1},
+		{[]string{"p;}"}, "sed: -e expression #1, char 3: unexpected `}'\n", 1},
+		{[]string{"y/ab/x/"}, "sed: -e expression #1, char 7: strings for `y' command are different lengths\n", 1},
+		{[]string{`s/a/\1/`}, "sed: -e expression #1, char 7: invalid reference \\1 on `s' command's RHS\n", 1},
+		{[]string{"b nowhere"}, "sed: can't find label for jump to `nowhere'\n", 1},
+		{[]string{"-e", "p", "-e", "k"}, "sed: -e expression #2, char 1: unknown command: `k'\n", 1},
+		{[]string{"-f", "s.sed"}, "sed: file s.sed line 2: unknown command: `k'\n", 1},
+		{[]string{"-f", "none.sed"}, "sed: couldn't open file none.sed: no such file or directory\n", 1},
+		{[]string{"1,/o/s//0/"}, "sed: no previous regular expression\n", 1},
+		{[]string{"-i", "p"}, "sed: no input files\n", 4},
+		{[]string{"-i", "p", "-"}, "sed: couldn't edit -: not a regular file\n", 4},
+	} {
+		_, stderr, code := runSed(ws, dir, "a\n", tt.args...)
+		if stderr != tt.stderr || code != tt.code {
+			t.Errorf("sed %q: got %q, exit %d, want %q, exit %d", tt.args, stderr, code, tt.stderr, tt.code)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+// Copyright 2017-2023 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sort
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// order is how keys are compared.
+type order struct {
+	// compare as 'n'umbers, 'g'eneral numbers, 'h'uman readable numbers,
+	// 'M'onths or 'V'ersions, as text if 0
+	kind              byte
+	ignoreBlanks      bool
+	dictionary        bool
+	ignoreNonprinting bool
+	fold              bool
+	reverse           bool
+}
+
+// set applies the option letter, reporting whether it is one.
+func (o *order) set(c byte) bool {
+	switch c {
+	case 'b':
+		o.ignoreBlanks = true
+	case 'd':
+		o.dictionary = true
+	case 'f':
+		o.fold = true
+	case 'i':
+		o.ignoreNonprinting = true
+	case 'r':
+		o.reverse = true
+	case 'n', 'g', 'h', 'M', 'V':
+		o.kind = c
+	default:
+		return false
+	}
+	return true
+}
+
+// key is a sort key: the part of a line from a character of a field to a
+// character of another field, or to the end of the line.
+type key struct {
+	startField, startChar int
+	// field 0 is the end of the line, char 0 the end of the field
+	endField, endChar int
+	// skip the blanks at the start of the fields of the start and the end
+	startBlanks, endBlanks bool
+	order
+}
+
+// parseKey parses a key definition F[.C][OPTS][,F[.C][OPTS]]. Keys without
+// ordering options are compared with the global ones.
+func parseKey(s string, global order) (*key, error) {
+	k := &key{}
+	start, end, hasEnd := strings.Cut(s, ",")
+
+	var opts order
+	var err error
+	if k.startField, k.startChar, err = parsePos(start, &opts, &k.startBlanks); err != nil || k.startField < 1 || k.startChar == 0 {
+		return nil, fmt.Errorf("invalid number at field start: invalid count at start of '%s'", s)
+	}
+	k.startChar = max(k.startChar, 1)
+	if hasEnd {
+		if k.endField, k.endChar, err = parsePos(end, &opts, &k.endBlanks); err != nil || k.endField < 1 {
+			return nil, fmt.Errorf("invalid number after ',': invalid count at start of '%s'", end)
+		}
+		k.endChar = max(k.endChar, 0)
+	}
+	k.order = opts
+	if opts == (order{}) && !k.startBlanks && !k.endBlanks {
+		k.order = global
+		k.startBlanks, k.endBlanks = global.ignoreBlanks, global.ignoreBlanks
+	}
+	return k, nil
+}
+
+// parsePos parses F[.C][OPTS]; the char is -1 if it is not given.
+func parsePos(s string, o *order, blanks *bool) (int, int, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	num, opts := s[:i], s[i:]
+	field, char, hasChar := strings.Cut(num, ".")
+	f, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, 0, err
+	}
+	c := -1
+	if hasChar {
+		if c, err = strconv.Atoi(char); err != nil {
+			return 0, 0, err
+		}
+	}
+	for j := 0; j < len(opts); j++ {
+		if opts[j] == 'b' {
+			*blanks = true
+			continue
+		}
+		if !o.set(opts[j]) {
+			return 0, 0, fmt.Errorf("invalid option '%c'", opts[j])
+		}
+	}
+	return f, c, nil
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// fieldStart returns the offset of the n-th field. Without a separator
+// fields are separated by the empty string between a non-blank and a
+// blank, their leading blanks included.
+func fieldStart(line string, n, sep int) int {
+	i := 0
+	for f := 1; f < n && i < len(line); f++ {
+		if sep >= 0 {
+			j := strings.IndexByte(line[i:], byte(sep))
+			if j < 0 {
+				return len(line)
+			}
+			i += j + 1
+			continue
+		}
+		for i < len(line) && isBlank(line[i]) {
+			i++
+		}
+		for i < len(line) && !isBlank(line[i]) {
+			i++
+		}
+	}
+	return i
+}
+
+// fieldEnd returns the offset of the end of the n-th field.
+func fieldEnd(line string, n, sep int) int {
+	i := fieldStart(line, n, sep)
+	if sep >= 0 {
+		if j := strings.IndexByte(line[i:], byte(sep)); j >= 0 {
+			return i + j
+		}
+		return len(line)
+	}
+	for i < len(line) && isBlank(line[i]) {
+		i++
+	}
+	for i < len(line) && !isBlank(line[i]) {
+		i++
+	}
+	return i
+}
+
+func skipBlanks(line string, i int) int {
+	for i < len(line) && isBlank(line[i]) {
+		i++
+	}
+	return i
+}
+
+// extract returns the key of the line.
+func (k *key) extract(line string, sep int) string {
+	start := fieldStart(line, k.startField, sep)
+	if k.startBlanks {
+		start = skipBlanks(line, start)
+	}
+	start = min(start+k.startChar-1, len(line))
+	end := len(line)
+	if k.endField > 0 {
+		if k.endChar == 0 {
+			end = fieldEnd(line, k.endField, sep)
+		} else {
+			end = fieldStart(line, k.endField, sep)
+			if k.endBlanks {
+				end = skipBlanks(line, end)
+			}
+			end = min(end+k.endChar, len(line))
+		}
+	}
+	return line[start:max(start, end)]
+}
+
+// compare compares the keys of two lines.
+func (k *key) compare(a, b string) int {
+	var c int
+	switch k.kind {
+	case 'n':
+		c = compareNumbers(a, b)
+	case 'g':
+		c = compareGeneral(a, b)
+	case 'h':
+		c = compareHuman(a, b)
+	case 'M':
+		c = month(a) - month(b)
+	case 'V':
+		c = compareVersions(a, b)
+	default:
+		if k.dictionary || k.ignoreNonprinting || k.fold {
+			a, b = k.text(a), k.text(b)
+		}
+		c = strings.Compare(a, b)
+	}
+	if k.reverse {
+		return -c
+	}
+	return c
+}
+
+// text drops the characters ignored by -d and -i and folds lower case to
+// upper case with -f.
+func (k *key) text(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case k.dictionary && !(isBlank(byte(r)) && r < 0x80 || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z'):
+			return -1
+		case k.ignoreNonprinting && (r < ' ' || r == 0x7f):
+			return -1
+		case k.fold && r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, s)
+}
+
+// number is the sign, integer and fraction digits of a decimal number,
+// without insignificant zeros.
+type number struct {
+	neg        bool
+	int, frac  string
+	suffixRank int
+}
+
+// parseNumber parses the number at the start of s after blanks, zero if
+// there is none. A human readable size suffix follows it with human.
+func parseNumber(s string, human bool) number {
+	var n number
+	i := skipBlanks(s, 0)
+	if i < len(s) && s[i] == '-' {
+		n.neg = true
+		i++
+	}
+	j := i
+	for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+		j++
+	}
+	n.int = strings.TrimLeft(s[i:j], "0")
+	if j < len(s) && s[j] == '.' {
+		k := j + 1
+		for k < len(s) && s[k] >= '0' && s[k] <= '9' {
+			k++
+		}
+		n.frac = strings.TrimRight(s[j+1:k], "0")
+		j = k
+	}
+	if human && j < len(s) && j > i {
+		if r := strings.IndexByte("KMGTPEZYRQ", s[j]); r >= 0 {
+			n.suffixRank = r + 1
+		} else if s[j] == 'k' {
+			n.suffixRank = 1
+		}
+	}
+	if n.int == "" && n.frac == "" {
+		n.neg = false
+	}
+	return n
+}
+
+func (n number) sign() int {
+	switch {
+	case n.neg:
+		return -1
+	case n.int == "" && n.frac == "":
+		return 0
+	}
+	return 1
+}
+
+// compareMagnitude compares the absolute values.
+func (n number) compareMagnitude(m number) int {
+	if c := len(n.int) - len(m.int); c != 0 {
+		return c
+	}
+	if c := strings.Compare(n.int, m.int); c != 0 {
+		return c
+	}
+	return strings.Compare(n.frac, m.frac)
+}
+
+// compareNumbers compares the leading decimal numbers of the strings
+// exactly, whatever their length.
+func compareNumbers(a, b string) int {
+	x, y := parseNumber(a, false), parseNumber(b, false)
+	if c := x.sign() - y.sign(); c != 0 {
+		return c
+	}
+	c := x.compareMagnitude(y)
+	if x.neg {
+		return -c
+	}
+	return c
+}
+
+// compareHuman compares numbers with size suffixes such as 2K and 1G, by
+// sign, then suffix, then value.
+func compareHuman(a, b string) int {
+	x, y := parseNumber(a, true), parseNumber(b, true)
+	if c := x.sign() - y.sign(); c != 0 {
+		return c
+	}
+	c := x.suffixRank - y.suffixRank
+	if c == 0 {
+		c = x.compareMagnitude(y)
+	}
+	if x.neg {
+		return -c
+	}
+	return c
+}
+
+// general parses the leading floating point number of s, reporting
+// whether there is one.
+func general(s string) (float64, bool) {
+	s = s[skipBlanks(s, 0):]
+	// the longest prefix that parses
+	end := 0
+	i := 0
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+	lower := strings.ToLower(s[i:min(len(s), i+8)])
+	switch {
+	case strings.HasPrefix(lower, "infinity"):
+		end = i + 8
+	case strings.HasPrefix(lower, "inf"), strings.HasPrefix(lower, "nan"):
+		end = i + 3
+	default:
+		digits := false
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i, digits = i+1, true
+		}
+		if i < len(s) && s[i] == '.' {
+			i++
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i, digits = i+1, true
+			}
+		}
+		if !digits {
+			return 0, false
+		}
+		end = i
+		if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+			j := i + 1
+			if j < len(s) && (s[j] == '-' || s[j] == '+') {
+				j++
+			}
+			k := j
+			for k < len(s) && s[k] >= '0' && s[k] <= '9' {
+				k++
+			}
+			if k > j {
+				end = k
+			}
+		}
+	}
+	f, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil && !math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// compareGeneral compares floating point numbers. Strings that are not
+// numbers come first, then NaNs, then numbers by value.
+func compareGeneral(a, b string) int {
+	x, okx := general(a)
+	y, oky := general(b)
+	rank := func(f float64, ok bool) int {
+		switch {
+		case !ok:
+			return 0
+		case math.IsNaN(f):
+			return 1
+		}
+		return 2
+	}
+	if c := rank(x, okx) - rank(y, oky); c != 0 || !okx || math.IsNaN(x) {
+		return c
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+var months = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+// month returns the number of the month abbreviation at the start of s,
+// 0 if there is none.
+func month(s string) int {
+	s = s[skipBlanks(s, 0):]
+	if len(s) < 3 {
+		return 0
+	}
+	m := strings.ToUpper(s[:3])
+	for i, name := range months {
+		if m == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// compareVersions compares file names with version numbers, as
+// filevercmp: "." and ".." first, then hidden files, then the others by
+// their versions without file name suffixes, such as ".tar.gz".
+func compareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+	for _, special := range []string{"", ".", ".."} {
+		if a == special {
+			return -1
+		}
+		if b == special {
+			return 1
+		}
+	}
+	ha, hb := strings.HasPrefix(a, "."), strings.HasPrefix(b, ".")
+	if ha != hb {
+		if ha {
+			return -1
+		}
+		return 1
+	}
+	if ha {
+		a, b = a[1:], b[1:]
+	}
+	if c := verrevcmp(a[:suffixStart(a)], b[:suffixStart(b)]); c != 0 {
+		return c
+	}
+	if c := verrevcmp(a, b); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// suffixStart returns where the file name suffix of s starts: the
+// trailing sequence of (\.[A-Za-z~][A-Za-z0-9~]*)*.
+func suffixStart(s string) int {
+	alpha := func(c byte) bool { return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '~' }
+	start := len(s)
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == '.' && i+1 < len(s) && alpha(s[i+1]) {
+			start = i
+			continue
+		}
+		if !alpha(c) && !(c >= '0' && c <= '9') {
+			break
+		}
+	}
+	return start
+}
+
+// verrevcmp compares versions as Debian does: runs of non-digits by
+// character, '~' before anything, letters before other characters, and
+// runs of digits by value.
+func verrevcmp(a, b string) int {
+	digit := func(s string, i int) bool { return i < len(s) && s[i] >= '0' && s[i] <= '9' }
+	ord := func(s string, i int) int {
+		if i >= len(s) {
+			return 0
+		}
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			return 0
+		case c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+			return int(c)
+		case c == '~':
+			return -1
+		}
+		return int(c) + 256
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !digit(a, i) || j < len(b) && !digit(b, j) {
+			if c := ord(a, i) - ord(b, j); c != 0 {
+				return c
+			}
+			i, j = i+1, j+1
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		first := 0
+		for digit(a, i) && digit(b, j) {
+			if first == 0 {
+				first = int(a[i]) - int(b[j])
+			}
+			i, j = i+1, j+1
+		}
+		if digit(a, i) {
+			return 1
+		}
+		if digit(b, j) {
+			return -1
+		}
+		if first != 0 {
+			return first
+		}
+	}
+	return 0
+}
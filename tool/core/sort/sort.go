@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Sort lines.
+// Sort lines of workspace files.
 //
 // Synopsis:
 //
@@ -10,266 +10,729 @@
 //
 // Description:
 //
-//	Sort copies lines from the input to the output, sorting them in the
-//	process. This does nothing fancy (no multi-threading, compression,
-//	optiminzations, ...); it simply uses Go's sort.Sort function.
+//	Sort writes the sorted concatenation of the inputs, or of stdin, to
+//	the output. Lines that compare equal are ordered by all their bytes
+//	unless -s or -u is given. Inputs larger than the buffer size are
+//	sorted in runs written to temporary files inside the workspace, which
+//	are then merged.
 //
 // Options:
 //
-//	-r:      Reverse the result of comparisons
-//	-C:      Check that the single input file is ordered. No warnings.
-//	-u:	     Unique keys. Suppress all lines that have a key that is equal to an already processed one.
-//	-f: 	 Fold lower case to upper case character.
-//	-b: 	 Ignore leading blank characters when comparing lines.
-//	-n:      Compare according to string numerical value.
-//	-o FILE: Specify the name of an output file to be used instead of the standard output.
-package main
+//	-b, --ignore-leading-blanks:  ignore leading blanks
+//	-d, --dictionary-order:       consider only blanks and alphanumeric characters
+//	-f, --ignore-case:            fold lower case to upper case characters
+//	-g, --general-numeric-sort:   compare by floating point value
+//	-i, --ignore-nonprinting:     consider only printable characters
+//	-M, --month-sort:             compare month abbreviations, JAN < ... < DEC
+//	-h, --human-numeric-sort:     compare human readable numbers, such as 2K and 1G
+//	-n, --numeric-sort:           compare by numerical value
+//	-V, --version-sort:           compare version numbers within text
+//	-r, --reverse:                reverse the result of comparisons
+//	-c, --check[=diagnose-first]: check whether the input is sorted, report the first disorder
+//	-C, --check=quiet|silent:     like -c, without the report
+//	-k, --key KEYDEF:             sort by a key; KEYDEF is F[.C][OPTS][,F[.C][OPTS]]
+//	-m, --merge:                  merge already sorted inputs
+//	-o, --output FILE:            write the result to FILE instead of stdout
+//	-s, --stable:                 do not compare whole lines as a last resort
+//	-S, --buffer-size SIZE:       the memory for sorting, such as 64M (default: 64M)
+//	-t, --field-separator SEP:    separate fields by SEP instead of blank transitions
+//	-T, --temporary-directory DIR: put temporary files in DIR (default: the working directory)
+//	-u, --unique:                 output only the first of equal lines
+//	-z, --zero-terminated:        lines end with NUL, not newline
+//
+// Keys may be given several times. OPTS are one or more of the ordering
+// letters b, d, f, g, h, i, M, n, r and V; keys without them use the global
+// options.
+package sort
 
 import (
+	"bufio"
+	"container/heap"
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"math/rand"
 	"os"
-	"sort"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
-	"unicode"
-)
 
-var (
-	reverse      = flag.Bool("r", false, "Reverse the result of comparisons.")
-	ordered      = flag.Bool("C", false, "Check that the single input file is ordered. No warnings.")
-	unique       = flag.Bool("u", false, "Unique keys. Suppress all lines that have a key that is equal to an already processed one.")
-	ignoreCase   = flag.Bool("f", false, "Fold lower case to upper case character.")
-	ignoreBlanks = flag.Bool("b", false, "Ignore leading blank characters when comparing lines.")
-	numeric      = flag.Bool("n", false, "Compare according to string numerical value.")
-	outputFile   = flag.String("o", "", "Specify the name of an output file to be used instead of the standard output.")
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
 )
 
-type ignoreCaseSort []string
+const (
+	defaultBufferSize = 64 << 20
+	// the number of runs merged at once
+	mergeBatch = 16
+	// the estimated memory of a line besides its bytes
+	lineOverhead = 32
+)
 
-func (a ignoreCaseSort) Len() int           { return len(a) }
-func (a ignoreCaseSort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a ignoreCaseSort) Less(i, j int) bool { return strings.ToUpper(a[i]) < strings.ToUpper(a[j]) }
+// command implements the sort core utility.
+type command struct {
+	core.Base
 
-type ignoreBlanksSort []string
+	ws vfs.Workspace
+}
 
-func (a ignoreBlanksSort) Len() int      { return len(a) }
-func (a ignoreBlanksSort) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a ignoreBlanksSort) Less(i, j int) bool {
-	l := strings.TrimLeftFunc(a[i], unicode.IsSpace)
-	r := strings.TrimLeftFunc(a[j], unicode.IsSpace)
-	if l == r {
-		return len(a[i]) >= len(a[j])
+// New creates a new sort command.
+func New(ws vfs.Workspace) core.Command {
+	c := &command{
+		ws: ws,
 	}
-	return l < r
+	c.Init()
+	return c
 }
 
-type ignoreBlanksCaseSort []string
+// listFlag collects the values of a flag given several times.
+type listFlag []string
 
-func (a ignoreBlanksCaseSort) Len() int      { return len(a) }
-func (a ignoreBlanksCaseSort) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a ignoreBlanksCaseSort) Less(i, j int) bool {
-	l := strings.ToUpper(strings.TrimLeftFunc(a[i], unicode.IsSpace))
-	r := strings.ToUpper(strings.TrimLeftFunc(a[j], unicode.IsSpace))
-	if l == r {
-		return len(a[i]) >= len(a[j])
-	}
-	return l < r
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(s string) error { *l = append(*l, s); return nil }
+
+// checkFlag is -c, -C and --check[=diagnose-first|quiet|silent].
+type checkFlag struct {
+	check, quiet bool
 }
 
-type numericSort []string
+func (c *checkFlag) String() string   { return "" }
+func (c *checkFlag) IsBoolFlag() bool { return true }
+func (c *checkFlag) Set(s string) error {
+	switch s {
+	case "true", "diagnose-first":
+		c.check = true
+	case "quiet", "silent":
+		c.check, c.quiet = true, true
+	case "false":
+		c.check = false
+	default:
+		return fmt.Errorf("invalid argument '%s' for '--check'", s)
+	}
+	return nil
+}
 
-func (a numericSort) Len() int      { return len(a) }
-func (a numericSort) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a numericSort) Less(i, j int) bool {
-	// consider removing thousands separator and parsing LC_NUMERIC
-	l := strings.ToUpper(strings.TrimLeftFunc(a[i], unicode.IsSpace))
-	r := strings.ToUpper(strings.TrimLeftFunc(a[j], unicode.IsSpace))
+// quietFlag is -C.
+type quietFlag struct{ *checkFlag }
 
-	// treat all non-numeric characters as zeros
-	ln, _ := strconv.ParseFloat(l, 64)
-	rn, _ := strconv.ParseFloat(r, 64)
+func (q quietFlag) Set(s string) error {
+	if s == "false" {
+		return q.checkFlag.Set(s)
+	}
+	return q.checkFlag.Set("quiet")
+}
 
-	return ln < rn
+type flags struct {
+	order
+	check      checkFlag
+	keys       listFlag
+	merge      bool
+	output     string
+	stable     bool
+	bufferSize string
+	separator  string
+	tempDir    string
+	unique     bool
+	zero       bool
 }
 
-var errNotOrdered = errors.New("not ordered")
+// sorter compares lines.
+type sorter struct {
+	keys []*key
+	// the field separator, -1 for blank transitions
+	sep int
+	// compare whole lines as a last resort, reversed with reverse
+	lastResort bool
+	reverse    bool
+	unique     bool
+}
 
-type params struct {
-	outputFile   string
-	reverse      bool
-	ordered      bool
-	unique       bool
-	ignoreCase   bool
-	ignoreBlanks bool
-	numeric      bool
+// compare compares the lines by their keys, then by all their bytes.
+func (s *sorter) compare(a, b string) int {
+	for _, k := range s.keys {
+		if c := k.compare(k.extract(a, s.sep), k.extract(b, s.sep)); c != 0 {
+			return c
+		}
+	}
+	if !s.lastResort {
+		return 0
+	}
+	c := strings.Compare(a, b)
+	if s.reverse {
+		return -c
+	}
+	return c
 }
 
-type cmd struct {
-	stdin  io.ReadCloser
-	stdout io.Writer
-	stderr io.Writer
-	params params
-	args   []string
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
 }
 
-func command(stdin io.ReadCloser, stdout, stderr io.Writer, p params, args []string) *cmd {
-	return &cmd{
-		stdin:  stdin,
-		stdout: stdout,
-		stderr: stderr,
-		params: p,
-		args:   args,
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("sort", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	boolVar := func(p *bool, short, long, usage string) {
+		fs.BoolVar(p, short, false, usage)
+		fs.BoolVar(p, long, false, usage)
+	}
+	stringVar := func(p *string, short, long, value, usage string) {
+		fs.StringVar(p, short, value, usage)
+		fs.StringVar(p, long, value, usage)
+	}
+	kind := func(short, long, usage string) {
+		v := orderFlag{&f.order, short[0]}
+		fs.Var(v, short, usage)
+		fs.Var(v, long, usage)
+	}
+
+	boolVar(&f.ignoreBlanks, "b", "ignore-leading-blanks", "ignore leading blanks")
+	boolVar(&f.dictionary, "d", "dictionary-order", "consider only blanks and alphanumeric characters")
+	boolVar(&f.fold, "f", "ignore-case", "fold lower case to upper case characters")
+	boolVar(&f.ignoreNonprinting, "i", "ignore-nonprinting", "consider only printable characters")
+	boolVar(&f.reverse, "r", "reverse", "reverse the result of comparisons")
+	kind("g", "general-numeric-sort", "compare by floating point value")
+	kind("M", "month-sort", "compare month abbreviations, JAN < ... < DEC")
+	kind("h", "human-numeric-sort", "compare human readable numbers, such as 2K and 1G")
+	kind("n", "numeric-sort", "compare by numerical value")
+	kind("V", "version-sort", "compare version numbers within text")
+	fs.Var(&f.check, "c", "check whether the input is sorted")
+	fs.Var(&f.check, "check", "check whether the input is sorted, quietly with quiet or silent")
+	fs.Var(quietFlag{&f.check}, "C", "check whether the input is sorted, without a report")
+	fs.Var(&f.keys, "k", "sort by a key; KEYDEF is F[.C][OPTS][,F[.C][OPTS]]")
+	fs.Var(&f.keys, "key", "sort by a key; KEYDEF is F[.C][OPTS][,F[.C][OPTS]]")
+	boolVar(&f.merge, "m", "merge", "merge already sorted inputs")
+	stringVar(&f.output, "o", "output", "", "write the result to FILE instead of stdout")
+	boolVar(&f.stable, "s", "stable", "do not compare whole lines as a last resort")
+	stringVar(&f.bufferSize, "S", "buffer-size", "", "the memory for sorting, such as 64M")
+	stringVar(&f.separator, "t", "field-separator", "", "separate fields by SEP instead of blank transitions")
+	stringVar(&f.tempDir, "T", "temporary-directory", "", "put temporary files in DIR")
+	boolVar(&f.unique, "u", "unique", "output only the first of equal lines")
+	boolVar(&f.zero, "z", "zero-terminated", "lines end with NUL, not newline")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "sort [OPTIONS]... [INPUT]...\n\n")
+		fmt.Fprintf(fs.Output(), "Sort writes the sorted concatenation of the inputs to the output.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
 	}
-}
 
-func (c *cmd) run() error {
-	// Input files
-	from := []io.ReadCloser{}
-	for _, v := range c.args {
-		f, err := os.Open(v)
+	valued := []string{"k", "key", "o", "output", "S", "buffer-size", "t", "field-separator", "T", "temporary-directory"}
+	if err := fs.Parse(cli.Args(args, valued...)); err != nil {
+		return cli.Exit(2, err)
+	}
+
+	s := &sorter{
+		sep:        -1,
+		lastResort: !f.stable && !f.unique,
+		reverse:    f.reverse,
+		unique:     f.unique,
+	}
+	switch {
+	case f.separator == "":
+	case f.separator == `\0`:
+		s.sep = 0
+	case len(f.separator) == 1:
+		s.sep = int(f.separator[0])
+	default:
+		return cli.Exit(2, fmt.Errorf("multi-character tab '%s'", f.separator))
+	}
+	for _, def := range f.keys {
+		k, err := parseKey(def, f.order)
 		if err != nil {
-			return err
+			return cli.Exit(2, fmt.Errorf("%v", err))
 		}
-		defer f.Close()
-		from = append(from, f)
+		s.keys = append(s.keys, k)
 	}
-
-	if len(c.args) == 0 {
-		from = append(from, c.stdin)
+	if len(s.keys) == 0 {
+		s.keys = []*key{{
+			startField:  1,
+			startChar:   1,
+			startBlanks: f.ignoreBlanks,
+			endBlanks:   f.ignoreBlanks,
+			order:       f.order,
+		}}
 	}
 
-	// Read unicode string from input
-	fileContents := []string{}
-	for _, f := range from {
-		bytes, err := io.ReadAll(f)
+	bufferSize := int64(defaultBufferSize)
+	if f.bufferSize != "" {
+		n, err := parseSize(f.bufferSize)
 		if err != nil {
-			return err
+			return cli.Exit(2, fmt.Errorf("invalid -S argument '%s'", f.bufferSize))
 		}
-		s := string(bytes)
-		fileContents = append(fileContents, s)
-		// Add a separator between files if the file is not newline
-		// terminated. Prevents concatenating lines between files.
-		if len(s) > 0 && s[len(s)-1] != '\n' {
-			fileContents = append(fileContents, "\n")
+		bufferSize = n
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	eol := byte('\n')
+	if f.zero {
+		eol = 0
+	}
+
+	r := &run{
+		command:    c,
+		ctx:        ctx,
+		sorter:     s,
+		eol:        eol,
+		bufferSize: bufferSize,
+		tempDir:    c.ResolvePath(cmpOr(f.tempDir, ".")),
+	}
+	defer r.cleanup()
+
+	if f.check.check {
+		if len(inputs) > 1 {
+			return cli.Exit(2, fmt.Errorf("extra operand '%s' not allowed with -c", inputs[1]))
 		}
+		return r.checkSorted(inputs[0], f.check.quiet)
+	}
+	return r.sort(inputs, f.output, f.merge)
+}
+
+// orderFlag sets the kind of comparison.
+type orderFlag struct {
+	o    *order
+	kind byte
+}
+
+func (v orderFlag) String() string   { return "" }
+func (v orderFlag) IsBoolFlag() bool { return true }
+func (v orderFlag) Set(s string) error {
+	if s != "false" {
+		v.o.kind = v.kind
 	}
+	return nil
+}
 
-	s := strings.Join(fileContents, "")
-	if len(s) > 0 && s[len(s)-1] == '\n' {
-		s = s[:len(s)-1] // remove newline terminator
+func cmpOr(s, def string) string {
+	if s == "" {
+		return def
 	}
+	return s
+}
 
-	if c.params.ordered {
-		// if ordered is true, set ignoreBlanks to false to be consistent with coreutils
-		// see https://github.com/coreutils/coreutils/blob/d53190ed46a55f599800ebb2d8ddfe38205dbd24/src/sort.c#L4147
-		c.params.ignoreBlanks = false
-		lines := strings.Split(s, "\n")
-		if !sort.IsSorted(c.sortInterface(lines)) {
-			return errNotOrdered
+// parseSize parses a size with an optional b, K, M, G or T suffix,
+// kibibytes without one.
+func parseSize(s string) (int64, error) {
+	mult := int64(1 << 10)
+	if i := strings.IndexAny(s, "bKkMmGgTt"); i >= 0 && i == len(s)-1 {
+		switch s[i] {
+		case 'b':
+			mult = 1
+		case 'K', 'k':
+			mult = 1 << 10
+		case 'M', 'm':
+			mult = 1 << 20
+		case 'G', 'g':
+			mult = 1 << 30
+		case 'T', 't':
+			mult = 1 << 40
 		}
+		s = s[:i]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size")
+	}
+	return n * mult, nil
+}
+
+// run is a sort in progress.
+type run struct {
+	*command
+	ctx        context.Context
+	sorter     *sorter
+	eol        byte
+	bufferSize int64
+	tempDir    string
+	// the temporary files to remove
+	temps []string
+}
+
+// lineReader reads lines without their terminators.
+type lineReader struct {
+	r   *bufio.Reader
+	eol byte
+	c   io.Closer
+}
+
+func (l *lineReader) next() (string, bool, error) {
+	line, err := l.r.ReadString(l.eol)
+	if err == io.EOF {
+		return line, line != "", nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return line[:len(line)-1], true, nil
+}
+
+func (l *lineReader) close() {
+	if l.c != nil {
+		l.c.Close()
+	}
+}
+
+// open opens an input, "-" being stdin.
+func (r *run) open(name string) (*lineReader, error) {
+	if name == "-" {
+		return &lineReader{r: bufio.NewReader(r.Stdin), eol: r.eol}, nil
+	}
+	f, err := r.ws.OpenFile(r.ResolvePath(name), os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read: %s: %w", name, cause(err))
+	}
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("read failed: %s: Is a directory", name)
+	}
+	return &lineReader{r: bufio.NewReader(f), eol: r.eol, c: f}, nil
+}
+
+// cause strips the operation and the path from path errors.
+func cause(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
 
-		if c.params.unique && len(lines) > 1 {
-			for i := 1; i < len(lines); i++ {
-				if c.params.ignoreCase && strings.EqualFold(lines[i], lines[i-1]) {
-					return errNotOrdered
-				} else if lines[i] == lines[i-1] {
-					return errNotOrdered
+// checkSorted reports whether the input is sorted with exit status 1 and
+// the first disorder on stderr unless quiet.
+func (r *run) checkSorted(name string, quiet bool) error {
+	in, err := r.open(name)
+	if err != nil {
+		return cli.Exit(2, err)
+	}
+	defer in.close()
+	var prev string
+	for n := 1; ; n++ {
+		line, ok, err := in.next()
+		if err != nil {
+			return cli.Exit(2, err)
+		}
+		if !ok {
+			return nil
+		}
+		if n > 1 {
+			c := r.sorter.compare(prev, line)
+			if c > 0 || c == 0 && r.sorter.unique {
+				if !quiet {
+					fmt.Fprintf(r.Stderr, "sort: %s:%d: disorder: %s\n", name, n, line)
 				}
+				return cli.Exit(1, nil)
 			}
 		}
+		prev = line
+	}
+}
 
-		return nil
+// sort sorts or merges the inputs to the output. Everything is read
+// before the output is opened, so that it may be one of the inputs.
+func (r *run) sort(inputs []string, output string, merge bool) error {
+	var sources []source
+	if merge {
+		for _, name := range inputs {
+			if name != "-" && output != "" && r.ResolvePath(name) == r.ResolvePath(output) {
+				// the output would truncate the input before it is read
+				path, err := r.spill(name)
+				if err != nil {
+					return cli.Exit(2, err)
+				}
+				in, err := r.openTemp(path)
+				if err != nil {
+					return cli.Exit(2, err)
+				}
+				sources = append(sources, in)
+				continue
+			}
+			in, err := r.open(name)
+			if err != nil {
+				return cli.Exit(2, err)
+			}
+			sources = append(sources, in)
+		}
+	} else {
+		var err error
+		if sources, err = r.runs(inputs); err != nil {
+			return cli.Exit(2, err)
+		}
+	}
+	defer func() {
+		for _, s := range sources {
+			s.close()
+		}
+	}()
+
+	for len(sources) > mergeBatch {
+		merged, err := r.mergeToTemp(sources[:mergeBatch])
+		if err != nil {
+			return cli.Exit(2, err)
+		}
+		sources = append(sources[mergeBatch:], merged)
 	}
 
-	if err := c.writeOutput(c.stdout, c.sortAlgorithm(s)); err != nil {
-		return err
+	var w io.Writer = r.Stdout
+	if output != "" {
+		f, err := r.ws.OpenFile(r.ResolvePath(output), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return cli.Exit(2, fmt.Errorf("open failed: %s: %w", output, cause(err)))
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	if err := r.merge(sources, bw); err != nil {
+		return cli.Exit(2, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return cli.Exit(2, fmt.Errorf("write failed: %w", err))
 	}
 	return nil
 }
 
-func (c *cmd) sortInterface(lines []string) sort.Interface {
-	var si sort.Interface
-	switch {
-	case c.params.ignoreBlanks && c.params.ignoreCase:
-		si = ignoreBlanksCaseSort(lines)
-	case c.params.ignoreBlanks:
-		si = ignoreBlanksSort(lines)
-	case c.params.ignoreCase:
-		si = ignoreCaseSort(lines)
-	case c.params.numeric:
-		si = numericSort(lines)
-	default:
-		si = sort.StringSlice(lines)
+// source is a sorted sequence of lines.
+type source interface {
+	next() (string, bool, error)
+	close()
+}
+
+// lines is a sorted run in memory.
+type lines []string
+
+func (l *lines) next() (string, bool, error) {
+	if len(*l) == 0 {
+		return "", false, nil
+	}
+	line := (*l)[0]
+	*l = (*l)[1:]
+	return line, true, nil
+}
+
+func (l *lines) close() {}
+
+// runs reads the inputs into sorted runs of at most the buffer size. Runs
+// other than the last are written to temporary files.
+func (r *run) runs(inputs []string) ([]source, error) {
+	var sources []source
+	var buf []string
+	var size int64
+	flush := func() error {
+		slices.SortStableFunc(buf, r.sorter.compare)
+		path, err := r.writeTemp(func(w *bufio.Writer) error {
+			return r.merge([]source{(*lines)(&buf)}, w)
+		})
+		if err != nil {
+			return err
+		}
+		in, err := r.openTemp(path)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, in)
+		buf, size = nil, 0
+		return nil
+	}
+	for _, name := range inputs {
+		in, err := r.open(name)
+		if err != nil {
+			closeAll(sources)
+			return nil, err
+		}
+		for {
+			if err := r.ctx.Err(); err != nil {
+				in.close()
+				closeAll(sources)
+				return nil, err
+			}
+			line, ok, err := in.next()
+			if err != nil {
+				in.close()
+				closeAll(sources)
+				return nil, fmt.Errorf("read failed: %s: %w", name, err)
+			}
+			if !ok {
+				break
+			}
+			buf = append(buf, line)
+			size += int64(len(line)) + lineOverhead
+			if size >= r.bufferSize {
+				if err := flush(); err != nil {
+					in.close()
+					closeAll(sources)
+					return nil, err
+				}
+			}
+		}
+		in.close()
 	}
+	slices.SortStableFunc(buf, r.sorter.compare)
+	return append(sources, (*lines)(&buf)), nil
+}
 
-	return si
+func closeAll(sources []source) {
+	for _, s := range sources {
+		s.close()
+	}
 }
 
-func (c *cmd) sortAlgorithm(s string) string {
-	if len(s) == 0 {
-		return "" // edge case mimics coreutils
+// writeTemp creates a temporary file inside the workspace and writes it.
+func (r *run) writeTemp(write func(*bufio.Writer) error) (string, error) {
+	var f vfs.File
+	var path string
+	for range 100 {
+		path = filepath.Join(r.tempDir, fmt.Sprintf(".sort%06d.tmp", rand.Intn(1e6)))
+		var err error
+		f, err = r.ws.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("cannot create temporary file in '%s': %w", r.tempDir, cause(err))
+		}
+		break
+	}
+	if f == nil {
+		return "", fmt.Errorf("cannot create temporary file in '%s'", r.tempDir)
+	}
+	r.temps = append(r.temps, path)
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("write failed: %s: %w", path, err)
 	}
-	lines := strings.Split(s, "\n")
-	si := c.sortInterface(lines)
+	return path, nil
+}
 
-	if c.params.reverse {
-		sort.Sort(sort.Reverse(si))
-	} else {
-		sort.Sort(si)
+func (r *run) openTemp(path string) (*lineReader, error) {
+	f, err := r.ws.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
 	}
+	return &lineReader{r: bufio.NewReader(f), eol: r.eol, c: f}, nil
+}
 
-	if c.params.unique && len(lines) > 1 {
-		j := 1
-		for i := 1; i < len(lines); i++ {
-			if c.params.ignoreCase && c.params.ignoreBlanks {
-				l1 := strings.TrimLeftFunc(lines[i], unicode.IsSpace)
-				l2 := strings.TrimLeftFunc(lines[i-1], unicode.IsSpace)
-				if strings.EqualFold(l1, l2) {
-					continue
-				}
-			} else if c.params.ignoreCase && strings.EqualFold(lines[i], lines[j]) {
-				continue
-			} else if lines[i] == lines[i-1] {
-				continue
+// spill copies an input to a temporary file.
+func (r *run) spill(name string) (string, error) {
+	in, err := r.open(name)
+	if err != nil {
+		return "", err
+	}
+	defer in.close()
+	return r.writeTemp(func(w *bufio.Writer) error {
+		for {
+			line, ok, err := in.next()
+			if err != nil || !ok {
+				return err
 			}
-			lines[j] = lines[i]
-			j++
+			w.WriteString(line)
+			w.WriteByte(r.eol)
 		}
+	})
+}
 
-		lines = lines[:j]
+// mergeToTemp merges the sources into a temporary file.
+func (r *run) mergeToTemp(sources []source) (source, error) {
+	path, err := r.writeTemp(func(w *bufio.Writer) error {
+		return r.merge(sources, w)
+	})
+	closeAll(sources)
+	if err != nil {
+		return nil, err
 	}
+	return r.openTemp(path)
+}
+
+// item is the next line of a source being merged.
+type item struct {
+	line string
+	src  int
+}
+
+// mergeHeap orders the next lines of the sources, lines of earlier
+// sources first when they compare equal.
+type mergeHeap struct {
+	items []item
+	cmp   func(a, b string) int
+}
 
-	return strings.Join(lines, "\n") + "\n" // append newline terminator
+func (h *mergeHeap) Len() int { return len(h.items) }
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := h.cmp(h.items[i].line, h.items[j].line); c != 0 {
+		return c < 0
+	}
+	return h.items[i].src < h.items[j].src
+}
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x any)    { h.items = append(h.items, x.(item)) }
+func (h *mergeHeap) Pop() any {
+	it := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return it
 }
 
-func (c *cmd) writeOutput(w io.Writer, s string) error {
-	to := w
-	if c.params.outputFile != "" {
-		f, err := os.Create(c.params.outputFile)
+// merge writes the lines of the sorted sources in order. With -u only the
+// first of lines that compare equal is written.
+func (r *run) merge(sources []source, w *bufio.Writer) error {
+	h := &mergeHeap{cmp: r.sorter.compare}
+	for i, s := range sources {
+		line, ok, err := s.next()
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-		to = f
+		if ok {
+			h.items = append(h.items, item{line, i})
+		}
 	}
+	heap.Init(h)
 
-	_, err := to.Write([]byte(s))
-	return err
+	var prev string
+	written := false
+	for h.Len() > 0 {
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		it := h.items[0]
+		if !r.sorter.unique || !written || r.sorter.compare(prev, it.line) != 0 {
+			w.WriteString(it.line)
+			if err := w.WriteByte(r.eol); err != nil {
+				return fmt.Errorf("write failed: %w", err)
+			}
+			prev, written = it.line, true
+		}
+		line, ok, err := sources[it.src].next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.items[0].line = line
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
 }
 
-func main() {
-	flag.Parse()
-	p := params{
-		reverse: *reverse, ordered: *ordered, outputFile: *outputFile, unique: *unique,
-		ignoreCase: *ignoreCase, ignoreBlanks: *ignoreBlanks, numeric: *numeric,
-	}
-	if err := command(os.Stdin, os.Stdout, os.Stderr, p, flag.Args()).run(); err != nil {
-		if err == errNotOrdered {
-			os.Exit(1)
-		}
-		log.Fatal(err)
+// cleanup removes the temporary files.
+func (r *run) cleanup() {
+	for _, path := range r.temps {
+		r.ws.DeleteFile(path, false)
 	}
 }
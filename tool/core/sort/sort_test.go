@@ -2,52 +2,92 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+package sort
 
 import (
 	"bytes"
 	"errors"
-	"io"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
 )
 
+func setup(t *testing.T, files map[string]string) (string, vfs.Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func runSort(ws vfs.Workspace, dir, stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := New(ws)
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	cmd.SetWorkingDir(dir)
+	err := cmd.Run(args...)
+	var e *cli.ExitError
+	if errors.As(err, &e) && e.Err != nil {
+		// as the shell reports it
+		fmt.Fprintf(&stderr, "sort: %v\n", e.Err)
+	}
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+func exitCode(err error) int {
+	var e *cli.ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
 func TestSortStdin(t *testing.T) {
+	dir, ws := setup(t, nil)
 	for _, tt := range []struct {
-		name    string
-		params  params
-		input   string
-		want    string
-		wantErr error
+		name  string
+		args  []string
+		input string
+		want  string
+		code  int
 	}{
 		{
-			name:    "unique no duplicates",
-			params:  params{unique: true},
-			input:   "a\nb\nc\n",
-			want:    "a\nb\nc\n",
-			wantErr: nil,
+			name:  "unique no duplicates",
+			args:  []string{"-u"},
+			input: "a\nb\nc\n",
+			want:  "a\nb\nc\n",
 		},
 		{
-			name:    "unique with duplicates",
-			params:  params{unique: true},
-			input:   "a\nb\nc\na\n",
-			want:    "a\nb\nc\n",
-			wantErr: nil,
+			name:  "unique with duplicates",
+			args:  []string{"-u"},
+			input: "a\nb\nc\na\n",
+			want:  "a\nb\nc\n",
 		},
 		{
-			name:    "unique and ordered no duplicates",
-			params:  params{unique: true, ordered: true},
-			input:   "a\nb\nc\n",
-			wantErr: nil,
+			name:  "unique and ordered no duplicates",
+			args:  []string{"-u", "-C"},
+			input: "a\nb\nc\n",
 		},
 		{
-			name:    "unique and ordered with duplicates",
-			params:  params{unique: true, ordered: true},
-			input:   "a\nb\nc\na\n",
-			wantErr: errNotOrdered,
+			name:  "unique and ordered with duplicates",
+			args:  []string{"-u", "-C"},
+			input: "a\nb\nc\na\n",
+			code:  1,
 		},
 		{
 			name:  "ignore case off",
@@ -55,158 +95,263 @@ func TestSortStdin(t *testing.T) {
 			want:  "Orange\napple\n",
 		},
 		{
-			name:   "ignore case on 1",
-			params: params{ignoreCase: true},
-			input:  "apple\nOrange\n",
-			want:   "apple\nOrange\n",
+			name:  "ignore case on 1",
+			args:  []string{"-f"},
+			input: "apple\nOrange\n",
+			want:  "apple\nOrange\n",
+		},
+		{
+			name:  "ignore case on 2",
+			args:  []string{"-f"},
+			input: "apple\nOrange\napple\n",
+			want:  "apple\napple\nOrange\n",
+		},
+		{
+			name:  "ordered if ignore case is true",
+			args:  []string{"-f", "-C"},
+			input: "a\nB\nc\nD\ne\n",
+		},
+		{
+			name:  "unique with ignore case",
+			args:  []string{"-u", "-f"},
+			input: "a\nA\n",
+			want:  "a\n",
+		},
+		{
+			name:  "ordered but not unique",
+			args:  []string{"-C", "-u"},
+			input: "a\na\n",
+			code:  1,
+		},
+		{
+			name:  "unique and ignore case not ordered",
+			args:  []string{"-ufC"},
+			input: "A\na\n",
+			code:  1,
+		},
+		{
+			name:  "ignore blanks",
+			args:  []string{"-b"},
+			input: "  b\nA\n",
+			want:  "A\n  b\n",
+		},
+		{
+			name:  "ignore blanks and ignore case",
+			args:  []string{"-f", "-b"},
+			input: "  b\nA\n  C\n",
+			want:  "A\n  b\n  C\n",
+		},
+		{
+			name:  "ignore blanks, case and unique",
+			args:  []string{"-fbu"},
+			input: " b\nA\n C\nA\nb\n",
+			want:  "A\n b\n C\n",
+		},
+		{
+			name:  "ignore blanks breaking ties",
+			args:  []string{"-b"},
+			input: " {\n  {\n {\n  {\n",
+			want:  "  {\n  {\n {\n {\n",
 		},
 		{
-			name:   "ignore case on 2",
-			params: params{ignoreCase: true},
-			input:  "apple\nOrange\napple\n",
-			want:   "apple\napple\nOrange\n",
+			name:  "ignore blanks breaking ties with and ignore case",
+			args:  []string{"-b", "-f"},
+			input: "a\n {\n  {\n {\n  {\nA\n",
+			want:  "A\na\n  {\n  {\n {\n {\n",
 		},
 		{
-			name:   "ordered if ignore case is true",
-			params: params{ignoreCase: true, ordered: true},
-			input:  "a\nB\nc\nD\ne\n",
+			name:  "numeric sort",
+			args:  []string{"-n"},
+			input: "39\n100\n21\n",
+			want:  "21\n39\n100\n",
 		},
 		{
-			name:    "unique with ignore case",
-			params:  params{unique: true, ignoreCase: true},
-			input:   "a\nA\n",
-			want:    "a\n",
-			wantErr: nil,
+			name:  "numeric sort with floats",
+			args:  []string{"-n"},
+			input: "39.1\n100.2\n-21.3\n",
+			want:  "-21.3\n39.1\n100.2\n",
 		},
 		{
-			name:    "ordered but not unique",
-			params:  params{ordered: true, unique: true},
-			input:   "a\na\n",
-			wantErr: errNotOrdered,
+			name:  "numeric sort with blanks",
+			args:  []string{"-n"},
+			input: " 39\n  100\n21\n",
+			want:  "21\n 39\n  100\n",
 		},
 		{
-			name:    "unique and ignore case not ordered",
-			params:  params{unique: true, ignoreCase: true, ordered: true},
-			input:   "A\na\n",
-			wantErr: errNotOrdered,
+			name:  "numeric sort with leading zeros",
+			args:  []string{"-n"},
+			input: "039\n00100.1\n00021\n",
+			want:  "00021\n039\n00100.1\n",
 		},
 		{
-			name:   "ignore blanks",
-			params: params{ignoreBlanks: true},
-			input:  "  b\nA\n",
-			want:   "A\n  b\n",
+			name:  "numeric sort with non numeric strings",
+			args:  []string{"-n"},
+			input: "hello\n1.0\n-1.0\n",
+			want:  "-1.0\nhello\n1.0\n",
 		},
 		{
-			name:   "ignore blanks and ignore case",
-			params: params{ignoreCase: true, ignoreBlanks: true},
-			input:  "  b\nA\n  C\n",
-			want:   "A\n  b\n  C\n",
+			name:  "numeric sort of long numbers",
+			args:  []string{"-n"},
+			input: "123456789012345678901\n123456789012345678900\n",
+			want:  "123456789012345678900\n123456789012345678901\n",
 		},
 		{
-			name:   "ignore blanks, case and unique",
-			params: params{ignoreCase: true, ignoreBlanks: true, unique: true},
-			input:  " b\nA\n C\nA\nb\n",
-			want:   "A\n b\n C\n",
+			name:  "numeric sort ordered",
+			args:  []string{"-n", "-C"},
+			input: "-1\n2.1\n3\n",
 		},
 		{
-			name:    "ignore blanks (no effect), case and unique and ordered ",
-			params:  params{ignoreCase: true, ignoreBlanks: true, ordered: true},
-			input:   " b\nA\n C\nA\nb\n",
-			wantErr: errNotOrdered,
+			name:  "numeric sort unordered",
+			args:  []string{"-n", "-C"},
+			input: "01\n2.1\n0.2\n",
+			code:  1,
+		},
+
+		// keys and separators
+		{
+			name:  "key field",
+			args:  []string{"-k2"},
+			input: "x b\ny a\n",
+			want:  "y a\nx b\n",
 		},
 		{
-			name:   "ignore blanks breaking ties",
-			params: params{ignoreBlanks: true},
-			input:  " {\n  {\n {\n  {\n",
-			want:   "  {\n  {\n {\n {\n",
+			name:  "numeric key then text",
+			args:  []string{"-k2,2n", "-k1,1"},
+			input: "b 10\na 9\nc 9\n",
+			want:  "a 9\nc 9\nb 10\n",
 		},
 		{
-			name:   "ignore blanks breaking ties with and ignore case",
-			params: params{ignoreBlanks: true, ignoreCase: true},
-			input:  "a\n {\n  {\n {\n  {\nA\n",
-			want:   "A\na\n  {\n  {\n {\n {\n",
+			name:  "reversed key",
+			args:  []string{"-k2,2nr", "-k1,1"},
+			input: "b 10\na 9\nc 9\n",
+			want:  "b 10\na 9\nc 9\n",
 		},
 		{
-			name:   "numeric sort",
-			params: params{numeric: true},
-			input:  "39\n100\n21\n",
-			want:   "21\n39\n100\n",
+			name:  "separator",
+			args:  []string{"-t:", "-k3n"},
+			input: "root:x:0\nbin:x:2\nuser:x:1000\n",
+			want:  "root:x:0\nbin:x:2\nuser:x:1000\n",
 		},
 		{
-			name:   "numeric sort with floats",
-			params: params{numeric: true},
-			input:  "39.1\n100.2\n-21.3\n",
-			want:   "-21.3\n39.1\n100.2\n",
+			name:  "empty fields",
+			args:  []string{"-t", ",", "-k2,2"},
+			input: "a,c\nb,\nc,b\n",
+			want:  "b,\nc,b\na,c\n",
 		},
 		{
-			name:   "numeric sort with blanks",
-			params: params{numeric: true},
-			input:  " 39\n  100\n21\n",
-			want:   "21\n 39\n  100\n",
+			name:  "key characters",
+			args:  []string{"-k1.2,1.3"},
+			input: "xcb\nyab\nzaa\n",
+			want:  "zaa\nyab\nxcb\n",
 		},
 		{
-			name:   "numeric sort with leading zeros",
-			params: params{numeric: true},
-			input:  "039\n00100.1\n00021\n",
-			want:   "00021\n039\n00100.1\n",
+			name:  "leading blanks of fields",
+			args:  []string{"-k2b,2"},
+			input: "a   z\nb y\n",
+			want:  "b y\na   z\n",
 		},
 		{
-			name:   "numeric sort with non numeric strings",
-			params: params{numeric: true},
-			input:  "hello\n1.0\n-1.0\n",
-			want:   "-1.0\nhello\n1.0\n",
+			name:  "stable",
+			args:  []string{"-s", "-k1,1"},
+			input: "a 2\nb 1\na 1\n",
+			want:  "a 2\na 1\nb 1\n",
 		},
 		{
-			name:   "numeric sort ordered",
-			params: params{numeric: true, ordered: true},
-			input:  "-1\n2.1\n3\n",
+			name:  "last resort",
+			args:  []string{"-k1,1"},
+			input: "a 2\nb 1\na 1\n",
+			want:  "a 1\na 2\nb 1\n",
 		},
 		{
-			name:    "numeric sort unordered",
-			params:  params{numeric: true, ordered: true},
-			input:   "01\n2.1\n0.2\n",
-			wantErr: errNotOrdered,
+			name:  "unique keys",
+			args:  []string{"-u", "-k1,1"},
+			input: "a 2\nb 1\na 1\n",
+			want:  "a 2\nb 1\n",
+		},
+
+		// orders
+		{
+			name:  "human numeric",
+			args:  []string{"-h"},
+			input: "1G\n10K\n2M\n512\n-1K\n",
+			want:  "-1K\n512\n10K\n2M\n1G\n",
+		},
+		{
+			name:  "version",
+			args:  []string{"-V"},
+			input: "file-1.10.tar.gz\nfile-1.2.tar.gz\nfile-1.2~rc1.tar.gz\nfile-1.9\n",
+			want:  "file-1.2~rc1.tar.gz\nfile-1.2.tar.gz\nfile-1.9\nfile-1.10.tar.gz\n",
+		},
+		{
+			name:  "month",
+			args:  []string{"-M"},
+			input: "Mar\nfoo\n jan\nDEC\n",
+			want:  "foo\n jan\nMar\nDEC\n",
+		},
+		{
+			name:  "general numeric",
+			args:  []string{"-g"},
+			input: "1e3\nx\n-inf\n2.5\n",
+			want:  "x\n-inf\n2.5\n1e3\n",
+		},
+		{
+			name:  "dictionary order",
+			args:  []string{"-d"},
+			input: "b-2\n_a\n",
+			want:  "_a\nb-2\n",
+		},
+		{
+			name:  "zero terminated",
+			args:  []string{"-z"},
+			input: "b\nx\x00a\x00",
+			want:  "a\x00b\nx\x00",
+		},
+
+		// errors
+		{
+			name:  "check reports disorder",
+			args:  []string{"-c"},
+			input: "a\nc\nb\n",
+			code:  1,
+		},
+		{
+			name: "invalid key",
+			args: []string{"-k0"},
+			code: 2,
+		},
+		{
+			name: "multi-character separator",
+			args: []string{"-t", "ab"},
+			code: 2,
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			stdin := io.NopCloser(strings.NewReader(tt.input))
-			stdout := &bytes.Buffer{}
-
-			err := command(stdin, stdout, nil, tt.params, nil).run()
-			if !errors.Is(err, tt.wantErr) {
-				t.Fatalf("sort err: = %q, want: %q", err, tt.wantErr)
+			out, _, code := runSort(ws, dir, tt.input, tt.args...)
+			if code != tt.code {
+				t.Errorf("sort %q: got exit status %d, want %d", tt.args, code, tt.code)
 			}
-
-			if stdout.String() != tt.want {
-				t.Errorf("sort = %q, want: %q", stdout.String(), tt.want)
+			if out != tt.want {
+				t.Errorf("sort %q = %q, want: %q", tt.args, out, tt.want)
 			}
 		})
 	}
 }
 
 func TestSortFiles(t *testing.T) {
-	tmpDir := t.TempDir()
-	file1, err := os.Create(filepath.Join(tmpDir, "file1"))
-	if err != nil {
-		t.Fatalf("Failed to create tmp file1: %v", err)
-	}
-	if _, err := file1.WriteString("α\nβ\nγ"); err != nil {
-		t.Fatalf("failed to write into file1: %v", err)
-	}
-	file2, err := os.Create(filepath.Join(tmpDir, "file2"))
-	if err != nil {
-		t.Fatalf("Failed to create tmp file2: %v", err)
-	}
-	if _, err := file2.WriteString("a\nd\nc\n"); err != nil {
-		t.Fatalf("failed to write into file1: %v", err)
-	}
+	dir, ws := setup(t, map[string]string{
+		"file1":  "α\nβ\nγ",
+		"file2":  "a\nd\nc\n",
+		"sorted": "b\ne\n",
+	})
 
 	for _, tt := range []struct {
-		name    string
-		args    []string
-		params  params
-		want    string
-		wantErr error
+		name   string
+		args   []string
+		stdin  string
+		output string
+		want   string
+		stderr string
+		code   int
 	}{
 		{
 			name: "empty input",
@@ -215,64 +360,104 @@ func TestSortFiles(t *testing.T) {
 		},
 		{
 			name: "input from 2 files",
-			args: []string{filepath.Join(tmpDir, "file1"), filepath.Join(tmpDir, "file2")},
+			args: []string{"file1", "file2"},
 			want: "a\nc\nd\nα\nβ\nγ\n",
 		},
 		{
-			name:   "reversed = true",
-			args:   []string{filepath.Join(tmpDir, "file1"), filepath.Join(tmpDir, "file2")},
-			params: params{reverse: true},
-			want:   "γ\nβ\nα\nd\nc\na\n",
+			name: "reversed = true",
+			args: []string{"-r", "file1", "file2"},
+			want: "γ\nβ\nα\nd\nc\na\n",
 		},
 		{
 			name:   "outputfile set",
-			args:   []string{filepath.Join(tmpDir, "file1"), filepath.Join(tmpDir, "file2")},
-			params: params{outputFile: filepath.Join(tmpDir, "outputfile")},
+			args:   []string{"-o", "outputfile", "file1", "file2"},
+			output: "outputfile",
 			want:   "a\nc\nd\nα\nβ\nγ\n",
 		},
 		{
-			name:    "no such file or directory",
-			args:    []string{"nosuchfile"},
-			wantErr: syscall.Errno(2),
+			name:   "no such file or directory",
+			args:   []string{"nosuchfile"},
+			stderr: "no such file or directory",
+			code:   2,
+		},
+		{
+			name: "ordered",
+			args: []string{"-C", "file1"},
 		},
 		{
-			name:   "ordered",
-			args:   []string{filepath.Join(tmpDir, "file1")},
-			params: params{ordered: true},
+			name: "not ordered",
+			args: []string{"-C", "file2"},
+			code: 1,
 		},
 		{
-			name:    "not ordered",
-			args:    []string{filepath.Join(tmpDir, "file2")},
-			params:  params{ordered: true},
-			wantErr: errNotOrdered,
+			name:   "disorder",
+			args:   []string{"-c", "file2"},
+			stderr: "sort: file2:3: disorder: c\n",
+			code:   1,
+		},
+		{
+			name:  "merge",
+			args:  []string{"-m", "sorted", "-"},
+			stdin: "a\nc\n",
+			want:  "a\nb\nc\ne\n",
+		},
+		{
+			name:   "merge into an input",
+			args:   []string{"-m", "-o", "sorted", "sorted", "-"},
+			stdin:  "a\nc\n",
+			output: "sorted",
+			want:   "a\nb\nc\ne\n",
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
-			f, err := os.Create(filepath.Join(tmpDir, "file"))
-			if err != nil {
-				t.Fatalf("failed to create tmp file: %v", err)
-			}
-			stdout := &bytes.Buffer{}
-			c := command(f, stdout, nil, tt.params, tt.args)
-
-			err = c.run()
-			if !errors.Is(err, tt.wantErr) {
-				t.Fatalf("sort err: = %q, want: %q", err, tt.wantErr)
+			out, stderr, code := runSort(ws, dir, tt.stdin, tt.args...)
+			if code != tt.code {
+				t.Errorf("sort %q: got exit status %d, want %d", tt.args, code, tt.code)
 			}
-
-			if tt.params.outputFile != "" {
-				res, err := os.ReadFile(tt.params.outputFile)
+			if tt.output != "" {
+				res, err := os.ReadFile(filepath.Join(dir, tt.output))
 				if err != nil {
 					t.Fatalf("failed to read file: %v", err)
 				}
-				if string(res) != tt.want {
-					t.Errorf("sort = %q, want: %q", string(res), tt.want)
-				}
-			} else {
-				if stdout.String() != tt.want {
-					t.Errorf("sort = %q, want: %q", stdout.String(), tt.want)
-				}
+				out = string(res)
+			}
+			if out != tt.want {
+				t.Errorf("sort %q = %q, want: %q", tt.args, out, tt.want)
+			}
+			if !strings.Contains(stderr, tt.stderr) || tt.stderr == "" && stderr != "" {
+				t.Errorf("sort %q: got stderr %q, want %q", tt.args, stderr, tt.stderr)
 			}
 		})
 	}
 }
+
+// TestSortExternal sorts more lines than fit in the buffer, through
+// temporary runs that are merged in several passes.
+func TestSortExternal(t *testing.T) {
+	dir, ws := setup(t, nil)
+	var input, want strings.Builder
+	const n = 2000
+	for i := range n {
+		fmt.Fprintf(&input, "%d\n", (i*7919)%n)
+		fmt.Fprintf(&want, "%d\n", i)
+	}
+	tmp := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	out, stderr, code := runSort(ws, dir, input.String(), "-n", "-S", "1K", "-T", "tmp")
+	if code != 0 {
+		t.Fatalf("sort: exit status %d: %s", code, stderr)
+	}
+	if out != want.String() {
+		t.Errorf("sort -n -S 1K: got %d bytes, want %d", len(out), want.Len())
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+}
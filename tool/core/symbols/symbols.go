@@ -0,0 +1,159 @@
+// Symbols lists the declarations of Go source files in the workspace.
+//
+// Synopsis:
+//
+//	symbols [OPTIONS] PATH...
+//	symbols -s NAME FILE
+//
+// Description:
+//
+//	Each PATH is a Go file or a package directory. The package and the
+//	types, functions, methods, constants and variables are listed with
+//	their line ranges. With -s, the declaration of NAME, such as Foo or
+//	T.Close for a method, is printed with its doc comment.
+//
+// Options:
+//
+//	-r, --recursive: include the packages of subdirectories
+//	-t, --tests:     include the _test.go files of directories
+//	-e, --exported:  only list exported symbols
+//	-s, --symbol:    print the declaration of NAME from FILE
+//	-n, --number:    number the lines of the declaration
+//	    --json:      print the result as JSON
+package symbols
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+var errUsage = errors.New("usage: symbols [OPTIONS] PATH... | symbols -s NAME FILE")
+
+// command implements the symbols core utility.
+type command struct {
+	core.Base
+
+	ws vfs.Workspace
+}
+
+// New creates a new symbols command.
+func New(ws vfs.Workspace) core.Command {
+	c := &command{
+		ws: ws,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	recursive bool
+	tests     bool
+	exported  bool
+	symbol    string
+	number    bool
+	json      bool
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("symbols", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.BoolVar(&f.recursive, "r", false, "include the packages of subdirectories")
+	fs.BoolVar(&f.recursive, "recursive", false, "include the packages of subdirectories")
+	fs.BoolVar(&f.tests, "t", false, "include the _test.go files of directories")
+	fs.BoolVar(&f.tests, "tests", false, "include the _test.go files of directories")
+	fs.BoolVar(&f.exported, "e", false, "only list exported symbols")
+	fs.BoolVar(&f.exported, "exported", false, "only list exported symbols")
+	fs.StringVar(&f.symbol, "s", "", "print the declaration of `NAME` from FILE")
+	fs.StringVar(&f.symbol, "symbol", "", "print the declaration of `NAME` from FILE")
+	fs.BoolVar(&f.number, "n", false, "number the lines of the declaration")
+	fs.BoolVar(&f.number, "number", false, "number the lines of the declaration")
+	fs.BoolVar(&f.json, "json", false, "print the result as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "symbols [OPTIONS] PATH...\nsymbols -s NAME FILE\n\n")
+		fmt.Fprintf(fs.Output(), "Symbols lists the declarations of Go source files with their line ranges.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(cli.Args(args, "s", "symbol")); err != nil {
+		return cli.Exit(2, err)
+	}
+	if fs.NArg() == 0 || f.symbol != "" && fs.NArg() != 1 {
+		return cli.Exit(2, errUsage)
+	}
+
+	if f.symbol != "" {
+		src, err := c.ws.ReadSymbol(c.ResolvePath(fs.Arg(0)), f.symbol)
+		if err != nil {
+			return cli.Exit(1, err)
+		}
+		if f.json {
+			return c.printJSON(src)
+		}
+		if !f.number {
+			fmt.Fprint(c.Stdout, src.Source)
+			return nil
+		}
+		start := src.Symbol.Start
+		if src.Symbol.Doc > 0 {
+			start = src.Symbol.Doc
+		}
+		fmt.Fprintln(c.Stdout, vfs.FormatContentWithLineNumbers(src.Source, start))
+		return nil
+	}
+
+	o := &vfs.SymbolOptions{
+		Recursive: f.recursive,
+		Tests:     f.tests,
+		Exported:  f.exported,
+	}
+	result := &vfs.SymbolResult{}
+	var failed bool
+	for _, p := range fs.Args() {
+		r, err := c.ws.Symbols(c.ResolvePath(p), o)
+		if err != nil {
+			fmt.Fprintf(c.Stderr, "symbols: %v\n", err)
+			failed = true
+			continue
+		}
+		result.Files = append(result.Files, r.Files...)
+	}
+	if f.json {
+		if err := c.printJSON(result); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(c.Stdout, result)
+	}
+	if failed {
+		return cli.Exit(1, nil)
+	}
+	return nil
+}
+
+func (c *command) printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "%s\n", data)
+	return nil
+}
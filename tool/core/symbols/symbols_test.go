@@ -0,0 +1,150 @@
+package symbols
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+const source = `// Package shapes has shapes.
+package shapes
+
+import "math"
+
+// Pi is the ratio.
+const Pi = math.Pi
+
+const (
+	Red = iota
+	green
+)
+
+// Circle is round.
+type Circle struct {
+	R float64
+}
+
+// Area returns the area.
+func (c *Circle) Area() float64 {
+	return Pi * c.R * c.R
+}
+
+func helper() {}
+`
+
+func setup(t *testing.T) (string, vfs.Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"shapes.go":      source,
+		"shapes_test.go": "package shapes\n\nfunc TestArea() {}\n",
+		"sub/sub.go":     "package sub\n\nvar X int\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func run(t *testing.T, ws vfs.Workspace, dir string, args ...string) (string, error) {
+	t.Helper()
+	cmd := New(ws)
+	var stdout, stderr bytes.Buffer
+	cmd.SetIO(strings.NewReader(""), &stdout, &stderr)
+	cmd.SetWorkingDir(dir)
+	err := cmd.Run(args...)
+	return stdout.String() + stderr.String(), err
+}
+
+func TestSymbolsList(t *testing.T) {
+	dir, ws := setup(t)
+
+	out, err := run(t, ws, dir, "shapes.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "shapes.go") + `: package shapes
+  7-7       const Pi
+  10-10     const Red
+  11-11     const green
+  15-17     type Circle struct
+  20-22     func (c *Circle) Area() float64
+  24-24     func helper()
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, err = run(t, ws, dir, "-e", "-r", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"const Pi", "type Circle", "Area()", "package sub", "var X"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in:\n%s", s, out)
+		}
+	}
+	for _, s := range []string{"helper", "green", "TestArea"} {
+		if strings.Contains(out, s) {
+			t.Errorf("unexpected %q in:\n%s", s, out)
+		}
+	}
+
+	out, err = run(t, ws, dir, "--tests", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "func TestArea()") || strings.Contains(out, "package sub") {
+		t.Errorf("unexpected listing:\n%s", out)
+	}
+}
+
+func TestSymbolsRead(t *testing.T) {
+	dir, ws := setup(t)
+
+	for _, name := range []string{"Circle.Area", "(*Circle).Area", "*Circle.Area"} {
+		out, err := run(t, ws, dir, "-s", name, "shapes.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "// Area returns the area.\nfunc (c *Circle) Area() float64 {\n\treturn Pi * c.R * c.R\n}\n"
+		if out != want {
+			t.Errorf("%s: got %q, want %q", name, out, want)
+		}
+	}
+
+	out, err := run(t, ws, dir, "--json", "--symbol=green", "shapes.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src vfs.SymbolSource
+	if err := json.Unmarshal([]byte(out), &src); err != nil {
+		t.Fatal(err)
+	}
+	if src.Source != "\tgreen\n" || src.Symbol.Kind != "const" || src.Symbol.Start != 11 {
+		t.Errorf("unexpected symbol: %+v %q", src.Symbol, src.Source)
+	}
+
+	_, err = run(t, ws, dir, "-s", "Missing", "shapes.go")
+	var e *cli.ExitError
+	if !errors.As(err, &e) || e.Code != 1 {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+}
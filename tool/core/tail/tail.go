@@ -6,34 +6,50 @@
 // the end of the file as it grows.
 //
 // Synopsis:
-//     tail [-f] [-n lines_to_show] [FILE]
+//     tail [OPTIONS] [FILE]...
 //
 // Description:
-//     If no files are specified, read from stdin.
+//     If no files are specified, or the file is -, read from stdin.
+//     With more than one file, each is preceded by a "==> FILE <==" header.
 //
 // Options:
-//     -f: follow the end of the file as it grows
-//     -n: specify the number of lines to show (default: 10)
-
-// Missing features:
-// - follow-mode (i.e. tail -f)
+//     -c, --bytes=[+]NUM: print the last NUM bytes, or from byte NUM with +
+//     -n, --lines=[+]NUM: print the last NUM lines, or from line NUM with +
+//         (default: 10)
+//     -f, --follow[={name|descriptor}]: follow the end of the files as they
+//         grow
+//     -F: follow by name and retry, surviving log rotation and truncation
+//     --retry: keep trying to open the files that are not accessible
+//     --pid=PID: with -f, stop after the process PID dies
+//     -s, --sleep-interval=N: seconds to wait between checks for changes
+//     -q, --quiet: never print headers
+//     -v, --verbose: always print headers
 
 package tail
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 	"os"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/u-root/u-root/pkg/core"
-	"github.com/u-root/u-root/pkg/uroot/unixflag"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
 )
 
 // var (
@@ -48,14 +64,37 @@ type readAtSeeker interface {
 
 // tailConfig is a configuration object for the Tail function
 type tailConfig struct {
+	// print bytes instead of lines (-c)
+	bytes bool
+
+	// specifies the number of lines or bytes to print (-n, -c)
+	count int64
+
+	// count from the start of the input instead of from its end (+NUM)
+	fromStart bool
+
 	// enable follow-mode (-f)
 	follow bool
 
-	// specifies the number of lines to print (-n)
-	numLines int
+	// follow the file by name instead of by descriptor (-F)
+	byName bool
+
+	// keep trying to open inaccessible files (--retry)
+	retry bool
+
+	// stop following when the process exits (--pid)
+	pid int
 
 	// time to wait for new write in follow mode
 	followDuration time.Duration
+
+	// print the "==> FILE <==" headers
+	headers bool
+}
+
+// watcher is implemented by file systems notified of file changes.
+type watcher interface {
+	Watch(ctx context.Context, path string, recursive bool) (<-chan vfs.Event, error)
 }
 
 // getBlockSize returns the number of bytes to read for each ReadAt call. This
@@ -63,8 +102,8 @@ type tailConfig struct {
 func getBlockSize(numLines int) int64 {
 	// This is currently computed as 81 * N, where N is the requested number of
 	// lines, and 81 is a relatively generous estimation of the average line
-	// length.
-	return 81 * int64(numLines)
+	// length, up to 1MiB for large counts.
+	return min(81*int64(numLines), 1<<20)
 }
 
 // lastNLines finds the n-th-to-last line in `buf`, and returns a new slice
@@ -163,7 +202,7 @@ func readLastLinesBackwards(input readAtSeeker, writer io.Writer, numLines int)
 // readLastLinesBackwards.
 // It returns an error, if any. If no error is encountered, the File object's
 // offset is positioned after the last read location.
-func readLastLinesFromBeginning(input io.ReadSeeker, writer io.Writer, numLines int) error {
+func readLastLinesFromBeginning(input io.Reader, writer io.Writer, numLines int) error {
 	blkSize := getBlockSize(numLines)
 	// read block by block until EOF and store a reference to the last lines
 	buf := make([]byte, blkSize)
@@ -194,134 +233,427 @@ func readLastLinesFromBeginning(input io.ReadSeeker, writer io.Writer, numLines
 	return nil
 }
 
-func isTruncated(file *os.File) (bool, error) {
-	// current read position in a file
-	currentPos, err := file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return false, err
-	}
-	// file stat to get the size
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return false, err
+// lastBytes writes the last n bytes read from the input.
+func lastBytes(input io.Reader, writer io.Writer, n int64) error {
+	var data []byte
+	buf := make([]byte, 32*1024)
+	for {
+		k, err := input.Read(buf)
+		data = append(data, buf[:k]...)
+		if int64(len(data)) > n {
+			data = data[:copy(data, data[int64(len(data))-n:])]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return currentPos > fileInfo.Size(), nil
+	_, err := writer.Write(data)
+	return err
 }
 
-// tail reads the last N lines from the input File and writes them to the Writer.
-// The tailConfig object allows to specify the precise behaviour.
-func tail(inFile *os.File, writer io.Writer, config tailConfig) error {
-	// try reading from the end of the file
-	retryFromBeginning := false
-	err := readLastLinesBackwards(inFile, writer, config.numLines)
-	if err != nil {
-		// if it failed because it couldn't seek, mark it for retry reading from
-		// the beginning
-		if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.ESPIPE {
-			retryFromBeginning = true
-		} else {
-			return err
+// skipLines discards the first n lines of the input.
+func skipLines(input *bufio.Reader, n int64) error {
+	for n > 0 {
+		_, err := input.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// the rest of a long line
+			continue
 		}
-	}
-	// if reading backwards failed because the file is not seekable,
-	// retry from the beginning
-	if retryFromBeginning {
-		if err = readLastLinesFromBeginning(inFile, writer, config.numLines); err != nil {
+		if err != nil {
 			return err
 		}
+		n--
 	}
-	if config.follow {
-		blkSize := getBlockSize(1)
-		// read block by block until EOF and store a reference to the last lines
-		buf := make([]byte, blkSize)
-		for {
-			n, err := inFile.Read(buf)
-			if err == io.EOF {
-				// without this sleep you would hogg the CPU
-				time.Sleep(config.followDuration)
-				// truncated ?
-				truncated, errTruncated := isTruncated(inFile)
-				if errTruncated != nil {
-					break
-				}
-				if truncated {
-					// seek from start
-					_, errSeekStart := inFile.Seek(0, io.SeekStart)
-					if errSeekStart != nil {
-						break
-					}
-				}
-				continue
-			}
-			if err == nil {
-				_, err := writer.Write(buf[:n])
-				if err != nil {
-					return err
-				}
-				continue
+	return nil
+}
+
+// source is a file printed and followed by tail.
+type source struct {
+	// the operand, "-" for stdin
+	name string
+	file fs.File
+	// stdin when it is not a file, it is not followed
+	reader io.Reader
+	// the file open, to tell when its name is given to another file
+	info fs.FileInfo
+	// the file is inaccessible, it has been reported
+	gone bool
+	// the file is no longer followed
+	done bool
+}
+
+func (s *source) title() string {
+	if s.name == "-" {
+		return "standard input"
+	}
+	return s.name
+}
+
+// pipe reports whether the source is stdin that cannot be followed, such
+// as a pipe, whose data ends with its writer.
+func (s *source) pipe() bool {
+	if s.reader != nil {
+		return true
+	}
+	return s.name == "-" && s.info != nil && s.info.Mode()&(fs.ModeNamedPipe|fs.ModeSocket) != 0
+}
+
+func (s *source) close() {
+	if s.file != nil && s.name != "-" {
+		s.file.Close()
+	}
+	s.file = nil
+	s.info = nil
+}
+
+// printer writes the data of the sources with a "==> FILE <==" header
+// whenever it switches from a source to another.
+type printer struct {
+	w       io.Writer
+	headers bool
+	last    *source
+	printed bool
+}
+
+func (p *printer) header(src *source) {
+	if !p.headers || p.last == src {
+		return
+	}
+	if p.printed {
+		fmt.Fprintf(p.w, "\n==> %s <==\n", src.title())
+	} else {
+		fmt.Fprintf(p.w, "==> %s <==\n", src.title())
+	}
+	p.printed = true
+	p.last = src
+}
+
+// copyNew writes what has been appended to the file since the last read.
+func (p *printer) copyNew(src *source, buf []byte) error {
+	for src.file != nil {
+		n, err := src.file.Read(buf)
+		if n > 0 {
+			p.header(src)
+			if _, err := p.w.Write(buf[:n]); err != nil {
+				return err
 			}
-			break
+		}
+		if err == io.EOF || n == 0 && err == nil {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (c *command) run(reader *os.File, writer io.Writer, follow bool, numLines int, followDuration time.Duration, args []string) error {
-	var (
-		inFile fs.File
-		err    error
-	)
-
-	// TODO: add support for parsing + (from beggining of the file)
-	// negative sign is the same as none
-	if numLines < 0 {
-		numLines = -1 * numLines
+// cause strips the operation and path of file errors, tail reports them
+// itself.
+func cause(err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
 	}
-	config := tailConfig{follow: follow, numLines: numLines, followDuration: followDuration}
+	return err
+}
 
-	switch len(args) {
-	case 0:
-		return tail(reader, writer, config)
-	case 1:
-	default:
-		if follow {
-			return fmt.Errorf("tail: can only read one file at a time if follow true")
-		}
+// alive reports whether the process is running.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
 	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
 
-	for i, file := range args {
-		if len(args) > 1 {
-			fmt.Fprintf(writer, "==> %s <==\n", file)
+func (c *command) open(src *source, stdin io.Reader) error {
+	if src.name == "-" {
+		f, ok := stdin.(*os.File)
+		switch {
+		case ok && f != nil:
+			src.file = f
+		case stdin != nil && !ok:
+			src.reader = stdin
+		default:
+			src.reader = bytes.NewReader(nil)
+			return nil
 		}
-
-		inFile, err = c.f.Open(file)
+	} else {
+		f, err := c.f.Open(src.name)
 		if err != nil {
 			return err
 		}
+		src.file = f
+	}
+	if src.file == nil {
+		return nil
+	}
+	info, err := src.file.Stat()
+	if err != nil {
+		src.close()
+		return err
+	}
+	src.info = info
+	return nil
+}
+
+// printStart writes the last lines or bytes of the source, or those from
+// the start offset, and leaves the file at its end.
+func printStart(src *source, writer io.Writer, config tailConfig) error {
+	var (
+		input   io.Reader = src.reader
+		seeker  readAtSeeker
+		regular bool
+	)
+	if src.file != nil {
+		input = src.file
+		seeker, regular = src.file.(readAtSeeker)
+		regular = regular && src.info.Mode().IsRegular()
+	}
 
-		r, ok := inFile.(*os.File)
-		if !ok {
-			return fmt.Errorf("can not seek: %s", file)
+	switch {
+	case config.fromStart && config.bytes:
+		skip := max(config.count-1, 0)
+		if regular {
+			if _, err := seeker.Seek(skip, io.SeekCurrent); err != nil {
+				return err
+			}
+		} else if _, err := io.CopyN(io.Discard, input, skip); err != nil && err != io.EOF {
+			return err
 		}
-		err := tail(r, writer, config)
+		_, err := io.Copy(writer, input)
+		return err
+	case config.fromStart:
+		r := bufio.NewReader(input)
+		if err := skipLines(r, max(config.count-1, 0)); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		_, err := r.WriteTo(writer)
+		return err
+	case config.count == 0:
+		if regular {
+			_, err := seeker.Seek(0, io.SeekEnd)
+			return err
+		}
+		_, err := io.Copy(io.Discard, input)
+		return err
+	case config.bytes && regular:
+		end, err := seeker.Seek(0, io.SeekEnd)
 		if err != nil {
 			return err
 		}
+		if _, err := seeker.Seek(max(end-config.count, 0), io.SeekStart); err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, input)
+		return err
+	case config.bytes:
+		return lastBytes(input, writer, config.count)
+	case regular:
+		return readLastLinesBackwards(seeker, writer, int(min(config.count, math.MaxInt32)))
+	default:
+		return readLastLinesFromBeginning(input, writer, int(min(config.count, math.MaxInt32)))
+	}
+}
+
+func (c *command) run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, config tailConfig, args []string) error {
+	warn := func(format string, a ...any) {
+		fmt.Fprintf(stderr, "tail: "+format+"\n", a...)
+	}
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
 
-		if len(args) > 1 && i < len(args)-1 {
-			fmt.Fprintln(writer)
+	var failed bool
+	p := &printer{w: stdout, headers: config.headers}
+	sources := make([]*source, len(args))
+	for i, name := range args {
+		src := &source{name: name}
+		sources[i] = src
+		if err := c.open(src, stdin); err != nil {
+			warn("cannot open '%s' for reading: %v", name, cause(err))
+			failed = true
+			src.gone = true
+			src.done = !config.retry
+			continue
+		}
+		p.header(src)
+		if err := printStart(src, stdout, config); err != nil {
+			warn("error reading '%s': %v", src.title(), cause(err))
+			failed = true
+			src.close()
+			src.done = true
 		}
 	}
 
+	if config.follow {
+		return c.follow(ctx, sources, p, config, warn)
+	}
+	for _, src := range sources {
+		src.close()
+	}
+	if failed {
+		return cli.Exit(1, nil)
+	}
 	return nil
 }
 
-// func main() {
-// 	flag.Parse()
-// 	if err := run(os.Stdin, os.Stdout, *flagFollow, *flagNumLines, 500*time.Millisecond, flag.Args()); err != nil {
-// 		log.Fatalf("tail: %v", err)
-// 	}
-// }
+// follow writes what is appended to the sources until the context is done
+// or the process of config.pid exits. It waits for changes with the
+// notifications of the file system if it has them, and polls otherwise.
+// Like GNU tail, it returns at once if the only sources are pipes.
+func (c *command) follow(ctx context.Context, sources []*source, p *printer, config tailConfig, warn func(string, ...any)) error {
+	defer func() {
+		for _, src := range sources {
+			src.close()
+		}
+	}()
+	if !slices.ContainsFunc(sources, func(src *source) bool { return !src.pipe() }) {
+		return nil
+	}
+	// stops the watches when following ends
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wake := make(chan struct{}, 1)
+	var polling atomic.Bool
+	polling.Store(config.pid != 0)
+	w, ok := c.f.(watcher)
+	for _, src := range sources {
+		switch {
+		case src.pipe():
+			src.done = true
+			continue
+		case src.done:
+			continue
+		case src.name == "-" || !ok:
+			polling.Store(true)
+			continue
+		}
+		events, err := w.Watch(ctx, src.name, false)
+		if err != nil {
+			polling.Store(true)
+			continue
+		}
+		go func() {
+			for range events {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+			// no more notifications, the file may be gone
+			polling.Store(true)
+		}()
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		var active bool
+		for _, src := range sources {
+			if src.done {
+				continue
+			}
+			if err := p.copyNew(src, buf); err != nil {
+				warn("error reading '%s': %v", src.title(), cause(err))
+				src.close()
+				src.done = true
+				continue
+			}
+			if c.check(src, config, warn) {
+				if err := p.copyNew(src, buf); err != nil {
+					warn("error reading '%s': %v", src.title(), cause(err))
+					src.close()
+					src.done = true
+					continue
+				}
+			}
+			active = active || !src.done
+		}
+		if !active {
+			warn("no files remaining")
+			return cli.Exit(1, nil)
+		}
+		if config.pid != 0 && !alive(config.pid) {
+			return nil
+		}
+
+		var tick <-chan time.Time
+		if polling.Load() {
+			tick = time.After(config.followDuration)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-tick:
+		}
+	}
+}
+
+// check reopens the file when it appears, or when its name is given to
+// another file if followed by name, and rewinds it when truncated. It
+// reports whether the file is to be read again.
+func (c *command) check(src *source, config tailConfig, warn func(string, ...any)) bool {
+	if src.file == nil {
+		if err := c.open(src, nil); err != nil {
+			return false
+		}
+		if src.gone {
+			warn("'%s' has appeared;  following new file", src.name)
+			src.gone = false
+		}
+		return true
+	}
+
+	if config.byName && src.name != "-" {
+		info, err := fs.Stat(c.f, src.name)
+		switch {
+		case err != nil && !config.retry:
+			warn("%s: %v", src.name, cause(err))
+			src.close()
+			src.done = true
+			return false
+		case err != nil:
+			warn("'%s' has become inaccessible: %v", src.name, cause(err))
+			src.close()
+			src.gone = true
+			return false
+		case !os.SameFile(info, src.info):
+			warn("'%s' has been replaced;  following new file", src.name)
+			src.close()
+			if err := c.open(src, nil); err != nil {
+				src.gone = true
+				return false
+			}
+			return true
+		}
+	}
+
+	seeker, ok := src.file.(io.Seeker)
+	if !ok {
+		return false
+	}
+	info, err := src.file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil || info.Size() >= pos {
+		return false
+	}
+	warn("%s: file truncated", src.title())
+	_, err = seeker.Seek(0, io.SeekStart)
+	return err == nil
+}
 
 // command implements the tail core utility.
 // type FileOpen func(string) (*os.File, error)
@@ -345,7 +677,77 @@ func New(f fs.FS) *command {
 
 type flags struct {
 	flagFollow   bool
-	flagNumLines int
+	flagByName   bool
+	flagRetry    bool
+	flagNumLines string
+	flagBytes    string
+	flagPid      int
+	flagSleep    float64
+	flagQuiet    bool
+	flagVerbose  bool
+}
+
+// followFlag is -f, --follow and --follow={name|descriptor}.
+type followFlag struct {
+	follow *bool
+	byName *bool
+}
+
+func (f followFlag) IsBoolFlag() bool { return true }
+
+func (f followFlag) String() string {
+	if f.follow == nil || !*f.follow {
+		return ""
+	}
+	if *f.byName {
+		return "name"
+	}
+	return "descriptor"
+}
+
+func (f followFlag) Set(s string) error {
+	switch s {
+	case "true", "descriptor":
+		*f.follow, *f.byName = true, false
+	case "name":
+		*f.follow, *f.byName = true, true
+	case "false":
+		*f.follow = false
+	default:
+		return fmt.Errorf("invalid argument '%s' for '--follow'", s)
+	}
+	return nil
+}
+
+var countSuffixes = map[string]int64{
+	"":    1,
+	"b":   512,
+	"kB":  1000,
+	"K":   1 << 10,
+	"KiB": 1 << 10,
+	"MB":  1000 * 1000,
+	"M":   1 << 20,
+	"MiB": 1 << 20,
+	"GB":  1000 * 1000 * 1000,
+	"G":   1 << 30,
+	"GiB": 1 << 30,
+}
+
+var countPattern = regexp.MustCompile(`^([+-]?)([0-9]+)([a-zA-Z]*)$`)
+
+// parseCount parses [+]NUM[SUFFIX], NUM counting from the start of the
+// input with a plus sign and from its end otherwise.
+func parseCount(s, what string) (int64, bool, error) {
+	m := countPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false, fmt.Errorf("invalid number of %s: '%s'", what, s)
+	}
+	mult, ok := countSuffixes[m[3]]
+	n, err := strconv.ParseInt(m[2], 10, 64)
+	if !ok || err != nil || n > math.MaxInt64/mult {
+		return 0, false, fmt.Errorf("invalid number of %s: '%s'", what, s)
+	}
+	return n * mult, m[1] == "+", nil
 }
 
 // Run executes the command with a `context.Background()`.
@@ -360,32 +762,71 @@ func (c *command) RunContext(ctx context.Context, args ...string) error {
 	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
 	fs.SetOutput(c.Stderr)
 
-	fs.BoolVar(&f.flagFollow, "f", false, "follow the end of the file")
-	fs.IntVar(&f.flagNumLines, "n", 10, "specify the number of lines to show")
+	follow := followFlag{&f.flagFollow, &f.flagByName}
+	fs.Var(follow, "f", "follow the end of the files as they grow")
+	fs.Var(follow, "follow", "follow the files by `name` or descriptor as they grow")
+	fs.BoolVar(&f.flagByName, "F", false, "same as --follow=name --retry")
+	fs.BoolVar(&f.flagRetry, "retry", false, "keep trying to open the files that are not accessible")
+	fs.StringVar(&f.flagNumLines, "n", "10", "print the last `NUM` lines, or from line NUM with +NUM")
+	fs.StringVar(&f.flagNumLines, "lines", "10", "print the last `NUM` lines, or from line NUM with +NUM")
+	fs.StringVar(&f.flagBytes, "c", "", "print the last `NUM` bytes, or from byte NUM with +NUM")
+	fs.StringVar(&f.flagBytes, "bytes", "", "print the last `NUM` bytes, or from byte NUM with +NUM")
+	fs.IntVar(&f.flagPid, "pid", 0, "with -f, stop after the process `PID` dies")
+	fs.Float64Var(&f.flagSleep, "s", 0, "wait `N` seconds between checks for changes")
+	fs.Float64Var(&f.flagSleep, "sleep-interval", 0, "wait `N` seconds between checks for changes")
+	fs.BoolVar(&f.flagQuiet, "q", false, "never print headers")
+	fs.BoolVar(&f.flagQuiet, "quiet", false, "never print headers")
+	fs.BoolVar(&f.flagQuiet, "silent", false, "never print headers")
+	fs.BoolVar(&f.flagVerbose, "v", false, "always print headers")
+	fs.BoolVar(&f.flagVerbose, "verbose", false, "always print headers")
 
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "tail [-f] [-n lines_to_show] [FILE]\n\n")
+		fmt.Fprintf(fs.Output(), "tail [OPTIONS] [FILE]...\n\n")
 		fmt.Fprintf(fs.Output(), "Tail prints the lasts 10 lines of a file. Can additionally follow the\n")
 		fmt.Fprintf(fs.Output(), "the end of the file as it grows.\n")
-		fmt.Fprintf(fs.Output(), "If no files are specified, read from stdin.\n")
+		fmt.Fprintf(fs.Output(), "If no files are specified, or the file is -, read from stdin.\n")
 		fmt.Fprintf(fs.Output(), "\n")
-		fmt.Fprintf(fs.Output(), "Missing features:\n")
-		fmt.Fprintf(fs.Output(), "- follow-mode (i.e. tail -f)\n")
 		fmt.Fprintf(fs.Output(), "Options:\n")
 		fs.PrintDefaults()
 	}
 
-	if err := fs.Parse(unixflag.ArgsToGoArgs(args)); err != nil {
-		return err
+	// the obsolete form of -n, as in "tail -5"
+	if len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && strings.Trim(args[0][1:], "0123456789") == "" {
+		args = append([]string{"-n", args[0][1:]}, args[1:]...)
+	}
+	if err := fs.Parse(cli.Args(args, "n", "lines", "c", "bytes", "pid", "s", "sleep-interval")); err != nil {
+		return cli.Exit(1, err)
 	}
 
-	stdin, ok := c.Stdin.(*os.File)
-	if stdin != nil && !ok {
-		return fmt.Errorf("tail: input type not supported")
+	config := tailConfig{
+		follow:         f.flagFollow || f.flagByName,
+		byName:         f.flagByName,
+		retry:          f.flagRetry,
+		pid:            f.flagPid,
+		followDuration: c.duration,
+		headers:        f.flagVerbose || !f.flagQuiet && fs.NArg() > 1,
 	}
-	if err := c.run(stdin, c.Stdout, f.flagFollow, f.flagNumLines, c.duration, fs.Args()); err != nil {
-		return err
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "F" {
+			config.retry = true
+		}
+	})
+	var err error
+	if f.flagBytes != "" {
+		config.bytes = true
+		config.count, config.fromStart, err = parseCount(f.flagBytes, "bytes")
+	} else {
+		config.count, config.fromStart, err = parseCount(f.flagNumLines, "lines")
+	}
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+	if f.flagSleep < 0 {
+		return cli.Exit(1, fmt.Errorf("invalid number of seconds: '%v'", f.flagSleep))
+	}
+	if f.flagSleep > 0 {
+		config.followDuration = time.Duration(f.flagSleep * float64(time.Second))
 	}
 
-	return nil
+	return c.run(ctx, c.Stdin, c.Stdout, c.Stderr, config, fs.Args())
 }
@@ -6,13 +6,19 @@ package tail
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"os/exec"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/qiangli/shell/vfs"
 )
 
 type localFS struct {
@@ -126,7 +132,7 @@ func TestTailRun(t *testing.T) {
 
 	err = run(nil, nil, true, 10, time.Second, []string{"a", "b"})
 	if err == nil {
-		t.Error("tail should return an error if more than one file specified if follow true")
+		t.Error("tail should return an error if no file to follow can be opened")
 	}
 
 	b.Truncate(0)
@@ -209,6 +215,309 @@ func TestTailFollow(t *testing.T) {
 	}
 }
 
+// watchFS notifies of changes on its channel.
+type watchFS struct {
+	localFS
+	events chan vfs.Event
+}
+
+func (r *watchFS) Watch(ctx context.Context, path string, recursive bool) (<-chan vfs.Event, error) {
+	return r.events, nil
+}
+
+func TestTailFollowWatch(t *testing.T) {
+	f := tempFile(t, "first\n")
+	defer f.Close()
+
+	wfs := &watchFS{events: make(chan vfs.Event)}
+	sw := &syncWriter{
+		ch: make(chan []byte, 2),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		cmd := New(wfs)
+		// only a change notification wakes it up
+		cmd.duration = time.Hour
+		cmd.SetIO(nil, sw, &bytes.Buffer{})
+		done <- cmd.RunContext(ctx, "-f", f.Name())
+	}()
+	if r := <-sw.ch; string(r) != "first\n" {
+		t.Fatalf("expected %q, got %q", "first\n", r)
+	}
+
+	if _, err := f.WriteString("second\n"); err != nil {
+		t.Fatal(err)
+	}
+	wfs.events <- vfs.Event{Path: f.Name(), Op: vfs.Write}
+	if r := <-sw.ch; string(r) != "second\n" {
+		t.Fatalf("expected %q, got %q", "second\n", r)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tail did not stop following when canceled")
+	}
+}
+
+func TestTailFollowPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("p\n")
+	w.Close()
+	defer r.Close()
+	f := tempFile(t, "x\n")
+
+	for _, tt := range []struct {
+		name  string
+		stdin io.Reader
+		args  []string
+		want  string
+		err   bool
+	}{
+		{name: "reader", stdin: strings.NewReader("a\n"), args: []string{"-f"}, want: "a\n"},
+		{name: "pipe", stdin: r, args: []string{"-f", "-"}, want: "p\n"},
+		{name: "pipe and missing file", stdin: strings.NewReader("a\n"), args: []string{"-f", "-", f.Name() + ".missing"}, want: "==> standard input <==\na\n", err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := New(NewLocalFS())
+			cmd.duration = 20 * time.Millisecond
+			cmd.SetIO(tt.stdin, &stdout, &stderr)
+			done := make(chan error)
+			go func() {
+				done <- cmd.Run(tt.args...)
+			}()
+			select {
+			case err := <-done:
+				if (err != nil) != tt.err {
+					t.Fatalf("error = %v, stderr %q", err, stderr.String())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("tail followed a pipe")
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, stdout.String())
+			}
+			if !tt.err && stderr.Len() > 0 {
+				t.Errorf("stderr %q", stderr.String())
+			}
+		})
+	}
+}
+
+// ctxFS records the contexts of the watches.
+type ctxFS struct {
+	localFS
+	mu   sync.Mutex
+	ctxs []context.Context
+}
+
+func (r *ctxFS) Watch(ctx context.Context, path string, recursive bool) (<-chan vfs.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctxs = append(r.ctxs, ctx)
+	return make(chan vfs.Event), nil
+}
+
+func TestTailFollowStopsWatches(t *testing.T) {
+	f := tempFile(t, "x\n")
+	p := exec.Command("true")
+	if err := p.Run(); err != nil {
+		t.Skip(err)
+	}
+
+	cfs := &ctxFS{}
+	cmd := New(cfs)
+	cmd.duration = 20 * time.Millisecond
+	cmd.SetIO(nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err := cmd.Run("-f", "--pid", strconv.Itoa(p.Process.Pid), f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	cfs.mu.Lock()
+	defer cfs.mu.Unlock()
+	if len(cfs.ctxs) != 1 || cfs.ctxs[0].Err() == nil {
+		t.Errorf("watches not stopped: %v", cfs.ctxs)
+	}
+}
+
+func TestTailCounts(t *testing.T) {
+	f := tempFile(t, "one\ntwo\nthree\nfour\n")
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-n", "2"}, "three\nfour\n"},
+		{[]string{"-n", "+3"}, "three\nfour\n"},
+		{[]string{"-n", "+0"}, "one\ntwo\nthree\nfour\n"},
+		{[]string{"-n", "0"}, ""},
+		{[]string{"-1"}, "four\n"},
+		{[]string{"--lines=1"}, "four\n"},
+		{[]string{"-c", "5"}, "four\n"},
+		{[]string{"-c", "+15"}, "four\n"},
+		{[]string{"--bytes", "3"}, "ur\n"},
+	} {
+		var b bytes.Buffer
+		cmd := New(NewLocalFS())
+		cmd.SetIO(nil, &b, &bytes.Buffer{})
+		if err := cmd.Run(append(tt.args, f.Name())...); err != nil {
+			t.Errorf("tail %q: %v", tt.args, err)
+			continue
+		}
+		if b.String() != tt.want {
+			t.Errorf("tail %q = %q, want %q", tt.args, b.String(), tt.want)
+		}
+	}
+
+	// stdin that is not a file
+	var b bytes.Buffer
+	cmd := New(NewLocalFS())
+	cmd.SetIO(strings.NewReader("one\ntwo\nthree\n"), &b, &bytes.Buffer{})
+	if err := cmd.Run("-c", "4", "-"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "ree\n" {
+		t.Errorf("tail -c 4 - = %q, want %q", b.String(), "ree\n")
+	}
+
+	cmd.SetIO(nil, &b, &bytes.Buffer{})
+	if err := cmd.Run("-n", "x", f.Name()); err == nil {
+		t.Error("tail should fail with an invalid number of lines")
+	}
+}
+
+// readUntil waits until the output contains want.
+func readUntil(t *testing.T, out *lockedBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q, got %q", want, out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTailFollowMultiple(t *testing.T) {
+	f1 := tempFile(t, "a1\n")
+	f2 := tempFile(t, "b1\n")
+
+	out := &lockedBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		cmd := New(NewLocalFS())
+		cmd.duration = 20 * time.Millisecond
+		cmd.SetIO(nil, out, &bytes.Buffer{})
+		done <- cmd.RunContext(ctx, "-f", f1.Name(), f2.Name())
+	}()
+	readUntil(t, out, fmt.Sprintf("==> %s <==\na1\n\n==> %s <==\nb1\n", f1.Name(), f2.Name()))
+
+	f1.WriteString("a2\n")
+	readUntil(t, out, fmt.Sprintf("\n==> %s <==\na2\n", f1.Name()))
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailFollowRotate(t *testing.T) {
+	f := tempFile(t, "old\n")
+	name := f.Name()
+
+	out := &lockedBuffer{}
+	stderr := &lockedBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		cmd := New(NewLocalFS())
+		cmd.duration = 20 * time.Millisecond
+		cmd.SetIO(nil, out, stderr)
+		done <- cmd.RunContext(ctx, "-F", name)
+	}()
+	readUntil(t, out, "old\n")
+
+	// rotate
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, out, "new\n")
+
+	// truncate
+	if err := os.WriteFile(name, []byte("n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, out, "n\n")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"has been replaced", "file truncated"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("expected %q in %q", want, stderr.String())
+		}
+	}
+}
+
+func TestTailFollowPid(t *testing.T) {
+	f := tempFile(t, "x\n")
+	p := exec.Command("sleep", "0.2")
+	if err := p.Start(); err != nil {
+		t.Skip(err)
+	}
+	go p.Wait()
+
+	cmd := New(NewLocalFS())
+	cmd.duration = 20 * time.Millisecond
+	var b bytes.Buffer
+	cmd.SetIO(nil, &b, &bytes.Buffer{})
+	done := make(chan error)
+	go func() {
+		done <- cmd.Run("-f", "--pid", strconv.Itoa(p.Process.Pid), f.Name())
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tail did not stop after the process exited")
+	}
+	if b.String() != "x\n" {
+		t.Errorf("expected %q, got %q", "x\n", b.String())
+	}
+}
+
+// lockedBuffer is a buffer written and read concurrently.
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.String()
+}
+
 func TestLastNLines(t *testing.T) {
 	tests := []struct {
 		input  []byte
@@ -0,0 +1,351 @@
+// Tr translates, squeezes and deletes bytes.
+//
+// Synopsis:
+//
+//	tr [OPTION]... SET1 [SET2]
+//
+// Description:
+//
+//	Tr copies stdin to stdout, replacing the bytes of SET1 by the bytes at
+//	the same positions in SET2, deleting them with -d and squeezing
+//	repeats with -s. SET2 is extended to the length of SET1 by repeating
+//	its last byte.
+//
+//	Sets are made of bytes, escapes such as \n, \t, \\ and \NNN (octal),
+//	ranges such as a-z, classes such as [:alpha:], [:digit:], [:lower:],
+//	[:upper:], [:space:], [:blank:], [:punct:], [:alnum:], [:cntrl:],
+//	[:graph:], [:print:] and [:xdigit:], equivalence classes [=c=] and, in
+//	SET2, repeats [c*N] and [c*], the latter filling SET2 to the length of
+//	SET1.
+//
+// Options:
+//
+//	-c, -C, --complement:   use the complement of SET1
+//	-d, --delete:           delete the bytes of SET1
+//	-s, --squeeze-repeats:  replace repeats of a byte of the last set by one
+//	-t, --truncate-set1:    truncate SET1 to the length of SET2
+package tr
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+)
+
+// command implements the tr core utility.
+type command struct {
+	core.Base
+}
+
+// New creates a new tr command.
+func New() core.Command {
+	c := &command{}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	complement bool
+	delete     bool
+	squeeze    bool
+	truncate   bool
+}
+
+var classes = map[string]func(c byte) bool{
+	"alnum":  func(c byte) bool { return isAlpha(c) || isDigit(c) },
+	"alpha":  isAlpha,
+	"blank":  func(c byte) bool { return c == ' ' || c == '\t' },
+	"cntrl":  func(c byte) bool { return c < ' ' || c == 0x7f },
+	"digit":  isDigit,
+	"graph":  func(c byte) bool { return c > ' ' && c < 0x7f },
+	"lower":  func(c byte) bool { return c >= 'a' && c <= 'z' },
+	"print":  func(c byte) bool { return c >= ' ' && c < 0x7f },
+	"punct":  func(c byte) bool { return c > ' ' && c < 0x7f && !isAlpha(c) && !isDigit(c) },
+	"space":  func(c byte) bool { return c == ' ' || c >= '\t' && c <= '\r' },
+	"upper":  func(c byte) bool { return c >= 'A' && c <= 'Z' },
+	"xdigit": func(c byte) bool { return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' },
+}
+
+func isAlpha(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// unescape returns the byte at the start of s, decoding escapes, and its
+// length in s.
+func unescape(s string) (byte, int) {
+	if s[0] != '\\' || len(s) == 1 {
+		return s[0], 1
+	}
+	switch c := s[1]; c {
+	case 'a':
+		return '\a', 2
+	case 'b':
+		return '\b', 2
+	case 'f':
+		return '\f', 2
+	case 'n':
+		return '\n', 2
+	case 'r':
+		return '\r', 2
+	case 't':
+		return '\t', 2
+	case 'v':
+		return '\v', 2
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n, v := 1, int(c-'0')
+		for n < 3 && 1+n < len(s) && s[1+n] >= '0' && s[1+n] <= '7' && v*8+int(s[1+n]-'0') < 256 {
+			v = v*8 + int(s[1+n]-'0')
+			n++
+		}
+		return byte(v), 1 + n
+	default:
+		return c, 2
+	}
+}
+
+// parseSet expands a set into its bytes. A [c*] repeat, only allowed in
+// SET2, is returned as the position where fill copies of its byte are to
+// be inserted.
+func parseSet(s string, set2 bool) (bytes []byte, fillAt int, fill byte, err error) {
+	fillAt = -1
+	for i := 0; i < len(s); {
+		if s[i] == '[' && i+1 < len(s) {
+			rest := s[i+1:]
+			switch {
+			case rest[0] == ':':
+				if end := strings.Index(rest, ":]"); end > 0 {
+					name := rest[1:end]
+					is, ok := classes[name]
+					if !ok {
+						return nil, 0, 0, fmt.Errorf("invalid character class '%s'", name)
+					}
+					for c := 0; c < 256; c++ {
+						if is(byte(c)) {
+							bytes = append(bytes, byte(c))
+						}
+					}
+					i += end + 3
+					continue
+				}
+			case rest[0] == '=':
+				if c, n := unescape(rest[1:]); n+3 <= len(rest) && rest[1+n:3+n] == "=]" {
+					bytes = append(bytes, c)
+					i += n + 4
+					continue
+				}
+			default:
+				c, n := unescape(rest)
+				if end := strings.IndexByte(rest[n:], ']'); n < len(rest) && rest[n] == '*' && end >= 0 {
+					count := rest[n+1 : n+end]
+					if !set2 {
+						return nil, 0, 0, errors.New("the [c*] repeat construct may not appear in string1")
+					}
+					if count == "" || strings.Trim(count, "0") == "" {
+						if fillAt >= 0 {
+							return nil, 0, 0, errors.New("only one [c*] repeat construct may appear in string2")
+						}
+						fillAt, fill = len(bytes), c
+						i += 1 + n + end + 1
+						continue
+					}
+					base := 10
+					if count[0] == '0' {
+						base = 8
+					}
+					repeat, err := strconv.ParseUint(count, base, 31)
+					if err != nil {
+						return nil, 0, 0, fmt.Errorf("invalid repeat count '%s' in [c*n] construct", count)
+					}
+					bytes = append(bytes, strings.Repeat(string([]byte{c}), int(repeat))...)
+					i += 1 + n + end + 1
+					continue
+				}
+			}
+		}
+		c, n := unescape(s[i:])
+		i += n
+		if i+1 < len(s) && s[i] == '-' {
+			end, m := unescape(s[i+1:])
+			if end < c {
+				return nil, 0, 0, fmt.Errorf("range-endpoints of '%s' are in reverse collating sequence order", s[i-n:i+1+m])
+			}
+			for b := int(c); b <= int(end); b++ {
+				bytes = append(bytes, byte(b))
+			}
+			i += 1 + m
+			continue
+		}
+		bytes = append(bytes, c)
+	}
+	return bytes, fillAt, fill, nil
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("tr", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+
+	fs.BoolVar(&f.complement, "c", false, "use the complement of SET1")
+	fs.BoolVar(&f.complement, "C", false, "use the complement of SET1")
+	fs.BoolVar(&f.complement, "complement", false, "use the complement of SET1")
+	fs.BoolVar(&f.delete, "d", false, "delete the bytes of SET1")
+	fs.BoolVar(&f.delete, "delete", false, "delete the bytes of SET1")
+	fs.BoolVar(&f.squeeze, "s", false, "replace repeats of a byte of the last set by one")
+	fs.BoolVar(&f.squeeze, "squeeze-repeats", false, "replace repeats of a byte of the last set by one")
+	fs.BoolVar(&f.truncate, "t", false, "truncate SET1 to the length of SET2")
+	fs.BoolVar(&f.truncate, "truncate-set1", false, "truncate SET1 to the length of SET2")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "tr [OPTION]... SET1 [SET2]\n\n")
+		fmt.Fprintf(fs.Output(), "Tr translates, squeezes and deletes bytes of stdin.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(cli.Args(args)); err != nil {
+		return cli.Exit(1, err)
+	}
+
+	sets := fs.Args()
+	translate := !f.delete && len(sets) == 2
+	want := 2
+	switch {
+	case f.delete && !f.squeeze, !f.delete && f.squeeze && len(sets) < 2:
+		want = 1
+	}
+	switch {
+	case len(sets) == 0:
+		return cli.Exit(1, errors.New("missing operand"))
+	case len(sets) < want:
+		if f.delete {
+			return cli.Exit(1, fmt.Errorf("missing operand after '%s'\nTwo strings must be given when both deleting and squeezing repeats.", sets[0]))
+		}
+		return cli.Exit(1, fmt.Errorf("missing operand after '%s'\nTwo strings must be given when translating.", sets[0]))
+	case len(sets) > want:
+		if f.delete {
+			return cli.Exit(1, fmt.Errorf("extra operand '%s'\nOnly one string may be given when deleting without squeezing repeats.", sets[want]))
+		}
+		return cli.Exit(1, fmt.Errorf("extra operand '%s'", sets[want]))
+	}
+
+	set1, _, _, err := parseSet(sets[0], false)
+	if err != nil {
+		return cli.Exit(1, err)
+	}
+	if f.complement {
+		var in [256]bool
+		for _, b := range set1 {
+			in[b] = true
+		}
+		set1 = set1[:0]
+		for b := 0; b < 256; b++ {
+			if !in[b] {
+				set1 = append(set1, byte(b))
+			}
+		}
+	}
+
+	var set2 []byte
+	if len(sets) == 2 {
+		var fillAt int
+		var fill byte
+		if set2, fillAt, fill, err = parseSet(sets[1], true); err != nil {
+			return cli.Exit(1, err)
+		}
+		if fillAt >= 0 {
+			n := max(len(set1)-len(set2), 0)
+			set2 = append(set2[:fillAt], append([]byte(strings.Repeat(string([]byte{fill}), n)), set2[fillAt:]...)...)
+		}
+	}
+
+	t := &translator{}
+	for b := range t.table {
+		t.table[b] = byte(b)
+	}
+	switch {
+	case translate:
+		if len(set2) == 0 {
+			return cli.Exit(1, errors.New("when not truncating set1, string2 must be non-empty"))
+		}
+		if f.truncate {
+			set1 = set1[:min(len(set1), len(set2))]
+		}
+		for i, b := range set1 {
+			t.table[b] = set2[min(i, len(set2)-1)]
+		}
+		if f.squeeze {
+			t.setSqueeze(set2)
+		}
+	case f.delete:
+		for _, b := range set1 {
+			t.delete[b] = true
+		}
+		if f.squeeze {
+			t.setSqueeze(set2)
+		}
+	default:
+		t.setSqueeze(set1)
+	}
+
+	if err := t.copy(ctx, c.Stdout, c.Stdin); err != nil {
+		return cli.Exit(1, err)
+	}
+	return nil
+}
+
+// translator maps, deletes and squeezes bytes.
+type translator struct {
+	table   [256]byte
+	delete  [256]bool
+	squeeze [256]bool
+}
+
+func (t *translator) setSqueeze(set []byte) {
+	for _, b := range set {
+		t.squeeze[b] = true
+	}
+}
+
+func (t *translator) copy(ctx context.Context, w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 32*1024)
+	last := -1
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if t.delete[b] {
+				continue
+			}
+			b = t.table[b]
+			if t.squeeze[b] && int(b) == last {
+				continue
+			}
+			bw.WriteByte(b)
+			last = int(b)
+		}
+		if err == io.EOF {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
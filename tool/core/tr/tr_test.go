@@ -0,0 +1,14 @@
+package tr
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/core"
+
+	"github.com/qiangli/shell/tool/core/internal/golden"
+)
+
+func TestTr(t *testing.T) {
+	golden.Run(t, "tr", func(fs.FS) core.Command { return New() })
+}
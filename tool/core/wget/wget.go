@@ -3,21 +3,26 @@
 // license that can be found in the LICENSE file.
 //go:build !tinygo || tinygo.enable
 
-// Wget reads one file from a url and writes to stdout.
+// Wget reads one file from a url and writes it to a file of the workspace.
 //
 // Synopsis:
 //
-//	wget URL
+//	wget [-O FILE] URL
 //
 // Description:
 //
-//	Returns a non-zero code on failure.
+//	The file is named after the last element of the url path, index.html
+//	if there is none, unless -O is given; "-O -" writes to stdout. Files
+//	are written through the workspace, to a temporary file replacing the
+//	file once the download is complete, and requests follow the network
+//	policy of the shell. Returns a non-zero code on failure.
 //
 // Notes:
 //
 //	There are a few differences with GNU wget:
 //	- Upon error, the return value is always 1.
-//	- The protocol (http/https) is mandatory.
+//	- The protocol (http/https) is mandatory. file and tftp urls are not
+//	  supported, they would bypass the workspace and the network policy.
 //
 // Example:
 //
@@ -30,88 +35,33 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"path"
 	"strings"
 
+	"github.com/u-root/u-root/pkg/core"
 	"github.com/u-root/u-root/pkg/curl"
-	"github.com/u-root/uio/uio"
-
-	// To build the dependencies of this package with TinyGo, we need to include
-	// the cpuid package, since tinygo does not support the asm code in the
-	// cpuid package. The cpuid package will use the tinygo bridge to get the
-	// CPU information. For further information see
-	// github.com/u-root/cpuid/cpuid_amd64_tinygo_bridge.go
-	_ "github.com/u-root/cpuid"
 
-	"github.com/u-root/u-root/pkg/core"
-	// "github.com/u-root/u-root/pkg/uroot/unixflag"
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+	"github.com/qiangli/shell/vnet"
 )
 
 var errEmptyURL = errors.New("empty url")
 
+// cmd implements the wget core utility.
 type cmd struct {
 	core.Base
 
+	ws     vfs.Workspace
+	policy *vnet.Policy
+
 	url        string
 	outputPath string
 }
 
-// // flags parses wget flags
-// // wget is old school, and allows flags after the URL.
-// // This code does not process the -- flag specified in the
-// // man page, as the command itself does not seem to either.
-// func flags(args ...string) (string, string, error) {
-// 	// -- takes priority over everything else.
-// 	// flag package does not allow - as a flag.
-// 	// except, in spite of the docs, wget on linux seems
-// 	// to ignore --. Great. It's a terrible idea anyway,
-// 	// unless you really like creating files that start
-// 	// with -
-// 	// If at some point one wishes to add -- support,
-// 	// the slices package is a good place to start.
-
-// 	if len(args) == 0 {
-// 		return "", "", errEmptyURL
-// 	}
-
-// 	f := flag.NewFlagSet(args[0], flag.ContinueOnError)
-// 	outPath := f.String("O", "", "output file")
-
-// 	if err := f.Parse(args[1:]); err != nil {
-// 		return "", "", err
-// 	}
-
-// 	if len(f.Args()) == 0 {
-// 		return "", "", errEmptyURL
-// 	}
-
-// 	URL := f.Args()[0]
-
-// 	// Now, it is allowed to have switches after the URL,
-// 	// handle following flags
-// 	if err := f.Parse(f.Args()[1:]); err != nil {
-// 		return "", "", err
-// 	}
-
-// 	return *outPath, URL, nil
-// }
-
-// func command(args ...string) (*cmd, error) {
-// 	outPath, URL, err := flags(args...)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-
-// 	return &cmd{
-// 		outputPath: outPath,
-// 		url:        URL,
-// 	}, nil
-// }
-
-func (c *cmd) run() error {
-	// log.SetPrefix("wget: ")
-
+func (c *cmd) run(ctx context.Context) error {
 	if c.url == "" {
 		return errEmptyURL
 	}
@@ -120,49 +70,43 @@ func (c *cmd) run() error {
 	if err != nil {
 		return err
 	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q of %v", parsedURL.Scheme, c.url)
+	}
 
 	if c.outputPath == "" {
 		c.outputPath = defaultOutputPath(parsedURL.Path)
 	}
-	// if c.outputPath == "-" {
-	// 	// c.outputPath = "/dev/stdout"
-	// }
-
-	schemes := curl.Schemes{
-		"tftp": curl.DefaultTFTPClient,
-		"http": curl.DefaultHTTPClient,
 
-		// curl.DefaultSchemes doesn't support HTTPS by default.
-		"https": curl.DefaultHTTPClient,
-		"file":  &curl.LocalFileClient{},
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsedURL.String(), nil)
+	if err != nil {
+		return err
 	}
-
-	reader, err := schemes.FetchWithoutCache(context.Background(), parsedURL)
+	resp, err := c.policy.Client().Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to download %v: %w", c.url, err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %v: %w: %s", c.url, curl.ErrStatusNotOk, resp.Status)
+	}
+	body := c.policy.Body(resp.Body)
 
-	if c.outputPath == "-" || c.outputPath == "" {
-		b, err := uio.ReadAll(uio.NewCachingReader(reader))
-		if err != nil {
-			return err
-		}
-		// io.WriteString(c.Stdout, string(b))
-		io.Writer.Write(c.Stdout, b)
-	} else {
-		if err := uio.ReadIntoFile(reader, c.outputPath); err != nil {
-			return err
-		}
+	if c.outputPath == "-" {
+		_, err := io.Copy(c.Stdout, body)
+		return err
+	}
+	f, err := cli.CreateFile(c.ws, c.ResolvePath(c.outputPath))
+	if err != nil {
+		return err
 	}
-	return nil
+	if _, err := io.Copy(f, body); err != nil {
+		f.Abort()
+		return fmt.Errorf("failed to download %v: %w", c.url, err)
+	}
+	return f.Commit()
 }
 
-// func usage() {
-// 	log.Printf("Usage: %s [ARGS] URL\n", os.Args[0])
-// 	flag.PrintDefaults()
-// 	// os.Exit(2)
-// }
-
 func defaultOutputPath(urlPath string) string {
 	if urlPath == "" || strings.HasSuffix(urlPath, "/") {
 		return "index.html"
@@ -170,31 +114,17 @@ func defaultOutputPath(urlPath string) string {
 	return path.Base(urlPath)
 }
 
-// func main() {
-// 	c, err := command(os.Args...)
-// 	if err == nil {
-// 		err = c.run()
-// 	}
-// 	if err != nil {
-// 		if errors.Is(err, errEmptyURL) {
-// 			usage()
-// 		}
-// 		log.Fatal(err)
-// 	}
-// }
-
-// command implements the wget core utility.
-// type command struct {
-// 	core.Base
-// }
-
 type flags struct {
 	outPath string
 }
 
-// New creates a new cat command.
-func New() core.Command {
-	c := &cmd{}
+// New creates a new wget command writing to ws, with the requests
+// restricted by policy.
+func New(ws vfs.Workspace, policy *vnet.Policy) core.Command {
+	c := &cmd{
+		ws:     ws,
+		policy: policy,
+	}
 	c.Init()
 	return c
 }
@@ -208,23 +138,20 @@ func (c *cmd) Run(args ...string) error {
 func (c *cmd) RunContext(ctx context.Context, args ...string) error {
 	var f flags
 
-	if len(args) == 0 {
-		return errEmptyURL
-	}
-
-	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs := flag.NewFlagSet("wget", flag.ContinueOnError)
 	fs.SetOutput(c.Stderr)
 
 	fs.StringVar(&f.outPath, "O", "", "output file")
 
 	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "wget URL\n\n")
-		fmt.Fprintf(fs.Output(), "Wget reads one file from a url and writes to stdout.\n")
+		fmt.Fprintf(fs.Output(), "wget [-O FILE] URL\n\n")
+		fmt.Fprintf(fs.Output(), "Wget reads one file from a url and writes it to a file of the workspace.\n")
 		fmt.Fprintf(fs.Output(), "Options:\n")
 		fs.PrintDefaults()
 	}
 
-	if err := fs.Parse(args); err != nil {
+	// wget is old school, and allows flags after the URL.
+	if err := fs.Parse(cli.Args(args, "O")); err != nil {
 		return err
 	}
 
@@ -232,30 +159,8 @@ func (c *cmd) RunContext(ctx context.Context, args ...string) error {
 		return errEmptyURL
 	}
 
-	URL := fs.Args()[0]
-
-	// Now, it is allowed to have switches after the URL,
-	// handle following flags
-	// if err := fs.Parse(unixflag.ArgsToGoArgs(fs.Args()[1:])); err != nil {
-	// 	return err
-	// }
-
-	// outPath, URL, err := flags(args...)
-	// if err != nil {
-	// 	return nil, err
-	// }
-
-	// fetcher := &cmd{
 	c.outputPath = f.outPath
-	c.url = URL
-	// }
-
-	if err := c.run(); err != nil {
-		return err
-	}
-	// if err := run(c.Stdout, fs.Args()); err != nil {
-	// 	return err
-	// }
+	c.url = fs.Args()[0]
 
-	return nil
+	return c.run(ctx)
 }
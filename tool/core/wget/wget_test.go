@@ -12,14 +12,19 @@ package wget
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/u-root/u-root/pkg/curl"
+
+	"github.com/qiangli/shell/vfs"
+	"github.com/qiangli/shell/vnet"
 )
 
 const content = "Very simple web server"
@@ -33,6 +38,9 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(content))
 	case "/302":
 		http.Redirect(w, r, "/200", http.StatusFound /* 302 */)
+	case "/302-ipv4":
+		// to the same server by its address
+		http.Redirect(w, r, "http://"+strings.Replace(r.Host, "localhost", "127.0.0.1", 1)+"/200", http.StatusFound)
 	case "/500":
 		w.WriteHeader(500)
 		w.Write([]byte(content))
@@ -134,12 +142,15 @@ func TestWget(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := os.Chdir(t.TempDir()); err != nil {
-				t.Fatalf("failed to change into temporary directory: %v", err)
+			dir := t.TempDir()
+			ws, err := vfs.NewLocalFS([]string{dir})
+			if err != nil {
+				t.Fatal(err)
 			}
 
-			cmd := New()
-			err := cmd.Run([]string{"-O", tt.outputPath, tt.url}...)
+			cmd := New(ws, nil)
+			cmd.SetWorkingDir(dir)
+			err = cmd.Run([]string{"-O", tt.outputPath, tt.url}...)
 			// c, err := command([]string{"wget", "-O", tt.outputPath, tt.url}...)
 			// if err == nil {
 			// 	err = c.run()
@@ -150,7 +161,7 @@ func TestWget(t *testing.T) {
 			}
 
 			if tt.wantContent != "" {
-				content, err := os.ReadFile(tt.wantOutputPath)
+				content, err := os.ReadFile(filepath.Join(dir, tt.wantOutputPath))
 				if err != nil {
 					t.Fatalf("file %s was not created: %v", tt.wantOutputPath, err)
 				}
@@ -187,7 +198,7 @@ func TestNoServer(t *testing.T) {
 		}
 	}()
 
-	cmd := New()
+	cmd := New(nil, nil)
 	err := cmd.Run([]string{"", fmt.Sprintf("http://localhost:%d/200", port)}...)
 	// c, err := command("", fmt.Sprintf("http://localhost:%d/200", port))
 	// if err != errEmptyURL {
@@ -201,6 +212,22 @@ func TestNoServer(t *testing.T) {
 	}
 }
 
+func TestUnsupportedScheme(t *testing.T) {
+	// file urls would read around the workspace
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"file://" + secret, "tftp://localhost/file"} {
+		var stdout strings.Builder
+		cmd := New(nil, nil)
+		cmd.SetIO(strings.NewReader(""), &stdout, io.Discard)
+		if err := cmd.Run("-O", "-", u); err == nil || stdout.Len() > 0 {
+			t.Errorf("%s: got %q, %v, want an error", u, stdout.String(), err)
+		}
+	}
+}
+
 // func TestFlags(t *testing.T) {
 // 	for _, tt := range []struct {
 // 		name string
@@ -234,7 +261,7 @@ func TestStdout(t *testing.T) {
 	srv := httptest.NewServer(handler{})
 	defer srv.Close()
 
-	cmd := New()
+	cmd := New(nil, nil)
 	err := cmd.Run([]string{"-O", "-", fmt.Sprintf("%s/200", srv.URL)}...)
 	// c, err := command([]string{"wget", "-O", "-", fmt.Sprintf("%s/200", srv.URL)}...)
 	// if err != nil {
@@ -245,3 +272,106 @@ func TestStdout(t *testing.T) {
 		t.Errorf("expected nil got %v", err)
 	}
 }
+
+func TestPolicy(t *testing.T) {
+	srv := httptest.NewServer(handler{})
+	defer srv.Close()
+	local := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	for _, tt := range []struct {
+		name   string
+		url    string
+		policy *vnet.Policy
+		err    error
+	}{
+		{
+			name:   "allowed host",
+			url:    srv.URL + "/200",
+			policy: &vnet.Policy{AllowHosts: []string{"127.0.0.0/8"}},
+		},
+		{
+			name:   "host not allowed",
+			url:    srv.URL + "/200",
+			policy: &vnet.Policy{AllowHosts: []string{"example.com"}},
+			err:    vnet.ErrHostNotAllowed,
+		},
+		{
+			name:   "redirect to a host not allowed",
+			url:    local + "/302-ipv4",
+			policy: &vnet.Policy{AllowHosts: []string{"localhost"}},
+			err:    vnet.ErrHostNotAllowed,
+		},
+		{
+			name:   "response too large",
+			url:    srv.URL + "/200",
+			policy: &vnet.Policy{MaxBytes: int64(len(content) - 1)},
+			err:    vnet.ErrTooLarge,
+		},
+		{
+			name:   "response within the cap",
+			url:    srv.URL + "/200",
+			policy: &vnet.Policy{MaxBytes: int64(len(content))},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ws, err := vfs.NewLocalFS([]string{dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := New(ws, tt.policy)
+			cmd.SetWorkingDir(dir)
+			err = cmd.Run("-O", "out", tt.url)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			got, readErr := os.ReadFile(filepath.Join(dir, "out"))
+			if tt.err == nil && string(got) != content {
+				t.Errorf("got %q, %v, want %q", got, readErr, content)
+			}
+			if tt.err != nil && readErr == nil {
+				t.Errorf("out was written on error")
+			}
+		})
+	}
+}
+
+func TestOutputReplaced(t *testing.T) {
+	srv := httptest.NewServer(handler{})
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name   string
+		policy *vnet.Policy
+		want   string
+	}{
+		{name: "complete", want: content},
+		{name: "too large", policy: &vnet.Policy{MaxBytes: 1}, want: "old"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "out"), []byte("old"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			ws, err := vfs.NewLocalFS([]string{dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := New(ws, tt.policy)
+			cmd.SetWorkingDir(dir)
+			cmd.Run("-O", "out", srv.URL+"/200")
+			if got, err := os.ReadFile(filepath.Join(dir, "out")); string(got) != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+			if info, err := os.Stat(filepath.Join(dir, "out")); err != nil || info.Mode().Perm() != 0o600 {
+				t.Errorf("mode %v, %v, want %v", info.Mode(), err, os.FileMode(0o600))
+			}
+			// no temporary file is left
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%d files, want 1", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+// Yq processes YAML.
+//
+// Synopsis:
+//
+//	yq [OPTION]... PROGRAM [FILE]...
+//
+// Description:
+//
+//	Yq runs the jq PROGRAM on each document of the YAML files, or of
+//	stdin, and writes the results as YAML. The program and the options
+//	are those of jq, see jq. The results of a document are written one
+//	after the other and those of the next document after a "---" line;
+//	with -c each result is written on one line in the flow style of JSON.
+//
+//	With -i each file is replaced with the results of its documents,
+//	through the atomic writes of the workspace, in the format of its
+//	input unless -o is given. A file is left as it is if the program
+//	fails on it. Comments and the order of keys are not kept.
+//
+// Options:
+//
+//	-i, --inplace:              edit the files in place
+//	-p, --input-format FORMAT:  read yaml or json (default: yaml)
+//	-o, --output-format FORMAT: write yaml or json (default: yaml)
+//	-r, --raw-output:           write strings without quotes
+//	-j, --join-output:          like -r without newlines after the results
+//	-c, --compact-output:       write each result on one line
+//	-s, --slurp:                run the program once on the array of the inputs
+//	-n, --null-input:           run the program once on null, the inputs being read by input
+//	-R, --raw-input:            read the lines of the input as strings, or the whole input with -s
+//	-e, --exit-status:          set the exit status from the last result
+//	-S, --sort-keys:            sort the keys of objects (always done)
+//	    --tab:                  indent JSON with a tab
+//	    --indent N:             indent with N spaces (default: 2)
+//	    --arg NAME VALUE:       set $NAME to the string VALUE
+//	    --argjson NAME TEXT:    set $NAME to the JSON TEXT
+package yq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/u-root/u-root/pkg/core"
+	"gopkg.in/yaml.v3"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/tool/core/internal/query"
+	"github.com/qiangli/shell/vfs"
+)
+
+// command implements the yq core utility.
+type command struct {
+	core.Base
+
+	ws vfs.Workspace
+}
+
+// New creates a new yq command.
+func New(ws vfs.Workspace) core.Command {
+	c := &command{
+		ws: ws,
+	}
+	c.Init()
+	return c
+}
+
+type flags struct {
+	query.Options
+
+	inPlace bool
+	input   string
+	output  string
+}
+
+// format returns the canonical name of a format.
+func format(s string) (string, error) {
+	switch s {
+	case "y", "yaml", "yml":
+		return "yaml", nil
+	case "j", "json":
+		return "json", nil
+	}
+	return "", fmt.Errorf("unknown format: %s", s)
+}
+
+// Run executes the command with a `context.Background()`.
+func (c *command) Run(args ...string) error {
+	return c.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command.
+func (c *command) RunContext(ctx context.Context, args ...string) error {
+	var f flags
+
+	fs := flag.NewFlagSet("yq", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	f.Flags(fs)
+	fs.BoolVar(&f.inPlace, "i", false, "edit the files in place")
+	fs.BoolVar(&f.inPlace, "inplace", false, "edit the files in place")
+	fs.StringVar(&f.input, "p", "yaml", "read yaml or json")
+	fs.StringVar(&f.input, "input-format", "yaml", "read yaml or json")
+	fs.StringVar(&f.output, "o", "", "write yaml or json (default: yaml)")
+	fs.StringVar(&f.output, "output-format", "", "write yaml or json (default: yaml)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "yq [OPTION]... PROGRAM [FILE]...\n\n")
+		fmt.Fprintf(fs.Output(), "Yq processes YAML.\n")
+		fmt.Fprintf(fs.Output(), "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "  --arg NAME VALUE\n    \tset $NAME to the string VALUE\n")
+		fmt.Fprintf(fs.Output(), "  --argjson NAME TEXT\n    \tset $NAME to the JSON TEXT\n")
+	}
+
+	args, err := f.Args(args)
+	if err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	valued := append([]string{"p", "input-format", "o", "output-format"}, query.Valued...)
+	if err := fs.Parse(cli.Args(args, valued...)); err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	if err := f.CheckIndent(); err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return cli.Exit(query.ExitUsage, nil)
+	}
+	if f.input, err = format(f.input); err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	if f.output == "" {
+		f.output = "yaml"
+		if f.inPlace {
+			f.output = f.input
+		}
+	}
+	if f.output, err = format(f.output); err != nil {
+		return cli.Exit(query.ExitUsage, err)
+	}
+	decode := decodeYAML
+	if f.input == "json" {
+		decode = query.DecodeJSON
+	}
+
+	program, files := fs.Arg(0), fs.Args()[1:]
+	if !f.inPlace {
+		open := func(name string) (io.ReadCloser, error) {
+			if name == "-" {
+				return io.NopCloser(c.Stdin), nil
+			}
+			f, err := c.ws.OpenFile(c.ResolvePath(name), os.O_RDONLY, 0)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, pathCause(err))
+			}
+			return f, nil
+		}
+		return c.run(ctx, &f, program, query.NewInputs(files, open, decode, &f.Options), c.Stdout)
+	}
+
+	if len(files) == 0 {
+		return cli.Exit(query.ExitUsage, errors.New("no files to edit in place"))
+	}
+	var status error
+	for _, name := range files {
+		if err := c.editInPlace(ctx, &f, program, name, decode); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			status = err
+		}
+	}
+	return status
+}
+
+// run runs the program on the inputs, writing the results to w.
+func (c *command) run(ctx context.Context, f *flags, program string, in *query.Inputs, w io.Writer) error {
+	docs := &documents{Inputs: in}
+	prog, err := query.Compile(program, &f.Options, docs)
+	if err != nil {
+		return cli.Exit(query.ExitCompile, err)
+	}
+	var written int
+	write := func(v any) error {
+		if f.output == "json" {
+			return f.WriteJSON(w, v)
+		}
+		if written != 0 && written != docs.n {
+			io.WriteString(w, "---\n")
+		}
+		written = docs.n
+		return writeYAML(w, v, &f.Options)
+	}
+	return prog.Run(ctx, "yq", &f.Options, docs, write, c.Stderr)
+}
+
+// editInPlace runs the program on the file and replaces it with the
+// results through the workspace.
+func (c *command) editInPlace(ctx context.Context, f *flags, program, name string, decode query.NewDecoder) error {
+	path := c.ResolvePath(name)
+	if name == "-" {
+		return cli.Exit(query.ExitUsage, fmt.Errorf("couldn't edit %s: not a regular file", name))
+	}
+	data, err := c.ws.ReadFile(path, nil)
+	if err != nil {
+		return cli.Exit(query.ExitUsage, fmt.Errorf("%s: %w", name, pathCause(err)))
+	}
+	open := func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	var buf bytes.Buffer
+	if err := c.run(ctx, f, program, query.NewInputs([]string{name}, open, decode, &f.Options), &buf); err != nil {
+		return err
+	}
+	if err := c.ws.WriteFile(path, buf.Bytes(), nil); err != nil {
+		return cli.Exit(query.ExitUsage, fmt.Errorf("couldn't edit %s: %w", name, err))
+	}
+	return nil
+}
+
+// documents counts the documents read, by the main loop or by input.
+type documents struct {
+	*query.Inputs
+	n int
+}
+
+func (d *documents) Next() (any, bool) {
+	v, ok := d.Inputs.Next()
+	if ok {
+		d.n++
+	}
+	return v, ok
+}
+
+// decodeYAML decodes the documents of a YAML stream.
+func decodeYAML(r io.Reader) query.Decoder {
+	dec := yaml.NewDecoder(r)
+	return func() (any, error) {
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		return fromYAML(v), nil
+	}
+}
+
+// fromYAML converts the decoded YAML to the values of jq.
+func fromYAML(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = fromYAML(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = fromYAML(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = fromYAML(e)
+		}
+		return v
+	case uint64:
+		return new(big.Int).SetUint64(v)
+	case []byte:
+		return string(v)
+	}
+	return v
+}
+
+// toYAML converts the values of jq for the YAML encoder.
+func toYAML(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = toYAML(e)
+		}
+		return m
+	case []any:
+		a := make([]any, len(v))
+		for i, e := range v {
+			a[i] = toYAML(e)
+		}
+		return a
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if b, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return &yaml.Node{Kind: yaml.ScalarNode, Value: b.String()}
+		}
+		f, _ := v.Float64()
+		return f
+	case *big.Int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: v.String()}
+	}
+	return v
+}
+
+// writeYAML writes v as a YAML document, a raw string with -r and -j, or
+// in the flow style of JSON with -c.
+func writeYAML(w io.Writer, v any, o *query.Options) error {
+	if _, ok := v.(string); ok && (o.Raw || o.Join) || o.Compact {
+		return o.WriteJSON(w, v)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(o.Indent)
+	if err := enc.Encode(toYAML(v)); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if o.Join {
+		b = bytes.TrimSuffix(b, []byte("\n"))
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// pathCause drops the operation and the path of file errors.
+func pathCause(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
@@ -0,0 +1,237 @@
+package yq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qiangli/shell/tool/core/internal/cli"
+	"github.com/qiangli/shell/vfs"
+)
+
+func setup(t *testing.T, files map[string]string) (string, vfs.Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := vfs.NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func runYq(ws vfs.Workspace, dir, stdin string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	cmd := New(ws)
+	cmd.SetIO(strings.NewReader(stdin), &stdout, &stderr)
+	cmd.SetWorkingDir(dir)
+	err := cmd.Run(args...)
+	var e *cli.ExitError
+	if errors.As(err, &e) && e.Err != nil {
+		// as the shell reports it
+		fmt.Fprintf(&stderr, "yq: %v\n", e.Err)
+	}
+	return stdout.String(), stderr.String(), exitCode(err)
+}
+
+func exitCode(err error) int {
+	var e *cli.ExitError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+const config = `# the service
+name: web
+replicas: 2
+ports:
+  - 80
+  - 443
+env:
+  DEBUG: "false"
+  LEVEL: info
+`
+
+func TestYq(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		stdin string
+		files map[string]string
+		want  string
+		code  int
+		// wantFiles are the contents of files after the run
+		wantFiles map[string]string
+	}{
+		{
+			name:  "scalar",
+			args:  []string{".name"},
+			stdin: config,
+			want:  "web\n",
+		},
+		{
+			name:  "quoted scalar",
+			args:  []string{".env.DEBUG"},
+			stdin: config,
+			want:  "\"false\"\n",
+		},
+		{
+			name:  "raw output",
+			args:  []string{"-r", ".env.DEBUG"},
+			stdin: config,
+			want:  "false\n",
+		},
+		{
+			name:  "mapping",
+			args:  []string{".env"},
+			stdin: config,
+			want:  "DEBUG: \"false\"\nLEVEL: info\n",
+		},
+		{
+			name:  "results of a document",
+			args:  []string{".ports[]"},
+			stdin: config,
+			want:  "80\n443\n",
+		},
+		{
+			name:  "documents",
+			args:  []string{".a"},
+			stdin: "a: 1\n---\na: [x]\n",
+			want:  "1\n---\n- x\n",
+		},
+		{
+			name:  "update",
+			args:  []string{".replicas += 1 | del(.env)"},
+			stdin: config,
+			want:  "name: web\nports:\n  - 80\n  - 443\nreplicas: 3\n",
+		},
+		{
+			name:  "json output",
+			args:  []string{"-o", "json", "{name, ports}"},
+			stdin: config,
+			want:  "{\n  \"name\": \"web\",\n  \"ports\": [\n    80,\n    443\n  ]\n}\n",
+		},
+		{
+			name:  "compact",
+			args:  []string{"-c", ".ports"},
+			stdin: config,
+			want:  "[80,443]\n",
+		},
+		{
+			name:  "json input",
+			args:  []string{"-p", "json", "."},
+			stdin: `{"a": {"b": [1, 2.5, 100000000000000000001]}}`,
+			want:  "a:\n  b:\n    - 1\n    - 2.5\n    - 100000000000000000001\n",
+		},
+		{
+			name:  "slurp",
+			args:  []string{"-s", "map(.a) | add"},
+			stdin: "a: 1\n---\na: 2\n",
+			want:  "3\n",
+		},
+		{
+			name: "null input",
+			args: []string{"-n", "--arg", "name", "api", "--argjson", "ports", "[8080]", "{name: $name, ports: $ports}"},
+			want: "name: api\nports:\n  - 8080\n",
+		},
+		{
+			name:  "exit status",
+			args:  []string{"-e", ".missing"},
+			stdin: config,
+			want:  "null\n",
+			code:  1,
+		},
+		{
+			name:  "indent",
+			args:  []string{"--indent", "4", ".env"},
+			stdin: "env: {a: {b: 1}}\n",
+			want:  "a:\n    b: 1\n",
+		},
+		{
+			name:  "files",
+			args:  []string{".v", "a.yaml", "b.yml"},
+			files: map[string]string{"a.yaml": "v: 1\n", "b.yml": "v: 2\n"},
+			want:  "1\n---\n2\n",
+		},
+		{
+			name:  "multiline string",
+			args:  []string{"."},
+			stdin: "s: |\n  a\n  b\n",
+			want:  "s: |\n  a\n  b\n",
+		},
+		{
+			name:      "in place",
+			args:      []string{"-i", ".replicas = 3", "a.yaml"},
+			files:     map[string]string{"a.yaml": "name: web\nreplicas: 2\n"},
+			wantFiles: map[string]string{"a.yaml": "name: web\nreplicas: 3\n"},
+		},
+		{
+			name:      "in place documents",
+			args:      []string{"-i", ".count *= 10", "a.yaml", "b.yaml"},
+			files:     map[string]string{"a.yaml": "count: 1\n---\ncount: 2\n", "b.yaml": "count: 3\n"},
+			wantFiles: map[string]string{"a.yaml": "count: 10\n---\ncount: 20\n", "b.yaml": "count: 30\n"},
+		},
+		{
+			name:      "in place json",
+			args:      []string{"-i", "-p", "json", ".a = 2", "a.json"},
+			files:     map[string]string{"a.json": "{\"a\": 1}\n"},
+			wantFiles: map[string]string{"a.json": "{\n  \"a\": 2\n}\n"},
+		},
+		{
+			name:      "in place failure",
+			args:      []string{"-i", ".a.b = 1", "a.yaml"},
+			files:     map[string]string{"a.yaml": "a: [1]\n"},
+			code:      5,
+			wantFiles: map[string]string{"a.yaml": "a: [1]\n"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := setup(t, tt.files)
+			got, stderr, code := runYq(ws, dir, tt.stdin, tt.args...)
+			if got != tt.want || code != tt.code {
+				t.Errorf("yq %q: got %q, exit %d, want %q, exit %d; stderr %q", tt.args, got, code, tt.want, tt.code, stderr)
+			}
+			for name, want := range tt.wantFiles {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Errorf("yq %q: %v", tt.args, err)
+				} else if string(data) != want {
+					t.Errorf("yq %q: got %s %q, want %q", tt.args, name, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestYqErrors(t *testing.T) {
+	dir, ws := setup(t, map[string]string{"bad.yaml": "a: [1\n"})
+	for _, tt := range []struct {
+		args   []string
+		stderr string
+		code   int
+	}{
+		{[]string{".a[", "bad.yaml"}, "yq: invalid query: .a[: unexpected EOF\n", 3},
+		{[]string{".", "bad.yaml"}, "yq: bad.yaml: yaml: line 1: did not find expected ',' or ']'\n", 2},
+		{[]string{".", "none.yaml"}, "yq: none.yaml: no such file or directory\n", 2},
+		{[]string{"-o", "xml", "."}, "yq: unknown format: xml\n", 2},
+		{[]string{"-i", "."}, "yq: no files to edit in place\n", 2},
+		{[]string{"-i", ".", "none.yaml"}, "yq: none.yaml: no such file or directory\n", 2},
+	} {
+		_, stderr, code := runYq(ws, dir, "", tt.args...)
+		if stderr != tt.stderr || code != tt.code {
+			t.Errorf("yq %q: got %q, exit %d, want %q, exit %d", tt.args, stderr, code, tt.stderr, tt.code)
+		}
+	}
+}
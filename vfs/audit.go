@@ -0,0 +1,440 @@
+package vfs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrAuditGap is reported by VerifyAuditLog when a record is missing
+	ErrAuditGap = errors.New("audit log gap")
+	// ErrAuditTampered is reported by VerifyAuditLog when a record was altered
+	ErrAuditTampered = errors.New("audit log tampered")
+)
+
+// AuditRecord is one entry of the workspace audit log.
+// Records are chained: Prev holds the Hash of the preceding record and
+// Hash is the sha256 of the record encoded with an empty Hash.
+type AuditRecord struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"`
+	Op      string    `json:"op"`
+	Path    string    `json:"path"`
+	Target  string    `json:"target,omitempty"`
+	Flag    int       `json:"flag,omitempty"`
+	Before  string    `json:"before,omitempty"`
+	After   string    `json:"after,omitempty"`
+	Size    int64     `json:"size"`
+	Error   string    `json:"error,omitempty"`
+	Prev    string    `json:"prev"`
+	Hash    string    `json:"hash"`
+}
+
+func (r *AuditRecord) digest() (string, error) {
+	c := *r
+	c.Hash = ""
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditWorkspace wraps a Workspace and appends a hash-chained record
+// to the audit log for every mutation made through it.
+//
+// Files opened for writing with OpenFile are recorded when opened, with
+// the content digest at that time, and again when closed with the digest
+// of what was written.
+type AuditWorkspace struct {
+	Workspace
+
+	session string
+
+	mu   sync.Mutex
+	log  *os.File
+	seq  int64
+	prev string
+}
+
+// NewAuditWorkspace returns a Workspace recording mutations of ws to logPath.
+// An existing log is verified and appended to. A random session id is
+// generated if session is empty.
+func NewAuditWorkspace(ws Workspace, logPath string, session string) (*AuditWorkspace, error) {
+	if session == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		session = hex.EncodeToString(b)
+	}
+
+	last, err := verifyAuditLog(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	a := &AuditWorkspace{
+		Workspace: ws,
+		session:   session,
+		log:       f,
+	}
+	if last != nil {
+		a.seq = last.Seq
+		a.prev = last.Hash
+	}
+	return a, nil
+}
+
+// Unwrap returns the underlying workspace.
+func (a *AuditWorkspace) Unwrap() Workspace {
+	return a.Workspace
+}
+
+// Session returns the session id stamped on the records.
+func (a *AuditWorkspace) Session() string {
+	return a.session
+}
+
+// Close closes the audit log.
+func (a *AuditWorkspace) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.log.Close()
+}
+
+func (a *AuditWorkspace) append(r *AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r.Seq = a.seq + 1
+	r.Time = time.Now().UTC()
+	r.Session = a.session
+	r.Prev = a.prev
+
+	hash, err := r.digest()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err := a.log.Write(b); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := a.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	a.seq = r.Seq
+	a.prev = r.Hash
+	return nil
+}
+
+// record appends the record, reporting the operation error if any.
+func (a *AuditWorkspace) record(r *AuditRecord, opErr error) error {
+	if opErr != nil {
+		r.Error = opErr.Error()
+	}
+	if err := a.append(r); err != nil {
+		return errors.Join(opErr, err)
+	}
+	return opErr
+}
+
+// locate returns the resolved path for the log, or path itself if it is invalid.
+func (a *AuditWorkspace) locate(path string) string {
+	if p, err := a.Workspace.Locator(path); err == nil {
+		return p
+	}
+	return path
+}
+
+// checksum returns the sha256 and size of a regular file, empty if it does not exist.
+func (a *AuditWorkspace) checksum(path string) (string, int64) {
+	info, err := a.Workspace.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", 0
+	}
+	f, err := a.Workspace.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return "", 0
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0
+	}
+	return hex.EncodeToString(h.Sum(nil)), n
+}
+
+// checksums returns the sha256 of every regular file under path keyed by location.
+func (a *AuditWorkspace) checksums(path string) map[string]string {
+	sums := make(map[string]string)
+	root := a.locate(path)
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			sums[p], _ = a.checksum(p)
+		}
+		return nil
+	})
+	return sums
+}
+
+func (a *AuditWorkspace) WriteFile(path string, content []byte, o *WriteOptions) error {
+	before, _ := a.checksum(path)
+	err := a.Workspace.WriteFile(path, content, o)
+	after, size := a.checksum(path)
+	return a.record(&AuditRecord{
+		Op:     "write",
+		Path:   a.locate(path),
+		Before: before,
+		After:  after,
+		Size:   size,
+	}, err)
+}
+
+func (a *AuditWorkspace) EditFile(path string, o *EditOptions) (*EditResult, error) {
+	before, _ := a.checksum(path)
+	result, err := a.Workspace.EditFile(path, o)
+	after, size := a.checksum(path)
+	return result, a.record(&AuditRecord{
+		Op:     "edit",
+		Path:   a.locate(path),
+		Before: before,
+		After:  after,
+		Size:   size,
+	}, err)
+}
+
+func (a *AuditWorkspace) MoveFile(source, destination string) error {
+	src := a.locate(source)
+	before, _ := a.checksum(source)
+	err := a.Workspace.MoveFile(source, destination)
+	after, size := a.checksum(destination)
+	return a.record(&AuditRecord{
+		Op:     "move",
+		Path:   src,
+		Target: a.locate(destination),
+		Before: before,
+		After:  after,
+		Size:   size,
+	}, err)
+}
+
+func (a *AuditWorkspace) CopyFile(source, destination string) error {
+	err := a.Workspace.CopyFile(source, destination)
+	if info, serr := a.Workspace.Stat(destination); err == nil && serr == nil && info.IsDir() {
+		// one record per copied file
+		sums := a.checksums(destination)
+		for _, p := range slices.Sorted(maps.Keys(sums)) {
+			sum := sums[p]
+			if rerr := a.record(&AuditRecord{
+				Op:     "copy",
+				Path:   a.locate(source),
+				Target: p,
+				After:  sum,
+			}, nil); rerr != nil {
+				return rerr
+			}
+		}
+		return nil
+	}
+	after, size := a.checksum(destination)
+	return a.record(&AuditRecord{
+		Op:     "copy",
+		Path:   a.locate(source),
+		Target: a.locate(destination),
+		After:  after,
+		Size:   size,
+	}, err)
+}
+
+func (a *AuditWorkspace) DeleteFile(path string, recursive bool) error {
+	target := a.locate(path)
+	var sums map[string]string
+	if info, err := a.Workspace.Stat(path); err == nil && info.IsDir() && recursive {
+		sums = a.checksums(path)
+	}
+	before, size := a.checksum(path)
+	err := a.Workspace.DeleteFile(path, recursive)
+	if err == nil {
+		// one record per deleted file
+		for _, p := range slices.Sorted(maps.Keys(sums)) {
+			sum := sums[p]
+			if rerr := a.record(&AuditRecord{
+				Op:     "delete",
+				Path:   p,
+				Before: sum,
+			}, nil); rerr != nil {
+				return rerr
+			}
+		}
+	}
+	return a.record(&AuditRecord{
+		Op:     "delete",
+		Path:   target,
+		Before: before,
+		Size:   size,
+	}, err)
+}
+
+func (a *AuditWorkspace) CreateDirectory(path string) error {
+	err := a.Workspace.CreateDirectory(path)
+	return a.record(&AuditRecord{
+		Op:   "mkdir",
+		Path: a.locate(path),
+	}, err)
+}
+
+func (a *AuditWorkspace) OpenFile(path string, flag int, perm fs.FileMode) (File, error) {
+	if !IsWriteFlag(flag) {
+		return a.Workspace.OpenFile(path, flag, perm)
+	}
+	before, size := a.checksum(path)
+	f, err := a.Workspace.OpenFile(path, flag, perm)
+	if rerr := a.record(&AuditRecord{
+		Op:     "open",
+		Path:   a.locate(path),
+		Flag:   flag,
+		Before: before,
+		Size:   size,
+	}, err); rerr != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, rerr
+	}
+	return &auditFile{File: f, a: a, path: path, flag: flag, before: before}, nil
+}
+
+// auditFile records the content written through it when it is closed.
+type auditFile struct {
+	File
+	a      *AuditWorkspace
+	path   string
+	flag   int
+	before string
+	closed sync.Once
+}
+
+func (f *auditFile) Close() error {
+	err := f.File.Close()
+	var rerr error
+	f.closed.Do(func() {
+		after, size := f.a.checksum(f.path)
+		rerr = f.a.record(&AuditRecord{
+			Op:     "close",
+			Path:   f.a.locate(f.path),
+			Flag:   f.flag,
+			Before: f.before,
+			After:  after,
+			Size:   size,
+		}, nil)
+	})
+	return errors.Join(err, rerr)
+}
+
+// VerifyAuditLog checks the sequence and hash chain of the audit log and
+// returns the number of valid records. The error wraps ErrAuditGap or
+// ErrAuditTampered and reports the first offending line.
+func VerifyAuditLog(path string) (int, error) {
+	last, err := verifyAuditLog(path)
+	if last == nil {
+		return 0, err
+	}
+	return int(last.Seq), err
+}
+
+// verifyAuditLog returns the last valid record.
+func verifyAuditLog(path string) (*AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last *AuditRecord
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		b, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(b) == 0 {
+			return last, nil
+		}
+		if err != nil && err != io.EOF {
+			return last, err
+		}
+		if len(b) == 0 || b[len(b)-1] != '\n' {
+			return last, fmt.Errorf("%w: line %d: incomplete record", ErrAuditTampered, line)
+		}
+		b = b[:len(b)-1]
+
+		var r AuditRecord
+		if err := json.Unmarshal(b, &r); err != nil {
+			return last, fmt.Errorf("%w: line %d: %v", ErrAuditTampered, line, err)
+		}
+
+		// any byte level change shows up in the re-encoded form
+		encoded, err := json.Marshal(&r)
+		if err != nil {
+			return last, err
+		}
+		if !bytes.Equal(encoded, b) {
+			return last, fmt.Errorf("%w: line %d: record is not canonical", ErrAuditTampered, line)
+		}
+		hash, err := r.digest()
+		if err != nil {
+			return last, err
+		}
+		if hash != r.Hash {
+			return last, fmt.Errorf("%w: line %d: hash mismatch", ErrAuditTampered, line)
+		}
+
+		var seq int64 = 1
+		var prev string
+		if last != nil {
+			seq = last.Seq + 1
+			prev = last.Hash
+		}
+		if r.Seq != seq {
+			return last, fmt.Errorf("%w: line %d: expected seq %d, got %d", ErrAuditGap, line, seq, r.Seq)
+		}
+		if r.Prev != prev {
+			return last, fmt.Errorf("%w: line %d: chain broken", ErrAuditGap, line)
+		}
+		last = &r
+	}
+}
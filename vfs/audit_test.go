@@ -0,0 +1,282 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newAudit returns an audited workspace over a temporary directory with
+// the files, and the path of its log.
+func newAudit(t *testing.T, files map[string]string) (string, *AuditWorkspace, string) {
+	t.Helper()
+	dir, ws := newLocal(t, files)
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewAuditWorkspace(ws, logPath, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return dir, a, logPath
+}
+
+func readAuditLog(t *testing.T, path string) []*AuditRecord {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*AuditRecord
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		var r AuditRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, &r)
+	}
+	return records
+}
+
+func TestAuditWorkspace(t *testing.T) {
+	dir, a, logPath := newAudit(t, map[string]string{
+		"a.txt":   "one\n",
+		"d/z.txt": "z\n",
+		"d/b.txt": "b\n",
+		"d/m.txt": "m\n",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	if err := a.WriteFile(path("a.txt"), []byte("two\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.EditFile(path("a.txt"), &EditOptions{Find: "two", Replace: "three"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.CopyFile(path("d"), path("e")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.DeleteFile(path("d"), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.MoveFile(path("missing"), path("x")); err == nil {
+		t.Fatal("moved a missing file")
+	}
+
+	n, err := VerifyAuditLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readAuditLog(t, logPath)
+	if n != len(records) {
+		t.Errorf("VerifyAuditLog = %d, want %d", n, len(records))
+	}
+
+	var got []string
+	for _, r := range records {
+		line := r.Op + " " + strings.TrimPrefix(r.Path, dir)
+		if r.Target != "" {
+			line += " " + strings.TrimPrefix(r.Target, dir)
+		}
+		if r.Error != "" {
+			line += " error"
+		}
+		got = append(got, line)
+		if r.Session != "test" {
+			t.Errorf("session = %q", r.Session)
+		}
+	}
+	// the records of the files of a directory are sorted
+	want := []string{
+		"write /a.txt",
+		"edit /a.txt",
+		"copy /d /e/b.txt",
+		"copy /d /e/m.txt",
+		"copy /d /e/z.txt",
+		"delete /d/b.txt",
+		"delete /d/m.txt",
+		"delete /d/z.txt",
+		"delete /d",
+		"move /missing /x error",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if records[0].Before != ContentHash([]byte("one\n")) || records[0].After != ContentHash([]byte("two\n")) {
+		t.Errorf("write checksums = %s, %s", records[0].Before, records[0].After)
+	}
+
+	// a new session resumes the chain
+	a.Close()
+	ws, _ := NewLocalFS([]string{dir})
+	b, err := NewAuditWorkspace(ws, logPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.CreateDirectory(path("f")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := VerifyAuditLog(logPath); err != nil || n != len(records)+1 {
+		t.Errorf("VerifyAuditLog = %d, %v, want %d", n, err, len(records)+1)
+	}
+}
+
+func TestAuditOpenFile(t *testing.T) {
+	dir, a, logPath := newAudit(t, map[string]string{"a.txt": "one\n"})
+	path := filepath.Join(dir, "a.txt")
+
+	f, err := a.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("two\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// closing again is not recorded
+	f.Close()
+	r, err := a.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	records := readAuditLog(t, logPath)
+	if len(records) != 2 || records[0].Op != "open" || records[1].Op != "close" {
+		t.Fatalf("records = %+v, want open and close", records)
+	}
+	before, after := ContentHash([]byte("one\n")), ContentHash([]byte("one\ntwo\n"))
+	if records[0].Before != before || records[0].After != "" {
+		t.Errorf("open checksums = %s, %s, want %s and none", records[0].Before, records[0].After, before)
+	}
+	if c := records[1]; c.Before != before || c.After != after || c.Size != 8 || c.Flag != os.O_WRONLY|os.O_APPEND {
+		t.Errorf("close record = %+v, want %s to %s of 8 bytes", c, before, after)
+	}
+	if _, err := VerifyAuditLog(logPath); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		modify func(lines [][]byte) [][]byte
+		valid  int
+		err    error
+	}{
+		{
+			name:   "intact",
+			modify: func(lines [][]byte) [][]byte { return lines },
+			valid:  4,
+		},
+		{
+			name: "tampered",
+			modify: func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte(`"op":"write"`), []byte(`"op":"erase"`), 1)
+				return lines
+			},
+			valid: 1,
+			err:   ErrAuditTampered,
+		},
+		{
+			name: "rehashed",
+			modify: func(lines [][]byte) [][]byte {
+				var r AuditRecord
+				json.Unmarshal(lines[1], &r)
+				r.Path = "/elsewhere"
+				r.Hash, _ = r.digest()
+				lines[1], _ = json.Marshal(&r)
+				return lines
+			},
+			valid: 2,
+			err:   ErrAuditGap,
+		},
+		{
+			name: "not canonical",
+			modify: func(lines [][]byte) [][]byte {
+				lines[2] = bytes.Replace(lines[2], []byte(`{"seq"`), []byte(`{ "seq"`), 1)
+				return lines
+			},
+			valid: 2,
+			err:   ErrAuditTampered,
+		},
+		{
+			name: "dropped",
+			modify: func(lines [][]byte) [][]byte {
+				return append(lines[:1], lines[2:]...)
+			},
+			valid: 1,
+			err:   ErrAuditGap,
+		},
+		{
+			name: "dropped last",
+			modify: func(lines [][]byte) [][]byte {
+				return lines[:3]
+			},
+			valid: 3,
+		},
+		{
+			name: "reordered",
+			modify: func(lines [][]byte) [][]byte {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			valid: 1,
+			err:   ErrAuditGap,
+		},
+		{
+			name: "truncated",
+			modify: func(lines [][]byte) [][]byte {
+				lines[3] = lines[3][:len(lines[3])/2]
+				return lines
+			},
+			valid: 3,
+			err:   ErrAuditTampered,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, a, logPath := newAudit(t, nil)
+			for _, name := range []string{"1", "2", "3", "4"} {
+				if err := a.WriteFile(filepath.Join(dir, name), []byte(name), nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a.Close()
+
+			data, err := os.ReadFile(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+			lines = tt.modify(lines)
+			data = append(bytes.Join(lines, []byte("\n")), '\n')
+			if tt.name == "truncated" {
+				data = data[:len(data)-1]
+			}
+			if err := os.WriteFile(logPath, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := VerifyAuditLog(logPath)
+			if n != tt.valid || !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+				t.Errorf("VerifyAuditLog = %d, %v, want %d, %v", n, err, tt.valid, tt.err)
+			}
+			// a broken log is not appended to
+			ws, _ := NewLocalFS([]string{dir})
+			if b, err := NewAuditWorkspace(ws, logPath, ""); (err == nil) != (tt.err == nil) {
+				t.Errorf("NewAuditWorkspace error = %v, want %v", err, tt.err)
+			} else if b != nil {
+				b.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,527 @@
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Checkpointer is implemented by workspaces that can roll back changes.
+type Checkpointer interface {
+	// Checkpoint starts a new checkpoint and returns its id.
+	Checkpoint() (string, error)
+	// Rollback restores all files modified since the checkpoint.
+	Rollback(string) error
+	ListCheckpoints() ([]*Checkpoint, error)
+	// DiffCheckpoint returns a unified diff of the changes since the checkpoint.
+	DiffCheckpoint(string) (string, error)
+}
+
+// Checkpoint describes a point the workspace can be rolled back to.
+type Checkpoint struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	// Files modified while the checkpoint was the latest one
+	Files []string `json:"files"`
+}
+
+// snapshot is the state of a path before its first modification in a checkpoint.
+type snapshot struct {
+	Path   string      `json:"path"`
+	Exists bool        `json:"exists"`
+	IsDir  bool        `json:"dir,omitempty"`
+	Mode   fs.FileMode `json:"mode,omitempty"`
+	// content address of the file in the blob store
+	Blob string `json:"blob,omitempty"`
+}
+
+type checkpoint struct {
+	ID        string      `json:"id"`
+	Created   time.Time   `json:"created"`
+	Snapshots []*snapshot `json:"snapshots"`
+}
+
+func (c *checkpoint) lookup(path string) *snapshot {
+	for _, s := range c.Snapshots {
+		if s.Path == path {
+			return s
+		}
+	}
+	return nil
+}
+
+type checkpointIndex struct {
+	Next        int           `json:"next"`
+	Checkpoints []*checkpoint `json:"checkpoints"`
+}
+
+// CheckpointWorkspace wraps a Workspace and saves a copy of every file
+// before its first modification after a checkpoint, so the changes can be
+// reviewed or rolled back. Nothing is saved until the first checkpoint.
+type CheckpointWorkspace struct {
+	Workspace
+
+	// snapshot store
+	dir string
+
+	mu    sync.Mutex
+	index checkpointIndex
+}
+
+// NewCheckpointWorkspace returns a Workspace keeping snapshots of ws in dir.
+// Checkpoints saved in dir by an earlier session are resumed.
+func NewCheckpointWorkspace(ws Workspace, dir string) (*CheckpointWorkspace, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint store: %w", err)
+	}
+	c := &CheckpointWorkspace{
+		Workspace: ws,
+		dir:       dir,
+		index:     checkpointIndex{Next: 1},
+	}
+	data, err := os.ReadFile(c.indexPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &c.index); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint index: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Unwrap returns the underlying workspace.
+func (c *CheckpointWorkspace) Unwrap() Workspace {
+	return c.Workspace
+}
+
+func (c *CheckpointWorkspace) indexPath() string {
+	return filepath.Join(c.dir, "checkpoints.json")
+}
+
+func (c *CheckpointWorkspace) blobPath(blob string) string {
+	return filepath.Join(c.dir, "blobs", blob)
+}
+
+func (c *CheckpointWorkspace) save() error {
+	data, err := json.MarshalIndent(&c.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.indexPath())
+}
+
+func (c *CheckpointWorkspace) current() *checkpoint {
+	if len(c.index.Checkpoints) == 0 {
+		return nil
+	}
+	return c.index.Checkpoints[len(c.index.Checkpoints)-1]
+}
+
+func (c *CheckpointWorkspace) find(id string) (int, error) {
+	for i, cp := range c.index.Checkpoints {
+		if cp.ID == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("checkpoint not found: %s", id)
+}
+
+// snapshot saves the state of path unless it was saved in the current checkpoint.
+func (c *CheckpointWorkspace) snapshot(path string, recursive bool) error {
+	return c.snapshotTree(path, recursive, "")
+}
+
+// snapshotCopy saves the state of the destination of a copy or a move of
+// source: the destination and what it contains, and the paths the entries
+// of a source directory are written to, which may not exist yet.
+func (c *CheckpointWorkspace) snapshotCopy(source, destination string) error {
+	src, err := c.Workspace.Locator(source)
+	if err != nil {
+		src = ""
+	}
+	return c.snapshotTree(destination, true, src)
+}
+
+// snapshotTree saves the state of path and, if recursive, of its entries
+// and of the paths below it matching the entries of the source directory,
+// if any.
+func (c *CheckpointWorkspace) snapshotTree(path string, recursive bool, source string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cp := c.current()
+	if cp == nil {
+		return nil
+	}
+	abs, err := c.Workspace.Locator(path)
+	if err != nil {
+		// let the operation report the invalid path
+		return nil
+	}
+
+	var added bool
+	var walk func(string) error
+	walk = func(p string) error {
+		if cp.lookup(p) == nil {
+			s, err := c.capture(p)
+			if err != nil {
+				return err
+			}
+			cp.Snapshots = append(cp.Snapshots, s)
+			added = true
+		}
+		if !recursive {
+			return nil
+		}
+		info, err := os.Lstat(p)
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := walk(filepath.Join(p, e.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(abs); err != nil {
+		return fmt.Errorf("failed to snapshot %s: %w", path, err)
+	}
+	if info, err := os.Stat(source); source != "" && err == nil && info.IsDir() {
+		err := filepath.WalkDir(source, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || p == source {
+				return nil
+			}
+			rel, _ := filepath.Rel(source, p)
+			dst := filepath.Join(abs, rel)
+			if cp.lookup(dst) != nil {
+				return nil
+			}
+			s, err := c.capture(dst)
+			if err != nil {
+				return err
+			}
+			cp.Snapshots = append(cp.Snapshots, s)
+			added = true
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", path, err)
+		}
+	}
+	if !added {
+		return nil
+	}
+	return c.save()
+}
+
+func (c *CheckpointWorkspace) capture(path string) (*snapshot, error) {
+	s := &snapshot{Path: path}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Exists = true
+	s.Mode = info.Mode()
+	if info.IsDir() {
+		s.IsDir = true
+		return s, nil
+	}
+	if !info.Mode().IsRegular() {
+		// symlinks and devices are left alone on rollback
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	s.Blob = hex.EncodeToString(sum[:])
+	blob := c.blobPath(s.Blob)
+	if _, err := os.Stat(blob); os.IsNotExist(err) {
+		if err := os.WriteFile(blob, data, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// since returns the state of every path modified after checkpoint i was taken.
+func (c *CheckpointWorkspace) since(i int) []*snapshot {
+	seen := make(map[string]bool)
+	var list []*snapshot
+	for _, cp := range c.index.Checkpoints[i:] {
+		for _, s := range cp.Snapshots {
+			if !seen[s.Path] {
+				seen[s.Path] = true
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+func (c *CheckpointWorkspace) Checkpoint() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := strconv.Itoa(c.index.Next)
+	c.index.Next++
+	c.index.Checkpoints = append(c.index.Checkpoints, &checkpoint{
+		ID:      id,
+		Created: time.Now(),
+	})
+	if err := c.save(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (c *CheckpointWorkspace) ListCheckpoints() ([]*Checkpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var list []*Checkpoint
+	for _, cp := range c.index.Checkpoints {
+		files := []string{}
+		for _, s := range cp.Snapshots {
+			files = append(files, s.Path)
+		}
+		sort.Strings(files)
+		list = append(list, &Checkpoint{
+			ID:      cp.ID,
+			Created: cp.Created,
+			Files:   files,
+		})
+	}
+	return list, nil
+}
+
+func (c *CheckpointWorkspace) Rollback(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, err := c.find(id)
+	if err != nil {
+		return err
+	}
+	list := c.since(i)
+
+	// parents before children when restoring, children first when removing
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Path < list[b].Path
+	})
+	for _, s := range list {
+		if !s.Exists {
+			continue
+		}
+		if err := c.restore(s); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", s.Path, err)
+		}
+	}
+	for _, s := range slices.Backward(list) {
+		if s.Exists {
+			continue
+		}
+		if _, err := c.Workspace.Lstat(s.Path); os.IsNotExist(err) {
+			continue
+		}
+		if err := c.Workspace.DeleteFile(s.Path, true); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", s.Path, err)
+		}
+	}
+
+	// the checkpoint starts over from the restored state
+	c.index.Checkpoints = c.index.Checkpoints[:i+1]
+	c.index.Checkpoints[i].Snapshots = nil
+	if err := c.save(); err != nil {
+		return err
+	}
+	return c.prune()
+}
+
+// restore puts back the file or directory of the snapshot through the
+// wrapped workspace, so that its checks apply and the workspaces it wraps
+// record the changes.
+func (c *CheckpointWorkspace) restore(s *snapshot) error {
+	if s.IsDir {
+		info, err := c.Workspace.Lstat(s.Path)
+		if err == nil && info.IsDir() {
+			return nil
+		}
+		if err == nil {
+			if err := c.Workspace.DeleteFile(s.Path, true); err != nil {
+				return err
+			}
+		}
+		if err := c.Workspace.CreateDirectory(s.Path); err != nil {
+			return err
+		}
+		return c.chmod(s.Path, s.Mode)
+	}
+	if s.Blob == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.blobPath(s.Blob))
+	if err != nil {
+		return err
+	}
+	if info, err := c.Workspace.Lstat(s.Path); err == nil && info.IsDir() {
+		if err := c.Workspace.DeleteFile(s.Path, true); err != nil {
+			return err
+		}
+	}
+	if err := c.Workspace.WriteFile(s.Path, data, nil); err != nil {
+		return err
+	}
+	return c.chmod(s.Path, s.Mode)
+}
+
+// chmod sets the permissions of the file at path.
+func (c *CheckpointWorkspace) chmod(path string, mode fs.FileMode) error {
+	f, err := c.Workspace.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Chmod(mode.Perm())
+}
+
+// prune removes blobs no longer referenced by any checkpoint.
+func (c *CheckpointWorkspace) prune() error {
+	used := make(map[string]bool)
+	for _, cp := range c.index.Checkpoints {
+		for _, s := range cp.Snapshots {
+			used[s.Blob] = true
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(c.dir, "blobs"))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !used[e.Name()] {
+			os.Remove(c.blobPath(e.Name()))
+		}
+	}
+	return nil
+}
+
+func (c *CheckpointWorkspace) DiffCheckpoint(id string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, err := c.find(id)
+	if err != nil {
+		return "", err
+	}
+	list := c.since(i)
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Path < list[b].Path
+	})
+
+	var diff string
+	for _, s := range list {
+		if s.IsDir {
+			continue
+		}
+		var before, after string
+		from, to := s.Path, s.Path
+		if s.Blob != "" {
+			data, err := os.ReadFile(c.blobPath(s.Blob))
+			if err != nil {
+				return "", err
+			}
+			before = string(data)
+		} else if !s.Exists {
+			from = "/dev/null"
+		}
+		if info, err := os.Lstat(s.Path); err == nil && info.Mode().IsRegular() {
+			data, err := os.ReadFile(s.Path)
+			if err != nil {
+				return "", err
+			}
+			after = string(data)
+		} else {
+			to = "/dev/null"
+		}
+		diff += UnifiedDiff(from, to, before, after)
+	}
+	return diff, nil
+}
+
+func (c *CheckpointWorkspace) WriteFile(path string, content []byte, o *WriteOptions) error {
+	if err := c.snapshot(path, false); err != nil {
+		return err
+	}
+	return c.Workspace.WriteFile(path, content, o)
+}
+
+func (c *CheckpointWorkspace) EditFile(path string, o *EditOptions) (*EditResult, error) {
+	if err := c.snapshot(path, false); err != nil {
+		return nil, err
+	}
+	return c.Workspace.EditFile(path, o)
+}
+
+func (c *CheckpointWorkspace) MoveFile(source, destination string) error {
+	if err := c.snapshot(source, true); err != nil {
+		return err
+	}
+	if err := c.snapshotCopy(source, destination); err != nil {
+		return err
+	}
+	return c.Workspace.MoveFile(source, destination)
+}
+
+func (c *CheckpointWorkspace) CopyFile(source, destination string) error {
+	if err := c.snapshotCopy(source, destination); err != nil {
+		return err
+	}
+	return c.Workspace.CopyFile(source, destination)
+}
+
+func (c *CheckpointWorkspace) DeleteFile(path string, recursive bool) error {
+	if err := c.snapshot(path, recursive); err != nil {
+		return err
+	}
+	return c.Workspace.DeleteFile(path, recursive)
+}
+
+func (c *CheckpointWorkspace) CreateDirectory(path string) error {
+	if err := c.snapshot(path, false); err != nil {
+		return err
+	}
+	return c.Workspace.CreateDirectory(path)
+}
+
+func (c *CheckpointWorkspace) OpenFile(path string, flag int, perm fs.FileMode) (File, error) {
+	if IsWriteFlag(flag) {
+		if err := c.snapshot(path, false); err != nil {
+			return nil, err
+		}
+	}
+	return c.Workspace.OpenFile(path, flag, perm)
+}
@@ -0,0 +1,288 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newCheckpoint(t *testing.T, files map[string]string) (string, *CheckpointWorkspace, string) {
+	t.Helper()
+	dir, ws := newLocal(t, files)
+	store := t.TempDir()
+	c, err := NewCheckpointWorkspace(ws, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, c, store
+}
+
+// readTree returns the content of the files under dir, directories ending
+// with a slash.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(dir, path)
+		switch {
+		case rel == ".":
+		case d.IsDir():
+			tree[filepath.ToSlash(rel)+"/"] = ""
+		default:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree[filepath.ToSlash(rel)] = string(data)
+		}
+		return nil
+	})
+	return tree
+}
+
+func sameTree(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	for name, content := range want {
+		if g, ok := got[name]; !ok || g != content {
+			t.Errorf("%s = %q, %v, want %q", name, g, ok, content)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s left over", name)
+		}
+	}
+}
+
+func TestCheckpointRollback(t *testing.T) {
+	files := map[string]string{
+		"a.txt":       "one\n",
+		"latin1.txt":  "caf\xe9\n",
+		"utf16.txt":   "\xff\xfeh\x00i\x00\n\x00",
+		"bin":         "\x00\xff\xfe\x01",
+		"ascii.txt":   "plain\n",
+		"d/":          "",
+		"d/x.txt":     "x\n",
+		"d/sub/":      "",
+		"d/sub/y.txt": "y\n",
+		"e/":          "",
+	}
+	dir, c, store := newCheckpoint(t, files)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// nothing is saved before the first checkpoint
+	if err := c.WriteFile(path("a.txt"), []byte("one\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := c.ListCheckpoints(); len(list) != 0 {
+		t.Fatalf("checkpoints = %v", list)
+	}
+
+	id, err := c.Checkpoint()
+	if err != nil || id != "1" {
+		t.Fatalf("Checkpoint = %q, %v", id, err)
+	}
+	steps := []func() error{
+		func() error { return c.WriteFile(path("a.txt"), []byte("two\n"), nil) },
+		func() error { return c.WriteFile(path("a.txt"), []byte("twice\n"), nil) },
+		func() error {
+			_, err := c.EditFile(path("latin1.txt"), &EditOptions{Find: "caf", Replace: "th"})
+			return err
+		},
+		func() error { return c.WriteFile(path("utf16.txt"), []byte("plain\n"), nil) },
+		func() error { return c.WriteFile(path("bin"), []byte{1, 2, 3}, nil) },
+		func() error { return c.WriteFile(path("ascii.txt"), []byte("\xff\xfeo\x00k\x00"), nil) },
+		func() error { return c.WriteFile(path("new.txt"), []byte("n\n"), nil) },
+		func() error { return c.DeleteFile(path("d"), true) },
+		func() error { return c.MoveFile(path("e"), path("f")) },
+		func() error {
+			f, err := c.OpenFile(path("opened"), os.O_CREATE|os.O_WRONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			f.WriteString("o\n")
+			return f.Close()
+		},
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	if err := os.Chmod(path("a.txt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := c.ListCheckpoints()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListCheckpoints = %v, %v", list, err)
+	}
+	var got []string
+	for _, f := range list[0].Files {
+		got = append(got, strings.TrimPrefix(filepath.ToSlash(f), filepath.ToSlash(dir)))
+	}
+	want := "/a.txt /ascii.txt /bin /d /d/sub /d/sub/y.txt /d/x.txt /e /f /latin1.txt /new.txt /opened /utf16.txt"
+	if strings.Join(got, " ") != want {
+		t.Errorf("files = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	// a later checkpoint only rolls back what came after it
+	if id, err := c.Checkpoint(); err != nil || id != "2" {
+		t.Fatalf("Checkpoint = %q, %v", id, err)
+	}
+	if err := c.WriteFile(path("a.txt"), []byte("three\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rollback("2"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path("a.txt")); string(data) != "twice\n" {
+		t.Errorf("a.txt = %q after rollback to 2", data)
+	}
+
+	// checkpoints are resumed from the store
+	ws, _ := NewLocalFS([]string{dir})
+	c, err = NewCheckpointWorkspace(ws, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := c.ListCheckpoints(); len(list) != 2 {
+		t.Fatalf("resumed checkpoints = %d", len(list))
+	}
+	if err := c.Rollback("1"); err != nil {
+		t.Fatal(err)
+	}
+	sameTree(t, readTree(t, dir), files)
+	if info, err := os.Stat(path("a.txt")); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("a.txt mode = %v, %v", info.Mode(), err)
+	}
+	if list, _ := c.ListCheckpoints(); len(list) != 1 || len(list[0].Files) != 0 {
+		t.Errorf("checkpoints after rollback = %v", list)
+	}
+	// unreferenced snapshots are pruned
+	if blobs, _ := os.ReadDir(filepath.Join(store, "blobs")); len(blobs) != 0 {
+		t.Errorf("%d blobs left", len(blobs))
+	}
+
+	if err := c.Rollback("7"); err == nil {
+		t.Error("rolled back to a missing checkpoint")
+	}
+}
+
+func TestDiffCheckpoint(t *testing.T) {
+	dir, c, _ := newCheckpoint(t, map[string]string{
+		"a.txt": "1\n2\n3\n",
+		"b.txt": "gone\n",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	id, err := c.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff, err := c.DiffCheckpoint(id); err != nil || diff != "" {
+		t.Fatalf("DiffCheckpoint = %q, %v", diff, err)
+	}
+	if _, err := c.EditFile(path("a.txt"), &EditOptions{Find: "2", Replace: "two"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteFile(path("b.txt"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteFile(path("c.txt"), []byte("new\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := c.DiffCheckpoint(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- " + path("a.txt") + "\n+++ " + path("a.txt") + "\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n" +
+		"--- " + path("b.txt") + "\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n" +
+		"--- /dev/null\n+++ " + path("c.txt") + "\n@@ -0,0 +1 @@\n+new\n"
+	if diff != want {
+		t.Errorf("DiffCheckpoint =\n%s\nwant:\n%s", diff, want)
+	}
+	if _, err := c.DiffCheckpoint("9"); err == nil {
+		t.Error("diffed a missing checkpoint")
+	}
+}
+
+func TestCheckpointRollbackMerge(t *testing.T) {
+	files := map[string]string{
+		"src/":          "",
+		"src/a.txt":     "new a\n",
+		"src/sub/":      "",
+		"src/sub/b.txt": "new b\n",
+		"dst/":          "",
+		"dst/a.txt":     "old a\n",
+		"dst/keep.txt":  "keep\n",
+	}
+	dir, c, _ := newCheckpoint(t, files)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	id, err := c.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the copy merges into the existing directory
+	if err := c.CopyFile(path("src"), path("dst")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path("dst/sub/b.txt")); string(data) != "new b\n" {
+		t.Fatalf("dst/sub/b.txt = %q after the copy", data)
+	}
+	if err := c.Rollback(id); err != nil {
+		t.Fatal(err)
+	}
+	sameTree(t, readTree(t, dir), files)
+}
+
+func TestCheckpointRollbackAudited(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"a.txt": "one\n", "e/": ""})
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewAuditWorkspace(ws, logPath, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	c, err := NewCheckpointWorkspace(a, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	id, err := c.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteFile(path("a.txt"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteFile(path("e"), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateDirectory(path("d")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rollback(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restores are made through the wrapped workspace
+	var got []string
+	for _, r := range readAuditLog(t, logPath) {
+		got = append(got, r.Op+" "+strings.TrimPrefix(r.Path, dir))
+	}
+	want := "delete /a.txt, delete /e, mkdir /d, write /a.txt, mkdir /e, delete /d"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("records = %s, want %s", strings.Join(got, ", "), want)
+	}
+	if data, _ := os.ReadFile(path("a.txt")); string(data) != "one\n" {
+		t.Errorf("a.txt = %q after rollback", data)
+	}
+}
@@ -0,0 +1,288 @@
+package vfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffLine is a line of a hunk. Kind is ' ' for context, '-' for a line
+// removed from the old content and '+' for a line added in the new one.
+// Text includes the line terminator, except for a last line without one.
+type DiffLine struct {
+	Kind byte   `json:"kind"`
+	Text string `json:"text"`
+}
+
+// DiffHunk is a group of changes with surrounding context.
+// Starts are 1-based line numbers.
+type DiffHunk struct {
+	OldStart int         `json:"oldStart"`
+	OldLines int         `json:"oldLines"`
+	NewStart int         `json:"newStart"`
+	NewLines int         `json:"newLines"`
+	Lines    []*DiffLine `json:"lines"`
+}
+
+// Header returns the "@@ -l,s +l,s @@" line of the hunk.
+func (h *DiffHunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// SplitLines splits content into lines keeping the line terminators.
+func SplitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// DiffHunks compares the old and new lines and returns the differences
+// grouped into hunks with the given number of context lines.
+func DiffHunks(a, b []string, context int) []*DiffHunk {
+	return diffHunks(diffLines(a, b, nil), context, nil)
+}
+
+// diffHunks groups the changes of ops into hunks. The groups of
+// consecutive changes for which ignore is true do not make hunks, they
+// are only shown within the hunks of other changes.
+func diffHunks(ops []diffOp, context int, ignore func([]diffOp) bool) []*DiffHunk {
+	context = min(max(context, 0), len(ops))
+
+	var hunks []*DiffHunk
+	var h *DiffHunk
+	// index of the op after the last change added to the current hunk
+	last := 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		if ignore != nil && ignore(ops[i:j]) {
+			i = j
+			continue
+		}
+		if h != nil && i-last > 2*context {
+			// close the current hunk with trailing context
+			h.add(ops[last:min(last+context, i)])
+			h = nil
+		}
+		if h == nil {
+			start := max(i-context, 0)
+			h = &DiffHunk{
+				OldStart: ops[start].a + 1,
+				NewStart: ops[start].b + 1,
+			}
+			hunks = append(hunks, h)
+			h.add(ops[start:i])
+		} else {
+			h.add(ops[last:i])
+		}
+		h.add(ops[i:j])
+		last, i = j, j
+	}
+	if h != nil {
+		h.add(ops[last:min(last+context, len(ops))])
+	}
+	return hunks
+}
+
+func (h *DiffHunk) add(ops []diffOp) {
+	for _, op := range ops {
+		h.Lines = append(h.Lines, &DiffLine{Kind: op.kind, Text: op.text})
+		switch op.kind {
+		case ' ':
+			h.OldLines++
+			h.NewLines++
+		case '-':
+			h.OldLines++
+		case '+':
+			h.NewLines++
+		}
+	}
+}
+
+// FormatHunks renders hunks in unified diff format with the given file labels.
+// Nothing is returned if there are no hunks.
+func FormatHunks(from, to string, hunks []*DiffHunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+	for _, h := range hunks {
+		sb.WriteString(h.Header())
+		sb.WriteByte('\n')
+		for _, l := range h.Lines {
+			sb.WriteByte(l.Kind)
+			sb.WriteString(l.Text)
+			if !strings.HasSuffix(l.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// UnifiedDiff returns the differences between the old and new content in
+// unified diff format with three lines of context.
+func UnifiedDiff(from, to string, a, b string) string {
+	return FormatHunks(from, to, DiffHunks(SplitLines(a), SplitLines(b), 3))
+}
+
+type diffOp struct {
+	kind byte
+	text string
+	// line index in the old and new content
+	a, b int
+}
+
+// maximum size of the Myers trace before falling back to a plain replace
+const maxDiffTrace = 1 << 25
+
+// diffLines returns the edit script turning a into b using Myers' algorithm.
+// Lines are equal if their keys are, key being nil for the lines
+// themselves.
+func diffLines(a, b []string, key func(string) string) []diffOp {
+	// intern lines so comparisons are cheap
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			if key != nil {
+				l = key(l)
+			}
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	x, y := intern(a), intern(b)
+
+	var ops []diffOp
+	// common prefix
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		ops = append(ops, diffOp{' ', a[pre], pre, pre})
+		pre++
+	}
+	// common suffix
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	ops = append(ops, myers(a, b, x, y, pre, len(x)-suf, pre, len(y)-suf)...)
+
+	for i := suf; i > 0; i-- {
+		ops = append(ops, diffOp{' ', a[len(a)-i], len(a) - i, len(b) - i})
+	}
+	return ops
+}
+
+func myers(a, b []string, x, y []int, a0, a1, b0, b1 int) []diffOp {
+	n, m := a1-a0, b1-b0
+	replace := func() []diffOp {
+		var ops []diffOp
+		for i := a0; i < a1; i++ {
+			ops = append(ops, diffOp{'-', a[i], i, b0})
+		}
+		for j := b0; j < b1; j++ {
+			ops = append(ops, diffOp{'+', b[j], a1, j})
+		}
+		return ops
+	}
+	if n == 0 || m == 0 {
+		return replace()
+	}
+
+	total := n + m
+	off := total
+	v := make([]int, 2*total+2)
+	var trace [][]int
+	for d := 0; d <= total; d++ {
+		if (d+1)*len(v) > maxDiffTrace {
+			return replace()
+		}
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				i = v[off+k+1]
+			} else {
+				i = v[off+k-1] + 1
+			}
+			j := i - k
+			for i < n && j < m && x[a0+i] == y[b0+j] {
+				i++
+				j++
+			}
+			v[off+k] = i
+			if i >= n && j >= m {
+				return backtrack(a, b, trace, off, a0, b0, n, m, d)
+			}
+		}
+	}
+	return replace()
+}
+
+func backtrack(a, b []string, trace [][]int, off, a0, b0, n, m, d int) []diffOp {
+	var rev []diffOp
+	i, j := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := i - j
+		var pk int
+		if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		pi := v[off+pk]
+		pj := pi - pk
+		for i > pi && j > pj {
+			i--
+			j--
+			rev = append(rev, diffOp{' ', a[a0+i], a0 + i, b0 + j})
+		}
+		if i == pi {
+			j--
+			rev = append(rev, diffOp{'+', b[b0+j], a0 + i, b0 + j})
+		} else {
+			i--
+			rev = append(rev, diffOp{'-', a[a0+i], a0 + i, b0 + j})
+		}
+	}
+	for i > 0 && j > 0 {
+		i--
+		j--
+		rev = append(rev, diffOp{' ', a[a0+i], a0 + i, b0 + j})
+	}
+
+	ops := make([]diffOp, len(rev))
+	for i, op := range rev {
+		ops[len(rev)-1-i] = op
+	}
+	return ops
+}
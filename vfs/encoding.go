@@ -0,0 +1,455 @@
+package vfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+	"golang.org/x/text/transform"
+)
+
+// number of leading bytes inspected to detect the encoding of content
+const sniffLen = 8000
+
+// TextEncoding is the character encoding of text content.
+type TextEncoding struct {
+	// Name such as "UTF-8", "UTF-16LE", "ISO-8859-1" or "Shift_JIS"
+	Name string `json:"name"`
+	// The content starts with a byte order mark
+	BOM bool `json:"bom,omitempty"`
+
+	enc encoding.Encoding
+}
+
+func (e *TextEncoding) String() string {
+	if e.BOM {
+		return e.Name + " with BOM"
+	}
+	return e.Name
+}
+
+// UTF8 reports whether the content is UTF-8 without a byte order mark and
+// needs no transcoding.
+func (e *TextEncoding) UTF8() bool {
+	return e.Name == "UTF-8" && !e.BOM
+}
+
+// Decode transcodes the content to UTF-8, dropping the byte order mark.
+func (e *TextEncoding) Decode(content []byte) ([]byte, error) {
+	if e.UTF8() {
+		return content, nil
+	}
+	out, _, err := transform.Bytes(e.enc.NewDecoder(), content)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", e, err)
+	}
+	return out, nil
+}
+
+// Encode transcodes UTF-8 text to the encoding, adding the byte order mark
+// if the encoding has one. It fails if the text has characters the
+// encoding cannot represent.
+func (e *TextEncoding) Encode(text []byte) ([]byte, error) {
+	if e.UTF8() {
+		return text, nil
+	}
+	out, _, err := transform.Bytes(e.enc.NewEncoder(), text)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s: %v", e, err)
+	}
+	return out, nil
+}
+
+// NewReader returns a reader of the content of r transcoded to UTF-8.
+func (e *TextEncoding) NewReader(r io.Reader) io.Reader {
+	if e.UTF8() {
+		return r
+	}
+	return transform.NewReader(r, e.enc.NewDecoder())
+}
+
+var (
+	utf8Encoding = &TextEncoding{Name: "UTF-8", enc: xunicode.UTF8}
+	// ISO-8859-1 decodes any byte sequence and is the fallback for
+	// content that is neither UTF-8 nor valid in a multibyte encoding
+	latin1Encoding = &TextEncoding{Name: "ISO-8859-1", enc: charmap.ISO8859_1}
+
+	// tried in order on content that is not UTF-8
+	multibyteEncodings = []*TextEncoding{
+		{Name: "Shift_JIS", enc: japanese.ShiftJIS},
+		{Name: "EUC-JP", enc: japanese.EUCJP},
+		{Name: "GB18030", enc: simplifiedchinese.GB18030},
+		{Name: "Big5", enc: traditionalchinese.Big5},
+		{Name: "EUC-KR", enc: korean.EUCKR},
+	}
+
+	boms = []struct {
+		bom []byte
+		enc *TextEncoding
+	}{
+		// UTF-32LE first, its BOM starts with the one of UTF-16LE
+		{[]byte{0xff, 0xfe, 0, 0}, &TextEncoding{Name: "UTF-32LE", BOM: true, enc: utf32.UTF32(utf32.LittleEndian, utf32.ExpectBOM)}},
+		{[]byte{0, 0, 0xfe, 0xff}, &TextEncoding{Name: "UTF-32BE", BOM: true, enc: utf32.UTF32(utf32.BigEndian, utf32.ExpectBOM)}},
+		{[]byte{0xef, 0xbb, 0xbf}, &TextEncoding{Name: "UTF-8", BOM: true, enc: xunicode.UTF8BOM}},
+		{[]byte{0xff, 0xfe}, &TextEncoding{Name: "UTF-16LE", BOM: true, enc: xunicode.UTF16(xunicode.LittleEndian, xunicode.ExpectBOM)}},
+		{[]byte{0xfe, 0xff}, &TextEncoding{Name: "UTF-16BE", BOM: true, enc: xunicode.UTF16(xunicode.BigEndian, xunicode.ExpectBOM)}},
+	}
+)
+
+// LookupEncoding returns the encoding by its name or alias, such as
+// "utf-16le", "latin1" or "shift_jis". A "-BOM" suffix selects the
+// variant of a Unicode encoding with a byte order mark.
+func LookupEncoding(name string) (*TextEncoding, error) {
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	bom := strings.HasSuffix(upper, "-BOM")
+	upper = strings.TrimSuffix(upper, "-BOM")
+	for _, b := range boms {
+		if b.enc.Name == upper {
+			if bom {
+				return b.enc, nil
+			}
+			break
+		}
+	}
+	switch upper {
+	case "UTF-8", "UTF8":
+		return utf8Encoding, nil
+	case "UTF-16LE":
+		return &TextEncoding{Name: upper, enc: xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM)}, nil
+	case "UTF-16BE":
+		return &TextEncoding{Name: upper, enc: xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM)}, nil
+	case "UTF-32LE":
+		return &TextEncoding{Name: upper, enc: utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)}, nil
+	case "UTF-32BE":
+		return &TextEncoding{Name: upper, enc: utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)}, nil
+	}
+	if bom {
+		return nil, fmt.Errorf("unsupported encoding %q: only Unicode encodings have a BOM", name)
+	}
+
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported encoding %q", name)
+	}
+	canonical, err := ianaindex.MIME.Name(enc)
+	if err != nil {
+		canonical, _ = ianaindex.IANA.Name(enc)
+	}
+	return &TextEncoding{Name: canonical, enc: enc}, nil
+}
+
+// DetectEncoding guesses the encoding of the content from a byte order
+// mark, UTF-8 validity and the byte sequences of common multibyte
+// encodings, falling back to ISO-8859-1. It returns nil if the content is
+// binary.
+func DetectEncoding(content []byte) *TextEncoding {
+	return detectEncoding(content, false)
+}
+
+// detectEncoding detects the encoding of the content, which is the start
+// of longer content if truncated and may end in an incomplete character.
+func detectEncoding(content []byte, truncated bool) *TextEncoding {
+	for _, b := range boms {
+		if bytes.HasPrefix(content, b.bom) {
+			return b.enc
+		}
+	}
+	if len(content) == 0 {
+		return utf8Encoding
+	}
+	if e := detectUTF16(content); e != nil {
+		return e
+	}
+	if bytes.IndexByte(content, 0) >= 0 || controlRatio(content) > 0.1 {
+		return nil
+	}
+	if valid(content, truncated, utf8.Valid) {
+		return utf8Encoding
+	}
+	if multibyteRatio(content) > 0.5 {
+		// the valid decoding with the most characters of its script
+		var best *TextEncoding
+		var bestScore float64
+		for _, e := range multibyteEncodings {
+			if !valid(content, truncated, e.decodes) {
+				continue
+			}
+			text, _ := e.Decode(content)
+			if score := scriptScore(e.Name, string(text)); best == nil || score > bestScore {
+				best, bestScore = e, score
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return latin1Encoding
+}
+
+// scriptScore returns the share of the non ASCII characters of the text
+// typical of the language of the encoding: kana and kanji of Japanese
+// text with kana, Hangul of Korean and Han characters of Chinese text,
+// which score lower as the others decode to Han characters as well.
+func scriptScore(name, text string) float64 {
+	var n, kana, han, hangul int
+	for _, r := range text {
+		switch {
+		case r < utf8.RuneSelf, 0x3000 <= r && r <= 0x303f, 0xff01 <= r && r <= 0xff5e:
+			// punctuation and full width forms are common to all
+			continue
+		case 0x3040 <= r && r <= 0x30ff:
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		}
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	switch name {
+	case "Shift_JIS", "EUC-JP":
+		if kana == 0 {
+			return 0
+		}
+		return float64(kana+han) / float64(n)
+	case "EUC-KR":
+		return float64(hangul) / float64(n)
+	}
+	return 0.9 * float64(han) / float64(n)
+}
+
+// valid reports whether the content passes the check, ignoring an
+// incomplete character at the end of truncated content.
+func valid(content []byte, truncated bool, check func([]byte) bool) bool {
+	if check(content) {
+		return true
+	}
+	for n := 1; truncated && n <= 3 && n < len(content); n++ {
+		if check(content[:len(content)-n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodes reports whether the content decodes without invalid sequences.
+func (e *TextEncoding) decodes(content []byte) bool {
+	out, _, err := transform.Bytes(e.enc.NewDecoder(), content)
+	return err == nil && !bytes.ContainsRune(out, utf8.RuneError)
+}
+
+// detectUTF16 recognizes UTF-16 without a byte order mark by the zero
+// bytes of ASCII characters.
+func detectUTF16(content []byte) *TextEncoding {
+	if len(content) < 4 {
+		return nil
+	}
+	var even, odd int
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i] == 0 {
+			even++
+		}
+		if content[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(content) / 2
+	switch {
+	case odd*2 > pairs && even*20 < pairs:
+		e, _ := LookupEncoding("UTF-16LE")
+		return e
+	case even*2 > pairs && odd*20 < pairs:
+		e, _ := LookupEncoding("UTF-16BE")
+		return e
+	}
+	return nil
+}
+
+// controlRatio returns the share of control characters other than
+// whitespace, backspace and escape in the content.
+func controlRatio(content []byte) float64 {
+	n := 0
+	for _, c := range content {
+		if c < 0x20 && !strings.ContainsRune("\t\n\v\f\r\b\x1b", rune(c)) || c == 0x7f {
+			n++
+		}
+	}
+	return float64(n) / float64(len(content))
+}
+
+// multibyteRatio returns the share of non ASCII bytes in runs of two or
+// more. Characters of the multibyte encodings mostly take two non ASCII
+// bytes while the accented letters of Latin-1 text are mostly single.
+func multibyteRatio(content []byte) float64 {
+	high, paired := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] < 0x80 {
+			continue
+		}
+		high++
+		if i+1 < len(content) && content[i+1] >= 0x80 {
+			paired += 2
+			high++
+			i++
+		}
+	}
+	if high == 0 {
+		return 0
+	}
+	return float64(paired) / float64(high)
+}
+
+// DetectReader detects the encoding of the content of r from its first
+// bytes, nil if binary, and returns a reader of the whole content.
+func DetectReader(r io.Reader) (io.Reader, *TextEncoding, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	sample, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, nil, err
+	}
+	return br, detectEncoding(sample, err == nil), nil
+}
+
+// DecodeReader returns a reader of the content of r transcoded to UTF-8
+// from the named encoding, or from the detected one if the name is empty
+// or "auto". Binary content is read as is and its encoding is nil.
+func DecodeReader(r io.Reader, name string) (io.Reader, *TextEncoding, error) {
+	if name != "" && name != "auto" {
+		e, err := LookupEncoding(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return e.NewReader(r), e, nil
+	}
+	r, e, err := DetectReader(r)
+	if err != nil || e == nil {
+		return r, nil, err
+	}
+	return e.NewReader(r), e, nil
+}
+
+// Hexdump renders the data in the canonical hex+ASCII format of
+// hexdump -C, with the offsets starting at offset.
+func Hexdump(data []byte, offset int64) string {
+	var sb strings.Builder
+	h := NewHexdumper(&sb, offset)
+	h.Write(data)
+	h.Close()
+	return sb.String()
+}
+
+// NewHexdumper returns a writer rendering the bytes written to it to w in
+// the format of hexdump -C. Close writes the last partial line and the
+// final offset.
+func NewHexdumper(w io.Writer, offset int64) io.WriteCloser {
+	return &hexdumper{w: w, offset: offset}
+}
+
+type hexdumper struct {
+	w      io.Writer
+	offset int64
+	line   [16]byte
+	n      int
+	// the previous line was repeated and elided with "*"
+	prev    [16]byte
+	hasPrev bool
+	starred bool
+}
+
+func (h *hexdumper) Write(p []byte) (int, error) {
+	for i, c := range p {
+		h.line[h.n] = c
+		h.n++
+		if h.n == len(h.line) {
+			if err := h.flush(); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (h *hexdumper) flush() error {
+	full := h.n == len(h.line)
+	if full && h.hasPrev && h.line == h.prev {
+		h.offset += int64(h.n)
+		h.n = 0
+		if h.starred {
+			return nil
+		}
+		h.starred = true
+		_, err := io.WriteString(h.w, "*\n")
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%08x  ", h.offset)
+	for i := range h.line {
+		if i < h.n {
+			fmt.Fprintf(&sb, "%02x ", h.line[i])
+		} else {
+			sb.WriteString("   ")
+		}
+		if i == 7 {
+			sb.WriteByte(' ')
+		}
+	}
+	sb.WriteString(" |")
+	for _, c := range h.line[:h.n] {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteString("|\n")
+
+	h.prev, h.hasPrev, h.starred = h.line, full, false
+	h.offset += int64(h.n)
+	h.n = 0
+	_, err := io.WriteString(h.w, sb.String())
+	return err
+}
+
+func (h *hexdumper) Close() error {
+	if h.n > 0 {
+		if err := h.flush(); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(h.w, "%08x\n", h.offset)
+	return err
+}
+
+// encodeLike transcodes UTF-8 text written over the file at path to the
+// encoding of its current content, keeping the encoding and byte order
+// mark of the file for WriteOptions.EncodeLike. Other content is returned
+// as is.
+func encodeLike(path string, content []byte) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return content, nil
+	}
+	defer f.Close()
+	_, e, err := DetectReader(f)
+	if err != nil || e == nil || e.UTF8() || DetectEncoding(content) != utf8Encoding {
+		return content, nil
+	}
+	return e.Encode(content)
+}
@@ -0,0 +1,254 @@
+package vfs
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MatchGlob reports whether the slash separated name matches the pattern.
+// "*" and "?" do not match "/" and "**" matches any number of directories.
+// Character classes and brace alternatives such as "*.{go,mod}" are
+// supported.
+func MatchGlob(pattern, name string) (bool, error) {
+	re, err := compileGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(name), nil
+}
+
+// compileGlob returns the anchored regexp for the glob.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^" + globRegexp(pattern) + "$")
+}
+
+// globRegexp translates the glob to a regexp without anchors.
+func globRegexp(pattern string) string {
+	var sb strings.Builder
+	braces := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				// "**" must be a whole path element to cross directories
+				start := i == 0 || pattern[i-1] == '/'
+				j := i + 2
+				for j < len(pattern) && pattern[j] == '*' {
+					j++
+				}
+				switch {
+				case start && j < len(pattern) && pattern[j] == '/':
+					sb.WriteString("(?:.*/)?")
+					i = j
+				case start && j == len(pattern):
+					sb.WriteString(".*")
+					i = j - 1
+				default:
+					sb.WriteString("[^/]*")
+					i = j - 1
+				}
+				continue
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := i + 1
+			if j < len(pattern) && (pattern[j] == '!' || pattern[j] == '^') {
+				j++
+			}
+			if j < len(pattern) && pattern[j] == ']' {
+				j++
+			}
+			for j < len(pattern) && pattern[j] != ']' {
+				j++
+			}
+			if j >= len(pattern) {
+				// no closing bracket, match it literally
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : j]
+			sb.WriteByte('[')
+			if class[0] == '!' || class[0] == '^' {
+				sb.WriteByte('^')
+				class = class[1:]
+			}
+			sb.WriteString(strings.ReplaceAll(class, `\`, `\\`))
+			sb.WriteByte(']')
+			i = j
+		case '{':
+			braces++
+			sb.WriteString("(?:")
+		case '}':
+			if braces == 0 {
+				sb.WriteString(`\}`)
+				continue
+			}
+			braces--
+			sb.WriteByte(')')
+		case ',':
+			if braces > 0 {
+				sb.WriteByte('|')
+				continue
+			}
+			sb.WriteByte(',')
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+				continue
+			}
+			sb.WriteString(`\\`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	for ; braces > 0; braces-- {
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
+
+// ignoreRule is one pattern of a .gitignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreList holds the rules of an ignore file, matched against paths
+// relative to the directory of the file.
+type ignoreList struct {
+	// slash separated directory relative to the walk root, "" for the root
+	base  string
+	rules []*ignoreRule
+}
+
+// parseIgnore parses patterns in .gitignore format.
+func parseIgnore(base string, content string) *ignoreList {
+	l := &ignoreList{base: base}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " \t")
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if r := newIgnoreRule(line); r != nil {
+			l.rules = append(l.rules, r)
+		}
+	}
+	return l
+}
+
+func newIgnoreRule(pattern string) *ignoreRule {
+	r := &ignoreRule{}
+	if pattern[0] == '!' {
+		r.negate = true
+		pattern = pattern[1:]
+	} else if pattern[0] == '\\' && len(pattern) > 1 && (pattern[1] == '!' || pattern[1] == '#') {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return nil
+	}
+
+	// a pattern with a slash is relative to the ignore file,
+	// otherwise it matches the name at any level
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	src := globRegexp(pattern)
+	if !anchored {
+		src = "(?:.*/)?" + src
+	}
+	re, err := regexp.Compile("^" + src + "$")
+	if err != nil {
+		return nil
+	}
+	r.re = re
+	return r
+}
+
+// match returns whether the rules ignore (1), include (-1) or do not
+// mention (0) the slash separated path relative to the walk root.
+func (l *ignoreList) match(rel string, isDir bool) int {
+	if l.base != "" {
+		if !strings.HasPrefix(rel, l.base+"/") {
+			return 0
+		}
+		rel = rel[len(l.base)+1:]
+	}
+	for i := len(l.rules) - 1; i >= 0; i-- {
+		r := l.rules[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			if r.negate {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// ignored reports whether the path is ignored by the lists, the deepest
+// list that mentions the path taking precedence.
+func ignored(lists []*ignoreList, rel string, isDir bool) bool {
+	for i := len(lists) - 1; i >= 0; i-- {
+		switch lists[i].match(rel, isDir) {
+		case 1:
+			return true
+		case -1:
+			return false
+		}
+	}
+	return false
+}
+
+// parentRel returns the parent of the slash separated relative path,
+// "" for the root.
+func parentRel(rel string) string {
+	if i := strings.LastIndexByte(rel, '/'); i >= 0 {
+		return rel[:i]
+	}
+	return ""
+}
+
+// joinRel joins the name to the slash separated relative directory.
+func joinRel(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return path.Join(dir, name)
+}
+
+// hasGlobMeta reports whether the path has glob metacharacters.
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[{")
+}
+
+// splitGlob splits the glob into the directory of its leading elements
+// without metacharacters and the slash separated pattern of the rest.
+func splitGlob(pattern string) (dir, rest string) {
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	i := 0
+	for i < len(elems)-1 && !hasGlobMeta(elems[i]) {
+		i++
+	}
+	dir = strings.Join(elems[:i], "/")
+	if dir == "" && i > 0 {
+		dir = "/"
+	}
+	return filepath.FromSlash(dir), strings.Join(elems[i:], "/")
+}
@@ -0,0 +1,392 @@
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// version of the persisted index format
+const indexVersion = 2
+
+// indexFile is the entry of a searched file in the trigram index.
+type indexFile struct {
+	Path    string
+	ModTime int64
+	Size    int64
+	// Binary and oversized files are never searched
+	Binary bool
+	// Sorted trigrams of the lower cased content
+	Trigrams []uint32
+}
+
+type indexData struct {
+	Version int
+	Root    string
+	Files   []*indexFile
+}
+
+// searchIndex maps trigrams to the files of a workspace root containing
+// them. Files are added as they are searched and replaced when their
+// size or modification time changes, so a search only reads the files
+// that may match and the ones not indexed yet.
+type searchIndex struct {
+	mu   sync.Mutex
+	file string
+	root string
+
+	// by id, nil once replaced or removed
+	files    []*indexFile
+	ids      map[string]int32
+	postings map[uint32][]int32
+	dirty    bool
+}
+
+// loadIndex returns the index of root persisted in dir, or an empty one.
+func loadIndex(dir, root string) *searchIndex {
+	sum := sha256.Sum256([]byte(root))
+	x := &searchIndex{
+		file:     filepath.Join(dir, hex.EncodeToString(sum[:8])+".idx"),
+		root:     root,
+		ids:      make(map[string]int32),
+		postings: make(map[uint32][]int32),
+	}
+
+	f, err := os.Open(x.file)
+	if err != nil {
+		return x
+	}
+	defer f.Close()
+	var data indexData
+	if err := gob.NewDecoder(f).Decode(&data); err != nil || data.Version != indexVersion || data.Root != root {
+		// rebuilt as files are searched
+		return x
+	}
+	for _, e := range data.Files {
+		x.insert(e)
+	}
+	return x
+}
+
+// save persists the index if it changed.
+func (x *searchIndex) save() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.dirty {
+		return nil
+	}
+
+	data := indexData{Version: indexVersion, Root: x.root}
+	for _, e := range x.files {
+		if e != nil {
+			data.Files = append(data.Files, e)
+		}
+	}
+	if len(data.Files) < len(x.files)/2 {
+		// drop the postings of replaced entries
+		x.files, x.ids, x.postings = nil, make(map[string]int32), make(map[uint32][]int32)
+		for _, e := range data.Files {
+			x.insert(e)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(x.file), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(x.file), ".idx*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := gob.NewEncoder(f).Encode(&data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), x.file); err != nil {
+		return err
+	}
+	x.dirty = false
+	return nil
+}
+
+func (x *searchIndex) insert(e *indexFile) {
+	if id, ok := x.ids[e.Path]; ok {
+		x.files[id] = nil
+	}
+	id := int32(len(x.files))
+	x.files = append(x.files, e)
+	x.ids[e.Path] = id
+	for _, t := range e.Trigrams {
+		x.postings[t] = append(x.postings[t], id)
+	}
+}
+
+// add indexes the content of the file, nil if it is not searchable.
+func (x *searchIndex) add(path string, info fs.FileInfo, content []byte) {
+	e := &indexFile{
+		Path:    path,
+		ModTime: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+	}
+	if content != nil {
+		e.Trigrams = trigrams(content)
+	} else {
+		e.Binary = true
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.insert(e)
+	x.dirty = true
+}
+
+// remove drops the entries of path and the files under it.
+func (x *searchIndex) remove(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	prefix := path + string(filepath.Separator)
+	for p, id := range x.ids {
+		if p == path || strings.HasPrefix(p, prefix) {
+			x.files[id] = nil
+			delete(x.ids, p)
+			x.dirty = true
+		}
+	}
+}
+
+// indexQuery is the set of candidate files of a search.
+type indexQuery struct {
+	x *searchIndex
+	// ids of the files that may match, all if nil
+	candidates map[int32]bool
+}
+
+func (x *searchIndex) query(re *syntax.Regexp) *indexQuery {
+	q := &indexQuery{x: x}
+	if t := analyzeRegexp(re); t != nil {
+		x.mu.Lock()
+		q.candidates = t.eval(x)
+		x.mu.Unlock()
+	}
+	return q
+}
+
+// skip reports whether the file can be skipped: its entry is up to date
+// and rules out a match.
+func (q *indexQuery) skip(path string, info fs.FileInfo) bool {
+	q.x.mu.Lock()
+	defer q.x.mu.Unlock()
+	id, ok := q.x.ids[path]
+	if !ok {
+		return false
+	}
+	e := q.x.files[id]
+	if e.ModTime != info.ModTime().UnixNano() || e.Size != info.Size() {
+		return false
+	}
+	return e.Binary || q.candidates != nil && !q.candidates[id]
+}
+
+// fresh reports whether the entry of the file is up to date.
+func (q *indexQuery) fresh(path string, info fs.FileInfo) bool {
+	q.x.mu.Lock()
+	defer q.x.mu.Unlock()
+	id, ok := q.x.ids[path]
+	if !ok {
+		return false
+	}
+	e := q.x.files[id]
+	return e.ModTime == info.ModTime().UnixNano() && e.Size == info.Size()
+}
+
+// trigrams returns the sorted distinct trigrams of the lower cased content.
+func trigrams(content []byte) []uint32 {
+	set := make(map[uint32]struct{})
+	var t uint32
+	for i, c := range content {
+		t = (t<<8 | uint32(lowerASCII(c))) & 0xffffff
+		if i >= 2 {
+			set[t] = struct{}{}
+		}
+	}
+	out := make([]uint32, 0, len(set))
+	for t := range set {
+		out = append(out, t)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// trigramQuery is a boolean query of trigrams, nil matching all files.
+type trigramQuery struct {
+	or       bool
+	trigrams []uint32
+	subs     []*trigramQuery
+}
+
+// eval returns the ids of the files satisfying the query.
+func (t *trigramQuery) eval(x *searchIndex) map[int32]bool {
+	var set map[int32]bool
+	and := func(ids []int32) {
+		next := make(map[int32]bool)
+		for _, id := range ids {
+			if set == nil || set[id] {
+				next[id] = true
+			}
+		}
+		set = next
+	}
+	merge := func(s map[int32]bool) {
+		if set == nil {
+			set = make(map[int32]bool)
+		}
+		for id := range s {
+			set[id] = true
+		}
+	}
+	if t.or {
+		for _, sub := range t.subs {
+			merge(sub.eval(x))
+		}
+		if set == nil {
+			set = make(map[int32]bool)
+		}
+		return set
+	}
+	for _, tri := range t.trigrams {
+		and(x.postings[tri])
+	}
+	for _, sub := range t.subs {
+		s := sub.eval(x)
+		ids := make([]int32, 0, len(s))
+		for id := range s {
+			ids = append(ids, id)
+		}
+		and(ids)
+	}
+	return set
+}
+
+// analyzeRegexp returns the trigrams a match of the regexp must contain.
+func analyzeRegexp(re *syntax.Regexp) *trigramQuery {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalQuery(literalRuns(re))
+	case syntax.OpCapture, syntax.OpPlus:
+		return analyzeRegexp(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return analyzeRegexp(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		q := &trigramQuery{}
+		var run string
+		flush := func() {
+			if sub := literalQuery([]string{run}); sub != nil {
+				q.trigrams = append(q.trigrams, sub.trigrams...)
+			}
+			run = ""
+		}
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				runs := literalRuns(sub)
+				// the first and last runs join the neighbors
+				run += runs[0]
+				if len(runs) > 1 {
+					flush()
+					for _, r := range runs[1 : len(runs)-1] {
+						run = r
+						flush()
+					}
+					run = runs[len(runs)-1]
+				}
+				continue
+			}
+			flush()
+			if s := analyzeRegexp(sub); s != nil {
+				q.subs = append(q.subs, s)
+			}
+		}
+		flush()
+		if len(q.trigrams) == 0 && len(q.subs) == 0 {
+			return nil
+		}
+		return q
+	case syntax.OpAlternate:
+		q := &trigramQuery{or: true}
+		for _, sub := range re.Sub {
+			s := analyzeRegexp(sub)
+			if s == nil {
+				return nil
+			}
+			q.subs = append(q.subs, s)
+		}
+		return q
+	}
+	return nil
+}
+
+// literalRuns returns the lower cased text of the literal, split where
+// case folding makes the bytes unknown: for non ASCII letters and the
+// ASCII ones folding to non ASCII letters too, such as k and the Kelvin
+// sign.
+func literalRuns(re *syntax.Regexp) []string {
+	fold := re.Flags&syntax.FoldCase != 0
+	var runs []string
+	var sb strings.Builder
+	for _, r := range re.Rune {
+		if fold && (r >= utf8.RuneSelf || foldsNonASCII(r)) {
+			runs = append(runs, sb.String())
+			sb.Reset()
+			continue
+		}
+		if r < utf8.RuneSelf {
+			sb.WriteByte(lowerASCII(byte(r)))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return append(runs, sb.String())
+}
+
+// foldsNonASCII reports whether a non ASCII rune is equal to r under
+// simple case folding.
+func foldsNonASCII(r rune) bool {
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+func literalQuery(runs []string) *trigramQuery {
+	q := &trigramQuery{}
+	for _, run := range runs {
+		for i := 0; i+3 <= len(run); i++ {
+			q.trigrams = append(q.trigrams, uint32(run[i])<<16|uint32(run[i+1])<<8|uint32(run[i+2]))
+		}
+	}
+	if len(q.trigrams) == 0 {
+		return nil
+	}
+	return q
+}
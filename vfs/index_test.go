@@ -0,0 +1,114 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp/syntax"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchIndexRoundTrip(t *testing.T) {
+	dir, _ := newLocal(t, map[string]string{
+		"ab":       "ab",
+		"empty":    "",
+		"bin":      "hello\x00",
+		"long.txt": "hello world\n",
+		"d/x.go":   "package x\n",
+	})
+	indexDir := t.TempDir()
+	search := func(pattern string) string {
+		t.Helper()
+		// a new workspace loads the index saved by the previous search
+		ws, err := NewLocalFS([]string{dir}, WithIndex(indexDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := ws.SearchFiles(dir, &SearchOptions{Pattern: pattern, Index: true, FilesOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.ReplaceAll(res.String(), dir+string(filepath.Separator), "")
+	}
+
+	for i := range 2 {
+		for pattern, want := range map[string]string{
+			"ab":      "ab\n",
+			"b":       "ab\n",
+			"hello":   "long.txt\n",
+			"package": "d/x.go\n",
+		} {
+			if got := search(pattern); got != want {
+				t.Errorf("search %d for %q = %q, want %q", i, pattern, got, want)
+			}
+		}
+	}
+
+	x := loadIndex(indexDir, dir+string(filepath.Separator))
+	saved := map[string]bool{}
+	for _, e := range x.files {
+		if e != nil {
+			saved[strings.TrimPrefix(e.Path, dir+string(filepath.Separator))] = e.Binary
+		}
+	}
+	want := map[string]bool{"ab": false, "empty": false, "bin": true, "long.txt": false, "d/x.go": false}
+	if !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved entries = %v, want %v", saved, want)
+	}
+
+	re, _ := syntax.Parse("hello", syntax.Perl)
+	q := x.query(re)
+	for name, skip := range map[string]bool{"ab": true, "empty": true, "bin": true, "long.txt": false, "d/x.go": true} {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := q.skip(path, info); got != skip {
+			t.Errorf("skip %s = %v, want %v", name, got, skip)
+		}
+	}
+
+	// changed files are searched again
+	path := filepath.Join(dir, "ab")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	if got := search("hello"); got != "ab\nlong.txt\n" {
+		t.Errorf("search after a change = %q", got)
+	}
+}
+
+func TestSearchIndexFoldCase(t *testing.T) {
+	dir, _ := newLocal(t, map[string]string{
+		// the Kelvin sign and the long s fold to k and s
+		"kelvin.txt": "Kelvin\n",
+		"long-s.txt": "claſſ\n",
+		"other.txt":  "nothing\n",
+	})
+	indexDir := t.TempDir()
+	for i := range 2 {
+		for _, o := range []*SearchOptions{
+			{Pattern: "(?i)kelvin|class", Regexp: true},
+			{Pattern: "KELVIN|CLASS", Regexp: true, IgnoreCase: true},
+		} {
+			// a new workspace loads the index saved by the previous search
+			ws, err := NewLocalFS([]string{dir}, WithIndex(indexDir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.Index, o.FilesOnly = true, true
+			res, err := ws.SearchFiles(dir, o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.ReplaceAll(res.String(), dir+string(filepath.Separator), "")
+			if want := "kelvin.txt\nlong-s.txt\n"; got != want {
+				t.Errorf("search %d for %q = %q, want %q", i, o.Pattern, got, want)
+			}
+		}
+	}
+}
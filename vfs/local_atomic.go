@@ -0,0 +1,96 @@
+package vfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces the file at path with content.
+// The content is written to a temporary file in the same directory, synced
+// and renamed over path, so a crash leaves either the old or the new file.
+// The mode, ownership and extended attributes of an existing file are kept.
+// If backup is not empty, the previous content is kept at path+backup.
+func writeFileAtomic(path string, content []byte, backup string) error {
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	perm := fs.FileMode(0o644)
+	if info != nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("not a regular file: %s", path)
+		}
+		perm = info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	}
+
+	dir, name := filepath.Split(path)
+	f, err := os.CreateTemp(dir, "."+name+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	done := false
+	defer func() {
+		if !done {
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if info != nil {
+		// ownership first, chown clears the setuid and setgid bits
+		if err := copyAttrs(path, tmp, info); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+
+	if backup != "" && info != nil {
+		if err := backupFile(path, path+backup, perm); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	done = true
+
+	// persist the rename
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupFile makes bak refer to the current content of path.
+func backupFile(path, bak string, perm fs.FileMode) error {
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// the link keeps the old inode once path is replaced
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(bak, data, perm)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package vfs
+
+import "io/fs"
+
+// copyAttrs is a no-op where ownership and extended attributes are not supported.
+func copyAttrs(src, dst string, info fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		old    string
+		mode   fs.FileMode
+		backup string
+		want   fs.FileMode
+		bak    string
+	}{
+		{
+			name: "new file",
+			want: 0o644,
+		},
+		{
+			name: "keep mode",
+			old:  "old\n",
+			mode: 0o750,
+			want: 0o750,
+		},
+		{
+			name: "keep setgid",
+			old:  "old\n",
+			mode: 0o755 | fs.ModeSetgid,
+			want: 0o755 | fs.ModeSetgid,
+		},
+		{
+			name:   "backup",
+			old:    "old\n",
+			mode:   0o600,
+			backup: ".bak",
+			want:   0o600,
+			bak:    "old\n",
+		},
+		{
+			name:   "no backup of a new file",
+			backup: ".bak",
+			want:   0o644,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "f")
+			if tt.mode != 0 {
+				if err := os.WriteFile(path, []byte(tt.old), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(path, tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var opts []LocalOption
+			if tt.backup != "" {
+				opts = append(opts, WithBackup(tt.backup))
+			}
+			ws, err := NewLocalFS([]string{dir}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ws.WriteFile(path, []byte("new\n"), nil); err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := os.ReadFile(path); string(data) != "new\n" {
+				t.Errorf("content = %q", data)
+			}
+			if info, err := os.Stat(path); err != nil || info.Mode() != tt.want {
+				t.Errorf("mode = %v, %v, want %v", info.Mode(), err, tt.want)
+			}
+			data, err := os.ReadFile(path + tt.backup)
+			switch {
+			case tt.bak != "" && string(data) != tt.bak:
+				t.Errorf("backup = %q, %v, want %q", data, err, tt.bak)
+			case tt.bak == "" && tt.backup != "" && !os.IsNotExist(err):
+				t.Errorf("backup of a new file: %v", err)
+			}
+
+			// no temporary files are left
+			n := 1
+			if tt.bak != "" {
+				n++
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != n {
+				t.Errorf("%d files left, want %d", len(entries), n)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomicBackupReplaced(t *testing.T) {
+	dir, _ := newLocal(t, map[string]string{"f": "1\n", "f.bak": "stale\n"})
+	ws, err := NewLocalFS([]string{dir}, WithBackup(".bak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "f")
+	for _, content := range []string{"2\n", "3\n"} {
+		if err := ws.WriteFile(path, []byte(content), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ws.EditFile(path, &EditOptions{Find: "3", Replace: "4"}); err != nil {
+		t.Fatal(err)
+	}
+	// the backup is the content before the last change
+	if data, _ := os.ReadFile(path + ".bak"); string(data) != "3\n" {
+		t.Errorf("backup = %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "4\n" {
+		t.Errorf("content = %q", data)
+	}
+}
+
+func TestWriteFileAtomicNotRegular(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"d/": ""})
+	if err := ws.WriteFile(filepath.Join(dir, "d"), []byte("x"), nil); err == nil {
+		t.Error("wrote over a directory")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left", len(entries))
+	}
+}
@@ -0,0 +1,61 @@
+//go:build linux || darwin
+
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWriteFileAtomicXattr(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"f": "old\n"})
+	path := filepath.Join(dir, "f")
+	if err := unix.Setxattr(path, "user.test", []byte("value"), 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+			t.Skipf("xattrs not supported: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	if err := ws.WriteFile(path, []byte("new\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := getxattr(path, "user.test"); err != nil || !bytes.Equal(value, []byte("value")) {
+		t.Errorf("xattr = %q, %v", value, err)
+	}
+}
+
+func TestWriteFileAtomicOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner requires root")
+	}
+	dir, ws := newLocal(t, map[string]string{"f": "old\n"})
+	path := filepath.Join(dir, "f")
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o755|os.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.WriteFile(path, []byte("new\n"), nil); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := info.Sys().(*syscall.Stat_t); st.Uid != 1234 || st.Gid != 5678 {
+		t.Errorf("owner = %d:%d, want 1234:5678", st.Uid, st.Gid)
+	}
+	// chown clears setgid, which must be restored afterwards
+	if info.Mode()&os.ModeSetgid == 0 {
+		t.Errorf("mode = %v, setgid lost", info.Mode())
+	}
+}
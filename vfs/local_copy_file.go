@@ -39,6 +39,8 @@ func (s *LocalFS) CopyFile(
 		return fmt.Errorf("Error creating destination directory: %v", err)
 	}
 
+	defer s.invalidate(validDest)
+
 	// Perform the copy operation based on whether source is a file or directory
 	if srcInfo.IsDir() {
 		// It's a directory, copy recursively
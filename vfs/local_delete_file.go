@@ -19,6 +19,8 @@ func (s *LocalFS) DeleteFile(
 	}
 
 	// Check if path exists
+	defer s.invalidate(validPath)
+
 	info, err := os.Stat(validPath)
 	if os.IsNotExist(err) {
 		return fmt.Errorf("Error: Path does not exist: %s", path)
@@ -0,0 +1,367 @@
+package vfs
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type DiffOptions struct {
+	// Lines of context around the changes, negative for none (default: 3)
+	Context int
+	// Ignore case differences
+	IgnoreCase bool
+	// Ignore changes in the amount of white space
+	IgnoreSpaceChange bool
+	// Ignore all white space
+	IgnoreAllSpace bool
+	// Ignore changes whose lines are all blank
+	IgnoreBlankLines bool
+	// Compare the subdirectories of directories too
+	Recursive bool
+	// Compare a file only in one directory with an empty file
+	NewFile bool
+	// Only report whether the files differ, without the hunks
+	Brief bool
+	// Report the identical files too
+	Identical bool
+}
+
+// The statuses of a FileDiff.
+const (
+	DiffModified  = "modified"
+	DiffAdded     = "added"
+	DiffDeleted   = "deleted"
+	DiffBinary    = "binary"
+	DiffIdentical = "identical"
+	// subdirectories of both directories, not compared
+	DiffCommon = "common"
+	// a file and a directory, or special files
+	DiffMismatch = "mismatch"
+)
+
+// FileDiff is the difference between two files. A file only in one of
+// the directories has only its path set, or both paths with NewFile and
+// the hunks against an empty file.
+type FileDiff struct {
+	OldPath string      `json:"oldPath,omitempty"`
+	NewPath string      `json:"newPath,omitempty"`
+	Status  string      `json:"status"`
+	Hunks   []*DiffHunk `json:"hunks,omitempty"`
+}
+
+type DiffResult struct {
+	Files []*FileDiff `json:"files"`
+}
+
+// String renders the result as a unified diff, with a line for the files
+// without hunks.
+func (r *DiffResult) String() string {
+	var sb strings.Builder
+	for _, f := range r.Files {
+		switch {
+		case f.OldPath == "":
+			fmt.Fprintf(&sb, "Only in %s: %s\n", filepath.Dir(f.NewPath), filepath.Base(f.NewPath))
+		case f.NewPath == "":
+			fmt.Fprintf(&sb, "Only in %s: %s\n", filepath.Dir(f.OldPath), filepath.Base(f.OldPath))
+		case f.Status == DiffBinary:
+			fmt.Fprintf(&sb, "Binary files %s and %s differ\n", f.OldPath, f.NewPath)
+		case f.Status == DiffIdentical:
+			fmt.Fprintf(&sb, "Files %s and %s are identical\n", f.OldPath, f.NewPath)
+		case f.Status == DiffCommon:
+			fmt.Fprintf(&sb, "Common subdirectories: %s and %s\n", f.OldPath, f.NewPath)
+		case f.Status == DiffMismatch:
+			fmt.Fprintf(&sb, "Files %s and %s are of different types\n", f.OldPath, f.NewPath)
+		case len(f.Hunks) == 0:
+			fmt.Fprintf(&sb, "Files %s and %s differ\n", f.OldPath, f.NewPath)
+		default:
+			sb.WriteString(FormatHunks(f.OldPath, f.NewPath, f.Hunks))
+		}
+	}
+	return sb.String()
+}
+
+// Compare two files, or the files of two directories, line by line
+// Parameters:
+// a (required): Old file or directory,
+// b (required): New file or directory; a directory and a file compare
+// the file of the same name in the directory,
+// context (optional): Lines of context around the changes (default: 3),
+// ignoreCase, ignoreSpaceChange, ignoreAllSpace, ignoreBlankLines
+// (optional): Ignore these differences,
+// recursive (optional): Compare subdirectories,
+// newFile (optional): Compare files only in one directory with empty ones
+func (s *LocalFS) Diff(a, b string, o *DiffOptions) (*DiffResult, error) {
+	if o == nil {
+		o = &DiffOptions{}
+	}
+	d := &differ{fs: s, o: o, r: &DiffResult{}}
+
+	validA, err := s.validatePath(a)
+	if err != nil {
+		return nil, err
+	}
+	validB, err := s.validatePath(b)
+	if err != nil {
+		return nil, err
+	}
+	infoA, errA := os.Stat(validA)
+	infoB, errB := os.Stat(validB)
+	switch {
+	case errA == nil && errB == nil:
+	case o.NewFile && os.IsNotExist(errA) && errB == nil && !infoB.IsDir():
+		return d.r, d.file(a, b, false, true)
+	case o.NewFile && os.IsNotExist(errB) && errA == nil && !infoA.IsDir():
+		return d.r, d.file(a, b, true, false)
+	case errA != nil:
+		return nil, errA
+	default:
+		return nil, errB
+	}
+
+	// a directory and a file compare the file of the same name
+	switch {
+	case infoA.IsDir() && !infoB.IsDir():
+		a = filepath.Join(a, filepath.Base(b))
+		return d.r, d.file(a, b, true, true)
+	case !infoA.IsDir() && infoB.IsDir():
+		b = filepath.Join(b, filepath.Base(a))
+		return d.r, d.file(a, b, true, true)
+	case infoA.IsDir():
+		return d.r, d.dir(a, b, true, true)
+	}
+	return d.r, d.file(a, b, true, true)
+}
+
+// differ compares the files of a Diff.
+type differ struct {
+	fs *LocalFS
+	o  *DiffOptions
+	r  *DiffResult
+}
+
+// DiffContent compares the old and new content under the options and
+// returns the differences grouped into hunks.
+func DiffContent(a, b string, o *DiffOptions) []*DiffHunk {
+	context := o.Context
+	if context == 0 {
+		context = 3
+	}
+	key := diffKey(o)
+	ops := diffLines(SplitLines(a), SplitLines(b), key)
+	var ignore func([]diffOp) bool
+	if o.IgnoreBlankLines {
+		ignore = func(ops []diffOp) bool {
+			for _, op := range ops {
+				text := op.text
+				if key != nil {
+					text = key(text)
+				}
+				if strings.TrimRight(text, "\r\n") != "" {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return diffHunks(ops, context, ignore)
+}
+
+// diffKey returns the key making lines equal under the options, nil if
+// lines are compared as they are.
+func diffKey(o *DiffOptions) func(string) string {
+	if !o.IgnoreCase && !o.IgnoreSpaceChange && !o.IgnoreAllSpace {
+		return nil
+	}
+	return func(line string) string {
+		if o.IgnoreCase {
+			line = strings.ToLower(line)
+		}
+		switch {
+		case o.IgnoreAllSpace:
+			line = strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return -1
+				}
+				return r
+			}, line)
+		case o.IgnoreSpaceChange:
+			// runs of white space are one space, none at the end
+			var sb strings.Builder
+			space := false
+			for _, r := range strings.TrimRightFunc(line, unicode.IsSpace) {
+				if unicode.IsSpace(r) {
+					space = true
+					continue
+				}
+				if space {
+					sb.WriteByte(' ')
+					space = false
+				}
+				sb.WriteRune(r)
+			}
+			line = sb.String()
+		}
+		return line
+	}
+}
+
+// read reads a file, empty if it does not exist.
+func (d *differ) read(path string, exists bool) ([]byte, error) {
+	if !exists {
+		return nil, nil
+	}
+	validPath, err := d.fs.validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(validPath)
+}
+
+// file compares two files, one of them missing with NewFile.
+func (d *differ) file(a, b string, existsA, existsB bool) error {
+	dataA, err := d.read(a, existsA)
+	if err != nil {
+		return err
+	}
+	dataB, err := d.read(b, existsB)
+	if err != nil {
+		return err
+	}
+	f := &FileDiff{OldPath: a, NewPath: b, Status: DiffModified}
+	switch {
+	case !existsA:
+		f.Status = DiffAdded
+	case !existsB:
+		f.Status = DiffDeleted
+	}
+	if bytes.Equal(dataA, dataB) && existsA == existsB {
+		if d.o.Identical {
+			f.Status = DiffIdentical
+			d.r.Files = append(d.r.Files, f)
+		}
+		return nil
+	}
+	if isBinary(dataA) || isBinary(dataB) {
+		f.Status = DiffBinary
+		d.r.Files = append(d.r.Files, f)
+		return nil
+	}
+
+	hunks := DiffContent(string(dataA), string(dataB), d.o)
+	if len(hunks) == 0 {
+		if d.o.Identical {
+			f.Status = DiffIdentical
+			d.r.Files = append(d.r.Files, f)
+		}
+		return nil
+	}
+	if !d.o.Brief {
+		f.Hunks = hunks
+	}
+	d.r.Files = append(d.r.Files, f)
+	return nil
+}
+
+// isBinary reports whether the data has a NUL byte near its start.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8192)], 0) >= 0
+}
+
+// dir compares the entries of two directories, one of them missing with
+// NewFile.
+func (d *differ) dir(a, b string, existsA, existsB bool) error {
+	entries := func(path string, exists bool) (map[string]fs.FileInfo, error) {
+		infos := map[string]fs.FileInfo{}
+		if !exists {
+			return infos, nil
+		}
+		validPath, err := d.fs.validatePath(path)
+		if err != nil {
+			return nil, err
+		}
+		list, err := os.ReadDir(validPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			// follow symbolic links
+			info, err := os.Stat(filepath.Join(validPath, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			infos[e.Name()] = info
+		}
+		return infos, nil
+	}
+	infosA, err := entries(a, existsA)
+	if err != nil {
+		return err
+	}
+	infosB, err := entries(b, existsB)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range infosA {
+		names = append(names, name)
+	}
+	for name := range infosB {
+		if _, ok := infosA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		pathA, pathB := filepath.Join(a, name), filepath.Join(b, name)
+		infoA, inA := infosA[name]
+		infoB, inB := infosB[name]
+		var err error
+		switch {
+		case inA && inB:
+			err = d.entry(pathA, pathB, infoA, infoB)
+		case d.o.NewFile && inA && (infoA.Mode().IsRegular() || infoA.IsDir() && d.o.Recursive):
+			if infoA.IsDir() {
+				err = d.dir(pathA, pathB, true, false)
+			} else {
+				err = d.file(pathA, pathB, true, false)
+			}
+		case d.o.NewFile && inB && (infoB.Mode().IsRegular() || infoB.IsDir() && d.o.Recursive):
+			if infoB.IsDir() {
+				err = d.dir(pathA, pathB, false, true)
+			} else {
+				err = d.file(pathA, pathB, false, true)
+			}
+		case inA:
+			d.r.Files = append(d.r.Files, &FileDiff{OldPath: pathA, Status: DiffDeleted})
+		default:
+			d.r.Files = append(d.r.Files, &FileDiff{NewPath: pathB, Status: DiffAdded})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entry compares the entries of the same name of two directories.
+func (d *differ) entry(a, b string, infoA, infoB fs.FileInfo) error {
+	switch {
+	case infoA.IsDir() && infoB.IsDir():
+		if d.o.Recursive {
+			return d.dir(a, b, true, true)
+		}
+		d.r.Files = append(d.r.Files, &FileDiff{OldPath: a, NewPath: b, Status: DiffCommon})
+		return nil
+	case infoA.Mode().IsRegular() && infoB.Mode().IsRegular():
+		return d.file(a, b, true, true)
+	}
+	d.r.Files = append(d.r.Files, &FileDiff{OldPath: a, NewPath: b, Status: DiffMismatch})
+	return nil
+}
@@ -0,0 +1,243 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		a, b  string
+		o     DiffOptions
+		want  string
+	}{
+		{
+			name:  "modified",
+			files: map[string]string{"a": "1\n2\n3\n", "b": "1\nx\n3\n"},
+			a:     "a", b: "b",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n+x\n 3\n",
+		},
+		{
+			name:  "no newline at end of file",
+			files: map[string]string{"a": "1\n2", "b": "1\n2\n"},
+			a:     "a", b: "b",
+			want: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n 1\n-2\n\\ No newline at end of file\n+2\n",
+		},
+		{
+			name:  "context",
+			files: map[string]string{"a": "1\n2\n3\n4\n5\n", "b": "1\n2\nx\n4\n5\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{Context: 1},
+			want: "--- a\n+++ b\n@@ -2,3 +2,3 @@\n 2\n-3\n+x\n 4\n",
+		},
+		{
+			name:  "no context",
+			files: map[string]string{"a": "1\n2\n3\n", "b": "1\nx\n3\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{Context: -1},
+			want: "--- a\n+++ b\n@@ -2 +2 @@\n-2\n+x\n",
+		},
+		{
+			name:  "separate hunks",
+			files: map[string]string{"a": "1\n2\n3\n4\n5\n6\n", "b": "x\n2\n3\n4\n5\ny\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{Context: 1},
+			want: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n-1\n+x\n 2\n@@ -5,2 +5,2 @@\n 5\n-6\n+y\n",
+		},
+		{
+			name:  "added to an empty file",
+			files: map[string]string{"a": "", "b": "1\n"},
+			a:     "a", b: "b",
+			want: "--- a\n+++ b\n@@ -0,0 +1 @@\n+1\n",
+		},
+		{
+			name:  "identical",
+			files: map[string]string{"a": "1\n", "b": "1\n"},
+			a:     "a", b: "b",
+		},
+		{
+			name:  "report identical",
+			files: map[string]string{"a": "1\n", "b": "1\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{Identical: true},
+			want: "Files a and b are identical\n",
+		},
+		{
+			name:  "brief",
+			files: map[string]string{"a": "1\n", "b": "2\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{Brief: true},
+			want: "Files a and b differ\n",
+		},
+		{
+			name:  "binary",
+			files: map[string]string{"a": "1\x00", "b": "2\x00"},
+			a:     "a", b: "b",
+			want: "Binary files a and b differ\n",
+		},
+		{
+			name:  "ignore case",
+			files: map[string]string{"a": "Hello\n", "b": "hELLO\n"},
+			a:     "a", b: "b",
+			o: DiffOptions{IgnoreCase: true},
+		},
+		{
+			name:  "ignore space change",
+			files: map[string]string{"a": "a  b\n", "b": "a\tb \n"},
+			a:     "a", b: "b",
+			o: DiffOptions{IgnoreSpaceChange: true},
+		},
+		{
+			name:  "space change is not all space",
+			files: map[string]string{"a": "ab\n", "b": "a b\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{IgnoreSpaceChange: true},
+			want: "--- a\n+++ b\n@@ -1 +1 @@\n-ab\n+a b\n",
+		},
+		{
+			name:  "ignore all space",
+			files: map[string]string{"a": "ab\n", "b": " a b\n"},
+			a:     "a", b: "b",
+			o: DiffOptions{IgnoreAllSpace: true},
+		},
+		{
+			name:  "ignore blank lines",
+			files: map[string]string{"a": "1\n2\n", "b": "1\n\n2\n\n"},
+			a:     "a", b: "b",
+			o: DiffOptions{IgnoreBlankLines: true},
+		},
+		{
+			name:  "blank lines shown with other changes",
+			files: map[string]string{"a": "1\n2\n", "b": "1\n\nx\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{IgnoreBlankLines: true},
+			want: "--- a\n+++ b\n@@ -1,2 +1,3 @@\n 1\n-2\n+\n+x\n",
+		},
+		{
+			name:  "directory and file",
+			files: map[string]string{"d/f": "1\n", "f": "2\n"},
+			a:     "d", b: "f",
+			want: "--- d/f\n+++ f\n@@ -1 +1 @@\n-1\n+2\n",
+		},
+		{
+			name:  "file and directory",
+			files: map[string]string{"f": "1\n", "d/f": "2\n"},
+			a:     "f", b: "d",
+			want: "--- f\n+++ d/f\n@@ -1 +1 @@\n-1\n+2\n",
+		},
+		{
+			name: "directories",
+			files: map[string]string{
+				"a/same": "1\n", "b/same": "1\n",
+				"a/f": "1\n", "b/f": "2\n",
+				"a/old": "1\n", "b/new": "1\n",
+				"a/sub/f": "1\n", "b/sub/f": "2\n",
+				"a/t": "1\n", "b/t/": "",
+			},
+			a: "a", b: "b",
+			want: "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-1\n+2\n" +
+				"Only in b: new\n" +
+				"Only in a: old\n" +
+				"Common subdirectories: a/sub and b/sub\n" +
+				"Files a/t and b/t are of different types\n",
+		},
+		{
+			name: "recursive",
+			files: map[string]string{
+				"a/sub/f": "1\n", "b/sub/f": "2\n",
+				"a/sub/deep/x": "1\n", "b/other/": "",
+			},
+			a: "a", b: "b",
+			o: DiffOptions{Recursive: true, Brief: true},
+			want: "Only in b: other\n" +
+				"Only in a/sub: deep\n" +
+				"Files a/sub/f and b/sub/f differ\n",
+		},
+		{
+			name: "new file",
+			files: map[string]string{
+				"a/old": "1\n", "b/new": "2\n",
+				"a/sub/f": "3\n", "b/": "",
+			},
+			a: "a", b: "b",
+			o: DiffOptions{NewFile: true, Recursive: true},
+			want: "--- a/new\n+++ b/new\n@@ -0,0 +1 @@\n+2\n" +
+				"--- a/old\n+++ b/old\n@@ -1 +0,0 @@\n-1\n" +
+				"--- a/sub/f\n+++ b/sub/f\n@@ -1 +0,0 @@\n-3\n",
+		},
+		{
+			name:  "missing file as new",
+			files: map[string]string{"b": "1\n"},
+			a:     "a", b: "b",
+			o:    DiffOptions{NewFile: true},
+			want: "--- a\n+++ b\n@@ -0,0 +1 @@\n+1\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := newLocal(t, tt.files)
+			res, err := ws.Diff(filepath.Join(dir, tt.a), filepath.Join(dir, tt.b), &tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.ReplaceAll(res.String(), dir+string(filepath.Separator), ""); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffResult(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		"a/f": "1\n2\n", "b/f": "1\n3\n",
+		"a/old": "", "b/new": "",
+	})
+	res, err := ws.Diff(filepath.Join(dir, "a"), filepath.Join(dir, "b"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*FileDiff{
+		{
+			OldPath: filepath.Join(dir, "a/f"),
+			NewPath: filepath.Join(dir, "b/f"),
+			Status:  DiffModified,
+			Hunks: []*DiffHunk{{
+				OldStart: 1, OldLines: 2, NewStart: 1, NewLines: 2,
+				Lines: []*DiffLine{{' ', "1\n"}, {'-', "2\n"}, {'+', "3\n"}},
+			}},
+		},
+		{NewPath: filepath.Join(dir, "b/new"), Status: DiffAdded},
+		{OldPath: filepath.Join(dir, "a/old"), Status: DiffDeleted},
+	}
+	if !reflect.DeepEqual(res.Files, want) {
+		t.Errorf("got %+v, want %+v", res.Files, want)
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"a": "1\n"})
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "b"), []byte("2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Diff(filepath.Join(dir, "a"), filepath.Join(dir, "none"), nil); !os.IsNotExist(err) {
+		t.Errorf("missing file: error = %v", err)
+	}
+	// only a missing regular file is compared with an empty one
+	if _, err := ws.Diff(filepath.Join(dir, "none"), dir, &DiffOptions{NewFile: true}); !os.IsNotExist(err) {
+		t.Errorf("missing directory: error = %v", err)
+	}
+	if _, err := ws.Diff(filepath.Join(dir, "a"), filepath.Join(outside, "b"), nil); err == nil {
+		t.Error("compared a file outside the allowed directories")
+	}
+	if err := os.Symlink(filepath.Join(outside, "b"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Diff(filepath.Join(dir, "a"), filepath.Join(dir, "link"), nil); err == nil {
+		t.Error("followed a symlink out of the allowed directories")
+	}
+}
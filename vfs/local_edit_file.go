@@ -1,93 +1,329 @@
 package vfs
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"regexp"
 	"strings"
 )
 
+var (
+	// ErrEditConflict is returned when the file does not match the expected hash
+	ErrEditConflict = errors.New("file changed since it was read")
+	// ErrNotUnique is returned when a unique match was required
+	ErrNotUnique = errors.New("match is not unique")
+)
+
 type EditOptions struct {
 	Find           string
 	Replace        string
 	AllOccurrences bool
 	UseRegex       bool
+
+	// Replace only the Nth match, starting at 1. Takes precedence over
+	// AllOccurrences.
+	Occurrence int
+	// Fail unless Find matches exactly once
+	Unique bool
+
+	// Replace lines StartLine through EndLine (1-based, inclusive) with
+	// Replace. EndLine defaults to StartLine. If Find is set, the match is
+	// looked for within the lines instead.
+	StartLine int
+	EndLine   int
+
+	// Insert Replace as new lines after line InsertAfter, 0 for the top.
+	Insert      bool
+	InsertAfter int
+
+	// Reject the edit unless the ContentHash of the raw bytes of the file,
+	// as ReadFile returns them without options, is this, such as the Hash
+	// of the previous edit.
+	ExpectedHash string
+
+	// Character encoding of the file, such as "ISO-8859-1" or
+	// "Shift_JIS", to edit its text as UTF-8. Files with a byte order mark
+	// and UTF-16 without one are transcoded by default, other files are
+	// edited as raw bytes.
+	Encoding string
+}
+
+// LineRange is a 1-based inclusive range of lines of the edited content.
+// End is Start-1 when lines were only removed before Start.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
-// Update file by finding and replacing text using string matching or regex
+type EditResult struct {
+	// Number of replacements made
+	Replacements int `json:"replacements"`
+	// Changed lines of the new content
+	Ranges []*LineRange `json:"ranges"`
+	// ContentHash of the bytes written, the expected hash for a
+	// following edit
+	Hash string `json:"hash"`
+}
+
+// ContentHash returns the hex encoded sha256 of the content.
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Update file by finding and replacing text using string matching or regex,
+// or by replacing or inserting whole lines
 // Parameters:
 // path (required): Path to the file to modify,
-// find (required): Text to search for,
+// find: Text to search for,
 // replace (required): Text to replace with,
-// all_occurrences (optional): Replace all occurrences (default: true),
-// regex (optional): Treat find pattern as regex (default: false)
-// Return replacement count.
+// all_occurrences (optional): Replace all occurrences (default: false),
+// regex (optional): Treat find pattern as regex (default: false),
+// occurrence (optional): Replace the Nth occurrence only,
+// unique (optional): Fail if find does not match exactly once,
+// start_line, end_line (optional): Replace or search the line range,
+// insert, insert_after (optional): Insert lines after the line,
+// expected_hash (optional): Fail if the file changed since it was read
+// Return replacement count and the changed line ranges.
 func (s *LocalFS) EditFile(
 	path string,
 	o *EditOptions,
-) (int, error) {
+) (*EditResult, error) {
 	validPath, err := s.validatePath(path)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
 	// Check if it's a directory
-	if info, err := os.Stat(validPath); err == nil && info.IsDir() {
-		return -1, err
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return nil, err
 	}
-
-	// Check if file exists
-	if _, err := os.Stat(validPath); os.IsNotExist(err) {
-		return -1, err
+	if info.IsDir() {
+		return nil, fmt.Errorf("Error: Cannot edit a directory")
 	}
 
 	// Read file content
 	content, err := os.ReadFile(validPath)
 	if err != nil {
-		return -1, err
+		return nil, err
+	}
+
+	if o.ExpectedHash != "" && ContentHash(content) != o.ExpectedHash {
+		return nil, fmt.Errorf("%w: %s", ErrEditConflict, path)
+	}
+
+	// Edit the text of files in other encodings as UTF-8
+	enc, err := editEncoding(content, o.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	if enc != nil {
+		raw := content
+		if content, err = enc.Decode(raw); err != nil {
+			return nil, err
+		}
+		if back, err := enc.Encode(content); err != nil || !bytes.Equal(back, raw) {
+			return nil, fmt.Errorf("Error: %s is not valid %s", path, enc)
+		}
 	}
 
 	originalContent := string(content)
-	modifiedContent := ""
-	replacementCount := 0
+	edits, err := o.edits(originalContent)
+	if err != nil {
+		return nil, err
+	}
+	modifiedContent, ranges := applyEdits(originalContent, edits)
+
+	modified := []byte(modifiedContent)
+	if enc != nil {
+		if modified, err = enc.Encode(modified); err != nil {
+			return nil, err
+		}
+	}
+	if modifiedContent != originalContent {
+		defer s.invalidate(validPath)
+		if err := writeFileAtomic(validPath, modified, s.backup); err != nil {
+			return nil, err
+		}
+	}
+
+	return &EditResult{
+		Replacements: len(edits),
+		Ranges:       ranges,
+		Hash:         ContentHash(modified),
+	}, nil
+}
+
+// editEncoding returns the encoding of the content to edit as UTF-8, or
+// nil to edit the raw bytes. Unless named, only encodings detected
+// reliably, by a byte order mark or the zero bytes of UTF-16, are used: a
+// guess from the byte values, such as ISO-8859-1 for UTF-8 text with a
+// stray invalid byte, would keep the find text from matching.
+func editEncoding(content []byte, name string) (*TextEncoding, error) {
+	if name != "" {
+		return LookupEncoding(name)
+	}
+	for _, b := range boms {
+		if bytes.HasPrefix(content, b.bom) {
+			return b.enc, nil
+		}
+	}
+	return detectUTF16(content), nil
+}
+
+// textEdit replaces the bytes start to end of the content with text.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// edits returns the non-overlapping edits in order of position.
+func (o *EditOptions) edits(content string) ([]textEdit, error) {
+	if o.Insert || o.StartLine > 0 {
+		return o.lineEdits(content)
+	}
+	if o.Find == "" {
+		return nil, fmt.Errorf("Error: find text is required")
+	}
+	return o.findEdits(content, 0, len(content))
+}
+
+func (o *EditOptions) lineEdits(content string) ([]textEdit, error) {
+	lines := SplitLines(content)
+	// offsets[i] is the offset of line i+1, the last one the content length
+	offsets := make([]int, len(lines)+1)
+	for i, l := range lines {
+		offsets[i+1] = offsets[i] + len(l)
+	}
+	// text as whole lines ending at offset
+	block := func(text string, at int) string {
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if at == len(content) && !strings.HasSuffix(content, "\n") {
+			// keep the missing newline at the end of the file
+			if at > 0 && o.Insert {
+				return "\n" + strings.TrimSuffix(text, "\n")
+			}
+			return strings.TrimSuffix(text, "\n")
+		}
+		return text
+	}
 
-	// Perform the replacement
+	if o.Insert {
+		if o.InsertAfter < 0 || o.InsertAfter > len(lines) {
+			return nil, fmt.Errorf("Error: line %d is out of range (%d lines)", o.InsertAfter, len(lines))
+		}
+		at := offsets[o.InsertAfter]
+		return []textEdit{{at, at, block(o.Replace, at)}}, nil
+	}
+
+	start, end := o.StartLine, o.EndLine
+	if end == 0 {
+		end = start
+	}
+	if start < 1 || end < start || end > len(lines) {
+		return nil, fmt.Errorf("Error: lines %d-%d are out of range (%d lines)", start, end, len(lines))
+	}
+	from, to := offsets[start-1], offsets[end]
+	if o.Find != "" {
+		return o.findEdits(content, from, to)
+	}
+	return []textEdit{{from, to, block(o.Replace, to)}}, nil
+}
+
+// findEdits returns the edits for the matches of Find between from and to.
+func (o *EditOptions) findEdits(content string, from, to int) ([]textEdit, error) {
+	region := content[from:to]
+
+	var edits []textEdit
 	if o.UseRegex {
 		re, err := regexp.Compile(o.Find)
 		if err != nil {
-			return -1, err
-		}
-
-		if o.AllOccurrences {
-			modifiedContent = re.ReplaceAllString(originalContent, o.Replace)
-			replacementCount = len(re.FindAllString(originalContent, -1))
-		} else {
-			matched := re.FindStringIndex(originalContent)
-			if matched != nil {
-				replacementCount = 1
-				modifiedContent = originalContent[:matched[0]] + o.Replace + originalContent[matched[1]:]
-			} else {
-				modifiedContent = originalContent
-				replacementCount = 0
-			}
+			return nil, err
+		}
+		for _, m := range re.FindAllStringSubmatchIndex(region, -1) {
+			text := string(re.ExpandString(nil, o.Replace, region, m))
+			edits = append(edits, textEdit{from + m[0], from + m[1], text})
 		}
 	} else {
-		if o.AllOccurrences {
-			replacementCount = strings.Count(originalContent, o.Find)
-			modifiedContent = strings.ReplaceAll(originalContent, o.Find, o.Replace)
-		} else {
-			if index := strings.Index(originalContent, o.Find); index != -1 {
-				replacementCount = 1
-				modifiedContent = originalContent[:index] + o.Replace + originalContent[index+len(o.Find):]
-			} else {
-				modifiedContent = originalContent
-				replacementCount = 0
+		for i := 0; ; {
+			index := strings.Index(region[i:], o.Find)
+			if index == -1 {
+				break
 			}
+			i += index
+			edits = append(edits, textEdit{from + i, from + i + len(o.Find), o.Replace})
+			i += len(o.Find)
 		}
 	}
 
-	if err := os.WriteFile(validPath, []byte(modifiedContent), 0644); err != nil {
-		return -1, err
+	switch {
+	case o.Unique && len(edits) != 1:
+		return nil, fmt.Errorf("%w: %q matches %d times", ErrNotUnique, o.Find, len(edits))
+	case o.Occurrence > 0:
+		if o.Occurrence > len(edits) {
+			return nil, fmt.Errorf("Error: occurrence %d of %q not found (%d matches)", o.Occurrence, o.Find, len(edits))
+		}
+		return edits[o.Occurrence-1 : o.Occurrence], nil
+	case o.AllOccurrences:
+		return edits, nil
+	case len(edits) > 0:
+		return edits[:1], nil
 	}
+	return nil, nil
+}
 
-	return replacementCount, nil
+// applyEdits returns the edited content and the changed line ranges.
+func applyEdits(content string, edits []textEdit) (string, []*LineRange) {
+	var sb strings.Builder
+	// start of the replaced text in the new content
+	starts := make([]int, len(edits))
+	last := 0
+	for i, e := range edits {
+		sb.WriteString(content[last:e.start])
+		starts[i] = sb.Len()
+		sb.WriteString(e.text)
+		last = e.end
+	}
+	sb.WriteString(content[last:])
+	modified := sb.String()
+
+	var ranges []*LineRange
+	line, pos := 1, 0
+	lineAt := func(off int) int {
+		line += strings.Count(modified[pos:off], "\n")
+		pos = off
+		return line
+	}
+	for i, e := range edits {
+		if e.text == content[e.start:e.end] {
+			continue
+		}
+		at := starts[i]
+		r := &LineRange{Start: lineAt(at)}
+		switch {
+		case e.text != "":
+			r.End = r.Start + strings.Count(e.text[:len(e.text)-1], "\n")
+		case (at == 0 || modified[at-1] == '\n') && (strings.HasSuffix(content[e.start:e.end], "\n") || e.end == len(content)):
+			// whole lines removed
+			r.End = r.Start - 1
+		default:
+			r.End = r.Start
+		}
+		if n := len(ranges); n > 0 && r.Start <= ranges[n-1].End+1 && r.End >= ranges[n-1].End {
+			ranges[n-1].End = r.End
+			continue
+		}
+		if n := len(ranges); n > 0 && r.Start <= ranges[n-1].End {
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return modified, ranges
 }
@@ -0,0 +1,286 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEditFile(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		o       EditOptions
+		want    string
+		n       int
+		ranges  []LineRange
+		err     error
+	}{
+		{
+			name:    "first match",
+			content: "a\nb\na\n",
+			o:       EditOptions{Find: "a", Replace: "x"},
+			want:    "x\nb\na\n",
+			n:       1,
+			ranges:  []LineRange{{1, 1}},
+		},
+		{
+			name:    "all occurrences",
+			content: "a\nb\na\n",
+			o:       EditOptions{Find: "a", Replace: "x", AllOccurrences: true},
+			want:    "x\nb\nx\n",
+			n:       2,
+			ranges:  []LineRange{{1, 1}, {3, 3}},
+		},
+		{
+			name:    "occurrence",
+			content: "a\nb\na\na\n",
+			o:       EditOptions{Find: "a", Replace: "x", Occurrence: 2, AllOccurrences: true},
+			want:    "a\nb\nx\na\n",
+			n:       1,
+			ranges:  []LineRange{{3, 3}},
+		},
+		{
+			name:    "occurrence out of range",
+			content: "a\nb\n",
+			o:       EditOptions{Find: "a", Replace: "x", Occurrence: 2},
+			want:    "a\nb\n",
+			err:     errors.New(""),
+		},
+		{
+			name:    "unique",
+			content: "a\nb\n",
+			o:       EditOptions{Find: "b", Replace: "x", Unique: true},
+			want:    "a\nx\n",
+			n:       1,
+			ranges:  []LineRange{{2, 2}},
+		},
+		{
+			name:    "not unique",
+			content: "a\nb\na\n",
+			o:       EditOptions{Find: "a", Replace: "x", Unique: true},
+			want:    "a\nb\na\n",
+			err:     ErrNotUnique,
+		},
+		{
+			name:    "regex",
+			content: "key=1\nkey=22\n",
+			o:       EditOptions{Find: `key=(\d+)`, Replace: "$1=key", UseRegex: true, AllOccurrences: true},
+			want:    "1=key\n22=key\n",
+			n:       2,
+			ranges:  []LineRange{{1, 2}},
+		},
+		{
+			name:    "multi-line replacement",
+			content: "a\nb\nc\n",
+			o:       EditOptions{Find: "b", Replace: "b1\nb2"},
+			want:    "a\nb1\nb2\nc\n",
+			n:       1,
+			ranges:  []LineRange{{2, 3}},
+		},
+		{
+			name:    "lines",
+			content: "1\n2\n3\n4\n",
+			o:       EditOptions{StartLine: 2, EndLine: 3, Replace: "x"},
+			want:    "1\nx\n4\n",
+			n:       1,
+			ranges:  []LineRange{{2, 2}},
+		},
+		{
+			name:    "find within lines",
+			content: "a\na\na\n",
+			o:       EditOptions{StartLine: 2, EndLine: 3, Find: "a", Replace: "x", AllOccurrences: true},
+			want:    "a\nx\nx\n",
+			n:       2,
+			ranges:  []LineRange{{2, 3}},
+		},
+		{
+			name:    "delete lines",
+			content: "1\n2\n3\n",
+			o:       EditOptions{StartLine: 2},
+			want:    "1\n3\n",
+			n:       1,
+			ranges:  []LineRange{{2, 1}},
+		},
+		{
+			name:    "delete the only line without newline",
+			content: "abc",
+			o:       EditOptions{StartLine: 1},
+			want:    "",
+			n:       1,
+			ranges:  []LineRange{{1, 0}},
+		},
+		{
+			name:    "delete the last line without newline",
+			content: "a\nb",
+			o:       EditOptions{StartLine: 2},
+			want:    "a\n",
+			n:       1,
+			ranges:  []LineRange{{2, 1}},
+		},
+		{
+			name:    "replace the last line without newline",
+			content: "a\nb",
+			o:       EditOptions{StartLine: 2, Replace: "c\n"},
+			want:    "a\nc",
+			n:       1,
+			ranges:  []LineRange{{2, 2}},
+		},
+		{
+			name:    "lines out of range",
+			content: "1\n",
+			o:       EditOptions{StartLine: 1, EndLine: 2},
+			want:    "1\n",
+			err:     errors.New(""),
+		},
+		{
+			name:    "insert at the top",
+			content: "1\n2\n",
+			o:       EditOptions{Insert: true, Replace: "0"},
+			want:    "0\n1\n2\n",
+			n:       1,
+			ranges:  []LineRange{{1, 1}},
+		},
+		{
+			name:    "insert after",
+			content: "1\n2\n",
+			o:       EditOptions{Insert: true, InsertAfter: 1, Replace: "a\nb\n"},
+			want:    "1\na\nb\n2\n",
+			n:       1,
+			ranges:  []LineRange{{2, 3}},
+		},
+		{
+			name:    "insert at the end without newline",
+			content: "1\n2",
+			o:       EditOptions{Insert: true, InsertAfter: 2, Replace: "3"},
+			want:    "1\n2\n3",
+			n:       1,
+			ranges:  []LineRange{{2, 3}},
+		},
+		{
+			name:    "insert out of range",
+			content: "1\n",
+			o:       EditOptions{Insert: true, InsertAfter: 2, Replace: "3"},
+			want:    "1\n",
+			err:     errors.New(""),
+		},
+		{
+			name:    "latin-1",
+			content: "caf\xe9\n",
+			o:       EditOptions{Find: "café", Replace: "thé", Encoding: "latin1"},
+			want:    "th\xe9\n",
+			n:       1,
+			ranges:  []LineRange{{1, 1}},
+		},
+		{
+			name:    "latin-1 not named",
+			content: "caf\xe9\n",
+			o:       EditOptions{Find: "café", Replace: "thé"},
+			want:    "caf\xe9\n",
+		},
+		{
+			name:    "utf-8 with an invalid byte",
+			content: "café\n\xff\n",
+			o:       EditOptions{Find: "café", Replace: "thé"},
+			want:    "thé\n\xff\n",
+			n:       1,
+			ranges:  []LineRange{{1, 1}},
+		},
+		{
+			name:    "utf-16 without bom",
+			content: "c\x00a\x00f\x00\xe9\x00\n\x00",
+			o:       EditOptions{Find: "café", Replace: "thé"},
+			want:    "t\x00h\x00\xe9\x00\n\x00",
+			n:       1,
+			ranges:  []LineRange{{1, 1}},
+		},
+		{
+			name:    "invalid in the named encoding",
+			content: "\x82\n",
+			o:       EditOptions{Find: "x", Encoding: "Shift_JIS"},
+			want:    "\x82\n",
+			err:     errors.New(""),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, ws := newLocal(t, map[string]string{"f": tt.content})
+			path := filepath.Join(dir, "f")
+			res, err := ws.EditFile(path, &tt.o)
+			switch {
+			case tt.err != nil && err == nil:
+				t.Fatal("edit succeeded")
+			case tt.err != nil && tt.err.Error() != "" && !errors.Is(err, tt.err):
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			case tt.err == nil && err != nil:
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(path); string(got) != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			if res.Replacements != tt.n {
+				t.Errorf("replacements = %d, want %d", res.Replacements, tt.n)
+			}
+			var ranges []LineRange
+			for _, r := range res.Ranges {
+				ranges = append(ranges, *r)
+			}
+			if !reflect.DeepEqual(ranges, tt.ranges) {
+				t.Errorf("ranges = %v, want %v", ranges, tt.ranges)
+			}
+		})
+	}
+}
+
+func TestEditFileExpectedHash(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		"utf8.txt":   "a\r\nb\n",
+		"latin1.txt": "caf\xe9\n",
+	})
+	for _, name := range []string{"utf8.txt", "latin1.txt"} {
+		path := filepath.Join(dir, name)
+		raw, err := ws.ReadFile(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ws.EditFile(path, &EditOptions{Find: "x", ExpectedHash: ContentHash(raw)}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+
+		res, err := ws.EditFile(path, &EditOptions{StartLine: 1, Replace: "z", ExpectedHash: ContentHash(raw)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the hash is of the bytes written, as sha256sum reports it
+		written, _ := os.ReadFile(path)
+		if res.Hash != ContentHash(written) {
+			t.Errorf("%s: hash %s is not of the file after the edit", name, res.Hash)
+		}
+		// the old hash no longer matches
+		if _, err := ws.EditFile(path, &EditOptions{Find: "z", ExpectedHash: ContentHash(raw)}); !errors.Is(err, ErrEditConflict) {
+			t.Errorf("%s: error = %v, want %v", name, err, ErrEditConflict)
+		}
+		if _, err := ws.EditFile(path, &EditOptions{Find: "z", ExpectedHash: res.Hash}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// changing only the line endings or the last newline is a conflict
+	for _, content := range []string{"a\nb\n", "a\r\nb\r\n", "a\r\nb"} {
+		path := filepath.Join(dir, "utf8.txt")
+		if err := os.WriteFile(path, []byte("a\r\nb\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		hash := ContentHash([]byte("a\r\nb\n"))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ws.EditFile(path, &EditOptions{Find: "a", Replace: "x", ExpectedHash: hash}); !errors.Is(err, ErrEditConflict) {
+			t.Errorf("%q: error = %v, want %v", content, err, ErrEditConflict)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package vfs
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+type FindOptions struct {
+	// Glob such as "*.go" or "cmd/**/main.go". A pattern with a slash is
+	// matched against the path relative to the root, otherwise against the
+	// name. "**" matches any number of directories. All entries if empty.
+	Pattern string
+	// Type of the entries: "f" for files, "d" for directories and "l" for
+	// symlinks, all if empty
+	Type string
+	// Size range in bytes, no upper limit if MaxSize is zero or less
+	MinSize int64
+	MaxSize int64
+	// Modification time range, ignored if zero
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// Maximum depth below the root, unlimited if zero or less
+	Depth int
+	// Include hidden files and directories
+	Hidden bool
+	// Do not skip the files ignored by .gitignore
+	NoIgnore bool
+	// Skip entries matching these .gitignore style patterns
+	Exclude []string
+	// Follow symlinks
+	Follow bool
+
+	// Sort by "name" (default), "mtime" or "size"
+	SortBy  string
+	Reverse bool
+
+	// Page of the results, Limit defaults to MAX_SEARCH_RESULTS
+	Offset int
+	Limit  int
+}
+
+// FoundFile is an entry found by FindFiles.
+type FoundFile struct {
+	Path     string    `json:"path"`
+	Type     string    `json:"type"` // "file", "directory" or "symlink"
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+type FindResult struct {
+	Files []*FoundFile `json:"files"`
+	// Number of entries found
+	Total int `json:"total"`
+	// Offset of the next page, 0 if this is the last one
+	Next int `json:"next,omitempty"`
+}
+
+// Find files and directories by name, type, size and modification time
+// Parameters:
+// root (required): Directory to search,
+// pattern (optional): Glob of the names or relative paths, with "**" support,
+// type, min_size, max_size, modified_after, modified_before (optional): Filters,
+// depth, hidden, no_ignore, exclude, follow (optional): Traversal,
+// sort_by, reverse, offset, limit (optional): Order and page of the results
+func (s *LocalFS) FindFiles(root string, o *FindOptions) (*FindResult, error) {
+	if o == nil {
+		o = &FindOptions{}
+	}
+	validPath, err := s.validatePath(root)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("Error: The specified path is not a directory: %s", root)
+	}
+
+	match := func(string) bool { return true }
+	if o.Pattern != "" {
+		re, err := compileGlob(strings.TrimPrefix(o.Pattern, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", o.Pattern, err)
+		}
+		match = re.MatchString
+	}
+	byPath := strings.Contains(o.Pattern, "/")
+
+	switch o.Type {
+	case "", "f", "d", "l":
+	default:
+		return nil, fmt.Errorf("invalid type %q, expected f, d or l", o.Type)
+	}
+	var compare func(a, b *FoundFile) int
+	switch o.SortBy {
+	case "", "name":
+		compare = func(a, b *FoundFile) int { return strings.Compare(a.Path, b.Path) }
+	case "mtime":
+		compare = func(a, b *FoundFile) int { return a.Modified.Compare(b.Modified) }
+	case "size":
+		compare = func(a, b *FoundFile) int { return cmp.Compare(a.Size, b.Size) }
+	default:
+		return nil, fmt.Errorf("invalid sort order %q, expected name, mtime or size", o.SortBy)
+	}
+
+	var files []*FoundFile
+	wo := &walkOptions{
+		Depth:    o.Depth,
+		Follow:   o.Follow,
+		Hidden:   o.Hidden,
+		NoIgnore: o.NoIgnore,
+		Exclude:  o.Exclude,
+		Allow:    s.isPathInAllowedDirs,
+	}
+	err = walkFiles(validPath, wo, func(path, rel string, d fs.DirEntry, _ int) error {
+		name := d.Name()
+		if byPath {
+			name = rel
+		}
+		if !match(name) {
+			return nil
+		}
+
+		f := &FoundFile{Path: path}
+		var typ string
+		switch {
+		case d.IsDir():
+			f.Type, typ = "directory", "d"
+		case d.Type()&fs.ModeSymlink != 0:
+			f.Type, typ = "symlink", "l"
+		default:
+			f.Type, typ = "file", "f"
+		}
+		if o.Type != "" && o.Type != typ {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		f.Size = info.Size()
+		f.Modified = info.ModTime()
+		if f.Size < o.MinSize || o.MaxSize > 0 && f.Size > o.MaxSize {
+			return nil
+		}
+		if !o.ModifiedAfter.IsZero() && !f.Modified.After(o.ModifiedAfter) {
+			return nil
+		}
+		if !o.ModifiedBefore.IsZero() && !f.Modified.Before(o.ModifiedBefore) {
+			return nil
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(files, func(a, b *FoundFile) int {
+		if c := compare(a, b); c != 0 {
+			if o.Reverse {
+				return -c
+			}
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	limit := o.Limit
+	if limit <= 0 {
+		limit = MAX_SEARCH_RESULTS
+	}
+	result := &FindResult{Total: len(files)}
+	start := min(max(o.Offset, 0), len(files))
+	end := min(start+limit, len(files))
+	result.Files = files[start:end]
+	if end < len(files) {
+		result.Next = end
+	}
+	return result, nil
+}
@@ -0,0 +1,213 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileGlob(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"*.go", ".go", true},
+		{"ma?n.go", "main.go", true},
+		{"ma?n.go", "ma/n.go", false},
+		{"[mn]ain.go", "nain.go", true},
+		{"[!m]ain.go", "main.go", false},
+		{"[^m]ain.go", "xain.go", true},
+		{"[]]", "]", true},
+		{"[a", "[a", true},
+		{"*.{go,md}", "README.md", true},
+		{"*.{go,md}", "a.txt", false},
+		{"{a,b{c,d}}", "bd", true},
+		{"a}", "a}", true},
+		{"a,b", "a,b", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{"a.b", "axb", false},
+		{"**", "a/b/c", true},
+		{"**/main.go", "main.go", true},
+		{"**/main.go", "cmd/x/main.go", true},
+		{"cmd/**/main.go", "cmd/main.go", true},
+		{"cmd/**/main.go", "cmd/a/b/main.go", true},
+		{"cmd/**", "cmd/a/b", true},
+		{"cmd/**", "cmdx/a", false},
+		{"a**b", "a/b", false},
+		{"a**b", "axyb", true},
+	} {
+		re, err := compileGlob(tt.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", tt.pattern, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.match {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		".gitignore":      "*.log\nbuild/\n",
+		"main.go":         "package main\n",
+		"README.md":       "# readme, longer than the rest\n",
+		"debug.log":       "log\n",
+		"build/out":       "out\n",
+		"cmd/a/main.go":   "package main\n",
+		"cmd/b/b.go":      "package b\n",
+		".hidden/main.go": "package main\n",
+		"empty/":          "",
+	})
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "README.md"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("main.go", filepath.Join(dir, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		o    FindOptions
+		want string
+		next int
+	}{
+		{
+			name: "all",
+			want: "README.md cmd cmd/a cmd/a/main.go cmd/b cmd/b/b.go empty link.go main.go",
+		},
+		{
+			name: "name",
+			o:    FindOptions{Pattern: "*.go"},
+			want: "cmd/a/main.go cmd/b/b.go link.go main.go",
+		},
+		{
+			name: "path",
+			o:    FindOptions{Pattern: "cmd/**/*.go"},
+			want: "cmd/a/main.go cmd/b/b.go",
+		},
+		{
+			name: "anchored path",
+			o:    FindOptions{Pattern: "/*.go"},
+			want: "link.go main.go",
+		},
+		{
+			name: "files",
+			o:    FindOptions{Type: "f", Depth: 1},
+			want: "README.md main.go",
+		},
+		{
+			name: "directories",
+			o:    FindOptions{Type: "d"},
+			want: "cmd cmd/a cmd/b empty",
+		},
+		{
+			name: "symlinks",
+			o:    FindOptions{Type: "l"},
+			want: "link.go",
+		},
+		{
+			name: "followed",
+			o:    FindOptions{Type: "l", Follow: true},
+			want: "",
+		},
+		{
+			name: "hidden and ignored",
+			o:    FindOptions{Pattern: "*.{go,log}", Hidden: true, NoIgnore: true, Type: "f"},
+			want: ".hidden/main.go cmd/a/main.go cmd/b/b.go debug.log main.go",
+		},
+		{
+			name: "exclude",
+			o:    FindOptions{Pattern: "*.go", Exclude: []string{"cmd/a"}},
+			want: "cmd/b/b.go link.go main.go",
+		},
+		{
+			name: "size",
+			o:    FindOptions{Type: "f", MinSize: 11, MaxSize: 13},
+			want: "cmd/a/main.go main.go",
+		},
+		{
+			name: "modified before",
+			o:    FindOptions{Type: "f", ModifiedBefore: time.Now().Add(-time.Minute)},
+			want: "README.md",
+		},
+		{
+			name: "modified after",
+			o:    FindOptions{Type: "f", Depth: 1, ModifiedAfter: time.Now().Add(-time.Minute)},
+			want: "main.go",
+		},
+		{
+			name: "sort by size",
+			o:    FindOptions{Type: "f", SortBy: "size", Reverse: true},
+			want: "README.md cmd/a/main.go main.go cmd/b/b.go",
+		},
+		{
+			name: "page",
+			o:    FindOptions{Pattern: "*.go", Offset: 1, Limit: 2},
+			want: "cmd/b/b.go link.go",
+			next: 3,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ws.FindFiles(dir, &tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range res.Files {
+				got = append(got, strings.TrimPrefix(filepath.ToSlash(f.Path), filepath.ToSlash(dir)+"/"))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("FindFiles = %s, want %s", strings.Join(got, " "), tt.want)
+			}
+			if res.Next != tt.next {
+				t.Errorf("next = %d, want %d", res.Next, tt.next)
+			}
+		})
+	}
+
+	for _, o := range []*FindOptions{{Type: "x"}, {SortBy: "age"}} {
+		if _, err := ws.FindFiles(dir, o); err == nil {
+			t.Errorf("%+v succeeded", o)
+		}
+	}
+	if _, err := ws.FindFiles(filepath.Join(dir, "main.go"), nil); err == nil {
+		t.Error("found files in a file")
+	}
+}
+
+func TestFindFilesSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir, ws := newLocal(t, map[string]string{"d/a.go": ""})
+	for link, target := range map[string]string{
+		"out": outside,
+		"in":  filepath.Join(dir, "d"),
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := ws.FindFiles(dir, &FindOptions{Pattern: "*.go", Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// links out of the allowed directories are not followed
+	var got []string
+	for _, f := range res.Files {
+		got = append(got, strings.TrimPrefix(filepath.ToSlash(f.Path), filepath.ToSlash(dir)+"/"))
+	}
+	if want := "d/a.go in/a.go"; strings.Join(got, " ") != want {
+		t.Errorf("FindFiles = %s, want %s", strings.Join(got, " "), want)
+	}
+}
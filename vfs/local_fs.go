@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // partly adapted from https://github.com/mark3labs/mcp-filesystem-server/tree/main/filesystemserver/handler
@@ -20,12 +21,37 @@ const (
 	MAX_SEARCH_RESULTS = 1000
 	// Maximum file size in bytes to search within (10MB)
 	MAX_SEARCHABLE_SIZE = 10 * 1024 * 1024
+	// Maximum number of entries of a directory tree
+	MAX_TREE_ENTRIES = 1000
+	// Maximum number of bytes of a binary file rendered as a hexdump preview
+	MAX_HEXDUMP_SIZE = 4096
+	// Maximum number of files read by ReadMultipleFiles at once
+	MAX_READ_FILES = 100
 )
 
 // Local fs is a workspace
 type LocalFS struct {
 	// root string
 	allowedDirs []string
+
+	// suffix of the backup kept by WriteFile and EditFile, none if empty
+	backup string
+
+	// directory of the persisted search indexes, indexing is off if empty
+	indexDir string
+	mu       sync.Mutex
+	indexes  map[string]*searchIndex
+}
+
+// LocalOption configures a LocalFS.
+type LocalOption func(*LocalFS)
+
+// WithBackup keeps the previous content of files overwritten by WriteFile
+// and EditFile next to them with the suffix appended, such as ".bak".
+func WithBackup(suffix string) LocalOption {
+	return func(s *LocalFS) {
+		s.backup = suffix
+	}
 }
 
 // func NewLocalFS(root string) Workspace {
@@ -36,7 +62,15 @@ type LocalFS struct {
 // 	}
 // }
 
-func NewLocalFS(allowedDirs []string) (Workspace, error) {
+// WithIndex enables the trigram index for searches with SearchOptions.Index.
+// An index per allowed directory is kept in dir.
+func WithIndex(dir string) LocalOption {
+	return func(s *LocalFS) {
+		s.indexDir = dir
+	}
+}
+
+func NewLocalFS(allowedDirs []string, opts ...LocalOption) (Workspace, error) {
 	// Normalize and validate directories
 	normalized := make([]string, 0, len(allowedDirs))
 	for _, dir := range allowedDirs {
@@ -65,9 +99,13 @@ func NewLocalFS(allowedDirs []string) (Workspace, error) {
 		}
 		normalized = append(normalized, cleanPath)
 	}
-	return &LocalFS{
+	s := &LocalFS{
 		allowedDirs: normalized,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
 }
 
 // func (s *LocalFS) ListDirectory(path string) ([]string, error) {
@@ -173,12 +211,16 @@ func (s *LocalFS) Locator(path string) (string, error) {
 // 	}, nil
 // }
 
-func (s *LocalFS) OpenFile(path string, flag int, perm fs.FileMode) (*os.File, error) {
+func (s *LocalFS) OpenFile(path string, flag int, perm fs.FileMode) (File, error) {
 	validPath, err := s.validatePath(path)
 	if err != nil {
 		return nil, err
 	}
-	return os.OpenFile(validPath, flag, perm)
+	f, err := os.OpenFile(validPath, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 func (s *LocalFS) ReadDir(path string) ([]fs.DirEntry, error) {
@@ -1,12 +1,89 @@
 package vfs
 
 import (
+	"cmp"
 	"fmt"
+	"io/fs"
+	"mime"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 )
 
-func (s *LocalFS) ListDirectory(path string) ([]string, error) {
+type ListOptions struct {
+	// Sort by "name" (default), "mtime", "size" or "type", directories first
+	SortBy  string
+	Reverse bool
+	// Leave out hidden entries
+	SkipHidden bool
+	// List the entries of subdirectories up to Depth levels, unlimited if
+	// zero or less
+	Recursive bool
+	Depth     int
+	// Skip the entries ignored by .gitignore
+	GitIgnore bool
+	// Sniff the content of files for the MIME type instead of going by
+	// the extension
+	DetectMime bool
+
+	// Page of the entries, all if Limit is zero or less
+	Offset int
+	Limit  int
+}
+
+// ListEntry is an entry of a directory listing.
+type ListEntry struct {
+	// Slash separated path relative to the listed directory
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Type     string    `json:"type"` // "file", "directory", "symlink" or "other"
+	Size     int64     `json:"size"`
+	Mode     string    `json:"mode"` // such as "-rw-r--r--"
+	Modified time.Time `json:"modified"`
+	Target   string    `json:"target,omitempty"` // of a symlink
+	Mime     string    `json:"mime,omitempty"`
+}
+
+type ListResult struct {
+	Entries []*ListEntry `json:"entries"`
+	// Number of entries listed
+	Total int `json:"total"`
+	// Offset of the next page, 0 if this is the last one
+	Next int `json:"next,omitempty"`
+}
+
+// String renders the entries one per line:
+// "[DIR]  name (file://...)" or "[FILE] name (file://...) - 12 bytes".
+func (r *ListResult) String() string {
+	var sb strings.Builder
+	for _, e := range r.Entries {
+		resourceURI := PathToResourceURI(e.Path)
+		switch e.Type {
+		case "directory":
+			fmt.Fprintf(&sb, "[DIR]  %s (%s)\n", e.Name, resourceURI)
+		case "symlink":
+			fmt.Fprintf(&sb, "[LINK] %s -> %s (%s)\n", e.Name, e.Target, resourceURI)
+		default:
+			fmt.Fprintf(&sb, "[FILE] %s (%s) - %d bytes\n", e.Name, resourceURI, e.Size)
+		}
+	}
+	return sb.String()
+}
+
+// List the entries of a directory with their metadata
+// Parameters:
+// path (required): Directory to list,
+// sort_by, reverse (optional): Order of the entries (default: name),
+// skip_hidden (optional): Leave out hidden entries,
+// recursive, depth, gitignore (optional): List subdirectories,
+// offset, limit (optional): Page of the entries
+func (s *LocalFS) ListDirectory(path string, o *ListOptions) (*ListResult, error) {
+	if o == nil {
+		o = &ListOptions{}
+	}
+
 	// Handle empty or relative paths like "." or "./" by converting to absolute path
 	if path == "." || path == "./" {
 		// Get current working directory
@@ -32,28 +109,99 @@ func (s *LocalFS) ListDirectory(path string) ([]string, error) {
 		return nil, fmt.Errorf("Error: Path is not a directory")
 	}
 
-	entries, err := os.ReadDir(validPath)
-	if err != nil {
-		return nil, fmt.Errorf("Error reading directory: %v", err)
+	var compare func(a, b *ListEntry) int
+	switch o.SortBy {
+	case "", "name":
+		compare = func(a, b *ListEntry) int { return 0 }
+	case "mtime":
+		compare = func(a, b *ListEntry) int { return a.Modified.Compare(b.Modified) }
+	case "size":
+		compare = func(a, b *ListEntry) int { return cmp.Compare(a.Size, b.Size) }
+	case "type":
+		rank := func(e *ListEntry) string {
+			if e.Type == "directory" {
+				return ""
+			}
+			return e.Type
+		}
+		compare = func(a, b *ListEntry) int { return strings.Compare(rank(a), rank(b)) }
+	default:
+		return nil, fmt.Errorf("invalid sort order %q, expected name, mtime, size or type", o.SortBy)
 	}
 
-	var result []string
-	for _, entry := range entries {
-		entryPath := filepath.Join(validPath, entry.Name())
-		resourceURI := PathToResourceURI(entryPath)
-
-		if entry.IsDir() {
-			result = append(result, fmt.Sprintf("[DIR]  %s (%s)\n", entry.Name(), resourceURI))
-		} else {
-			info, err := entry.Info()
-			if err == nil {
-				result = append(result, fmt.Sprintf("[FILE] %s (%s) - %d bytes\n",
-					entry.Name(), resourceURI, info.Size()))
+	depth := 1
+	if o.Recursive {
+		depth = o.Depth
+	}
+	var readErr error
+	wo := &walkOptions{
+		Depth:    depth,
+		Hidden:   !o.SkipHidden,
+		NoIgnore: !o.GitIgnore,
+		OnError: func(_, rel string, err error) {
+			if rel == "" {
+				readErr = err
+			}
+		},
+	}
+	var entries []*ListEntry
+	err = walkFiles(validPath, wo, func(p, rel string, d fs.DirEntry, _ int) error {
+		e := &ListEntry{
+			Name: rel,
+			Path: p,
+		}
+		info, err := d.Info()
+		if err == nil {
+			e.Size = info.Size()
+			e.Mode = info.Mode().String()
+			e.Modified = info.ModTime()
+		}
+		switch {
+		case d.IsDir():
+			e.Type = "directory"
+		case d.Type()&fs.ModeSymlink != 0:
+			e.Type = "symlink"
+			e.Target, _ = os.Readlink(p)
+		case d.Type().IsRegular():
+			e.Type = "file"
+			if o.DetectMime {
+				e.Mime = DetectMimeType(p)
 			} else {
-				result = append(result, fmt.Sprintf("[FILE] %s (%s)\n", entry.Name(), resourceURI))
+				e.Mime = mime.TypeByExtension(filepath.Ext(p))
 			}
+		default:
+			e.Type = "other"
 		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading directory: %v", err)
 	}
 
+	slices.SortStableFunc(entries, func(a, b *ListEntry) int {
+		c := compare(a, b)
+		if c == 0 {
+			c = strings.Compare(a.Name, b.Name)
+		}
+		if o.Reverse {
+			return -c
+		}
+		return c
+	})
+
+	result := &ListResult{Total: len(entries)}
+	start := min(max(o.Offset, 0), len(entries))
+	end := len(entries)
+	if o.Limit > 0 {
+		end = min(start+o.Limit, len(entries))
+	}
+	result.Entries = entries[start:end]
+	if end < len(entries) {
+		result.Next = end
+	}
 	return result, nil
 }
@@ -0,0 +1,125 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListDirectory(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		".gitignore":  "*.log\n",
+		".git/HEAD":   "ref\n",
+		".env":        "x=1\n",
+		"a.txt":       "aaa\n",
+		"b.log":       "b\n",
+		"c.json":      "{}\n",
+		"d/e.txt":     "e\n",
+		"d/f/g.txt":   "g\n",
+		"d/f/.hidden": "h\n",
+	})
+	for i, name := range []string{"c.json", "a.txt", "b.log", "d"} {
+		mtime := time.Now().Add(time.Duration(i-4) * time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		o    *ListOptions
+		want string
+		next int
+	}{
+		{
+			name: "everything by default",
+			want: ".env .git .gitignore a.txt b.log c.json d link",
+		},
+		{
+			name: "skip hidden",
+			o:    &ListOptions{SkipHidden: true},
+			want: "a.txt b.log c.json d link",
+		},
+		{
+			name: "gitignore",
+			o:    &ListOptions{SkipHidden: true, GitIgnore: true},
+			want: "a.txt c.json d link",
+		},
+		{
+			name: "recursive",
+			o:    &ListOptions{SkipHidden: true, Recursive: true},
+			want: "a.txt b.log c.json d d/e.txt d/f d/f/g.txt link",
+		},
+		{
+			name: "recursive with hidden",
+			o:    &ListOptions{Recursive: true, Depth: 2},
+			want: ".env .git .git/HEAD .gitignore a.txt b.log c.json d d/e.txt d/f link",
+		},
+		{
+			name: "by size",
+			o:    &ListOptions{SkipHidden: true, SortBy: "size", Reverse: true},
+			want: "d link a.txt c.json b.log",
+		},
+		{
+			name: "by mtime",
+			o:    &ListOptions{SkipHidden: true, SortBy: "mtime"},
+			want: "c.json a.txt b.log d link",
+		},
+		{
+			name: "by type",
+			o:    &ListOptions{SkipHidden: true, SortBy: "type"},
+			want: "d a.txt b.log c.json link",
+		},
+		{
+			name: "page",
+			o:    &ListOptions{SkipHidden: true, Offset: 1, Limit: 2},
+			want: "b.log c.json",
+			next: 3,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ws.ListDirectory(dir, tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range res.Entries {
+				got = append(got, e.Name)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ListDirectory = %s, want %s", strings.Join(got, " "), tt.want)
+			}
+			if res.Next != tt.next {
+				t.Errorf("next = %d, want %d", res.Next, tt.next)
+			}
+		})
+	}
+
+	res, err := ws.ListDirectory(dir, &ListOptions{SkipHidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, link := res.Entries[0], res.Entries[4]
+	if a.Type != "file" || a.Size != 4 || a.Mode != "-rw-r--r--" || a.Mime != "text/plain; charset=utf-8" {
+		t.Errorf("a.txt = %+v", a)
+	}
+	if link.Type != "symlink" || link.Target != "a.txt" {
+		t.Errorf("link = %+v", link)
+	}
+	want := "[FILE] a.txt (" + PathToResourceURI(a.Path) + ") - 4 bytes\n"
+	if s := res.String(); !strings.HasPrefix(s, want) || !strings.Contains(s, "[DIR]  d (") || !strings.Contains(s, "[LINK] link -> a.txt (") {
+		t.Errorf("String =\n%s", s)
+	}
+
+	if _, err := ws.ListDirectory(dir, &ListOptions{SortBy: "name,size"}); err == nil {
+		t.Error("listed with an invalid sort order")
+	}
+	if _, err := ws.ListDirectory(filepath.Join(dir, "a.txt"), nil); err == nil {
+		t.Error("listed a file")
+	}
+}
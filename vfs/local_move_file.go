@@ -55,6 +55,7 @@ func (s *LocalFS) MoveFile(source, destination string) error {
 		return fmt.Errorf("Error with destination path: %v", err)
 	}
 
+	defer s.invalidate(validSource, validDest)
 	if err := os.Rename(validSource, validDest); err != nil {
 		return fmt.Errorf("Error moving file: %v", err)
 	}
@@ -2,6 +2,7 @@ package vfs
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -14,6 +15,10 @@ const (
 	lineNumWidth = 4  // Define this based on your Python configuration
 )
 
+// ErrEmptyFile is returned instead of content when a file read with
+// options has none.
+var ErrEmptyFile = errors.New("file is empty")
+
 type ReadOptions struct {
 	// Number the output lines, starting at 1. (cat -n style).
 	Number bool
@@ -23,81 +28,225 @@ type ReadOptions struct {
 
 	// Maximum number of lines to read. Return the entire file if zero or less
 	Limit int
+
+	// Read raw bytes from ByteOffset instead of lines, at most ByteLength
+	// of them if greater than zero. Byte mode is used if either is set.
+	ByteOffset int64
+	ByteLength int64
+
+	// Character encoding of the lines, such as "Shift_JIS" or "UTF-16LE",
+	// detected if empty or "auto". Lines are transcoded to UTF-8 without a
+	// byte order mark. Byte ranges are read as is.
+	Encoding string
+
+	// Render binary content, or the byte range in byte mode, as a hexdump
+	// of at most MAX_HEXDUMP_SIZE bytes unless ByteLength is set.
+	Hexdump bool
+}
+
+func (o *ReadOptions) bytes() bool {
+	return o.ByteOffset > 0 || o.ByteLength > 0
 }
 
 // ReadFile read raw bytes or content with line numbers if option is provided.
 // path: Absolute or relative file path
 // offset: Line offset to start reading from (0-indexed)
 // limit: Maximum number of lines to read
+// byte_offset, byte_length: Byte range to read instead of lines
+// encoding: Character encoding of the lines (default: detected)
+// hexdump: Hexdump preview of binary content or of the byte range
 // Returns:
-// Formatted file content with line numbers.
+// Formatted file content with line numbers, ErrEmptyFile if the file is empty.
 func (s *LocalFS) ReadFile(path string, o *ReadOptions) ([]byte, error) {
-	validPath, err := s.validatePath(path)
+	if o == nil {
+		validPath, err := s.validatePath(path)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(validPath)
+	}
+
+	r, err := s.OpenReader(path, o)
 	if err != nil {
 		return nil, err
 	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
 
+// OpenReader returns a reader streaming the content ReadFile would return.
+// Lines of any length are read without loading the whole file, transcoded
+// to UTF-8, and carriage returns of CRLF line endings are dropped.
+func (s *LocalFS) OpenReader(path string, o *ReadOptions) (io.ReadCloser, error) {
+	validPath, err := s.validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(validPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file '%s': %v", path, err)
+	}
 	if o == nil {
-		return os.ReadFile(validPath)
+		return file, nil
 	}
 
-	offset := max(o.Offset, 0)
-	limit := o.Limit
-	if limit <= 0 {
-		limit = math.MaxInt
+	if !o.bytes() {
+		r, enc, err := DecodeReader(file, o.Encoding)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if enc == nil && o.Hexdump {
+			return hexdumpPreview(file, r, 0, MAX_HEXDUMP_SIZE)
+		}
+		return &readCloser{NewLineReader(r, o), file}, nil
 	}
 
-	lines, err := readFile(validPath, o.Number, offset, limit)
+	info, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
-	return []byte(lines), nil
+	switch {
+	case info.Size() == 0:
+		file.Close()
+		return nil, ErrEmptyFile
+	case o.ByteOffset < 0 || o.ByteOffset >= info.Size():
+		file.Close()
+		return nil, fmt.Errorf("error: byte offset %d exceeds file size (%d bytes)", o.ByteOffset, info.Size())
+	}
+	length := info.Size() - o.ByteOffset
+	if o.ByteLength > 0 {
+		length = min(length, o.ByteLength)
+	}
+	section := io.NewSectionReader(file, o.ByteOffset, length)
+	if o.Hexdump {
+		limit := int64(MAX_HEXDUMP_SIZE)
+		if o.ByteLength > 0 {
+			limit = o.ByteLength
+		}
+		return hexdumpPreview(file, section, o.ByteOffset, limit)
+	}
+	return &readCloser{section, file}, nil
 }
 
-func readFile(path string, number bool, offset int, limit int) (string, error) {
-	file, err := os.Open(path)
+// hexdumpPreview renders at most limit bytes of the file read from r as a
+// hexdump, noting the number of bytes left out.
+func hexdumpPreview(file *os.File, r io.Reader, offset, limit int64) (io.ReadCloser, error) {
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(r, limit))
 	if err != nil {
-		return "", fmt.Errorf("error opening file '%s': %v", path, err)
+		return nil, err
 	}
-	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyFile
+	}
+	preview := Hexdump(data, offset)
+	if rest := info.Size() - offset - int64(len(data)); rest > 0 && int64(len(data)) == limit {
+		preview += fmt.Sprintf("... %d more bytes\n", rest)
+	}
+	return io.NopCloser(strings.NewReader(preview)), nil
+}
 
-	return ReadLines(file, number, offset, limit)
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
 
 // Read and format content with line numbers
 func ReadLines(reader io.Reader, number bool, offset int, limit int) (string, error) {
-	scanner := bufio.NewScanner(reader)
-	var content []string
-	for scanner.Scan() {
-		content = append(content, scanner.Text())
-	}
+	data, err := io.ReadAll(NewLineReader(reader, &ReadOptions{
+		Number: number,
+		Offset: offset,
+		Limit:  limit,
+	}))
+	return string(data), err
+}
 
-	if err := scanner.Err(); err != nil {
-		return "", err
+// NewLineReader returns a reader of the lines selected by the options,
+// separated by newlines and numbered if requested. It fails with
+// ErrEmptyFile if there are no lines and with an error if the offset is
+// past the last line.
+func NewLineReader(reader io.Reader, o *ReadOptions) io.Reader {
+	limit := o.Limit
+	if limit <= 0 {
+		limit = math.MaxInt
 	}
-
-	if len(content) == 0 {
-		return "Empty content", nil
+	return &lineReader{
+		r:      bufio.NewReader(reader),
+		number: o.Number,
+		offset: max(o.Offset, 0),
+		limit:  limit,
 	}
+}
 
-	startIdx := offset
-	endIdx := startIdx + limit
-	if startIdx < 0 {
-		startIdx = 0
-	}
-	if startIdx >= len(content) {
-		return "", fmt.Errorf("error: line offset %d exceeds file length (%d lines)", offset, len(content))
+type lineReader struct {
+	r      *bufio.Reader
+	number bool
+	offset int
+	limit  int
+
+	// lines read and returned so far
+	count   int
+	emitted int
+	buf     []byte
+	err     error
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	for len(l.buf) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+		l.next()
 	}
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
 
-	if endIdx <= 0 || endIdx > len(content) {
-		endIdx = len(content)
+// next buffers the next selected line or sets the error.
+func (l *lineReader) next() {
+	if l.emitted >= l.limit {
+		l.err = io.EOF
+		return
 	}
+	for {
+		text, err := l.r.ReadString('\n')
+		if text == "" {
+			switch {
+			case err != io.EOF:
+				l.err = err
+			case l.count == 0:
+				l.err = ErrEmptyFile
+			case l.count <= l.offset:
+				l.err = fmt.Errorf("error: line offset %d exceeds file length (%d lines)", l.offset, l.count)
+			default:
+				l.err = io.EOF
+			}
+			return
+		}
+		l.count++
+		if l.count <= l.offset {
+			continue
+		}
 
-	lines := content[startIdx:endIdx]
-	if !number {
-		return strings.Join(lines, "\n"), nil
+		text = strings.TrimSuffix(text, "\n")
+		text = strings.TrimSuffix(text, "\r")
+		if l.number {
+			text = FormatLinesWithLineNumbers([]string{text}, l.count)
+		}
+		if l.emitted > 0 {
+			l.buf = append(l.buf, '\n')
+		}
+		l.buf = append(l.buf, text...)
+		l.emitted++
+		return
 	}
-	return FormatLinesWithLineNumbers(lines, startIdx+1), nil
 }
 
 // FormatContentWithLineNumbers formats content with line numbers (cat -n style).
@@ -0,0 +1,183 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+	dir, ws := newLocal(t, map[string]string{
+		"lines":  "one\ntwo\r\nthree\nfour",
+		"long":   "a\n" + long + "\nb\n",
+		"empty":  "",
+		"latin1": "caf\xe9\n",
+		"bytes":  "0123456789",
+		"bin":    "\x00\x01\x02\x03",
+	})
+	for _, tt := range []struct {
+		name string
+		file string
+		o    *ReadOptions
+		want string
+		err  string
+	}{
+		{
+			name: "raw",
+			file: "lines",
+			want: "one\ntwo\r\nthree\nfour",
+		},
+		{
+			name: "lines",
+			file: "lines",
+			o:    &ReadOptions{},
+			want: "one\ntwo\nthree\nfour",
+		},
+		{
+			name: "offset and limit",
+			file: "lines",
+			o:    &ReadOptions{Offset: 1, Limit: 2},
+			want: "two\nthree",
+		},
+		{
+			name: "numbered",
+			file: "lines",
+			o:    &ReadOptions{Offset: 2, Number: true},
+			want: "   3\tthree\n   4\tfour",
+		},
+		{
+			name: "offset past the end",
+			file: "lines",
+			o:    &ReadOptions{Offset: 4},
+			err:  "line offset 4 exceeds file length (4 lines)",
+		},
+		{
+			name: "long line",
+			file: "long",
+			o:    &ReadOptions{Offset: 1, Limit: 1},
+			want: long,
+		},
+		{
+			name: "empty",
+			file: "empty",
+			o:    &ReadOptions{},
+			err:  ErrEmptyFile.Error(),
+		},
+		{
+			name: "decoded",
+			file: "latin1",
+			o:    &ReadOptions{},
+			want: "café",
+		},
+		{
+			name: "encoding",
+			file: "latin1",
+			o:    &ReadOptions{Encoding: "ISO-8859-1"},
+			want: "café",
+		},
+		{
+			name: "byte range",
+			file: "bytes",
+			o:    &ReadOptions{ByteOffset: 3, ByteLength: 4},
+			want: "3456",
+		},
+		{
+			name: "byte offset",
+			file: "bytes",
+			o:    &ReadOptions{ByteOffset: 8},
+			want: "89",
+		},
+		{
+			name: "byte length past the end",
+			file: "bytes",
+			o:    &ReadOptions{ByteLength: 20},
+			want: "0123456789",
+		},
+		{
+			name: "bytes not decoded",
+			file: "latin1",
+			o:    &ReadOptions{ByteOffset: 3},
+			want: "\xe9\n",
+		},
+		{
+			name: "byte offset past the end",
+			file: "bytes",
+			o:    &ReadOptions{ByteOffset: 10},
+			err:  "byte offset 10 exceeds file size (10 bytes)",
+		},
+		{
+			name: "empty byte range",
+			file: "empty",
+			o:    &ReadOptions{ByteLength: 1},
+			err:  ErrEmptyFile.Error(),
+		},
+		{
+			name: "hexdump of binary",
+			file: "bin",
+			o:    &ReadOptions{Hexdump: true},
+			want: Hexdump([]byte("\x00\x01\x02\x03"), 0),
+		},
+		{
+			name: "hexdump of a byte range",
+			file: "bytes",
+			o:    &ReadOptions{ByteOffset: 2, ByteLength: 3, Hexdump: true},
+			want: Hexdump([]byte("234"), 2) + "... 5 more bytes\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ws.ReadFile(filepath.Join(dir, tt.file), tt.o)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadFile = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"f": "a\r\nb\nc\n"})
+	r, err := ws.OpenReader(filepath.Join(dir, "f"), &ReadOptions{Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// the lines are streamed in reads of any size
+	var sb strings.Builder
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		sb.Write(buf[:n])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sb.String() != "b\nc" {
+		t.Errorf("read %q", sb.String())
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	got, err := ReadLines(strings.NewReader("a\nb\nc\n"), true, 1, 1)
+	if err != nil || got != "   2\tb" {
+		t.Errorf("ReadLines = %q, %v", got, err)
+	}
+	long := strings.Repeat("y", maxLineLen+10)
+	want := "   1\t" + long[:maxLineLen] + "\n 1.1\t" + long[maxLineLen:]
+	if got := FormatLinesWithLineNumbers([]string{long}, 1); got != want {
+		t.Errorf("FormatLinesWithLineNumbers = %q, want %q", got, want)
+	}
+}
@@ -2,127 +2,301 @@ package vfs
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
-func (s *LocalFS) ReadMultipleFiles(pathsSlice []string) ([]string, error) {
+type ReadMultipleOptions struct {
+	// Maximum number of files after glob expansion (default: MAX_READ_FILES)
+	MaxFiles int
+	// Total bytes of content across the files (default: MAX_INLINE_SIZE).
+	// Text files past the budget or MAX_INLINE_SIZE are summarized,
+	// archives are listed and other content is left out.
+	MaxBytes int64
+	// Number of files read at a time (default: 8)
+	Concurrency int
+}
+
+// FileContent is a file read by ReadMultipleFiles.
+type FileContent struct {
+	Path string `json:"path"`
+	URI  string `json:"uri,omitempty"`
+	Mime string `json:"mime,omitempty"`
+	Size int64  `json:"size"`
+	// Encoding of text files, which are returned as UTF-8
+	Encoding string `json:"encoding,omitempty"`
+	// UTF-8 text, or data URL of images and binary files. The text of
+	// summarized files is an excerpt of their first and last lines.
+	Content string `json:"content,omitempty"`
+	// Content was summarized or left out at the byte budget or size limits
+	Truncated bool         `json:"truncated,omitempty"`
+	Summary   *FileSummary `json:"summary,omitempty"`
+	Error     string       `json:"error,omitempty"`
+}
+
+type ReadMultipleResult struct {
+	Files []*FileContent `json:"files"`
+	// Bytes of content returned
+	Bytes int64 `json:"bytes"`
+}
+
+// String renders the files one after the other with a header each, as
+// "--- File: path ---" followed by the content or a note.
+func (r *ReadMultipleResult) String() string {
+	var sb strings.Builder
+	for _, f := range r.Files {
+		switch {
+		case f.Error != "":
+			fmt.Fprintf(&sb, "Error reading '%s': %s\n", f.Path, f.Error)
+			continue
+		case f.Content == "" && f.Truncated && f.Summary == nil:
+			fmt.Fprintf(&sb, "File '%s' (%s, %d bytes) is too large to display inline. Access it via resource URI: %s\n",
+				f.Path, f.Mime, f.Size, f.URI)
+			continue
+		}
+		if f.Summary == nil {
+			fmt.Fprintf(&sb, "--- File: %s ---\n", f.Path)
+		} else {
+			fmt.Fprintf(&sb, "--- File: %s (summary of %d bytes", f.Path, f.Size)
+			if f.Summary.Lines > 0 {
+				fmt.Fprintf(&sb, ", %d lines", f.Summary.Lines)
+			}
+			sb.WriteString(") ---\n")
+		}
+		sb.WriteString(f.Content)
+		if f.Content != "" && !strings.HasSuffix(f.Content, "\n") {
+			sb.WriteByte('\n')
+		}
+		if s := f.Summary; s != nil {
+			if len(s.Outline) > 0 {
+				sb.WriteString("Outline:\n")
+			}
+			for _, e := range s.Outline {
+				fmt.Fprintf(&sb, "  %s\n", e)
+			}
+			if len(s.Members) > 0 {
+				sb.WriteString("Members:\n")
+			}
+			for _, e := range s.Members {
+				fmt.Fprintf(&sb, "  %s\n", e)
+			}
+			if s.Omitted > 0 {
+				fmt.Fprintf(&sb, "  ... %d more\n", s.Omitted)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Read the contents of multiple files at once, in the order given
+// Parameters:
+// paths (required): Files to read, globs such as "src/**/*.go" are expanded,
+// max_files (optional): Files to read at most (default: 100),
+// max_bytes (optional): Total bytes of content (default: 5MB),
+// concurrency (optional): Files read at a time (default: 8)
+// Returns the content, or the error, of each file. Files too large for
+// the budget are summarized with an excerpt and an outline of their
+// declarations, and archives with a listing of their members.
+func (s *LocalFS) ReadMultipleFiles(pathsSlice []string, o *ReadMultipleOptions) (*ReadMultipleResult, error) {
+	if o == nil {
+		o = &ReadMultipleOptions{}
+	}
 	if len(pathsSlice) == 0 {
 		return nil, fmt.Errorf("No files specified to read")
 	}
-
-	// Maximum number of files to read in a single request
-	const maxFiles = 50
-	if len(pathsSlice) > maxFiles {
-		return nil, fmt.Errorf("Too many files requested. Maximum is %d files per request.", maxFiles)
+	maxFiles := o.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = MAX_READ_FILES
+	}
+	budget := o.MaxBytes
+	if budget <= 0 {
+		budget = MAX_INLINE_SIZE
+	}
+	concurrency := o.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
 	}
 
-	// Process each file
-	var results []string
+	var files []*FileContent
 	for _, path := range pathsSlice {
-		// Handle empty or relative paths like "." or "./" by converting to absolute path
-		if path == "." || path == "./" {
-			// Get current working directory
-			cwd, err := os.Getwd()
-			if err != nil {
-				results = append(results, fmt.Sprintf("Error resolving current directory for path '%s': %v", path, err))
-				continue
-			}
-			path = cwd
-		}
-
-		validPath, err := s.validatePath(path)
-		if err != nil {
-			results = append(results, fmt.Sprintf("Error with path '%s': %v", path, err))
+		if !hasGlobMeta(path) {
+			files = append(files, &FileContent{Path: path})
 			continue
 		}
-
-		// Check if it's a directory
-		info, err := os.Stat(validPath)
-		if err != nil {
-			results = append(results, fmt.Sprintf("Error accessing '%s': %v", path, err))
-			continue
+		matches, err := s.expandGlob(path)
+		switch {
+		case err != nil:
+			files = append(files, &FileContent{Path: path, Error: err.Error()})
+		case len(matches) == 0:
+			files = append(files, &FileContent{Path: path, Error: "no files match the pattern"})
 		}
-
-		if info.IsDir() {
-			// For directories, return a resource reference instead
-			resourceURI := PathToResourceURI(validPath)
-			results = append(results, fmt.Sprintf("'%s' is a directory. Use list_directory tool or resource URI: %s", path, resourceURI))
-			continue
+		for _, m := range matches {
+			files = append(files, &FileContent{Path: m})
 		}
+	}
+	if len(files) > maxFiles {
+		return nil, fmt.Errorf("Too many files requested (%d). Maximum is %d files per request.", len(files), maxFiles)
+	}
 
-		// Determine MIME type
-		mimeType := DetectMimeType(validPath)
-
-		// Check file size
-		if info.Size() > MAX_INLINE_SIZE {
-			// File is too large to inline, return a resource reference
-			resourceURI := PathToResourceURI(validPath)
-			results = append(results, fmt.Sprintf("File '%s' is too large to display inline (%d bytes). Access it via resource URI: %s",
-				path, info.Size(), resourceURI))
+	// read concurrently, up to the budget each, and share the budget in
+	// the order of the files
+	limit := min(budget, MAX_INLINE_SIZE)
+	contents := make([][]byte, len(files))
+	paths := make([]string, len(files))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, f := range files {
+		if f.Error != "" {
 			continue
 		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			paths[i], contents[i] = s.readContent(f, limit)
+		}()
+	}
+	wg.Wait()
 
-		// Read file content
-		content, err := os.ReadFile(validPath)
-		if err != nil {
-			results = append(results, fmt.Sprintf("Error reading file '%s': %v", path, err))
+	result := &ReadMultipleResult{Files: files}
+	for i, f := range files {
+		if f.Error != "" || contents[i] == nil {
 			continue
 		}
-
-		// Add file header
-		results = append(results, fmt.Sprintf("--- File: %s ---", path))
-
-		// Check if it's a text file
-		if IsTextFile(mimeType) {
-			// It's a text file, return as text
-			results = append(results, string(content))
-		} else if IsImageFile(mimeType) {
-			// It's an image file, return as image content
-			if info.Size() <= MAX_BASE64_SIZE {
-
-				results = append(results, DataURL(mimeType, content))
-				// results = append(results, mcp.TextContent{
-				// 	Type: "text",
-				// 	Text: fmt.Sprintf("Image file: %s (%s, %d bytes)", path, mimeType, info.Size()),
-				// })
-				// results = append(results, mcp.ImageContent{
-				// 	Type:     "image",
-				// 	Data:     base64.StdEncoding.EncodeToString(content),
-				// 	MIMEType: mimeType,
-				// })
+		remaining := budget - result.Bytes
+		// summaries share the rest of the budget with the files after them
+		share := max(remaining, 0) / int64(len(files)-i)
+		content := contents[i]
+		// cut short at the budget, the end may be an incomplete character
+		short := int64(len(content)) < f.Size
+		enc := detectEncoding(content, short)
+		if enc != nil && (IsTextFile(f.Mime) || !IsImageFile(f.Mime)) {
+			text, err := enc.Decode(content)
+			if err != nil {
+				f.Error = err.Error()
+				continue
+			}
+			f.Encoding = enc.String()
+			if short || int64(len(text)) > remaining {
+				f.Truncated = true
+				f.Content, f.Summary, err = summarizeText(paths[i], enc, f.Size, share)
+				if err != nil {
+					f.Error = err.Error()
+					continue
+				}
 			} else {
-				// Too large for base64, return a reference
-				resourceURI := PathToResourceURI(validPath)
-				results = append(results, fmt.Sprintf("Image file '%s' is too large to display inline (%d bytes). Access it via resource URI: %s",
-					path, info.Size(), resourceURI))
+				f.Content = string(text)
 			}
 		} else {
-			// It's another type of binary file
-			resourceURI := PathToResourceURI(validPath)
-
-			if info.Size() <= MAX_BASE64_SIZE {
-				// Small enough for base64 encoding
-				// results = append(results, mcp.TextContent{
-				// 	Type: "text",
-				// 	Text: fmt.Sprintf("Binary file: %s (%s, %d bytes)", path, mimeType, info.Size()),
-				// })
-
-				results = append(results, DataURL(mimeType, content))
-				// results = append(results, mcp.EmbeddedResource{
-				// 	Type: "resource",
-				// 	Resource: mcp.BlobResourceContents{
-				// 		URI:      resourceURI,
-				// 		MIMEType: mimeType,
-				// 		Blob:     base64.StdEncoding.EncodeToString(content),
-				// 	},
-				// })
+			// images and other binary files as data URLs
+			dataURL := DataURL(f.Mime, content)
+			if f.Size > MAX_BASE64_SIZE || short || int64(len(dataURL)) > remaining {
+				f.Truncated = true
+				summary, err := summarizeArchive(paths[i], share)
+				if err != nil {
+					f.Error = err.Error()
+				}
+				f.Summary = summary
 			} else {
-				// Too large for base64, return a reference
-				results = append(results, fmt.Sprintf("Binary file '%s' (%s, %d bytes). Access it via resource URI: %s",
-					path, mimeType, info.Size(), resourceURI))
+				f.Content = dataURL
 			}
 		}
+		result.Bytes += int64(len(f.Content))
+		if f.Summary != nil {
+			result.Bytes += f.Summary.size()
+		}
+	}
+	return result, nil
+}
+
+// readContent fills in the metadata of the file and returns its real path
+// and first limit bytes, nil on errors which are set on the file.
+func (s *LocalFS) readContent(f *FileContent, limit int64) (string, []byte) {
+	path := f.Path
+	// Handle empty or relative paths like "." or "./" by converting to absolute path
+	if path == "." || path == "./" {
+		// Get current working directory
+		cwd, err := os.Getwd()
+		if err != nil {
+			f.Error = fmt.Sprintf("error resolving current directory: %v", err)
+			return "", nil
+		}
+		path = cwd
+	}
+
+	validPath, err := s.validatePath(path)
+	if err != nil {
+		f.Error = err.Error()
+		return "", nil
+	}
+	f.URI = PathToResourceURI(validPath)
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		f.Error = err.Error()
+		return "", nil
+	}
+	if info.IsDir() {
+		// For directories, return a resource reference instead
+		f.Error = fmt.Sprintf("is a directory, use list_directory tool or resource URI: %s", f.URI)
+		return "", nil
+	}
+	f.Size = info.Size()
+	f.Mime = DetectMimeType(validPath)
+
+	file, err := os.Open(validPath)
+	if err != nil {
+		f.Error = err.Error()
+		return "", nil
 	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, limit))
+	if err != nil {
+		f.Error = err.Error()
+		return "", nil
+	}
+	return validPath, content
+}
 
-	return results, nil
+// expandGlob returns the files matching the glob, in lexical order.
+// Metacharacters are those of FindFiles, "*" does not match hidden names
+// unless the pattern has a dot before it.
+func (s *LocalFS) expandGlob(pattern string) ([]string, error) {
+	dir, rest := splitGlob(pattern)
+	re, err := compileGlob(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	root := dir
+	if root == "" {
+		root = "."
+	}
+	validPath, err := s.validatePath(root)
+	if err != nil {
+		return nil, err
+	}
+
+	depth := 0
+	if !strings.Contains(rest, "**") {
+		depth = strings.Count(rest, "/") + 1
+	}
+	wo := &walkOptions{
+		Depth:    depth,
+		Hidden:   strings.HasPrefix(rest, ".") || strings.Contains(rest, "/."),
+		NoIgnore: true,
+		Allow:    s.isPathInAllowedDirs,
+	}
+	var matches []string
+	err = walkFiles(validPath, wo, func(_, rel string, d fs.DirEntry, _ int) error {
+		if !d.IsDir() && d.Type()&(fs.ModeType&^fs.ModeSymlink) == 0 && re.MatchString(rel) {
+			matches = append(matches, filepath.Join(dir, filepath.FromSlash(rel)))
+		}
+		return nil
+	})
+	return matches, err
 }
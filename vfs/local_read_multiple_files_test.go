@@ -0,0 +1,150 @@
+package vfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadMultipleFiles(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		"a.txt":       "a\n",
+		"b.txt":       "b\n",
+		".hidden.txt": "h\n",
+		"latin1.txt":  "caf\xe9\n",
+		"src/x.go":    "package x\n",
+		"src/y/y.go":  "package y\n",
+		"bin.dat":     "\x00\x01\x02",
+		"d/":          "",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	for _, tt := range []struct {
+		name  string
+		paths []string
+		o     *ReadMultipleOptions
+		// "name=content" or "name!error" of each file
+		want []string
+	}{
+		{
+			name:  "in order",
+			paths: []string{path("b.txt"), path("a.txt")},
+			want:  []string{"b.txt=b\n", "a.txt=a\n"},
+		},
+		{
+			name:  "glob",
+			paths: []string{path("*.txt")},
+			want:  []string{"a.txt=a\n", "b.txt=b\n", "latin1.txt=café\n"},
+		},
+		{
+			name:  "hidden glob",
+			paths: []string{path(".*.txt")},
+			want:  []string{".hidden.txt=h\n"},
+		},
+		{
+			name:  "recursive glob",
+			paths: []string{path("src/**/*.go")},
+			want:  []string{"src/x.go=package x\n", "src/y/y.go=package y\n"},
+		},
+		{
+			name:  "errors",
+			paths: []string{path("missing"), path("*.none"), path("d"), path("a.txt")},
+			want:  []string{"missing!no such file", "*.none!no files match", "d!is a directory", "a.txt=a\n"},
+		},
+		{
+			name:  "binary",
+			paths: []string{path("bin.dat")},
+			want:  []string{"bin.dat=" + DataURL(DetectMimeType(path("bin.dat")), []byte("\x00\x01\x02"))},
+		},
+		{
+			name:  "binary past the budget",
+			paths: []string{path("a.txt"), path("bin.dat")},
+			o:     &ReadMultipleOptions{MaxBytes: 10},
+			want:  []string{"a.txt=a\n", "bin.dat="},
+		},
+		{
+			name:  "sequential",
+			paths: []string{path("*.txt"), path("src/**")},
+			o:     &ReadMultipleOptions{Concurrency: 1},
+			want:  []string{"a.txt=a\n", "b.txt=b\n", "latin1.txt=café\n", "src/x.go=package x\n", "src/y/y.go=package y\n"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ws.ReadMultipleFiles(tt.paths, tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			var bytes int64
+			for _, f := range res.Files {
+				name := strings.TrimPrefix(filepath.ToSlash(f.Path), filepath.ToSlash(dir)+"/")
+				if f.Error != "" {
+					got = append(got, name+"!"+f.Error)
+				} else {
+					got = append(got, name+"="+f.Content)
+				}
+				bytes += int64(len(f.Content))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("files = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				ok := got[i] == tt.want[i]
+				if name, msg, isErr := strings.Cut(tt.want[i], "!"); isErr {
+					ok = strings.HasPrefix(got[i], name+"!") && strings.Contains(got[i], msg)
+				}
+				if !ok {
+					t.Errorf("file %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			if res.Bytes != bytes {
+				t.Errorf("bytes = %d, want %d", res.Bytes, bytes)
+			}
+		})
+	}
+
+	res, err := ws.ReadMultipleFiles([]string{path("latin1.txt"), path("bin.dat")}, &ReadMultipleOptions{MaxBytes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := res.Files[0]; f.Encoding != "ISO-8859-1" || f.Size != 5 || f.URI != "file://"+path("latin1.txt") || f.Truncated {
+		t.Errorf("latin1.txt = %+v", f)
+	}
+	if f := res.Files[1]; !f.Truncated || f.Content != "" {
+		t.Errorf("bin.dat = %+v", f)
+	}
+	want := fmt.Sprintf("--- File: %s ---\ncafé\nFile '%s' (%s, 3 bytes) is too large to display inline. Access it via resource URI: file://%s\n",
+		path("latin1.txt"), path("bin.dat"), res.Files[1].Mime, path("bin.dat"))
+	if s := res.String(); s != want {
+		t.Errorf("String =\n%s\nwant:\n%s", s, want)
+	}
+}
+
+func TestReadMultipleFilesLimits(t *testing.T) {
+	files := map[string]string{}
+	for i := range 20 {
+		files[fmt.Sprintf("f%02d", i)] = fmt.Sprintf("%d\n", i)
+	}
+	dir, ws := newLocal(t, files)
+
+	if _, err := ws.ReadMultipleFiles(nil, nil); err == nil {
+		t.Error("read no files")
+	}
+	if _, err := ws.ReadMultipleFiles([]string{filepath.Join(dir, "f*")}, &ReadMultipleOptions{MaxFiles: 19}); err == nil {
+		t.Error("read more than MaxFiles")
+	}
+
+	// concurrent reads keep the order of the files
+	for _, n := range []int{1, 3, 50} {
+		res, err := ws.ReadMultipleFiles([]string{filepath.Join(dir, "f*")}, &ReadMultipleOptions{Concurrency: n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, f := range res.Files {
+			if f.Content != fmt.Sprintf("%d\n", i) {
+				t.Errorf("concurrency %d: file %d = %q", n, i, f.Content)
+			}
+		}
+	}
+}
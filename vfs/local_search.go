@@ -2,143 +2,323 @@ package vfs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	// "mime"
-	// "path/filepath"
-	"runtime"
-	// "slices"
-	"strconv"
-	// "strings"
-
-	// "github.com/gabriel-vasile/mimetype"
-	pt "github.com/qiangli/filesearch"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"strings"
 )
 
-func init() {
-	if cpu := runtime.NumCPU(); cpu == 1 {
-		runtime.GOMAXPROCS(2)
-	} else {
-		runtime.GOMAXPROCS(cpu)
+// default depth of directories to search
+const searchDepth = 25
+
+// SearchMatch is a line matching the search pattern.
+type SearchMatch struct {
+	Path string `json:"path"`
+	// 1-based line number
+	Line int `json:"line"`
+	// 1-based byte offset of the first match in the line
+	Column int    `json:"column"`
+	Text   string `json:"text"`
+	// Context lines
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// SearchFile is the number of matching lines of a file.
+type SearchFile struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+type SearchResult struct {
+	// Matches in file and line order, empty with FilesOnly or OnMatch
+	Matches []*SearchMatch `json:"matches,omitempty"`
+	// Files with matches
+	Files []*SearchFile `json:"files"`
+	// The search stopped at the maximum number of results
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// String formats the result like grep: "path:line:text" for matches and
+// "path-line-text" for context lines, or the file paths only.
+func (r *SearchResult) String() string {
+	var sb strings.Builder
+	if len(r.Matches) == 0 {
+		for _, f := range r.Files {
+			sb.WriteString(f.Path)
+			sb.WriteByte('\n')
+		}
+		return sb.String()
 	}
+	for _, m := range r.Matches {
+		for i, l := range m.Before {
+			fmt.Fprintf(&sb, "%s-%d-%s\n", m.Path, m.Line-len(m.Before)+i, l)
+		}
+		fmt.Fprintf(&sb, "%s:%d:%s\n", m.Path, m.Line, m.Text)
+		for i, l := range m.After {
+			fmt.Fprintf(&sb, "%s-%d-%s\n", m.Path, m.Line+1+i, l)
+		}
+	}
+	return sb.String()
 }
 
-// Usage:
-//   pt [OPTIONS] PATTERN [PATH]
-
-// Application Options:
-//       --version             Show version
-
-// Output Options:
-//       --color               Print color codes in results (default: true)
-//       --nocolor             Don't print color codes in results (default:
-//                             false)
-//       --color-line-number=  Color codes for line numbers (default: 1;33)
-//       --color-path=         Color codes for path names (default: 1;32)
-//       --color-match=        Color codes for result matches (default: 30;43)
-//       --group               Print file name at header (default: true)
-//       --nogroup             Don't print file name at header (default:
-//                             false)
-//   -0, --null                Separate filenames with null (for 'xargs -0')
-//                             (default: false)
-//       --column              Print column (default: false)
-//       --numbers             Print Line number. (default: true)
-//   -N, --nonumbers           Omit Line number. (default: false)
-//   -A, --after=              Print lines after match
-//   -B, --before=             Print lines before match
-//   -C, --context=            Print lines before and after match
-//   -l, --files-with-matches  Only print filenames that contain matches
-//   -c, --count               Only print the number of matching lines for
-//                             each input file.
-//   -o, --output-encode=      Specify output encoding (none, jis, sjis, euc)
-
-// Search Options:
-//   -e                        Parse PATTERN as a regular expression
-//                             (default: false). Accepted syntax is the same
-//                             as https://github.com/google/re2/wiki/Syntax
-//                             except from \C
-//   -i, --ignore-case         Match case insensitively
-//   -S, --smart-case          Match case insensitively unless PATTERN
-//                             contains uppercase characters
-//   -w, --word-regexp         Only match whole words
-//       --ignore=             Ignore files/directories matching pattern
-//       --vcs-ignore=         VCS ignore files (default: .gitignore)
-//       --global-gitignore    Use git's global gitignore file for ignore
-//                             patterns
-//       --home-ptignore       Use $Home/.ptignore file for ignore patterns
-//   -U, --skip-vcs-ignores    Don't use VCS ignore file for ignore patterns
-//   -g=                       Print filenames matching PATTERN
-//   -G, --file-search-regexp= PATTERN Limit search to filenames matching
-//                             PATTERN
-//       --depth=              Search up to NUM directories deep (default: 25)
-//   -f, --follow              Follow symlinks
-//       --hidden              Search hidden files and directories
-
-// Help Options:
-//   -h, --help                Show this help message
-
-func Search(path string, o *SearchOptions) (string, error) {
-	var args = []string{}
-
-	// output options
-	args = append(args, "--output-encode=none")
-
-	// search options
-	if o.Regexp {
-		args = append(args, "-e")
+// errSearchLimit stops the search at the maximum number of results.
+var errSearchLimit = errors.New("search limit reached")
+
+type searcher struct {
+	o      *SearchOptions
+	re     *regexp.Regexp
+	file   *regexp.Regexp
+	before int
+	after  int
+	max    int
+
+	// candidate files, nil without an index
+	index *indexQuery
+
+	result *SearchResult
+	count  int
+}
+
+func newSearcher(o *SearchOptions) (*searcher, error) {
+	if o.Pattern == "" {
+		return nil, fmt.Errorf("file serach pattern is required")
 	}
-	if o.IgnoreCase {
-		args = append(args, "--ignore-case")
+	pattern := o.Pattern
+	if !o.Regexp {
+		pattern = regexp.QuoteMeta(pattern)
 	}
 	if o.WordRegexp {
-		args = append(args, "--word-regexp")
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if o.IgnoreCase {
+		pattern = "(?i)" + pattern
 	}
-	for _, exclude := range o.Exclude {
-		args = append(args, "--ignore="+exclude)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern: %w", err)
+	}
+
+	s := &searcher{
+		o:      o,
+		re:     re,
+		before: o.Before,
+		after:  o.After,
+		max:    o.MaxResults,
+		result: &SearchResult{},
 	}
 	if o.FileSearchRegexp != "" {
-		args = append(args, "--file-search-regexp="+o.FileSearchRegexp)
+		if s.file, err = regexp.Compile(o.FileSearchRegexp); err != nil {
+			return nil, fmt.Errorf("invalid file search pattern: %w", err)
+		}
+	}
+	if s.before == 0 && s.after == 0 {
+		s.before, s.after = o.Context, o.Context
 	}
-	if o.Depth > 0 {
-		args = append(args, "--depth="+strconv.Itoa(o.Depth))
+	if s.max <= 0 {
+		s.max = MAX_SEARCH_RESULTS
 	}
-	if o.Follow {
-		args = append(args, "--follow")
+	return s, nil
+}
+
+// search looks for lines matching the pattern in the file or the files
+// under the directory at path. It uses the index, if not nil, to skip
+// files that cannot match and only follows symlinks to paths accepted by
+// allow, if not nil.
+func search(path string, o *SearchOptions, index *searchIndex, allow func(string) bool) (*SearchResult, error) {
+	s, err := newSearcher(o)
+	if err != nil {
+		return nil, err
 	}
-	if o.Hidden {
-		args = append(args, "--hidden")
+	if index != nil {
+		re, err := syntax.Parse(s.re.String(), syntax.Perl)
+		if err != nil {
+			return nil, err
+		}
+		s.index = index.query(re.Simplify())
+		defer index.save()
 	}
 
-	// args
-	if o.Pattern == "" {
-		return "", fmt.Errorf("file serach pattern is required")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		err = s.searchFile(path)
+	} else {
+		depth := o.Depth
+		if depth <= 0 {
+			depth = searchDepth
+		}
+		wo := &walkOptions{
+			Depth:   depth,
+			Follow:  o.Follow,
+			Hidden:  o.Hidden,
+			Exclude: o.Exclude,
+			Allow:   allow,
+		}
+		err = walkFiles(path, wo, func(path, _ string, d fs.DirEntry, _ int) error {
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if s.file != nil && !s.file.MatchString(d.Name()) {
+				return nil
+			}
+			return s.searchFile(path)
+		})
 	}
-	args = append(args, o.Pattern)
-	if path != "" {
-		args = append(args, path)
+	if errors.Is(err, errSearchLimit) {
+		s.result.Truncated = true
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.result, nil
+}
+
+// searchFile searches a text file, binary and oversized files are skipped.
+func (s *searcher) searchFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if s.index != nil && s.index.skip(path, info) {
+		return nil
+	}
+	if info.Size() > MAX_SEARCHABLE_SIZE {
+		s.indexed(path, info, nil)
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		s.indexed(path, info, nil)
+		return nil
+	}
+	s.indexed(path, info, data)
+
+	lines := strings.Split(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
 	}
 
-	var stdoutBuf, stderrBuf bytes.Buffer
-	pt := pt.PlatinumSearcher{Out: &stdoutBuf, Err: &stderrBuf}
-	exitCode := pt.Run(args)
+	var file *SearchFile
+	for i, l := range lines {
+		loc := s.re.FindStringIndex(l)
+		if loc == nil {
+			continue
+		}
+		if !s.o.FilesOnly && s.count == s.max {
+			return errSearchLimit
+		}
+		if file == nil {
+			if s.o.FilesOnly && len(s.result.Files) == s.max {
+				return errSearchLimit
+			}
+			file = &SearchFile{Path: path}
+			s.result.Files = append(s.result.Files, file)
+		}
+		file.Count++
+		if s.o.FilesOnly {
+			continue
+		}
+		s.count++
 
-	if exitCode != 0 {
-		return stderrBuf.String(), fmt.Errorf("search failed with exit code %d", exitCode)
+		m := &SearchMatch{
+			Path:   path,
+			Line:   i + 1,
+			Column: loc[0] + 1,
+			Text:   l,
+		}
+		if s.before > 0 {
+			m.Before = append([]string(nil), lines[max(i-s.before, 0):i]...)
+		}
+		if s.after > 0 {
+			m.After = append([]string(nil), lines[i+1:min(i+1+s.after, len(lines))]...)
+		}
+		if s.o.OnMatch != nil {
+			if err := s.o.OnMatch(m); err != nil {
+				return err
+			}
+			continue
+		}
+		s.result.Matches = append(s.result.Matches, m)
 	}
+	return nil
+}
 
-	return stdoutBuf.String(), nil
+// indexed adds a scanned file to the index, content is nil if the file is
+// not searchable.
+func (s *searcher) indexed(path string, info fs.FileInfo, content []byte) {
+	if s.index != nil && !s.index.fresh(path, info) {
+		s.index.x.add(path, info, content)
+	}
 }
 
-// Recursively search for files and directories matching a pattern
+// Recursively search the content of files for lines matching a pattern
 // Parameters: path (required): Starting path for the search,
-// pattern (required): Search pattern to match against file names
-func (s *LocalFS) SearchFiles(path string, options *SearchOptions) (string, error) {
+// pattern (required): Search pattern to match against file content
+func (s *LocalFS) SearchFiles(path string, options *SearchOptions) (*SearchResult, error) {
 	if options == nil {
 		options = &SearchOptions{}
 	}
 	validPath, err := s.validatePath(path)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	var index *searchIndex
+	if options.Index {
+		index = s.index(validPath, true)
+	}
+	return search(validPath, options, index, s.isPathInAllowedDirs)
+}
+
+// index returns the search index of the allowed directory containing
+// path, nil if indexing is off or the index is not loaded and load is false.
+func (s *LocalFS) index(path string, load bool) *searchIndex {
+	if s.indexDir == "" {
+		return nil
+	}
+	root := ""
+	for _, dir := range s.allowedDirs {
+		if strings.HasPrefix(path+string(filepath.Separator), dir) && len(dir) > len(root) {
+			root = dir
+		}
+	}
+	if root == "" {
+		return nil
 	}
 
-	return Search(validPath, options)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexes == nil {
+		s.indexes = make(map[string]*searchIndex)
+	}
+	index, ok := s.indexes[root]
+	if !ok && load {
+		index = loadIndex(s.indexDir, root)
+		s.indexes[root] = index
+	}
+	return index
+}
+
+// invalidate drops the index entries of the paths and the files under them.
+// Indexes not loaded yet notice the changes by the modification times.
+func (s *LocalFS) invalidate(paths ...string) {
+	for _, path := range paths {
+		if index := s.index(path, false); index != nil {
+			index.remove(path)
+		}
+	}
 }
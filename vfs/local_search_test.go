@@ -0,0 +1,116 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchFiles(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		"a.txt":         "one\nTwo\nthree\n",
+		"b.go":          "two words\ntwofold\n",
+		"d/c.txt":       "x\ntwo\ny\n",
+		".hidden/h.txt": "two\n",
+		"bin":           "two\x00\n",
+	})
+	for _, tt := range []struct {
+		name string
+		o    SearchOptions
+		want string
+	}{
+		{
+			name: "literal",
+			o:    SearchOptions{Pattern: "two"},
+			want: "b.go:1:two words\nb.go:2:twofold\nd/c.txt:2:two\n",
+		},
+		{
+			name: "ignore case",
+			o:    SearchOptions{Pattern: "two", IgnoreCase: true},
+			want: "a.txt:2:Two\nb.go:1:two words\nb.go:2:twofold\nd/c.txt:2:two\n",
+		},
+		{
+			name: "word",
+			o:    SearchOptions{Pattern: "two", WordRegexp: true},
+			want: "b.go:1:two words\nd/c.txt:2:two\n",
+		},
+		{
+			name: "regexp",
+			o:    SearchOptions{Pattern: "^t.*e$", Regexp: true},
+			want: "a.txt:3:three\n",
+		},
+		{
+			name: "file pattern",
+			o:    SearchOptions{Pattern: "two", FileSearchRegexp: `\.txt$`},
+			want: "d/c.txt:2:two\n",
+		},
+		{
+			name: "exclude",
+			o:    SearchOptions{Pattern: "two", Exclude: []string{"d"}},
+			want: "b.go:1:two words\nb.go:2:twofold\n",
+		},
+		{
+			name: "hidden",
+			o:    SearchOptions{Pattern: "two", Hidden: true, FileSearchRegexp: `\.txt$`},
+			want: ".hidden/h.txt:1:two\nd/c.txt:2:two\n",
+		},
+		{
+			name: "depth",
+			o:    SearchOptions{Pattern: "two", Depth: 1},
+			want: "b.go:1:two words\nb.go:2:twofold\n",
+		},
+		{
+			name: "context",
+			o:    SearchOptions{Pattern: "two", Context: 1, FileSearchRegexp: `c\.txt$`},
+			want: "d/c.txt-1-x\nd/c.txt:2:two\nd/c.txt-3-y\n",
+		},
+		{
+			name: "files only",
+			o:    SearchOptions{Pattern: "two", FilesOnly: true},
+			want: "b.go\nd/c.txt\n",
+		},
+		{
+			name: "max results",
+			o:    SearchOptions{Pattern: "two", MaxResults: 1},
+			want: "b.go:1:two words\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ws.SearchFiles(dir, &tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.ReplaceAll(res.String(), dir+string(filepath.Separator), ""); got != tt.want {
+				t.Errorf("SearchFiles =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFilesSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir, ws := newLocal(t, map[string]string{"d/a.txt": "two\n"})
+	for link, target := range map[string]string{
+		"out":     outside,
+		"out.txt": filepath.Join(outside, "secret.txt"),
+		"in":      filepath.Join(dir, "d"),
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := ws.SearchFiles(dir, &SearchOptions{Pattern: "two", Follow: true, FilesOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// links out of the allowed directories are not followed
+	want := "d/a.txt\nin/a.txt\n"
+	if got := strings.ReplaceAll(res.String(), dir+string(filepath.Separator), ""); got != want {
+		t.Errorf("SearchFiles =\n%s\nwant:\n%s", got, want)
+	}
+}
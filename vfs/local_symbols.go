@@ -0,0 +1,163 @@
+package vfs
+
+import (
+	"fmt"
+	"go/token"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+type SymbolOptions struct {
+	// Outline the packages of the subdirectories of a directory too
+	Recursive bool
+	// Include the _test.go files of directories
+	Tests bool
+	// Only list exported symbols
+	Exported bool
+}
+
+type SymbolResult struct {
+	Files []*SymbolFile `json:"files"`
+}
+
+// String renders the outline of each file as its path and package
+// followed by a line per symbol: "  12-20  func Foo(a int) error".
+func (r *SymbolResult) String() string {
+	var sb strings.Builder
+	for _, f := range r.Files {
+		fmt.Fprintf(&sb, "%s: package %s\n", f.Path, f.Package)
+		if f.Error != "" {
+			fmt.Fprintf(&sb, "  error: %s\n", f.Error)
+		}
+		for _, s := range f.Symbols {
+			fmt.Fprintf(&sb, "  %-9s %s\n", fmt.Sprintf("%d-%d", s.Start, s.End), s.Signature)
+		}
+	}
+	return sb.String()
+}
+
+// SymbolSource is a declaration read by ReadSymbol.
+type SymbolSource struct {
+	Path    string  `json:"path"`
+	Package string  `json:"package"`
+	Symbol  *Symbol `json:"symbol"`
+	// Lines of the declaration with its doc comment
+	Source string `json:"source"`
+}
+
+// List the packages, types, functions, methods, constants and variables of
+// Go source files with their line ranges
+// Parameters:
+// path (required): Go file or package directory,
+// recursive (optional): Include the packages of subdirectories,
+// tests (optional): Include the _test.go files of directories,
+// exported (optional): Only list exported symbols
+func (s *LocalFS) Symbols(path string, o *SymbolOptions) (*SymbolResult, error) {
+	if o == nil {
+		o = &SymbolOptions{}
+	}
+	validPath, err := s.validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if !info.IsDir() {
+		paths = append(paths, validPath)
+	} else {
+		depth := 1
+		if o.Recursive {
+			depth = 0
+		}
+		wo := &walkOptions{
+			Depth: depth,
+			Allow: s.isPathInAllowedDirs,
+		}
+		err := walkFiles(validPath, wo, func(p, _ string, d fs.DirEntry, _ int) error {
+			name := d.Name()
+			if d.Type().IsRegular() && strings.HasSuffix(name, ".go") && (o.Tests || !strings.HasSuffix(name, "_test.go")) {
+				paths = append(paths, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &SymbolResult{}
+	for _, p := range paths {
+		sf, err := s.parseSymbols(p)
+		if err != nil {
+			if !info.IsDir() {
+				return nil, err
+			}
+			result.Files = append(result.Files, &SymbolFile{Path: p, Error: err.Error()})
+			continue
+		}
+		if o.Exported {
+			var exported []*Symbol
+			for _, sym := range sf.Symbols {
+				if token.IsExported(sym.Name) && (sym.Recv == "" || token.IsExported(recvType(sym.Recv))) {
+					exported = append(exported, sym)
+				}
+			}
+			sf.Symbols = exported
+		}
+		result.Files = append(result.Files, sf)
+	}
+	return result, nil
+}
+
+// Read the declaration of a symbol from a Go source file
+// Parameters:
+// path (required): Go file,
+// name (required): Symbol such as "Foo", or "T.Close" for methods
+// Returns the symbol and its source lines including the doc comment.
+func (s *LocalFS) ReadSymbol(path, name string) (*SymbolSource, error) {
+	validPath, err := s.validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(validPath)
+	if err != nil {
+		return nil, err
+	}
+	sf, err := parseSymbols(validPath, content)
+	if sf == nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	sym := sf.findSymbol(name)
+	if sym == nil {
+		return nil, fmt.Errorf("symbol %s not found in %s", name, path)
+	}
+
+	start := sym.Start
+	if sym.Doc > 0 {
+		start = sym.Doc
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	return &SymbolSource{
+		Path:    path,
+		Package: sf.Package,
+		Symbol:  sym,
+		Source:  strings.Join(lines[start-1:min(sym.End, len(lines))], ""),
+	}, nil
+}
+
+func (s *LocalFS) parseSymbols(path string) (*SymbolFile, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sf, err := parseSymbols(path, src)
+	if sf == nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return sf, nil
+}
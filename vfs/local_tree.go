@@ -3,8 +3,10 @@ package vfs
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -12,29 +14,52 @@ import (
 type FileNode struct {
 	Name     string      `json:"name"`
 	Path     string      `json:"path"`
-	Type     string      `json:"type"` // "file" or "directory"
+	Type     string      `json:"type"` // "file", "directory" or "symlink"
 	Size     int64       `json:"size,omitempty"`
-	Modified time.Time   `json:"modified,omitempty"`
+	Modified *time.Time  `json:"modified,omitempty"`
+	Target   string      `json:"target,omitempty"` // of a symlink
+	Error    string      `json:"error,omitempty"`
 	Children []*FileNode `json:"children,omitempty"`
+	// Number of entries of a directory left out at the entry limit
+	Omitted int `json:"omitted,omitempty"`
 }
 
-// Returns a hierarchical JSON representation of a directory structure
+type TreeOptions struct {
+	// Maximum depth to traverse (default: 3)
+	Depth int
+	// Follow symlinks to directories
+	Follow bool
+	// Include hidden files and directories
+	Hidden bool
+	// Do not skip the files ignored by .gitignore
+	NoIgnore bool
+	// Skip entries matching these .gitignore style patterns
+	Exclude []string
+	// Maximum number of entries (default: MAX_TREE_ENTRIES)
+	MaxEntries int
+}
+
+// Returns a hierarchical representation of a directory structure
 // Parameters:
 // path (required): Path of the directory to traverse,
 // depth (optional): Maximum depth to traverse (default: 3),
-// follow_symlinks (optional): Whether to follow symbolic links (default: false)
+// follow_symlinks (optional): Whether to follow symbolic links (default: false),
+// hidden, no_ignore, exclude (optional): Entries to include,
+// max_entries (optional): Entries to list before truncating (default: 1000)
 func (s *LocalFS) Tree(
 	path string,
-	depth int,
-	follow bool,
-) (string, error) {
+	o *TreeOptions,
+) (*FileNode, error) {
+	if o == nil {
+		o = &TreeOptions{}
+	}
 
 	// Handle empty or relative paths like "." or "./" by converting to absolute path
 	if path == "." || path == "./" {
 		// Get current working directory
 		cwd, err := os.Getwd()
 		if err != nil {
-			return "", fmt.Errorf("Error resolving current directory: %v", err)
+			return nil, fmt.Errorf("Error resolving current directory: %v", err)
 		}
 		path = cwd
 	}
@@ -42,109 +67,178 @@ func (s *LocalFS) Tree(
 	// Validate the path is within allowed directories
 	validPath, err := s.validatePath(path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Check if it's a directory
 	info, err := os.Stat(validPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !info.IsDir() {
-		return "", fmt.Errorf("Error: The specified path is not a directory: %s", path)
+		return nil, fmt.Errorf("Error: The specified path is not a directory: %s", path)
+	}
+
+	depth := o.Depth
+	if depth <= 0 {
+		depth = 3
+	}
+	maxEntries := o.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = MAX_TREE_ENTRIES
+	}
+
+	modified := info.ModTime()
+	root := &FileNode{
+		Name:     filepath.Base(validPath),
+		Path:     validPath,
+		Type:     "directory",
+		Modified: &modified,
+	}
+	// directory nodes by relative path
+	dirs := map[string]*FileNode{"": root}
+	count := 0
+
+	wo := &walkOptions{
+		Depth:    depth,
+		Follow:   o.Follow,
+		Hidden:   o.Hidden,
+		NoIgnore: o.NoIgnore,
+		Exclude:  o.Exclude,
+		Allow:    s.isPathInAllowedDirs,
+		OnError: func(_, rel string, err error) {
+			if n := dirs[rel]; n != nil {
+				n.Error = err.Error()
+			}
+		},
 	}
+	err = walkFiles(validPath, wo, func(p, rel string, d fs.DirEntry, _ int) error {
+		parent := dirs[parentRel(rel)]
+		if count >= maxEntries {
+			parent.Omitted++
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		count++
 
-	// Build the tree structure
-	tree, err := s.buildTree(validPath, depth, 0, follow)
+		node := &FileNode{
+			Name: d.Name(),
+			Path: p,
+		}
+		if info, err := d.Info(); err != nil {
+			node.Error = err.Error()
+		} else {
+			modified := info.ModTime()
+			node.Modified = &modified
+			node.Size = info.Size()
+		}
+		switch {
+		case d.IsDir():
+			node.Type = "directory"
+			node.Size = 0
+			dirs[rel] = node
+		case d.Type()&fs.ModeSymlink != 0:
+			node.Type = "symlink"
+			node.Size = 0
+			node.Target, _ = os.Readlink(p)
+		default:
+			node.Type = "file"
+		}
+		parent.Children = append(parent.Children, node)
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("Error building directory tree: %v", err)
+		return nil, fmt.Errorf("Error building directory tree: %v", err)
 	}
+	return root, nil
+}
 
-	// Convert to JSON
-	jsonData, err := json.MarshalIndent(tree, "", "  ")
+// JSON renders the tree as indented JSON.
+func (n *FileNode) JSON() (string, error) {
+	data, err := json.MarshalIndent(n, "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("Error generating JSON: %v", err)
 	}
+	return string(data), nil
+}
 
-	return fmt.Sprintf("Directory tree for %s (max depth: %d):\n\n%s", validPath, depth, string(jsonData)), nil
+// Text renders the tree in the format of the tree command.
+func (n *FileNode) Text() string {
+	var sb strings.Builder
+	sb.WriteString(n.label())
+	sb.WriteByte('\n')
+	dirs, files := n.render(&sb, "")
+	fmt.Fprintf(&sb, "\n%d %s, %d %s\n", dirs, plural(dirs, "directory", "directories"), files, plural(files, "file", "files"))
+	return sb.String()
 }
 
-// buildTree builds a tree representation of the filesystem starting at the given path
-func (s *LocalFS) buildTree(path string, maxDepth int, currentDepth int, followSymlinks bool) (*FileNode, error) {
-	// Validate the path
-	validPath, err := s.validatePath(path)
-	if err != nil {
-		return nil, err
+func (n *FileNode) render(sb *strings.Builder, indent string) (int, int) {
+	dirs, files := 0, 0
+	for i, c := range n.Children {
+		last := i == len(n.Children)-1 && n.Omitted == 0
+		branch, next := "├── ", "│   "
+		if last {
+			branch, next = "└── ", "    "
+		}
+		sb.WriteString(indent + branch + c.label())
+		sb.WriteByte('\n')
+		if c.Type == "directory" {
+			dirs++
+			d, f := c.render(sb, indent+next)
+			dirs += d
+			files += f
+		} else {
+			files++
+		}
 	}
-
-	// Get file info
-	info, err := os.Stat(validPath)
-	if err != nil {
-		return nil, err
+	if n.Omitted > 0 {
+		fmt.Fprintf(sb, "%s└── ... %d more %s\n", indent, n.Omitted, plural(n.Omitted, "entry", "entries"))
 	}
+	return dirs, files
+}
 
-	// Create the node
-	node := &FileNode{
-		Name:     filepath.Base(validPath),
-		Path:     validPath,
-		Modified: info.ModTime(),
+func (n *FileNode) label() string {
+	s := n.Name
+	if n.Target != "" {
+		s += " -> " + n.Target
 	}
+	if n.Error != "" {
+		s += " [" + n.Error + "]"
+	}
+	return s
+}
 
-	// Set type and size
-	if info.IsDir() {
-		node.Type = "directory"
-
-		// If we haven't reached the max depth, process children
-		if currentDepth < maxDepth {
-			// Read directory entries
-			entries, err := os.ReadDir(validPath)
-			if err != nil {
-				return nil, err
-			}
+// Paths renders the entries as paths relative to the root, one per line,
+// with a slash after directory names.
+func (n *FileNode) Paths() string {
+	var sb strings.Builder
+	n.paths(&sb, "")
+	return sb.String()
+}
 
-			// Process each entry
-			for _, entry := range entries {
-				entryPath := filepath.Join(validPath, entry.Name())
-
-				// Handle symlinks
-				if entry.Type()&os.ModeSymlink != 0 {
-					if !followSymlinks {
-						// Skip symlinks if not following them
-						continue
-					}
-
-					// Resolve symlink
-					linkDest, err := filepath.EvalSymlinks(entryPath)
-					if err != nil {
-						// Skip invalid symlinks
-						continue
-					}
-
-					// Validate the symlink destination is within allowed directories
-					if !s.isPathInAllowedDirs(linkDest) {
-						// Skip symlinks pointing outside allowed directories
-						continue
-					}
-
-					entryPath = linkDest
-				}
-
-				// Recursively build child node
-				childNode, err := s.buildTree(entryPath, maxDepth, currentDepth+1, followSymlinks)
-				if err != nil {
-					// Skip entries with errors
-					continue
-				}
-
-				// Add child to the current node
-				node.Children = append(node.Children, childNode)
-			}
+func (n *FileNode) paths(sb *strings.Builder, dir string) {
+	for _, c := range n.Children {
+		rel := dir + c.Name
+		if c.Type == "directory" {
+			rel += "/"
+		}
+		sb.WriteString(rel)
+		sb.WriteByte('\n')
+		if c.Type == "directory" {
+			c.paths(sb, rel)
 		}
-	} else {
-		node.Type = "file"
-		node.Size = info.Size()
 	}
+	if n.Omitted > 0 {
+		fmt.Fprintf(sb, "%s... %d more %s\n", dir, n.Omitted, plural(n.Omitted, "entry", "entries"))
+	}
+}
 
-	return node, nil
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
 }
@@ -0,0 +1,119 @@
+package vfs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTree(t *testing.T) (string, Workspace) {
+	t.Helper()
+	dir, ws := newLocal(t, map[string]string{
+		".gitignore":   "*.log\n",
+		"a.txt":        "a\n",
+		"b/c.txt":      "c\n",
+		"b/d.log":      "d\n",
+		"b/e/f.txt":    "f\n",
+		".hidden/g":    "g\n",
+		"z/.gitignore": "y\n",
+		"z/y":          "y\n",
+		"z/x":          "x\n",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func TestTree(t *testing.T) {
+	dir, ws := newTree(t)
+	for _, tt := range []struct {
+		name  string
+		o     TreeOptions
+		paths string
+	}{
+		{
+			name:  "default",
+			paths: "a.txt\nb/\nb/c.txt\nb/e/\nb/e/f.txt\nlink\nz/\nz/x\n",
+		},
+		{
+			name:  "depth",
+			o:     TreeOptions{Depth: 1},
+			paths: "a.txt\nb/\nlink\nz/\n",
+		},
+		{
+			name:  "hidden and ignored",
+			o:     TreeOptions{Hidden: true, NoIgnore: true, Depth: 2},
+			paths: ".gitignore\n.hidden/\n.hidden/g\na.txt\nb/\nb/c.txt\nb/d.log\nb/e/\nlink\nz/\nz/.gitignore\nz/x\nz/y\n",
+		},
+		{
+			name:  "exclude",
+			o:     TreeOptions{Exclude: []string{"e/", "link"}},
+			paths: "a.txt\nb/\nb/c.txt\nz/\nz/x\n",
+		},
+		{
+			name:  "entry cap",
+			o:     TreeOptions{MaxEntries: 3},
+			paths: "a.txt\nb/\nb/c.txt\nb/... 1 more entry\n... 2 more entries\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := ws.Tree(dir, &tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := root.Paths(); got != tt.paths {
+				t.Errorf("Paths =\n%s\nwant:\n%s", got, tt.paths)
+			}
+		})
+	}
+
+	if _, err := ws.Tree(filepath.Join(dir, "a.txt"), nil); err == nil {
+		t.Error("listed the tree of a file")
+	}
+}
+
+func TestTreeRender(t *testing.T) {
+	dir, ws := newTree(t)
+	root, err := ws.Tree(dir, &TreeOptions{MaxEntries: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Base(dir) + `
+├── a.txt
+├── b
+│   ├── c.txt
+│   └── e
+│       └── f.txt
+├── link -> a.txt
+└── ... 1 more entry
+
+2 directories, 4 files
+`
+	if got := root.Text(); got != want {
+		t.Errorf("Text =\n%s\nwant:\n%s", got, want)
+	}
+
+	data, err := root.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded FileNode
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Omitted != 1 || len(decoded.Children) != 3 || decoded.Children[2].Target != "a.txt" {
+		t.Errorf("JSON = %s", data)
+	}
+	if decoded.Modified == nil || !decoded.Modified.Equal(*root.Modified) {
+		t.Errorf("modified = %v, want %v", decoded.Modified, root.Modified)
+	}
+	// unset fields are left out
+	file := &FileNode{Name: "f", Path: "/f", Type: "file"}
+	if data, _ := file.JSON(); strings.Contains(data, "modified") || strings.Contains(data, "size") {
+		t.Errorf("JSON = %s", data)
+	}
+}
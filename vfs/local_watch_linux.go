@@ -0,0 +1,216 @@
+//go:build linux
+
+package vfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_ATTRIB | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+
+// Watch reports file changes with inotify, falling back to polling if it
+// is not available. A file is watched through its directory so that
+// changes are reported across replacements such as log rotation.
+func (s *LocalFS) Watch(ctx context.Context, path string, recursive bool) (<-chan Event, error) {
+	validPath, err := s.validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return pollWatch(ctx, s, validPath, recursive, WatchInterval)
+	}
+	w := &inotify{
+		s:         s,
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		fd:        fd,
+		recursive: recursive && info.IsDir(),
+		dirs:      make(map[int]*watchDir),
+	}
+	root := validPath
+	if !info.IsDir() {
+		root, w.name = filepath.Dir(validPath), filepath.Base(validPath)
+	}
+	if err := w.add(root, "", nil); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	events := make(chan Event, 64)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblocks the read
+			w.file.Close()
+		case <-done:
+		}
+	}()
+	go func() {
+		defer close(events)
+		// the read also stops when the watched root is gone
+		defer w.file.Close()
+		defer close(done)
+		w.read(ctx, events)
+	}()
+	return events, nil
+}
+
+// watchDir is a directory watched by inotify.
+type watchDir struct {
+	path string
+	// slash separated path relative to the watched root
+	rel   string
+	lists []*ignoreList
+}
+
+type inotify struct {
+	s         *LocalFS
+	file      *os.File
+	fd        int
+	recursive bool
+	// the name of the watched file in the root directory, if any
+	name string
+	dirs map[int]*watchDir
+}
+
+// add watches the directory and, if recursive, its subdirectories that
+// are not ignored.
+func (w *inotify) add(dir, rel string, lists []*ignoreList) error {
+	if w.name == "" {
+		if data, err := os.ReadFile(filepath.Join(dir, ".gitignore")); err == nil {
+			lists = append(slices.Clip(lists), parseIgnore(rel, string(data)))
+		}
+	}
+	wd, err := unix.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "watch", Path: dir, Err: err}
+	}
+	w.dirs[wd] = &watchDir{path: dir, rel: rel, lists: lists}
+	if !w.recursive {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, d := range entries {
+		erel := joinRel(rel, d.Name())
+		if !d.IsDir() || slices.Contains(vcsDirs, d.Name()) || ignored(lists, erel, true) {
+			continue
+		}
+		p := filepath.Join(dir, d.Name())
+		if !w.s.isPathInAllowedDirs(p) {
+			continue
+		}
+		// the directory may be gone already
+		w.add(p, erel, lists)
+	}
+	return nil
+}
+
+func (w *inotify) read(ctx context.Context, events chan<- Event) {
+	buf := make([]byte, 64*1024)
+	send := func(ev Event) bool {
+		select {
+		case events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := string(buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(raw.Len)])
+			off += unix.SizeofInotifyEvent + int(raw.Len)
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+
+			dir := w.dirs[int(raw.Wd)]
+			if dir == nil {
+				continue
+			}
+			if raw.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirs, int(raw.Wd))
+				if len(w.dirs) == 0 {
+					// the watched root is gone
+					return
+				}
+				continue
+			}
+			if name == "" || w.name != "" && name != w.name {
+				continue
+			}
+			isDir := raw.Mask&unix.IN_ISDIR != 0
+			rel := joinRel(dir.rel, name)
+			if isDir && slices.Contains(vcsDirs, name) || ignored(dir.lists, rel, isDir) {
+				continue
+			}
+
+			var op Op
+			switch {
+			case raw.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+				op = Create
+			case raw.Mask&unix.IN_MODIFY != 0:
+				op = Write
+			case raw.Mask&unix.IN_ATTRIB != 0:
+				op = Chmod
+			case raw.Mask&unix.IN_DELETE != 0:
+				op = Remove
+			case raw.Mask&unix.IN_MOVED_FROM != 0:
+				op = Rename
+			default:
+				continue
+			}
+			path := filepath.Join(dir.path, name)
+			if !send(Event{Path: path, Op: op}) {
+				return
+			}
+			if op == Create && isDir && w.recursive && w.s.isPathInAllowedDirs(path) {
+				// watch the new directory and report what was created in
+				// it before
+				w.add(path, rel, dir.lists)
+				for _, ev := range w.created(path, rel, dir.lists) {
+					if !send(ev) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// created returns Create events for the entries of a new directory.
+func (w *inotify) created(dir, rel string, lists []*ignoreList) []Event {
+	var events []Event
+	wo := &walkOptions{
+		Hidden:  true,
+		Exclude: vcsExclude,
+		Allow:   w.s.isPathInAllowedDirs,
+	}
+	walkFiles(dir, wo, func(p, erel string, d os.DirEntry, _ int) error {
+		if !ignored(lists, joinRel(rel, erel), d.IsDir()) {
+			events = append(events, Event{Path: p, Op: Create})
+		}
+		return nil
+	})
+	return events
+}
@@ -0,0 +1,127 @@
+//go:build linux
+
+package vfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotifyWatch(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		".gitignore": "*.log\nbuild/\n",
+		"a.txt":      "a\n",
+		"d/b.txt":    "b\n",
+		".git/":      "",
+		"build/":     "",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := ws.(*LocalFS).Watch(ctx, dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(path("ignored.log"), []byte("x"), 0o644)
+	os.WriteFile(path(".git/HEAD"), []byte("x"), 0o644)
+	os.WriteFile(path("build/out"), []byte("x"), 0o644)
+	os.WriteFile(path("d/c.txt"), nil, 0o644)
+	expectEvents(t, events, dir, "CREATE d/c.txt")
+
+	f, err := os.OpenFile(path("a.txt"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("more\n")
+	f.Close()
+	expectEvents(t, events, dir, "WRITE a.txt")
+
+	os.Chmod(path("a.txt"), 0o600)
+	expectEvents(t, events, dir, "CHMOD a.txt")
+
+	os.Rename(path("a.txt"), path("d/a.txt"))
+	expectEvents(t, events, dir, "RENAME a.txt", "CREATE d/a.txt")
+
+	os.Remove(path("d/a.txt"))
+	expectEvents(t, events, dir, "REMOVE d/a.txt")
+
+	// the entries of new directories are reported and watched, without
+	// version control metadata
+	tmp := t.TempDir()
+	os.MkdirAll(filepath.Join(tmp, "e/f/.git"), 0o755)
+	os.WriteFile(filepath.Join(tmp, "e/f/g.txt"), nil, 0o644)
+	os.WriteFile(filepath.Join(tmp, "e/f/.git/HEAD"), nil, 0o644)
+	os.Rename(filepath.Join(tmp, "e"), path("e"))
+	expectEvents(t, events, dir, "CREATE e", "CREATE e/f", "CREATE e/f/g.txt")
+	os.WriteFile(path("e/f/h.txt"), nil, 0o644)
+	expectEvents(t, events, dir, "CREATE e/f/h.txt")
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestInotifyWatchFile(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"app.log": "1\n", "other": ""})
+	path := filepath.Join(dir, "app.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := ws.(*LocalFS).Watch(ctx, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "other"), []byte("x"), 0o644)
+	expectNoEvents(t, events, 50*time.Millisecond)
+
+	// changes are reported across log rotation
+	os.Rename(path, path+".1")
+	expectEvents(t, events, dir, "RENAME app.log")
+	os.WriteFile(path, []byte("2\n"), 0o644)
+	expectEvents(t, events, dir, "CREATE app.log", "WRITE app.log")
+}
+
+func TestInotifyWatchRootRemoved(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"d/a.txt": ""})
+	before := inotifyFiles(t)
+	events, err := ws.(*LocalFS).Watch(context.Background(), filepath.Join(dir, "d"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(filepath.Join(dir, "d"))
+	expectEvents(t, events, filepath.Join(dir, "d"), "REMOVE a.txt")
+	// the channel and the inotify file are closed once the watched
+	// directory is gone, without canceling the context
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				if n := inotifyFiles(t); n != before {
+					t.Errorf("%d inotify files open, want %d", n, before)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("events not closed")
+		}
+	}
+}
+
+// inotifyFiles returns the number of inotify files open in the process.
+func inotifyFiles(t *testing.T) int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip(err)
+	}
+	n := 0
+	for _, e := range entries {
+		if link, _ := os.Readlink(filepath.Join("/proc/self/fd", e.Name())); link == "anon_inode:inotify" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package vfs
+
+import (
+	"context"
+)
+
+// Watch reports file changes by polling every WatchInterval.
+func (s *LocalFS) Watch(ctx context.Context, path string, recursive bool) (<-chan Event, error) {
+	validPath, err := s.validatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return pollWatch(ctx, s, validPath, recursive, WatchInterval)
+}
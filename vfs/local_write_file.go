@@ -6,7 +6,16 @@ import (
 	"path/filepath"
 )
 
-func (s *LocalFS) WriteFile(path string, content []byte) error {
+type WriteOptions struct {
+	// Transcode the UTF-8 content to the detected encoding and byte order
+	// mark of the existing text file. The content is written as is
+	// otherwise.
+	EncodeLike bool
+}
+
+// WriteFile replaces the file at path with content, creating the parent
+// directories as needed.
+func (s *LocalFS) WriteFile(path string, content []byte, o *WriteOptions) error {
 	// Handle empty or relative paths like "." or "./" by converting to absolute path
 	if path == "." || path == "./" {
 		// Get current working directory
@@ -33,7 +42,15 @@ func (s *LocalFS) WriteFile(path string, content []byte) error {
 		return fmt.Errorf("Error creating parent directories: %v", err)
 	}
 
-	if err := os.WriteFile(validPath, content, 0644); err != nil {
+	if o != nil && o.EncodeLike {
+		content, err = encodeLike(validPath, content)
+		if err != nil {
+			return fmt.Errorf("Error writing file: %v", err)
+		}
+	}
+
+	defer s.invalidate(validPath)
+	if err := writeFileAtomic(validPath, content, s.backup); err != nil {
 		return fmt.Errorf("Error writing file: %v", err)
 	}
 
@@ -0,0 +1,114 @@
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newLocal returns a workspace over a temporary directory with the files,
+// names ending with a slash being directories.
+func newLocal(t *testing.T, files map[string]string) (string, Workspace) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws, err := NewLocalFS([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, ws
+}
+
+func TestWriteFileEncoding(t *testing.T) {
+	utf16 := "\xff\xfeh\x00i\x00\n\x00"
+	latin1 := "caf\xe9\n"
+	for _, tt := range []struct {
+		name    string
+		old     string
+		content string
+		o       *WriteOptions
+		want    string
+		err     bool
+	}{
+		{
+			name:    "raw over utf-16",
+			old:     utf16,
+			content: "ascii\n",
+			want:    "ascii\n",
+		},
+		{
+			name:    "raw over latin-1",
+			old:     latin1,
+			content: "5 €\n",
+			want:    "5 €\n",
+		},
+		{
+			name:    "binary over latin-1",
+			old:     latin1,
+			content: "\x00\x01\xe9",
+			o:       &WriteOptions{EncodeLike: true},
+			want:    "\x00\x01\xe9",
+		},
+		{
+			name:    "encode like utf-16",
+			old:     utf16,
+			content: "ok\n",
+			o:       &WriteOptions{EncodeLike: true},
+			want:    "\xff\xfeo\x00k\x00\n\x00",
+		},
+		{
+			name:    "encode like latin-1",
+			old:     latin1,
+			content: "thé\n",
+			o:       &WriteOptions{EncodeLike: true},
+			want:    "th\xe9\n",
+		},
+		{
+			name:    "not representable",
+			old:     latin1,
+			content: "5 €\n",
+			o:       &WriteOptions{EncodeLike: true},
+			want:    latin1,
+			err:     true,
+		},
+		{
+			name:    "new file",
+			content: "new\n",
+			o:       &WriteOptions{EncodeLike: true},
+			want:    "new\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			if tt.old != "" {
+				files["f"] = tt.old
+			}
+			dir, ws := newLocal(t, files)
+			path := filepath.Join(dir, "f")
+			err := ws.WriteFile(path, []byte(tt.content), tt.o)
+			if (err != nil) != tt.err {
+				t.Fatalf("WriteFile error = %v, want %v", err, tt.err)
+			}
+			got, _ := os.ReadFile(path)
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
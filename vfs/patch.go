@@ -0,0 +1,564 @@
+package vfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const devNull = "/dev/null"
+
+// FilePatch is the change to one file in a unified diff.
+type FilePatch struct {
+	OldName string
+	NewName string
+
+	// git extended headers
+	IsNew    bool
+	IsDelete bool
+	IsRename bool
+	IsBinary bool
+
+	Hunks []*DiffHunk
+
+	// started by a "diff --git" line, and whether ---/+++ were seen
+	git   bool
+	named bool
+}
+
+type PatchOptions struct {
+	// Strip the smallest prefix containing Strip leading slashes from file
+	// names (patch -p). Negative: strip "a/" and "b/" of git patches only.
+	Strip int
+	// Number of context lines at either end of a hunk that may be ignored
+	// when it does not apply as is (patch -F). GNU patch uses 2.
+	Fuzz int
+	// Compare context lines ignoring differences in white space
+	IgnoreWhitespace bool
+	// Undo the patch
+	Reverse bool
+	// Check the patch applies without modifying any file
+	DryRun bool
+	// Apply all hunks to File instead of the files named in the patch
+	File string
+	// Directory relative file names are resolved against
+	Dir string
+}
+
+// PatchResult reports how each file of the patch was applied.
+type PatchResult struct {
+	Files []*FilePatchResult
+}
+
+// Failed returns the number of hunks that did not apply.
+func (r *PatchResult) Failed() int {
+	var n int
+	for _, f := range r.Files {
+		n += len(f.Rejects)
+	}
+	return n
+}
+
+type FilePatchResult struct {
+	Path string
+	// source of a rename
+	From string
+
+	Created bool
+	Deleted bool
+
+	Hunks []*HunkResult
+	// hunks that did not apply, in unified diff format
+	Rejects []*DiffHunk
+	// reason the file could not be patched at all
+	Error string
+}
+
+type HunkResult struct {
+	Applied bool
+	// line the hunk was expected at and where it was applied, 1-based
+	Line int
+	// distance from the expected line
+	Offset int
+	// context lines ignored to apply the hunk
+	Fuzz int
+}
+
+// ParsePatch parses a unified or git style diff touching one or more files.
+func ParsePatch(patch string) ([]*FilePatch, error) {
+	lines := SplitLines(patch)
+
+	var files []*FilePatch
+	var fp *FilePatch
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			fp = &FilePatch{git: true}
+			fp.OldName, fp.NewName = parseGitNames(line[len("diff --git "):])
+			files = append(files, fp)
+		case fp != nil && len(fp.Hunks) == 0 && strings.HasPrefix(line, "new file mode"):
+			fp.IsNew = true
+		case fp != nil && len(fp.Hunks) == 0 && strings.HasPrefix(line, "deleted file mode"):
+			fp.IsDelete = true
+		case fp != nil && len(fp.Hunks) == 0 && strings.HasPrefix(line, "rename from "):
+			fp.IsRename = true
+			fp.OldName = "a/" + line[len("rename from "):]
+		case fp != nil && len(fp.Hunks) == 0 && strings.HasPrefix(line, "rename to "):
+			fp.IsRename = true
+			fp.NewName = "b/" + line[len("rename to "):]
+		case fp != nil && len(fp.Hunks) == 0 && (strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch"):
+			fp.IsBinary = true
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			// a git header is followed by the --- and +++ lines of the same file
+			if fp == nil || !fp.git || fp.named || len(fp.Hunks) > 0 {
+				fp = &FilePatch{}
+				files = append(files, fp)
+			}
+			fp.named = true
+			fp.OldName = parseFileName(line[len("--- "):])
+			fp.NewName = parseFileName(strings.TrimRight(lines[i+1], "\r\n")[len("+++ "):])
+			fp.IsNew = fp.IsNew || fp.OldName == devNull
+			fp.IsDelete = fp.IsDelete || fp.NewName == devNull
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if fp == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", i+1)
+			}
+			h, n, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			fp.Hunks = append(fp.Hunks, h)
+			i += n
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file changes found in patch")
+	}
+	return files, nil
+}
+
+func parseGitNames(s string) (string, string) {
+	// "a/old b/new", names may contain spaces
+	if i := strings.LastIndex(s, " b/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	old, new, _ := strings.Cut(s, " ")
+	return old, new
+}
+
+func parseFileName(s string) string {
+	// strip the timestamp
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if len(s) > 1 && s[0] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			s = u
+		}
+	}
+	return s
+}
+
+// parseHunk parses the hunk starting at lines[i] and returns the number of
+// body lines consumed.
+func parseHunk(lines []string, i int) (*DiffHunk, int, error) {
+	header := strings.TrimRight(lines[i], "\r\n")
+	var h DiffHunk
+	f := strings.Fields(header)
+	if len(f) < 4 || f[0] != "@@" || !strings.HasPrefix(f[1], "-") || !strings.HasPrefix(f[2], "+") {
+		return nil, 0, fmt.Errorf("line %d: invalid hunk header: %s", i+1, header)
+	}
+	var err error
+	if h.OldStart, h.OldLines, err = parseRange(f[1][1:]); err != nil {
+		return nil, 0, fmt.Errorf("line %d: invalid hunk header: %s", i+1, header)
+	}
+	if h.NewStart, h.NewLines, err = parseRange(f[2][1:]); err != nil {
+		return nil, 0, fmt.Errorf("line %d: invalid hunk header: %s", i+1, header)
+	}
+	// an empty range names the line before it
+	if h.OldLines == 0 {
+		h.OldStart++
+	}
+	if h.NewLines == 0 {
+		h.NewStart++
+	}
+
+	oldLines, newLines := 0, 0
+	n := 0
+	for j := i + 1; j < len(lines) && (oldLines < h.OldLines || newLines < h.NewLines || strings.HasPrefix(lines[j], "\\")); j++ {
+		line := lines[j]
+		n++
+		if strings.HasPrefix(line, "\\") {
+			// "\ No newline at end of file" applies to the previous line
+			if len(h.Lines) > 0 {
+				prev := h.Lines[len(h.Lines)-1]
+				prev.Text = strings.TrimSuffix(prev.Text, "\n")
+			}
+			continue
+		}
+		kind := line[0]
+		text := line[1:]
+		if line == "\n" || line == "\r\n" {
+			// context lines of blank lines lose the space in some editors
+			kind, text = ' ', line
+		}
+		switch kind {
+		case ' ':
+			oldLines++
+			newLines++
+		case '-':
+			oldLines++
+		case '+':
+			newLines++
+		default:
+			return nil, 0, fmt.Errorf("line %d: unexpected line in hunk: %q", j+1, strings.TrimRight(line, "\n"))
+		}
+		h.Lines = append(h.Lines, &DiffLine{Kind: kind, Text: text})
+	}
+	if oldLines != h.OldLines || newLines != h.NewLines {
+		return nil, 0, fmt.Errorf("line %d: truncated hunk", i+1)
+	}
+	return &h, n, nil
+}
+
+func parseRange(s string) (int, int, error) {
+	start, count, found := strings.Cut(s, ",")
+	l, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return l, 1, nil
+	}
+	n, err := strconv.Atoi(count)
+	return l, n, err
+}
+
+// ApplyPatch applies a unified diff to the files of the workspace.
+// Hunks that do not apply are reported in the result; the other hunks
+// of the file are still applied, as GNU patch does.
+func ApplyPatch(ws Workspace, patch string, o *PatchOptions) (*PatchResult, error) {
+	if o == nil {
+		o = &PatchOptions{}
+	}
+	files, err := ParsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PatchResult{}
+	for _, fp := range files {
+		if o.Reverse {
+			fp = fp.reverse()
+		}
+		r, err := applyFilePatch(ws, fp, o)
+		if err != nil {
+			return result, err
+		}
+		result.Files = append(result.Files, r)
+	}
+	return result, nil
+}
+
+func (fp *FilePatch) reverse() *FilePatch {
+	r := &FilePatch{
+		OldName:  fp.NewName,
+		NewName:  fp.OldName,
+		IsNew:    fp.IsDelete,
+		IsDelete: fp.IsNew,
+		IsRename: fp.IsRename,
+		IsBinary: fp.IsBinary,
+	}
+	for _, h := range fp.Hunks {
+		rh := &DiffHunk{
+			OldStart: h.NewStart,
+			OldLines: h.NewLines,
+			NewStart: h.OldStart,
+			NewLines: h.OldLines,
+		}
+		for _, l := range h.Lines {
+			kind := l.Kind
+			switch kind {
+			case '-':
+				kind = '+'
+			case '+':
+				kind = '-'
+			}
+			rh.Lines = append(rh.Lines, &DiffLine{Kind: kind, Text: l.Text})
+		}
+		r.Hunks = append(r.Hunks, rh)
+	}
+	return r
+}
+
+func (o *PatchOptions) path(fp *FilePatch, name string) string {
+	strip := o.Strip
+	if strip < 0 {
+		strip = 0
+		// names are swapped in a reversed patch
+		if hasGitPrefix(fp.OldName) || hasGitPrefix(fp.NewName) {
+			strip = 1
+		}
+	}
+	for range strip {
+		_, rest, found := strings.Cut(name, "/")
+		if !found {
+			break
+		}
+		name = rest
+	}
+	if !filepath.IsAbs(name) && o.Dir != "" {
+		name = filepath.Join(o.Dir, name)
+	}
+	return name
+}
+
+func hasGitPrefix(name string) bool {
+	return strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/")
+}
+
+func applyFilePatch(ws Workspace, fp *FilePatch, o *PatchOptions) (*FilePatchResult, error) {
+	var source, target string
+	switch {
+	case o.File != "":
+		source, target = o.File, o.File
+	case fp.IsNew:
+		source, target = o.path(fp, fp.NewName), o.path(fp, fp.NewName)
+	case fp.IsDelete:
+		source, target = o.path(fp, fp.OldName), o.path(fp, fp.OldName)
+	default:
+		source, target = o.path(fp, fp.OldName), o.path(fp, fp.NewName)
+		if !fp.IsRename && source != target {
+			// prefer the new name unless only the old file exists
+			if _, err := ws.Stat(target); err != nil {
+				if _, err := ws.Stat(source); err == nil {
+					target = source
+				}
+			}
+			source = target
+		}
+	}
+
+	r := &FilePatchResult{Path: target}
+	if fp.IsRename && source != target {
+		r.From = source
+	}
+	reject := func(msg string) (*FilePatchResult, error) {
+		r.Error = msg
+		r.Rejects = fp.Hunks
+		for _, h := range fp.Hunks {
+			r.Hunks = append(r.Hunks, &HunkResult{Line: h.OldStart})
+		}
+		return r, nil
+	}
+
+	if fp.IsBinary {
+		return reject("binary patches are not supported")
+	}
+
+	var content string
+	info, err := ws.Stat(source)
+	switch {
+	case err == nil && info.IsDir():
+		return reject(fmt.Sprintf("%s is a directory", source))
+	case err == nil:
+		data, err := ws.ReadFile(source, nil)
+		if err != nil {
+			return nil, err
+		}
+		content = string(data)
+		if fp.IsNew && content != "" {
+			return reject(fmt.Sprintf("%s already exists", source))
+		}
+	case os.IsNotExist(err) && fp.IsNew:
+		r.Created = true
+	default:
+		return reject(err.Error())
+	}
+
+	lines, results, rejects := applyHunks(SplitLines(content), fp.Hunks, o)
+	r.Hunks = results
+	r.Rejects = rejects
+	patched := strings.Join(lines, "")
+	r.Deleted = fp.IsDelete && patched == "" && len(rejects) == 0
+
+	if o.DryRun {
+		return r, nil
+	}
+	if len(rejects) == len(fp.Hunks) && len(fp.Hunks) > 0 {
+		// nothing to write
+		return r, nil
+	}
+
+	if r.Deleted {
+		if r.Created {
+			return r, nil
+		}
+		return r, ws.DeleteFile(source, false)
+	}
+	if err := mkdirAll(ws, filepath.Dir(target)); err != nil {
+		return nil, err
+	}
+	if patched != content || source != target || r.Created {
+		if err := ws.WriteFile(target, []byte(patched), nil); err != nil {
+			return nil, err
+		}
+	}
+	if source != target && !r.Created {
+		if err := ws.DeleteFile(source, false); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// mkdirAll creates dir and its missing parents through the workspace.
+func mkdirAll(ws Workspace, dir string) error {
+	info, err := ws.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("not a directory: %s", dir)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAll(ws, parent); err != nil {
+			return err
+		}
+	}
+	return ws.CreateDirectory(dir)
+}
+
+// applyHunks applies the hunks in order and returns the patched lines.
+func applyHunks(lines []string, hunks []*DiffHunk, o *PatchOptions) ([]string, []*HunkResult, []*DiffHunk) {
+	out := append([]string(nil), lines...)
+	var results []*HunkResult
+	var rejects []*DiffHunk
+
+	// lines added minus lines removed by the hunks applied so far
+	delta := 0
+	// distance of the last hunk from where it was expected
+	drift := 0
+	// hunks may not overlap
+	floor := 0
+	for _, h := range hunks {
+		res := &HunkResult{Line: h.OldStart}
+		results = append(results, res)
+
+		var old, new []string
+		for _, l := range h.Lines {
+			if l.Kind != '+' {
+				old = append(old, l.Text)
+			}
+			if l.Kind != '-' {
+				new = append(new, l.Text)
+			}
+		}
+		lead, trail := contextLines(h)
+
+		applied := false
+		for fuzz := 0; fuzz <= o.Fuzz && !applied; fuzz++ {
+			top, bottom := min(fuzz, lead), min(fuzz, trail)
+			if fuzz > 0 && top == 0 && bottom == 0 {
+				break
+			}
+			if top+bottom >= len(old) && len(old) > 0 {
+				break
+			}
+			fold := old[top : len(old)-bottom]
+			fnew := new[top : len(new)-bottom]
+
+			expected := h.OldStart - 1 + top + delta + drift
+			at := findLines(out, fold, expected, floor, o.IgnoreWhitespace)
+			if at < 0 {
+				continue
+			}
+
+			// context lines keep the text of the file, which may differ in whitespace
+			repl := make([]string, 0, len(fnew))
+			i := at
+			for _, l := range h.Lines[top : len(h.Lines)-bottom] {
+				switch l.Kind {
+				case ' ':
+					repl = append(repl, out[i])
+					i++
+				case '-':
+					i++
+				case '+':
+					repl = append(repl, l.Text)
+				}
+			}
+			out = append(out[:at], append(repl, out[at+len(fold):]...)...)
+			res.Applied = true
+			res.Fuzz = fuzz
+			res.Offset = at - (h.OldStart - 1 + top + delta)
+			res.Line = at - top - delta + 1
+			drift = res.Offset
+			delta += len(fnew) - len(fold)
+			floor = at + len(fnew)
+			applied = true
+		}
+		if !applied {
+			rejects = append(rejects, h)
+		}
+	}
+	return out, results, rejects
+}
+
+// contextLines returns the number of context lines before the first and
+// after the last change of the hunk.
+func contextLines(h *DiffHunk) (int, int) {
+	lead, trail := 0, 0
+	for _, l := range h.Lines {
+		if l.Kind != ' ' {
+			break
+		}
+		lead++
+	}
+	for i := len(h.Lines) - 1; i >= 0 && h.Lines[i].Kind == ' '; i-- {
+		trail++
+	}
+	if lead == len(h.Lines) {
+		trail = 0
+	}
+	return lead, trail
+}
+
+// findLines returns the position of want in lines closest to expected and
+// not before floor, or -1.
+func findLines(lines, want []string, expected, floor int, ignoreSpace bool) int {
+	last := len(lines) - len(want)
+	if last < floor {
+		return -1
+	}
+	expected = max(min(expected, last), floor)
+	match := func(at int) bool {
+		for i, w := range want {
+			l := lines[at+i]
+			if l == w {
+				continue
+			}
+			if !ignoreSpace || strings.Join(strings.Fields(l), " ") != strings.Join(strings.Fields(w), " ") {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; expected-d >= floor || expected+d <= last; d++ {
+		if at := expected + d; at <= last && match(at) {
+			return at
+		}
+		if at := expected - d; d > 0 && at >= floor && match(at) {
+			return at
+		}
+	}
+	return -1
+}
@@ -0,0 +1,285 @@
+package vfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Size of the head and of the tail excerpts of summarized text files
+	summaryExcerptSize = 4096
+	// Maximum number of outline entries or archive members of a summary
+	summaryEntries = 200
+)
+
+// FileSummary describes a file too large to be read whole.
+type FileSummary struct {
+	// Number of lines of text files
+	Lines int `json:"lines,omitempty"`
+	// Top-level declarations of source files, as "line: declaration"
+	Outline []string `json:"outline,omitempty"`
+	// Members of archives, as "name (size bytes)"
+	Members []string `json:"members,omitempty"`
+	// Number of outline entries or members left out
+	Omitted int `json:"omitted,omitempty"`
+}
+
+func (s *FileSummary) size() int64 {
+	var n int64
+	for _, e := range s.Outline {
+		n += int64(len(e))
+	}
+	for _, e := range s.Members {
+		n += int64(len(e))
+	}
+	return n
+}
+
+// summaryList collects entries up to the entry limit and a byte limit.
+type summaryList struct {
+	entries []string
+	size    int64
+	limit   int64
+	omitted int
+}
+
+func (l *summaryList) add(entry string) {
+	if len(l.entries) >= summaryEntries || l.size+int64(len(entry)) > l.limit {
+		l.omitted++
+		return
+	}
+	l.entries = append(l.entries, entry)
+	l.size += int64(len(entry))
+}
+
+// trim drops the last entries until the rest fit in limit bytes.
+func (l *summaryList) trim(limit int64) {
+	for len(l.entries) > 0 && l.size > limit {
+		last := l.entries[len(l.entries)-1]
+		l.entries = l.entries[:len(l.entries)-1]
+		l.size -= int64(len(last))
+		l.omitted++
+	}
+}
+
+// summarizeText returns an excerpt of the first and last lines of the
+// text file with a marker of the lines left out in between, along with
+// the line count and the outline of source files, in at most budget bytes.
+// The excerpt is left out if the marker does not fit.
+func summarizeText(path string, enc *TextEncoding, size, budget int64) (string, *FileSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	budget = max(budget, 0)
+	excerpt := min(summaryExcerptSize, budget/4)
+
+	// whole lines of the head, without a byte order mark
+	buf := make([]byte, excerpt)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, err
+	}
+	head, err := enc.Decode(buf[:n])
+	if err != nil {
+		return "", nil, err
+	}
+	head = head[:bytes.LastIndexByte(head, '\n')+1]
+
+	// whole lines of the tail, from a character boundary of the Unicode
+	// encodings and after the first line break of the others
+	plain, err := LookupEncoding(enc.Name)
+	if err != nil {
+		return "", nil, err
+	}
+	unit := int64(1)
+	switch {
+	case strings.HasPrefix(enc.Name, "UTF-16"):
+		unit = 2
+	case strings.HasPrefix(enc.Name, "UTF-32"):
+		unit = 4
+	}
+	off := max(size-excerpt, int64(n))
+	off += (unit - off%unit) % unit
+	buf = make([]byte, max(size-off, 0))
+	if _, err := f.ReadAt(buf, off); err != nil && err != io.EOF {
+		return "", nil, err
+	}
+	tail, err := plain.Decode(buf)
+	if err != nil {
+		return "", nil, err
+	}
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	} else {
+		tail = nil
+	}
+
+	// line count and outline
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	outline := &summaryList{limit: budget}
+	pattern := outlinePattern(path)
+	goSource := filepath.Ext(path) == ".go" && size <= MAX_SEARCHABLE_SIZE
+	var src bytes.Buffer
+	summary := &FileSummary{}
+	r := bufio.NewReader(enc.NewReader(f))
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			summary.Lines++
+			if goSource {
+				src.WriteString(line)
+			} else if pattern != nil && pattern.MatchString(line) {
+				outline.add(fmt.Sprintf("%d: %s", summary.Lines, strings.TrimSpace(line)))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if goSource {
+		for _, e := range outlineGo(src.Bytes()) {
+			outline.add(e)
+		}
+	}
+	omitted := summary.Lines - bytes.Count(head, []byte("\n")) - bytes.Count(tail, []byte("\n"))
+	if !bytes.HasSuffix(tail, []byte("\n")) && len(tail) > 0 {
+		omitted--
+	}
+	text := string(head) + fmt.Sprintf("... [%d lines omitted] ...\n", max(omitted, 0)) + string(tail)
+	if int64(len(text)) > budget {
+		text = ""
+	}
+	// the outline gets the rest of the budget
+	outline.trim(budget - int64(len(text)))
+	summary.Outline, summary.Omitted = outline.entries, outline.omitted
+	return text, summary, nil
+}
+
+// summarizeArchive lists the members of zip and tar archives in about
+// at most budget bytes. It returns nil for other files.
+func summarizeArchive(path string, budget int64) (*FileSummary, error) {
+	members := &summaryList{limit: budget}
+	name := strings.ToLower(path)
+	switch {
+	case hasSuffix(name, ".zip", ".jar", ".war", ".whl", ".apk"):
+		z, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			if f.FileInfo().IsDir() {
+				members.add(f.Name)
+			} else {
+				members.add(fmt.Sprintf("%s (%d bytes)", f.Name, f.UncompressedSize64))
+			}
+		}
+	case hasSuffix(name, ".tar", ".tar.gz", ".tgz"):
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var r io.Reader = f
+		if !strings.HasSuffix(name, ".tar") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return nil, err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if h.Typeflag == tar.TypeDir {
+				members.add(h.Name)
+			} else {
+				members.add(fmt.Sprintf("%s (%d bytes)", h.Name, h.Size))
+			}
+		}
+	default:
+		return nil, nil
+	}
+	return &FileSummary{Members: members.entries, Omitted: members.omitted}, nil
+}
+
+func hasSuffix(s string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	pythonOutline   = regexp.MustCompile(`^(async\s+def|def|class)\s+\w+`)
+	jsOutline       = regexp.MustCompile(`^(export\s+)?(default\s+)?(declare\s+)?(abstract\s+)?(async\s+)?(function\*?|class|interface|type|enum|namespace|const|let|var)\s+[\w$]+`)
+	rustOutline     = regexp.MustCompile(`^(pub(\([^)]*\))?\s+)?(async\s+)?(unsafe\s+)?(fn|struct|enum|trait|impl|mod|type|const|static|union|macro_rules!)[\s<]`)
+	cOutline        = regexp.MustCompile(`^((struct|union|enum|class|namespace|typedef)\b|#define\s|[A-Za-z_][\w\s\*&:<>,]*[\s\*&]\**[\w:~]+\s*\([^;]*$)`)
+	javaOutline     = regexp.MustCompile(`^\s{0,4}((public|protected|private|internal|static|abstract|final|sealed|open|data|override|suspend|async)\s+)*(class|interface|enum|record|object|fun|struct)\s+\w+`)
+	rubyOutline     = regexp.MustCompile(`^\s{0,2}(def|class|module)\s+\S+`)
+	shellOutline    = regexp.MustCompile(`^(function\s+[\w:.-]+|[\w:.-]+\s*\(\s*\))`)
+	markdownOutline = regexp.MustCompile(`^#{1,6}\s+\S`)
+)
+
+// outlinePattern returns the regexp of the lines declaring top-level
+// symbols in the language of the file, nil if there is none.
+func outlinePattern(path string) *regexp.Regexp {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".py", ".pyi":
+		return pythonOutline
+	case ".js", ".mjs", ".cjs", ".jsx", ".ts", ".mts", ".cts", ".tsx":
+		return jsOutline
+	case ".rs":
+		return rustOutline
+	case ".c", ".h", ".cc", ".cpp", ".cxx", ".hh", ".hpp", ".hxx":
+		return cOutline
+	case ".java", ".kt", ".kts", ".scala", ".cs", ".swift":
+		return javaOutline
+	case ".rb":
+		return rubyOutline
+	case ".sh", ".bash", ".zsh":
+		return shellOutline
+	case ".md", ".markdown":
+		return markdownOutline
+	}
+	return nil
+}
+
+// outlineGo returns the package clause and top-level declarations of the
+// Go source, as far as it parses.
+func outlineGo(src []byte) []string {
+	sf, _ := parseSymbols("", src)
+	if sf == nil {
+		return nil
+	}
+	out := []string{"package " + sf.Package}
+	for _, s := range sf.Symbols {
+		out = append(out, fmt.Sprintf("%d: %s", s.Start, s.Signature))
+	}
+	return out
+}
@@ -0,0 +1,175 @@
+package vfs
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lines returns n numbered lines of the width.
+func lines(n, width int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "%-*d\n", width-1, i)
+	}
+	return sb.String()
+}
+
+func TestSummarizeText(t *testing.T) {
+	dir, _ := newLocal(t, map[string]string{
+		"a.txt": lines(100, 10),
+		"a.py":  "import os\n" + lines(50, 10) + "def f():\n    pass\n" + lines(50, 10) + "class C:\n    pass\n",
+		"a.go":  "package a\n\n// F does it.\nfunc F() {}\n\ntype T struct{}\n" + strings.Repeat("// filler\n", 50),
+	})
+	for _, tt := range []struct {
+		name    string
+		file    string
+		budget  int64
+		text    string
+		outline []string
+	}{
+		{
+			name:   "excerpt",
+			file:   "a.txt",
+			budget: 120,
+			text:   lines(3, 10) + "... [95 lines omitted] ...\n" + "99       \n100      \n",
+		},
+		{
+			name:    "python outline",
+			file:    "a.py",
+			budget:  400,
+			outline: []string{"52: def f():", "104: class C:"},
+		},
+		{
+			name:    "go outline",
+			file:    "a.go",
+			budget:  400,
+			outline: []string{"package a", "4: func F()", "6: type T struct"},
+		},
+		{
+			name:   "no budget",
+			file:   "a.py",
+			budget: 0,
+			text:   "",
+		},
+		{
+			name:   "negative budget",
+			file:   "a.txt",
+			budget: -5,
+			text:   "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, summary, err := summarizeText(path, DetectEncoding([]byte("a")), info.Size(), tt.budget)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.outline == nil && text != tt.text {
+				t.Errorf("text =\n%s\nwant:\n%s", text, tt.text)
+			}
+			if tt.outline != nil && strings.Join(summary.Outline, "\n") != strings.Join(tt.outline, "\n") {
+				t.Errorf("outline = %q, want %q", summary.Outline, tt.outline)
+			}
+			// the excerpt, marker and outline fit in the budget
+			if n := int64(len(text)) + summary.size(); n > max(tt.budget, 0) {
+				t.Errorf("%d bytes over a budget of %d", n, tt.budget)
+			}
+			if want := strings.Count(string(mustRead(t, path)), "\n"); summary.Lines != want {
+				t.Errorf("lines = %d, want %d", summary.Lines, want)
+			}
+		})
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSummarizeArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zip.NewWriter(f)
+	for _, name := range []string{"d/", "d/a.txt", "b.txt"} {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			w.Write([]byte("abc"))
+		}
+	}
+	z.Close()
+	f.Close()
+
+	summary, err := summarizeArchive(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d/,d/a.txt (3 bytes),b.txt (3 bytes)"; strings.Join(summary.Members, ",") != want || summary.Omitted != 0 {
+		t.Errorf("members = %q, %d", summary.Members, summary.Omitted)
+	}
+	summary, err = summarizeArchive(path, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Members) != 2 || summary.Omitted != 1 {
+		t.Errorf("members = %q, %d", summary.Members, summary.Omitted)
+	}
+	if summary, err := summarizeArchive(filepath.Join(dir, "a.txt"), 20); summary != nil || err != nil {
+		t.Errorf("summary of a text file = %v, %v", summary, err)
+	}
+}
+
+func TestReadMultipleFilesBudget(t *testing.T) {
+	files := map[string]string{
+		"big.py": "import os\n" + lines(60, 10) + "def f():\n    pass\n",
+	}
+	for i := range 3 {
+		files[fmt.Sprintf("f%d.txt", i)] = lines(65, 10)
+	}
+	dir, ws := newLocal(t, files)
+
+	for _, budget := range []int64{1, 10, 50, 100, 300, 1000, 2000, 10000} {
+		res, err := ws.ReadMultipleFiles([]string{filepath.Join(dir, "*")}, &ReadMultipleOptions{MaxBytes: budget})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int64
+		for _, f := range res.Files {
+			if f.Error != "" {
+				t.Errorf("budget %d: %s: %s", budget, f.Path, f.Error)
+			}
+			n += int64(len(f.Content))
+			if f.Summary != nil {
+				n += f.Summary.size()
+				if f.Summary.Lines == 0 {
+					t.Errorf("budget %d: %s has no line count", budget, f.Path)
+				}
+			}
+		}
+		if n != res.Bytes || res.Bytes > budget {
+			t.Errorf("budget %d: %d bytes, counted %d", budget, n, res.Bytes)
+		}
+		// the last file does not fit unless everything does
+		if s := res.String(); budget < 10000 && !strings.Contains(s, "summary of 650 bytes, 65 lines") {
+			t.Errorf("budget %d: String =\n%s", budget, s)
+		}
+	}
+}
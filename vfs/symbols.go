@@ -0,0 +1,170 @@
+package vfs
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// Symbol is a top-level declaration of a Go source file.
+type Symbol struct {
+	Name string `json:"name"`
+	// "type", "func", "method", "const" or "var"
+	Kind string `json:"kind"`
+	// Receiver type of methods, such as "*T"
+	Recv string `json:"recv,omitempty"`
+	// Declaration without the body, such as "func (t *T) Close() error"
+	Signature string `json:"signature"`
+	// Line range of the declaration, starting at 1
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// First line of the doc comment, 0 if there is none
+	Doc int `json:"doc,omitempty"`
+}
+
+// ID returns the name by which ReadSymbol finds the symbol, such as "Foo"
+// or "T.Close" for methods.
+func (s *Symbol) ID() string {
+	if s.Recv == "" {
+		return s.Name
+	}
+	return recvType(s.Recv) + "." + s.Name
+}
+
+// recvType returns the receiver type name without pointer and type
+// parameters.
+func recvType(recv string) string {
+	recv = strings.TrimPrefix(recv, "*")
+	if i := strings.IndexByte(recv, '['); i >= 0 {
+		recv = recv[:i]
+	}
+	return recv
+}
+
+// SymbolFile is the outline of a Go source file.
+type SymbolFile struct {
+	Path    string    `json:"path"`
+	Package string    `json:"package"`
+	Symbols []*Symbol `json:"symbols"`
+	// Syntax error of a file parsed in part
+	Error string `json:"error,omitempty"`
+}
+
+// parseSymbols returns the outline of the Go source, as far as it parses.
+func parseSymbols(path string, src []byte) (*SymbolFile, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if file == nil || file.Name == nil {
+		return nil, err
+	}
+	sf := &SymbolFile{
+		Path:    path,
+		Package: file.Name.Name,
+	}
+	if err != nil {
+		sf.Error = err.Error()
+	}
+
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+	print := func(node any) string {
+		var sb strings.Builder
+		printer.Fprint(&sb, fset, node)
+		return sb.String()
+	}
+	add := func(name, kind, sig string, node ast.Node, doc *ast.CommentGroup) {
+		s := &Symbol{
+			Name:      name,
+			Kind:      kind,
+			Signature: sig,
+			Start:     line(node.Pos()),
+			End:       line(node.End()),
+		}
+		if doc != nil {
+			s.Doc = line(doc.Pos())
+		}
+		sf.Symbols = append(sf.Symbols, s)
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			sig := *d
+			sig.Doc, sig.Body = nil, nil
+			kind, recv := "func", ""
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				kind, recv = "method", print(d.Recv.List[0].Type)
+			}
+			add(d.Name.Name, kind, print(&sig), d, d.Doc)
+			if recv != "" {
+				sf.Symbols[len(sf.Symbols)-1].Recv = recv
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				// the whole declaration unless it is a group
+				var node ast.Node = spec
+				doc := d.Doc
+				if d.Lparen.IsValid() {
+					doc = nil
+				} else {
+					node = d
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Doc != nil {
+						doc = s.Doc
+					}
+					add(s.Name.Name, "type", "type "+s.Name.Name+" "+typeKind(fset, s), node, doc)
+				case *ast.ValueSpec:
+					if s.Doc != nil {
+						doc = s.Doc
+					}
+					for _, n := range s.Names {
+						add(n.Name, d.Tok.String(), fmt.Sprintf("%s %s", d.Tok, n.Name), node, doc)
+					}
+				}
+			}
+		}
+	}
+	return sf, nil
+}
+
+// typeKind describes the type of a type declaration in a few words.
+func typeKind(fset *token.FileSet, s *ast.TypeSpec) string {
+	switch s.Type.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	var sb strings.Builder
+	if s.Assign.IsValid() {
+		sb.WriteString("= ")
+	}
+	printer.Fprint(&sb, fset, s.Type)
+	kind := sb.String()
+	if i := strings.IndexByte(kind, '\n'); i >= 0 {
+		kind = kind[:i] + " ..."
+	}
+	return kind
+}
+
+// findSymbol returns the symbol by name: "Foo", or "T.Close", "*T.Close"
+// and "(*T).Close" for methods.
+func (sf *SymbolFile) findSymbol(name string) *Symbol {
+	recv, method, ok := strings.Cut(strings.NewReplacer("(", "", ")", "").Replace(name), ".")
+	for _, s := range sf.Symbols {
+		switch {
+		case !ok && s.Recv == "" && s.Name == name:
+			return s
+		case ok && s.Recv != "" && s.Name == method && recvType(s.Recv) == recvType(recv):
+			return s
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"mime"
+	"os"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -96,3 +97,8 @@ func DataURL(mime string, raw []byte) string {
 func PathToResourceURI(path string) string {
 	return "file://" + path
 }
+
+// IsWriteFlag reports whether the open flag allows the file to be modified
+func IsWriteFlag(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+}
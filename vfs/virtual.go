@@ -2,8 +2,8 @@ package vfs
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
-	"os"
 	"time"
 )
 
@@ -13,20 +13,25 @@ type FileSystem interface {
 	FileStore
 
 	ListRoots() ([]string, error)
-	ListDirectory(string) ([]string, error)
+	ListDirectory(string, *ListOptions) (*ListResult, error)
 	CreateDirectory(string) error
 	MoveFile(string, string) error
 	GetFileInfo(string) (*FileInfo, error)
 	DeleteFile(string, bool) error
 	CopyFile(string, string) error
-	EditFile(string, *EditOptions) (int, error)
-	Tree(string, int, bool) (string, error)
-	SearchFiles(string, *SearchOptions) (string, error)
+	EditFile(string, *EditOptions) (*EditResult, error)
+	Tree(string, *TreeOptions) (*FileNode, error)
+	SearchFiles(string, *SearchOptions) (*SearchResult, error)
+	FindFiles(string, *FindOptions) (*FindResult, error)
+	Symbols(string, *SymbolOptions) (*SymbolResult, error)
+	ReadSymbol(string, string) (*SymbolSource, error)
+	Diff(string, string, *DiffOptions) (*DiffResult, error)
 }
 
 type FileStore interface {
 	ReadFile(string, *ReadOptions) ([]byte, error)
-	WriteFile(string, []byte) error
+	OpenReader(string, *ReadOptions) (io.ReadCloser, error)
+	WriteFile(string, []byte, *WriteOptions) error
 
 	// aka:
 	// absolute path for file, endpoint for rest, and url for web
@@ -38,14 +43,41 @@ type FileStat interface {
 	Stat(name string) (fs.FileInfo, error)
 }
 
+// File is a file opened by a workspace, an *os.File or a wrapper of one.
+type File interface {
+	fs.File
+	io.Writer
+	io.StringWriter
+	io.Seeker
+	Name() string
+	Chmod(fs.FileMode) error
+}
+
 type Workspace interface {
 	FileSystem
 	FileStat
 
-	OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
 	ReadDir(name string) ([]fs.DirEntry, error)
 
-	ReadMultipleFiles([]string) ([]string, error)
+	ReadMultipleFiles([]string, *ReadMultipleOptions) (*ReadMultipleResult, error)
+}
+
+// Lookup returns the first workspace of type T in the chain of wrappers
+// starting at ws. Wrappers expose the workspace they wrap with Unwrap.
+func Lookup[T any](ws Workspace) (T, bool) {
+	for ws != nil {
+		if v, ok := ws.(T); ok {
+			return v, true
+		}
+		u, ok := ws.(interface{ Unwrap() Workspace })
+		if !ok {
+			break
+		}
+		ws = u.Unwrap()
+	}
+	var zero T
+	return zero, false
 }
 
 type SearchOptions struct {
@@ -69,6 +101,23 @@ type SearchOptions struct {
 	Follow bool
 	// Search hidden files and directories
 	Hidden bool
+
+	// Lines of context before and after each match. Context sets both
+	// unless they are set.
+	Before  int
+	After   int
+	Context int
+	// Maximum number of matches, or of files with FilesOnly
+	// (default: MAX_SEARCH_RESULTS)
+	MaxResults int
+	// Only report the files with matches and their match counts
+	FilesOnly bool
+	// Use the trigram index to skip files that cannot match, if the
+	// workspace keeps one
+	Index bool
+	// Receive the matches as they are found instead of in the result.
+	// Returning an error stops the search.
+	OnMatch func(*SearchMatch) error
 }
 
 type FileInfo struct {
@@ -0,0 +1,137 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// walkOptions controls which entries walkFiles visits.
+type walkOptions struct {
+	// Maximum depth below the root, unlimited if zero or less
+	Depth int
+	// Walk into symlinked directories
+	Follow bool
+	// Visit hidden files and directories
+	Hidden bool
+	// Do not read .gitignore files
+	NoIgnore bool
+	// Skip entries matching these .gitignore style patterns
+	Exclude []string
+	// Followed symlinks must point to a path allowed by this, if set
+	Allow func(path string) bool
+	// Called for the directories that cannot be read, which are skipped
+	OnError func(path, rel string, err error)
+}
+
+// walkFunc is called with the path of the entry, its slash separated path
+// relative to the root and its depth, 1 for the entries of the root.
+// Symlinks are reported as the target if Follow is set. Returning
+// fs.SkipDir skips a directory and fs.SkipAll stops the walk.
+type walkFunc func(path, rel string, d fs.DirEntry, depth int) error
+
+// walkFiles calls fn for the entries under the root directory in lexical
+// order, skipping hidden, excluded and git ignored entries.
+func walkFiles(root string, o *walkOptions, fn walkFunc) error {
+	if o == nil {
+		o = &walkOptions{}
+	}
+	w := &walker{o: o, fn: fn, visited: make(map[string]bool)}
+	if len(o.Exclude) > 0 {
+		w.exclude = parseIgnore("", strings.Join(o.Exclude, "\n"))
+	}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		w.visited[real] = true
+	}
+	err := w.walk(root, "", 1, nil)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+type walker struct {
+	o  *walkOptions
+	fn walkFunc
+	// excluded regardless of the ignore files
+	exclude *ignoreList
+	// real paths of the directories walked to break symlink loops
+	visited map[string]bool
+}
+
+func (w *walker) walk(dir, rel string, depth int, lists []*ignoreList) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if w.o.OnError != nil {
+			w.o.OnError(dir, rel, err)
+		}
+		return nil
+	}
+
+	if !w.o.NoIgnore {
+		if data, err := os.ReadFile(filepath.Join(dir, ".gitignore")); err == nil {
+			lists = append(slices.Clip(lists), parseIgnore(rel, string(data)))
+		}
+	}
+
+	for _, d := range entries {
+		name := d.Name()
+		if !w.o.Hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if d.Type()&fs.ModeSymlink != 0 && w.o.Follow {
+			info, err := os.Stat(path)
+			if err != nil {
+				// dangling link
+				continue
+			}
+			if w.o.Allow != nil {
+				if real, err := filepath.EvalSymlinks(path); err != nil || !w.o.Allow(real) {
+					continue
+				}
+			}
+			d = fs.FileInfoToDirEntry(info)
+		}
+
+		erel := joinRel(rel, name)
+		if w.exclude != nil && w.exclude.match(erel, d.IsDir()) > 0 || ignored(lists, erel, d.IsDir()) {
+			continue
+		}
+
+		err := w.fn(path, erel, d, depth)
+		if d.IsDir() {
+			if errors.Is(err, fs.SkipDir) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if w.o.Depth > 0 && depth >= w.o.Depth {
+				continue
+			}
+			real, rerr := filepath.EvalSymlinks(path)
+			if rerr != nil || w.visited[real] {
+				continue
+			}
+			w.visited[real] = true
+			if err := w.walk(path, erel, depth+1, lists); err != nil {
+				return err
+			}
+			delete(w.visited, real)
+			continue
+		}
+		if errors.Is(err, fs.SkipDir) {
+			// skip the rest of the directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
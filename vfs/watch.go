@@ -0,0 +1,180 @@
+package vfs
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// version control metadata is never watched
+var (
+	vcsDirs    = []string{".git", ".hg", ".svn"}
+	vcsExclude = []string{".git/", ".hg/", ".svn/"}
+)
+
+// Op is the kind of a file change, a bitmask when changes are combined.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+func (op Op) String() string {
+	var names []string
+	for i, name := range []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD"} {
+		if op&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "NONE"
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a change of a file in the workspace.
+type Event struct {
+	Path string `json:"path"`
+	Op   Op     `json:"op"`
+}
+
+// Watcher is implemented by workspaces notified of file changes.
+type Watcher interface {
+	// Watch reports the changes of the file, or of the entries of the
+	// directory and of its subdirectories if recursive, until the context
+	// is done and the channel is closed. Entries ignored by .gitignore
+	// files and version control metadata are left out.
+	Watch(ctx context.Context, path string, recursive bool) (<-chan Event, error)
+}
+
+// WatchInterval is how often Watch polls workspaces without change
+// notifications.
+var WatchInterval = 500 * time.Millisecond
+
+// Watch reports the changes of the path in the workspace, with its
+// Watcher if it has one and by polling otherwise.
+func Watch(ctx context.Context, ws Workspace, path string, recursive bool) (<-chan Event, error) {
+	if w, ok := Lookup[Watcher](ws); ok {
+		return w.Watch(ctx, path, recursive)
+	}
+	return pollWatch(ctx, ws, path, recursive, WatchInterval)
+}
+
+// fileState is what polling compares to detect changes.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// pollWatch reports changes by comparing snapshots of the path taken
+// every interval.
+func pollWatch(ctx context.Context, ws Workspace, path string, recursive bool, interval time.Duration) (<-chan Event, error) {
+	prev, err := watchSnapshot(ws, path, recursive)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event, 64)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			next, err := watchSnapshot(ws, path, recursive)
+			if err != nil {
+				// the watched path is gone
+				next = map[string]fileState{}
+			}
+			for _, ev := range diffSnapshots(prev, next) {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			prev = next
+		}
+	}()
+	return events, nil
+}
+
+// watchSnapshot returns the state of the file, or of the entries under the
+// directory, by path.
+func watchSnapshot(ws Workspace, path string, recursive bool) (map[string]fileState, error) {
+	info, err := ws.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]fileState)
+	if !info.IsDir() {
+		states[path] = fileState{info.Size(), info.ModTime(), info.Mode()}
+		return states, nil
+	}
+
+	var walk func(dir, rel string, lists []*ignoreList)
+	walk = func(dir, rel string, lists []*ignoreList) {
+		entries, err := ws.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		if data, err := ws.ReadFile(filepath.Join(dir, ".gitignore"), nil); err == nil {
+			lists = append(slices.Clip(lists), parseIgnore(rel, string(data)))
+		}
+		for _, d := range entries {
+			erel := joinRel(rel, d.Name())
+			if d.IsDir() && slices.Contains(vcsDirs, d.Name()) || ignored(lists, erel, d.IsDir()) {
+				continue
+			}
+			p := filepath.Join(dir, d.Name())
+			if info, err := d.Info(); err == nil {
+				states[p] = fileState{info.Size(), info.ModTime(), info.Mode()}
+			}
+			if recursive && d.IsDir() {
+				walk(p, erel, lists)
+			}
+		}
+	}
+	walk(path, "", nil)
+	return states, nil
+}
+
+// diffSnapshots returns the events turning prev into next, in path order.
+func diffSnapshots(prev, next map[string]fileState) []Event {
+	var events []Event
+	for p, s := range next {
+		old, ok := prev[p]
+		var op Op
+		switch {
+		case !ok:
+			op = Create
+		case s.mode.IsDir() && old.mode.IsDir():
+			// entries of directories are reported themselves
+		case s.size != old.size || !s.modTime.Equal(old.modTime):
+			op = Write
+		case s.mode != old.mode:
+			op = Chmod
+		}
+		if op != 0 {
+			events = append(events, Event{Path: p, Op: op})
+		}
+	}
+	for p := range prev {
+		if _, ok := next[p]; !ok {
+			events = append(events, Event{Path: p, Op: Remove})
+		}
+	}
+	slices.SortFunc(events, func(a, b Event) int { return strings.Compare(a.Path, b.Path) })
+	return events
+}
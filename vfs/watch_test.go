@@ -0,0 +1,140 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// expectEvents reads events until the wanted ones, as "OP rel" sorted by
+// path within each batch, were seen or the time is up.
+func expectEvents(t *testing.T, events <-chan Event, dir string, want ...string) {
+	t.Helper()
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed after %q, want %q", got, want)
+			}
+			rel, _ := filepath.Rel(dir, ev.Path)
+			got = append(got, ev.Op.String()+" "+filepath.ToSlash(rel))
+		case <-timeout:
+			t.Fatalf("events = %q, want %q", got, want)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+// expectNoEvents fails if an event arrives within the wait.
+func expectNoEvents(t *testing.T, events <-chan Event, wait time.Duration) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %v %s", ev.Op, ev.Path)
+	case <-time.After(wait):
+	}
+}
+
+func TestOpString(t *testing.T) {
+	for op, want := range map[Op]string{0: "NONE", Create: "CREATE", Write | Chmod: "WRITE|CHMOD"} {
+		if op.String() != want {
+			t.Errorf("%d = %s, want %s", op, op, want)
+		}
+	}
+}
+
+func TestPollWatch(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{
+		".gitignore": "*.log\n",
+		"a.txt":      "a\n",
+		"d/b.txt":    "b\n",
+		".git/":      "",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := pollWatch(ctx, ws, dir, true, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(path("ignored.log"), []byte("x"), 0o644)
+	os.WriteFile(path(".git/HEAD"), []byte("x"), 0o644)
+	os.WriteFile(path("c.txt"), []byte("c\n"), 0o644)
+	expectEvents(t, events, dir, "CREATE c.txt")
+
+	os.WriteFile(path("d/b.txt"), []byte("changed\n"), 0o644)
+	expectEvents(t, events, dir, "WRITE d/b.txt")
+
+	os.Chmod(path("a.txt"), 0o600)
+	expectEvents(t, events, dir, "CHMOD a.txt")
+
+	os.RemoveAll(path("d"))
+	expectEvents(t, events, dir, "REMOVE d", "REMOVE d/b.txt")
+
+	os.MkdirAll(path("e/f"), 0o755)
+	expectEvents(t, events, dir, "CREATE e", "CREATE e/f")
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestPollWatchFile(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	path := filepath.Join(dir, "a.txt")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := pollWatch(ctx, ws, path, false, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("other\n"), 0o644)
+	expectNoEvents(t, events, 50*time.Millisecond)
+
+	os.WriteFile(path, []byte("changed\n"), 0o644)
+	expectEvents(t, events, dir, "WRITE a.txt")
+
+	os.Remove(path)
+	expectEvents(t, events, dir, "REMOVE a.txt")
+
+	// a replacement is reported as the file comes back
+	os.WriteFile(path, []byte("new\n"), 0o644)
+	expectEvents(t, events, dir, "CREATE a.txt")
+
+	if _, err := pollWatch(ctx, ws, filepath.Join(dir, "missing"), false, time.Second); err == nil {
+		t.Error("watched a missing file")
+	}
+}
+
+func TestWatchWorkspace(t *testing.T) {
+	dir, ws := newLocal(t, map[string]string{"a.txt": "a\n"})
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := Watch(ctx, ws, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b\n"), 0o644)
+	expectEvents(t, events, dir, "CREATE b.txt")
+
+	// the channel is closed once the context is done
+	cancel()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("events not closed")
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package vnet is the network of the virtual system: the HTTP clients of
+// the commands, restricted by a policy.
+package vnet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrHostNotAllowed is returned for requests to hosts outside the
+	// allow-list of the policy.
+	ErrHostNotAllowed = errors.New("host not allowed")
+	// ErrTooLarge is returned when reading more than MaxBytes of a body.
+	ErrTooLarge = errors.New("response too large")
+)
+
+// Policy restricts the network access of the commands. A nil policy, as
+// the zero value, allows every host without limits.
+type Policy struct {
+	// Hosts the commands may connect to, all if empty. An entry is a host
+	// name, "*.example.com" for the subdomains of example.com, an IP
+	// address or a CIDR range such as "10.0.0.0/8". Names are matched as
+	// they are written in the URLs, not resolved.
+	AllowHosts []string
+	// Maximum size of a response body in bytes, unlimited if 0. Bodies
+	// are streamed to stdout or to the files of the workspace, so without
+	// it a download is only bounded by the disk.
+	MaxBytes int64
+	// Maximum duration of a request, with its redirects and body; none if 0
+	Timeout time.Duration
+}
+
+// PolicyFromEnv returns the policy configured by the environment, nil if
+// none of its variables is set:
+//
+//	GOSH_NETWORK_HOSTS      comma separated entries of AllowHosts
+//	GOSH_NETWORK_MAX_BYTES  MaxBytes
+//	GOSH_NETWORK_TIMEOUT    Timeout, such as "30s"
+func PolicyFromEnv() (*Policy, error) {
+	hosts := os.Getenv("GOSH_NETWORK_HOSTS")
+	maxBytes := os.Getenv("GOSH_NETWORK_MAX_BYTES")
+	timeout := os.Getenv("GOSH_NETWORK_TIMEOUT")
+	if hosts == "" && maxBytes == "" && timeout == "" {
+		return nil, nil
+	}
+	p := &Policy{}
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			p.AllowHosts = append(p.AllowHosts, h)
+		}
+	}
+	if maxBytes != "" {
+		n, err := strconv.ParseInt(maxBytes, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid GOSH_NETWORK_MAX_BYTES %q", maxBytes)
+		}
+		p.MaxBytes = n
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid GOSH_NETWORK_TIMEOUT %q", timeout)
+		}
+		p.Timeout = d
+	}
+	return p, nil
+}
+
+// Allow returns an error wrapping ErrHostNotAllowed unless host, without
+// its port, may be connected to.
+func (p *Policy) Allow(host string) error {
+	if p == nil || len(p.AllowHosts) == 0 {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	for _, entry := range p.AllowHosts {
+		entry = strings.ToLower(strings.TrimSuffix(entry, "."))
+		switch {
+		case ip != nil:
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && cidr.Contains(ip) {
+				return nil
+			}
+			if e := net.ParseIP(entry); e != nil && e.Equal(ip) {
+				return nil
+			}
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(host, entry[1:]) {
+				return nil
+			}
+		case host == entry:
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+}
+
+// Transport returns rt checking each request, redirects included,
+// against the policy. rt is http.DefaultTransport if nil.
+func (p *Policy) Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{policy: p, rt: rt}
+}
+
+// Client returns an HTTP client following the policy, which otherwise
+// behaves as http.DefaultClient.
+func (p *Policy) Client() *http.Client {
+	c := &http.Client{Transport: p.Transport(nil)}
+	if p != nil {
+		c.Timeout = p.Timeout
+	}
+	return c
+}
+
+// Body limits body to MaxBytes, reading more fails with ErrTooLarge.
+func (p *Policy) Body(body io.ReadCloser) io.ReadCloser {
+	if p == nil || p.MaxBytes <= 0 {
+		return body
+	}
+	return &limitedBody{ReadCloser: body, n: p.MaxBytes}
+}
+
+type transport struct {
+	policy *Policy
+	rt     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.Allow(req.URL.Hostname()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// limitedBody reads up to n more bytes of a body.
+type limitedBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		// fail only if there is more to read
+		var one [1]byte
+		for {
+			n, err := b.ReadCloser.Read(one[:])
+			if n > 0 {
+				return 0, ErrTooLarge
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if int64(len(p)) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,74 @@
+package vnet
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPolicyFromEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name                     string
+		hosts, maxBytes, timeout string
+		want                     *Policy
+		err                      bool
+	}{
+		{name: "unset"},
+		{
+			name:  "hosts",
+			hosts: "example.com, *.example.org,,10.0.0.0/8",
+			want:  &Policy{AllowHosts: []string{"example.com", "*.example.org", "10.0.0.0/8"}},
+		},
+		{
+			name:     "limits",
+			maxBytes: "1024",
+			timeout:  "30s",
+			want:     &Policy{MaxBytes: 1024, Timeout: 30 * time.Second},
+		},
+		{name: "invalid max bytes", maxBytes: "1k", err: true},
+		{name: "negative max bytes", maxBytes: "-1", err: true},
+		{name: "invalid timeout", timeout: "30", err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOSH_NETWORK_HOSTS", tt.hosts)
+			t.Setenv("GOSH_NETWORK_MAX_BYTES", tt.maxBytes)
+			t.Setenv("GOSH_NETWORK_TIMEOUT", tt.timeout)
+			got, err := PolicyFromEnv()
+			if tt.err != (err != nil) {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyFromEnvDenied(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	t.Setenv("GOSH_NETWORK_HOSTS", "example.com")
+	t.Setenv("GOSH_NETWORK_MAX_BYTES", "")
+	t.Setenv("GOSH_NETWORK_TIMEOUT", "")
+	p, err := PolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Client().Get(srv.URL); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("error = %v, want %v", err, ErrHostNotAllowed)
+	}
+
+	t.Setenv("GOSH_NETWORK_HOSTS", "example.com,127.0.0.0/8")
+	if p, err = PolicyFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := p.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}